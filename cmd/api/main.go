@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/davidcohan/port-authorizing/internal/api"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/logging"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 )
 
 func main() {
@@ -18,28 +21,48 @@ func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Server logs are separate from the audit log
+	if err := logging.Configure(cfg.Logging.LogLevel, cfg.Logging.LogFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	logger := logging.Component("server")
+
+	// Export traces when observability.otlp_endpoint is set (a no-op otherwise)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Observability)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid observability configuration: %v\n", err)
+		os.Exit(1)
 	}
 
 	// Create and start API server
 	server, err := api.NewServer(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		logger.Error("failed to create server", "error", err)
+		os.Exit(1)
 	}
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting API server on port %d", cfg.Server.Port)
+		logger.Info("starting API server", "port", cfg.Server.Port)
 		if err := server.Start(); err != nil {
-			log.Fatalf("Server error: %v", err)
+			logger.Error("server error", "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	sig := <-sigChan
 
-	log.Println("Shutting down gracefully...")
+	logger.Info("shutting down gracefully", "signal", sig.String())
 	_ = server.Shutdown()
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Warn("failed to flush traces", "error", err)
+	}
 }
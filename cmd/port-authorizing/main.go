@@ -33,11 +33,23 @@ with centralized authentication, role-based authorization, and query whitelistin
 	}
 	serverCmd.Flags().String("config", "config.yaml", "Path to configuration file")
 
-	// Client commands (login, list, connect, context)
+	// Validate command
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a server configuration file",
+		Long:  "Load and validate a server configuration file without starting the server, reporting every problem found",
+		RunE:  server.RunValidate,
+	}
+	validateCmd.Flags().String("config", "config.yaml", "Path to configuration file")
+
+	// Client commands (login, logout, whoami, list, connect, context)
 	loginCmd := cli.NewLoginCmd()
+	logoutCmd := cli.NewLogoutCmd()
+	whoamiCmd := cli.NewWhoamiCmd()
 	listCmd := cli.NewListCmd()
 	connectCmd := cli.NewConnectCmd()
 	contextCmd := cli.NewContextCmd()
+	approvalsCmd := cli.NewApprovalsCmd()
 
 	// Version command
 	versionCmd := &cobra.Command{
@@ -52,10 +64,14 @@ with centralized authentication, role-based authorization, and query whitelistin
 
 	// Add commands
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(whoamiCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(connectCmd)
 	rootCmd.AddCommand(contextCmd)
+	rootCmd.AddCommand(approvalsCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	// Global flags
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// redactedValue replaces secrets in audited diffs; a changed secret still shows up as changed
+const redactedValue = "********"
+
+// sensitiveFieldMarkers are substrings of field names (lowercased, underscores removed) whose values are never audited.
+// Numeric and boolean values are left alone so settings like token_expiry stay readable.
+var sensitiveFieldMarkers = []string{"password", "secret", "apikey", "routingkey", "token", "webhookurl"}
+
+// FieldChange is the before/after value of one field in an audited admin mutation
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// logAdminChange audits a successful admin mutation with a redacted field-level diff.
+// Actions are named config.<entity>.<verb> (e.g. config.connection.update); before is
+// nil for creates and after is nil for deletes.
+func (s *Server) logAdminChange(r *http.Request, action, entityType, name string, before, after interface{}) {
+	actor, _ := r.Context().Value(ContextKeyUsername).(string)
+
+	_ = audit.Log(s.GetConfig().Logging.AuditLogPath, actor, action, name, map[string]interface{}{
+		"entity_type": entityType,
+		"entity":      name,
+		"changes":     diffFields(toFieldMap(before), toFieldMap(after), sensitiveKeys(before, after)),
+	})
+}
+
+// toFieldMap flattens v to its top-level JSON fields (nil for a nil value)
+func toFieldMap(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// Not an object (e.g. a bare value): audit it as a single field
+		var value interface{}
+		_ = json.Unmarshal(data, &value)
+		return map[string]interface{}{"value": value}
+	}
+	return fields
+}
+
+// sensitiveKeys returns the JSON keys of struct fields in the given values whose Go name,
+// json tag or yaml tag marks a credential. A field may be tagged for yaml only (and so
+// marshal under its Go name), or carry a json name that hides what it holds.
+func sensitiveKeys(values ...interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	seen := make(map[reflect.Type]bool)
+	for _, v := range values {
+		if v != nil {
+			collectSensitiveKeys(reflect.TypeOf(v), keys, seen)
+		}
+	}
+	return keys
+}
+
+func collectSensitiveKeys(t reflect.Type, keys map[string]bool, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		jsonName := tagName(field.Tag.Get("json"))
+		if jsonName == "-" {
+			continue
+		}
+		key := field.Name
+		if jsonName != "" {
+			key = jsonName
+		}
+		if isSensitiveField(field.Name) || isSensitiveField(jsonName) || isSensitiveField(tagName(field.Tag.Get("yaml"))) {
+			keys[key] = true
+		}
+		collectSensitiveKeys(field.Type, keys, seen)
+	}
+}
+
+// tagName returns the name part of a struct tag value ("name,omitempty" -> "name")
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// diffFields returns the fields whose values differ between before and after,
+// with sensitive values (by name or in sensitive) redacted
+func diffFields(before, after map[string]interface{}, sensitive map[string]bool) map[string]FieldChange {
+	names := make(map[string]bool, len(before)+len(after))
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	changes := make(map[string]FieldChange)
+	for _, name := range sorted {
+		oldValue, newValue := before[name], after[name]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes[name] = FieldChange{
+			Before: redactField(name, oldValue, sensitive),
+			After:  redactField(name, newValue, sensitive),
+		}
+	}
+	return changes
+}
+
+// redactField masks the value of a sensitive field, recursing into nested objects and lists.
+// Credentials embedded in URLs are masked wherever they appear.
+func redactField(name string, value interface{}, sensitive map[string]bool) interface{} {
+	switch value.(type) {
+	case nil:
+		return nil
+	case float64, bool:
+		return value
+	}
+	if sensitive[name] || isSensitiveField(name) {
+		if s, ok := value.(string); ok && s == "" {
+			return ""
+		}
+		return redactedValue
+	}
+
+	switch v := value.(type) {
+	case string:
+		return redactURL(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			redacted[key] = redactField(key, nested, sensitive)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, nested := range v {
+			redacted[i] = redactField("", nested, sensitive)
+		}
+		return redacted
+	}
+	return value
+}
+
+// redactURL masks the password and sensitive query parameters of a URL; any other
+// string is returned unchanged
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return value
+	}
+
+	changed := false
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+		changed = true
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if isSensitiveField(key) || strings.EqualFold(key, "key") || strings.EqualFold(key, "sig") {
+				query.Set(key, redactedValue)
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	if !changed {
+		return value
+	}
+	return u.String()
+}
+
+// isSensitiveField reports whether a JSON field name holds a credential
+func isSensitiveField(name string) bool {
+	name = strings.ReplaceAll(strings.ToLower(name), "_", "")
+	for _, marker := range sensitiveFieldMarkers {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
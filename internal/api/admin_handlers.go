@@ -2,14 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
 	"github.com/davidcohan/port-authorizing/internal/security"
 	"github.com/gorilla/mux"
 )
@@ -17,8 +21,10 @@ import (
 // Configuration Management Handlers
 
 // handleGetConfig returns the current configuration
+// The ETag header carries the stored version, to send back as If-Match when saving.
 func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	cfg := s.GetConfig()
+	s.setConfigETag(w, r)
 
 	// Sanitize sensitive data
 	sanitized := sanitizeConfig(cfg)
@@ -29,10 +35,16 @@ func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	var newCfg config.Config
 	if err := json.NewDecoder(r.Body).Decode(&newCfg); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid configuration format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid configuration format")
 		return
 	}
 
+	if !validateConfig(w, &newCfg) {
+		return
+	}
+
+	before := s.GetConfig()
+
 	// Get comment from query parameter
 	comment := r.URL.Query().Get("comment")
 	if comment == "" {
@@ -44,30 +56,135 @@ func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	comment = fmt.Sprintf("%s (by %s)", comment, username)
 
 	// Save configuration
-	if err := s.storageBackend.Save(r.Context(), &newCfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save configuration: %v", err))
+	if !s.saveConfig(w, r, &newCfg, comment) {
 		return
 	}
 
 	// Reload configuration
 	if err := s.ReloadConfig(&newCfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload configuration: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload configuration: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.update", "config", "config", before, &newCfg)
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Configuration updated successfully",
 		"comment": comment,
 	})
 }
 
+// handleValidateConfig checks a configuration without saving it (dry run)
+func (s *Server) handleValidateConfig(w http.ResponseWriter, r *http.Request) {
+	var cfg config.Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid configuration format")
+		return
+	}
+
+	problems := validationProblems(config.Validate(&cfg))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
+// validateConfig responds 422 with every problem found when cfg is invalid
+// Returns true if the config may be saved.
+func validateConfig(w http.ResponseWriter, cfg *config.Config) bool {
+	problems := validationProblems(config.Validate(cfg))
+	if len(problems) == 0 {
+		return true
+	}
+
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":    apiError{Code: ErrCodeConfigInvalid, Message: "Configuration is invalid"},
+		"problems": problems,
+	})
+	return false
+}
+
+// validationProblems converts a config.Validate error into a list of field problems
+func validationProblems(err error) config.ValidationErrors {
+	if err == nil {
+		return config.ValidationErrors{}
+	}
+	var validationErrs config.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return validationErrs
+	}
+	return config.ValidationErrors{{Field: "config", Message: err.Error()}}
+}
+
+// saveConfig saves cfg to the storage backend. If the request has an If-Match
+// header (the ETag from an earlier read) the save only succeeds if nobody changed
+// the stored configuration since, and responds 409 otherwise. On success the
+// new version is set as the ETag header. Returns true if the config was saved.
+func (s *Server) saveConfig(w http.ResponseWriter, r *http.Request, cfg *config.Config, comment string) bool {
+	var err error
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		expected := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		err = s.storageBackend.SaveIfVersion(r.Context(), cfg, expected, comment)
+	} else {
+		err = s.storageBackend.Save(r.Context(), cfg, comment)
+	}
+
+	if errors.Is(err, config.ErrVersionConflict) {
+		respondError(w, http.StatusConflict, ErrCodeConfigConflict, "Configuration was changed by someone else since it was loaded; reload and try again")
+		return false
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to save configuration: %v", err))
+		return false
+	}
+
+	s.setConfigETag(w, r)
+	return true
+}
+
+// setConfigETag sets the ETag header to the stored configuration version
+func (s *Server) setConfigETag(w http.ResponseWriter, r *http.Request) {
+	version, err := s.storageBackend.CurrentVersion(r.Context())
+	if err != nil || version == "" {
+		return
+	}
+	w.Header().Set("ETag", `"`+version+`"`)
+}
+
+// configForUpdate returns a copy of the current configuration for handlers to
+// modify, so the live config is untouched if validation or saving fails
+func (s *Server) configForUpdate() *config.Config {
+	current := s.GetConfig()
+	cfg := *current
+	cfg.Auth.Users = append([]config.User(nil), current.Auth.Users...)
+	cfg.Connections = append([]config.ConnectionConfig(nil), current.Connections...)
+	cfg.Policies = append([]config.RolePolicy(nil), current.Policies...)
+	if current.Approval != nil {
+		approval := *current.Approval
+		approval.Patterns = append([]config.ApprovalPatternConfig(nil), current.Approval.Patterns...)
+		if approval.Webhook != nil {
+			webhook := *approval.Webhook
+			approval.Webhook = &webhook
+		}
+		if approval.Slack != nil {
+			slack := *approval.Slack
+			approval.Slack = &slack
+		}
+		cfg.Approval = &approval
+	}
+	return &cfg
+}
+
 // handleListConfigVersions lists available configuration versions
 func (s *Server) handleListConfigVersions(w http.ResponseWriter, r *http.Request) {
 	versions, err := s.storageBackend.ListVersions(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list versions: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to list versions: %v", err))
 		return
 	}
+	if len(versions) > 0 && versions[0].ETag != "" {
+		w.Header().Set("ETag", `"`+versions[0].ETag+`"`)
+	}
 
 	respondJSON(w, http.StatusOK, versions)
 }
@@ -79,7 +196,7 @@ func (s *Server) handleGetConfigVersion(w http.ResponseWriter, r *http.Request)
 
 	cfg, err := s.storageBackend.LoadVersion(r.Context(), versionID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, fmt.Sprintf("Version not found: %v", err))
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("Version not found: %v", err))
 		return
 	}
 
@@ -91,26 +208,30 @@ func (s *Server) handleGetConfigVersion(w http.ResponseWriter, r *http.Request)
 func (s *Server) handleRollbackConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	versionID := vars["id"]
+	before := s.GetConfig()
 
 	_, err := s.storageBackend.Rollback(r.Context(), versionID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to rollback: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to rollback: %v", err))
 		return
 	}
 
 	// Load the rolled back configuration
 	cfg, err := s.storageBackend.Load(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load configuration: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to load configuration: %v", err))
 		return
 	}
 
 	// Reload the server
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload configuration: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload configuration: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.rollback", "config", versionID, before, cfg)
+	s.setConfigETag(w, r)
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message":    "Configuration rolled back successfully",
 		"version_id": versionID,
@@ -161,6 +282,7 @@ func toConnectionResponse(conn config.ConnectionConfig) ConnectionResponse {
 
 // handleListAllConnections lists all configured connections (admin view)
 func (s *Server) handleListAllConnections(w http.ResponseWriter, r *http.Request) {
+	s.setConfigETag(w, r)
 	cfg := s.GetConfig()
 
 	// Convert connections to response format with duration as string
@@ -177,7 +299,7 @@ func (s *Server) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 	// Decode into a generic map first to handle duration as string
 	var rawConn map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&rawConn); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 		return
 	}
 
@@ -189,26 +311,26 @@ func (s *Server) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 	if durationStr, ok := rawConn["duration"].(string); ok && durationStr != "" {
 		duration, err := time.ParseDuration(durationStr)
 		if err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid duration format: %v. Use formats like 30m, 2h, 1h30m", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid duration format: %v. Use formats like 30m, 2h, 1h30m", err))
 			return
 		}
 		delete(rawConn, "duration")
 		jsonBytes, _ = json.Marshal(rawConn)
 		if err := json.Unmarshal(jsonBytes, &conn); err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 			return
 		}
 		conn.Duration = duration
 	} else {
 		if err := json.Unmarshal(jsonBytes, &conn); err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 			return
 		}
 	}
 
 	// Validate connection
 	if conn.Name == "" || conn.Type == "" || conn.Host == "" || conn.Port == 0 {
-		respondError(w, http.StatusBadRequest, "Missing required fields: name, type, host, port")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing required fields: name, type, host, port")
 		return
 	}
 
@@ -216,17 +338,17 @@ func (s *Server) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 	if conn.Metadata != nil && len(conn.Metadata) > 0 {
 		description, ok := conn.Metadata["description"]
 		if !ok || description == "" {
-			respondError(w, http.StatusBadRequest, "Metadata must include a 'description' field")
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Metadata must include a 'description' field")
 			return
 		}
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Check if connection already exists
 	for _, existing := range cfg.Connections {
 		if existing.Name == conn.Name {
-			respondError(w, http.StatusConflict, "Connection with this name already exists")
+			respondError(w, http.StatusConflict, ErrCodeAlreadyExists, "Connection with this name already exists")
 			return
 		}
 	}
@@ -234,19 +356,24 @@ func (s *Server) handleCreateConnection(w http.ResponseWriter, r *http.Request)
 	// Add connection
 	cfg.Connections = append(cfg.Connections, conn)
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Added connection %s (by %s)", conn.Name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.connection.create", "connection", conn.Name, nil, conn)
+
 	respondJSON(w, http.StatusCreated, toConnectionResponse(conn))
 }
 
@@ -258,7 +385,7 @@ func (s *Server) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	// Decode into a generic map first to handle duration as string
 	var rawConn map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&rawConn); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 		return
 	}
 
@@ -270,19 +397,19 @@ func (s *Server) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	if durationStr, ok := rawConn["duration"].(string); ok && durationStr != "" {
 		duration, err := time.ParseDuration(durationStr)
 		if err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid duration format: %v. Use formats like 30m, 2h, 1h30m", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid duration format: %v. Use formats like 30m, 2h, 1h30m", err))
 			return
 		}
 		delete(rawConn, "duration")
 		jsonBytes, _ = json.Marshal(rawConn)
 		if err := json.Unmarshal(jsonBytes, &updatedConn); err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 			return
 		}
 		updatedConn.Duration = duration
 	} else {
 		if err := json.Unmarshal(jsonBytes, &updatedConn); err != nil {
-			respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection format: %v", err))
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid connection format: %v", err))
 			return
 		}
 	}
@@ -291,17 +418,20 @@ func (s *Server) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	if updatedConn.Metadata != nil && len(updatedConn.Metadata) > 0 {
 		description, ok := updatedConn.Metadata["description"]
 		if !ok || description == "" {
-			respondError(w, http.StatusBadRequest, "Metadata must include a 'description' field")
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Metadata must include a 'description' field")
 			return
 		}
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and update connection
 	found := false
+	var before config.ConnectionConfig
 	for i, conn := range cfg.Connections {
 		if conn.Name == name {
+			before = conn
+
 			// Preserve the original name if not provided
 			if updatedConn.Name == "" {
 				updatedConn.Name = name
@@ -319,23 +449,28 @@ func (s *Server) handleUpdateConnection(w http.ResponseWriter, r *http.Request)
 	}
 
 	if !found {
-		respondError(w, http.StatusNotFound, "Connection not found")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found")
+		return
+	}
+
+	if !validateConfig(w, cfg) {
 		return
 	}
 
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Updated connection %s (by %s)", name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.connection.update", "connection", name, before, updatedConn)
+
 	respondJSON(w, http.StatusOK, toConnectionResponse(updatedConn))
 }
 
@@ -344,21 +479,23 @@ func (s *Server) handleDeleteConnection(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and remove connection
 	found := false
+	var removed config.ConnectionConfig
 	newConnections := []config.ConnectionConfig{}
 	for _, conn := range cfg.Connections {
 		if conn.Name == name {
 			found = true
+			removed = conn
 			continue
 		}
 		newConnections = append(newConnections, conn)
 	}
 
 	if !found {
-		respondError(w, http.StatusNotFound, "Connection not found")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found")
 		return
 	}
 
@@ -367,16 +504,17 @@ func (s *Server) handleDeleteConnection(w http.ResponseWriter, r *http.Request)
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Deleted connection %s (by %s)", name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.connection.delete", "connection", name, removed, nil)
+
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Connection deleted successfully"})
 }
 
@@ -384,6 +522,7 @@ func (s *Server) handleDeleteConnection(w http.ResponseWriter, r *http.Request)
 
 // handleListUsers lists all local users
 func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	s.setConfigETag(w, r)
 	cfg := s.GetConfig()
 
 	// Sanitize passwords
@@ -407,23 +546,28 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request format")
 		return
 	}
 
 	if req.Username == "" || req.Password == "" {
-		respondError(w, http.StatusBadRequest, "Username and password are required")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Username and password are required")
 		return
 	}
 
-	cfg := s.GetConfig()
+	username, err := config.NormalizeUsername(req.Username)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid username: %v", err))
+		return
+	}
+	req.Username = username
 
-	// Check if user already exists
-	for _, user := range cfg.Auth.Users {
-		if user.Username == req.Username {
-			respondError(w, http.StatusConflict, "User already exists")
-			return
-		}
+	cfg := s.configForUpdate()
+
+	// Check if user already exists (usernames are unique regardless of case)
+	if findUser(cfg, req.Username) >= 0 {
+		respondError(w, http.StatusConflict, ErrCodeAlreadyExists, "User already exists")
+		return
 	}
 
 	// Add user
@@ -435,25 +579,40 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	cfg.Auth.Users = append(cfg.Auth.Users, newUser)
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	// Save and reload
-	username := r.Context().Value(ContextKeyUsername).(string)
-	comment := fmt.Sprintf("Added user %s (by %s)", req.Username, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	adminUsername := r.Context().Value(ContextKeyUsername).(string)
+	comment := fmt.Sprintf("Added user %s (by %s)", req.Username, adminUsername)
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.user.create", "user", req.Username, nil, newUser)
+
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"username": req.Username,
 		"roles":    req.Roles,
 	})
 }
 
+// findUser returns the index of a local user, matching usernames case-insensitively, or -1
+func findUser(cfg *config.Config, username string) int {
+	for i, user := range cfg.Auth.Users {
+		if config.SameUsername(user.Username, username) {
+			return i
+		}
+	}
+	return -1
+}
+
 // handleUpdateUser updates an existing user
 func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -465,48 +624,49 @@ func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request format")
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and update user
-	found := false
-	for i, user := range cfg.Auth.Users {
-		if user.Username == username {
-			// Update roles
-			cfg.Auth.Users[i].Roles = req.Roles
-
-			// Update password if provided
-			// Note: Passwords are stored in plain text for operational requirements
-			if req.Password != nil && *req.Password != "" {
-				cfg.Auth.Users[i].Password = *req.Password
-			}
+	i := findUser(cfg, username)
+	if i < 0 {
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
+		return
+	}
+	before := cfg.Auth.Users[i]
+	username = before.Username
 
-			found = true
-			break
-		}
+	// Update roles
+	cfg.Auth.Users[i].Roles = req.Roles
+
+	// Update password if provided
+	// Note: Passwords are stored in plain text for operational requirements
+	if req.Password != nil && *req.Password != "" {
+		cfg.Auth.Users[i].Password = *req.Password
 	}
+	after := cfg.Auth.Users[i]
 
-	if !found {
-		respondError(w, http.StatusNotFound, "User not found")
+	if !validateConfig(w, cfg) {
 		return
 	}
 
 	// Save and reload
 	adminUsername := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Updated user %s (by %s)", username, adminUsername)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.user.update", "user", username, before, after)
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"username": username,
 		"roles":    req.Roles,
@@ -518,39 +678,34 @@ func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	username := vars["username"]
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and remove user
-	found := false
-	newUsers := []config.User{}
-	for _, user := range cfg.Auth.Users {
-		if user.Username == username {
-			found = true
-			continue
-		}
-		newUsers = append(newUsers, user)
-	}
-
-	if !found {
-		respondError(w, http.StatusNotFound, "User not found")
+	i := findUser(cfg, username)
+	if i < 0 {
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "User not found")
 		return
 	}
+	removed := cfg.Auth.Users[i]
+	username = removed.Username
 
-	cfg.Auth.Users = newUsers
+	newUsers := append([]config.User{}, cfg.Auth.Users[:i]...)
+	cfg.Auth.Users = append(newUsers, cfg.Auth.Users[i+1:]...)
 
 	// Save and reload
 	adminUsername := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Deleted user %s (by %s)", username, adminUsername)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.user.delete", "user", username, removed, nil)
+
 	respondJSON(w, http.StatusOK, map[string]string{"message": "User deleted successfully"})
 }
 
@@ -558,6 +713,7 @@ func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 
 // handleListPolicies lists all policies
 func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
+	s.setConfigETag(w, r)
 	cfg := s.GetConfig()
 	respondJSON(w, http.StatusOK, cfg.Policies)
 }
@@ -566,21 +722,21 @@ func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 	var policy config.RolePolicy
 	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid policy format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid policy format")
 		return
 	}
 
 	if policy.Name == "" {
-		respondError(w, http.StatusBadRequest, "Policy name is required")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Policy name is required")
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Check if policy already exists
 	for _, existing := range cfg.Policies {
 		if existing.Name == policy.Name {
-			respondError(w, http.StatusConflict, "Policy with this name already exists")
+			respondError(w, http.StatusConflict, ErrCodeAlreadyExists, "Policy with this name already exists")
 			return
 		}
 	}
@@ -588,19 +744,24 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 	// Add policy
 	cfg.Policies = append(cfg.Policies, policy)
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Added policy %s (by %s)", policy.Name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.policy.create", "policy", policy.Name, nil, policy)
+
 	respondJSON(w, http.StatusCreated, policy)
 }
 
@@ -611,16 +772,19 @@ func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 
 	var updatedPolicy config.RolePolicy
 	if err := json.NewDecoder(r.Body).Decode(&updatedPolicy); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid policy format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid policy format")
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and update policy
 	found := false
+	var before config.RolePolicy
 	for i, policy := range cfg.Policies {
 		if policy.Name == name {
+			before = policy
+
 			// Preserve the original name if not provided
 			if updatedPolicy.Name == "" {
 				updatedPolicy.Name = name
@@ -632,23 +796,28 @@ func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !found {
-		respondError(w, http.StatusNotFound, "Policy not found")
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "Policy not found")
+		return
+	}
+
+	if !validateConfig(w, cfg) {
 		return
 	}
 
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Updated policy %s (by %s)", name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.policy.update", "policy", name, before, updatedPolicy)
+
 	respondJSON(w, http.StatusOK, updatedPolicy)
 }
 
@@ -657,21 +826,23 @@ func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 
 	// Find and remove policy
 	found := false
+	var removed config.RolePolicy
 	newPolicies := []config.RolePolicy{}
 	for _, policy := range cfg.Policies {
 		if policy.Name == name {
 			found = true
+			removed = policy
 			continue
 		}
 		newPolicies = append(newPolicies, policy)
 	}
 
 	if !found {
-		respondError(w, http.StatusNotFound, "Policy not found")
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "Policy not found")
 		return
 	}
 
@@ -680,144 +851,130 @@ func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
 	// Save and reload
 	username := r.Context().Value(ContextKeyUsername).(string)
 	comment := fmt.Sprintf("Deleted policy %s (by %s)", name, username)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.policy.delete", "policy", name, removed, nil)
+
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Policy deleted successfully"})
 }
 
+// PolicyAccessDiff lists the connections a user would gain or lose under a proposed policy set
+type PolicyAccessDiff struct {
+	Roles   []string `json:"roles"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// handleSimulatePolicies compares connection access for every local user under
+// a proposed policy set against the current policies. Nothing is saved or reloaded.
+func (s *Server) handleSimulatePolicies(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Policies []config.RolePolicy `json:"policies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid policy format")
+		return
+	}
+
+	proposed := s.configForUpdate()
+	proposed.Policies = req.Policies
+	proposedAuthz := authorization.NewAuthorizer(proposed)
+
+	changes := make(map[string]PolicyAccessDiff)
+	for _, user := range proposed.Auth.Users {
+		before := s.authz.ListAccessibleConnections(user.Roles)
+		after := proposedAuthz.ListAccessibleConnections(user.Roles)
+
+		diff := PolicyAccessDiff{
+			Roles:   user.Roles,
+			Added:   connectionsDifference(after, before),
+			Removed: connectionsDifference(before, after),
+		}
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			changes[user.Username] = diff
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"users":         changes,
+		"users_checked": len(proposed.Auth.Users),
+		"problems":      validationProblems(config.Validate(proposed)),
+	})
+}
+
+// connectionsDifference returns the sorted names in a that are not in b
+func connectionsDifference(a, b []string) []string {
+	exclude := make(map[string]bool, len(b))
+	for _, name := range b {
+		exclude[name] = true
+	}
+
+	result := []string{}
+	for _, name := range a {
+		if !exclude[name] {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 // Audit Log Handlers
 
 // handleGetAuditLogs returns audit logs with filtering and pagination
 func (s *Server) handleGetAuditLogs(w http.ResponseWriter, r *http.Request) {
 	cfg := s.GetConfig()
-	auditLogPath := cfg.Logging.AuditLogPath
 
 	// Parse query parameters for filtering
-	username := r.URL.Query().Get("username")
-	action := r.URL.Query().Get("action")
-	connection := r.URL.Query().Get("connection")
-
-	var logs []string
-	var totalCount int
-
-	// If audit goes to stdout or memory, use in-memory buffer
-	if auditLogPath == "stdout" || auditLogPath == "-" {
-		// Use in-memory buffer
-		recentLogs := audit.GetRecentLogs(1000)
-		for _, entry := range recentLogs {
-			// Filter
-			if username != "" && entry.Username != username {
-				continue
-			}
-			if action != "" && entry.Action != action {
-				continue
-			}
-			if connection != "" && entry.Resource != connection {
-				continue
-			}
-
-			// Format as JSON string for display
-			logJSON, _ := json.Marshal(entry)
-			logs = append(logs, string(logJSON))
-		}
-		totalCount = len(logs)
-	} else {
-		// Read from file
-		data, err := os.ReadFile(auditLogPath)
-		if err != nil {
-			// Fallback to memory if file not readable
-			recentLogs := audit.GetRecentLogs(1000)
-			for _, entry := range recentLogs {
-				if username != "" && entry.Username != username {
-					continue
-				}
-				if action != "" && entry.Action != action {
-					continue
-				}
-				if connection != "" && entry.Resource != connection {
-					continue
-				}
-				logJSON, _ := json.Marshal(entry)
-				logs = append(logs, string(logJSON))
-			}
-			totalCount = len(logs)
-		} else {
-			// Parse file contents
-			lines := strings.Split(string(data), "\n")
-
-			for _, line := range lines {
-				if line == "" {
-					continue
-				}
-
-				// Simple filtering
-				if username != "" && !strings.Contains(line, username) {
-					continue
-				}
-				if action != "" && !strings.Contains(line, action) {
-					continue
-				}
-				if connection != "" && !strings.Contains(line, connection) {
-					continue
-				}
-
-				logs = append(logs, line)
-			}
-			totalCount = len(logs)
-		}
+	filter := audit.Filter{
+		Username: r.URL.Query().Get("username"),
+		Action:   r.URL.Query().Get("action"),
+		Resource: r.URL.Query().Get("connection"),
+		Metadata: auditMetadataFilter(r),
+		Limit:    100, // Return last 100 entries (pagination can be added)
 	}
 
-	// Return last 100 entries (pagination can be added)
-	start := 0
-	if len(logs) > 100 {
-		start = len(logs) - 100
-	}
+	logs, totalCount := audit.Query(cfg.Logging.AuditLogPath, filter)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"logs":  logs[start:],
+		"logs":  logs,
 		"total": totalCount,
 	})
 }
 
+// auditMetadataFilter reads metadata filters from metadata.<key>=<value> query parameters
+// (e.g., ?metadata.team=payments)
+func auditMetadataFilter(r *http.Request) map[string]string {
+	var filter map[string]string
+	for param, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(param, "metadata.")
+		if !ok || key == "" || len(values) == 0 {
+			continue
+		}
+		if filter == nil {
+			filter = make(map[string]string)
+		}
+		filter[key] = values[0]
+	}
+	return filter
+}
+
 // handleGetAuditStats returns audit log statistics
 func (s *Server) handleGetAuditStats(w http.ResponseWriter, r *http.Request) {
 	cfg := s.GetConfig()
 	auditLogPath := cfg.Logging.AuditLogPath
 
-	var totalEvents int
-
 	// Get memory buffer stats
 	currentMB, maxMB, entryCount, memEnabled := audit.GetMemoryStats()
 
-	// If audit goes to stdout or memory, use in-memory buffer
-	if auditLogPath == "stdout" || auditLogPath == "-" {
-		recentLogs := audit.GetRecentLogs(0) // Get all
-		totalEvents = len(recentLogs)
-	} else {
-		// Read audit log file
-		data, err := os.ReadFile(auditLogPath)
-		if err != nil {
-			// Fallback to memory
-			recentLogs := audit.GetRecentLogs(0)
-			totalEvents = len(recentLogs)
-		} else {
-			// Count lines (simple stats)
-			lines := strings.Split(string(data), "\n")
-			for _, line := range lines {
-				if line != "" {
-					totalEvents++
-				}
-			}
-		}
-	}
+	_, totalEvents := audit.Query(auditLogPath, audit.Filter{})
 
 	response := map[string]interface{}{
 		"total_events": totalEvents,
@@ -843,6 +1000,9 @@ func getAuditSource(logPath string, memEnabled bool) string {
 	if logPath == "stdout" || logPath == "-" {
 		return "in-memory buffer"
 	}
+	if !audit.IsFilePath(logPath) {
+		return "syslog: " + logPath + " (with memory buffer)"
+	}
 	return "file: " + logPath + " (with memory buffer)"
 }
 
@@ -851,20 +1011,110 @@ func getAuditSource(logPath string, memEnabled bool) string {
 // handleGetSystemStatus returns system status and active connections
 func (s *Server) handleGetSystemStatus(w http.ResponseWriter, r *http.Request) {
 	cfg := s.GetConfig()
+	connections := s.connMgr.GetActiveConnectionDetails()
 
-	// Get active connections from connection manager
-	activeConnections := s.connMgr.GetActiveConnections()
+	pendingApprovals := 0
+	if s.approvalMgr != nil {
+		pendingApprovals = s.approvalMgr.GetPendingRequestsCount()
+	}
 
+	uptime := time.Since(s.startedAt)
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"status":                 "running",
-		"active_connections":     activeConnections,
+		"active_connections":     summarizeActiveConnections(connections),
+		"connections":            connections,
 		"configured_connections": len(cfg.Connections),
 		"policies":               len(cfg.Policies),
 		"users":                  len(cfg.Auth.Users),
-		"uptime":                 time.Since(time.Now()).String(), // Placeholder
+		"started_at":             s.startedAt,
+		"uptime":                 uptime.Round(time.Second).String(),
+		"uptime_seconds":         uptime.Seconds(),
+		"logins_since_start":     s.logins.Load(),
+		"pending_approvals":      pendingApprovals,
+	})
+}
+
+// handleListActiveConnections returns every live session with its owner, expiry and byte usage
+func (s *Server) handleListActiveConnections(w http.ResponseWriter, r *http.Request) {
+	connections := s.connMgr.GetActiveConnectionDetails()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"connections": connections,
+		"total":       len(connections),
 	})
 }
 
+// KillConnectionRequest optionally explains why an admin terminated a session
+type KillConnectionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleKillConnection terminates a live session: its streams are closed at once and the
+// connection is removed, so the owner must connect again
+func (s *Server) handleKillConnection(w http.ResponseWriter, r *http.Request) {
+	adminUsername := r.Context().Value(ContextKeyUsername).(string)
+	connectionID := mux.Vars(r)["id"]
+
+	var req KillConnectionRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+			return
+		}
+	}
+
+	conn, err := s.connMgr.GetConnection(connectionID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
+		return
+	}
+
+	conn.CloseAllStreams()
+	if err := s.connMgr.CloseConnection(connectionID); err != nil {
+		// Expired or killed concurrently
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id": connectionID,
+		"owner":         conn.Username,
+		"created_at":    conn.CreatedAt.Format(time.RFC3339),
+		"expires_at":    conn.ExpiresAt().Format(time.RFC3339),
+		"bytes_in":      conn.BytesIn(),
+		"bytes_out":     conn.BytesOut(),
+	}
+	if req.Reason != "" {
+		metadata["reason"] = req.Reason
+	}
+	_ = audit.Log(s.GetConfig().Logging.AuditLogPath, adminUsername, "connection_killed", conn.Config.Name, metadata)
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Connection terminated"})
+}
+
+// activeConnectionSummary breaks the active connection count down by user, connection and type
+type activeConnectionSummary struct {
+	Total        int            `json:"total"`
+	ByUser       map[string]int `json:"by_user"`
+	ByConnection map[string]int `json:"by_connection"`
+	ByType       map[string]int `json:"by_type"`
+}
+
+// summarizeActiveConnections counts active connections per user, connection and type
+func summarizeActiveConnections(connections []proxy.ConnectionUsage) activeConnectionSummary {
+	summary := activeConnectionSummary{
+		Total:        len(connections),
+		ByUser:       make(map[string]int),
+		ByConnection: make(map[string]int),
+		ByType:       make(map[string]int),
+	}
+	for _, conn := range connections {
+		summary.ByUser[conn.Username]++
+		summary.ByConnection[conn.Connection]++
+		summary.ByType[conn.Type]++
+	}
+	return summary
+}
+
 // Helper Functions
 
 // sanitizeConfig removes sensitive data from configuration
@@ -940,12 +1190,12 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&testData); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid test data format")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid test data format")
 		return
 	}
 
 	if testData.Connection == "" || testData.Role == "" {
-		respondError(w, http.StatusBadRequest, "Connection and role are required")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Connection and role are required")
 		return
 	}
 
@@ -961,7 +1211,7 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if connection == nil {
-		respondError(w, http.StatusNotFound, "Connection not found")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found")
 		return
 	}
 
@@ -997,23 +1247,16 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Check if tags match (if connection has tags)
-		tagMatch := "no tags"
+		// Check if tags match (if connection has tags), explaining each tag expression
+		var tagMatch string
+		var tagResult *config.TagMatchResult
 		if len(connection.Tags) > 0 && len(policy.Tags) > 0 {
-			// Check if any connection tag matches any policy tag
-			for _, connTag := range connection.Tags {
-				for _, policyTag := range policy.Tags {
-					if connTag == policyTag {
-						tagMatch = "matched"
-						break
-					}
-				}
-				if tagMatch == "matched" {
-					break
-				}
-			}
-			if tagMatch != "matched" {
-				tagMatch = "no match"
+			result := config.MatchTags(policy.Tags, policy.TagMatch, connection.Tags)
+			tagResult = &result
+			if result.Matched {
+				tagMatch = "matched: " + strings.Join(result.Satisfied, ", ")
+			} else {
+				tagMatch = "no match: " + strings.Join(result.Failed, ", ")
 			}
 		} else if len(connection.Tags) == 0 && len(policy.Tags) == 0 {
 			tagMatch = "no tags required"
@@ -1024,17 +1267,21 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// If tags don't match, skip this policy
-		if len(connection.Tags) > 0 && len(policy.Tags) > 0 && tagMatch != "matched" {
+		if tagResult != nil && !tagResult.Matched {
 			continue
 		}
 
 		// This policy matches - add it to results
 		policyResult := map[string]interface{}{
-			"name":      policy.Name,
-			"roles":     policy.Roles,
-			"tags":      policy.Tags,
-			"tagMatch":  tagMatch,
-			"whitelist": policy.Whitelist,
+			"name":              policy.Name,
+			"roles":             policy.Roles,
+			"tags":              policy.Tags,
+			"tagMatch":          tagMatch,
+			"tagMatchMode":      tagMatchMode(policy.TagMatch),
+			"tagExpressions":    tagResult,
+			"whitelist":         policy.Whitelist,
+			"blacklist":         policy.Blacklist,
+			"table_permissions": policy.TablePermissions,
 		}
 		matchingPolicies = append(matchingPolicies, policyResult)
 
@@ -1043,11 +1290,8 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 			// HTTP request - use simple pattern matching
 			queryToTest := fmt.Sprintf("%s %s", testData.Method, testData.Path)
 			whitelist := s.authz.GetWhitelistForConnection([]string{testData.Role}, testData.Connection)
-			if len(whitelist) > 0 {
-				if err := s.authz.ValidatePattern(queryToTest, whitelist); err == nil {
-					hasAccess = true
-				}
-			} else {
+			blacklist := s.authz.GetBlacklistForConnection([]string{testData.Role}, testData.Connection)
+			if s.authz.Evaluate(queryToTest, whitelist, blacklist).Allowed {
 				hasAccess = true
 			}
 		} else if queryType == "database" && testData.Query != "" {
@@ -1078,6 +1322,16 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 		"connectionType":   connection.Type, // Include connection type for reference
 	}
 
+	// Explain which policy and pattern allow the request (the first matching rule wins)
+	request := testData.Query
+	if queryType == "http" {
+		request = fmt.Sprintf("%s %s", testData.Method, testData.Path)
+	}
+	if rule, ok := s.authz.MatchingWhitelistRule([]string{testData.Role}, testData.Connection, request, time.Now()); ok && strings.TrimSpace(request) != "" {
+		result["matched_rule"] = rule
+		result["matched_rule_reason"] = "allowed by " + rule.String()
+	}
+
 	// Add subquery validation for database queries and use it to determine hasAccess
 	if queryType == "database" && testData.Query != "" {
 		validator := security.NewSubqueryValidator()
@@ -1088,6 +1342,26 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 		// For database queries, hasAccess should match the subquery validation result
 		// This ensures multi-statement queries are properly validated
 		result["hasAccess"] = validationResult.IsAllowed
+
+		// A blacklist match denies the query even if every statement is whitelisted
+		blacklist := s.authz.GetBlacklistForConnection([]string{testData.Role}, testData.Connection)
+		if pattern, blacklisted := authorization.MatchBlacklist(testData.Query, blacklist); blacklisted {
+			result["blacklist_match"] = pattern
+			result["hasAccess"] = false
+		}
+		for _, subquery := range validationResult.Subqueries {
+			if pattern, blacklisted := authorization.MatchBlacklist(subquery.Subquery.Query, blacklist); blacklisted {
+				result["blacklist_match"] = pattern
+				result["hasAccess"] = false
+			}
+		}
+
+		// Explain which tables the query touches and whether table_permissions allow it
+		analysis, allowed := s.analyzePolicyTestQuery(testData.Role, testData.Connection, testData.Query)
+		result["sql_analysis"] = analysis
+		if !allowed {
+			result["hasAccess"] = false
+		}
 	}
 
 	// Check if approval is required
@@ -1104,12 +1378,62 @@ func (s *Server) handlePolicyTest(w http.ResponseWriter, r *http.Request) {
 		result["requiresApproval"] = requiresApproval
 		if requiresApproval {
 			result["approvalTimeout"] = approvalTimeout.String()
+			if queryType == "http" {
+				result["requiredApprovals"] = s.approvalMgr.RequiredApprovals(testData.Method, testData.Path, connection.Tags)
+			} else {
+				result["requiredApprovals"] = s.approvalMgr.RequiredApprovals(testData.Query, "", connection.Tags)
+			}
 		}
 	}
 
 	respondJSON(w, http.StatusOK, result)
 }
 
+// tagMatchMode returns a policy's tag_match mode, defaulting to "all"
+func tagMatchMode(mode string) string {
+	if mode == "" {
+		return "all"
+	}
+	return mode
+}
+
+// analyzePolicyTestQuery runs the SQL analyzer on a policy test query and checks the
+// role's table permissions, mirroring the Postgres proxy. Returns false if the table
+// permissions would block the query; a parse error is reported, not treated as a denial.
+func (s *Server) analyzePolicyTestQuery(role, connectionName, query string) (map[string]interface{}, bool) {
+	permissions := s.authz.GetTablePermissionsForConnection([]string{role}, connectionName)
+	result := map[string]interface{}{
+		"table_permissions_configured": len(permissions) > 0,
+	}
+
+	analysis, err := security.NewSQLAnalyzer().Analyze(query)
+	if err != nil {
+		result["error"] = err.Error()
+		if len(permissions) > 0 {
+			result["table_permissions"] = map[string]interface{}{
+				"allowed": true,
+				"reason":  "query could not be parsed; only the whitelist applies",
+			}
+		}
+		return result, true
+	}
+
+	result["operations"] = analysis.Operations
+	result["tables"] = analysis.Tables
+	result["has_join"] = analysis.HasJoin
+	result["accesses"] = analysis.Accesses
+
+	if len(permissions) == 0 {
+		return result, true
+	}
+	if err := security.CheckTablePermissions(analysis, permissions); err != nil {
+		result["table_permissions"] = map[string]interface{}{"allowed": false, "reason": err.Error()}
+		return result, false
+	}
+	result["table_permissions"] = map[string]interface{}{"allowed": true, "reason": "all tables permitted"}
+	return result, true
+}
+
 // Approval Management Handlers
 
 // ApprovalConfigResponse is the response for approval configuration
@@ -1118,6 +1442,7 @@ type ApprovalConfigResponse struct {
 	Patterns []ApprovalPatternResponse     `json:"patterns"`
 	Webhook  *config.WebhookApprovalConfig `json:"webhook,omitempty"`
 	Slack    *config.SlackApprovalConfig   `json:"slack,omitempty"`
+	Email    *config.EmailApprovalConfig   `json:"email,omitempty"`
 }
 
 // ApprovalPatternResponse represents an approval pattern with index
@@ -1127,30 +1452,51 @@ type ApprovalPatternResponse struct {
 	Tags           []string `json:"tags,omitempty"`
 	TagMatch       string   `json:"tag_match,omitempty"`
 	TimeoutSeconds int      `json:"timeout_seconds"`
+	// RequiredApprovals is the number of distinct approvers needed
+	RequiredApprovals int `json:"required_approvals,omitempty"`
 }
 
 // handleGetApprovalConfig returns the approval configuration
 func (s *Server) handleGetApprovalConfig(w http.ResponseWriter, r *http.Request) {
+	s.setConfigETag(w, r)
 	cfg := s.GetConfig()
 
 	patterns := make([]ApprovalPatternResponse, len(cfg.Approval.Patterns))
 	for i, p := range cfg.Approval.Patterns {
 		patterns[i] = ApprovalPatternResponse{
-			Index:          i,
-			Pattern:        p.Pattern,
-			Tags:           p.Tags,
-			TagMatch:       p.TagMatch,
-			TimeoutSeconds: p.TimeoutSeconds,
+			Index:             i,
+			Pattern:           p.Pattern,
+			Tags:              p.Tags,
+			TagMatch:          p.TagMatch,
+			TimeoutSeconds:    p.TimeoutSeconds,
+			RequiredApprovals: p.RequiredApprovals,
 		}
 	}
 
 	resp := ApprovalConfigResponse{
 		Enabled:  cfg.Approval.Enabled,
 		Patterns: patterns,
-		Webhook:  cfg.Approval.Webhook,
 		Slack:    cfg.Approval.Slack,
 	}
 
+	// Don't expose the webhook signing secret
+	if cfg.Approval.Webhook != nil {
+		webhook := *cfg.Approval.Webhook
+		if webhook.Secret != "" {
+			webhook.Secret = "********"
+		}
+		resp.Webhook = &webhook
+	}
+
+	// Don't expose the SMTP password
+	if cfg.Approval.Email != nil {
+		email := *cfg.Approval.Email
+		if email.Password != "" {
+			email.Password = "********"
+		}
+		resp.Email = &email
+	}
+
 	respondJSON(w, http.StatusOK, resp)
 }
 
@@ -1161,24 +1507,31 @@ func (s *Server) handleUpdateApprovalEnabled(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request: %v", err))
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
+	wasEnabled := cfg.Approval.Enabled
 	cfg.Approval.Enabled = req.Enabled
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	comment := fmt.Sprintf("Updated approval enabled status to %v", req.Enabled)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.approval.update", "approval", "approval",
+		map[string]bool{"enabled": wasEnabled}, map[string]bool{"enabled": req.Enabled})
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Approval status updated successfully",
 		"enabled": req.Enabled,
@@ -1189,13 +1542,13 @@ func (s *Server) handleUpdateApprovalEnabled(w http.ResponseWriter, r *http.Requ
 func (s *Server) handleCreateApprovalPattern(w http.ResponseWriter, r *http.Request) {
 	var pattern config.ApprovalPatternConfig
 	if err := json.NewDecoder(r.Body).Decode(&pattern); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid pattern: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid pattern: %v", err))
 		return
 	}
 
 	// Validate pattern
 	if pattern.Pattern == "" {
-		respondError(w, http.StatusBadRequest, "Pattern is required")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Pattern is required")
 		return
 	}
 
@@ -1203,26 +1556,37 @@ func (s *Server) handleCreateApprovalPattern(w http.ResponseWriter, r *http.Requ
 		pattern.TimeoutSeconds = 300 // Default 5 minutes
 	}
 
-	cfg := s.GetConfig()
+	if pattern.RequiredApprovals < 0 {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "required_approvals cannot be negative")
+		return
+	}
+
+	cfg := s.configForUpdate()
 	cfg.Approval.Patterns = append(cfg.Approval.Patterns, pattern)
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	comment := fmt.Sprintf("Added approval pattern: %s", pattern.Pattern)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.approval_pattern.create", "approval_pattern", pattern.Pattern, nil, pattern)
+
 	resp := ApprovalPatternResponse{
-		Index:          len(cfg.Approval.Patterns) - 1,
-		Pattern:        pattern.Pattern,
-		Tags:           pattern.Tags,
-		TagMatch:       pattern.TagMatch,
-		TimeoutSeconds: pattern.TimeoutSeconds,
+		Index:             len(cfg.Approval.Patterns) - 1,
+		Pattern:           pattern.Pattern,
+		Tags:              pattern.Tags,
+		TagMatch:          pattern.TagMatch,
+		TimeoutSeconds:    pattern.TimeoutSeconds,
+		RequiredApprovals: pattern.RequiredApprovals,
 	}
 
 	respondJSON(w, http.StatusCreated, resp)
@@ -1235,19 +1599,19 @@ func (s *Server) handleUpdateApprovalPattern(w http.ResponseWriter, r *http.Requ
 
 	var index int
 	if _, err := fmt.Sscanf(indexStr, "%d", &index); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid index")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid index")
 		return
 	}
 
 	var pattern config.ApprovalPatternConfig
 	if err := json.NewDecoder(r.Body).Decode(&pattern); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid pattern: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid pattern: %v", err))
 		return
 	}
 
 	// Validate pattern
 	if pattern.Pattern == "" {
-		respondError(w, http.StatusBadRequest, "Pattern is required")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Pattern is required")
 		return
 	}
 
@@ -1255,32 +1619,44 @@ func (s *Server) handleUpdateApprovalPattern(w http.ResponseWriter, r *http.Requ
 		pattern.TimeoutSeconds = 300
 	}
 
-	cfg := s.GetConfig()
+	if pattern.RequiredApprovals < 0 {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "required_approvals cannot be negative")
+		return
+	}
+
+	cfg := s.configForUpdate()
 	if index < 0 || index >= len(cfg.Approval.Patterns) {
-		respondError(w, http.StatusNotFound, "Pattern not found")
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "Pattern not found")
 		return
 	}
 
-	oldPattern := cfg.Approval.Patterns[index].Pattern
+	before := cfg.Approval.Patterns[index]
+	oldPattern := before.Pattern
 	cfg.Approval.Patterns[index] = pattern
 
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	comment := fmt.Sprintf("Updated approval pattern from '%s' to '%s'", oldPattern, pattern.Pattern)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.approval_pattern.update", "approval_pattern", oldPattern, before, pattern)
+
 	resp := ApprovalPatternResponse{
-		Index:          index,
-		Pattern:        pattern.Pattern,
-		Tags:           pattern.Tags,
-		TagMatch:       pattern.TagMatch,
-		TimeoutSeconds: pattern.TimeoutSeconds,
+		Index:             index,
+		Pattern:           pattern.Pattern,
+		Tags:              pattern.Tags,
+		TagMatch:          pattern.TagMatch,
+		TimeoutSeconds:    pattern.TimeoutSeconds,
+		RequiredApprovals: pattern.RequiredApprovals,
 	}
 
 	respondJSON(w, http.StatusOK, resp)
@@ -1293,48 +1669,52 @@ func (s *Server) handleDeleteApprovalPattern(w http.ResponseWriter, r *http.Requ
 
 	var index int
 	if _, err := fmt.Sscanf(indexStr, "%d", &index); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid index")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid index")
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
 	if index < 0 || index >= len(cfg.Approval.Patterns) {
-		respondError(w, http.StatusNotFound, "Pattern not found")
+		respondError(w, http.StatusNotFound, ErrCodeNotFound, "Pattern not found")
 		return
 	}
 
-	patternName := cfg.Approval.Patterns[index].Pattern
+	removed := cfg.Approval.Patterns[index]
+	patternName := removed.Pattern
 	cfg.Approval.Patterns = append(cfg.Approval.Patterns[:index], cfg.Approval.Patterns[index+1:]...)
 
 	comment := fmt.Sprintf("Deleted approval pattern: %s", patternName)
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.approval_pattern.delete", "approval_pattern", patternName, removed, nil)
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Approval pattern deleted successfully",
 	})
 }
 
-// handleUpdateApprovalProviders updates webhook and Slack approval providers
+// handleUpdateApprovalProviders updates webhook, Slack and email approval providers
 func (s *Server) handleUpdateApprovalProviders(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Webhook *config.WebhookApprovalConfig `json:"webhook,omitempty"`
 		Slack   *config.SlackApprovalConfig   `json:"slack,omitempty"`
+		Email   *config.EmailApprovalConfig   `json:"email,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request: %v", err))
 		return
 	}
 
-	cfg := s.GetConfig()
+	cfg := s.configForUpdate()
+	before := approvalProviders(cfg.Approval)
 
 	// Update providers
 	if req.Webhook != nil {
@@ -1351,18 +1731,89 @@ func (s *Server) handleUpdateApprovalProviders(w http.ResponseWriter, r *http.Re
 		cfg.Approval.Slack.WebhookURL = req.Slack.WebhookURL
 	}
 
+	if req.Email != nil {
+		email := *req.Email
+		// Preserve the existing password if not provided (or masked)
+		if (email.Password == "" || email.Password == "********") && cfg.Approval.Email != nil {
+			email.Password = cfg.Approval.Email.Password
+		}
+		cfg.Approval.Email = &email
+	}
+
+	if !validateConfig(w, cfg) {
+		return
+	}
+
 	comment := "Updated approval providers configuration"
-	if err := s.storageBackend.Save(r.Context(), cfg, comment); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save: %v", err))
+	if !s.saveConfig(w, r, cfg, comment) {
 		return
 	}
 
 	if err := s.ReloadConfig(cfg); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to reload: %v", err))
 		return
 	}
 
+	s.logAdminChange(r, "config.approval_providers.update", "approval_providers", "approval", before, approvalProviders(cfg.Approval))
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Approval providers updated successfully",
 	})
 }
+
+// approvalTestTimeout bounds each provider's delivery of a test approval request
+const approvalTestTimeout = 10 * time.Second
+
+// handleTestApprovalProviders sends a synthetic approval request through every configured
+// provider and reports whether each delivered it. Nothing is left pending.
+func (s *Server) handleTestApprovalProviders(w http.ResponseWriter, r *http.Request) {
+	username, _ := r.Context().Value(ContextKeyUsername).(string)
+
+	results := s.approvalMgr.ProbeProviders(r.Context(), username, approvalTestTimeout)
+	if len(results) == 0 {
+		respondError(w, http.StatusServiceUnavailable, ErrCodeApprovalUnavailable, "No approval providers are configured")
+		return
+	}
+
+	delivered := 0
+	for _, result := range results {
+		if result.Delivered {
+			delivered++
+		}
+	}
+	_ = audit.Log(s.GetConfig().Logging.AuditLogPath, username, "approval_provider_test", "approval", map[string]interface{}{
+		"providers": len(results),
+		"delivered": delivered,
+		"results":   results,
+	})
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"results":   results,
+		"delivered": delivered == len(results),
+	})
+}
+
+// approvalProvidersSnapshot is the audited state of the approval provider settings
+type approvalProvidersSnapshot struct {
+	Webhook *config.WebhookApprovalConfig `json:"webhook,omitempty"`
+	Slack   *config.SlackApprovalConfig   `json:"slack,omitempty"`
+	Email   *config.EmailApprovalConfig   `json:"email,omitempty"`
+}
+
+// approvalProviders copies the provider settings so later edits don't change the snapshot
+func approvalProviders(cfg *config.ApprovalConfig) approvalProvidersSnapshot {
+	var snapshot approvalProvidersSnapshot
+	if cfg.Webhook != nil {
+		webhook := *cfg.Webhook
+		snapshot.Webhook = &webhook
+	}
+	if cfg.Slack != nil {
+		slack := *cfg.Slack
+		snapshot.Slack = &slack
+	}
+	if cfg.Email != nil {
+		email := *cfg.Email
+		snapshot.Email = &email
+	}
+	return snapshot
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
 )
 
 // adminMiddleware checks if the user has the admin role
@@ -10,30 +12,36 @@ func (s *Server) adminMiddleware(next http.Handler) http.Handler {
 		// Get roles from context (set by authMiddleware)
 		rolesInterface := r.Context().Value(ContextKeyRoles)
 		if rolesInterface == nil {
-			respondError(w, http.StatusForbidden, "Admin role required")
+			respondError(w, http.StatusForbidden, ErrCodeForbidden, "Admin role required")
 			return
 		}
 
 		roles, ok := rolesInterface.([]string)
 		if !ok {
-			respondError(w, http.StatusForbidden, "Invalid roles")
+			respondError(w, http.StatusForbidden, ErrCodeForbidden, "Invalid roles")
 			return
 		}
 
-		// Check if user has admin role
-		hasAdmin := false
-		for _, role := range roles {
-			if role == "admin" {
-				hasAdmin = true
-				break
-			}
+		if !isAdmin(roles) {
+			respondError(w, http.StatusForbidden, ErrCodeForbidden, "Admin role required")
+			return
 		}
 
-		if !hasAdmin {
-			respondError(w, http.StatusForbidden, "Admin role required")
-			return
+		// Record the admin as author of any config versions saved by this request
+		if username, ok := r.Context().Value(ContextKeyUsername).(string); ok {
+			r = r.WithContext(config.WithAuthor(r.Context(), username))
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// isAdmin reports whether the roles include the admin role
+func isAdmin(roles []string) bool {
+	for _, role := range roles {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
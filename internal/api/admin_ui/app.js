@@ -4,6 +4,10 @@ const API_BASE = '/admin/api';
 // Get token from localStorage
 let token = localStorage.getItem('token');
 
+// Stored configuration version (ETag) from the last admin read; sent as If-Match
+// on changes so edits made meanwhile by another admin are not overwritten
+let configVersion = null;
+
 // Auto-refresh intervals
 let dashboardRefreshInterval = null;
 const DASHBOARD_REFRESH_MS = 5000; // Refresh every 5 seconds
@@ -16,6 +20,9 @@ async function apiCall(endpoint, options = {}) {
             'Authorization': `Bearer ${token}`
         }
     };
+    if (configVersion && options.method && options.method !== 'GET') {
+        defaultOptions.headers['If-Match'] = configVersion;
+    }
 
     const response = await fetch(`${API_BASE}${endpoint}`, {
         ...defaultOptions,
@@ -34,14 +41,35 @@ async function apiCall(endpoint, options = {}) {
         throw new Error('Unauthorized');
     }
 
+    const etag = response.headers.get('ETag');
+    if (etag) {
+        configVersion = etag;
+    }
+
     if (!response.ok) {
-        const error = await response.text();
-        throw new Error(error || 'API request failed');
+        const error = parseAPIError(await response.text());
+        if (error.code === 'config_conflict') {
+            showNotification('Configuration was changed by another admin since this page loaded. Reload before saving again.', 'error');
+        }
+        throw new Error(error.message || 'API request failed');
     }
 
     return response.json();
 }
 
+// Extract { code, message } from an error response body ({"error": {"code", "message"}})
+function parseAPIError(text) {
+    try {
+        const body = JSON.parse(text);
+        if (body.error && typeof body.error === 'object') {
+            return { code: body.error.code, message: body.error.message };
+        }
+    } catch (e) {
+        // Not JSON: use the body as the message
+    }
+    return { code: '', message: text };
+}
+
 // Helper function to escape HTML for safe display
 function escapeHtml(text) {
     const div = document.createElement('div');
@@ -192,7 +220,7 @@ async function loadDashboard() {
         console.log('Audit stats:', auditStats);
 
         document.getElementById('system-status').textContent = status.status || 'unknown';
-        document.getElementById('active-connections').textContent = status.active_connections || 0;
+        document.getElementById('active-connections').textContent = (status.active_connections && status.active_connections.total) || 0;
         document.getElementById('configured-connections').textContent = status.configured_connections || 0;
         document.getElementById('total-policies').textContent = status.policies || 0;
         document.getElementById('total-users').textContent = status.users || 0;
@@ -748,7 +776,7 @@ async function loadAuditLogs() {
             data.logs.forEach(log => {
                 const entry = document.createElement('div');
                 entry.className = 'log-entry';
-                entry.textContent = log;
+                entry.textContent = JSON.stringify(log);
                 container.appendChild(entry);
             });
         } else {
@@ -1256,6 +1284,33 @@ function displayPolicyTestResults(result) {
         `;
     }
 
+    // Add SQL analysis (tables touched and table permission check)
+    if (result.sql_analysis) {
+        const analysis = result.sql_analysis;
+        const permissions = analysis.table_permissions;
+        html += `
+            <div class="sql-analysis">
+                <h4>SQL Analysis</h4>
+                ${analysis.error ? `
+                    <p><strong>Could not parse query:</strong> ${analysis.error}</p>
+                ` : `
+                    <table class="test-details-table">
+                        <tr><td><strong>Operations:</strong></td><td>${analysis.operations.join(', ') || 'none'}</td></tr>
+                        <tr><td><strong>Tables:</strong></td><td>${analysis.tables.join(', ') || 'none'}</td></tr>
+                        <tr><td><strong>Joins:</strong></td><td>${analysis.has_join ? 'yes' : 'no'}</td></tr>
+                    </table>
+                `}
+                ${permissions ? `
+                    <div class="access-result ${permissions.allowed ? 'allowed' : 'denied'}">
+                        <strong>${permissions.allowed ? '✅ TABLE PERMISSIONS ALLOW' : '❌ TABLE PERMISSIONS DENY'}</strong>: ${permissions.reason}
+                    </div>
+                ` : `
+                    <p>No table permissions configured for this role and connection.</p>
+                `}
+            </div>
+        `;
+    }
+
     if (result.matchingPolicies && result.matchingPolicies.length > 0) {
         html += `
             <div class="matching-policies">
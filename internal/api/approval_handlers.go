@@ -2,10 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"net/http"
+	"strings"
 
 	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/gorilla/mux"
 )
 
@@ -15,20 +20,19 @@ func (s *Server) handleApproveRequest(w http.ResponseWriter, r *http.Request) {
 	requestID := vars["request_id"]
 
 	if requestID == "" {
-		http.Error(w, "request_id is required", http.StatusBadRequest)
+		approvalError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "request_id is required")
 		return
 	}
 
-	// Get approver info (from token if authenticated, or from query param)
-	approver := r.URL.Query().Get("approver")
+	authenticated, ok := s.authorizeApprovalCallback(w, r, requestID, approval.DecisionApproved)
+	if !ok {
+		return
+	}
+
+	// The approver the link was issued to, or the admin token's user; shared links name no one
+	approver := authenticated
 	if approver == "" {
-		// Try to get from auth token
-		username, ok := r.Context().Value(ContextKeyUsername).(string)
-		if ok {
-			approver = username
-		} else {
-			approver = "unknown"
-		}
+		approver = "unknown"
 	}
 
 	reason := r.URL.Query().Get("reason")
@@ -37,12 +41,63 @@ func (s *Server) handleApproveRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Submit approval
-	err := s.approvalMgr.SubmitApproval(requestID, approval.DecisionApproved, approver, reason)
+	resource := s.approvalResource(requestID)
+	channel := s.approvalChannel(r)
+	result, err := s.approvalMgr.SubmitApprovalFrom(requestID, channel, approval.DecisionApproved, approver, reason)
+	if errors.Is(err, approval.ErrSelfApproval) {
+		s.auditApprovalAttempt(r, requestID, approval.DecisionApproved, "approval_denied", fmt.Sprintf("%s: %v", approver, err))
+		approvalError(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to approve request: %v", err), http.StatusBadRequest)
+		submitError(w, r, "failed to approve request", err)
+		return
+	}
+
+	// Audit each individual approval
+	_ = audit.Log(s.config.Logging.AuditLogPath, approver, "approval_submitted", resource, map[string]interface{}{
+		"request_id": requestID,
+		"channel":    channel,
+		"approvals":  result.Approvals,
+		"required":   result.Required,
+		"duplicate":  result.Duplicate,
+		"reason":     reason,
+	})
+
+	// Quorum not reached yet
+	if !result.Resolved {
+		message := fmt.Sprintf("awaiting %d more approval(s)", result.Remaining())
+		if result.Duplicate {
+			message = fmt.Sprintf("%s has already approved this request, %s", approver, message)
+		}
+
+		if r.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":      "pending",
+				"request_id":  requestID,
+				"approved_by": approver,
+				"approvals":   result.Approvals,
+				"required":    result.Required,
+				"remaining":   result.Remaining(),
+				"message":     message,
+			})
+		} else {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(approvalPendingHTML(requestID, message)))
+		}
 		return
 	}
 
+	_ = audit.Log(s.config.Logging.AuditLogPath, approver, "approval_decision", resource, map[string]interface{}{
+		"request_id": requestID,
+		"channel":    channel,
+		"decision":   approval.DecisionApproved,
+		"approvals":  result.Approvals,
+		"required":   result.Required,
+		"ledger":     s.approvalLedger(requestID),
+	})
+
 	// Return success page or JSON based on Accept header
 	if r.Header.Get("Accept") == "application/json" {
 		w.Header().Set("Content-Type", "application/json")
@@ -111,19 +166,19 @@ func (s *Server) handleRejectRequest(w http.ResponseWriter, r *http.Request) {
 	requestID := vars["request_id"]
 
 	if requestID == "" {
-		http.Error(w, "request_id is required", http.StatusBadRequest)
+		approvalError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "request_id is required")
 		return
 	}
 
-	// Get approver info
-	approver := r.URL.Query().Get("approver")
+	authenticated, ok := s.authorizeApprovalCallback(w, r, requestID, approval.DecisionRejected)
+	if !ok {
+		return
+	}
+
+	// The approver the link was issued to, or the admin token's user; shared links name no one
+	approver := authenticated
 	if approver == "" {
-		username, ok := r.Context().Value(ContextKeyUsername).(string)
-		if ok {
-			approver = username
-		} else {
-			approver = "unknown"
-		}
+		approver = "unknown"
 	}
 
 	reason := r.URL.Query().Get("reason")
@@ -131,13 +186,25 @@ func (s *Server) handleRejectRequest(w http.ResponseWriter, r *http.Request) {
 		reason = "rejected via API"
 	}
 
-	// Submit rejection
-	err := s.approvalMgr.SubmitApproval(requestID, approval.DecisionRejected, approver, reason)
+	// Submit rejection (a single rejection denies the request)
+	resource := s.approvalResource(requestID)
+	channel := s.approvalChannel(r)
+	result, err := s.approvalMgr.SubmitApprovalFrom(requestID, channel, approval.DecisionRejected, approver, reason)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to reject request: %v", err), http.StatusBadRequest)
+		submitError(w, r, "failed to reject request", err)
 		return
 	}
 
+	_ = audit.Log(s.config.Logging.AuditLogPath, approver, "approval_decision", resource, map[string]interface{}{
+		"request_id": requestID,
+		"channel":    channel,
+		"decision":   approval.DecisionRejected,
+		"approvals":  result.Approvals,
+		"required":   result.Required,
+		"reason":     reason,
+		"ledger":     s.approvalLedger(requestID),
+	})
+
 	// Return success page or JSON
 	if r.Header.Get("Accept") == "application/json" {
 		w.Header().Set("Content-Type", "application/json")
@@ -200,12 +267,195 @@ func (s *Server) handleRejectRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// authorizeApprovalCallback authenticates an approve/reject call before it is submitted
+// The call must carry the single-use token from the notification link, whose approver
+// (empty for shared links) is returned, or an admin API token (as the CLI sends), whose
+// user is. Rejected attempts are audited and answered with 401 (403 for a valid token
+// without the admin role, or a shared link approving a request that needs several approvers).
+func (s *Server) authorizeApprovalCallback(w http.ResponseWriter, r *http.Request, requestID string, decision approval.Decision) (string, bool) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		// The approver named by the link is authenticated by its token
+		approver := r.URL.Query().Get("approver")
+		err := s.approvalMgr.ConsumeCallback(requestID, decision, approver, token)
+		if err == nil {
+			return approver, true
+		}
+		if errors.Is(err, approval.ErrApproverRequired) {
+			s.auditApprovalAttempt(r, requestID, decision, "approval_denied", err.Error())
+			approvalError(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+			return "", false
+		}
+		s.auditApprovalAttempt(r, requestID, decision, "approval_forged", err.Error())
+		approvalError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+		return "", false
+	}
+
+	bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		s.auditApprovalAttempt(r, requestID, decision, "approval_unauthenticated", "missing approval token or authorization header")
+		approvalError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "approval token or admin authorization required")
+		return "", false
+	}
+
+	claims, err := s.authSvc.validateToken(bearer)
+	if err != nil {
+		s.auditApprovalAttempt(r, requestID, decision, "approval_unauthenticated", "invalid or expired token")
+		approvalError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid or expired token")
+		return "", false
+	}
+	if !isAdmin(claims.Roles) {
+		s.auditApprovalAttempt(r, requestID, decision, "approval_denied", fmt.Sprintf("%s lacks the admin role", claims.Username))
+		approvalError(w, r, http.StatusForbidden, ErrCodeForbidden, "admin role required")
+		return "", false
+	}
+	return claims.Username, true
+}
+
+// approvalError answers a failed approve/reject call. API clients (Accept: application/json
+// or a Bearer token, as the CLI sends) get the JSON error body with its code; browsers
+// following a notification link get the message as plain text.
+func approvalError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") || strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		respondError(w, status, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// submitError answers a decision the approval manager could not record: 404 for a request
+// that is unknown, expired or already decided, 500 when the store failed
+func submitError(w http.ResponseWriter, r *http.Request, prefix string, err error) {
+	message := fmt.Sprintf("%s: %v", prefix, err)
+	if errors.Is(err, approval.ErrRequestNotFound) {
+		approvalError(w, r, http.StatusNotFound, ErrCodeNotFound, message)
+		return
+	}
+	approvalError(w, r, http.StatusInternalServerError, ErrCodeInternal, message)
+}
+
+// auditApprovalAttempt records a rejected approve/reject call under the approver it claimed
+func (s *Server) auditApprovalAttempt(r *http.Request, requestID string, decision approval.Decision, action, reason string) {
+	claimed := r.URL.Query().Get("approver")
+	if claimed == "" {
+		claimed = "unknown"
+	}
+	observed := ""
+	if ip := clientIP(r, s.trustedProxies); ip != nil {
+		observed = ip.String()
+	}
+	_ = audit.Log(s.config.Logging.AuditLogPath, claimed, action, s.approvalResource(requestID), tracing.Annotate(r.Context(), map[string]interface{}{
+		"request_id": requestID,
+		"decision":   decision,
+		"channel":    s.approvalChannel(r),
+		"client_ip":  observed,
+		"reason":     reason,
+	}))
+}
+
+// approvalResource returns the connection name of a pending request for audit logs
+func (s *Server) approvalResource(requestID string) string {
+	req, err := s.approvalMgr.GetPendingRequest(requestID)
+	if err != nil {
+		return ""
+	}
+	if name := req.Metadata["connection_name"]; name != "" {
+		return name
+	}
+	return req.ConnectionID
+}
+
+// approvalChannel returns the channel an approval callback came through
+// Only registered provider names are accepted; anything else is recorded as "api"
+func (s *Server) approvalChannel(r *http.Request) string {
+	channel := r.URL.Query().Get("channel")
+	if channel != "" && s.approvalMgr.HasProvider(channel) {
+		return channel
+	}
+	return "api"
+}
+
+// approvalLedger returns the channel ledger of a resolved request from the approval history
+func (s *Server) approvalLedger(requestID string) []approval.LedgerEntry {
+	for _, entry := range s.approvalMgr.GetHistory(0) {
+		if entry.RequestID == requestID {
+			return entry.Ledger
+		}
+	}
+	return nil
+}
+
+// approvalPendingHTML renders the page shown when an approval is recorded but quorum is not reached
+func approvalPendingHTML(requestID, message string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <title>Approval Recorded</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Arial, sans-serif;
+            display: flex;
+            justify-content: center;
+            align-items: center;
+            height: 100vh;
+            margin: 0;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+        }
+        .container {
+            background: white;
+            padding: 3rem;
+            border-radius: 1rem;
+            box-shadow: 0 10px 40px rgba(0,0,0,0.2);
+            text-align: center;
+        }
+        h1 { color: #667eea; margin: 0 0 1rem 0; }
+        .pending { font-size: 4rem; color: #f39c12; margin-bottom: 1rem; }
+        .message { font-size: 1rem; color: #555; margin: 1rem 0; }
+        .details {
+            background: #f8f9fa;
+            padding: 1rem;
+            border-radius: 0.5rem;
+            margin: 1.5rem 0;
+            font-size: 0.9rem;
+            color: #666;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="pending">&#8987;</div>
+        <h1>Approval Recorded</h1>
+        <p class="message">Your approval has been recorded, ` + html.EscapeString(message) + `.</p>
+        <div class="details">
+            <p><strong>Request ID:</strong> ` + html.EscapeString(requestID) + `</p>
+        </div>
+        <p>You can close this window and return to your work.</p>
+    </div>
+</body>
+</html>`
+}
+
+// handleGetApprovalHistory returns recently resolved approvals with their channel ledger (for admin)
+func (s *Server) handleGetApprovalHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if _, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil {
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"history": s.approvalMgr.GetHistory(limit),
+	})
+}
+
 // handleGetPendingApprovals returns list of pending approvals (for admin)
 func (s *Server) handleGetPendingApprovals(w http.ResponseWriter, r *http.Request) {
-	count := s.approvalMgr.GetPendingRequestsCount()
+	requests := s.approvalMgr.ListPendingRequests()
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"pending_count": count,
+		"pending_count": len(requests),
+		"requests":      requests,
 	})
 }
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/auth"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestApprovalCallbacks_RequireTokenOrAdmin(t *testing.T) {
+	links := make(chan map[string]string, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		links <- map[string]string{
+			"approve": payload["approve_url"].(string),
+			"reject":  payload["reject_url"].(string),
+		}
+	}))
+	defer webhook.Close()
+
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080},
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: time.Hour,
+		},
+		Approval: &config.ApprovalConfig{
+			Enabled: true,
+			Webhook: &config.WebhookApprovalConfig{URL: webhook.URL, Secret: "callback-secret"},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditLog},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// pending starts an approval request and returns its signed links
+	pending := func() (chan *approval.Response, map[string]string) {
+		responses := make(chan *approval.Response, 1)
+		go func() {
+			resp, _ := server.approvalMgr.RequestApproval(context.Background(), &approval.Request{
+				Username: "alice",
+				Method:   "DELETE",
+				Path:     "/api/users/1",
+			}, time.Minute)
+			responses <- resp
+		}()
+		select {
+		case link := <-links:
+			return responses, link
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook never received the approval request")
+			return nil, nil
+		}
+	}
+
+	call := func(target, bearer string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	responses, link := pending()
+	requestID := strings.Split(link["approve"], "/")[3]
+
+	forged := []string{
+		"/api/approvals/" + requestID + "/approve?token=deadbeef&approver=mallory",
+		strings.Replace(link["reject"], "/reject", "/approve", 1), // token for the other decision
+		link["approve"] + "&approver=mallory",                     // shared link passed off as an approver's
+	}
+	for _, target := range forged {
+		if code := call(target, ""); code != http.StatusUnauthorized {
+			t.Errorf("GET %s = %d, want %d", target, code, http.StatusUnauthorized)
+		}
+	}
+	unauthenticated := "/api/approvals/" + requestID + "/approve?approver=mallory"
+	for _, bearer := range []string{"", "not-a-token"} {
+		if code := call(unauthenticated, bearer); code != http.StatusUnauthorized {
+			t.Errorf("approve with bearer %q = %d, want %d", bearer, code, http.StatusUnauthorized)
+		}
+	}
+
+	// A valid API token without the admin role may not decide
+	developer, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "dave", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	if code := call(unauthenticated, developer); code != http.StatusForbidden {
+		t.Errorf("approve as non-admin = %d, want %d", code, http.StatusForbidden)
+	}
+
+	data, _ := os.ReadFile(auditLog)
+	for action, want := range map[string]int{"approval_forged": 3, "approval_unauthenticated": 2, "approval_denied": 1} {
+		if got := strings.Count(string(data), `"`+action+`"`); got != want {
+			t.Errorf("audit log has %d %s events, want %d: %s", got, action, want, data)
+		}
+	}
+	if !strings.Contains(string(data), `"mallory"`) {
+		t.Errorf("rejected attempts should record the claimed approver: %s", data)
+	}
+
+	// The signed link decides once; a shared link names no approver
+	if code := call(link["approve"], ""); code != http.StatusOK {
+		t.Fatalf("signed approve link = %d, want %d", code, http.StatusOK)
+	}
+	if resp := <-responses; resp.Decision != approval.DecisionApproved || resp.ApprovedBy != "unknown" {
+		t.Errorf("response = %s by %s, want approved by unknown", resp.Decision, resp.ApprovedBy)
+	}
+
+	// An admin API token (as the CLI sends) also authorizes a decision, as its own user
+	responses, link = pending()
+	requestID = strings.Split(link["reject"], "/")[3]
+	admin, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "carol", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	if code := call("/api/approvals/"+requestID+"/reject?approver=mallory", admin); code != http.StatusOK {
+		t.Fatalf("reject with API token = %d, want %d", code, http.StatusOK)
+	}
+	if resp := <-responses; resp.Decision != approval.DecisionRejected || resp.ApprovedBy != "carol" {
+		t.Errorf("response = %s by %s, want rejected by carol", resp.Decision, resp.ApprovedBy)
+	}
+
+	// An admin can't approve their own request
+	responses, link = pending()
+	requestID = strings.Split(link["approve"], "/")[3]
+	requester, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "Alice", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	if code := call("/api/approvals/"+requestID+"/approve", requester); code != http.StatusForbidden {
+		t.Fatalf("self-approval = %d, want %d", code, http.StatusForbidden)
+	}
+	data, _ = os.ReadFile(auditLog)
+	if got := strings.Count(string(data), `"approval_denied"`); got != 2 {
+		t.Errorf("audit log has %d approval_denied events after self-approval, want 2: %s", got, data)
+	}
+	if code := call("/api/approvals/"+requestID+"/reject", admin); code != http.StatusOK {
+		t.Fatalf("reject after self-approval = %d, want %d", code, http.StatusOK)
+	}
+	if resp := <-responses; resp.Decision != approval.DecisionRejected || len(resp.Approvers) != 0 {
+		t.Errorf("response = %s with approvers %v, want rejected with none", resp.Decision, resp.Approvers)
+	}
+}
+
+func TestApprovalCallbacks_ErrorBodies(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		Server: config.ServerConfig{Port: 8080},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Approval: &config.ApprovalConfig{
+			Enabled: true,
+			Webhook: &config.WebhookApprovalConfig{URL: "http://127.0.0.1:1/approvals", Secret: "callback-secret"},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: t.TempDir() + "/audit.log"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	admin, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "carol", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		header     http.Header
+		wantStatus int
+		wantCode   ErrorCode // Empty for a plain-text body
+	}{
+		{"forged link from a browser", "/api/approvals/req-1/approve?token=deadbeef", nil, http.StatusUnauthorized, ""},
+		{"forged link as JSON", "/api/approvals/req-1/approve?token=deadbeef", http.Header{"Accept": {"application/json"}}, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"invalid bearer token", "/api/approvals/req-1/reject", http.Header{"Authorization": {"Bearer not-a-token"}}, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"unknown request", "/api/approvals/req-1/approve", http.Header{"Authorization": {"Bearer " + admin}}, http.StatusNotFound, ErrCodeNotFound},
+		{"unknown request rejected", "/api/approvals/req-1/reject", http.Header{"Authorization": {"Bearer " + admin}}, http.StatusNotFound, ErrCodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp struct {
+				Error apiError `json:"error"`
+			}
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if tt.wantCode == "" {
+				if decodeErr == nil || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+					t.Errorf("browser error = %q (%s), want plain text", w.Body.String(), w.Header().Get("Content-Type"))
+				}
+				return
+			}
+			if decodeErr != nil || resp.Error.Code != tt.wantCode || resp.Error.Message == "" {
+				t.Errorf("error body = %s, want code %s", w.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// auditExportFlushEvery is how many rows are buffered before an export is flushed to the client
+const auditExportFlushEvery = 500
+
+// handleExportAuditLogs streams every audit entry matching the audit log filters
+// (username, action, connection, metadata.<key>) as CSV or NDJSON (?format=csv|ndjson, default csv)
+func (s *Server) handleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
+	cfg := s.GetConfig()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "format must be csv or ndjson")
+		return
+	}
+
+	filter := audit.Filter{
+		Username: r.URL.Query().Get("username"),
+		Action:   r.URL.Query().Get("action"),
+		Resource: r.URL.Query().Get("connection"),
+		Metadata: auditMetadataFilter(r),
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var err error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = exportAuditCSV(w, cfg.Logging.AuditLogPath, filter)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		err = exportAuditNDJSON(w, cfg.Logging.AuditLogPath, filter)
+	}
+	if err != nil {
+		// Headers are gone; all that's left is to stop and log
+		s.logger.Warn("audit export failed", "format", format, "error", err)
+	}
+}
+
+// exportAuditNDJSON writes one JSON entry per line
+func exportAuditNDJSON(w http.ResponseWriter, logPath string, filter audit.Filter) error {
+	encoder := json.NewEncoder(w)
+	rows := 0
+	return audit.Each(logPath, filter, func(entry audit.Entry) error {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		rows++
+		if rows%auditExportFlushEvery == 0 {
+			flushResponse(w)
+		}
+		return nil
+	})
+}
+
+// exportAuditCSV writes timestamp, username, action and resource columns, then one column per
+// flattened metadata key (nested objects become dotted keys). The keys are collected in a first
+// pass over the log so rows can be streamed in the second.
+func exportAuditCSV(w http.ResponseWriter, logPath string, filter audit.Filter) error {
+	keySet := make(map[string]bool)
+	err := audit.Each(logPath, filter, func(entry audit.Entry) error {
+		for key := range flattenMetadata(entry.Metadata) {
+			keySet[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writer := csv.NewWriter(w)
+	header := append([]string{"timestamp", "username", "action", "resource"}, keys...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	rows := 0
+	err = audit.Each(logPath, filter, func(entry audit.Entry) error {
+		metadata := flattenMetadata(entry.Metadata)
+		row := make([]string, 0, len(header))
+		row = append(row, entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.Username, entry.Action, entry.Resource)
+		for _, key := range keys {
+			row = append(row, metadata[key])
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%auditExportFlushEvery == 0 {
+			writer.Flush()
+			flushResponse(w)
+		}
+		return writer.Error()
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// flattenMetadata renders metadata values as strings keyed by dotted path.
+// Strings are kept as-is; other values are JSON-encoded.
+func flattenMetadata(metadata map[string]interface{}) map[string]string {
+	flat := make(map[string]string)
+	var walk func(prefix string, values map[string]interface{})
+	walk = func(prefix string, values map[string]interface{}) {
+		for key, value := range values {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				walk(prefix+key+".", v)
+			case string:
+				flat[prefix+key] = v
+			default:
+				encoded, err := json.Marshal(v)
+				if err != nil {
+					encoded = []byte(fmt.Sprint(v))
+				}
+				flat[prefix+key] = string(encoded)
+			}
+		}
+	}
+	walk("", metadata)
+	return flat
+}
+
+// flushResponse sends buffered response data to the client when the writer supports it
+func flushResponse(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
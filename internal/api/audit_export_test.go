@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+func TestHandleExportAuditLogs(t *testing.T) {
+	defer audit.Close()
+	server := newAdminTestServer(t)
+	auditPath := t.TempDir() + "/audit.log"
+	server.GetConfig().Logging.AuditLogPath = auditPath
+
+	// More entries than the 100 the audit log view returns
+	for i := 0; i < 150; i++ {
+		_ = audit.Log(auditPath, "alice", "postgres_query", "test-db", map[string]interface{}{"query": "SELECT 1, 2", "allowed": true})
+	}
+	_ = audit.Log(auditPath, "alice", "connect", "test-db", map[string]interface{}{"duration": "1h", "client": map[string]interface{}{"ip": "10.0.0.1"}})
+	_ = audit.Log(auditPath, "bob", "connect", "prod-db", nil)
+
+	t.Run("csv", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleExportAuditLogs(w, httptest.NewRequest(http.MethodGet, "/admin/api/audit/export?format=csv&username=alice", nil))
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment; filename=\"audit-") {
+			t.Fatalf("status = %d, Content-Disposition = %q", w.Code, w.Header().Get("Content-Disposition"))
+		}
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		wantHeader := "timestamp,username,action,resource,allowed,client.ip,duration,query"
+		if got := strings.Join(records[0], ","); got != wantHeader {
+			t.Errorf("header = %q, want %q", got, wantHeader)
+		}
+		if len(records) != 1+151 {
+			t.Fatalf("rows = %d, want 151 (every match, uncapped)", len(records)-1)
+		}
+		if got := strings.Join(records[1][1:], ","); got != "alice,postgres_query,test-db,true,,,SELECT 1, 2" {
+			t.Errorf("first row = %q", got)
+		}
+		if got := strings.Join(records[151][1:], ","); got != "alice,connect,test-db,,10.0.0.1,1h," {
+			t.Errorf("last row = %q", got)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleExportAuditLogs(w, httptest.NewRequest(http.MethodGet, "/admin/api/audit/export?format=ndjson&action=connect", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+		}
+
+		var users []string
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var entry audit.Entry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+			users = append(users, entry.Username)
+		}
+		if strings.Join(users, ",") != "alice,bob" {
+			t.Errorf("exported users = %v, want alice,bob", users)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleExportAuditLogs(w, httptest.NewRequest(http.MethodGet, "/admin/api/audit/export?format=xml", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
@@ -2,15 +2,23 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/audit"
 	"github.com/davidcohan/port-authorizing/internal/auth"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions
@@ -21,8 +29,16 @@ const (
 	ContextKeyUsername ContextKey = "username"
 	// ContextKeyRoles is the context key for storing user roles
 	ContextKeyRoles ContextKey = "roles"
+	// ContextKeyClaims is the context key for storing the validated token claims
+	ContextKeyClaims ContextKey = "claims"
 )
 
+// defaultTokenRenewalWindow is how long after login tokens can be refreshed without auth.token_renewal_window
+const defaultTokenRenewalWindow = 24 * time.Hour
+
+// errTokenAudience rejects a token signed with our secret but minted for another issuer or audience
+var errTokenAudience = errors.New("token issuer or audience mismatch")
+
 // AuthService handles authentication operations
 type AuthService struct {
 	config      *config.Config
@@ -46,7 +62,15 @@ func NewAuthService(cfg *config.Config) (*AuthService, error) {
 type Claims struct {
 	Username string   `json:"username"`
 	Roles    []string `json:"roles"`
-	Email    string   `json:"email,omitempty"`
+	Email    string   `json:"email"`
+	// Provider is the auth provider the user logged in with
+	Provider string `json:"provider,omitempty"`
+	// Groups are the identity provider groups at login; refreshes re-map them to current roles (OIDC)
+	Groups []string `json:"groups,omitempty"`
+	// AuthTime is when the user logged in; refreshed tokens keep it to bound the renewal window
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// SessionExpiresAt is when the identity provider session ends (OIDC); tokens are not renewed past it
+	SessionExpiresAt *jwt.NumericDate `json:"session_exp,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -72,9 +96,34 @@ type UserInfo struct {
 
 // handleLogin handles user login
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	_, span := tracing.Start(r.Context(), "auth.login")
+	defer span.End()
+
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	// Throttle repeated failures per username and per client IP before checking the password
+	throttleKeys := []string{"user:" + config.UsernameKey(req.Username)}
+	ip := clientIP(r, s.trustedProxies)
+	if ip != nil {
+		throttleKeys = append(throttleKeys, "ip:"+ip.String())
+	}
+	if wait, locked, key := s.loginThrottle.Wait(throttleKeys...); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		metadata := map[string]interface{}{
+			"locked":      locked,
+			"retry_after": retryAfter,
+			"scope":       strings.SplitN(key, ":", 2)[0],
+		}
+		if ip != nil {
+			metadata["client_ip"] = ip.String()
+		}
+		_ = audit.Log(s.config.Logging.AuditLogPath, req.Username, "login_throttled", "login", metadata)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		respondError(w, http.StatusTooManyRequests, ErrCodeTooManyLoginAttempts, fmt.Sprintf("Too many failed login attempts; try again in %ds", retryAfter))
 		return
 	}
 
@@ -86,16 +135,28 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	userInfo, err := s.authSvc.authManager.Authenticate(credentials)
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Invalid credentials")
+		tracing.Fail(span, err)
+		s.loginThrottle.Fail(throttleKeys...)
+		respondError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+	span.SetAttributes(attribute.String("username", userInfo.Username))
+	// Only the user's own counter clears: the IP counter decays with its window, so logging
+	// into one's own account can't reset guesses at other accounts from the same IP
+	s.loginThrottle.Reset(throttleKeys[0])
+
+	if !s.hasRequiredRoles(userInfo) {
+		respondError(w, http.StatusForbidden, ErrCodeNoRoles, noRolesMessage)
 		return
 	}
 
 	// Generate JWT token
 	token, expiresAt, err := s.authSvc.generateToken(userInfo)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to generate token")
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 		return
 	}
+	s.logins.Add(1)
 
 	respondJSON(w, http.StatusOK, LoginResponse{
 		Token:     token,
@@ -108,20 +169,165 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// noRolesMessage is returned for logins without roles when auth.require_role is set
+const noRolesMessage = "Login denied: no roles are assigned to this user; contact your administrator"
+
+// hasRequiredRoles enforces auth.require_role, auditing rejected logins
+func (s *Server) hasRequiredRoles(userInfo *auth.UserInfo) bool {
+	if !s.config.Auth.RequireRole || len(userInfo.Roles) > 0 {
+		return true
+	}
+	_ = audit.Log(s.config.Logging.AuditLogPath, userInfo.Username, "login_denied", "login", map[string]interface{}{
+		"reason":   "no_roles",
+		"provider": userInfo.Metadata["provider"],
+	})
+	return false
+}
+
+// handleRefreshToken issues a new token with a fresh expiry in exchange for a still-valid one
+// Renewals stop at auth.token_renewal_window after login or when the OIDC session ends.
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(ContextKeyClaims).(*Claims)
+
+	renewed, token, expiresAt, err := s.authSvc.refreshToken(claims)
+	if err != nil {
+		_ = audit.Log(s.config.Logging.AuditLogPath, claims.Username, "token_refresh_denied", "token", map[string]interface{}{
+			"provider": claims.Provider,
+			"reason":   err.Error(),
+		})
+		respondError(w, http.StatusForbidden, ErrCodeTokenNotRenewable, err.Error())
+		return
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, claims.Username, "token_refresh", "token", map[string]interface{}{
+		"provider":            claims.Provider,
+		"previous_expires_at": claims.ExpiresAt.Time,
+		"expires_at":          expiresAt,
+		"roles":               renewed.Roles,
+	})
+
+	respondJSON(w, http.StatusOK, LoginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User: UserInfo{
+			Username: renewed.Username,
+			Email:    renewed.Email,
+			Roles:    renewed.Roles,
+		},
+	})
+}
+
 // generateToken creates a new JWT token
 func (a *AuthService) generateToken(userInfo *auth.UserInfo) (string, time.Time, error) {
-	expiresAt := time.Now().Add(a.config.Auth.TokenExpiry)
+	now := time.Now()
 	claims := &Claims{
 		Username: userInfo.Username,
 		Roles:    userInfo.Roles,
 		Email:    userInfo.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		Provider: userInfo.Metadata["provider"],
+		Groups:   userInfo.Groups,
+		AuthTime: jwt.NewNumericDate(now),
+	}
+	if sessionEnd, err := time.Parse(time.RFC3339, userInfo.Metadata[auth.MetadataSessionExpiresAt]); err == nil {
+		claims.SessionExpiresAt = jwt.NewNumericDate(sessionEnd)
+	}
+
+	return a.signToken(claims, now.Add(a.config.Auth.TokenExpiry))
+}
+
+// refreshToken issues a new token for still-valid claims with a fresh expiry
+// The new expiry never goes past the renewal window (counted from login) or the
+// identity provider session, and the user's provider must still be configured.
+// Roles are resolved again where the provider can (local users, OIDC group mappings),
+// so a removed user or revoked role is not carried into the renewed token.
+func (a *AuthService) refreshToken(claims *Claims) (*Claims, string, time.Time, error) {
+	now := time.Now()
+
+	loginAt := claims.AuthTime
+	if loginAt == nil {
+		// Tokens issued before refreshes were supported only carry iat
+		loginAt = claims.IssuedAt
+	}
+	if loginAt == nil {
+		return nil, "", time.Time{}, fmt.Errorf("token has no login time")
+	}
+
+	window := a.config.Auth.TokenRenewalWindow
+	if window == 0 {
+		window = defaultTokenRenewalWindow
+	}
+	limit := loginAt.Add(window)
+	if claims.SessionExpiresAt != nil && claims.SessionExpiresAt.Before(limit) {
+		limit = claims.SessionExpiresAt.Time
+	}
+	if !now.Before(limit) {
+		return nil, "", time.Time{}, fmt.Errorf("token can no longer be renewed (limit reached at %s)", limit.UTC().Format(time.RFC3339))
+	}
+
+	roles := claims.Roles
+	if claims.Provider != "" {
+		provider := a.provider(claims.Provider)
+		if provider == nil {
+			return nil, "", time.Time{}, fmt.Errorf("auth provider %q is no longer available", claims.Provider)
+		}
+		if resolver, ok := provider.(auth.RoleResolver); ok {
+			current, err := resolver.ResolveRoles(claims.Username, claims.Groups)
+			if err != nil {
+				return nil, "", time.Time{}, err
+			}
+			roles = current
+		}
+	}
+	if len(roles) == 0 {
+		return nil, "", time.Time{}, fmt.Errorf("user %q has no roles", claims.Username)
+	}
+
+	expiresAt := now.Add(a.config.Auth.TokenExpiry)
+	if expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	renewed := &Claims{
+		Username:         claims.Username,
+		Roles:            roles,
+		Email:            claims.Email,
+		Provider:         claims.Provider,
+		Groups:           claims.Groups,
+		AuthTime:         loginAt,
+		SessionExpiresAt: claims.SessionExpiresAt,
+	}
+	token, expiresAt, err := a.signToken(renewed, expiresAt)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return renewed, token, expiresAt, nil
+}
+
+// provider returns the configured auth provider with the given name, or nil
+func (a *AuthService) provider(name string) auth.Provider {
+	for _, provider := range a.authManager.GetProviders() {
+		if provider.Name() == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+// signToken sets the token's registered claims (subject, issuer, audience, issue and
+// expiry times) and signs it
+func (a *AuthService) signToken(claims *Claims, expiresAt time.Time) (string, time.Time, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   claims.Username,
+		Issuer:    a.config.Auth.JWTIssuer,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	if a.config.Auth.JWTAudience != "" {
+		claims.Audience = jwt.ClaimStrings{a.config.Auth.JWTAudience}
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = jwtKeyID(a.config.Auth.JWTSecret)
 	tokenString, err := token.SignedString([]byte(a.config.Auth.JWTSecret))
 	if err != nil {
 		return "", time.Time{}, err
@@ -130,16 +336,33 @@ func (a *AuthService) generateToken(userInfo *auth.UserInfo) (string, time.Time,
 	return tokenString, expiresAt, nil
 }
 
-// validateToken validates and parses a JWT token
+// validateToken validates and parses a JWT token, checking iss and aud when
+// jwt_issuer and jwt_audience are configured. A correctly signed token for another
+// issuer or audience fails with errTokenAudience, returned with its claims for the audit.
 func (a *AuthService) validateToken(tokenString string) (*Claims, error) {
+	var options []jwt.ParserOption
+	if a.config.Auth.JWTIssuer != "" {
+		options = append(options, jwt.WithIssuer(a.config.Auth.JWTIssuer))
+	}
+	if a.config.Auth.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(a.config.Auth.JWTAudience))
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(a.config.Auth.JWTSecret), nil
-	})
+		return a.verificationKeys(token), nil
+	}, options...)
 
 	if err != nil {
+		// Claims are only checked once the signature is verified; iss and aud are the
+		// only required claims, missing from tokens minted before they were configured
+		if errors.Is(err, jwt.ErrTokenInvalidIssuer) || errors.Is(err, jwt.ErrTokenInvalidAudience) || errors.Is(err, jwt.ErrTokenRequiredClaimMissing) {
+			if claims, ok := token.Claims.(*Claims); ok {
+				return claims, fmt.Errorf("%w: %v", errTokenAudience, err)
+			}
+		}
 		return nil, err
 	}
 
@@ -150,31 +373,79 @@ func (a *AuthService) validateToken(tokenString string) (*Claims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
+// verificationKeys returns the secret named by the token's kid header or, for tokens
+// without a known kid, every accepted secret (jwt_secret first, then jwt_secrets)
+func (a *AuthService) verificationKeys(token *jwt.Token) jwt.VerificationKeySet {
+	secrets := append([]string{a.config.Auth.JWTSecret}, a.config.Auth.JWTSecrets...)
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		for _, secret := range secrets {
+			if jwtKeyID(secret) == kid {
+				return jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(secret)}}
+			}
+		}
+	}
+
+	keys := jwt.VerificationKeySet{}
+	for _, secret := range secrets {
+		keys.Keys = append(keys.Keys, []byte(secret))
+	}
+	return keys
+}
+
+// jwtKeyID identifies a secret in token headers without revealing it
+func jwtKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
 // authMiddleware validates JWT tokens
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			respondError(w, http.StatusUnauthorized, "Missing authorization header")
+			respondError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Missing authorization header")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			respondError(w, http.StatusUnauthorized, "Invalid authorization header format")
+			respondError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid authorization header format")
 			return
 		}
 
 		claims, err := s.authSvc.validateToken(parts[1])
+		if errors.Is(err, errTokenAudience) {
+			s.auditTokenAudience(r, claims)
+			respondError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Token was not issued for this server")
+			return
+		}
 		if err != nil {
-			respondError(w, http.StatusUnauthorized, "Invalid or expired token")
+			respondError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid or expired token")
 			return
 		}
 
 		// Add username and roles to context
 		ctx := context.WithValue(r.Context(), ContextKeyUsername, claims.Username)
 		ctx = context.WithValue(ctx, ContextKeyRoles, claims.Roles)
+		ctx = context.WithValue(ctx, ContextKeyClaims, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// auditTokenAudience records a correctly signed token presented with another issuer or audience,
+// e.g. a token from a different environment sharing the JWT secret
+func (s *Server) auditTokenAudience(r *http.Request, claims *Claims) {
+	metadata := map[string]interface{}{
+		"issuer":            claims.Issuer,
+		"audience":          []string(claims.Audience),
+		"expected_issuer":   s.config.Auth.JWTIssuer,
+		"expected_audience": s.config.Auth.JWTAudience,
+		"path":              r.URL.Path,
+	}
+	if ip := clientIP(r, s.trustedProxies); ip != nil {
+		metadata["client_ip"] = ip.String()
+	}
+	_ = audit.Log(s.config.Logging.AuditLogPath, claims.Username, "token_invalid_audience", "auth", metadata)
+}
@@ -228,6 +228,14 @@ func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.hasRequiredRoles(userInfo) {
+		if stateData.ws != nil {
+			_ = stateData.ws.WriteJSON(map[string]string{"error": noRolesMessage})
+		}
+		http.Error(w, noRolesMessage, http.StatusForbidden)
+		return
+	}
+
 	// Generate our JWT token
 	token, expiresAt, err := s.authSvc.generateToken(userInfo)
 	if err != nil {
@@ -238,6 +246,8 @@ func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.logins.Add(1)
+
 	// Log successful OIDC login
 	_ = audit.Log(s.config.Logging.AuditLogPath, userInfo.Username, "oidc_login_success", "oidc", map[string]interface{}{
 		"email":       userInfo.Email,
@@ -5,27 +5,34 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/auth"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestRespondError(t *testing.T) {
 	w := httptest.NewRecorder()
-	respondError(w, http.StatusBadRequest, "test error message")
+	respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "test error message")
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("status code = %d, want %d", w.Code, http.StatusBadRequest)
 	}
 
-	var response map[string]string
+	var response struct {
+		Error apiError `json:"error"`
+	}
 	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if response["error"] != "test error message" {
-		t.Errorf("error message = %s, want 'test error message'", response["error"])
+	if response.Error.Code != ErrCodeInvalidRequest || response.Error.Message != "test error message" {
+		t.Errorf("error = %+v, want invalid_request with 'test error message'", response.Error)
 	}
 }
 
@@ -279,3 +286,302 @@ func BenchmarkHandleLogin(b *testing.B) {
 		server.handleLogin(w, req)
 	}
 }
+
+func TestHandleRefreshToken(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret:          "test-secret",
+			TokenExpiry:        time.Hour,
+			TokenRenewalWindow: 8 * time.Hour,
+			Users: []config.User{
+				{Username: "admin", Password: "admin123", Roles: []string{"admin"}},
+				{Username: "departed", Password: "gone123"},
+			},
+		},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	refresh := func(token string) (int, LoginResponse) {
+		req := httptest.NewRequest("POST", "/api/token/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var response LoginResponse
+		_ = json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response
+	}
+
+	// A token issued at login can be refreshed and keeps its login time
+	body, _ := json.Marshal(LoginRequest{Username: "admin", Password: "admin123"})
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/login", bytes.NewReader(body)))
+	var login LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&login); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+
+	code, refreshed := refresh(login.Token)
+	if code != http.StatusOK || refreshed.Token == "" || refreshed.User.Username != "admin" {
+		t.Fatalf("refresh = %d %+v, want 200 with a new token", code, refreshed)
+	}
+	original, _ := server.authSvc.validateToken(login.Token)
+	renewed, err := server.authSvc.validateToken(refreshed.Token)
+	if err != nil {
+		t.Fatalf("refreshed token invalid: %v", err)
+	}
+	if !renewed.AuthTime.Equal(original.AuthTime.Time) || renewed.Provider != original.Provider {
+		t.Errorf("refreshed claims = %+v, want login time and provider of %+v", renewed, original)
+	}
+
+	if code, _ := refresh("not-a-token"); code != http.StatusUnauthorized {
+		t.Errorf("refresh with invalid token = %d, want 401", code)
+	}
+
+	sign := func(claims *Claims) string {
+		token, _, err := server.authSvc.signToken(claims, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("signToken() error = %v", err)
+		}
+		return token
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		claims     *Claims
+		wantStatus int
+		wantExpiry time.Time // Zero: now + token_expiry
+		wantRoles  []string  // Nil: not checked
+	}{
+		{
+			name:       "within renewal window",
+			claims:     &Claims{Username: "admin", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now.Add(-2 * time.Hour))},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "capped at renewal window",
+			claims:     &Claims{Username: "admin", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now.Add(-7*time.Hour - 30*time.Minute))},
+			wantStatus: http.StatusOK,
+			wantExpiry: now.Add(30 * time.Minute),
+		},
+		{
+			name:       "renewal window exceeded",
+			claims:     &Claims{Username: "admin", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now.Add(-9 * time.Hour))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "capped at identity provider session",
+			claims: &Claims{Username: "admin", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now),
+				SessionExpiresAt: jwt.NewNumericDate(now.Add(10 * time.Minute))},
+			wantStatus: http.StatusOK,
+			wantExpiry: now.Add(10 * time.Minute),
+		},
+		{
+			name: "identity provider session ended",
+			claims: &Claims{Username: "admin", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now),
+				SessionExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "user removed since login",
+			claims:     &Claims{Username: "ghost", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "user has no roles anymore",
+			claims:     &Claims{Username: "departed", Provider: "local", Roles: []string{"admin"}, AuthTime: jwt.NewNumericDate(now)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token without roles",
+			claims:     &Claims{Username: "sso-user", AuthTime: jwt.NewNumericDate(now)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "roles changed since login",
+			claims:     &Claims{Username: "admin", Provider: "local", Roles: []string{"admin", "dba"}, AuthTime: jwt.NewNumericDate(now)},
+			wantStatus: http.StatusOK,
+			wantRoles:  []string{"admin"},
+		},
+		{
+			name:       "provider no longer configured",
+			claims:     &Claims{Username: "admin", Provider: "corp-oidc", AuthTime: jwt.NewNumericDate(now)},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := refresh(sign(tt.claims))
+			if code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", code, tt.wantStatus)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			wantExpiry := tt.wantExpiry
+			if wantExpiry.IsZero() {
+				wantExpiry = time.Now().Add(cfg.Auth.TokenExpiry)
+			}
+			if diff := response.ExpiresAt.Sub(wantExpiry); diff < -2*time.Second || diff > 2*time.Second {
+				t.Errorf("expires_at = %s, want about %s", response.ExpiresAt, wantExpiry)
+			}
+			if tt.wantRoles != nil {
+				renewed, err := server.authSvc.validateToken(response.Token)
+				if err != nil {
+					t.Fatalf("refreshed token invalid: %v", err)
+				}
+				if !reflect.DeepEqual(renewed.Roles, tt.wantRoles) || !reflect.DeepEqual(response.User.Roles, tt.wantRoles) {
+					t.Errorf("refreshed roles = %v (response %v), want %v", renewed.Roles, response.User.Roles, tt.wantRoles)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLogin_RequireRole(t *testing.T) {
+	defer audit.Close()
+
+	for _, requireRole := range []bool{false, true} {
+		auditPath := filepath.Join(t.TempDir(), "audit.log")
+		server, err := NewServer(&config.Config{
+			Auth: config.AuthConfig{
+				JWTSecret:   "test-secret",
+				TokenExpiry: time.Hour,
+				Users:       []config.User{{Username: "norole", Password: "secret123"}},
+				RequireRole: requireRole,
+			},
+			Logging: config.LoggingConfig{AuditLogPath: auditPath},
+		})
+		if err != nil {
+			t.Fatalf("NewServer() error = %v", err)
+		}
+
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewReader([]byte(`{"username": "norole", "password": "secret123"}`)))
+		w := httptest.NewRecorder()
+		server.handleLogin(w, req)
+
+		entries, _ := audit.Query(auditPath, audit.Filter{Action: "login_denied"})
+		if !requireRole {
+			if w.Code != http.StatusOK || len(entries) != 0 {
+				t.Errorf("require_role off: status = %d, login_denied entries = %d; want 200, 0", w.Code, len(entries))
+			}
+			continue
+		}
+		if w.Code != http.StatusForbidden {
+			t.Errorf("require_role on: status = %d, want 403", w.Code)
+		}
+		if len(entries) != 1 || entries[0].Metadata["reason"] != "no_roles" {
+			t.Errorf("login_denied audit entries = %+v", entries)
+		}
+	}
+}
+
+func TestValidateToken_SecretRotation(t *testing.T) {
+	newService := func(secret string, previous ...string) *AuthService {
+		svc, err := NewAuthService(&config.Config{
+			Auth: config.AuthConfig{JWTSecret: secret, JWTSecrets: previous, TokenExpiry: time.Hour},
+		})
+		if err != nil {
+			t.Fatalf("NewAuthService() error = %v", err)
+		}
+		return svc
+	}
+	user := &auth.UserInfo{Username: "alice", Roles: []string{"dev"}}
+
+	old := newService("old-secret")
+	oldToken, _, err := old.generateToken(user)
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	// Tokens issued before kid headers were added carry none
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Username:         "alice",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	legacyToken, _ := legacy.SignedString([]byte("old-secret"))
+
+	rotated := newService("new-secret", "old-secret")
+	newToken, _, _ := rotated.generateToken(user)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if parsed.Header["kid"] != jwtKeyID("new-secret") {
+		t.Errorf("kid = %v, want the new secret's key ID", parsed.Header["kid"])
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "legacy": legacyToken, "new": newToken} {
+		if claims, err := rotated.validateToken(token); err != nil || claims.Username != "alice" {
+			t.Errorf("%s token during rotation: claims = %+v, err = %v", name, claims, err)
+		}
+	}
+
+	// Once the old secret is dropped, its tokens stop validating
+	done := newService("new-secret")
+	for name, token := range map[string]string{"old": oldToken, "legacy": legacyToken} {
+		if _, err := done.validateToken(token); err == nil {
+			t.Errorf("%s token validated after the old secret was removed", name)
+		}
+	}
+	if _, err := done.validateToken(newToken); err != nil {
+		t.Errorf("new token after rotation: %v", err)
+	}
+}
+
+func TestAuthMiddleware_IssuerAudience(t *testing.T) {
+	defer audit.Close()
+	server := newAdminTestServer(t)
+	cfg := server.GetConfig()
+	cfg.Logging.AuditLogPath = filepath.Join(t.TempDir(), "audit.log")
+	cfg.Auth.JWTIssuer = "port-authorizing-prod"
+	cfg.Auth.JWTAudience = "prod-api"
+
+	user := &auth.UserInfo{Username: "developer", Email: "dev@example.com", Roles: []string{"developer"}}
+	prodToken, _, err := server.authSvc.generateToken(user)
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(prodToken, &Claims{})
+	claims := parsed.Claims.(*Claims)
+	if claims.Issuer != "port-authorizing-prod" || len(claims.Audience) != 1 || claims.Audience[0] != "prod-api" || claims.Subject != "developer" || claims.Email != "dev@example.com" {
+		t.Errorf("minted claims = %+v, want iss, aud, sub and email set", claims)
+	}
+
+	// Same secret, another environment
+	staging, err := NewAuthService(&config.Config{Auth: config.AuthConfig{
+		JWTSecret: cfg.Auth.JWTSecret, TokenExpiry: time.Hour, JWTIssuer: "port-authorizing-staging", JWTAudience: "staging-api",
+	}})
+	if err != nil {
+		t.Fatalf("NewAuthService() error = %v", err)
+	}
+	stagingToken, _, _ := staging.generateToken(user)
+	// Tokens minted before jwt_issuer/jwt_audience were configured carry neither
+	unscoped, _ := NewAuthService(&config.Config{Auth: config.AuthConfig{JWTSecret: cfg.Auth.JWTSecret, TokenExpiry: time.Hour}})
+	unscopedToken, _, _ := unscoped.generateToken(user)
+
+	for name, tt := range map[string]struct {
+		token string
+		want  int
+	}{
+		"prod":     {prodToken, http.StatusOK},
+		"staging":  {stagingToken, http.StatusUnauthorized},
+		"unscoped": {unscopedToken, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/api/connections", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s token: status = %d, want %d", name, w.Code, tt.want)
+		}
+	}
+
+	entries, _ := audit.Query(cfg.Logging.AuditLogPath, audit.Filter{Action: "token_invalid_audience"})
+	if len(entries) != 2 || entries[0].Username != "developer" || entries[0].Metadata["issuer"] != "port-authorizing-staging" {
+		t.Errorf("token_invalid_audience entries = %+v, want one per rejected token", entries)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/gorilla/websocket"
+)
+
+// defaultBannerAckTimeout is how long a stream waits for the banner acknowledgement
+const defaultBannerAckTimeout = 60 * time.Second
+
+// bannerMessage is the text-frame handshake used for banner acknowledgement
+// Server sends {"type":"banner_ack_request","message":...,"token":...};
+// the CLI answers {"type":"banner_ack","token":...} once the user has agreed.
+type bannerMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	Token   string `json:"token"`
+}
+
+// requiresBannerAck reports whether streams on a connection must be acknowledged first
+func requiresBannerAck(conn *proxy.Connection) bool {
+	return conn.Config.Banner != nil && conn.Config.Banner.RequireAck
+}
+
+// awaitBannerAck runs the banner acknowledgement handshake on a tunnel before any
+// traffic is forwarded. Returns false (after closing the tunnel) if the client
+// did not acknowledge in time.
+func (s *Server) awaitBannerAck(wsConn *websocket.Conn, conn *proxy.Connection, username string) bool {
+	if !requiresBannerAck(conn) {
+		return true
+	}
+
+	banner := conn.Config.Banner
+	timeout := banner.AckTimeout
+	if timeout == 0 {
+		timeout = defaultBannerAckTimeout
+	}
+
+	reject := func(reason string) bool {
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "banner_ack_missing", conn.Config.Name, map[string]interface{}{
+			"connection_id": conn.ID,
+			"reason":        reason,
+		})
+		_ = wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Banner acknowledgement required"))
+		return false
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return reject(fmt.Sprintf("failed to generate token: %v", err))
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	request, _ := json.Marshal(bannerMessage{Type: "banner_ack_request", Message: banner.Message, Token: token})
+	if err := wsConn.WriteMessage(websocket.TextMessage, request); err != nil {
+		return reject(fmt.Sprintf("failed to send banner: %v", err))
+	}
+
+	_ = wsConn.SetReadDeadline(time.Now().Add(timeout))
+	messageType, data, err := wsConn.ReadMessage()
+	if err != nil {
+		return reject(fmt.Sprintf("no acknowledgement: %v", err))
+	}
+
+	var ack bannerMessage
+	if messageType != websocket.TextMessage || json.Unmarshal(data, &ack) != nil ||
+		ack.Type != "banner_ack" || ack.Token != token {
+		return reject("invalid acknowledgement")
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "banner_acknowledged", conn.Config.Name, map[string]interface{}{
+		"connection_id":   conn.ID,
+		"acknowledged_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	return true
+}
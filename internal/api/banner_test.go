@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/auth"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+func TestAwaitBannerAck(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     func(ws *websocket.Conn, request bannerMessage)
+		wantOK    bool
+		wantEvent string
+	}{
+		{
+			name: "acknowledged",
+			reply: func(ws *websocket.Conn, request bannerMessage) {
+				ack, _ := json.Marshal(bannerMessage{Type: "banner_ack", Token: request.Token})
+				_ = ws.WriteMessage(websocket.TextMessage, ack)
+			},
+			wantOK:    true,
+			wantEvent: "banner_acknowledged",
+		},
+		{
+			name: "wrong token",
+			reply: func(ws *websocket.Conn, request bannerMessage) {
+				ack, _ := json.Marshal(bannerMessage{Type: "banner_ack", Token: "forged"})
+				_ = ws.WriteMessage(websocket.TextMessage, ack)
+			},
+			wantEvent: "banner_ack_missing",
+		},
+		{
+			name: "data instead of ack",
+			reply: func(ws *websocket.Conn, request bannerMessage) {
+				_ = ws.WriteMessage(websocket.BinaryMessage, []byte("SELECT 1"))
+			},
+			wantEvent: "banner_ack_missing",
+		},
+		{
+			name:      "no reply",
+			reply:     func(ws *websocket.Conn, request bannerMessage) {},
+			wantEvent: "banner_ack_missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+				Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+				Connections: []config.ConnectionConfig{{
+					Name: "prod-db", Type: "postgres", Host: "localhost", Port: 5432,
+					Banner: &config.BannerConfig{Message: "Authorized use only", RequireAck: true, AckTimeout: 200 * time.Millisecond},
+				}},
+				Logging: config.LoggingConfig{AuditLogPath: t.TempDir() + "/audit.log"},
+			}
+			server, err := NewServer(cfg)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			defer server.connMgr.CloseAll()
+
+			id, _, err := server.connMgr.CreateConnection("alice", &cfg.Connections[0], time.Hour, nil, cfg.Logging.AuditLogPath, nil)
+			if err != nil {
+				t.Fatalf("CreateConnection() error = %v", err)
+			}
+			conn, _ := server.connMgr.GetConnection(id)
+
+			result := make(chan bool, 1)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				wsConn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer func() { _ = wsConn.Close() }()
+				result <- server.awaitBannerAck(wsConn, conn, "alice")
+			}))
+			defer ts.Close()
+
+			client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer func() { _ = client.Close() }()
+
+			_, data, err := client.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			var request bannerMessage
+			if err := json.Unmarshal(data, &request); err != nil || request.Type != "banner_ack_request" ||
+				request.Message != "Authorized use only" || request.Token == "" {
+				t.Fatalf("banner request = %s", data)
+			}
+			tt.reply(client, request)
+
+			select {
+			case ok := <-result:
+				if ok != tt.wantOK {
+					t.Errorf("awaitBannerAck() = %v, want %v", ok, tt.wantOK)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("awaitBannerAck() did not return")
+			}
+
+			logData, _ := os.ReadFile(cfg.Logging.AuditLogPath)
+			if !strings.Contains(string(logData), tt.wantEvent) {
+				t.Errorf("audit log missing %s: %s", tt.wantEvent, logData)
+			}
+		})
+	}
+}
+
+func TestHandleProxyStream_BannerAckRequiresWebSocket(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{{
+			Name: "prod-db", Type: "postgres", Host: "localhost", Port: 5432,
+			Banner: &config.BannerConfig{Message: "Authorized use only", RequireAck: true},
+		}},
+		Logging: config.LoggingConfig{AuditLogPath: t.TempDir() + "/audit.log"},
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.connMgr.CloseAll()
+
+	id, _, err := server.connMgr.CreateConnection("alice", &cfg.Connections[0], time.Hour, nil, cfg.Logging.AuditLogPath, nil)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "alice", Roles: []string{"dev"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	req := httptest.NewRequest("POST", "/api/proxy/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 (body %s)", w.Code, w.Body.String())
+	}
+}
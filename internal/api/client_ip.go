@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies parses trusted proxy IPs and CIDRs from config
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy CIDR %s: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// isTrustedProxy checks if an IP belongs to a trusted proxy
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP resolves the client IP of a request.
+// X-Forwarded-For is only honored when the direct peer is a trusted proxy; the
+// header is walked right to left, skipping trusted hops, so clients cannot spoof it.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	var hops []string
+	for _, value := range forwarded {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// clientRemoteAddr returns r.RemoteAddr with the host replaced by the resolved client IP,
+// for the synthetic requests streams hand to protocol proxies
+func clientRemoteAddr(r *http.Request, trusted []*net.IPNet) string {
+	ip := clientIP(r, trusted)
+	if ip == nil {
+		return r.RemoteAddr
+	}
+	_, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		port = "0"
+	}
+	return net.JoinHostPort(ip.String(), port)
+}
+
+// clientScheme returns the scheme the client used to reach the API: https for a TLS
+// request, or the X-Forwarded-Proto set by a trusted proxy terminating TLS in front of it
+func clientScheme(r *http.Request, trusted []*net.IPNet) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !isTrustedProxy(ip, trusted) {
+		return "http"
+	}
+
+	// The nearest proxy's value is last
+	values := strings.Split(strings.Join(r.Header.Values("X-Forwarded-Proto"), ","), ",")
+	if proto := strings.ToLower(strings.TrimSpace(values[len(values)-1])); proto == "https" {
+		return proto
+	}
+	return "http"
+}
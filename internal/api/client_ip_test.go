@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error = %v", err)
+	}
+	if len(nets) != 3 {
+		t.Errorf("parseTrustedProxies() returned %d networks, want 3", len(nets))
+	}
+
+	if _, err := parseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("parseTrustedProxies() expected error for invalid entry")
+	}
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("parseTrustedProxies() expected error for invalid CIDR")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := parseTrustedProxies([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.5:1234",
+			want:       "203.0.113.5",
+		},
+		{
+			name:         "untrusted peer cannot spoof header",
+			remoteAddr:   "203.0.113.5:1234",
+			forwardedFor: "198.51.100.1",
+			want:         "203.0.113.5",
+		},
+		{
+			name:         "trusted proxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "198.51.100.1",
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "multiple trusted hops",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "1.2.3.4, 198.51.100.1, 10.0.0.2",
+			want:         "198.51.100.1",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/connect/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := clientIP(req, trusted).String(); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientScheme(t *testing.T) {
+	trusted, _ := parseTrustedProxies([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		tls            bool
+		forwardedProto string
+		want           string
+	}{
+		{"plain client", "203.0.113.5:1234", false, "", "http"},
+		{"tls client", "203.0.113.5:1234", true, "", "https"},
+		{"untrusted peer cannot claim https", "203.0.113.5:1234", false, "https", "http"},
+		{"trusted proxy terminating tls", "10.0.0.1:1234", false, "https", "https"},
+		{"nearest trusted proxy wins", "10.0.0.1:1234", false, "https, http", "http"},
+		{"trusted proxy without header", "10.0.0.1:1234", false, "", "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/proxy/conn-1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+
+			if got := clientScheme(req, trusted); got != tt.want {
+				t.Errorf("clientScheme() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
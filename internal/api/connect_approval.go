@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
+)
+
+// defaultConnectApprovalTimeout is how long a connect waits for approval when approval_timeout is unset
+const defaultConnectApprovalTimeout = 5 * time.Minute
+
+// approveConnect holds a connect to a connection with require_approval until an approver
+// decides. It returns 0 once approved, or the status, code and message to refuse the connect with.
+// A non-zero extendTo asks to extend a live connection until then instead.
+func (s *Server) approveConnect(ctx context.Context, w http.ResponseWriter, username, reason string, connConfig *config.ConnectionConfig, extendTo time.Time) (int, ErrorCode, string) {
+	auditLogPath := s.config.Logging.AuditLogPath
+	timeout := connConfig.ApprovalTimeout
+	if timeout <= 0 {
+		timeout = defaultConnectApprovalTimeout
+	}
+	// The server's write timeout would cut the response off while the approver decides
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 30*time.Second))
+
+	req := &approval.Request{
+		Username: username,
+		Method:   "CONNECT",
+		Path:     connConfig.Name,
+		Tags:     connConfig.Tags,
+		Metadata: map[string]string{
+			"connection_name": connConfig.Name,
+			"connection_type": connConfig.Type,
+		},
+	}
+	if reason != "" {
+		req.Metadata["reason"] = reason
+	}
+	requested := map[string]interface{}{
+		"reason":  reason,
+		"timeout": timeout.String(),
+	}
+	if !extendTo.IsZero() {
+		req.Method = "EXTEND"
+		req.Metadata["extend_to"] = extendTo.Format(time.RFC3339)
+		requested["extend_to"] = extendTo.Format(time.RFC3339)
+	}
+
+	_ = audit.Log(auditLogPath, username, "connect_approval_requested", connConfig.Name, tracing.Annotate(ctx, requested))
+
+	resp, err := s.approvalMgr.RequestApproval(ctx, req, timeout)
+	if err != nil {
+		_ = audit.Log(auditLogPath, username, "connect_approval_error", connConfig.Name, tracing.Annotate(ctx, map[string]interface{}{
+			"error": err.Error(),
+		}))
+		return http.StatusServiceUnavailable, ErrCodeApprovalUnavailable, "Connection requires approval, but the approval request failed"
+	}
+
+	if resp.Decision != approval.DecisionApproved {
+		_ = audit.Log(auditLogPath, username, "connect_approval_rejected", connConfig.Name, tracing.Annotate(ctx, map[string]interface{}{
+			"request_id":  resp.RequestID,
+			"decision":    resp.Decision,
+			"reason":      resp.Reason,
+			"rejected_by": resp.ApprovedBy,
+			"channel":     resp.Channel,
+			"ledger":      resp.Ledger,
+		}))
+		if resp.Decision == approval.DecisionTimeout {
+			return http.StatusForbidden, ErrCodeApprovalDenied, "Access denied: connection approval timed out"
+		}
+		return http.StatusForbidden, ErrCodeApprovalDenied, "Access denied: connection approval was rejected"
+	}
+
+	_ = audit.Log(auditLogPath, username, "connect_approval_granted", connConfig.Name, tracing.Annotate(ctx, map[string]interface{}{
+		"request_id":  resp.RequestID,
+		"approved_by": resp.ApprovedBy,
+		"channel":     resp.Channel,
+		"ledger":      resp.Ledger,
+	}))
+	return 0, "", ""
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ExtendRequest asks for more time on a live connection (the body is optional)
+type ExtendRequest struct {
+	// Duration is added to the current expiry (e.g. "30m"); defaults to the connection's duration
+	Duration string `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"` // Shown to approvers of connections with require_approval
+}
+
+// ExtendResponse reports the new expiry of an extended connection
+type ExtendResponse struct {
+	ConnectionID      string    `json:"connection_id"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	// MaxExpiresAt is as far as the connection can ever be extended
+	MaxExpiresAt time.Time `json:"max_expires_at"`
+}
+
+// tunnelNotice is a JSON text message telling the CLI about a change to its connection
+type tunnelNotice struct {
+	Type      string    `json:"type"` // connection_extended
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// connectionMaxLifetime returns how long a connection may last in total, extensions
+// included: the server's max_connection_duration, capped by the tightest policy max_duration
+func (s *Server) connectionMaxLifetime(authz *authorization.Authorizer, roles []string, connConfig *config.ConnectionConfig) time.Duration {
+	limit := s.config.Server.MaxConnectionDuration
+	if policyMax := authz.MaxDurationForConnection(roles, connConfig.Name); policyMax > 0 && (limit == 0 || policyMax < limit) {
+		limit = policyMax
+	}
+	return limit
+}
+
+// handleExtendConnection pushes out the expiry of one of the user's live connections by
+// the requested duration (default: the connection's duration), never past its max lifetime
+// counted from when it was opened. Connections with require_approval need a fresh approval.
+func (s *Server) handleExtendConnection(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(ContextKeyUsername).(string)
+	roles, _ := r.Context().Value(ContextKeyRoles).([]string)
+	connectionID := mux.Vars(r)["connectionID"]
+
+	conn, err := s.connMgr.GetConnection(connectionID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
+		return
+	}
+
+	// Verify ownership
+	if conn.Username != username {
+		respondError(w, http.StatusForbidden, ErrCodeForbidden, "Access denied")
+		return
+	}
+	if !s.checkConnectionSource(w, r, conn) {
+		return
+	}
+	authz := s.connectionAuthz(conn)
+
+	connConfig := conn.Config
+	connectionName := connConfig.Name
+	ctx, span := tracing.Start(r.Context(), "proxy.extend",
+		attribute.String("username", username),
+		attribute.String("connection", connectionName),
+		attribute.String("connection_id", connectionID))
+	defer span.End()
+
+	var req ExtendRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+			return
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxConnectReasonLength {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Reason is too long (at most %d characters)", maxConnectReasonLength))
+		return
+	}
+	if reason == "" {
+		reason = conn.Reason()
+	}
+
+	step := s.connectionDuration(authz, roles, connConfig)
+	if req.Duration != "" {
+		requested, err := time.ParseDuration(req.Duration)
+		if err != nil || requested <= 0 {
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid duration %q", req.Duration))
+			return
+		}
+		step = requested
+	}
+
+	// The user must still be granted the connection
+	access := authz.CheckConnectionAccess(roles, connectionName)
+	decision := audit.Decision{
+		Subject:  username,
+		Roles:    roles,
+		Action:   "extend",
+		Resource: connectionName,
+		Decision: audit.DecisionAllow,
+		Policy:   access.Policy,
+		Reason:   access.Reason,
+	}
+	previous := conn.ExpiresAt()
+	deny := func(status int, code ErrorCode, message, reason string) {
+		decision.Decision = audit.DecisionDeny
+		span.SetAttributes(attribute.String("decision", string(code)))
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "connection_extend_denied", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"connection_id":  connectionID,
+			"old_expires_at": previous.Format(time.RFC3339),
+			"roles":          roles,
+			"reason":         reason,
+		}))
+		respondError(w, status, code, message)
+	}
+	if !access.Allowed {
+		if access.OutsideSchedule {
+			deny(http.StatusForbidden, ErrCodeOutsideSchedule, "Access denied: this connection is outside its scheduled access hours", "outside_schedule")
+			return
+		}
+		deny(http.StatusForbidden, ErrCodeAccessDenied, "Access denied: insufficient permissions for this connection", "insufficient permissions")
+		return
+	}
+
+	// Extensions never take the connection past its max lifetime
+	maxExpiresAt := conn.CreatedAt.Add(s.connectionMaxLifetime(authz, roles, connConfig))
+	expiresAt := previous.Add(step)
+	if expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+	if !expiresAt.After(previous) {
+		decision.Policy = "max_duration"
+		decision.Reason = fmt.Sprintf("connection already at its max duration (until %s)", maxExpiresAt.Format(time.RFC3339))
+		deny(http.StatusForbidden, ErrCodeExtensionLimit,
+			fmt.Sprintf("Connection cannot be extended past its maximum duration (until %s)", maxExpiresAt.Format(time.RFC3339)), "max_duration")
+		return
+	}
+
+	// Connections with require_approval are only extended once an approver agrees
+	if connConfig.RequireApproval {
+		if status, code, message := s.approveConnect(ctx, w, username, reason, connConfig, expiresAt); status != 0 {
+			decision.Policy = "require_approval"
+			decision.Reason = message
+			deny(status, code, message, "approval_denied")
+			return
+		}
+	}
+
+	previous, err = s.connMgr.ExtendConnection(connectionID, expiresAt)
+	if err != nil {
+		tracing.Fail(span, err)
+		if errors.Is(err, proxy.ErrNotExtended) {
+			// Extended by a concurrent request in the meantime
+			respondError(w, http.StatusConflict, ErrCodeInvalidRequest, "Connection was extended by another request; try again")
+			return
+		}
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
+		return
+	}
+	_ = audit.LogDecision(decision)
+	span.SetAttributes(attribute.String("decision", "allowed"))
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "connection_extended", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+		"connection_id":  connectionID,
+		"old_expires_at": previous.Format(time.RFC3339),
+		"new_expires_at": expiresAt.Format(time.RFC3339),
+		"max_expires_at": maxExpiresAt.Format(time.RFC3339),
+		"reason":         reason,
+	}))
+
+	respondJSON(w, http.StatusOK, ExtendResponse{
+		ConnectionID:      connectionID,
+		ExpiresAt:         expiresAt,
+		PreviousExpiresAt: previous,
+		MaxExpiresAt:      maxExpiresAt,
+	})
+}
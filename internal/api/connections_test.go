@@ -2,13 +2,22 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/auth"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
 )
 
 func TestHandleConnect_FullFlow(t *testing.T) {
@@ -138,7 +147,8 @@ func TestHandleConnect_FullFlow(t *testing.T) {
 func TestHandleListConnections_WithFiltering(t *testing.T) {
 	cfg := &config.Config{
 		Server: config.ServerConfig{
-			Port: 8080,
+			Port:                  8080,
+			MaxConnectionDuration: 2 * time.Hour,
 		},
 		Auth: config.AuthConfig{
 			JWTSecret:   "test-secret",
@@ -148,7 +158,8 @@ func TestHandleListConnections_WithFiltering(t *testing.T) {
 			},
 		},
 		Connections: []config.ConnectionConfig{
-			{Name: "test-db-1", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:test"}},
+			{Name: "test-db-1", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:test"}, Duration: 30 * time.Minute,
+				Metadata: map[string]string{"description": "Test database", "database": "app"}},
 			{Name: "test-db-2", Type: "postgres", Host: "localhost", Port: 5433, Tags: []string{"env:test"}},
 			{Name: "prod-db", Type: "postgres", Host: "prod.example.com", Port: 5432, Tags: []string{"env:prod"}},
 		},
@@ -159,6 +170,8 @@ func TestHandleListConnections_WithFiltering(t *testing.T) {
 				Tags:      []string{"env:test"},
 				TagMatch:  "any",
 				Whitelist: []string{"^SELECT.*"},
+				// Caps test-db-2's server default, but not test-db-1's shorter duration
+				MaxDuration: time.Hour,
 			},
 		},
 		Logging: config.LoggingConfig{
@@ -198,14 +211,25 @@ func TestHandleListConnections_WithFiltering(t *testing.T) {
 		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
 	}
 
-	var connections []interface{}
+	var connections []ConnectionInfo
 	if err := json.NewDecoder(w.Body).Decode(&connections); err != nil {
 		t.Fatalf("Failed to decode response: %v, body: %s", err, w.Body.String())
 	}
 
 	// Developer should only see 2 test connections, not prod
 	if len(connections) != 2 {
-		t.Errorf("connections count = %d, want 2", len(connections))
+		t.Fatalf("connections count = %d, want 2", len(connections))
+	}
+
+	first := connections[0]
+	if first.Description != "Test database" || len(first.Tags) != 1 || first.MaxDuration != "30m0s" {
+		t.Errorf("test-db-1 = %+v, want description, tags and a 30m max duration", first)
+	}
+	if _, leaked := first.Metadata["database"]; leaked {
+		t.Errorf("test-db-1 metadata = %v, want only display metadata", first.Metadata)
+	}
+	if connections[1].MaxDuration != "1h0m0s" {
+		t.Errorf("test-db-2 max duration = %q, want the policy cap 1h0m0s", connections[1].MaxDuration)
 	}
 }
 
@@ -267,3 +291,804 @@ func BenchmarkHandleConnect(b *testing.B) {
 		server.router.ServeHTTP(w, req)
 	}
 }
+
+// fakeCountryLookup maps IP strings to country codes
+type fakeCountryLookup map[string]string
+
+func (f fakeCountryLookup) Country(ip net.IP) (string, error) {
+	return f[ip.String()], nil
+}
+
+func TestHandleConnect_Geofence(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Port:                  8080,
+			MaxConnectionDuration: time.Hour,
+		},
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: 24 * time.Hour,
+			Users: []config.User{
+				{Username: "admin", Password: "admin123", Roles: []string{"admin"}},
+			},
+		},
+		Connections: []config.ConnectionConfig{
+			{
+				Name: "eu-db",
+				Type: "postgres",
+				Host: "localhost",
+				Port: 5432,
+				Tags: []string{"env:prod"},
+				Geofence: &config.GeofenceConfig{
+					AllowedCountries: []string{"DE", "FR"},
+				},
+			},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "admin-all", Roles: []string{"admin"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}},
+		},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "admin", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		geoIP      fakeCountryLookup
+		remoteAddr string
+		wantStatus int
+	}{
+		{
+			name:       "allowed country",
+			geoIP:      fakeCountryLookup{"203.0.113.5": "DE"},
+			remoteAddr: "203.0.113.5:1234",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disallowed country",
+			geoIP:      fakeCountryLookup{"198.51.100.1": "US"},
+			remoteAddr: "198.51.100.1:1234",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unknown country",
+			geoIP:      fakeCountryLookup{},
+			remoteAddr: "192.168.1.10:1234",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no geoip database",
+			remoteAddr: "203.0.113.5:1234",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.geoIP = nil
+			if tt.geoIP != nil {
+				server.geoIP = tt.geoIP
+			}
+
+			req := httptest.NewRequest("POST", "/api/connect/eu-db", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleConnect_SourceCIDRs(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Port:                  8080,
+			MaxConnectionDuration: time.Hour,
+			TrustedProxies:        []string{"10.0.0.1"},
+		},
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: 24 * time.Hour,
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "office-db", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "office-only", Roles: []string{"developer"}, Tags: []string{"env:prod"}, SourceCIDRs: []string{"203.0.113.0/24"}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditLog},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "dev", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		wantStatus    int
+		wantDeniedLog string
+	}{
+		{name: "direct from allowed network", remoteAddr: "203.0.113.7:1234", wantStatus: http.StatusOK},
+		{name: "direct from other network", remoteAddr: "198.51.100.1:1234", wantStatus: http.StatusForbidden, wantDeniedLog: "198.51.100.1"},
+		{name: "forwarded by trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "203.0.113.9", wantStatus: http.StatusOK},
+		{name: "forwarded by untrusted proxy", remoteAddr: "10.0.0.2:1234", forwardedFor: "203.0.113.9", wantStatus: http.StatusForbidden, wantDeniedLog: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/connect/office-db", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantDeniedLog != "" {
+				data, _ := os.ReadFile(auditLog)
+				if !strings.Contains(string(data), `"ip_denied"`) || !strings.Contains(string(data), tt.wantDeniedLog) {
+					t.Errorf("audit log missing ip_denied for %s: %s", tt.wantDeniedLog, data)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleConnect_SourceScopedPolicies(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: 24 * time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-api", Type: "http", Host: "localhost", Port: 8081, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "vpn-write", Roles: []string{"developer"}, Tags: []string{"env:prod"}, SourceCIDRs: []string{"10.8.0.0/16"}, Whitelist: []string{`.*`}},
+			{Name: "anywhere-read", Roles: []string{"developer"}, Tags: []string{"env:prod"}, Whitelist: []string{`^GET `}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditLog},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "dev", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	connect := func(remoteAddr string) *proxy.Connection {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/connect/prod-api", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		var resp ConnectResponse
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("connect from %s: status = %d, body: %s", remoteAddr, w.Code, w.Body.String())
+		}
+		conn, err := server.connMgr.GetConnection(resp.ConnectionID)
+		if err != nil {
+			t.Fatalf("GetConnection() error = %v", err)
+		}
+		return conn
+	}
+
+	// Outside the VPN only the open policy applies
+	if got := connect("198.51.100.1:1234").Whitelist(); strings.Join(got, ",") != "^GET " {
+		t.Errorf("whitelist connecting from outside = %v, want only anywhere-read", got)
+	}
+
+	// A connection opened on the VPN can't be used from another network
+	conn := connect("10.8.1.2:1234")
+	if got := conn.Whitelist(); strings.Join(got, ",") != ".*,^GET " {
+		t.Errorf("whitelist connecting from the VPN = %v, want both policies", got)
+	}
+	req := httptest.NewRequest("POST", "/api/connect/"+conn.ID+"/extend", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.RemoteAddr = "198.51.100.1:1234"
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(ErrCodeNetworkDenied)) {
+		t.Errorf("extend from outside: status = %d, body: %s; want 403 %s", w.Code, w.Body.String(), ErrCodeNetworkDenied)
+	}
+	data, _ := os.ReadFile(auditLog)
+	if !strings.Contains(string(data), `"ip_denied"`) || !strings.Contains(string(data), `"connected_ip":"10.8.1.2"`) {
+		t.Errorf("audit log missing ip_denied for the later request: %s", data)
+	}
+}
+
+func TestHandleConnect_OutsideSchedule(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	// A whole-day window on a day that isn't today (UTC) is never active during the test
+	otherDay := strings.ToLower(time.Now().UTC().AddDate(0, 0, 1).Weekday().String()[:3])
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: 24 * time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "prod-hours", Roles: []string{"developer"}, Tags: []string{"env:prod"}, Schedule: &config.Schedule{Days: []string{otherDay}}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditLog},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "dev", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/connect/prod-db", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d, body: %s", w.Code, http.StatusForbidden, w.Body.String())
+	}
+	data, _ := os.ReadFile(auditLog)
+	if !strings.Contains(string(data), `"outside_schedule"`) || !strings.Contains(string(data), "prod-hours") {
+		t.Errorf("audit log missing outside_schedule: %s", data)
+	}
+}
+
+func TestHandleConnect_ConcurrentConnectionLimit(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour, MaxConcurrentConnections: 3},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: 24 * time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:prod"}},
+			{Name: "dev-db", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:dev"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "prod", Roles: []string{"developer"}, Tags: []string{"env:prod"}, MaxConcurrentConnections: 1},
+			{Name: "dev", Roles: []string{"developer"}, Tags: []string{"env:dev"}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditLog},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "dev", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	connect := func(name string) int {
+		req := httptest.NewRequest("POST", "/api/connect/"+name, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The prod policy allows one connection; the server-wide limit caps the rest at three
+	steps := []struct {
+		connection string
+		want       int
+	}{
+		{"prod-db", http.StatusOK},
+		{"prod-db", http.StatusTooManyRequests},
+		{"dev-db", http.StatusOK},
+		{"dev-db", http.StatusOK},
+		{"dev-db", http.StatusTooManyRequests},
+	}
+	for i, step := range steps {
+		if code := connect(step.connection); code != step.want {
+			t.Fatalf("step %d: connect %s = %d, want %d", i, step.connection, code, step.want)
+		}
+	}
+
+	data, _ := os.ReadFile(auditLog)
+	if strings.Count(string(data), `"connection_limit_reached"`) != 2 {
+		t.Errorf("audit log should record two connection_limit_reached events: %s", data)
+	}
+}
+
+func TestHandleConnect_RequireReason(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: time.Hour,
+			Users:       []config.User{{Username: "oncall", Password: "pw", Roles: []string{"oncall"}}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-api", Type: "http", Host: "localhost", Port: 8081, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "prod", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}, RequireReason: true},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditPath},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "oncall", Roles: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	connect := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/connect/prod-api", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := connect("")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("connect without reason: status = %d, want 400, body: %s", w.Code, w.Body.String())
+	}
+	var denied struct {
+		Error          apiError `json:"error"`
+		ReasonRequired bool     `json:"reason_required"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&denied)
+	if denied.Error.Code != ErrCodeReasonRequired || !denied.ReasonRequired {
+		t.Errorf("response should flag reason_required: %+v", denied)
+	}
+
+	if w := connect(`{"reason": "` + strings.Repeat("x", maxConnectReasonLength+1) + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("connect with oversized reason: status = %d, want 400", w.Code)
+	}
+
+	w = connect(`{"reason": "  INC-1234 investigating failed payments  "}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("connect with reason: status = %d, want 200, body: %s", w.Code, w.Body.String())
+	}
+	var resp ConnectResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	conn, err := server.connMgr.GetConnection(resp.ConnectionID)
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if conn.Reason() != "INC-1234 investigating failed payments" {
+		t.Errorf("connection reason = %q", conn.Reason())
+	}
+
+	entries, _ := audit.Query(auditPath, audit.Filter{Action: "connect"})
+	if len(entries) != 1 {
+		t.Fatalf("connect audit entries = %v, want 1", entries)
+	}
+	if entries[0].Metadata["reason"] != "INC-1234 investigating failed payments" {
+		t.Errorf("connect audit reason = %v", entries[0].Metadata["reason"])
+	}
+}
+
+// decidingProvider answers every approval request it receives with decision
+type decidingProvider struct {
+	mgr      *approval.Manager
+	decision approval.Decision
+}
+
+func (p *decidingProvider) SendApprovalRequest(ctx context.Context, req *approval.Request) error {
+	go func() { _, _ = p.mgr.SubmitApproval(req.ID, p.decision, "bob", "") }()
+	return nil
+}
+
+func (p *decidingProvider) GetProviderName() string { return "test" }
+
+func TestHandleConnect_RequireApproval(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: time.Hour,
+			Users:       []config.User{{Username: "oncall", Password: "pw", Roles: []string{"oncall"}}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-api", Type: "http", Host: "localhost", Port: 8081, Tags: []string{"env:prod"}, RequireApproval: true, ApprovalTimeout: time.Minute},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "prod", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}},
+		},
+		Approval: &config.ApprovalConfig{Enabled: true},
+		Logging:  config.LoggingConfig{AuditLogPath: auditPath},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "oncall", Roles: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	connect := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/connect/prod-api", strings.NewReader(`{"reason": "INC-1234"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// No provider can deliver the request
+	if w := connect(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("connect without providers: status = %d, want 503, body: %s", w.Code, w.Body.String())
+	}
+
+	provider := &decidingProvider{mgr: server.approvalMgr, decision: approval.DecisionRejected}
+	server.approvalMgr.RegisterProvider(provider)
+	if w := connect(); w.Code != http.StatusForbidden {
+		t.Errorf("rejected connect: status = %d, want 403, body: %s", w.Code, w.Body.String())
+	}
+	if server.connMgr.CountByUsername("oncall") != 0 {
+		t.Errorf("rejected connect created a connection")
+	}
+
+	provider.decision = approval.DecisionApproved
+	if w := connect(); w.Code != http.StatusOK {
+		t.Fatalf("approved connect: status = %d, want 200, body: %s", w.Code, w.Body.String())
+	}
+
+	for action, want := range map[string]int{
+		"connect_approval_requested": 3,
+		"connect_approval_error":     1,
+		"connect_approval_rejected":  1,
+		"connect_approval_granted":   1,
+		"connect":                    1,
+	} {
+		if entries, _ := audit.Query(auditPath, audit.Filter{Action: action}); len(entries) != want {
+			t.Errorf("%s audit entries = %d, want %d", action, len(entries), want)
+		}
+	}
+	granted, _ := audit.Query(auditPath, audit.Filter{Action: "connect_approval_granted"})
+	if len(granted) == 1 && granted[0].Metadata["approved_by"] != "bob" {
+		t.Errorf("approved_by = %v, want bob", granted[0].Metadata["approved_by"])
+	}
+}
+
+func TestHandleExtendConnection(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-api", Type: "http", Host: "localhost", Port: 8081, Duration: 15 * time.Minute, Tags: []string{"env:prod"}},
+			{Name: "gated-api", Type: "http", Host: "localhost", Port: 8082, Duration: 15 * time.Minute, Tags: []string{"env:gated"}, RequireApproval: true, ApprovalTimeout: time.Minute},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "prod", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}, MaxDuration: 40 * time.Minute},
+			{Name: "gated", Roles: []string{"oncall"}, Tags: []string{"env:gated"}, Whitelist: []string{".*"}},
+		},
+		Approval: &config.ApprovalConfig{Enabled: true},
+		Logging:  config.LoggingConfig{AuditLogPath: auditPath},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "oncall", Roles: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	otherToken, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "intruder", Roles: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	post := func(token, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	connect := func(name string) ConnectResponse {
+		w := post(token, "/api/connect/"+name, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("connect %s: status = %d, body: %s", name, w.Code, w.Body.String())
+		}
+		var resp ConnectResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	extend := func(token, connectionID, body string) (*httptest.ResponseRecorder, ExtendResponse) {
+		w := post(token, "/api/connect/"+connectionID+"/extend", body)
+		var resp ExtendResponse
+		if w.Code == http.StatusOK {
+			_ = json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&resp)
+		}
+		return w, resp
+	}
+
+	connected := connect("prod-api")
+	conn, err := server.connMgr.GetConnection(connected.ConnectionID)
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	maxExpiresAt := conn.CreatedAt.Add(40 * time.Minute)
+
+	if w, _ := extend(otherToken, connected.ConnectionID, ""); w.Code != http.StatusForbidden {
+		t.Errorf("extend by another user: status = %d, want 403", w.Code)
+	}
+	if w, _ := extend(token, "unknown-id", ""); w.Code != http.StatusNotFound {
+		t.Errorf("extend unknown connection: status = %d, want 404", w.Code)
+	}
+	if w, _ := extend(token, connected.ConnectionID, `{"duration": "soon"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("extend with invalid duration: status = %d, want 400", w.Code)
+	}
+
+	// Without a duration the connection gets another connection duration
+	w, resp := extend(token, connected.ConnectionID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("extend: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if want := connected.ExpiresAt.Add(15 * time.Minute); !resp.ExpiresAt.Equal(want) || !resp.PreviousExpiresAt.Equal(connected.ExpiresAt) {
+		t.Errorf("extend = %+v, want expiry %v", resp, want)
+	}
+	if !conn.ExpiresAt().Equal(resp.ExpiresAt) {
+		t.Errorf("connection expiry = %v, want %v", conn.ExpiresAt(), resp.ExpiresAt)
+	}
+	if !resp.MaxExpiresAt.Equal(maxExpiresAt) {
+		t.Errorf("max_expires_at = %v, want %v (policy max_duration)", resp.MaxExpiresAt, maxExpiresAt)
+	}
+
+	// Extensions stop at the policy's max_duration
+	w, resp = extend(token, connected.ConnectionID, `{"duration": "1h"}`)
+	if w.Code != http.StatusOK || !resp.ExpiresAt.Equal(maxExpiresAt) {
+		t.Fatalf("extend past max: status = %d, expiry = %v, want %v", w.Code, resp.ExpiresAt, maxExpiresAt)
+	}
+	w, _ = extend(token, connected.ConnectionID, "")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(ErrCodeExtensionLimit)) {
+		t.Errorf("extend at max: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// Connections requiring approval need a fresh one to be extended
+	provider := &decidingProvider{mgr: server.approvalMgr, decision: approval.DecisionApproved}
+	server.approvalMgr.RegisterProvider(provider)
+	gated := connect("gated-api")
+	provider.decision = approval.DecisionRejected
+	if w, _ := extend(token, gated.ConnectionID, `{"reason": "long migration"}`); w.Code != http.StatusForbidden {
+		t.Errorf("rejected extension: status = %d, want 403, body: %s", w.Code, w.Body.String())
+	}
+	if gatedConn, _ := server.connMgr.GetConnection(gated.ConnectionID); !gatedConn.ExpiresAt().Equal(gated.ExpiresAt) {
+		t.Errorf("rejected extension moved the expiry to %v", gatedConn.ExpiresAt())
+	}
+	provider.decision = approval.DecisionApproved
+	if w, resp := extend(token, gated.ConnectionID, `{"duration": "10m"}`); w.Code != http.StatusOK || !resp.ExpiresAt.Equal(gated.ExpiresAt.Add(10*time.Minute)) {
+		t.Errorf("approved extension: status = %d, expiry = %v, body: %s", w.Code, resp.ExpiresAt, w.Body.String())
+	}
+	requested, _ := audit.Query(auditPath, audit.Filter{Action: "connect_approval_requested"})
+	if len(requested) != 3 || requested[2].Metadata["extend_to"] != gated.ExpiresAt.Add(10*time.Minute).Format(time.RFC3339) {
+		t.Errorf("extension approval requests = %v", requested)
+	}
+
+	extended, _ := audit.Query(auditPath, audit.Filter{Action: "connection_extended"})
+	if len(extended) != 3 {
+		t.Fatalf("connection_extended audit entries = %d, want 3", len(extended))
+	}
+	if extended[0].Metadata["old_expires_at"] != connected.ExpiresAt.Format(time.RFC3339) ||
+		extended[0].Metadata["new_expires_at"] != connected.ExpiresAt.Add(15*time.Minute).Format(time.RFC3339) {
+		t.Errorf("connection_extended metadata = %v", extended[0].Metadata)
+	}
+	if denied, _ := audit.Query(auditPath, audit.Filter{Action: "connection_extend_denied"}); len(denied) != 2 {
+		t.Errorf("connection_extend_denied audit entries = %d, want 2", len(denied))
+	}
+}
+
+func TestHandleExtendConnection_SourceScopedPolicies(t *testing.T) {
+	defer audit.Close()
+	decisionPath := filepath.Join(t.TempDir(), "decisions.log")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-api", Type: "http", Host: "localhost", Port: 8081, Duration: 15 * time.Minute, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			// Listed first, but the client (192.0.2.1) is outside its network
+			{Name: "office", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}, SourceCIDRs: []string{"10.0.0.0/8"}},
+			{Name: "anywhere", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, Whitelist: []string{".*"}},
+		},
+		Logging: config.LoggingConfig{
+			AuditLogPath:    filepath.Join(t.TempDir(), "audit.log"),
+			DecisionLogPath: decisionPath,
+		},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	t.Cleanup(func() { audit.ConfigureDecisionLog("", 0) })
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "oncall", Roles: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/connect/prod-api")
+	if w.Code != http.StatusOK {
+		t.Fatalf("connect: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var connected ConnectResponse
+	_ = json.NewDecoder(w.Body).Decode(&connected)
+
+	if w := post("/api/connect/" + connected.ConnectionID + "/extend"); w.Code != http.StatusOK {
+		t.Fatalf("extend: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// The extension is granted by the policy that applies to the client's network
+	data, err := os.ReadFile(decisionPath)
+	if err != nil {
+		t.Fatalf("failed to read decision log: %v", err)
+	}
+	var extend *audit.Decision
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var decision audit.Decision
+		if err := json.Unmarshal([]byte(line), &decision); err == nil && decision.Action == "extend" {
+			extend = &decision
+		}
+	}
+	if extend == nil || extend.Decision != audit.DecisionAllow || extend.Policy != "anywhere" {
+		t.Errorf("extend decision = %+v, want allowed by policy anywhere", extend)
+	}
+}
+
+func TestHandleConnect_AllowedDatabases(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "pg", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:dev"},
+				BackendDatabase: "app", AllowedDatabases: []string{"analytics"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "dev", Roles: []string{"dev"}, Tags: []string{"env:dev"}, Whitelist: []string{".*"}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditPath},
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "alice", Roles: []string{"dev"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	connect := func(body string) (*httptest.ResponseRecorder, ConnectResponse) {
+		req := httptest.NewRequest("POST", "/api/connect/pg", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		var resp ConnectResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	if w, resp := connect(""); w.Code != http.StatusOK || resp.Database != "app" {
+		t.Errorf("default database: status = %d, database = %q, want app", w.Code, resp.Database)
+	}
+
+	w, resp := connect(`{"database": "analytics"}`)
+	if w.Code != http.StatusOK || resp.Database != "analytics" {
+		t.Fatalf("allowed database: status = %d, database = %q, body: %s", w.Code, resp.Database, w.Body.String())
+	}
+	if conn, err := server.connMgr.GetConnection(resp.ConnectionID); err != nil || conn.Database() != "analytics" {
+		t.Errorf("connection database = %q, %v, want analytics", conn.Database(), err)
+	}
+
+	w, _ = connect(`{"database": "billing"}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(ErrCodeDatabaseDenied)) {
+		t.Errorf("unlisted database: status = %d, body: %s, want 403 database_denied", w.Code, w.Body.String())
+	}
+	entries, _ := audit.Query(auditPath, audit.Filter{Action: "database_denied", Resource: "pg"})
+	if len(entries) != 1 || entries[0].Metadata["database"] != "billing" {
+		t.Errorf("database_denied entries = %+v, want one for billing", entries)
+	}
+}
+
+func TestHandleGetConnectionPolicy(t *testing.T) {
+	defer audit.Close()
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "pg", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:dev"}},
+			{Name: "prod", Type: "postgres", Host: "localhost", Port: 5432, Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "dev", Roles: []string{"dev"}, Tags: []string{"env:dev"}, Whitelist: []string{"^SELECT.*"}, Blacklist: []string{"(?i)pg_sleep"}},
+			{Name: "ops", Roles: []string{"ops"}, Tags: []string{"env:dev", "env:prod"}, TagMatch: "any", Whitelist: []string{"^DELETE.*"}},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: filepath.Join(t.TempDir(), "audit.log")},
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "alice", Roles: []string{"dev"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	get := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/connections/"+name+"/policy", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("pg")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var policy ConnectionPolicyResponse
+	_ = json.NewDecoder(w.Body).Decode(&policy)
+	// Only the caller's rules: the ops role's DELETE pattern must not show up
+	if strings.Join(policy.Whitelist, ",") != "^SELECT.*" || strings.Join(policy.Blacklist, ",") != "(?i)pg_sleep" {
+		t.Errorf("policy = %+v, want only the dev role's patterns", policy)
+	}
+	if policy.MaxDuration != "1h0m0s" {
+		t.Errorf("max duration = %q", policy.MaxDuration)
+	}
+
+	if w := get("prod"); w.Code != http.StatusForbidden {
+		t.Errorf("inaccessible connection: status = %d, want 403", w.Code)
+	}
+	if w := get("missing"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown connection: status = %d, want 404", w.Code)
+	}
+}
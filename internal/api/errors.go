@@ -0,0 +1,51 @@
+package api
+
+// ErrorCode is a stable, machine-readable identifier for an error response.
+// Clients branch on codes; messages are for people and may change.
+type ErrorCode string
+
+// Error codes returned by the API
+const (
+	// Requests
+	ErrCodeInvalidRequest ErrorCode = "invalid_request" // Malformed body, parameter or value
+	ErrCodeNotFound       ErrorCode = "not_found"
+	ErrCodeAlreadyExists  ErrorCode = "already_exists"
+	ErrCodeInternal       ErrorCode = "internal_error"
+
+	// Authentication
+	ErrCodeUnauthorized         ErrorCode = "unauthorized" // Missing, invalid or expired token
+	ErrCodeInvalidCredentials   ErrorCode = "invalid_credentials"
+	ErrCodeTooManyLoginAttempts ErrorCode = "too_many_login_attempts"
+	ErrCodeNoRoles              ErrorCode = "no_roles"
+	ErrCodeTokenNotRenewable    ErrorCode = "token_not_renewable"
+	ErrCodeForbidden            ErrorCode = "forbidden" // Authenticated, but not allowed (e.g., admin role required)
+
+	// Connecting
+	ErrCodeConnectionNotFound     ErrorCode = "connection_not_found" // Unknown, expired or closed connection
+	ErrCodeAccessDenied           ErrorCode = "access_denied"        // No policy grants the connection
+	ErrCodeOutsideSchedule        ErrorCode = "outside_schedule"
+	ErrCodeNetworkDenied          ErrorCode = "network_denied"  // Client IP outside the policy's source_cidrs
+	ErrCodeLocationDenied         ErrorCode = "location_denied" // Blocked by the connection's geofence
+	ErrCodeReasonRequired         ErrorCode = "reason_required"
+	ErrCodeDatabaseDenied         ErrorCode = "database_denied" // Database not in the connection's allowed_databases
+	ErrCodeApprovalDenied         ErrorCode = "approval_denied" // Connection approval rejected or timed out
+	ErrCodeApprovalUnavailable    ErrorCode = "approval_unavailable"
+	ErrCodeBannerAckRequired      ErrorCode = "banner_ack_required"
+	ErrCodeExplainPreviewDisabled ErrorCode = "explain_preview_disabled"
+	ErrCodeConnectionLimit        ErrorCode = "connection_limit_reached"
+	ErrCodeExtensionLimit         ErrorCode = "extension_limit_reached" // Extension past the connection's max duration
+	ErrCodeBackendUnreachable     ErrorCode = "backend_unreachable"
+	ErrCodeBackendAuthFailed      ErrorCode = "backend_auth_failed"
+	ErrCodeBackendTLS             ErrorCode = "backend_tls_error"
+	ErrCodeBackendError           ErrorCode = "backend_error"
+
+	// Administration
+	ErrCodeConfigInvalid  ErrorCode = "config_invalid"  // Validation problems are listed in "problems"
+	ErrCodeConfigConflict ErrorCode = "config_conflict" // Changed by someone else since it was loaded
+)
+
+// apiError is the body of every error response: {"error": {"code": ..., "message": ...}}
+type apiError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
@@ -2,13 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/geoip"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ServerInfo represents server configuration for CLI clients
@@ -27,17 +36,28 @@ type AuthProviderInfo struct {
 
 // ConnectionInfo represents connection information for the client
 type ConnectionInfo struct {
-	Name     string            `json:"name"`
-	Type     string            `json:"type"`
-	Tags     []string          `json:"tags,omitempty"`
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"` // From metadata["description"]
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// MaxDuration is how long a connection would last for this user (e.g. "15m0s")
+	MaxDuration string `json:"max_duration,omitempty"`
+	// RequireReason is set when the user must give a reason to connect
+	RequireReason bool `json:"require_reason,omitempty"`
 }
 
-// ConnectRequest represents a connection request
+// ConnectRequest represents a connection request (the body is optional)
 type ConnectRequest struct {
 	Duration time.Duration `json:"duration"`
+	Reason   string        `json:"reason,omitempty"` // Why the user is connecting; required by policies with require_reason
+	// Database picks the backend database of a postgres connection (one of its allowed_databases)
+	Database string `json:"database,omitempty"`
 }
 
+// maxConnectReasonLength caps the reason recorded with a connection
+const maxConnectReasonLength = 500
+
 // ConnectResponse represents a connection response
 type ConnectResponse struct {
 	ConnectionID string    `json:"connection_id"`
@@ -45,6 +65,12 @@ type ConnectResponse struct {
 	ProxyURL     string    `json:"proxy_url"`
 	Type         string    `json:"type,omitempty"`     // Connection type
 	Database     string    `json:"database,omitempty"` // For postgres connections
+	// KafkaBrokers are the cluster's broker node IDs; the CLI opens a local listener per broker
+	KafkaBrokers []int32 `json:"kafka_brokers,omitempty"`
+	// Banner is shown to the user on connect; with BannerRequireAck the CLI must
+	// acknowledge it on every tunnel before traffic flows
+	Banner           string `json:"banner,omitempty"`
+	BannerRequireAck bool   `json:"banner_require_ack,omitempty"`
 }
 
 // handleServerInfo returns server configuration information for CLI clients
@@ -88,6 +114,7 @@ func (s *Server) handleListConnections(w http.ResponseWriter, r *http.Request) {
 
 	// Get accessible connections based on roles
 	accessibleNames := s.authz.ListAccessibleConnections(roles)
+	authz := s.requestAuthz(r)
 	accessibleMap := make(map[string]bool)
 	for _, name := range accessibleNames {
 		accessibleMap[name] = true
@@ -109,17 +136,162 @@ func (s *Server) handleListConnections(w http.ResponseWriter, r *http.Request) {
 			displayMetadata["environment"] = env
 		}
 
-		connections = append(connections, ConnectionInfo{
-			Name:     conn.Name,
-			Type:     conn.Type,
-			Tags:     conn.Tags,
-			Metadata: displayMetadata,
-		})
+		info := ConnectionInfo{
+			Name:        conn.Name,
+			Type:        conn.Type,
+			Description: conn.Metadata["description"],
+			Tags:        conn.Tags,
+			Metadata:    displayMetadata,
+		}
+		if duration := s.connectionDuration(authz, roles, &conn); duration > 0 {
+			info.MaxDuration = duration.String()
+		}
+		info.RequireReason = authz.RequiresReason(roles, conn.Name)
+		connections = append(connections, info)
 	}
 
 	respondJSON(w, http.StatusOK, connections)
 }
 
+// ConnectionPolicyResponse is the caller's effective policy on a connection: what their
+// roles allow right now, merged across matching policies (never other roles' rules)
+type ConnectionPolicyResponse struct {
+	Connection string `json:"connection"`
+	Type       string `json:"type"`
+	// Whitelist patterns a request or query must match (empty: not restricted by pattern)
+	Whitelist []string `json:"whitelist"`
+	// Blacklist patterns that block a request or query even when whitelisted
+	Blacklist        []string                 `json:"blacklist,omitempty"`
+	TablePermissions []config.TablePermission `json:"table_permissions,omitempty"`
+	CopyDirections   []string                 `json:"copy_directions,omitempty"`
+	ReadOnly         bool                     `json:"read_only,omitempty"`
+	RequireReason    bool                     `json:"require_reason,omitempty"`
+	MaxDuration      string                   `json:"max_duration,omitempty"`
+}
+
+// handleGetConnectionPolicy returns what the caller may do on a connection, so users can
+// see why a query was blocked
+func (s *Server) handleGetConnectionPolicy(w http.ResponseWriter, r *http.Request) {
+	username := r.Context().Value(ContextKeyUsername).(string)
+	roles, _ := r.Context().Value(ContextKeyRoles).([]string)
+	connectionName := mux.Vars(r)["name"]
+
+	var connConfig *config.ConnectionConfig
+	for i := range s.config.Connections {
+		if s.config.Connections[i].Name == connectionName {
+			connConfig = &s.config.Connections[i]
+			break
+		}
+	}
+	if connConfig == nil {
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found")
+		return
+	}
+	if !s.authz.CanAccessConnection(roles, connectionName) {
+		respondError(w, http.StatusForbidden, ErrCodeAccessDenied, "Access denied: insufficient permissions for this connection")
+		return
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "view_connection_policy", connectionName, map[string]interface{}{
+		"roles": roles,
+	})
+
+	// The policy in effect from the caller's network (policies' source_cidrs)
+	authz := s.requestAuthz(r)
+	resp := ConnectionPolicyResponse{
+		Connection:       connectionName,
+		Type:             connConfig.Type,
+		Whitelist:        authz.GetWhitelistForConnection(roles, connectionName),
+		Blacklist:        authz.GetBlacklistForConnection(roles, connectionName),
+		TablePermissions: authz.GetTablePermissionsForConnection(roles, connectionName),
+		CopyDirections:   authz.GetCopyDirectionsForConnection(roles, connectionName),
+		ReadOnly:         authz.IsReadOnlyForConnection(roles, connectionName),
+		RequireReason:    authz.RequiresReason(roles, connectionName),
+	}
+	if resp.Whitelist == nil {
+		resp.Whitelist = []string{}
+	}
+	if duration := s.connectionDuration(authz, roles, connConfig); duration > 0 {
+		resp.MaxDuration = duration.String()
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// maxRequestBytes returns the largest query, command or HTTP request the proxy buffers
+// for a connection (0 = unlimited)
+func (s *Server) maxRequestBytes(connConfig *config.ConnectionConfig) int64 {
+	if connConfig.MaxRequestBytes > 0 {
+		return connConfig.MaxRequestBytes
+	}
+	return s.config.Server.MaxRequestBytes
+}
+
+// requestAuthz returns the authorizer as seen from the client of a request: only the
+// policies whose source_cidrs contain its IP grant anything
+func (s *Server) requestAuthz(r *http.Request) *authorization.Authorizer {
+	return s.authz.ForSource(clientIP(r, s.trustedProxies))
+}
+
+// connectionAuthz returns the authorizer as seen from the network a connection was opened from
+func (s *Server) connectionAuthz(conn *proxy.Connection) *authorization.Authorizer {
+	if ip := conn.ClientIP(); ip != nil {
+		return s.authz.ForSource(ip)
+	}
+	return s.authz
+}
+
+// checkConnectionSource re-checks source_cidrs for a later request on a connection (a
+// stream, an extension). The client must still be allowed, from a network the same
+// policies apply to as the one it connected from, since those scoped the connection's
+// grants. Otherwise it audits ip_denied, responds 403 and returns false. Connections
+// with no recorded client IP weren't scoped at connect and aren't checked.
+func (s *Server) checkConnectionSource(w http.ResponseWriter, r *http.Request, conn *proxy.Connection) bool {
+	connected := conn.ClientIP()
+	if connected == nil {
+		return true
+	}
+	roles, _ := r.Context().Value(ContextKeyRoles).([]string)
+	ip := clientIP(r, s.trustedProxies)
+	if s.authz.SourceAllowed(roles, conn.Config.Name, ip) && s.authz.SameSourcePolicies(roles, connected, ip) {
+		return true
+	}
+
+	observed := ""
+	if ip != nil {
+		observed = ip.String()
+	}
+	metadata := map[string]interface{}{
+		"connection_id": conn.ID,
+		"client_ip":     observed,
+		"connected_ip":  connected.String(),
+		"roles":         roles,
+	}
+	_ = audit.Log(s.config.Logging.AuditLogPath, conn.Username, "ip_denied", conn.Config.Name, tracing.Annotate(r.Context(), metadata))
+	respondError(w, http.StatusForbidden, ErrCodeNetworkDenied, "Access denied: connections from your network are not allowed")
+	return false
+}
+
+// connectionDuration returns how long a connection opened by a user with these roles lasts
+func (s *Server) connectionDuration(authz *authorization.Authorizer, roles []string, connConfig *config.ConnectionConfig) time.Duration {
+	// Use connection-specific duration, fallback to server default
+	duration := connConfig.Duration
+	if duration == 0 {
+		duration = s.config.Server.MaxConnectionDuration
+	}
+
+	// Enforce server max as upper limit
+	if duration > s.config.Server.MaxConnectionDuration {
+		duration = s.config.Server.MaxConnectionDuration
+	}
+
+	// Enforce the tightest per-role limit from the user's matching policies
+	if policyMax := authz.MaxDurationForConnection(roles, connConfig.Name); policyMax > 0 && duration > policyMax {
+		duration = policyMax
+	}
+	return duration
+}
+
 // handleConnect establishes a new proxy connection
 func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	username := r.Context().Value(ContextKeyUsername).(string)
@@ -127,6 +299,11 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	connectionName := vars["name"]
 
+	ctx, span := tracing.Start(r.Context(), "proxy.connect",
+		attribute.String("username", username),
+		attribute.String("connection", connectionName))
+	defer span.End()
+
 	// Find connection config
 	var connConfig *config.ConnectionConfig
 	for i := range s.config.Connections {
@@ -137,47 +314,238 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if connConfig == nil {
-		respondError(w, http.StatusNotFound, "Connection not found")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found")
+		return
+	}
+
+	// The body is optional; it carries the user's reason for connecting
+	var req ConnectRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+			return
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxConnectReasonLength {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Reason is too long (at most %d characters)", maxConnectReasonLength))
 		return
 	}
 
 	// Check authorization
-	if !s.authz.CanAccessConnection(roles, connectionName) {
-		_ = audit.Log(s.config.Logging.AuditLogPath, username, "connect_denied", connectionName, map[string]interface{}{
+	access := s.authz.CheckConnectionAccess(roles, connectionName)
+	decision := audit.Decision{
+		Subject:  username,
+		Roles:    roles,
+		Action:   "connect",
+		Resource: connectionName,
+		Decision: audit.DecisionAllow,
+		Policy:   access.Policy,
+		Reason:   access.Reason,
+	}
+	if !access.Allowed && access.OutsideSchedule {
+		decision.Decision = audit.DecisionDeny
+		span.SetAttributes(attribute.String("decision", "outside_schedule"))
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "outside_schedule", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"roles":  roles,
+			"policy": access.Policy,
+			"reason": access.Reason,
+		}))
+		respondError(w, http.StatusForbidden, ErrCodeOutsideSchedule, "Access denied: this connection is outside its scheduled access hours")
+		return
+	}
+	if !access.Allowed {
+		decision.Decision = audit.DecisionDeny
+		span.SetAttributes(attribute.String("decision", "denied"))
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "connect_denied", connectionName, tracing.Annotate(ctx, map[string]interface{}{
 			"roles":  roles,
 			"reason": "insufficient permissions",
+		}))
+		respondError(w, http.StatusForbidden, ErrCodeAccessDenied, "Access denied: insufficient permissions for this connection")
+		return
+	}
+
+	// Enforce per-policy source networks (X-Forwarded-For is only honored from trusted proxies)
+	ip := clientIP(r, s.trustedProxies)
+	if !s.authz.SourceAllowed(roles, connectionName, ip) {
+		observed := ""
+		if ip != nil {
+			observed = ip.String()
+		}
+		decision.Decision = audit.DecisionDeny
+		decision.Policy = "source_cidrs"
+		span.SetAttributes(attribute.String("decision", "ip_denied"))
+		decision.Reason = fmt.Sprintf("client IP %s not in any allowed source network", observed)
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "ip_denied", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"client_ip": observed,
+			"roles":     roles,
+		}))
+		respondError(w, http.StatusForbidden, ErrCodeNetworkDenied, "Access denied: connections from your network are not allowed")
+		return
+	}
+
+	// From here on only the policies whose source_cidrs contain the client IP apply
+	authz := s.authz.ForSource(ip)
+
+	// Enforce geofencing based on client location
+	if connConfig.Geofence != nil {
+		allowed, country, reason := s.checkGeofence(connConfig.Geofence, ip)
+		event := "geofence_allowed"
+		if !allowed {
+			event = "geofence_denied"
+		}
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, event, connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"client_ip": ip.String(),
+			"country":   country,
+			"reason":    reason,
+		}))
+		if !allowed {
+			decision.Decision = audit.DecisionDeny
+			decision.Policy = "geofence"
+			span.SetAttributes(attribute.String("decision", "geofence_denied"))
+			decision.Reason = reason
+			_ = audit.LogDecision(decision)
+			respondError(w, http.StatusForbidden, ErrCodeLocationDenied, "Access denied: connections from your location are not allowed")
+			return
+		}
+	}
+
+	// Policies with require_reason only grant access to users who say why they connect
+	if reason == "" && authz.RequiresReason(roles, connectionName) {
+		decision.Decision = audit.DecisionDeny
+		decision.Policy = "require_reason"
+		decision.Reason = "no reason given"
+		span.SetAttributes(attribute.String("decision", "reason_required"))
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "connect_denied", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"roles":  roles,
+			"reason": "reason_required",
+		}))
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":           apiError{Code: ErrCodeReasonRequired, Message: "A reason is required to connect to this connection"},
+			"reason_required": true,
 		})
-		respondError(w, http.StatusForbidden, "Access denied: insufficient permissions for this connection")
 		return
 	}
 
-	// Use connection-specific duration, fallback to server default
-	duration := connConfig.Duration
-	if duration == 0 {
-		duration = s.config.Server.MaxConnectionDuration
+	// Postgres connections let users pick one of their allowed_databases
+	if req.Database != "" && (connConfig.Type != "postgres" || !proxy.DatabaseAllowed(connConfig, req.Database)) {
+		decision.Decision = audit.DecisionDeny
+		decision.Policy = "allowed_databases"
+		decision.Reason = fmt.Sprintf("database %q not allowed", req.Database)
+		span.SetAttributes(attribute.String("decision", "database_denied"))
+		_ = audit.LogDecision(decision)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "database_denied", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+			"database": req.Database,
+			"allowed":  connConfig.AllowedDatabases,
+			"roles":    roles,
+		}))
+		respondError(w, http.StatusForbidden, ErrCodeDatabaseDenied, fmt.Sprintf("Access denied: database %q is not allowed on this connection", req.Database))
+		return
 	}
 
-	// Enforce server max as upper limit
-	if duration > s.config.Server.MaxConnectionDuration {
-		duration = s.config.Server.MaxConnectionDuration
+	// Connections with require_approval are only established once an approver agrees
+	if connConfig.RequireApproval {
+		if status, code, message := s.approveConnect(ctx, w, username, reason, connConfig, time.Time{}); status != 0 {
+			decision.Decision = audit.DecisionDeny
+			decision.Policy = "require_approval"
+			decision.Reason = message
+			span.SetAttributes(attribute.String("decision", "approval_denied"))
+			_ = audit.LogDecision(decision)
+			respondError(w, status, code, message)
+			return
+		}
 	}
+	_ = audit.LogDecision(decision)
+
+	duration := s.connectionDuration(authz, roles, connConfig)
 
 	// Get whitelist for this user's roles and connection
-	whitelist := s.authz.GetWhitelistForConnection(roles, connectionName)
+	whitelist := authz.GetWhitelistForConnection(roles, connectionName)
+
+	// Cap the user's concurrent connections: the tightest of the server-wide and policy limits
+	maxConcurrent := authz.MaxConcurrentConnectionsForConnection(roles, connectionName)
+	if global := s.config.Server.MaxConcurrentConnections; global > 0 && (maxConcurrent == 0 || global < maxConcurrent) {
+		maxConcurrent = global
+	}
 
 	// Create connection (with whitelist for HTTP/HTTPS and approval manager)
-	connectionID, expiresAt, err := s.connMgr.CreateConnection(username, connConfig, duration, whitelist, s.config.Logging.AuditLogPath, s.approvalMgr)
+	connectionID, expiresAt, err := s.connMgr.CreateConnectionWithLimit(username, maxConcurrent, connConfig, duration, whitelist, s.config.Logging.AuditLogPath, s.approvalMgr)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create connection")
+		tracing.Fail(span, err)
+		switch {
+		case errors.Is(err, proxy.ErrConnectionLimit):
+			_ = audit.Log(s.config.Logging.AuditLogPath, username, "connection_limit_reached", connectionName, tracing.Annotate(ctx, map[string]interface{}{
+				"limit":  maxConcurrent,
+				"active": s.connMgr.CountByUsername(username),
+				"roles":  roles,
+			}))
+			respondError(w, http.StatusTooManyRequests, ErrCodeConnectionLimit, fmt.Sprintf("Connection limit reached: at most %d concurrent connections allowed", maxConcurrent))
+		case errors.Is(err, proxy.ErrBackendUnreachable):
+			respondError(w, http.StatusBadGateway, ErrCodeBackendUnreachable, "Backend unreachable")
+		case errors.Is(err, proxy.ErrBackendAuthFailed):
+			respondError(w, http.StatusBadGateway, ErrCodeBackendAuthFailed, "Backend auth failed")
+		case errors.Is(err, proxy.ErrBackendTLS):
+			respondError(w, http.StatusBadGateway, ErrCodeBackendTLS, "Backend TLS error")
+		default:
+			respondError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create connection")
+		}
 		return
 	}
 
-	// Log audit event
-	_ = audit.Log(s.config.Logging.AuditLogPath, username, "connect", connectionName, map[string]interface{}{
+	span.SetAttributes(attribute.String("decision", "allowed"), attribute.String("connection_id", connectionID))
+
+	// Track the user's policy on the connection so config reloads can re-evaluate it,
+	// and resolve time-scoped whitelist patterns per request for HTTP connections
+	connectMetadata := map[string]interface{}{
 		"connection_id": connectionID,
 		"duration":      duration.String(),
 		"roles":         roles,
-	})
+	}
+	if reason != "" {
+		connectMetadata["reason"] = reason
+	}
+	if req.Database != "" {
+		connectMetadata["database"] = req.Database
+	}
+	if conn, err := s.connMgr.GetConnection(connectionID); err == nil {
+		conn.SetClientIP(ip)
+		conn.SetPolicy(roles, authz.NewWhitelistResolver(roles, connectionName))
+		conn.SetReason(reason)
+		conn.SetDatabase(req.Database)
+		if httpProxy, ok := conn.Proxy.(*proxy.HTTPProxy); ok {
+			httpProxy.SetWhitelistSource(conn)
+			httpProxy.SetDefaultRequestTimeout(s.config.Server.RequestTimeout)
+			httpProxy.SetMaxRequestBytes(s.maxRequestBytes(connConfig))
+			httpProxy.SetConnectReason(reason)
+		}
+		if grpcProxy, ok := conn.Proxy.(*proxy.GRPCProxy); ok {
+			grpcProxy.SetWhitelistSource(conn)
+			grpcProxy.SetConnectReason(reason)
+		}
+		if mongoProxy, ok := conn.Proxy.(*proxy.MongoProxy); ok {
+			mongoProxy.SetWhitelistSource(conn)
+		}
+		if sshProxy, ok := conn.Proxy.(*proxy.SSHProxy); ok {
+			sshProxy.SetWhitelistSource(conn)
+		}
+		if kafkaProxy, ok := conn.Proxy.(*proxy.KafkaProxy); ok {
+			kafkaProxy.SetWhitelistSource(conn)
+		}
+		if tcpProxy, ok := conn.Proxy.(*proxy.TCPProxy); ok {
+			tcpProxy.SetMaxRequestBytes(s.maxRequestBytes(connConfig))
+		}
+		// Known when the backend was checked with validate_on_connect
+		if addr := conn.BackendAddr(); addr != "" {
+			connectMetadata["backend_addr"] = addr
+		}
+	}
+
+	// Log audit event
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "connect", connectionName, tracing.Annotate(ctx, connectMetadata))
 
 	response := ConnectResponse{
 		ConnectionID: connectionID,
@@ -188,15 +556,54 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 
 	// Add database info for Postgres connections
 	if connConfig.Type == "postgres" {
-		response.Database = connConfig.BackendDatabase
+		response.Database = req.Database
+		if response.Database == "" {
+			response.Database = connConfig.BackendDatabase
+		}
 		if response.Database == "" {
 			response.Database = connConfig.Metadata["database"]
 		}
 	}
 
+	if connConfig.Type == "kafka" {
+		brokers, err := proxy.KafkaBrokers(connConfig)
+		if err != nil {
+			// Clients still work through the bootstrap listener; metadata points every broker at it
+			s.logger.Warn("kafka broker discovery failed", "connection", connectionName, "error", err)
+		}
+		response.KafkaBrokers = brokers
+	}
+
+	if connConfig.Banner != nil {
+		response.Banner = connConfig.Banner.Message
+		response.BannerRequireAck = connConfig.Banner.RequireAck
+	}
+
 	respondJSON(w, http.StatusOK, response)
 }
 
+// checkGeofence checks a client IP against a connection's geofence.
+// Fails closed when no GeoIP database is loaded or the lookup fails.
+func (s *Server) checkGeofence(fence *config.GeofenceConfig, ip net.IP) (bool, string, string) {
+	if s.geoIP == nil {
+		return false, "", "geoip database not configured"
+	}
+
+	country, err := s.geoIP.Country(ip)
+	if err != nil {
+		return false, "", err.Error()
+	}
+
+	if !geoip.Allowed(country, fence.AllowedCountries, fence.BlockedCountries, fence.AllowUnknown) {
+		if country == "" {
+			return false, country, "unknown country"
+		}
+		return false, country, "country not allowed"
+	}
+
+	return true, country, "country allowed"
+}
+
 // handleProxy handles proxying requests to the actual endpoint
 //
 //nolint:unused // Reserved for legacy HTTP proxy support
@@ -208,26 +615,39 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 	// Get connection
 	conn, err := s.connMgr.GetConnection(connectionID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Connection not found or expired")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
 		return
 	}
 
 	// Verify ownership
 	if conn.Username != username {
-		respondError(w, http.StatusForbidden, "Access denied")
+		respondError(w, http.StatusForbidden, ErrCodeForbidden, "Access denied")
+		return
+	}
+	if !s.checkConnectionSource(w, r, conn) {
 		return
 	}
 
+	ctx, span := tracing.Start(r.Context(), "proxy.request",
+		attribute.String("username", username),
+		attribute.String("connection", conn.Config.Name),
+		attribute.String("connection_id", connectionID),
+		attribute.String("http.method", r.Method))
+	defer span.End()
+	r = r.WithContext(proxy.WithClientScheme(ctx, clientScheme(r, s.trustedProxies)))
+
 	// Log audit event
-	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_request", conn.Config.Name, map[string]interface{}{
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_request", conn.Config.Name, tracing.Annotate(ctx, map[string]interface{}{
 		"connection_id": connectionID,
 		"method":        r.Method,
 		"path":          r.URL.Path,
-	})
+	}))
 
 	// Proxy the request based on protocol type
+	conn.Touch()
 	if err := conn.Proxy.HandleRequest(w, r); err != nil {
-		respondError(w, http.StatusBadGateway, fmt.Sprintf("Proxy error: %v", err))
+		tracing.Fail(span, err)
+		respondError(w, http.StatusBadGateway, ErrCodeBackendError, fmt.Sprintf("Proxy error: %v", err))
 		return
 	}
 }
@@ -239,7 +659,7 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	_ = json.NewEncoder(w).Encode(data)
 }
 
-// respondError sends an error response
-func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+// respondError sends an error response with a machine-readable code
+func respondError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	respondJSON(w, status, map[string]interface{}{"error": apiError{Code: code, Message: message}})
 }
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+)
+
+const (
+	// readinessDialTimeout bounds each backend reachability check
+	readinessDialTimeout = 2 * time.Second
+	// readinessCacheTTL is how long readiness results are reused, so frequent probes don't hammer backends
+	readinessCacheTTL = 10 * time.Second
+)
+
+// backendStatus is the reachability of one configured connection
+type backendStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Reachable bool   `json:"reachable"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readinessReport is the result of checking every configured connection
+type readinessReport struct {
+	Ready       bool            `json:"ready"`
+	CheckedAt   time.Time       `json:"checked_at"`
+	Connections []backendStatus `json:"connections"`
+}
+
+// readinessChecker dials each configured backend and caches the report briefly
+type readinessChecker struct {
+	mu      sync.Mutex
+	cfg     *config.Config // Config the cached report was computed for
+	report  *readinessReport
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+func newReadinessChecker() *readinessChecker {
+	return &readinessChecker{
+		ttl:     readinessCacheTTL,
+		timeout: readinessDialTimeout,
+	}
+}
+
+// Check returns the cached report for cfg, or dials every connection if it expired
+// Concurrent callers wait for a single check instead of dialing the backends again.
+func (c *readinessChecker) Check(cfg *config.Config) readinessReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && c.cfg == cfg && time.Since(c.report.CheckedAt) < c.ttl {
+		return *c.report
+	}
+
+	report := readinessReport{
+		Ready:       true,
+		CheckedAt:   time.Now(),
+		Connections: make([]backendStatus, len(cfg.Connections)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range cfg.Connections {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Connections[i] = c.dial(&cfg.Connections[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, status := range report.Connections {
+		if !status.Reachable {
+			report.Ready = false
+		}
+	}
+
+	c.cfg = cfg
+	c.report = &report
+	return report
+}
+
+// dial checks that a connection's backend accepts TCP connections; a connection
+// with failover hosts is reachable if any of them is
+func (c *readinessChecker) dial(conn *config.ConnectionConfig) backendStatus {
+	status := backendStatus{Name: conn.Name, Type: conn.Type}
+
+	start := time.Now()
+	var err error
+	for _, addr := range proxy.BackendAddrs(conn) {
+		var backend net.Conn
+		if backend, err = net.DialTimeout("tcp", addr, c.timeout); err == nil {
+			_ = backend.Close()
+			break
+		}
+	}
+	status.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Reachable = true
+	return status
+}
+
+// handleReady reports whether every configured backend is reachable (503 if not)
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	report := s.readiness.Check(s.GetConfig())
+
+	status, code := "ready", http.StatusOK
+	if !report.Ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	respondJSON(w, code, map[string]interface{}{
+		"status":      status,
+		"ready":       report.Ready,
+		"checked_at":  report.CheckedAt,
+		"connections": report.Connections,
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// listenPort starts a TCP listener and returns its port
+func listenPort(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestHandleReady(t *testing.T) {
+	up, upPort := listenPort(t)
+	defer func() { _ = up.Close() }()
+	down, downPort := listenPort(t)
+	_ = down.Close()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "db", Type: "postgres", Host: "127.0.0.1", Port: upPort},
+		},
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	probe := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		_ = json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := probe("/api/health/ready")
+	if code != http.StatusOK || body["status"] != "ready" {
+		t.Fatalf("ready = %d %v, want 200 ready", code, body)
+	}
+
+	// A new config with an unreachable backend is checked immediately, not served from cache
+	broken := *cfg
+	broken.Connections = append(broken.Connections, config.ConnectionConfig{Name: "cache", Type: "tcp", Host: "127.0.0.1", Port: downPort})
+	if err := server.ReloadConfig(&broken); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	code, body = probe("/api/health?deep=true")
+	if code != http.StatusServiceUnavailable || body["ready"] != false {
+		t.Fatalf("deep health = %d %v, want 503 not ready", code, body)
+	}
+	connections := body["connections"].([]interface{})
+	if len(connections) != 2 {
+		t.Fatalf("connections = %d, want 2", len(connections))
+	}
+	db, cache := connections[0].(map[string]interface{}), connections[1].(map[string]interface{})
+	if db["name"] != "db" || db["reachable"] != true {
+		t.Errorf("db status = %v, want reachable", db)
+	}
+	if cache["name"] != "cache" || cache["reachable"] != false || cache["error"] == "" {
+		t.Errorf("cache status = %v, want unreachable with error", cache)
+	}
+
+	// Results are cached: a backend coming back is only noticed after the TTL
+	restored, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(downPort)))
+	if err != nil {
+		t.Skipf("could not rebind port %d: %v", downPort, err)
+	}
+	defer func() { _ = restored.Close() }()
+
+	if code, _ := probe("/api/health/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("ready within cache TTL = %d, want cached 503", code)
+	}
+	server.readiness.ttl = 0
+	if code, _ := probe("/api/health/ready"); code != http.StatusOK {
+		t.Errorf("ready after TTL = %d, want 200", code)
+	}
+
+	// Plain health stays a liveness check
+	if code, body := probe("/api/health"); code != http.StatusOK || body["status"] != "healthy" {
+		t.Errorf("health = %d %v, want 200 healthy", code, body)
+	}
+}
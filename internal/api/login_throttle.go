@@ -0,0 +1,183 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// Login throttling defaults, used when auth.lockout leaves a setting at 0
+const (
+	defaultLockoutMaxFailures = 5
+	defaultLockoutWindow      = 15 * time.Minute
+	defaultLockoutDuration    = 15 * time.Minute
+	defaultLockoutBackoff     = time.Second
+	defaultLockoutMaxTracked  = 10000
+
+	// lockoutFreeFailures are failures that don't delay the next attempt, so a mistyped password or two never waits
+	lockoutFreeFailures = 2
+)
+
+// loginThrottle counts failed logins per username and per client IP.
+// After the free failures, every failure makes the next attempt wait twice as long
+// as the previous one, and max_failures within the window lock the key out.
+// Entries expire with the window and the store never tracks more than max_tracked keys.
+type loginThrottle struct {
+	mu       sync.Mutex
+	cfg      config.LockoutConfig // Resolved: every limit set
+	failures map[string]*loginFailures
+	now      func() time.Time
+}
+
+// loginFailures is the failure history of one username or IP
+type loginFailures struct {
+	count       int
+	first       time.Time // First failure of the current window
+	last        time.Time // Most recent failure
+	lockedUntil time.Time
+}
+
+// newLoginThrottle creates a throttle with the auth.lockout settings
+func newLoginThrottle(cfg config.LockoutConfig) *loginThrottle {
+	t := &loginThrottle{failures: make(map[string]*loginFailures), now: time.Now}
+	t.Configure(cfg)
+	return t
+}
+
+// Configure applies new auth.lockout settings, keeping the failures already counted
+func (t *loginThrottle) Configure(cfg config.LockoutConfig) {
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = defaultLockoutMaxFailures
+	}
+	if cfg.Window == 0 {
+		cfg.Window = defaultLockoutWindow
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = defaultLockoutDuration
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = defaultLockoutBackoff
+	}
+	if cfg.MaxTracked == 0 {
+		cfg.MaxTracked = defaultLockoutMaxTracked
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+}
+
+// Wait returns how long the caller must wait before trying these keys again,
+// whether that is because of a lockout, and the key that is throttled
+func (t *loginThrottle) Wait(keys ...string) (time.Duration, bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.Disabled {
+		return 0, false, ""
+	}
+
+	now := t.now()
+	var wait time.Duration
+	var locked bool
+	var throttledKey string
+	for _, key := range keys {
+		entry := t.current(key, now)
+		if entry == nil {
+			continue
+		}
+		keyLocked := now.Before(entry.lockedUntil)
+		until := entry.lockedUntil
+		if !keyLocked && entry.count > lockoutFreeFailures {
+			until = entry.last.Add(t.backoff(entry.count - lockoutFreeFailures))
+		}
+		if d := until.Sub(now); d > wait {
+			wait, locked, throttledKey = d, keyLocked, key
+		}
+	}
+	return wait, locked, throttledKey
+}
+
+// Fail records a failed login for every key
+func (t *loginThrottle) Fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.Disabled {
+		return
+	}
+
+	now := t.now()
+	for _, key := range keys {
+		entry := t.current(key, now)
+		if entry == nil {
+			t.makeRoom(now)
+			entry = &loginFailures{first: now}
+			t.failures[key] = entry
+		}
+		entry.count++
+		entry.last = now
+		if entry.count >= t.cfg.MaxFailures {
+			entry.lockedUntil = now.Add(t.cfg.LockoutDuration)
+		}
+	}
+}
+
+// Reset forgets the failures of a key (after a successful login)
+func (t *loginThrottle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, key)
+}
+
+// current returns the live failure history of a key, dropping it if it expired. Requires t.mu.
+func (t *loginThrottle) current(key string, now time.Time) *loginFailures {
+	entry, ok := t.failures[key]
+	if !ok {
+		return nil
+	}
+	if t.expired(entry, now) {
+		delete(t.failures, key)
+		return nil
+	}
+	return entry
+}
+
+// expired reports whether a history's window has passed and it is not locked out. Requires t.mu.
+func (t *loginThrottle) expired(entry *loginFailures, now time.Time) bool {
+	return !now.Before(entry.first.Add(t.cfg.Window)) && !now.Before(entry.lockedUntil)
+}
+
+// backoff is the wait after count delayed failures: backoff, doubled per further failure. Requires t.mu.
+func (t *loginThrottle) backoff(count int) time.Duration {
+	wait := t.cfg.Backoff
+	for i := 1; i < count && wait < t.cfg.LockoutDuration; i++ {
+		wait *= 2
+	}
+	if wait > t.cfg.LockoutDuration {
+		wait = t.cfg.LockoutDuration
+	}
+	return wait
+}
+
+// makeRoom keeps the store under max_tracked keys: expired entries go first,
+// then the ones whose last failure is oldest. Requires t.mu.
+func (t *loginThrottle) makeRoom(now time.Time) {
+	if len(t.failures) < t.cfg.MaxTracked {
+		return
+	}
+	for key, entry := range t.failures {
+		if t.expired(entry, now) {
+			delete(t.failures, key)
+		}
+	}
+	for len(t.failures) >= t.cfg.MaxTracked {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range t.failures {
+			if oldestKey == "" || entry.last.Before(oldest) {
+				oldestKey, oldest = key, entry.last
+			}
+		}
+		delete(t.failures, oldestKey)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func newTestThrottle(cfg config.LockoutConfig) (*loginThrottle, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	t := newLoginThrottle(cfg)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestLoginThrottle_BackoffAndLockout(t *testing.T) {
+	throttle, now := newTestThrottle(config.LockoutConfig{MaxFailures: 5, Backoff: time.Second, LockoutDuration: 10 * time.Minute})
+
+	// The free failures never delay the next attempt
+	for i := 0; i < lockoutFreeFailures; i++ {
+		throttle.Fail("user:alice")
+		if wait, _, _ := throttle.Wait("user:alice"); wait != 0 {
+			t.Fatalf("wait after %d failures = %v, want 0", i+1, wait)
+		}
+	}
+
+	// Then every failure doubles the wait
+	for i, want := range []time.Duration{time.Second, 2 * time.Second} {
+		throttle.Fail("user:alice")
+		wait, locked, key := throttle.Wait("user:alice", "ip:192.0.2.1")
+		if wait != want || locked || key != "user:alice" {
+			t.Errorf("after delayed failure %d: Wait() = %v, %v, %q; want %v, false, user:alice", i+1, wait, locked, key, want)
+		}
+		*now = now.Add(wait)
+	}
+
+	// max_failures locks the key out
+	throttle.Fail("user:alice")
+	if wait, locked, _ := throttle.Wait("user:alice"); wait != 10*time.Minute || !locked {
+		t.Errorf("Wait() after max_failures = %v, %v; want 10m lockout", wait, locked)
+	}
+	*now = now.Add(10 * time.Minute)
+	if wait, _, _ := throttle.Wait("user:alice"); wait != 0 {
+		t.Errorf("Wait() after the lockout = %v, want 0", wait)
+	}
+}
+
+func TestLoginThrottle_ResetAndExpiry(t *testing.T) {
+	throttle, now := newTestThrottle(config.LockoutConfig{MaxFailures: 3, Window: time.Minute})
+
+	throttle.Fail("user:bob")
+	throttle.Fail("user:bob")
+	throttle.Reset("user:bob")
+	throttle.Fail("user:bob")
+	if wait, _, _ := throttle.Wait("user:bob"); wait != 0 {
+		t.Errorf("Wait() after reset and one failure = %v, want 0", wait)
+	}
+
+	throttle.Fail("user:carol")
+	throttle.Fail("user:carol")
+	*now = now.Add(time.Minute)
+	throttle.Fail("user:carol")
+	if wait, locked, _ := throttle.Wait("user:carol"); wait != 0 || locked {
+		t.Errorf("failures outside the window should not count: Wait() = %v, %v", wait, locked)
+	}
+}
+
+func TestLoginThrottle_Bounded(t *testing.T) {
+	throttle, now := newTestThrottle(config.LockoutConfig{MaxTracked: 3})
+
+	for i := 0; i < 10; i++ {
+		throttle.Fail(fmt.Sprintf("ip:192.0.2.%d", i))
+		*now = now.Add(time.Second)
+	}
+	if len(throttle.failures) != 3 {
+		t.Errorf("tracked keys = %d, want 3", len(throttle.failures))
+	}
+	if _, ok := throttle.failures["ip:192.0.2.9"]; !ok {
+		t.Error("the most recent key was evicted")
+	}
+}
+
+func TestLoginThrottle_Disabled(t *testing.T) {
+	throttle, _ := newTestThrottle(config.LockoutConfig{Disabled: true, MaxFailures: 1})
+	throttle.Fail("user:alice")
+	if wait, _, _ := throttle.Wait("user:alice"); wait != 0 {
+		t.Errorf("Wait() with throttling disabled = %v, want 0", wait)
+	}
+}
+
+func TestHandleLogin_Throttled(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	server, err := NewServer(&config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: time.Hour,
+			Users:       []config.User{{Username: "admin", Password: "admin123", Roles: []string{"admin"}}},
+			Lockout:     config.LockoutConfig{MaxFailures: 3},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditPath},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username": %q, "password": %q}`, username, password)
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		server.handleLogin(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := login("Admin", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// Locked out regardless of the username's case, even with the right password
+	w := login("admin", "admin123")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login while locked out: status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 response should set Retry-After")
+	}
+
+	entries, _ := audit.Query(auditPath, audit.Filter{Action: "login_throttled"})
+	if len(entries) != 1 || entries[0].Metadata["locked"] != true {
+		t.Errorf("login_throttled audit entries = %+v", entries)
+	}
+}
+
+func TestHandleLogin_SuccessKeepsIPFailures(t *testing.T) {
+	server, err := NewServer(&config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret:   "test-secret",
+			TokenExpiry: time.Hour,
+			Users:       []config.User{{Username: "mallory", Password: "mallory123", Roles: []string{"developer"}}},
+			Lockout:     config.LockoutConfig{MaxFailures: 3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	login := func(username, password string) int {
+		body := fmt.Sprintf(`{"username": %q, "password": %q}`, username, password)
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		server.handleLogin(w, req)
+		return w.Code
+	}
+
+	// Logging into one's own account between guesses doesn't clear the IP's failures
+	for _, target := range []string{"alice", "bob"} {
+		if code := login(target, "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess at %s: status = %d, want 401", target, code)
+		}
+	}
+	if code := login("mallory", "mallory123"); code != http.StatusOK {
+		t.Fatalf("own login: status = %d, want 200", code)
+	}
+	if code := login("carol", "guess"); code != http.StatusUnauthorized {
+		t.Fatalf("guess at carol: status = %d, want 401", code)
+	}
+	if code := login("mallory", "mallory123"); code != http.StatusTooManyRequests {
+		t.Errorf("login from the locked out IP: status = %d, want 429", code)
+	}
+}
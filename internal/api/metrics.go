@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// handleMetrics exposes connection metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	cfg := s.GetConfig()
+	sessions := s.connMgr.ActiveSessionsByConnection()
+
+	// Report every configured connection so series don't disappear at zero
+	thresholds := make(map[string]int)
+	for _, conn := range cfg.Connections {
+		if _, ok := sessions[conn.Name]; !ok {
+			sessions[conn.Name] = 0
+		}
+		if conn.SessionAlertThreshold > 0 {
+			thresholds[conn.Name] = conn.SessionAlertThreshold
+		}
+	}
+
+	var b strings.Builder
+	total := 0
+	for _, count := range sessions {
+		total += count
+	}
+	writeMetric(&b, "port_authorizing_active_sessions_total", "Active proxy sessions across all connections", nil, total)
+	writeMetric(&b, "port_authorizing_active_sessions", "Active proxy sessions per connection", sessions, 0)
+	writeMetric(&b, "port_authorizing_session_alert_threshold", "Configured session alert threshold per connection", thresholds, 0)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// writeMetric writes a gauge, either unlabeled (values == nil) or with one
+// series per connection label
+func writeMetric(b *strings.Builder, name, help string, values map[string]int, value int) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	if values == nil {
+		fmt.Fprintf(b, "%s %d\n", name, value)
+		return
+	}
+
+	names := make([]string, 0, len(values))
+	for connection := range values {
+		names = append(names, connection)
+	}
+	sort.Strings(names)
+	for _, connection := range names {
+		fmt.Fprintf(b, "%s{connection=\"%s\"} %d\n", name, escapeLabelValue(connection), values[connection])
+	}
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
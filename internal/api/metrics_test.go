@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "api", Type: "http", Host: "localhost", Port: 8080, SessionAlertThreshold: 5},
+			{Name: "idle-db", Type: "postgres", Host: "localhost", Port: 5432},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: t.TempDir() + "/audit.log"},
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.connMgr.CloseAll()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := server.connMgr.CreateConnection("alice", &cfg.Connections[0], time.Hour, nil, cfg.Logging.AuditLogPath, nil); err != nil {
+			t.Fatalf("CreateConnection() error = %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE port_authorizing_active_sessions gauge",
+		`port_authorizing_active_sessions{connection="api"} 2`,
+		`port_authorizing_active_sessions{connection="idle-db"} 0`,
+		"port_authorizing_active_sessions_total 2",
+		`port_authorizing_session_alert_threshold{connection="api"} 5`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
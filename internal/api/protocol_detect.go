@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
+	"github.com/gorilla/websocket"
+)
+
+// protocolDetectWait is how long detect_protocol waits for the client to speak first.
+// Clients of server-first protocols (e.g., MySQL) are connected to the backend after it.
+const protocolDetectWait = 500 * time.Millisecond
+
+// firstMessage is the client's first binary WebSocket message, read while detecting the protocol
+type firstMessage struct {
+	data []byte
+	err  error
+}
+
+// readFirstMessage reads the client's first binary message in the background.
+// Whoever receives from the channel owns all further reads from wsConn.
+func readFirstMessage(wsConn *websocket.Conn) <-chan firstMessage {
+	first := make(chan firstMessage, 1)
+	go func() {
+		for {
+			messageType, data, err := wsConn.ReadMessage()
+			if err != nil {
+				first <- firstMessage{err: err}
+				return
+			}
+			extendReadDeadline(wsConn)
+			if messageType == websocket.BinaryMessage {
+				first <- firstMessage{data: data}
+				return
+			}
+		}
+	}()
+	return first
+}
+
+// logProtocolDetected audits the protocol detect_protocol recognized ("" if none)
+// and how the session is handled
+func (s *Server) logProtocolDetected(ctx context.Context, conn *proxy.Connection, username, protocol string) {
+	handling := "passthrough"
+	if protocol == proxy.ProtocolPostgres {
+		handling = "postgres_proxy"
+	}
+	if protocol == "" {
+		protocol = "unknown"
+	}
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "protocol_detected", conn.Config.Name, tracing.Annotate(ctx, map[string]interface{}{
+		"connection_id": conn.ID,
+		"protocol":      protocol,
+		"handling":      handling,
+	}))
+}
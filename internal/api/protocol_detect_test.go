@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/auth"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+// startDetectBackend accepts connections, writes greeting (if any) and echoes what it reads
+func startDetectBackend(t *testing.T, greeting []byte) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = c.Close() }()
+				if greeting != nil {
+					_, _ = c.Write(greeting)
+				}
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestHandleProxyStream_DetectProtocol(t *testing.T) {
+	defer audit.Close()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+
+	mysqlGreeting := append([]byte{14, 0, 0, 0, 10}, "8.0.36\x00"...)
+	mysqlGreeting = append(mysqlGreeting, make([]byte, 7)...)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "cache", Type: "tcp", Host: "127.0.0.1", Port: startDetectBackend(t, nil), DetectProtocol: true},
+			{Name: "mysql", Type: "tcp", Host: "127.0.0.1", Port: startDetectBackend(t, mysqlGreeting), DetectProtocol: true},
+			{Name: "db", Type: "tcp", Host: "127.0.0.1", Port: startDetectBackend(t, nil), DetectProtocol: true},
+		},
+		Logging: config.LoggingConfig{AuditLogPath: auditPath},
+	}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "alice", Roles: []string{"dev"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+	dial := func(i int) *websocket.Conn {
+		id, _, err := server.connMgr.CreateConnection("alice", &cfg.Connections[i], time.Hour, nil, auditPath, nil)
+		if err != nil {
+			t.Fatalf("CreateConnection() error = %v", err)
+		}
+		header := http.Header{"Authorization": {"Bearer " + token}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/proxy/"+id, header)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		t.Cleanup(func() { _ = ws.Close() })
+		_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return ws
+	}
+	read := func(ws *websocket.Conn) []byte {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		return data
+	}
+	detected := func(connection string) map[string]interface{} {
+		entries, _ := audit.Query(auditPath, audit.Filter{Action: "protocol_detected", Resource: connection})
+		if len(entries) != 1 {
+			t.Fatalf("protocol_detected entries for %s = %+v, want 1", connection, entries)
+		}
+		return entries[0].Metadata
+	}
+
+	// Redis is recognized from the client's first command and passed through
+	ws := dial(0)
+	ping := []byte("*1\r\n$4\r\nPING\r\n")
+	_ = ws.WriteMessage(websocket.BinaryMessage, ping)
+	if got := read(ws); !bytes.Equal(got, ping) {
+		t.Errorf("redis echo = %q, want %q", got, ping)
+	}
+	if md := detected("cache"); md["protocol"] != "redis" || md["handling"] != "passthrough" {
+		t.Errorf("redis detection = %v", md)
+	}
+
+	// MySQL clients wait for the server, whose greeting identifies it
+	ws = dial(1)
+	if got := read(ws); !bytes.Equal(got, mysqlGreeting) {
+		t.Errorf("mysql greeting = %q", got)
+	}
+	if md := detected("mysql"); md["protocol"] != "mysql" || md["handling"] != "passthrough" {
+		t.Errorf("mysql detection = %v", md)
+	}
+
+	// Postgres sessions are handed to the Postgres proxy, which enforces its checks
+	ws = dial(2)
+	params := "user\x00mallory\x00database\x00app\x00\x00"
+	startup := make([]byte, 8, 8+len(params))
+	startup = append(startup, params...)
+	binary.BigEndian.PutUint32(startup[0:4], uint32(len(startup)))
+	binary.BigEndian.PutUint32(startup[4:8], 196608)
+	_ = ws.WriteMessage(websocket.BinaryMessage, startup)
+	if got := read(ws); len(got) == 0 || got[0] != 'R' {
+		t.Fatalf("postgres auth request = %q, want AuthenticationCleartextPassword", got)
+	}
+	_ = ws.WriteMessage(websocket.BinaryMessage, []byte{'p', 0, 0, 0, 7, 'p', 'w', 0})
+	if got := read(ws); len(got) == 0 || got[0] != 'E' || !bytes.Contains(got, []byte("Username mismatch")) {
+		t.Errorf("postgres response = %q, want the proxy's username mismatch error", got)
+	}
+	if md := detected("db"); md["protocol"] != "postgres" || md["handling"] != "postgres_proxy" {
+		t.Errorf("postgres detection = %v", md)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/gorilla/mux"
+)
+
+// handleGRPCStream serves a gRPC connection: the tunnel carries the client's
+// HTTP/2 connection, which the connection's GRPCProxy terminates so every RPC
+// is checked against the method whitelist and approvals before reaching the backend.
+// Uses the WebSocket tunnel when requested, otherwise the hijacked HTTP connection.
+func (s *Server) handleGRPCStream(w http.ResponseWriter, r *http.Request, isWebSocket bool) {
+	username := r.Context().Value(ContextKeyUsername).(string)
+	connectionID := mux.Vars(r)["connectionID"]
+
+	// Get connection (already validated in parent function)
+	conn, _ := s.connMgr.GetConnection(connectionID)
+
+	grpcProxy, ok := conn.Proxy.(*proxy.GRPCProxy)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, "gRPC proxy not initialized")
+		return
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "grpc_connect", conn.Config.Name, map[string]interface{}{
+		"connection_id": connectionID,
+		"websocket":     isWebSocket,
+	})
+
+	var stream net.Conn
+	if isWebSocket {
+		wsConn, err := s.upgradeTunnel(w, r)
+		if err != nil {
+			s.connLogger(conn).Warn("websocket upgrade failed", "error", err)
+			_ = audit.Log(s.config.Logging.AuditLogPath, username, "websocket_upgrade_failed", conn.Config.Name, map[string]interface{}{
+				"connection_id": connectionID,
+				"error":         err.Error(),
+			})
+			return
+		}
+		defer func() { _ = wsConn.Close() }()
+
+		// Usage banner consent must be given before any traffic flows
+		if !s.awaitBannerAck(wsConn, conn, username) {
+			return
+		}
+
+		// Keep the tunnel alive in both directions (server pings, CLI pings and traffic)
+		stopKeepalive := s.startWebSocketKeepalive(wsConn)
+		defer stopKeepalive()
+
+		stream = &websocketConn{ws: wsConn, done: make(chan struct{})}
+	} else {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, ErrCodeInternal, "HTTP hijacking not supported")
+			return
+		}
+		clientConn, bufrw, err := hijacker.Hijack()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to hijack connection: %v", err))
+			return
+		}
+		_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		_ = bufrw.Flush()
+		conn.FollowExpiry(clientConn)
+		stream = clientConn
+	}
+	defer func() { _ = stream.Close() }()
+
+	// Register the stream so idle and expired connections can be torn down
+	conn.RegisterStream(stream)
+	defer conn.UnregisterStream(stream)
+
+	grpcProxy.ServeConn(proxy.TrackActivity(stream, conn))
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "grpc_disconnect", conn.Config.Name, map[string]interface{}{
+		"connection_id": connectionID,
+	})
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,7 +14,10 @@ import (
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // handleHTTPProxyStream handles HTTP connections through TCP stream with approval support
@@ -26,19 +31,19 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 	// Validate connection exists and hasn't expired
 	conn, err := s.connMgr.GetConnection(connectionID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Connection not found or expired")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
 		return
 	}
 
 	// Verify ownership
 	if conn.Username != username {
-		respondError(w, http.StatusForbidden, "Access denied")
+		respondError(w, http.StatusForbidden, ErrCodeForbidden, "Access denied")
 		return
 	}
 
 	// Verify it's an HTTP/HTTPS connection
 	if conn.Config.Type != "http" && conn.Config.Type != "https" {
-		respondError(w, http.StatusBadRequest, "Not an HTTP/HTTPS connection")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Not an HTTP/HTTPS connection")
 		return
 	}
 
@@ -52,13 +57,13 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 	// Hijack HTTP connection to get raw TCP socket
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		respondError(w, http.StatusInternalServerError, "HTTP hijacking not supported")
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, "HTTP hijacking not supported")
 		return
 	}
 
 	clientConn, bufrw, err := hijacker.Hijack()
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to hijack connection: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to hijack connection: %v", err))
 		return
 	}
 	defer func() { _ = clientConn.Close() }()
@@ -71,8 +76,8 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 200 Connection Established\r\n\r\n")
 	_ = bufrw.Flush()
 
-	// Set deadline based on connection expiry
-	_ = clientConn.SetDeadline(conn.ExpiresAt)
+	// Set deadline based on connection expiry, following any extension
+	conn.FollowExpiry(clientConn)
 
 	// Use the HTTP proxy instance from connection (which has approval support)
 	httpProxy := conn.Proxy
@@ -86,12 +91,22 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 
 	// Process HTTP requests in a loop
 	reader := bufio.NewReader(bufrw)
+	// Request spans join the stream's trace but must not be cancelled with the hijacked request
+	streamCtx := proxy.WithClientScheme(context.WithoutCancel(r.Context()), clientScheme(r, s.trustedProxies))
+	remoteAddr := clientRemoteAddr(r, s.trustedProxies)
 
-	for time.Now().Before(conn.ExpiresAt) {
+	for time.Now().Before(conn.ExpiresAt()) {
 		// Check if connection expired handled by loop condition
 
 		// Read HTTP request from client
-		requestBytes, err := readHTTPRequest(reader)
+		requestBytes, err := readHTTPRequest(reader, s.maxRequestBytes(conn.Config))
+		var tooLarge *proxy.RequestTooLargeError
+		if errors.As(err, &tooLarge) {
+			proxy.LogRequestTooLarge(s.config.Logging.AuditLogPath, username, conn.Config.Name, connectionID, "http", tooLarge, nil)
+			proxy.WriteRequestTooLarge(&streamResponseWriter{writer: bufrw, header: make(http.Header)}, tooLarge)
+			_ = bufrw.Flush()
+			break
+		}
 		if err != nil {
 			if err != io.EOF && !strings.Contains(err.Error(), "use of closed") {
 				_ = audit.Log(s.config.Logging.AuditLogPath, username, "http_read_error", conn.Config.Name, map[string]interface{}{
@@ -102,6 +117,8 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		conn.Touch()
+
 		// Parse HTTP request to get method and path for logging
 		reqReader := bufio.NewReader(bytes.NewReader(requestBytes))
 		httpReq, err := http.ReadRequest(reqReader)
@@ -118,8 +135,13 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 
 		// Create a synthetic HTTP request for the proxy handler
 		// The proxy handler expects the request body to contain the raw HTTP request
-		proxyReq := httptest.NewRequest("POST", "/", bytes.NewReader(requestBytes))
+		reqCtx, reqSpan := tracing.Start(streamCtx, "proxy.http.request",
+			attribute.String("connection_id", connectionID),
+			attribute.String("http.method", httpReq.Method),
+			attribute.String("url.path", httpReq.URL.Path))
+		proxyReq := httptest.NewRequest("POST", "/", bytes.NewReader(requestBytes)).WithContext(reqCtx)
 		proxyReq.Header.Set("Content-Type", "application/octet-stream")
+		proxyReq.RemoteAddr = remoteAddr
 
 		// Create response writer that writes back to the client
 		respWriter := &streamResponseWriter{
@@ -130,20 +152,25 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 		// Call the HTTP proxy's HandleRequest
 		// This will check whitelist, approval, and forward to backend!
 		err = httpProxy.HandleRequest(respWriter, proxyReq)
+		if err != nil {
+			tracing.Fail(reqSpan, err)
+		}
+		reqSpan.End()
 
 		// CRITICAL: Flush the response back to the client!
 		_ = bufrw.Flush()
+		conn.Touch()
 
 		if err != nil {
 			// Error response was already sent by HandleRequest
 			// Check if it was a 403 (blocked/rejected)
 			if respWriter.statusCode == http.StatusForbidden {
-				_ = audit.Log(s.config.Logging.AuditLogPath, username, "http_request_blocked", conn.Config.Name, map[string]interface{}{
+				_ = audit.Log(s.config.Logging.AuditLogPath, username, "http_request_blocked", conn.Config.Name, tracing.Annotate(reqCtx, map[string]interface{}{
 					"connection_id": connectionID,
 					"method":        httpReq.Method,
 					"path":          httpReq.URL.Path,
 					"reason":        "blocked by approval or whitelist",
-				})
+				}))
 			}
 			break
 		}
@@ -160,7 +187,7 @@ func (s *Server) handleHTTPProxyStream(w http.ResponseWriter, r *http.Request) {
 }
 
 // readHTTPRequest reads a complete HTTP request from the reader
-func readHTTPRequest(reader *bufio.Reader) ([]byte, error) {
+func readHTTPRequest(reader *bufio.Reader, limit int64) ([]byte, error) {
 	var buffer bytes.Buffer
 
 	// Peek to see if there's data available
@@ -171,7 +198,7 @@ func readHTTPRequest(reader *bufio.Reader) ([]byte, error) {
 
 	// Read request line and headers
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := readHeaderLine(reader, int64(buffer.Len()), limit)
 		if err != nil {
 			return nil, err
 		}
@@ -192,8 +219,11 @@ func readHTTPRequest(reader *bufio.Reader) ([]byte, error) {
 			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "content-length:") {
 				parts := strings.SplitN(line, ":", 2)
 				if len(parts) == 2 {
-					var contentLength int
+					var contentLength int64
 					_, _ = fmt.Sscanf(strings.TrimSpace(parts[1]), "%d", &contentLength)
+					if size := int64(buffer.Len()) + contentLength; limit > 0 && size > limit {
+						return nil, &proxy.RequestTooLargeError{Size: size, Limit: limit}
+					}
 
 					if contentLength > 0 {
 						// Read body
@@ -213,6 +243,26 @@ func readHTTPRequest(reader *bufio.Reader) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
+// readHeaderLine reads a request or header line like ReadString('\n'), failing with
+// *proxy.RequestTooLargeError as soon as the request (buffered bytes so far plus the
+// line) exceeds limit (0 = unlimited)
+func readHeaderLine(reader *bufio.Reader, buffered, limit int64) (string, error) {
+	if limit <= 0 {
+		return reader.ReadString('\n')
+	}
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if size := buffered + int64(len(line)); size > limit {
+			return "", &proxy.RequestTooLargeError{Size: size, Limit: limit, AtLeast: true}
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(line), err
+		}
+	}
+}
+
 // streamResponseWriter writes HTTP responses directly to the client stream
 type streamResponseWriter struct {
 	writer      *bufio.ReadWriter
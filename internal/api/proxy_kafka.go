@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/gorilla/mux"
+)
+
+// Headers describing a Kafka tunnel stream, sent by the CLI (see kafkaStreamFromHeaders)
+const (
+	headerKafkaBroker    = "X-Kafka-Broker"    // Target broker node ID; absent for the bootstrap listener
+	headerKafkaBootstrap = "X-Kafka-Bootstrap" // Client-side address of the bootstrap listener
+	headerKafkaListeners = "X-Kafka-Listeners" // Client-side broker addresses: "1=localhost:9093,2=localhost:9094"
+)
+
+// handleKafkaStream serves a Kafka connection: the connection's KafkaProxy checks
+// every request's topics against the whitelist and rewrites broker addresses in
+// responses to the CLI's local listeners, so clients never reach brokers directly.
+// Uses the WebSocket tunnel when requested, otherwise the hijacked HTTP connection.
+func (s *Server) handleKafkaStream(w http.ResponseWriter, r *http.Request, isWebSocket bool) {
+	username := r.Context().Value(ContextKeyUsername).(string)
+	connectionID := mux.Vars(r)["connectionID"]
+
+	// Get connection (already validated in parent function)
+	conn, _ := s.connMgr.GetConnection(connectionID)
+
+	kafkaProxy, ok := conn.Proxy.(*proxy.KafkaProxy)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, "Kafka proxy not initialized")
+		return
+	}
+
+	kafkaStream, err := kafkaStreamFromHeaders(r.Header)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "kafka_connect", conn.Config.Name, map[string]interface{}{
+		"connection_id": connectionID,
+		"websocket":     isWebSocket,
+		"broker_id":     kafkaStream.BrokerID,
+	})
+
+	var stream net.Conn
+	if isWebSocket {
+		wsConn, err := s.upgradeTunnel(w, r)
+		if err != nil {
+			s.connLogger(conn).Warn("websocket upgrade failed", "error", err)
+			_ = audit.Log(s.config.Logging.AuditLogPath, username, "websocket_upgrade_failed", conn.Config.Name, map[string]interface{}{
+				"connection_id": connectionID,
+				"error":         err.Error(),
+			})
+			return
+		}
+		defer func() { _ = wsConn.Close() }()
+
+		// Usage banner consent must be given before any traffic flows
+		if !s.awaitBannerAck(wsConn, conn, username) {
+			return
+		}
+
+		// Keep the tunnel alive in both directions (server pings, CLI pings and traffic)
+		stopKeepalive := s.startWebSocketKeepalive(wsConn)
+		defer stopKeepalive()
+
+		stream = &websocketConn{ws: wsConn, done: make(chan struct{})}
+	} else {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, ErrCodeInternal, "HTTP hijacking not supported")
+			return
+		}
+		clientConn, bufrw, err := hijacker.Hijack()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to hijack connection: %v", err))
+			return
+		}
+		_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		_ = bufrw.Flush()
+		conn.FollowExpiry(clientConn)
+		stream = clientConn
+	}
+	defer func() { _ = stream.Close() }()
+
+	// Register the stream so idle and expired connections can be torn down
+	conn.RegisterStream(stream)
+	defer conn.UnregisterStream(stream)
+
+	err = kafkaProxy.HandleConnection(proxy.TrackActivity(stream, conn), kafkaStream)
+	conn.SetBackendAddr(kafkaProxy.BackendAddr())
+	if err != nil {
+		s.connLogger(conn).Warn("kafka stream failed", "error", err, "backend_addr", kafkaProxy.BackendAddr())
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "kafka_error", conn.Config.Name, map[string]interface{}{
+			"connection_id": connectionID,
+			"error":         err.Error(),
+			"backend_addr":  kafkaProxy.BackendAddr(),
+		})
+		return
+	}
+
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "kafka_disconnect", conn.Config.Name, map[string]interface{}{
+		"connection_id": connectionID,
+		"backend_addr":  kafkaProxy.BackendAddr(),
+	})
+}
+
+// kafkaStreamFromHeaders reads the target broker and the CLI's listener addresses from a stream request
+func kafkaStreamFromHeaders(h http.Header) (proxy.KafkaStream, error) {
+	stream := proxy.KafkaStream{
+		BrokerID:  -1,
+		Bootstrap: h.Get(headerKafkaBootstrap),
+		Listeners: make(map[int32]string),
+	}
+
+	if broker := h.Get(headerKafkaBroker); broker != "" {
+		id, err := strconv.ParseInt(broker, 10, 32)
+		if err != nil || id < 0 {
+			return stream, fmt.Errorf("invalid %s header %q", headerKafkaBroker, broker)
+		}
+		stream.BrokerID = int32(id)
+	}
+
+	if listeners := h.Get(headerKafkaListeners); listeners != "" {
+		for _, entry := range strings.Split(listeners, ",") {
+			idStr, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			id, err := strconv.ParseInt(idStr, 10, 32)
+			if !ok || err != nil || addr == "" {
+				return stream, fmt.Errorf("invalid %s entry %q", headerKafkaListeners, entry)
+			}
+			stream.Listeners[int32(id)] = addr
+		}
+	}
+	return stream, nil
+}
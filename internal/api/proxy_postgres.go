@@ -3,12 +3,21 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/davidcohan/port-authorizing/internal/audit"
 	"github.com/davidcohan/port-authorizing/internal/proxy"
 	"github.com/gorilla/mux"
 )
 
+// QueryPreviewHeader requests EXPLAIN-only preview mode for a postgres proxy stream
+const QueryPreviewHeader = "X-Query-Preview"
+
+// isExplainPreviewRequest checks if the client requested EXPLAIN preview mode
+func isExplainPreviewRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(QueryPreviewHeader), "explain")
+}
+
 // handlePostgresProxy handles Postgres protocol connections
 // This creates a transparent TCP tunnel but with protocol-aware query logging
 func (s *Server) handlePostgresProxy(w http.ResponseWriter, r *http.Request) {
@@ -20,24 +29,29 @@ func (s *Server) handlePostgresProxy(w http.ResponseWriter, r *http.Request) {
 	// Validate connection exists and hasn't expired
 	conn, err := s.connMgr.GetConnection(connectionID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Connection not found or expired")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
 		return
 	}
 
 	// Verify ownership
 	if conn.Username != username {
-		respondError(w, http.StatusForbidden, "Access denied")
+		respondError(w, http.StatusForbidden, ErrCodeForbidden, "Access denied")
 		return
 	}
 
 	// Verify it's a Postgres connection
 	if conn.Config.Type != "postgres" {
-		respondError(w, http.StatusBadRequest, "Not a Postgres connection")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Not a Postgres connection")
+		return
+	}
+
+	if isExplainPreviewRequest(r) && !conn.Config.ExplainPreview {
+		respondError(w, http.StatusForbidden, ErrCodeExplainPreviewDisabled, "EXPLAIN preview mode is not enabled for this connection")
 		return
 	}
 
 	// Get whitelist for this user's roles and connection
-	whitelist := s.authz.GetWhitelistForConnection(roles, conn.Config.Name)
+	whitelist := s.connectionAuthz(conn).GetWhitelistForConnection(roles, conn.Config.Name)
 
 	// Log audit event
 	_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_connect", conn.Config.Name, map[string]interface{}{
@@ -45,18 +59,19 @@ func (s *Server) handlePostgresProxy(w http.ResponseWriter, r *http.Request) {
 		"method":          r.Method,
 		"roles":           roles,
 		"whitelist_rules": len(whitelist),
+		"explain_preview": isExplainPreviewRequest(r),
 	})
 
 	// Hijack HTTP connection to get raw TCP socket
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		respondError(w, http.StatusInternalServerError, "HTTP hijacking not supported")
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, "HTTP hijacking not supported")
 		return
 	}
 
 	clientConn, bufrw, err := hijacker.Hijack()
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to hijack connection: %v", err))
+		respondError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to hijack connection: %v", err))
 		return
 	}
 	defer func() { _ = clientConn.Close() }()
@@ -69,8 +84,8 @@ func (s *Server) handlePostgresProxy(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 200 Connection Established\r\n\r\n")
 	_ = bufrw.Flush()
 
-	// Set deadline based on connection expiry
-	_ = clientConn.SetDeadline(conn.ExpiresAt)
+	// Set deadline based on connection expiry, following any extension
+	conn.FollowExpiry(clientConn)
 
 	// Create Postgres proxy with credential substitution and whitelist
 	pgProxy := proxy.NewPostgresAuthProxy(
@@ -87,18 +102,58 @@ func (s *Server) handlePostgresProxy(w http.ResponseWriter, r *http.Request) {
 		pgProxy.SetApprovalManager(s.approvalMgr)
 	}
 
+	// Resolve whitelist patterns per query from the connection's current policy
+	pgProxy.SetWhitelistSource(conn)
+
+	// Restrict operations per table when the matching policies define table_permissions
+	pgProxy.SetTablePermissions(s.connectionAuthz(conn).GetTablePermissionsForConnection(roles, conn.Config.Name))
+
+	// COPY FROM/TO only in the directions the matching policies allow
+	pgProxy.SetCopyDirections(s.connectionAuthz(conn).GetCopyDirectionsForConnection(roles, conn.Config.Name))
+
+	// EXPLAIN preview mode (already validated against connection config)
+	pgProxy.SetExplainOnly(isExplainPreviewRequest(r))
+
+	// Read-only mode: set on the connection or through one of the user's read_only_roles
+	pgProxy.SetReadOnly(s.connectionAuthz(conn).IsReadOnlyForConnection(roles, conn.Config.Name))
+
+	// Whitelist-only connections reject stacked statements unless turned off
+	pgProxy.SetBlockMultiStatement(s.blockMultiStatement())
+
+	// Oversized queries are rejected instead of buffered
+	pgProxy.SetMaxRequestBytes(s.maxRequestBytes(conn.Config))
+
+	// Approvers see the reason the user gave when connecting
+	pgProxy.SetConnectReason(conn.Reason())
+
+	// Sessions use the database the user picked when connecting, if any
+	pgProxy.SetDatabase(conn.Database())
+
+	// Warn the client with a NoticeResponse shortly before the connection expires
+	pgProxy.SetExpiry(conn)
+
 	// Handle the Postgres protocol connection
 	// This will authenticate the client with API credentials,
 	// log all queries, and forward to backend with backend credentials
-	if err := pgProxy.HandleConnection(clientConn); err != nil {
+	err = pgProxy.HandleConnection(proxy.TrackActivity(clientConn, conn))
+	conn.SetBackendAddr(pgProxy.BackendAddr())
+	if err != nil {
+		s.connLogger(conn).Warn("postgres session failed", "error", err, "backend_addr", pgProxy.BackendAddr())
 		_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_error", conn.Config.Name, map[string]interface{}{
 			"connection_id": connectionID,
 			"error":         err.Error(),
+			"backend_addr":  pgProxy.BackendAddr(),
 		})
 		return
 	}
 
 	_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_disconnect", conn.Config.Name, map[string]interface{}{
 		"connection_id": connectionID,
+		"backend_addr":  pgProxy.BackendAddr(),
 	})
 }
+
+// blockMultiStatement reports whether security.block_multi_statement is on (the default)
+func (s *Server) blockMultiStatement() bool {
+	return s.config.Security.BlockMultiStatement == nil || *s.config.Security.BlockMultiStatement
+}
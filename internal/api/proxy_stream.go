@@ -3,6 +3,9 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -14,8 +17,10 @@ import (
 
 	"github.com/davidcohan/port-authorizing/internal/audit"
 	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // WebSocket upgrader with generous buffer sizes for throughput
@@ -27,6 +32,23 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// compressingUpgrader is upgrader with permessage-deflate negotiation
+var compressingUpgrader = func() websocket.Upgrader {
+	u := upgrader
+	u.EnableCompression = true
+	return u
+}()
+
+// upgradeTunnel upgrades a CLI tunnel request. With server.websocket_compression,
+// permessage-deflate is used when the CLI offers it (connect --compress); control
+// frames (ping/pong/close) are never compressed.
+func (s *Server) upgradeTunnel(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	if s.config.Server.WebSocketCompression {
+		return compressingUpgrader.Upgrade(w, r, nil)
+	}
+	return upgrader.Upgrade(w, r, nil)
+}
+
 // handleProxyStream handles WebSocket-based reverse tunneling to target service
 // Routes to appropriate protocol handler based on connection type
 func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
@@ -37,23 +59,57 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 	// Validate connection exists and hasn't expired
 	conn, err := s.connMgr.GetConnection(connectionID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Connection not found or expired")
+		respondError(w, http.StatusNotFound, ErrCodeConnectionNotFound, "Connection not found or expired")
 		return
 	}
 
 	// Verify ownership
 	if conn.Username != username {
-		respondError(w, http.StatusForbidden, "Access denied")
+		respondError(w, http.StatusForbidden, ErrCodeForbidden, "Access denied")
+		return
+	}
+
+	// Every tunnel must come from a network the connection's policies allow
+	if !s.checkConnectionSource(w, r, conn) {
 		return
 	}
 
+	// Protocol handlers run within this span; it ends when the stream closes
+	ctx, span := tracing.Start(r.Context(), "proxy.stream",
+		attribute.String("username", username),
+		attribute.String("connection", conn.Config.Name),
+		attribute.String("connection_id", connectionID),
+		attribute.String("connection.type", conn.Config.Type))
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	// Check if this is a WebSocket upgrade request (from CLI)
 	isWebSocket := r.Header.Get("Upgrade") == "websocket" &&
 		r.Header.Get("Connection") != "" &&
 		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
 
+	// Banner acknowledgement is a WebSocket handshake; raw streams can't give it
+	if requiresBannerAck(conn) && !isWebSocket {
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "banner_ack_missing", conn.Config.Name, map[string]interface{}{
+			"connection_id": connectionID,
+			"reason":        "banner acknowledgement requires the WebSocket tunnel",
+		})
+		respondError(w, http.StatusForbidden, ErrCodeBannerAckRequired, "This connection requires banner acknowledgement; connect with the CLI")
+		return
+	}
+
 	// Route to appropriate handler based on connection type
 	if conn.Config.Type == "postgres" {
+		// EXPLAIN preview mode must be enabled on the connection
+		if isExplainPreviewRequest(r) && !conn.Config.ExplainPreview {
+			_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_preview_denied", conn.Config.Name, map[string]interface{}{
+				"connection_id": connectionID,
+				"reason":        "explain preview not enabled for connection",
+			})
+			respondError(w, http.StatusForbidden, ErrCodeExplainPreviewDisabled, "EXPLAIN preview mode is not enabled for this connection")
+			return
+		}
+
 		// For PostgreSQL: use WebSocket if upgrade requested, otherwise use protocol-aware proxy
 		if isWebSocket {
 			s.handlePostgresWebSocket(w, r)
@@ -75,17 +131,42 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// For gRPC: terminate HTTP/2 to gate each RPC on its method
+	if conn.Config.Type == "grpc" {
+		s.handleGRPCStream(w, r, isWebSocket)
+		return
+	}
+
+	// For MongoDB: parse the wire protocol to gate each command
+	if conn.Config.Type == "mongodb" {
+		s.handleMongoStream(w, r, isWebSocket)
+		return
+	}
+
+	// For SSH: terminate the session to gate each exec, shell and subsystem request
+	if conn.Config.Type == "ssh" {
+		s.handleSSHStream(w, r, isWebSocket)
+		return
+	}
+
+	// For Kafka: parse requests to gate each topic and rewrite broker addresses
+	if conn.Config.Type == "kafka" {
+		s.handleKafkaStream(w, r, isWebSocket)
+		return
+	}
+
 	// For WebSocket requests or TCP connections, use WebSocket-based reverse tunnel
 
 	// Log audit event
-	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_stream_websocket", conn.Config.Name, map[string]interface{}{
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_stream_websocket", conn.Config.Name, tracing.Annotate(ctx, map[string]interface{}{
 		"connection_id": connectionID,
 		"method":        r.Method,
-	})
+	}))
 
 	// Upgrade HTTP connection to WebSocket
-	wsConn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := s.upgradeTunnel(w, r)
 	if err != nil {
+		s.connLogger(conn).Warn("websocket upgrade failed", "error", err)
 		_ = audit.Log(s.config.Logging.AuditLogPath, username, "websocket_upgrade_failed", conn.Config.Name, map[string]interface{}{
 			"connection_id": connectionID,
 			"error":         err.Error(),
@@ -94,18 +175,50 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = wsConn.Close() }()
 
-	// Setup ping/pong to keep connection alive (send pong in response to ping from client)
-	_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	wsConn.SetPongHandler(func(string) error {
-		_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
+	// Usage banner consent must be given before any traffic flows
+	if !s.awaitBannerAck(wsConn, conn, username) {
+		return
+	}
+
+	// Keep the tunnel alive in both directions (server pings, CLI pings and traffic)
+	stopKeepalive := s.startWebSocketKeepalive(wsConn)
+	defer stopKeepalive()
+
+	// detect_protocol: a Postgres session gets the Postgres proxy's whitelisting and auditing
+	// instead of raw passthrough. If the client doesn't speak first, the backend's greeting
+	// is sniffed instead once the tunnel is up.
+	var initial []byte
+	var pendingFirst <-chan firstMessage
+	if conn.Config.DetectProtocol {
+		first := readFirstMessage(wsConn)
+		select {
+		case msg := <-first:
+			if msg.err != nil {
+				return
+			}
+			initial = msg.data
+			detected := proxy.DetectClientProtocol(initial)
+			s.logProtocolDetected(ctx, conn, username, detected)
+			if detected == proxy.ProtocolPostgres {
+				s.servePostgresSession(r, wsConn, conn, initial)
+				return
+			}
+		case <-time.After(protocolDetectWait):
+			pendingFirst = first
+		}
+	}
 
 	// Connect to backend target service
 	targetAddr := fmt.Sprintf("%s:%d", conn.Config.Host, conn.Config.Port)
-	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
+	targetConn, selection, err := proxy.DialBackendSelection(conn.Config, 10*time.Second)
 	if err != nil {
-		_ = audit.Log(s.config.Logging.AuditLogPath, username, "backend_connect_failed", conn.Config.Name, map[string]interface{}{
+		event := "backend_connect_failed"
+		if errors.Is(err, proxy.ErrBackendTLS) {
+			event = "backend_tls_error"
+		}
+		s.connLogger(conn).Warn("backend connect failed", "target", targetAddr, "error", err)
+		tracing.Fail(span, err)
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, event, conn.Config.Name, map[string]interface{}{
 			"connection_id": connectionID,
 			"target":        targetAddr,
 			"error":         err.Error(),
@@ -114,10 +227,16 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer func() { _ = targetConn.Close() }()
+	backendAddr := proxy.ResolvedBackendAddr(targetConn)
+	conn.SetBackendAddr(backendAddr)
+	proxy.LogBackendSelection(s.config.Logging.AuditLogPath, username, conn.Config.Name, connectionID, selection)
 
-	// Set deadline based on connection expiry
-	timeUntilExpiry := time.Until(conn.ExpiresAt)
-	_ = targetConn.SetDeadline(conn.ExpiresAt)
+	// Register the backend stream so the idle timeout can close it
+	conn.RegisterStream(targetConn)
+	defer conn.UnregisterStream(targetConn)
+
+	// Set deadline based on connection expiry, following any extension
+	conn.FollowExpiry(targetConn)
 
 	// Create capture buffers to record traffic (max 10KB per direction)
 	maxCaptureSize := 10 * 1024
@@ -128,28 +247,66 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 	done := make(chan error, 2)
 	disconnectReason := "client_disconnect"
 
+	// The expiry warning is written from a timer, so WebSocket writes are serialized
+	var writeMu sync.Mutex
+	stopWarning := proxy.WatchExpiryWarning(conn, s.config.Logging.AuditLogPath, username, conn.Config.Name, connectionID, "websocket_text",
+		func(message string) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return wsConn.WriteMessage(websocket.TextMessage, []byte(message))
+		})
+	defer stopWarning()
+
 	// WebSocket → Backend (CLI sends data to backend)
+	forward := func(data []byte) error {
+		conn.Touch()
+
+		// Capture traffic for audit
+		requestSize += len(data)
+		if len(requestData) < maxCaptureSize {
+			requestData = append(requestData, data...)
+			if len(requestData) > maxCaptureSize {
+				requestData = requestData[:maxCaptureSize]
+			}
+		}
+
+		// Enforce max_bytes_in before anything reaches the backend
+		if err := conn.AddBytesIn(len(data)); err != nil {
+			return err
+		}
+
+		// Forward to backend
+		_, err := targetConn.Write(data)
+		return err
+	}
 	go func() {
+		// The message read while detecting the protocol goes first
+		if pendingFirst != nil {
+			msg := <-pendingFirst
+			if msg.err != nil {
+				done <- msg.err
+				return
+			}
+			initial = msg.data
+		}
+		if initial != nil {
+			if err := forward(initial); err != nil {
+				done <- err
+				return
+			}
+		}
+
 		for {
 			messageType, data, err := wsConn.ReadMessage()
 			if err != nil {
 				done <- err
 				return
 			}
+			extendReadDeadline(wsConn)
 
 			// Only process binary messages
 			if messageType == websocket.BinaryMessage {
-				// Capture traffic for audit
-				requestSize += len(data)
-				if len(requestData) < maxCaptureSize {
-					requestData = append(requestData, data...)
-					if len(requestData) > maxCaptureSize {
-						requestData = requestData[:maxCaptureSize]
-					}
-				}
-
-				// Forward to backend
-				if _, err := targetConn.Write(data); err != nil {
+				if err := forward(data); err != nil {
 					done <- err
 					return
 				}
@@ -158,6 +315,7 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Backend → WebSocket (backend sends data back to CLI)
+	sniffBackend := pendingFirst != nil
 	go func() {
 		buf := make([]byte, 32768) // 32KB buffer
 		for {
@@ -167,6 +325,24 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			// The client waited for the server to speak first
+			if sniffBackend {
+				sniffBackend = false
+				detected := ""
+				if proxy.IsMySQLGreeting(buf[:n]) {
+					detected = proxy.ProtocolMySQL
+				}
+				s.logProtocolDetected(ctx, conn, username, detected)
+			}
+
+			conn.Touch()
+
+			// Enforce max_bytes_out before anything reaches the client
+			if err := conn.AddBytesOut(n); err != nil {
+				done <- err
+				return
+			}
+
 			// Capture traffic for audit
 			responseSize += n
 			if len(responseData) < maxCaptureSize {
@@ -177,55 +353,97 @@ func (s *Server) handleProxyStream(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Forward to CLI via WebSocket
-			if err := wsConn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+			writeMu.Lock()
+			err = wsConn.WriteMessage(websocket.BinaryMessage, buf[:n])
+			writeMu.Unlock()
+			if err != nil {
 				done <- err
 				return
 			}
 		}
 	}()
 
-	// Wait for one direction to finish, or timeout
-	select {
-	case err1 := <-done:
-		// One direction finished, close connections
-		_ = targetConn.Close()
-		_ = wsConn.Close()
-
-		// Wait for the other goroutine to finish
-		<-done
-
-		// Determine disconnect reason from error
-		if err1 != nil && err1 != io.EOF {
-			if websocket.IsUnexpectedCloseError(err1, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-				disconnectReason = "websocket_error"
+	// Wait for one direction to finish, or the connection to expire
+	expiry := time.NewTimer(time.Until(conn.ExpiresAt()))
+	defer expiry.Stop()
+	for waiting := true; waiting; {
+		select {
+		case err1 := <-done:
+			// One direction finished, close connections
+			waiting = false
+			_ = targetConn.Close()
+			writeMu.Lock()
+			if errors.Is(err1, proxy.ErrQuotaExceeded) {
+				_ = wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Byte quota exceeded"))
 			} else {
-				disconnectReason = "backend_error"
+				// A normal close tells the CLI the stream ended, so it does not reconnect
+				_ = wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			}
+			writeMu.Unlock()
+			_ = wsConn.Close()
+
+			// Wait for the other goroutine to finish
+			<-done
+
+			// Determine disconnect reason from error
+			if errors.Is(err1, proxy.ErrQuotaExceeded) {
+				disconnectReason = "quota_exceeded"
+			} else if conn.IsIdle(time.Now()) {
+				disconnectReason = "idle_timeout"
+			} else if err1 != nil && err1 != io.EOF {
+				if websocket.IsUnexpectedCloseError(err1, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+					disconnectReason = "websocket_error"
+				} else {
+					disconnectReason = "backend_error"
+				}
 			}
-		}
-
-	case <-time.After(timeUntilExpiry):
-		// Connection expired - server-enforced timeout
-		disconnectReason = "timeout"
-
-		// Close connections to terminate goroutines
-		_ = targetConn.Close()
-		_ = wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Connection expired"))
-		_ = wsConn.Close()
 
-		// Wait for both goroutines to finish
-		<-done
-		<-done
+		case <-conn.Extended():
+			// Connection extended - wait for the new expiry and tell the CLI
+			expiresAt := conn.ExpiresAt()
+			expiry.Reset(time.Until(expiresAt))
+			notice, _ := json.Marshal(tunnelNotice{Type: "connection_extended", ExpiresAt: expiresAt})
+			writeMu.Lock()
+			_ = wsConn.WriteMessage(websocket.TextMessage, notice)
+			writeMu.Unlock()
+
+		case <-expiry.C:
+			// Connection expired - server-enforced timeout
+			waiting = false
+			disconnectReason = "timeout"
+
+			// Close connections to terminate goroutines
+			_ = targetConn.Close()
+			writeMu.Lock()
+			_ = wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Connection expired"))
+			writeMu.Unlock()
+			_ = wsConn.Close()
+
+			// Wait for both goroutines to finish
+			<-done
+			<-done
+		}
 	}
 
+	s.connLogger(conn).Debug("tunnel session closed",
+		"reason", disconnectReason,
+		"backend_addr", backendAddr,
+		"bytes_in", conn.BytesIn(),
+		"bytes_out", conn.BytesOut())
+
 	// Log session with captured traffic
-	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_session_websocket", conn.Config.Name, map[string]interface{}{
+	span.SetAttributes(attribute.String("disconnect_reason", disconnectReason))
+	_ = audit.Log(s.config.Logging.AuditLogPath, username, "proxy_session_websocket", conn.Config.Name, tracing.Annotate(ctx, map[string]interface{}{
 		"connection_id":    connectionID,
 		"reason":           disconnectReason,
+		"backend_addr":     backendAddr,
 		"request_size":     requestSize,
 		"response_size":    responseSize,
+		"bytes_in":         conn.BytesIn(),
+		"bytes_out":        conn.BytesOut(),
 		"request_preview":  truncateData(requestData, 500),
 		"response_preview": truncateData(responseData, 500),
-	})
+	}))
 }
 
 // handlePostgresWebSocket handles PostgreSQL connections via WebSocket with protocol-aware parsing
@@ -239,7 +457,7 @@ func (s *Server) handlePostgresWebSocket(w http.ResponseWriter, r *http.Request)
 	conn, _ := s.connMgr.GetConnection(connectionID)
 
 	// Get whitelist for this user's roles
-	whitelist := s.authz.GetWhitelistForConnection(roles, conn.Config.Name)
+	whitelist := s.connectionAuthz(conn).GetWhitelistForConnection(roles, conn.Config.Name)
 
 	// Log audit event
 	_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_connect_websocket", conn.Config.Name, map[string]interface{}{
@@ -247,11 +465,13 @@ func (s *Server) handlePostgresWebSocket(w http.ResponseWriter, r *http.Request)
 		"method":          r.Method,
 		"roles":           roles,
 		"whitelist_rules": len(whitelist),
+		"explain_preview": isExplainPreviewRequest(r),
 	})
 
 	// Upgrade HTTP connection to WebSocket
-	wsConn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := s.upgradeTunnel(w, r)
 	if err != nil {
+		s.connLogger(conn).Warn("websocket upgrade failed", "error", err)
 		_ = audit.Log(s.config.Logging.AuditLogPath, username, "websocket_upgrade_failed", conn.Config.Name, map[string]interface{}{
 			"connection_id": connectionID,
 			"error":         err.Error(),
@@ -260,12 +480,25 @@ func (s *Server) handlePostgresWebSocket(w http.ResponseWriter, r *http.Request)
 	}
 	defer func() { _ = wsConn.Close() }()
 
-	// Setup ping/pong keepalive
-	_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	wsConn.SetPongHandler(func(string) error {
-		_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
+	// Usage banner consent must be given before any traffic flows
+	if !s.awaitBannerAck(wsConn, conn, username) {
+		return
+	}
+
+	// Keep the tunnel alive in both directions (server pings, CLI pings and traffic)
+	stopKeepalive := s.startWebSocketKeepalive(wsConn)
+	defer stopKeepalive()
+
+	s.servePostgresSession(r, wsConn, conn, nil)
+}
+
+// servePostgresSession runs a Postgres session over an upgraded WebSocket through the
+// protocol-aware proxy. initial holds client bytes already read from the WebSocket, if any.
+func (s *Server) servePostgresSession(r *http.Request, wsConn *websocket.Conn, conn *proxy.Connection, initial []byte) {
+	username := r.Context().Value(ContextKeyUsername).(string)
+	roles, _ := r.Context().Value(ContextKeyRoles).([]string)
+	connectionID := conn.ID
+	whitelist := s.connectionAuthz(conn).GetWhitelistForConnection(roles, conn.Config.Name)
 
 	// Create Postgres proxy with protocol-aware query logging and security
 	pgProxy := proxy.NewPostgresAuthProxy(
@@ -282,29 +515,67 @@ func (s *Server) handlePostgresWebSocket(w http.ResponseWriter, r *http.Request)
 		pgProxy.SetApprovalManager(s.approvalMgr)
 	}
 
+	// Resolve whitelist patterns per query from the connection's current policy
+	pgProxy.SetWhitelistSource(conn)
+
+	// Restrict operations per table when the matching policies define table_permissions
+	pgProxy.SetTablePermissions(s.connectionAuthz(conn).GetTablePermissionsForConnection(roles, conn.Config.Name))
+
+	// COPY FROM/TO only in the directions the matching policies allow
+	pgProxy.SetCopyDirections(s.connectionAuthz(conn).GetCopyDirectionsForConnection(roles, conn.Config.Name))
+
+	// EXPLAIN preview mode (already validated against connection config)
+	pgProxy.SetExplainOnly(isExplainPreviewRequest(r))
+
+	// Read-only mode: set on the connection or through one of the user's read_only_roles
+	pgProxy.SetReadOnly(s.connectionAuthz(conn).IsReadOnlyForConnection(roles, conn.Config.Name))
+
+	// Whitelist-only connections reject stacked statements unless turned off
+	pgProxy.SetBlockMultiStatement(s.blockMultiStatement())
+
+	// Oversized queries are rejected instead of buffered
+	pgProxy.SetMaxRequestBytes(s.maxRequestBytes(conn.Config))
+
+	// Approvers see the reason the user gave when connecting
+	pgProxy.SetConnectReason(conn.Reason())
+
+	// Sessions use the database the user picked when connecting, if any
+	pgProxy.SetDatabase(conn.Database())
+
+	// Warn the client with a NoticeResponse shortly before the connection expires
+	pgProxy.SetExpiry(conn)
+
 	// Create a virtual connection that wraps WebSocket
 	// This allows the PostgresAuthProxy to work with WebSocket instead of raw TCP
 	wsNetConn := &websocketConn{
-		ws:   wsConn,
-		done: make(chan struct{}),
+		ws:     wsConn,
+		done:   make(chan struct{}),
+		buffer: initial,
 	}
 	defer func() {
 		// Safe close - won't panic if already closed
 		_ = wsNetConn.Close()
 	}()
 
+	// Register the stream so idle and expired connections can be torn down
+	conn.RegisterStream(wsNetConn)
+	defer conn.UnregisterStream(wsNetConn)
+
 	// Handle the Postgres protocol connection through WebSocket
-	if err := pgProxy.HandleConnection(wsNetConn); err != nil {
-		if err != io.EOF {
-			_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_error", conn.Config.Name, map[string]interface{}{
-				"connection_id": connectionID,
-				"error":         err.Error(),
-			})
-		}
+	err := pgProxy.HandleConnection(proxy.TrackActivity(wsNetConn, conn))
+	conn.SetBackendAddr(pgProxy.BackendAddr())
+	if err != nil && err != io.EOF {
+		s.connLogger(conn).Warn("postgres session failed", "error", err, "backend_addr", pgProxy.BackendAddr())
+		_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_error", conn.Config.Name, map[string]interface{}{
+			"connection_id": connectionID,
+			"error":         err.Error(),
+			"backend_addr":  pgProxy.BackendAddr(),
+		})
 	}
 
 	_ = audit.Log(s.config.Logging.AuditLogPath, username, "postgres_disconnect_websocket", conn.Config.Name, map[string]interface{}{
 		"connection_id": connectionID,
+		"backend_addr":  pgProxy.BackendAddr(),
 	})
 }
 
@@ -320,7 +591,7 @@ func (s *Server) handleHTTPWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, _ := s.connMgr.GetConnection(connectionID)
 
 	// Get whitelist for this user's roles
-	whitelist := s.authz.GetWhitelistForConnection(roles, conn.Config.Name)
+	whitelist := s.connectionAuthz(conn).GetWhitelistForConnection(roles, conn.Config.Name)
 
 	// Log audit event
 	_ = audit.Log(s.config.Logging.AuditLogPath, username, "http_connect_websocket", conn.Config.Name, map[string]interface{}{
@@ -331,8 +602,9 @@ func (s *Server) handleHTTPWebSocket(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Upgrade HTTP connection to WebSocket
-	wsConn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := s.upgradeTunnel(w, r)
 	if err != nil {
+		s.connLogger(conn).Warn("websocket upgrade failed", "error", err)
 		_ = audit.Log(s.config.Logging.AuditLogPath, username, "websocket_upgrade_failed", conn.Config.Name, map[string]interface{}{
 			"connection_id": connectionID,
 			"error":         err.Error(),
@@ -341,12 +613,14 @@ func (s *Server) handleHTTPWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = wsConn.Close() }()
 
-	// Setup ping/pong keepalive
-	_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	wsConn.SetPongHandler(func(string) error {
-		_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
+	// Usage banner consent must be given before any traffic flows
+	if !s.awaitBannerAck(wsConn, conn, username) {
+		return
+	}
+
+	// Keep the tunnel alive in both directions (server pings, CLI pings and traffic)
+	stopKeepalive := s.startWebSocketKeepalive(wsConn)
+	defer stopKeepalive()
 
 	// Create HTTP proxy with whitelist and approval support
 	httpProxy := conn.Proxy
@@ -370,9 +644,15 @@ func (s *Server) handleHTTPWebSocket(w http.ResponseWriter, r *http.Request) {
 		_ = wsNetConn.Close()
 	}()
 
+	// Register the stream so idle and expired connections can be torn down
+	conn.RegisterStream(wsNetConn)
+	defer conn.UnregisterStream(wsNetConn)
+
 	// Process HTTP requests from WebSocket stream
 	// Similar to handleHTTPProxyStream but over WebSocket
-	if err := s.handleHTTPOverWebSocket(wsNetConn, httpProxy, username, conn, connectionID); err != nil {
+	// Request spans join the stream's trace but must not be cancelled with the upgraded request
+	streamCtx := proxy.WithClientScheme(context.WithoutCancel(r.Context()), clientScheme(r, s.trustedProxies))
+	if err := s.handleHTTPOverWebSocket(streamCtx, wsNetConn, httpProxy, username, conn, connectionID, clientRemoteAddr(r, s.trustedProxies)); err != nil {
 		if err != io.EOF {
 			_ = audit.Log(s.config.Logging.AuditLogPath, username, "http_error", conn.Config.Name, map[string]interface{}{
 				"connection_id": connectionID,
@@ -388,17 +668,24 @@ func (s *Server) handleHTTPWebSocket(w http.ResponseWriter, r *http.Request) {
 
 // handleHTTPOverWebSocket processes HTTP requests from a WebSocket connection
 // This enables approval and whitelist checks for HTTP traffic
-func (s *Server) handleHTTPOverWebSocket(wsNetConn *websocketConn, httpProxy proxy.Protocol, username string, conn *proxy.Connection, connectionID string) error {
+func (s *Server) handleHTTPOverWebSocket(ctx context.Context, wsNetConn *websocketConn, httpProxy proxy.Protocol, username string, conn *proxy.Connection, connectionID, remoteAddr string) error {
 	// Create combined reader/writer for HTTP parsing
 	reader := bufio.NewReader(wsNetConn)
 	writer := bufio.NewWriter(wsNetConn)
 	bufrw := bufio.NewReadWriter(reader, writer)
 
-	for time.Now().Before(conn.ExpiresAt) {
+	for time.Now().Before(conn.ExpiresAt()) {
 		// Check if connection expired handled by loop condition
 
 		// Read HTTP request from WebSocket
-		requestBytes, err := readHTTPRequestFromStream(reader)
+		requestBytes, err := readHTTPRequestFromStream(reader, s.maxRequestBytes(conn.Config))
+		var tooLarge *proxy.RequestTooLargeError
+		if errors.As(err, &tooLarge) {
+			proxy.LogRequestTooLarge(s.config.Logging.AuditLogPath, username, conn.Config.Name, connectionID, "http", tooLarge, nil)
+			proxy.WriteRequestTooLarge(&streamResponseWriter{writer: bufrw, header: make(http.Header)}, tooLarge)
+			_ = bufrw.Flush()
+			break
+		}
 		if err != nil {
 			if err != io.EOF && !strings.Contains(err.Error(), "use of closed") {
 				return err
@@ -406,6 +693,8 @@ func (s *Server) handleHTTPOverWebSocket(wsNetConn *websocketConn, httpProxy pro
 			break
 		}
 
+		conn.Touch()
+
 		// Parse HTTP request
 		reqReader := bufio.NewReader(bytes.NewReader(requestBytes))
 		httpReq, err := http.ReadRequest(reqReader)
@@ -417,8 +706,13 @@ func (s *Server) handleHTTPOverWebSocket(wsNetConn *websocketConn, httpProxy pro
 		}
 
 		// Create synthetic request for proxy handler
-		proxyReq := httptest.NewRequest("POST", "/", bytes.NewReader(requestBytes))
+		reqCtx, reqSpan := tracing.Start(ctx, "proxy.http.request",
+			attribute.String("connection_id", connectionID),
+			attribute.String("http.method", httpReq.Method),
+			attribute.String("url.path", httpReq.URL.Path))
+		proxyReq := httptest.NewRequest("POST", "/", bytes.NewReader(requestBytes)).WithContext(reqCtx)
 		proxyReq.Header.Set("Content-Type", "application/octet-stream")
+		proxyReq.RemoteAddr = remoteAddr // The CLI's address, forwarded to backends with forwarded_headers
 
 		// Create response writer that writes back to WebSocket
 		respWriter := &streamResponseWriter{
@@ -428,7 +722,12 @@ func (s *Server) handleHTTPOverWebSocket(wsNetConn *websocketConn, httpProxy pro
 
 		// Call HTTP proxy's HandleRequest (this checks approval + whitelist)
 		err = httpProxy.HandleRequest(respWriter, proxyReq)
+		if err != nil {
+			tracing.Fail(reqSpan, err)
+		}
+		reqSpan.End()
 		_ = bufrw.Flush()
+		conn.Touch()
 
 		if err != nil {
 			break
@@ -444,7 +743,7 @@ func (s *Server) handleHTTPOverWebSocket(wsNetConn *websocketConn, httpProxy pro
 }
 
 // readHTTPRequestFromStream reads a complete HTTP request from a stream
-func readHTTPRequestFromStream(reader *bufio.Reader) ([]byte, error) {
+func readHTTPRequestFromStream(reader *bufio.Reader, limit int64) ([]byte, error) {
 	var buffer bytes.Buffer
 
 	// Peek to see if there's data
@@ -455,7 +754,7 @@ func readHTTPRequestFromStream(reader *bufio.Reader) ([]byte, error) {
 
 	// Read request line and headers
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := readHeaderLine(reader, int64(buffer.Len()), limit)
 		if err != nil {
 			return nil, err
 		}
@@ -474,8 +773,11 @@ func readHTTPRequestFromStream(reader *bufio.Reader) ([]byte, error) {
 			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "content-length:") {
 				parts := strings.SplitN(line, ":", 2)
 				if len(parts) == 2 {
-					var contentLength int
+					var contentLength int64
 					_, _ = fmt.Sscanf(strings.TrimSpace(parts[1]), "%d", &contentLength)
+					if size := int64(buffer.Len()) + contentLength; limit > 0 && size > limit {
+						return nil, &proxy.RequestTooLargeError{Size: size, Limit: limit}
+					}
 
 					if contentLength > 0 {
 						body := make([]byte, contentLength)
@@ -517,6 +819,7 @@ func (c *websocketConn) Read(b []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
+		extendReadDeadline(c.ws)
 
 		// Only process binary messages (skip ping/pong/text)
 		if messageType == websocket.BinaryMessage {
@@ -545,6 +848,8 @@ func (c *websocketConn) Close() error {
 	var err error
 	c.closeOnce.Do(func() {
 		close(c.done)
+		// A normal close tells the CLI the stream ended, so it does not reconnect
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
 		err = c.ws.Close()
 	})
 	return err
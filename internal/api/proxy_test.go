@@ -1,14 +1,22 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/auth"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/proxy"
 )
 
 func TestHandleProxyStream_PostgresConnection(t *testing.T) {
@@ -385,3 +393,128 @@ func BenchmarkHandleProxyStream(b *testing.B) {
 		server.router.ServeHTTP(proxyW, proxyReq)
 	}
 }
+
+func TestKafkaStreamFromHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Kafka-Broker", "2")
+	h.Set("X-Kafka-Bootstrap", "localhost:9092")
+	h.Set("X-Kafka-Listeners", "1=localhost:9093, 2=localhost:9094")
+
+	stream, err := kafkaStreamFromHeaders(h)
+	if err != nil {
+		t.Fatalf("kafkaStreamFromHeaders() error = %v", err)
+	}
+	if stream.BrokerID != 2 || stream.Bootstrap != "localhost:9092" {
+		t.Errorf("stream = %+v, want broker 2 behind localhost:9092", stream)
+	}
+	if stream.Listeners[1] != "localhost:9093" || stream.Listeners[2] != "localhost:9094" {
+		t.Errorf("listeners = %v, want brokers 1 and 2", stream.Listeners)
+	}
+
+	if stream, err := kafkaStreamFromHeaders(http.Header{}); err != nil || stream.BrokerID != -1 {
+		t.Errorf("kafkaStreamFromHeaders(no headers) = %+v, %v, want the bootstrap broker", stream, err)
+	}
+
+	h.Set("X-Kafka-Listeners", "localhost:9093")
+	if _, err := kafkaStreamFromHeaders(h); err == nil {
+		t.Error("kafkaStreamFromHeaders() with a malformed listener succeeded")
+	}
+}
+
+func TestReadHTTPRequest_MaxRequestBytes(t *testing.T) {
+	small := "GET /api/users HTTP/1.1\r\nHost: api\r\n\r\n"
+	withBody := "POST /api/users HTTP/1.1\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("x", 100)
+	longHeader := "GET / HTTP/1.1\r\nX-Padding: " + strings.Repeat("x", 10000) + "\r\n\r\n"
+
+	for _, read := range []func(*bufio.Reader, int64) ([]byte, error){readHTTPRequest, readHTTPRequestFromStream} {
+		if got, err := read(bufio.NewReader(strings.NewReader(small)), 64); err != nil || string(got) != small {
+			t.Errorf("read(small) = %q, %v, want the request", got, err)
+		}
+
+		_, err := read(bufio.NewReader(strings.NewReader(withBody)), 64)
+		var tooLarge *proxy.RequestTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Size != int64(len(withBody)) || tooLarge.AtLeast {
+			t.Errorf("read(large body) error = %v, want the exact request size", err)
+		}
+
+		_, err = read(bufio.NewReader(strings.NewReader(longHeader)), 1024)
+		if !errors.As(err, &tooLarge) || !tooLarge.AtLeast || tooLarge.Size > 8192 {
+			t.Errorf("read(long header) error = %v, want it cut off near the limit", err)
+		}
+
+		if got, err := read(bufio.NewReader(strings.NewReader(withBody)), 0); err != nil || string(got) != withBody {
+			t.Errorf("read(unlimited) = %q, %v", got, err)
+		}
+	}
+}
+
+func TestHandleHTTPProxyStream_ForwardedProtoFromTLSClient(t *testing.T) {
+	protos := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.Header.Get("X-Forwarded-Proto")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	server, err := NewServer(&config.Config{
+		Server: config.ServerConfig{Port: 8080, MaxConnectionDuration: time.Hour},
+		Auth:   config.AuthConfig{JWTSecret: "test-secret", TokenExpiry: time.Hour},
+		Connections: []config.ConnectionConfig{
+			{Name: "test-http", Type: "http", Host: "127.0.0.1", Port: port, Scheme: "http", Tags: []string{"env:test"}, ForwardedHeaders: true},
+		},
+		Policies: []config.RolePolicy{
+			{Name: "dev", Roles: []string{"developer"}, Tags: []string{"env:test"}, Whitelist: []string{".*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.connMgr.CloseAll()
+	token, _, err := server.authSvc.generateToken(&auth.UserInfo{Username: "alice", Roles: []string{"developer"}})
+	if err != nil {
+		t.Fatalf("generateToken() error = %v", err)
+	}
+
+	connectReq := httptest.NewRequest("POST", "/api/connect/test-http", nil)
+	connectReq.Header.Set("Authorization", "Bearer "+token)
+	connectW := httptest.NewRecorder()
+	server.router.ServeHTTP(connectW, connectReq)
+	if connectW.Code != http.StatusOK {
+		t.Fatalf("connect: status = %d, body: %s", connectW.Code, connectW.Body.String())
+	}
+	var connected ConnectResponse
+	_ = json.NewDecoder(connectW.Body).Decode(&connected)
+
+	// The client reaches the API over TLS; the stream's requests must say so to the backend
+	api := httptest.NewTLSServer(server.router)
+	defer api.Close()
+	client, err := tls.Dial("tcp", api.Listener.Addr().String(), api.Client().Transport.(*http.Transport).TLSClientConfig)
+	if err != nil {
+		t.Fatalf("tls.Dial() error = %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	_, _ = fmt.Fprintf(client, "POST /api/proxy/%s HTTP/1.1\r\nHost: api\r\nAuthorization: Bearer %s\r\n\r\n", connected.ConnectionID, token)
+	reader := bufio.NewReader(client)
+	established, err := http.ReadResponse(reader, nil)
+	if err != nil || established.StatusCode != http.StatusOK {
+		t.Fatalf("stream: response = %v, error = %v", established, err)
+	}
+
+	_, _ = fmt.Fprintf(client, "GET /hello HTTP/1.1\r\nHost: api.internal\r\n\r\n")
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("proxied request: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	select {
+	case proto := <-protos:
+		if proto != "https" {
+			t.Errorf("X-Forwarded-Proto = %q, want https", proto)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend never received the proxied request")
+	}
+}
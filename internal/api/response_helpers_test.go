@@ -43,19 +43,21 @@ func TestRespondError_StatusCodes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			respondError(w, tt.statusCode, tt.message)
+			respondError(w, tt.statusCode, ErrCodeInternal, tt.message)
 
 			if w.Code != tt.statusCode {
 				t.Errorf("status code = %d, want %d", w.Code, tt.statusCode)
 			}
 
-			var response map[string]string
+			var response struct {
+				Error apiError `json:"error"`
+			}
 			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 				t.Fatalf("Failed to decode response: %v", err)
 			}
 
-			if response["error"] != tt.message {
-				t.Errorf("error message = %s, want %s", response["error"], tt.message)
+			if response.Error.Message != tt.message {
+				t.Errorf("error message = %s, want %s", response.Error.Message, tt.message)
 			}
 
 			// Check content type
@@ -149,13 +151,15 @@ func TestRespondJSON_ComplexData(t *testing.T) {
 
 func TestRespondError_EmptyMessage(t *testing.T) {
 	w := httptest.NewRecorder()
-	respondError(w, http.StatusBadRequest, "")
+	respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "")
 
-	var response map[string]string
+	var response struct {
+		Error apiError `json:"error"`
+	}
 	_ = json.NewDecoder(w.Body).Decode(&response)
 
-	if response["error"] != "" {
-		t.Errorf("Empty error message should be preserved, got %s", response["error"])
+	if response.Error.Message != "" || response.Error.Code != ErrCodeInvalidRequest {
+		t.Errorf("Empty error message should be preserved, got %+v", response.Error)
 	}
 }
 
@@ -181,7 +185,7 @@ func BenchmarkRespondError(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
-		respondError(w, http.StatusBadRequest, "test error")
+		respondError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "test error")
 	}
 }
 
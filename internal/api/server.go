@@ -2,16 +2,27 @@ package api
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/approval"
 	"github.com/davidcohan/port-authorizing/internal/audit"
 	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/geoip"
+	"github.com/davidcohan/port-authorizing/internal/logging"
 	"github.com/davidcohan/port-authorizing/internal/proxy"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/gorilla/mux"
 )
 
@@ -26,6 +37,13 @@ type Server struct {
 	authSvc        *AuthService
 	authz          *authorization.Authorizer
 	approvalMgr    *approval.Manager
+	geoIP          geoip.CountryLookup
+	trustedProxies []*net.IPNet
+	logger         *slog.Logger // Operational log (audit events go through the audit package)
+	readiness      *readinessChecker
+	startedAt      time.Time    // Reported as uptime in the system status
+	logins         atomic.Int64 // Successful logins since startedAt
+	loginThrottle  *loginThrottle
 }
 
 // NewServer creates a new API server instance
@@ -36,6 +54,10 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		memoryMB = 1 // Default to 1MB
 	}
 	audit.ConfigureMemoryBuffer(memoryMB)
+	audit.ConfigureFileRotation(cfg.Logging.AuditMaxMB, cfg.Logging.AuditMaxBackups, cfg.Logging.AuditCompress)
+	audit.ConfigureDecisionLog(cfg.Logging.DecisionLogPath, cfg.Logging.DecisionLogRetentionDays)
+	audit.ConfigureResourceMetadata(connectionAuditMetadata(cfg))
+	audit.ConfigureRedactions(auditRedactions(cfg))
 
 	// Initialize storage backend
 	storageBackend, err := config.NewStorageBackend(cfg.Storage)
@@ -49,30 +71,19 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	}
 
 	// Initialize approval manager
-	approvalMgr := approval.NewManager(5 * time.Minute) // Default 5 minute timeout
-
-	// Configure approval providers if enabled
-	if cfg.Approval != nil && cfg.Approval.Enabled {
-		if cfg.Approval.Webhook != nil && cfg.Approval.Webhook.URL != "" {
-			webhookProvider := approval.NewWebhookProvider(cfg.Approval.Webhook.URL)
-			approvalMgr.RegisterProvider(webhookProvider)
-		}
+	approvalMgr, err := newApprovalManager(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-		if cfg.Approval.Slack != nil && cfg.Approval.Slack.WebhookURL != "" {
-			slackProvider := approval.NewSlackProvider(
-				cfg.Approval.Slack.WebhookURL,
-				cfg.Server.BaseURL,
-			)
-			approvalMgr.RegisterProvider(slackProvider)
-		}
+	trustedProxies, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
-		// Add approval patterns
-		for _, pattern := range cfg.Approval.Patterns {
-			timeout := time.Duration(pattern.TimeoutSeconds) * time.Second
-			if err := approvalMgr.AddApprovalPattern(pattern.Pattern, pattern.Tags, pattern.TagMatch, timeout); err != nil {
-				return nil, fmt.Errorf("failed to add approval pattern: %w", err)
-			}
-		}
+	geoIP, err := newGeoIPLookup(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	s := &Server{
@@ -83,12 +94,64 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		authSvc:        authSvc,
 		authz:          authorization.NewAuthorizer(cfg),
 		approvalMgr:    approvalMgr,
+		geoIP:          geoIP,
+		trustedProxies: trustedProxies,
+		logger:         logging.Component("api"),
+		readiness:      newReadinessChecker(),
+		startedAt:      time.Now(),
+		loginThrottle:  newLoginThrottle(cfg.Auth.Lockout),
 	}
+	s.connMgr.SetDefaultIdleTimeout(cfg.Server.IdleTimeout)
+	s.connMgr.SetDefaultByteQuotas(cfg.Server.MaxBytesIn, cfg.Server.MaxBytesOut)
 
 	s.setupRoutes()
 	return s, nil
 }
 
+// auditRedactions compiles the configured audit redaction rules; invalid patterns are
+// skipped (Validate reports them)
+func auditRedactions(cfg *config.Config) []audit.Redaction {
+	rules := make([]audit.Redaction, 0, len(cfg.Security.AuditRedactions))
+	for _, rule := range cfg.Security.AuditRedactions {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil || rule.Pattern == "" {
+			continue
+		}
+		rules = append(rules, audit.Redaction{
+			Pattern:     pattern,
+			Replacement: rule.Replacement,
+			Resources:   rule.Connections,
+		})
+	}
+	return rules
+}
+
+// connectionAuditMetadata collects the metadata merged into each connection's audit entries:
+// that of the policies whose tags match the connection (earlier policies win), overridden
+// by the connection's own metadata
+func connectionAuditMetadata(cfg *config.Config) map[string]map[string]string {
+	metadata := make(map[string]map[string]string)
+	for _, conn := range cfg.Connections {
+		merged := make(map[string]string)
+		for i := len(cfg.Policies) - 1; i >= 0; i-- {
+			policy := cfg.Policies[i]
+			if len(policy.Tags) == 0 || len(conn.Tags) == 0 || !config.MatchTags(policy.Tags, policy.TagMatch, conn.Tags).Matched {
+				continue
+			}
+			for key, value := range policy.Metadata {
+				merged[key] = value
+			}
+		}
+		for key, value := range conn.Metadata {
+			merged[key] = value
+		}
+		if len(merged) > 0 {
+			metadata[conn.Name] = merged
+		}
+	}
+	return metadata
+}
+
 // ReloadConfig reloads the configuration and updates server components
 // while preserving existing connections
 func (s *Server) ReloadConfig(newCfg *config.Config) error {
@@ -101,6 +164,13 @@ func (s *Server) ReloadConfig(newCfg *config.Config) error {
 		memoryMB = 1 // Default to 1MB
 	}
 	audit.ConfigureMemoryBuffer(memoryMB)
+	audit.ConfigureFileRotation(newCfg.Logging.AuditMaxMB, newCfg.Logging.AuditMaxBackups, newCfg.Logging.AuditCompress)
+	audit.ConfigureDecisionLog(newCfg.Logging.DecisionLogPath, newCfg.Logging.DecisionLogRetentionDays)
+	audit.ConfigureResourceMetadata(connectionAuditMetadata(newCfg))
+	audit.ConfigureRedactions(auditRedactions(newCfg))
+	if err := logging.SetLevel(newCfg.Logging.LogLevel); err != nil {
+		return err
+	}
 
 	// Recreate auth service
 	authSvc, err := NewAuthService(newCfg)
@@ -112,39 +182,227 @@ func (s *Server) ReloadConfig(newCfg *config.Config) error {
 	authz := authorization.NewAuthorizer(newCfg)
 
 	// Recreate approval manager
-	approvalMgr := approval.NewManager(5 * time.Minute)
-	if newCfg.Approval != nil && newCfg.Approval.Enabled {
-		if newCfg.Approval.Webhook != nil && newCfg.Approval.Webhook.URL != "" {
-			webhookProvider := approval.NewWebhookProvider(newCfg.Approval.Webhook.URL)
-			approvalMgr.RegisterProvider(webhookProvider)
-		}
+	approvalMgr, err := newApprovalManager(newCfg)
+	if err != nil {
+		return err
+	}
 
-		if newCfg.Approval.Slack != nil && newCfg.Approval.Slack.WebhookURL != "" {
-			slackProvider := approval.NewSlackProvider(
-				newCfg.Approval.Slack.WebhookURL,
-				newCfg.Server.BaseURL,
-			)
-			approvalMgr.RegisterProvider(slackProvider)
-		}
+	trustedProxies, err := parseTrustedProxies(newCfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
 
-		for _, pattern := range newCfg.Approval.Patterns {
-			timeout := time.Duration(pattern.TimeoutSeconds) * time.Second
-			if err := approvalMgr.AddApprovalPattern(pattern.Pattern, pattern.Tags, pattern.TagMatch, timeout); err != nil {
-				return fmt.Errorf("failed to add approval pattern: %w", err)
-			}
+	// Reopen GeoIP database only if the path changed
+	geoIP := s.geoIP
+	if newCfg.Security.GeoIPDatabase != s.config.Security.GeoIPDatabase {
+		geoIP, err = newGeoIPLookup(newCfg)
+		if err != nil {
+			return err
+		}
+		if closer, ok := s.geoIP.(io.Closer); ok {
+			_ = closer.Close()
 		}
 	}
 
 	// Update server fields
 	// Note: We intentionally preserve connMgr to keep existing connections alive
+	s.connMgr.SetDefaultIdleTimeout(newCfg.Server.IdleTimeout)
+	s.loginThrottle.Configure(newCfg.Auth.Lockout)
+	s.connMgr.SetDefaultByteQuotas(newCfg.Server.MaxBytesIn, newCfg.Server.MaxBytesOut)
 	s.config = newCfg
 	s.authSvc = authSvc
 	s.authz = authz
+	if s.approvalMgr != nil {
+		s.approvalMgr.Close() // Forget cached approvals made under the old config
+	}
 	s.approvalMgr = approvalMgr
+	s.geoIP = geoIP
+	s.trustedProxies = trustedProxies
+
+	// Existing sessions follow the new policy: revoked ones are drained,
+	// the rest get the new whitelist in place
+	revoked := s.connMgr.ApplyPolicyChange(authz, newCfg.Logging.AuditLogPath)
+	s.logger.Info("configuration reloaded",
+		"connections", len(newCfg.Connections),
+		"policies", len(newCfg.Policies),
+		"revoked_connections", revoked)
 
 	return nil
 }
 
+// approvalCallbackSecret derives the approve/reject link key from the JWT secret,
+// so it is the same on every replica without being the JWT secret itself
+func approvalCallbackSecret(jwtSecret string) string {
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte("port-authorizing approval callbacks"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newGeoIPLookup opens the configured GeoIP database, or returns nil if none is configured
+func newGeoIPLookup(cfg *config.Config) (geoip.CountryLookup, error) {
+	if cfg.Security.GeoIPDatabase == "" {
+		return nil, nil
+	}
+
+	resolver, err := geoip.Open(cfg.Security.GeoIPDatabase)
+	if err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+// newApprovalManager creates an approval manager with the providers and patterns from config
+func newApprovalManager(cfg *config.Config) (*approval.Manager, error) {
+	approvalMgr := approval.NewManager(5 * time.Minute) // Default 5 minute timeout
+
+	if cfg.Approval == nil || !cfg.Approval.Enabled {
+		return approvalMgr, nil
+	}
+
+	// Audit every retried delivery to a provider
+	auditLogPath := cfg.Logging.AuditLogPath
+	retryHook := func(provider string, req *approval.Request, attempt int, delay time.Duration, err error) {
+		username, resource := "system", ""
+		metadata := map[string]interface{}{
+			"provider": provider,
+			"attempt":  attempt,
+			"delay":    delay.String(),
+			"error":    err.Error(),
+		}
+		if req != nil {
+			username, resource = req.Username, req.Metadata["connection_name"]
+			if resource == "" {
+				resource = req.ConnectionID
+			}
+			metadata["request_id"] = req.ID
+		}
+		_ = audit.Log(auditLogPath, username, "approval_delivery_retry", resource, metadata)
+	}
+
+	if cfg.Approval.Webhook != nil && cfg.Approval.Webhook.URL != "" {
+		webhookProvider := approval.NewWebhookProvider(cfg.Approval.Webhook.URL, cfg.Approval.Webhook.Secret)
+		if cfg.Approval.Webhook.Template != "" {
+			if err := webhookProvider.SetTemplate(cfg.Approval.Webhook.Template); err != nil {
+				return nil, err
+			}
+		}
+		webhookProvider.SetRetry(deliveryRetryPolicy(cfg.Approval.Webhook.Retry), retryHook)
+		approvalMgr.RegisterProvider(webhookProvider)
+	}
+
+	// The shared secret also signs the approve/reject links sent through every channel
+	if cfg.Approval.Webhook != nil && cfg.Approval.Webhook.Secret != "" {
+		approvalMgr.SetCallbackSecret(cfg.Approval.Webhook.Secret)
+	}
+
+	// Replicas sharing pending requests must verify each other's links: without a
+	// webhook secret, sign them with a key derived from the JWT secret
+	if store := cfg.Approval.Store; store != nil && store.Type == "redis" {
+		redisStore, err := approval.NewRedisStore(*store.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create approval store: %w", err)
+		}
+		approvalMgr.SetStore(redisStore)
+		if cfg.Approval.Webhook == nil || cfg.Approval.Webhook.Secret == "" {
+			approvalMgr.SetCallbackSecret(approvalCallbackSecret(cfg.Auth.JWTSecret))
+		}
+	}
+
+	if cfg.Approval.Slack != nil && cfg.Approval.Slack.WebhookURL != "" {
+		slackProvider := approval.NewSlackProvider(
+			cfg.Approval.Slack.WebhookURL,
+			cfg.Server.BaseURL,
+		)
+		if cfg.Approval.Slack.Template != "" {
+			if err := slackProvider.SetTemplate(cfg.Approval.Slack.Template); err != nil {
+				return nil, err
+			}
+		}
+		slackProvider.SetRetry(deliveryRetryPolicy(cfg.Approval.Slack.Retry), retryHook)
+		approvalMgr.RegisterProvider(slackProvider)
+	}
+
+	if cfg.Approval.Email != nil && cfg.Approval.Email.SMTPHost != "" {
+		emailProvider, err := approval.NewEmailProvider(*cfg.Approval.Email, cfg.Server.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create email approval provider: %w", err)
+		}
+		approvalMgr.RegisterProvider(emailProvider)
+	}
+
+	// Add approval patterns
+	for i, pattern := range cfg.Approval.Patterns {
+		timeout := time.Duration(pattern.TimeoutSeconds) * time.Second
+		if err := approvalMgr.AddApprovalPattern(pattern.Pattern, pattern.Tags, pattern.TagMatch, timeout, pattern.RequiredApprovals); err != nil {
+			return nil, fmt.Errorf("failed to add approval pattern: %w", err)
+		}
+
+		if pattern.ApprovalCacheSeconds > 0 {
+			window := time.Duration(pattern.ApprovalCacheSeconds) * time.Second
+			if err := approvalMgr.SetPatternApprovalCache(i, window); err != nil {
+				return nil, fmt.Errorf("failed to add approval cache: %w", err)
+			}
+		}
+
+		if pattern.Escalation != nil && pattern.Escalation.PagerDuty != nil {
+			escalator, err := approval.NewPagerDutyEscalator(*pattern.Escalation.PagerDuty, cfg.Server.BaseURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create approval escalation: %w", err)
+			}
+			after := time.Duration(pattern.Escalation.AfterSeconds) * time.Second
+			if err := approvalMgr.SetPatternEscalation(i, after, escalator); err != nil {
+				return nil, fmt.Errorf("failed to add approval escalation: %w", err)
+			}
+		}
+	}
+
+	// Audit every escalation attempt
+	approvalMgr.SetEscalationHook(func(req *approval.Request, escalation *approval.Escalation, err error) {
+		resource := req.Metadata["connection_name"]
+		if resource == "" {
+			resource = req.ConnectionID
+		}
+		metadata := map[string]interface{}{
+			"request_id": req.ID,
+			"method":     req.Method,
+			"path":       req.Path,
+			"provider":   escalation.Escalator.GetProviderName(),
+			"after":      escalation.After.String(),
+			"delivered":  err == nil,
+		}
+		if err != nil {
+			metadata["error"] = err.Error()
+		}
+		_ = audit.Log(auditLogPath, req.Username, "approval_escalated", resource, metadata)
+	})
+
+	// Audit requests approved from the approval cache (no one was asked)
+	approvalMgr.SetCachedApprovalHook(func(req *approval.Request, response *approval.Response) {
+		resource := req.Metadata["connection_name"]
+		if resource == "" {
+			resource = req.ConnectionID
+		}
+		_ = audit.Log(auditLogPath, req.Username, "approval_cached", resource, map[string]interface{}{
+			"request_id":    req.ID,
+			"connection_id": req.ConnectionID,
+			"method":        req.Method,
+			"path":          req.Path,
+			"approved_by":   response.ApprovedBy,
+			"reason":        response.Reason,
+		})
+	})
+
+	return approvalMgr, nil
+}
+
+// deliveryRetryPolicy converts a provider's retry settings (nil = defaults)
+func deliveryRetryPolicy(retry *config.DeliveryRetryConfig) approval.RetryPolicy {
+	if retry == nil {
+		return approval.RetryPolicy{}
+	}
+	return approval.RetryPolicy{MaxAttempts: retry.MaxAttempts, BaseDelay: retry.BaseDelay}
+}
+
 // GetConfig returns the current configuration (thread-safe)
 func (s *Server) GetConfig() *config.Config {
 	s.configMu.RLock()
@@ -161,11 +419,15 @@ func (s *Server) LoadConfigFromStorage() (*config.Config, error) {
 func (s *Server) setupRoutes() {
 	// Apply CORS middleware to all routes (allow all origins)
 	s.router.Use(s.corsMiddleware)
+	// Continue traces started by clients (traceparent header); a no-op unless tracing is configured
+	s.router.Use(tracing.Middleware)
 
 	// Public routes
 	s.router.HandleFunc("/api/info", s.handleServerInfo).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/login", s.handleLogin).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/api/health", s.handleHealth).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/health/ready", s.handleReady).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
 
 	// OIDC authentication routes (public)
 	s.router.HandleFunc("/api/auth/oidc/ws", s.handleOIDCWebSocket).Methods("GET")
@@ -176,12 +438,16 @@ func (s *Server) setupRoutes() {
 	api := s.router.PathPrefix("/api").Subrouter()
 	api.Use(s.authMiddleware)
 	api.HandleFunc("/connections", s.handleListConnections).Methods("GET", "OPTIONS")
+	api.HandleFunc("/connections/{name}/policy", s.handleGetConnectionPolicy).Methods("GET", "OPTIONS")
 	api.HandleFunc("/connect/{name}", s.handleConnect).Methods("POST", "OPTIONS")
+	api.HandleFunc("/connect/{connectionID}/extend", s.handleExtendConnection).Methods("POST", "OPTIONS")
+	api.HandleFunc("/token/refresh", s.handleRefreshToken).Methods("POST", "OPTIONS")
 
 	// Transparent proxy endpoint - accepts TCP connection and forwards to target
 	api.HandleFunc("/proxy/{connectionID}", s.handleProxyStream).Methods("POST", "GET", "PUT", "DELETE", "CONNECT", "PATCH", "OPTIONS")
 
-	// Approval endpoints (can be accessed via webhook callbacks, so don't require auth)
+	// Approval endpoints: authenticated by the signed link token or an admin JWT in the handlers,
+	// since notification links are opened without an API token
 	s.router.HandleFunc("/api/approvals/{request_id}/approve", s.handleApproveRequest).Methods("GET", "POST", "OPTIONS")
 	s.router.HandleFunc("/api/approvals/{request_id}/reject", s.handleRejectRequest).Methods("GET", "POST", "OPTIONS")
 
@@ -195,12 +461,15 @@ func (s *Server) setupRoutes() {
 	// Configuration management
 	adminAPI.HandleFunc("/config", s.handleGetConfig).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/config", s.handleUpdateConfig).Methods("PUT", "OPTIONS")
+	adminAPI.HandleFunc("/config/validate", s.handleValidateConfig).Methods("POST", "OPTIONS")
 	adminAPI.HandleFunc("/config/versions", s.handleListConfigVersions).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/config/versions/{id}", s.handleGetConfigVersion).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/config/rollback/{id}", s.handleRollbackConfig).Methods("POST", "OPTIONS")
 
 	// Connection management
 	adminAPI.HandleFunc("/connections", s.handleListAllConnections).Methods("GET", "OPTIONS")
+	adminAPI.HandleFunc("/connections/active", s.handleListActiveConnections).Methods("GET", "OPTIONS")
+	adminAPI.HandleFunc("/connections/active/{id}", s.handleKillConnection).Methods("DELETE", "OPTIONS")
 	adminAPI.HandleFunc("/connections", s.handleCreateConnection).Methods("POST", "OPTIONS")
 	adminAPI.HandleFunc("/connections/{name}", s.handleUpdateConnection).Methods("PUT", "OPTIONS")
 	adminAPI.HandleFunc("/connections/{name}", s.handleDeleteConnection).Methods("DELETE", "OPTIONS")
@@ -214,6 +483,7 @@ func (s *Server) setupRoutes() {
 	// Policy management
 	adminAPI.HandleFunc("/policies", s.handleListPolicies).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/policies", s.handleCreatePolicy).Methods("POST", "OPTIONS")
+	adminAPI.HandleFunc("/policies/simulate", s.handleSimulatePolicies).Methods("POST", "OPTIONS")
 	adminAPI.HandleFunc("/policies/{name}", s.handleUpdatePolicy).Methods("PUT", "OPTIONS")
 	adminAPI.HandleFunc("/policies/{name}", s.handleDeletePolicy).Methods("DELETE", "OPTIONS")
 
@@ -222,8 +492,10 @@ func (s *Server) setupRoutes() {
 
 	// Approval management
 	adminAPI.HandleFunc("/approvals", s.handleGetApprovalConfig).Methods("GET", "OPTIONS")
+	adminAPI.HandleFunc("/approvals/history", s.handleGetApprovalHistory).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/approvals/enabled", s.handleUpdateApprovalEnabled).Methods("PUT", "OPTIONS")
 	adminAPI.HandleFunc("/approvals/providers", s.handleUpdateApprovalProviders).Methods("PUT", "OPTIONS")
+	adminAPI.HandleFunc("/approvals/test", s.handleTestApprovalProviders).Methods("POST", "OPTIONS")
 	adminAPI.HandleFunc("/approvals/patterns", s.handleCreateApprovalPattern).Methods("POST", "OPTIONS")
 	adminAPI.HandleFunc("/approvals/patterns/{index}", s.handleUpdateApprovalPattern).Methods("PUT", "OPTIONS")
 	adminAPI.HandleFunc("/approvals/patterns/{index}", s.handleDeleteApprovalPattern).Methods("DELETE", "OPTIONS")
@@ -231,6 +503,7 @@ func (s *Server) setupRoutes() {
 	// Audit logs
 	adminAPI.HandleFunc("/audit/logs", s.handleGetAuditLogs).Methods("GET", "OPTIONS")
 	adminAPI.HandleFunc("/audit/stats", s.handleGetAuditStats).Methods("GET", "OPTIONS")
+	adminAPI.HandleFunc("/audit/export", s.handleExportAuditLogs).Methods("GET", "OPTIONS")
 
 	// System status
 	adminAPI.HandleFunc("/status", s.handleGetSystemStatus).Methods("GET", "OPTIONS")
@@ -252,7 +525,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS, CONNECT")
 
 		// Allow common headers
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin, If-Match")
 
 		// Allow credentials
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -261,7 +534,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		// Expose custom headers to JavaScript
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, Authorization, ETag")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -275,29 +548,65 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.config.Server.Port),
-		Handler:      s.router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
+	s.httpServer = newHTTPServer(s.config.Server, s.router)
 	return s.httpServer.ListenAndServe()
 }
 
+// HTTP server defaults, used when server.http leaves a setting at 0
+const (
+	defaultHTTPReadTimeout  = 15 * time.Second
+	defaultHTTPWriteTimeout = 15 * time.Second
+	defaultHTTPIdleTimeout  = 60 * time.Second
+)
+
+// newHTTPServer builds the API server with the server.http timeouts and header limit.
+// The write timeout only bounds regular responses: proxy handlers that hijack the
+// connection replace the server's deadlines with the proxy connection's expiry, and
+// WebSocket upgrades clear them, so long-lived sessions are not cut off.
+func newHTTPServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:           fmt.Sprintf(":%d", cfg.Port),
+		Handler:        handler,
+		ReadTimeout:    cfg.HTTP.ReadTimeout,
+		WriteTimeout:   cfg.HTTP.WriteTimeout,
+		IdleTimeout:    cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes: cfg.HTTP.MaxHeaderBytes, // 0 = http.DefaultMaxHeaderBytes
+	}
+	if server.ReadTimeout == 0 {
+		server.ReadTimeout = defaultHTTPReadTimeout
+	}
+	if server.WriteTimeout == 0 {
+		server.WriteTimeout = defaultHTTPWriteTimeout
+	}
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = defaultHTTPIdleTimeout
+	}
+	return server
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Close all active connections
+	s.logger.Info("closing active connections", "active_connections", s.connMgr.GetActiveConnections())
 	s.connMgr.CloseAll()
 
 	return s.httpServer.Shutdown(ctx)
 }
 
+// connLogger returns the server logger tagged with a proxy connection and its owner
+func (s *Server) connLogger(conn *proxy.Connection) *slog.Logger {
+	return s.logger.With("connection_id", conn.ID, "username", conn.Username, "connection", conn.Config.Name)
+}
+
 // handleHealth returns server health status
+// With ?deep=true it also checks backend reachability, like /api/health/ready.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("deep") == "true" {
+		s.handleReady(w, r)
+		return
+	}
 	respondJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
 }
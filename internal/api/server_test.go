@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -199,3 +200,24 @@ func BenchmarkNewServer(b *testing.B) {
 		_, _ = NewServer(cfg)
 	}
 }
+
+func TestNewHTTPServer_Limits(t *testing.T) {
+	defaults := newHTTPServer(config.ServerConfig{Port: 8080}, http.NotFoundHandler())
+	if defaults.Addr != ":8080" || defaults.ReadTimeout != 15*time.Second || defaults.WriteTimeout != 15*time.Second ||
+		defaults.IdleTimeout != 60*time.Second || defaults.MaxHeaderBytes != 0 {
+		t.Errorf("defaults: addr=%s read=%v write=%v idle=%v header=%d", defaults.Addr, defaults.ReadTimeout,
+			defaults.WriteTimeout, defaults.IdleTimeout, defaults.MaxHeaderBytes)
+	}
+
+	configured := newHTTPServer(config.ServerConfig{Port: 8080, HTTP: config.HTTPServerConfig{
+		ReadTimeout:    5 * time.Minute,
+		WriteTimeout:   10 * time.Minute,
+		IdleTimeout:    2 * time.Minute,
+		MaxHeaderBytes: 64 << 10,
+	}}, http.NotFoundHandler())
+	if configured.ReadTimeout != 5*time.Minute || configured.WriteTimeout != 10*time.Minute ||
+		configured.IdleTimeout != 2*time.Minute || configured.MaxHeaderBytes != 64<<10 {
+		t.Errorf("configured: read=%v write=%v idle=%v header=%d", configured.ReadTimeout,
+			configured.WriteTimeout, configured.IdleTimeout, configured.MaxHeaderBytes)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// storageReloadDebounce is how long the storage must stay quiet before an external
+// change is applied, so a burst of edits causes a single reload
+const storageReloadDebounce = 2 * time.Second
+
+// WatchStorage reloads the configuration whenever the storage backend reports a
+// change made outside this server (kubectl edit, another replica's admin API, ...).
+// It returns when ctx is done.
+func (s *Server) WatchStorage(ctx context.Context) {
+	s.watchStorage(ctx, s.storageBackend.Watch(ctx), storageReloadDebounce)
+}
+
+func (s *Server) watchStorage(ctx context.Context, updates <-chan *config.Config, debounce time.Duration) {
+	var pending *config.Config
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cfg, ok := <-updates:
+			if !ok {
+				return
+			}
+			// Keep only the latest change and restart the quiet period
+			pending = cfg
+			timer.Reset(debounce)
+		case <-timer.C:
+			if pending != nil {
+				s.applyStorageChange(pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+// applyStorageChange validates and reloads a configuration read from storage,
+// ignoring it if it matches the running one (such as this server's own saves)
+func (s *Server) applyStorageChange(newCfg *config.Config) {
+	before := s.GetConfig()
+	if sameConfig(before, newCfg) {
+		return
+	}
+
+	auditLogPath := before.Logging.AuditLogPath
+	if err := config.Validate(newCfg); err != nil {
+		s.logger.Warn("ignoring invalid configuration from storage", "error", err)
+		_ = audit.Log(auditLogPath, "system", "config_reload_external_failed", "config", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := s.ReloadConfig(newCfg); err != nil {
+		s.logger.Warn("failed to reload configuration from storage", "error", err)
+		_ = audit.Log(auditLogPath, "system", "config_reload_external_failed", "config", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	changed := make([]string, 0)
+	for name := range diffFields(toFieldMap(before), toFieldMap(newCfg), nil) {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	_ = audit.Log(newCfg.Logging.AuditLogPath, "system", "config_reloaded_external", "config", map[string]interface{}{
+		"changed_sections": changed,
+	})
+}
+
+// sameConfig reports whether two configurations would be stored identically
+func sameConfig(a, b *config.Config) bool {
+	aData, err := yaml.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bData, err := yaml.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestWatchStorage_DebouncesExternalChanges(t *testing.T) {
+	defer audit.Close()
+	server := newAdminTestServer(t)
+	auditPath := t.TempDir() + "/audit.log"
+	server.GetConfig().Logging.AuditLogPath = auditPath
+
+	withPort := func(port int) *config.Config {
+		cfg := *server.GetConfig()
+		cfg.Server.Port = port
+		return &cfg
+	}
+
+	updates := make(chan *config.Config)
+	done := make(chan struct{})
+	go func() {
+		server.watchStorage(context.Background(), updates, 50*time.Millisecond)
+		close(done)
+	}()
+
+	// The running config (e.g. this server's own save) is not reloaded
+	updates <- withPort(8080)
+	time.Sleep(150 * time.Millisecond)
+	if entries, _ := audit.Query(auditPath, audit.Filter{Action: "config_reloaded_external"}); len(entries) != 0 {
+		t.Fatalf("unchanged config audited as reloaded: %+v", entries)
+	}
+
+	// A burst of edits applies only the last one
+	updates <- withPort(9001)
+	updates <- withPort(9002)
+	updates <- withPort(9003)
+	time.Sleep(150 * time.Millisecond)
+
+	if port := server.GetConfig().Server.Port; port != 9003 {
+		t.Errorf("port after reload = %d, want 9003", port)
+	}
+	entries, _ := audit.Query(auditPath, audit.Filter{Action: "config_reloaded_external"})
+	if len(entries) != 1 || entries[0].Username != "system" {
+		t.Fatalf("audit entries = %+v, want one external reload", entries)
+	}
+	if changed, _ := entries[0].Metadata["changed_sections"].([]interface{}); len(changed) != 1 || changed[0] != "Server" {
+		t.Errorf("changed sections = %v, want [Server]", entries[0].Metadata["changed_sections"])
+	}
+
+	// An invalid edit is rejected and the running config kept
+	invalid := withPort(9004)
+	invalid.Auth.JWTSecret = ""
+	updates <- invalid
+	time.Sleep(150 * time.Millisecond)
+	if port := server.GetConfig().Server.Port; port != 9003 {
+		t.Errorf("port after invalid edit = %d, want 9003", port)
+	}
+	if entries, _ := audit.Query(auditPath, audit.Filter{Action: "config_reload_external_failed"}); len(entries) != 1 {
+		t.Errorf("failed reload audit entries = %+v, want one", entries)
+	}
+
+	close(updates)
+	<-done
+}
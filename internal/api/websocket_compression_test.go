@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+// sampleQueryResult is a text-heavy result set like a SELECT over a users table
+func sampleQueryResult() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "D|%d|user%d|user%d@example.com|active|2024-01-%02d 10:00:00+00\n", i, i, i, i%28+1)
+	}
+	return b.Bytes()
+}
+
+// countingConn counts the bytes read from the network
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// startCompressionTunnel serves tunnels that send payload once and then echo messages
+func startCompressionTunnel(t testing.TB, serverCompression bool, payload []byte) string {
+	t.Helper()
+	server := &Server{config: &config.Config{
+		Server: config.ServerConfig{WebSocketCompression: serverCompression},
+	}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := server.upgradeTunnel(w, r)
+		if err != nil {
+			return
+		}
+		defer func() { _ = wsConn.Close() }()
+		stop := server.startWebSocketKeepalive(wsConn)
+		defer stop()
+
+		if err := wsConn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+			return
+		}
+		for {
+			messageType, data, err := wsConn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := wsConn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dialCompressionTunnel dials the tunnel, counting the bytes received into read
+func dialCompressionTunnel(t testing.TB, url string, clientCompression bool, read *atomic.Int64) (*websocket.Conn, *http.Response) {
+	t.Helper()
+	dialer := websocket.Dialer{
+		EnableCompression: clientCompression,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, read: read}, nil
+		},
+	}
+	conn, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	return conn, resp
+}
+
+func TestUpgradeTunnel_Compression(t *testing.T) {
+	payload := sampleQueryResult()
+
+	tests := []struct {
+		name              string
+		serverCompression bool
+		clientCompression bool
+		wantNegotiated    bool
+	}{
+		{"both enabled", true, true, true},
+		{"server disabled", false, true, false},
+		{"client did not ask", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := startCompressionTunnel(t, tt.serverCompression, payload)
+			var read atomic.Int64
+			conn, resp := dialCompressionTunnel(t, url, tt.clientCompression, &read)
+			defer func() { _ = conn.Close() }()
+
+			negotiated := strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+			if negotiated != tt.wantNegotiated {
+				t.Fatalf("permessage-deflate negotiated = %v, want %v", negotiated, tt.wantNegotiated)
+			}
+
+			// Binary framing is unchanged: the payload arrives intact in one message
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			messageType, data, err := conn.ReadMessage()
+			if err != nil || messageType != websocket.BinaryMessage || !bytes.Equal(data, payload) {
+				t.Fatalf("ReadMessage() = type %d, %d bytes, %v; want the %d-byte binary payload", messageType, len(data), err, len(payload))
+			}
+			if tt.wantNegotiated && read.Load() >= int64(len(payload))/2 {
+				t.Errorf("received %d bytes on the wire for a %d-byte payload, want it compressed", read.Load(), len(payload))
+			}
+			if !tt.wantNegotiated && read.Load() < int64(len(payload)) {
+				t.Errorf("received %d bytes on the wire for a %d-byte payload, want it uncompressed", read.Load(), len(payload))
+			}
+
+			// Pings are answered and client messages still round-trip
+			pongs := make(chan struct{}, 1)
+			conn.SetPongHandler(func(string) error {
+				pongs <- struct{}{}
+				return nil
+			})
+			if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+				t.Fatalf("WriteControl(ping) error = %v", err)
+			}
+			if err := conn.WriteMessage(websocket.BinaryMessage, []byte("SELECT 1")); err != nil {
+				t.Fatalf("WriteMessage() error = %v", err)
+			}
+			if _, data, err := conn.ReadMessage(); err != nil || string(data) != "SELECT 1" {
+				t.Fatalf("echo = %q, %v; want SELECT 1", data, err)
+			}
+			select {
+			case <-pongs:
+			default:
+				t.Error("no pong received for the ping")
+			}
+		})
+	}
+}
+
+// BenchmarkTunnelTransfer reports the bytes on the wire for a sample query result,
+// with and without compression
+func BenchmarkTunnelTransfer(b *testing.B) {
+	payload := sampleQueryResult()
+	for _, compressed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compressed=%t", compressed), func(b *testing.B) {
+			var read atomic.Int64
+			url := startCompressionTunnel(b, compressed, payload)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				conn, _ := dialCompressionTunnel(b, url, compressed, &read)
+				if _, _, err := conn.ReadMessage(); err != nil {
+					b.Fatalf("ReadMessage() error = %v", err)
+				}
+				_ = conn.Close()
+			}
+			b.ReportMetric(float64(read.Load())/float64(b.N), "wire-bytes/op")
+			b.ReportMetric(float64(len(payload)), "payload-bytes")
+		})
+	}
+}
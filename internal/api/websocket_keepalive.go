@@ -0,0 +1,69 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsReadTimeout matches the CLI's read deadline: a tunnel with no traffic,
+	// ping or pong for this long is considered dead
+	wsReadTimeout = 60 * time.Second
+
+	// defaultWebSocketPingInterval is used when server.websocket_ping_interval is unset
+	defaultWebSocketPingInterval = 30 * time.Second
+
+	// wsControlWriteTimeout bounds how long a ping or pong write may block
+	wsControlWriteTimeout = 10 * time.Second
+)
+
+// startWebSocketKeepalive keeps a tunnel alive through idle-sensitive load balancers.
+// The read deadline is extended by pings and pongs from the CLI (data frames extend it
+// in the read loops via extendReadDeadline), and the server pings the CLI every
+// server.websocket_ping_interval so the server→client direction never goes quiet.
+// The returned function stops the ping ticker.
+func (s *Server) startWebSocketKeepalive(wsConn *websocket.Conn) func() {
+	extendReadDeadline(wsConn)
+	wsConn.SetPongHandler(func(string) error {
+		extendReadDeadline(wsConn)
+		return nil
+	})
+	wsConn.SetPingHandler(func(data string) error {
+		extendReadDeadline(wsConn)
+		err := wsConn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(wsControlWriteTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	interval := s.config.Server.WebSocketPingInterval
+	if interval <= 0 {
+		interval = defaultWebSocketPingInterval
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// WriteControl is safe to call concurrently with the tunnel's data writes
+				if err := wsConn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsControlWriteTimeout)); err != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+// extendReadDeadline pushes the tunnel's read deadline out after any received traffic
+func extendReadDeadline(wsConn *websocket.Conn) {
+	_ = wsConn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+}
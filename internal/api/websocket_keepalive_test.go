@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+func TestStartWebSocketKeepalive(t *testing.T) {
+	server := &Server{config: &config.Config{
+		Server: config.ServerConfig{WebSocketPingInterval: 20 * time.Millisecond},
+	}}
+
+	pongs := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = wsConn.Close() }()
+		stop := server.startWebSocketKeepalive(wsConn)
+		defer stop()
+
+		// Control frames are processed while reading
+		wsConn.SetPongHandler(func(string) error {
+			extendReadDeadline(wsConn)
+			pongs <- struct{}{}
+			return nil
+		})
+		for {
+			if _, _, err := wsConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	pings := make(chan struct{}, 10)
+	client.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return client.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pings:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no server ping received (got %d)", i)
+		}
+	}
+	select {
+	case <-pongs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not receive the client's pong")
+	}
+}
@@ -2,12 +2,16 @@ package approval
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Decision represents an approval decision
@@ -29,6 +33,19 @@ type Request struct {
 	Body         string
 	RequestedAt  time.Time
 	Metadata     map[string]string
+	// Tags are the connection's tags, available to message templates
+	Tags []string
+	// RequiredApprovals is the number of distinct approvers needed (defaults to 1)
+	RequiredApprovals int
+	// Escalation pages an on-call engineer if the request is still undecided after a while (optional)
+	Escalation *Escalation `json:"-"`
+	// ApprovalCache auto-approves identical requests for this long once approved (0 = disabled)
+	ApprovalCache time.Duration
+	// ApproveToken and RejectToken sign the shared approve/reject links (set by the manager)
+	ApproveToken string
+	RejectToken  string
+	// signApprover returns the token of an approver's own link (set by the manager)
+	signApprover func(decision Decision, approver string) string
 }
 
 // Response represents an approval response
@@ -36,8 +53,27 @@ type Response struct {
 	RequestID   string
 	Decision    Decision
 	ApprovedBy  string
+	Approvers   []string // Distinct approvers recorded before the decision
 	Reason      string
 	RespondedAt time.Time
+	Channel     string        // Channel that returned the decision (slack, email, webhook, api)
+	Ledger      []LedgerEntry // Per-channel notification/response trail
+}
+
+// SubmitResult describes the state of a request after an approval is submitted
+type SubmitResult struct {
+	Approvals int  // Distinct approvals recorded so far
+	Required  int  // Approvals needed to reach quorum
+	Duplicate bool // Approver had already approved this request
+	Resolved  bool // Request reached a final decision
+}
+
+// Remaining returns how many more approvals are needed to reach quorum
+func (r *SubmitResult) Remaining() int {
+	if r.Resolved || r.Approvals >= r.Required {
+		return 0
+	}
+	return r.Required - r.Approvals
 }
 
 // Provider defines the interface for approval providers (Slack, webhook, etc)
@@ -49,26 +85,59 @@ type Provider interface {
 	GetProviderName() string
 }
 
+// Escalator pages someone about a request that is still pending (PagerDuty, etc)
+type Escalator interface {
+	// Escalate notifies the on-call engineer, including the approve/reject links
+	Escalate(ctx context.Context, req *Request) error
+
+	// GetProviderName returns the name of the escalation provider
+	GetProviderName() string
+}
+
+// Escalation triggers an escalator when a request has no decision after a delay
+type Escalation struct {
+	After     time.Duration
+	Escalator Escalator
+}
+
+// EscalationHook is called after each escalation attempt (e.g., for auditing); err is the delivery error, if any
+type EscalationHook func(req *Request, escalation *Escalation, err error)
+
 // Manager manages pending approval requests
 type Manager struct {
 	providers       []Provider
-	pendingRequests map[string]*pendingRequest
+	pendingRequests map[string]*pendingRequest // Requests this process is waiting on
+	store           Store                      // Pending state, shared between replicas
+	pollInterval    time.Duration              // How often waiters check the store for decisions
 	mu              sync.RWMutex
 	defaultTimeout  time.Duration
 	patterns        []*approvalPattern
+	history         []HistoryEntry
+	escalationHook  EscalationHook
+	cachedHook      CachedApprovalHook
+	approvalCache   map[string]*cachedApproval // Keyed by user, connection and request
+	cleanupOnce     sync.Once
+	stop            chan struct{}
+	closed          bool
+	callbackSecret  string // Signs approve/reject links
 }
 
+// pendingRequest is a request this process is waiting on; its approvals are in the store
 type pendingRequest struct {
 	Request  *Request
 	Response chan *Response
 	Timer    *time.Timer
+	Resolved bool // This process has taken the request's decision
 }
 
 type approvalPattern struct {
-	Pattern  *regexp.Regexp
-	Tags     []string
-	TagMatch string // "all" or "any"
-	Timeout  time.Duration
+	Pattern           *regexp.Regexp
+	Tags              []string
+	TagMatch          string // "all" or "any"
+	Timeout           time.Duration
+	RequiredApprovals int
+	Escalation        *Escalation
+	CacheWindow       time.Duration // Remember approvals for identical requests this long
 }
 
 // NewManager creates a new approval manager
@@ -80,8 +149,13 @@ func NewManager(defaultTimeout time.Duration) *Manager {
 	return &Manager{
 		providers:       []Provider{},
 		pendingRequests: make(map[string]*pendingRequest),
+		store:           newMemoryStore(),
+		pollInterval:    defaultStorePollInterval,
 		defaultTimeout:  defaultTimeout,
 		patterns:        []*approvalPattern{},
+		approvalCache:   make(map[string]*cachedApproval),
+		stop:            make(chan struct{}),
+		callbackSecret:  newCallbackSecret(),
 	}
 }
 
@@ -90,10 +164,31 @@ func (m *Manager) RegisterProvider(provider Provider) {
 	m.providers = append(m.providers, provider)
 }
 
+// HasProvider reports whether a provider or pattern escalator with the given name is registered
+func (m *Manager) HasProvider(name string) bool {
+	for _, provider := range m.providers {
+		if provider.GetProviderName() == name {
+			return true
+		}
+	}
+	for _, pattern := range m.patterns {
+		if pattern.Escalation != nil && pattern.Escalation.Escalator.GetProviderName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEscalationHook sets the function called after each escalation attempt
+func (m *Manager) SetEscalationHook(hook EscalationHook) {
+	m.escalationHook = hook
+}
+
 // AddApprovalPattern adds a pattern that requires approval
 // Pattern format: "^METHOD /path/pattern$"
 // Patterns are case-insensitive by default
-func (m *Manager) AddApprovalPattern(pattern string, tags []string, tagMatch string, timeout time.Duration) error {
+// requiredApprovals is the number of distinct approvers needed (0 or 1 = single approval)
+func (m *Manager) AddApprovalPattern(pattern string, tags []string, tagMatch string, timeout time.Duration, requiredApprovals int) error {
 	// Make pattern case-insensitive (like whitelist patterns)
 	re, err := regexp.Compile("(?i)" + pattern)
 	if err != nil {
@@ -108,22 +203,68 @@ func (m *Manager) AddApprovalPattern(pattern string, tags []string, tagMatch str
 		tagMatch = "all"
 	}
 
+	if requiredApprovals < 1 {
+		requiredApprovals = 1
+	}
+
 	m.patterns = append(m.patterns, &approvalPattern{
-		Pattern:  re,
-		Tags:     tags,
-		TagMatch: tagMatch,
-		Timeout:  timeout,
+		Pattern:           re,
+		Tags:              tags,
+		TagMatch:          tagMatch,
+		Timeout:           timeout,
+		RequiredApprovals: requiredApprovals,
 	})
 
 	return nil
 }
 
+// SetPatternEscalation escalates requests matching the pattern at index (in the order added)
+// to escalator when they are still undecided after the given delay
+func (m *Manager) SetPatternEscalation(index int, after time.Duration, escalator Escalator) error {
+	if index < 0 || index >= len(m.patterns) {
+		return fmt.Errorf("approval pattern %d does not exist", index)
+	}
+	if after <= 0 {
+		return fmt.Errorf("escalation delay must be positive")
+	}
+	m.patterns[index].Escalation = &Escalation{After: after, Escalator: escalator}
+	return nil
+}
+
 // RequiresApproval checks if a request requires approval
 // If connectionTags is nil or empty, only patterns without tags are considered
 func (m *Manager) RequiresApproval(method, path string, connectionTags []string) (bool, time.Duration) {
-	if len(m.patterns) == 0 {
+	pattern := m.matchPattern(method, path, connectionTags)
+	if pattern == nil {
 		return false, 0
 	}
+	return true, pattern.Timeout
+}
+
+// RequiredApprovals returns the number of distinct approvers needed for a request
+// Returns 1 if no pattern matches
+func (m *Manager) RequiredApprovals(method, path string, connectionTags []string) int {
+	pattern := m.matchPattern(method, path, connectionTags)
+	if pattern == nil {
+		return 1
+	}
+	return pattern.RequiredApprovals
+}
+
+// EscalationFor returns the escalation of the pattern matching a request, or nil
+func (m *Manager) EscalationFor(method, path string, connectionTags []string) *Escalation {
+	pattern := m.matchPattern(method, path, connectionTags)
+	if pattern == nil {
+		return nil
+	}
+	return pattern.Escalation
+}
+
+// matchPattern returns the first approval pattern matching the request, or nil
+func (m *Manager) matchPattern(method, path string, connectionTags []string) *approvalPattern {
+	if len(m.patterns) == 0 {
+		return nil
+	}
 
 	requestStr := fmt.Sprintf("%s %s", method, path)
 
@@ -135,16 +276,16 @@ func (m *Manager) RequiresApproval(method, path string, connectionTags []string)
 
 		// If pattern has no tags, it applies to all connections
 		if len(pattern.Tags) == 0 {
-			return true, pattern.Timeout
+			return pattern
 		}
 
 		// Check tag matching
 		if m.matchesTags(connectionTags, pattern.Tags, pattern.TagMatch) {
-			return true, pattern.Timeout
+			return pattern
 		}
 	}
 
-	return false, 0
+	return nil
 }
 
 // matchesTags checks if connection tags match the required tags
@@ -183,7 +324,35 @@ func (m *Manager) matchesTags(connectionTags, requiredTags []string, matchMode s
 }
 
 // RequestApproval sends an approval request to all providers and waits for a response
+// The wait is traced as an "approval.wait" span, a child of the span in ctx.
 func (m *Manager) RequestApproval(ctx context.Context, req *Request, timeout time.Duration) (*Response, error) {
+	ctx, span := tracing.Start(ctx, "approval.wait",
+		attribute.String("username", req.Username),
+		attribute.String("connection_id", req.ConnectionID),
+		attribute.String("http.method", req.Method),
+		attribute.String("url.path", req.Path))
+	defer span.End()
+
+	response, err := m.requestApproval(ctx, req, timeout)
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.String("approval.request_id", response.RequestID),
+		attribute.String("approval.decision", string(response.Decision)),
+		attribute.String("approval.channel", response.Channel))
+	return response, nil
+}
+
+func (m *Manager) requestApproval(ctx context.Context, req *Request, timeout time.Duration) (*Response, error) {
+	// An identical request was approved recently: don't ask again
+	if req.ApprovalCache > 0 {
+		if response := m.approveFromCache(req); response != nil {
+			return response, nil
+		}
+	}
+
 	if len(m.providers) == 0 {
 		return nil, fmt.Errorf("no approval providers configured")
 	}
@@ -191,6 +360,18 @@ func (m *Manager) RequestApproval(ctx context.Context, req *Request, timeout tim
 	// Generate unique request ID
 	req.ID = uuid.New().String()
 	req.RequestedAt = time.Now()
+	if req.RequiredApprovals < 1 {
+		req.RequiredApprovals = 1
+	}
+	m.signCallbacks(req)
+
+	// Store pending request, where any replica can record a decision
+	storeCtx, cancelStore := m.storeContext()
+	err := m.store.Put(storeCtx, &PendingState{Request: req}, timeout+storeTTLMargin)
+	cancelStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store approval request: %w", err)
+	}
 
 	// Create response channel
 	respChan := make(chan *Response, 1)
@@ -198,7 +379,6 @@ func (m *Manager) RequestApproval(ctx context.Context, req *Request, timeout tim
 	// Create timeout timer
 	timer := time.NewTimer(timeout)
 
-	// Store pending request
 	m.mu.Lock()
 	m.pendingRequests[req.ID] = &pendingRequest{
 		Request:  req,
@@ -213,75 +393,299 @@ func (m *Manager) RequestApproval(ctx context.Context, req *Request, timeout tim
 		delete(m.pendingRequests, req.ID)
 		m.mu.Unlock()
 		timer.Stop()
+
+		storeCtx, cancelStore := m.storeContext()
+		defer cancelStore()
+		_ = m.store.Delete(storeCtx, req.ID)
 	}()
 
-	// Send approval request to all providers
+	// Send approval request to all providers, recording each channel in the ledger.
+	// Providers retry failed deliveries, but never past the request's timeout.
+	sendCtx, cancelSend := context.WithTimeout(ctx, timeout)
+	defer cancelSend()
 	for _, provider := range m.providers {
-		if err := provider.SendApprovalRequest(ctx, req); err != nil {
+		entry := LedgerEntry{Channel: provider.GetProviderName()}
+		if err := provider.SendApprovalRequest(sendCtx, req); err != nil {
 			// Log error but continue with other providers
 			fmt.Printf("Error sending approval request to %s: %v\n", provider.GetProviderName(), err)
+			entry.Error = err.Error()
+		} else {
+			entry.DeliveredAt = time.Now()
 		}
+		m.appendLedger(req.ID, entry)
+	}
+
+	// Escalate if still undecided before the timeout
+	var escalate <-chan time.Time
+	if req.Escalation != nil && req.Escalation.After < timeout {
+		escalationTimer := time.NewTimer(req.Escalation.After)
+		defer escalationTimer.Stop()
+		escalate = escalationTimer.C
 	}
 
+	// Decisions recorded by other replicas are picked up from the store
+	poll := time.NewTicker(m.pollInterval)
+	defer poll.Stop()
+
 	// Wait for response or timeout
-	select {
-	case response := <-respChan:
-		return response, nil
-	case <-timer.C:
-		return &Response{
-			RequestID:   req.ID,
-			Decision:    DecisionTimeout,
-			Reason:      "approval request timed out",
-			RespondedAt: time.Now(),
-		}, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	for {
+		select {
+		case response := <-respChan:
+			return response, nil
+		case <-escalate:
+			escalate = nil
+			m.escalate(ctx, req)
+		case <-poll.C:
+			if response := m.storedOutcome(req); response != nil {
+				return response, nil
+			}
+		case <-timer.C:
+			// Timeout denies the whole request, even if some approvals were recorded
+			if response := m.resolveUnanswered(req, DecisionTimeout, "approval request timed out"); response != nil {
+				return response, nil
+			}
+			// A decision arrived at the same time as the timeout
+			return <-respChan, nil
+		case <-ctx.Done():
+			m.resolveUnanswered(req, DecisionTimeout, ctx.Err().Error())
+			return nil, ctx.Err()
+		}
 	}
 }
 
-// SubmitApproval processes an approval response (called by callback endpoints)
-func (m *Manager) SubmitApproval(requestID string, decision Decision, approvedBy, reason string) error {
-	m.mu.Lock()
-	pending, exists := m.pendingRequests[requestID]
-	m.mu.Unlock()
+// escalate triggers the request's escalator and records the attempt in the ledger
+func (m *Manager) escalate(ctx context.Context, req *Request) {
+	escalation := req.Escalation
+	entry := LedgerEntry{Channel: escalation.Escalator.GetProviderName()}
+	err := escalation.Escalator.Escalate(ctx, req)
+	if err != nil {
+		fmt.Printf("Error escalating approval request to %s: %v\n", entry.Channel, err)
+		entry.Error = err.Error()
+	} else {
+		entry.DeliveredAt = time.Now()
+	}
+	m.appendLedger(req.ID, entry)
 
-	if !exists {
-		return fmt.Errorf("approval request not found or already processed: %s", requestID)
+	m.mu.RLock()
+	hook := m.escalationHook
+	m.mu.RUnlock()
+
+	if hook != nil {
+		hook(req, escalation, err)
 	}
+}
 
+// resolveUnanswered resolves a request that received no final decision and records it in history
+// Returns nil if the request was already resolved by a decision submitted to this process;
+// a decision recorded by another replica in the meantime is returned instead.
+func (m *Manager) resolveUnanswered(req *Request, decision Decision, reason string) *Response {
 	response := &Response{
-		RequestID:   requestID,
+		RequestID:   req.ID,
 		Decision:    decision,
-		ApprovedBy:  approvedBy,
 		Reason:      reason,
 		RespondedAt: time.Now(),
 	}
 
-	// Send response (non-blocking)
-	select {
-	case pending.Response <- response:
+	var decided *Response
+	storeCtx, cancelStore := m.storeContext()
+	_, err := m.store.Update(storeCtx, req.ID, func(state *PendingState) error {
+		if state.Resolved {
+			decided = state.Outcome
+			return errAlreadyResolved
+		}
+		response.Approvers = append([]string(nil), state.Approvers...)
+		response.Ledger = append([]LedgerEntry(nil), state.Ledger...)
+		state.Resolved = true
+		state.Outcome = response
 		return nil
-	default:
-		return fmt.Errorf("failed to deliver approval response")
+	})
+	cancelStore()
+	if err != nil && decided != nil {
+		response = decided
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := m.pendingRequests[req.ID]
+	if pending.Resolved {
+		return nil
+	}
+	pending.Resolved = true
+	m.addHistory(req, response)
+
+	return response
+}
+
+// storedOutcome returns the decision recorded in the store by another replica, or nil
+// if there is none (or this process took the decision, which is in its response channel)
+func (m *Manager) storedOutcome(req *Request) *Response {
+	storeCtx, cancelStore := m.storeContext()
+	state, err := m.store.Get(storeCtx, req.ID)
+	cancelStore()
+	if err != nil || !state.Resolved || state.Outcome == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := m.pendingRequests[req.ID]
+	if pending.Resolved {
+		return nil
+	}
+	pending.Resolved = true
+	m.addHistory(req, state.Outcome)
+	return state.Outcome
+}
+
+// appendLedger records a notification or escalation attempt for a pending request
+func (m *Manager) appendLedger(requestID string, entry LedgerEntry) {
+	storeCtx, cancelStore := m.storeContext()
+	defer cancelStore()
+	_, _ = m.store.Update(storeCtx, requestID, func(state *PendingState) error {
+		state.Ledger = append(state.Ledger, entry)
+		return nil
+	})
+}
+
+// SubmitApproval processes an approval response (called by callback endpoints)
+// Approvals are counted per distinct approver until the request's quorum is reached.
+// Any single rejection resolves the request as rejected.
+func (m *Manager) SubmitApproval(requestID string, decision Decision, approvedBy, reason string) (*SubmitResult, error) {
+	return m.SubmitApprovalFrom(requestID, "api", decision, approvedBy, reason)
+}
+
+// SubmitApprovalFrom processes an approval response received through a specific channel
+// The decision is recorded in the store, so it reaches the waiting request even when
+// another replica holds it.
+func (m *Manager) SubmitApprovalFrom(requestID, channel string, decision Decision, approvedBy, reason string) (*SubmitResult, error) {
+	var result *SubmitResult
+	var response *Response
+	storeCtx, cancelStore := m.storeContext()
+	state, err := m.store.Update(storeCtx, requestID, func(state *PendingState) error {
+		if state.Resolved {
+			return errAlreadyResolved
+		}
+		var err error
+		result, response, err = state.apply(channel, decision, approvedBy, reason, time.Now())
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			state.Resolved = true
+			state.Outcome = response
+		}
+		return nil
+	})
+	cancelStore()
+	if errors.Is(err, ErrRequestNotFound) || errors.Is(err, errAlreadyResolved) {
+		return nil, fmt.Errorf("%w or already processed: %s", ErrRequestNotFound, requestID)
+	}
+	if errors.Is(err, ErrSelfApproval) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record approval decision: %w", err)
+	}
+	if response == nil {
+		return result, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Remember the approval for identical requests; a rejection forgets it
+	m.updateApprovalCache(state.Request, decision, state.Approvers)
+	result.Resolved = true
+
+	pending, local := m.pendingRequests[requestID]
+	if local {
+		if pending.Resolved {
+			return result, nil // The waiter already took the decision from the store
+		}
+		// Send response (non-blocking)
+		select {
+		case pending.Response <- response:
+			pending.Resolved = true
+		default:
+			return nil, fmt.Errorf("failed to deliver approval response")
+		}
+	}
+	m.addHistory(state.Request, response)
+	return result, nil
 }
 
 // GetPendingRequest retrieves a pending approval request by ID
 func (m *Manager) GetPendingRequest(requestID string) (*Request, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	storeCtx, cancelStore := m.storeContext()
+	defer cancelStore()
 
-	pending, exists := m.pendingRequests[requestID]
-	if !exists {
+	state, err := m.store.Get(storeCtx, requestID)
+	if err != nil {
 		return nil, fmt.Errorf("approval request not found: %s", requestID)
 	}
 
-	return pending.Request, nil
+	return state.Request, nil
 }
 
 // GetPendingRequestsCount returns the number of pending approval requests
 func (m *Manager) GetPendingRequestsCount() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return len(m.pendingRequests)
+	storeCtx, cancelStore := m.storeContext()
+	defer cancelStore()
+
+	states, err := m.store.List(storeCtx)
+	if err != nil {
+		return 0
+	}
+	return len(states)
+}
+
+// PendingEntry summarizes a request still awaiting a decision
+type PendingEntry struct {
+	RequestID         string            `json:"request_id"`
+	Username          string            `json:"username"`
+	ConnectionID      string            `json:"connection_id"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	RequestedAt       time.Time         `json:"requested_at"`
+	Approvals         int               `json:"approvals"`
+	RequiredApprovals int               `json:"required_approvals"`
+}
+
+// ListPendingRequests returns the requests still awaiting a decision, oldest first
+// Requests waited on by other replicas are included when the store is shared.
+func (m *Manager) ListPendingRequests() []PendingEntry {
+	storeCtx, cancelStore := m.storeContext()
+	defer cancelStore()
+
+	states, err := m.store.List(storeCtx)
+	if err != nil {
+		return []PendingEntry{}
+	}
+
+	result := make([]PendingEntry, 0, len(states))
+	for _, pending := range states {
+		if pending.Resolved {
+			continue
+		}
+		req := pending.Request
+		result = append(result, PendingEntry{
+			RequestID:         req.ID,
+			Username:          req.Username,
+			ConnectionID:      req.ConnectionID,
+			Method:            req.Method,
+			Path:              req.Path,
+			Metadata:          req.Metadata,
+			RequestedAt:       req.RequestedAt,
+			Approvals:         len(pending.Approvers),
+			RequiredApprovals: req.RequiredApprovals,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RequestedAt.Before(result[j].RequestedAt)
+	})
+	return result
 }
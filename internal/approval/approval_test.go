@@ -2,6 +2,9 @@ package approval
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -84,7 +87,7 @@ func TestManager_AddApprovalPattern(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mgr.AddApprovalPattern(tt.pattern, tt.tags, tt.tagMatch, tt.timeout)
+			err := mgr.AddApprovalPattern(tt.pattern, tt.tags, tt.tagMatch, tt.timeout, 0)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AddApprovalPattern() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -94,9 +97,9 @@ func TestManager_AddApprovalPattern(t *testing.T) {
 
 func TestManager_RequiresApproval(t *testing.T) {
 	mgr := NewManager(5 * time.Minute)
-	_ = mgr.AddApprovalPattern("^DELETE /.*", nil, "", 3*time.Minute)
-	_ = mgr.AddApprovalPattern("^POST /admin/.*", []string{"env:production"}, "all", 10*time.Minute)
-	_ = mgr.AddApprovalPattern("^PUT /.*", []string{"team:backend", "env:production"}, "any", 5*time.Minute)
+	_ = mgr.AddApprovalPattern("^DELETE /.*", nil, "", 3*time.Minute, 0)
+	_ = mgr.AddApprovalPattern("^POST /admin/.*", []string{"env:production"}, "all", 10*time.Minute, 0)
+	_ = mgr.AddApprovalPattern("^PUT /.*", []string{"team:backend", "env:production"}, "any", 5*time.Minute, 0)
 
 	tests := []struct {
 		name           string
@@ -258,7 +261,7 @@ func TestManager_SubmitApproval(t *testing.T) {
 	}
 
 	// Submit approval
-	err := mgr.SubmitApproval(requestID, DecisionApproved, "bob", "looks good")
+	_, err := mgr.SubmitApproval(requestID, DecisionApproved, "bob", "looks good")
 	if err != nil {
 		t.Fatalf("SubmitApproval() error = %v", err)
 	}
@@ -280,13 +283,169 @@ func TestManager_SubmitApproval(t *testing.T) {
 func TestManager_SubmitApproval_NotFound(t *testing.T) {
 	mgr := NewManager(5 * time.Minute)
 
-	err := mgr.SubmitApproval("nonexistent-id", DecisionApproved, "bob", "test")
+	_, err := mgr.SubmitApproval("nonexistent-id", DecisionApproved, "bob", "test")
 
 	if err == nil {
 		t.Error("SubmitApproval() expected error for nonexistent ID, got nil")
 	}
 }
 
+// startPendingApproval starts an approval request in the background and returns its ID
+func startPendingApproval(t *testing.T, mgr *Manager, req *Request, timeout time.Duration) (string, chan *Response) {
+	t.Helper()
+
+	respChan := make(chan *Response, 1)
+	go func() {
+		resp, err := mgr.RequestApproval(context.Background(), req, timeout)
+		if err != nil {
+			t.Errorf("RequestApproval() error = %v", err)
+			return
+		}
+		respChan <- resp
+	}()
+
+	// Wait for the request to be registered
+	time.Sleep(100 * time.Millisecond)
+
+	mgr.mu.RLock()
+	var requestID string
+	for id := range mgr.pendingRequests {
+		requestID = id
+	}
+	mgr.mu.RUnlock()
+
+	if requestID == "" {
+		t.Fatal("No pending request found")
+	}
+	return requestID, respChan
+}
+
+func TestManager_SubmitApproval_Quorum(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test"})
+
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/api/users/1", RequiredApprovals: 2}
+	requestID, respChan := startPendingApproval(t, mgr, req, 5*time.Second)
+
+	result, err := mgr.SubmitApproval(requestID, DecisionApproved, "bob", "ok")
+	if err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	if result.Resolved || result.Remaining() != 1 {
+		t.Errorf("after first approval: resolved = %v, remaining = %d, want false, 1", result.Resolved, result.Remaining())
+	}
+
+	// The requester can't count toward their own quorum, in any spelling of the name
+	if _, err := mgr.SubmitApproval(requestID, DecisionApproved, " Alice", "self"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("self-approval error = %v, want ErrSelfApproval", err)
+	}
+
+	// Same approver again does not count
+	result, err = mgr.SubmitApproval(requestID, DecisionApproved, "bob", "ok again")
+	if err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	if !result.Duplicate || result.Approvals != 1 {
+		t.Errorf("duplicate approval: duplicate = %v, approvals = %d, want true, 1", result.Duplicate, result.Approvals)
+	}
+
+	result, err = mgr.SubmitApproval(requestID, DecisionApproved, "carol", "ok")
+	if err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	if !result.Resolved {
+		t.Error("expected request to be resolved after quorum")
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp.Decision != DecisionApproved {
+			t.Errorf("Decision = %v, want %v", resp.Decision, DecisionApproved)
+		}
+		if len(resp.Approvers) != 2 || resp.Approvers[0] != "bob" || resp.Approvers[1] != "carol" {
+			t.Errorf("Approvers = %v, want [bob carol]", resp.Approvers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for approval response")
+	}
+
+	// Further submissions are refused once resolved
+	if _, err := mgr.SubmitApproval(requestID, DecisionApproved, "dave", "late"); err == nil {
+		t.Error("SubmitApproval() expected error after request was resolved")
+	}
+}
+
+func TestManager_SubmitApproval_QuorumRejected(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test"})
+
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/api/users/1", RequiredApprovals: 3}
+	requestID, respChan := startPendingApproval(t, mgr, req, 5*time.Second)
+
+	if _, err := mgr.SubmitApproval(requestID, DecisionApproved, "bob", "ok"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	result, err := mgr.SubmitApproval(requestID, DecisionRejected, "carol", "no")
+	if err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	if !result.Resolved {
+		t.Error("expected a single rejection to resolve the request")
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp.Decision != DecisionRejected {
+			t.Errorf("Decision = %v, want %v", resp.Decision, DecisionRejected)
+		}
+		if resp.ApprovedBy != "carol" {
+			t.Errorf("ApprovedBy = %v, want carol", resp.ApprovedBy)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for rejection response")
+	}
+}
+
+func TestManager_SubmitApproval_QuorumTimeout(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test"})
+
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/api/users/1", RequiredApprovals: 2}
+	requestID, respChan := startPendingApproval(t, mgr, req, 300*time.Millisecond)
+
+	if _, err := mgr.SubmitApproval(requestID, DecisionApproved, "bob", "ok"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp.Decision != DecisionTimeout {
+			t.Errorf("Decision = %v, want %v", resp.Decision, DecisionTimeout)
+		}
+		if len(resp.Approvers) != 1 {
+			t.Errorf("Approvers = %v, want [bob]", resp.Approvers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for timeout response")
+	}
+}
+
+func TestManager_RequiredApprovals(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	_ = mgr.AddApprovalPattern("^DELETE /.*", []string{"env:production"}, "all", 0, 2)
+	_ = mgr.AddApprovalPattern("^DELETE /.*", nil, "", 0, 0)
+
+	if got := mgr.RequiredApprovals("DELETE", "/api/users/1", []string{"env:production"}); got != 2 {
+		t.Errorf("RequiredApprovals(production) = %d, want 2", got)
+	}
+	if got := mgr.RequiredApprovals("DELETE", "/api/users/1", []string{"env:staging"}); got != 1 {
+		t.Errorf("RequiredApprovals(staging) = %d, want 1", got)
+	}
+	if got := mgr.RequiredApprovals("GET", "/api/users/1", nil); got != 1 {
+		t.Errorf("RequiredApprovals(no match) = %d, want 1", got)
+	}
+}
+
 func TestManager_GetPendingRequest(t *testing.T) {
 	mgr := NewManager(5 * time.Minute)
 	provider := &mockProvider{name: "test", delay: 10 * time.Second}
@@ -360,6 +519,149 @@ func TestManager_GetPendingRequestsCount(t *testing.T) {
 	}
 }
 
+func TestManager_ListPendingRequests(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test", delay: 10 * time.Second})
+
+	ctx := context.Background()
+	for _, path := range []string{"/api/users/1", "/api/users/2"} {
+		req := &Request{
+			Username:          "alice",
+			Method:            "DELETE",
+			Path:              path,
+			Metadata:          map[string]string{"connection_name": "prod-api"},
+			RequiredApprovals: 2,
+		}
+		go func() {
+			_, _ = mgr.RequestApproval(ctx, req, 30*time.Second)
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	pending := mgr.ListPendingRequests()
+	if len(pending) != 2 {
+		t.Fatalf("ListPendingRequests() returned %d requests, want 2", len(pending))
+	}
+	if pending[0].Path != "/api/users/1" || pending[1].Path != "/api/users/2" {
+		t.Errorf("ListPendingRequests() paths = %s, %s, want oldest first", pending[0].Path, pending[1].Path)
+	}
+
+	if _, err := mgr.SubmitApproval(pending[0].RequestID, DecisionApproved, "bob", "ok"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	pending = mgr.ListPendingRequests()
+	if pending[0].Approvals != 1 || pending[0].RequiredApprovals != 2 {
+		t.Errorf("approvals = %d/%d, want 1/2", pending[0].Approvals, pending[0].RequiredApprovals)
+	}
+	if pending[0].Metadata["connection_name"] != "prod-api" {
+		t.Errorf("connection_name = %q, want prod-api", pending[0].Metadata["connection_name"])
+	}
+}
+
+func TestManager_RequestApproval_Escalation(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test"})
+	if err := mgr.AddApprovalPattern("^DELETE", nil, "", time.Second, 0); err != nil {
+		t.Fatalf("AddApprovalPattern() error = %v", err)
+	}
+	escalator := &mockEscalator{escalated: make(chan string, 1)}
+	if err := mgr.SetPatternEscalation(0, 150*time.Millisecond, escalator); err != nil {
+		t.Fatalf("SetPatternEscalation() error = %v", err)
+	}
+
+	var hookCalls int
+	var hookMu sync.Mutex
+	mgr.SetEscalationHook(func(req *Request, escalation *Escalation, err error) {
+		hookMu.Lock()
+		defer hookMu.Unlock()
+		hookCalls++
+	})
+
+	escalation := mgr.EscalationFor("DELETE", "/users/1", nil)
+	if escalation == nil || escalation.After != 150*time.Millisecond {
+		t.Fatalf("EscalationFor() = %+v, want pattern escalation", escalation)
+	}
+	if mgr.EscalationFor("GET", "/users/1", nil) != nil {
+		t.Error("EscalationFor() returned an escalation for a request without approval")
+	}
+	if !mgr.HasProvider("pager") {
+		t.Error("HasProvider() should accept escalator names as approval channels")
+	}
+
+	requestID, respChan := startPendingApproval(t, mgr, &Request{Username: "alice", Method: "DELETE", Path: "/users/1", Escalation: escalation}, time.Second)
+
+	select {
+	case id := <-escalator.escalated:
+		if id != requestID {
+			t.Errorf("escalated request = %s, want %s", id, requestID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not escalated before the timeout")
+	}
+
+	// The paged engineer can still approve
+	if _, err := mgr.SubmitApprovalFrom(requestID, "pager", DecisionApproved, "oncall", "paged"); err != nil {
+		t.Fatalf("SubmitApprovalFrom() error = %v", err)
+	}
+	resp := <-respChan
+	if resp.Decision != DecisionApproved {
+		t.Errorf("Decision = %s, want approved", resp.Decision)
+	}
+
+	channels := make([]string, len(resp.Ledger))
+	for i, entry := range resp.Ledger {
+		channels[i] = entry.Channel
+	}
+	if strings.Join(channels, ",") != "test,pager" {
+		t.Errorf("ledger channels = %v, want [test pager]", channels)
+	}
+	if resp.Ledger[1].Approver != "oncall" {
+		t.Errorf("escalation ledger approver = %q, want oncall", resp.Ledger[1].Approver)
+	}
+
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	if hookCalls != 1 {
+		t.Errorf("escalation hook calls = %d, want 1", hookCalls)
+	}
+}
+
+func TestManager_RequestApproval_NoEscalationAfterDecision(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "test"})
+	escalator := &mockEscalator{escalated: make(chan string, 1)}
+
+	requestID, respChan := startPendingApproval(t, mgr, &Request{
+		Method:     "DELETE",
+		Escalation: &Escalation{After: 300 * time.Millisecond, Escalator: escalator},
+	}, time.Second)
+	if _, err := mgr.SubmitApproval(requestID, DecisionRejected, "bob", "no"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	<-respChan
+
+	select {
+	case <-escalator.escalated:
+		t.Error("request was escalated after a decision")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+// mockEscalator records escalated request IDs
+type mockEscalator struct {
+	escalated chan string
+}
+
+func (m *mockEscalator) Escalate(ctx context.Context, req *Request) error {
+	m.escalated <- req.ID
+	return nil
+}
+
+func (m *mockEscalator) GetProviderName() string {
+	return "pager"
+}
+
 // mockProvider is a mock approval provider for testing
 type mockProvider struct {
 	name  string
@@ -379,9 +681,9 @@ func (m *mockProvider) GetProviderName() string {
 
 func BenchmarkManager_RequiresApproval(b *testing.B) {
 	mgr := NewManager(5 * time.Minute)
-	_ = mgr.AddApprovalPattern("^DELETE /.*", nil, "", 5*time.Minute)
-	_ = mgr.AddApprovalPattern("^POST /admin/.*", []string{"env:production"}, "all", 5*time.Minute)
-	_ = mgr.AddApprovalPattern("^PUT /api/users/.*", nil, "", 5*time.Minute)
+	_ = mgr.AddApprovalPattern("^DELETE /.*", nil, "", 5*time.Minute, 0)
+	_ = mgr.AddApprovalPattern("^POST /admin/.*", []string{"env:production"}, "all", 5*time.Minute, 0)
+	_ = mgr.AddApprovalPattern("^PUT /api/users/.*", nil, "", 5*time.Minute, 0)
 
 	tags := []string{"env:production"}
 
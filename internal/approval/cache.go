@@ -0,0 +1,140 @@
+package approval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// approvalCacheCleanupInterval is how often expired cached approvals are purged
+const approvalCacheCleanupInterval = time.Minute
+
+// cachedApproval is a remembered approval for identical follow-up requests
+type cachedApproval struct {
+	Approvers []string
+	ExpiresAt time.Time
+}
+
+// CachedApprovalHook is called when a request is auto-approved from the approval cache (e.g., for auditing)
+type CachedApprovalHook func(req *Request, response *Response)
+
+// SetCachedApprovalHook sets the function called for each request approved from the cache
+func (m *Manager) SetCachedApprovalHook(hook CachedApprovalHook) {
+	m.cachedHook = hook
+}
+
+// SetPatternApprovalCache remembers approvals of requests matching the pattern at index
+// (in the order added), auto-approving identical requests for the given window
+func (m *Manager) SetPatternApprovalCache(index int, window time.Duration) error {
+	if index < 0 || index >= len(m.patterns) {
+		return fmt.Errorf("approval pattern %d does not exist", index)
+	}
+	m.patterns[index].CacheWindow = window
+	return nil
+}
+
+// ApprovalCacheFor returns the approval cache window of the pattern matching a request, or 0
+func (m *Manager) ApprovalCacheFor(method, path string, connectionTags []string) time.Duration {
+	pattern := m.matchPattern(method, path, connectionTags)
+	if pattern == nil {
+		return 0
+	}
+	return pattern.CacheWindow
+}
+
+// approvalCacheKey identifies identical requests: same user, connection and request
+func approvalCacheKey(req *Request) string {
+	connection := req.Metadata["connection_name"]
+	if connection == "" {
+		connection = req.ConnectionID
+	}
+	return strings.Join([]string{req.Username, connection, req.Method, req.Path}, "\x00")
+}
+
+// approveFromCache resolves a request from a cached approval, without notifying providers
+// Returns nil if there is no unexpired approval for an identical request.
+func (m *Manager) approveFromCache(req *Request) *Response {
+	m.mu.Lock()
+	cached, ok := m.approvalCache[approvalCacheKey(req)]
+	if !ok || !time.Now().Before(cached.ExpiresAt) {
+		m.mu.Unlock()
+		return nil
+	}
+
+	req.ID = uuid.New().String()
+	req.RequestedAt = time.Now()
+	response := &Response{
+		RequestID:   req.ID,
+		Decision:    DecisionApproved,
+		ApprovedBy:  strings.Join(cached.Approvers, ", "),
+		Approvers:   append([]string(nil), cached.Approvers...),
+		Reason:      fmt.Sprintf("approved within the approval cache window (until %s)", cached.ExpiresAt.Format(time.RFC3339)),
+		RespondedAt: req.RequestedAt,
+		Channel:     "cache",
+	}
+	m.addHistory(req, response)
+	hook := m.cachedHook
+	m.mu.Unlock()
+
+	if hook != nil {
+		hook(req, response)
+	}
+	return response
+}
+
+// updateApprovalCache records an approval or, for any other decision, forgets the cached one
+// Must be called with m.mu held
+func (m *Manager) updateApprovalCache(req *Request, decision Decision, approvers []string) {
+	key := approvalCacheKey(req)
+	if decision != DecisionApproved {
+		delete(m.approvalCache, key)
+		return
+	}
+	if req.ApprovalCache <= 0 || m.closed {
+		return
+	}
+
+	m.approvalCache[key] = &cachedApproval{
+		Approvers: append([]string(nil), approvers...),
+		ExpiresAt: time.Now().Add(req.ApprovalCache),
+	}
+	m.cleanupOnce.Do(func() { go m.cleanupApprovalCache() })
+}
+
+// cleanupApprovalCache purges expired cached approvals until the manager is closed
+func (m *Manager) cleanupApprovalCache() {
+	ticker := time.NewTicker(approvalCacheCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			m.mu.Lock()
+			for key, cached := range m.approvalCache {
+				if !now.Before(cached.ExpiresAt) {
+					delete(m.approvalCache, key)
+				}
+			}
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close clears the approval cache and stops its cleanup. Pending requests are unaffected,
+// but no new approvals are cached (used when the manager is replaced on config reload).
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.approvalCache = make(map[string]*cachedApproval)
+	close(m.stop)
+}
@@ -0,0 +1,139 @@
+package approval
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider counts the approval requests it is sent
+type countingProvider struct {
+	sent atomic.Int32
+}
+
+func (c *countingProvider) SendApprovalRequest(ctx context.Context, req *Request) error {
+	c.sent.Add(1)
+	return nil
+}
+
+func (c *countingProvider) GetProviderName() string {
+	return "counting"
+}
+
+func newCacheTestManager(t *testing.T) (*Manager, *countingProvider) {
+	t.Helper()
+
+	mgr := NewManager(5 * time.Minute)
+	t.Cleanup(mgr.Close)
+	provider := &countingProvider{}
+	mgr.RegisterProvider(provider)
+	if err := mgr.AddApprovalPattern("^DELETE", nil, "", time.Second, 0); err != nil {
+		t.Fatalf("AddApprovalPattern() error = %v", err)
+	}
+	if err := mgr.SetPatternApprovalCache(0, time.Minute); err != nil {
+		t.Fatalf("SetPatternApprovalCache() error = %v", err)
+	}
+	return mgr, provider
+}
+
+func cacheTestRequest(mgr *Manager, path string) *Request {
+	return &Request{
+		Username:      "alice",
+		ConnectionID:  "conn-1",
+		Method:        "DELETE",
+		Path:          path,
+		Metadata:      map[string]string{"connection_name": "prod-api"},
+		ApprovalCache: mgr.ApprovalCacheFor("DELETE", path, nil),
+	}
+}
+
+// decide starts an approval request and resolves it with decision
+func decide(t *testing.T, mgr *Manager, req *Request, decision Decision) {
+	t.Helper()
+
+	requestID, respChan := startPendingApproval(t, mgr, req, time.Second)
+	if _, err := mgr.SubmitApproval(requestID, decision, "bob", "test"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+	<-respChan
+}
+
+func TestManager_ApprovalCache(t *testing.T) {
+	mgr, provider := newCacheTestManager(t)
+
+	var cachedHooks atomic.Int32
+	mgr.SetCachedApprovalHook(func(req *Request, response *Response) { cachedHooks.Add(1) })
+
+	if window := mgr.ApprovalCacheFor("DELETE", "/users/1", nil); window != time.Minute {
+		t.Fatalf("ApprovalCacheFor() = %v, want 1m", window)
+	}
+
+	decide(t, mgr, cacheTestRequest(mgr, "/users/1"), DecisionApproved)
+
+	// Identical request: approved without notifying anyone
+	resp, err := mgr.RequestApproval(context.Background(), cacheTestRequest(mgr, "/users/1"), time.Second)
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if resp.Decision != DecisionApproved || resp.Channel != "cache" || resp.ApprovedBy != "bob" {
+		t.Errorf("cached response = %+v, want approved by bob from cache", resp)
+	}
+	if got := provider.sent.Load(); got != 1 {
+		t.Errorf("provider notified %d times, want 1", got)
+	}
+	if got := cachedHooks.Load(); got != 1 {
+		t.Errorf("cached approval hook calls = %d, want 1", got)
+	}
+
+	// A different request (or user) still needs approval
+	other := cacheTestRequest(mgr, "/users/2")
+	resp, err = mgr.RequestApproval(context.Background(), other, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if resp.Decision != DecisionTimeout {
+		t.Errorf("different request decision = %s, want timeout", resp.Decision)
+	}
+}
+
+func TestManager_ApprovalCache_RejectInvalidates(t *testing.T) {
+	mgr, _ := newCacheTestManager(t)
+
+	decide(t, mgr, cacheTestRequest(mgr, "/users/1"), DecisionApproved)
+
+	// Bypass the cache to get an explicit rejection for the same key
+	req := cacheTestRequest(mgr, "/users/1")
+	req.ApprovalCache = 0
+	decide(t, mgr, req, DecisionRejected)
+
+	resp, err := mgr.RequestApproval(context.Background(), cacheTestRequest(mgr, "/users/1"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if resp.Channel == "cache" {
+		t.Error("rejected request was still approved from the cache")
+	}
+}
+
+func TestManager_ApprovalCache_ClearedOnClose(t *testing.T) {
+	mgr, _ := newCacheTestManager(t)
+
+	decide(t, mgr, cacheTestRequest(mgr, "/users/1"), DecisionApproved)
+	mgr.Close()
+
+	mgr.mu.RLock()
+	cached := len(mgr.approvalCache)
+	mgr.mu.RUnlock()
+	if cached != 0 {
+		t.Errorf("approval cache has %d entries after Close, want 0", cached)
+	}
+
+	resp, err := mgr.RequestApproval(context.Background(), cacheTestRequest(mgr, "/users/1"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if resp.Channel == "cache" {
+		t.Error("closed manager approved from the cache")
+	}
+}
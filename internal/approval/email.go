@@ -0,0 +1,304 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+const (
+	defaultEmailSubjectTemplate = `[Port Authorizing] Approval required: {{.Method}} {{.Path}}`
+
+	defaultEmailBodyTemplate = `A request requires your approval.
+
+User:         {{.Username}}
+Connection:   {{.ConnectionName}}
+Request:      {{.Method}} {{.Path}}
+{{if .Reason}}Reason:       {{.Reason}}
+{{end}}Requested at: {{.RequestedAt}}
+Request ID:   {{.RequestID}}
+{{if .Body}}
+Body:
+{{.Body}}
+{{end}}
+Approve: {{.ApproveURL}}
+Reject:  {{.RejectURL}}
+`
+)
+
+// EmailProvider sends approval requests by email over SMTP
+type EmailProvider struct {
+	host               string
+	port               int
+	from               string
+	to                 []string
+	username           string
+	password           string
+	useTLS             bool
+	allowPlaintextAuth bool
+	apiBaseURL         string // Base URL of the API server for callbacks
+	subjectTemplate    *template.Template
+	bodyTemplate       *template.Template
+	timeout            time.Duration
+}
+
+// NewEmailProvider creates a new email approval provider
+func NewEmailProvider(cfg config.EmailApprovalConfig, apiBaseURL string) (*EmailProvider, error) {
+	if cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("email provider requires smtp_host")
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("email provider requires from address")
+	}
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email provider requires at least one recipient")
+	}
+
+	port := cfg.SMTPPort
+	if port == 0 {
+		if cfg.TLS {
+			port = 465
+		} else {
+			port = 587
+		}
+	}
+
+	subjectText := cfg.SubjectTemplate
+	if subjectText == "" {
+		subjectText = defaultEmailSubjectTemplate
+	}
+	subjectTmpl, err := parseTemplate("subject", subjectText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email subject template: %w", err)
+	}
+
+	bodyText := cfg.BodyTemplate
+	if bodyText == "" {
+		bodyText = defaultEmailBodyTemplate
+	}
+	bodyTmpl, err := parseTemplate("body", bodyText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email body template: %w", err)
+	}
+
+	return &EmailProvider{
+		host:               cfg.SMTPHost,
+		port:               port,
+		from:               cfg.From,
+		to:                 cfg.To,
+		username:           cfg.Username,
+		password:           cfg.Password,
+		useTLS:             cfg.TLS,
+		allowPlaintextAuth: cfg.AllowPlaintextAuth,
+		apiBaseURL:         apiBaseURL,
+		subjectTemplate:    subjectTmpl,
+		bodyTemplate:       bodyTmpl,
+		timeout:            30 * time.Second,
+	}, nil
+}
+
+// SendApprovalRequest sends an approval request email to all recipients
+// Signed requests get one message per recipient, with links bound to their address so
+// each recipient approves as themselves; a failed recipient doesn't stop the others.
+func (e *EmailProvider) SendApprovalRequest(ctx context.Context, req *Request) error {
+	if req.signApprover == nil {
+		subject, body, err := e.render(req, "")
+		if err != nil {
+			return err
+		}
+		if err := e.send(ctx, e.to, e.buildMessage(e.to, subject, body)); err != nil {
+			return fmt.Errorf("failed to send approval email: %w", err)
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, rcpt := range e.to {
+		subject, body, err := e.render(req, rcpt)
+		if err != nil {
+			return err
+		}
+		to := []string{rcpt}
+		if err := e.send(ctx, to, e.buildMessage(to, subject, body)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send approval email to %s: %w", rcpt, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendNotification emails an informational notification to all recipients
+func (e *EmailProvider) SendNotification(ctx context.Context, n *Notification) error {
+	var body strings.Builder
+	body.WriteString(n.Message + "\n")
+	if len(n.Metadata) > 0 {
+		keys := make([]string, 0, len(n.Metadata))
+		for key := range n.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		body.WriteString("\n")
+		for _, key := range keys {
+			fmt.Fprintf(&body, "%s: %s\n", key, n.Metadata[key])
+		}
+	}
+	fmt.Fprintf(&body, "\nSent at: %s\n", n.SentAt.Format(time.RFC1123))
+
+	subject := "[Port Authorizing] " + strings.Join(strings.Fields(n.Title), " ")
+	if err := e.send(ctx, e.to, e.buildMessage(e.to, subject, body.String())); err != nil {
+		return fmt.Errorf("failed to send notification email: %w", err)
+	}
+
+	return nil
+}
+
+// render executes the subject and body templates for a request, with links for one
+// recipient (or shared ones when recipient is empty)
+func (e *EmailProvider) render(req *Request, recipient string) (string, string, error) {
+	data := newTemplateData(req, e.apiBaseURL, "email", recipient)
+
+	var subject bytes.Buffer
+	if err := e.subjectTemplate.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email subject: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := e.bodyTemplate.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email body: %w", err)
+	}
+
+	// Subjects must be a single header line
+	subjectLine := strings.Join(strings.Fields(subject.String()), " ")
+
+	return subjectLine, body.String(), nil
+}
+
+// buildMessage assembles an RFC 5322 message with headers
+func (e *EmailProvider) buildMessage(to []string, subject, body string) []byte {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + e.from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	return msg.Bytes()
+}
+
+// send delivers the message to the recipients over SMTP, using implicit TLS or STARTTLS when available
+func (e *EmailProvider) send(ctx context.Context, to []string, msg []byte) error {
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+
+	dialer := &net.Dialer{Timeout: e.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	deadline := time.Now().Add(e.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+
+	tlsConfig := &tls.Config{ServerName: e.host}
+	if e.useTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	secure := e.useTLS
+	if !secure {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+			secure = true
+		}
+	}
+
+	if e.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			var auth smtp.Auth
+			if secure {
+				auth = smtp.PlainAuth("", e.username, e.password, e.host)
+			} else {
+				if !e.allowPlaintextAuth {
+					return fmt.Errorf("SMTP server does not support TLS and allow_plaintext_auth is disabled")
+				}
+				auth = &plaintextAuth{username: e.username, password: e.password}
+			}
+			if err := client.Auth(auth); err != nil {
+				return fmt.Errorf("SMTP authentication failed: %w", err)
+			}
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// GetProviderName returns the provider name
+func (e *EmailProvider) GetProviderName() string {
+	return "email"
+}
+
+// plaintextAuth implements PLAIN auth without requiring TLS.
+// Only used when explicitly enabled via allow_plaintext_auth.
+type plaintextAuth struct {
+	username string
+	password string
+}
+
+func (a *plaintextAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	resp := []byte("\x00" + a.username + "\x00" + a.password)
+	return "PLAIN", resp, nil
+}
+
+func (a *plaintextAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, fmt.Errorf("unexpected server challenge")
+	}
+	return nil, nil
+}
@@ -0,0 +1,356 @@
+package approval
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// fakeSMTPServer is a minimal SMTP server that records the last message received
+type fakeSMTPServer struct {
+	listener net.Listener
+	received chan string
+	authSeen chan string
+}
+
+func newFakeSMTPServer(t *testing.T, advertiseAuth bool) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &fakeSMTPServer{
+		listener: listener,
+		received: make(chan string, 4),
+		authSeen: make(chan string, 1),
+	}
+
+	// Each message is its own session, e.g. one per recipient of an approval request
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn, advertiseAuth)
+		}
+	}()
+
+	return s
+}
+
+// serve runs one SMTP session, passing each message received to s.received
+func (s *fakeSMTPServer) serve(conn net.Conn, advertiseAuth bool) {
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	write := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	write("220 localhost ESMTP fake")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			if advertiseAuth {
+				write("250-localhost")
+				write("250 AUTH PLAIN")
+			} else {
+				write("250 localhost")
+			}
+		case strings.HasPrefix(cmd, "AUTH"):
+			s.authSeen <- strings.TrimSpace(line)
+			write("235 Authentication successful")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			write("250 OK")
+		case cmd == "DATA":
+			write("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.received <- data.String()
+			write("250 OK")
+		case cmd == "QUIT":
+			write("221 Bye")
+			return
+		default:
+			write("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) hostPort(t *testing.T) (string, int) {
+	t.Helper()
+	host, portStr, _ := net.SplitHostPort(s.listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func TestNewEmailProvider_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.EmailApprovalConfig
+		wantErr bool
+	}{
+		{
+			name:    "valid config",
+			cfg:     config.EmailApprovalConfig{SMTPHost: "smtp.example.com", From: "pa@example.com", To: []string{"oncall@example.com"}},
+			wantErr: false,
+		},
+		{
+			name:    "missing host",
+			cfg:     config.EmailApprovalConfig{From: "pa@example.com", To: []string{"oncall@example.com"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing recipients",
+			cfg:     config.EmailApprovalConfig{SMTPHost: "smtp.example.com", From: "pa@example.com"},
+			wantErr: true,
+		},
+		{
+			name: "invalid subject template",
+			cfg: config.EmailApprovalConfig{
+				SMTPHost: "smtp.example.com", From: "pa@example.com", To: []string{"oncall@example.com"},
+				SubjectTemplate: "{{.Method",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewEmailProvider(tt.cfg, "https://pa.example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewEmailProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && provider.GetProviderName() != "email" {
+				t.Errorf("GetProviderName() = %v, want email", provider.GetProviderName())
+			}
+		})
+	}
+}
+
+func TestNewEmailProvider_DefaultPort(t *testing.T) {
+	provider, _ := NewEmailProvider(config.EmailApprovalConfig{SMTPHost: "smtp.example.com", From: "a@b", To: []string{"c@d"}}, "")
+	if provider.port != 587 {
+		t.Errorf("port = %d, want 587", provider.port)
+	}
+
+	provider, _ = NewEmailProvider(config.EmailApprovalConfig{SMTPHost: "smtp.example.com", From: "a@b", To: []string{"c@d"}, TLS: true}, "")
+	if provider.port != 465 {
+		t.Errorf("port = %d, want 465 with implicit TLS", provider.port)
+	}
+}
+
+func TestEmailProvider_Render(t *testing.T) {
+	provider, err := NewEmailProvider(config.EmailApprovalConfig{
+		SMTPHost:        "smtp.example.com",
+		From:            "pa@example.com",
+		To:              []string{"oncall@example.com"},
+		SubjectTemplate: "{{.Username}} wants {{.Method}} on {{.ConnectionName}}",
+		BodyTemplate:    "approve={{.ApproveURL}} reject={{.RejectURL}}",
+	}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewEmailProvider() error = %v", err)
+	}
+
+	req := &Request{
+		ID:          "req-1",
+		Username:    "alice",
+		Method:      "DELETE",
+		Path:        "/api/users/1",
+		RequestedAt: time.Now(),
+		Metadata:    map[string]string{"connection_name": "prod-api"},
+	}
+
+	subject, body, err := provider.render(req, "")
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+
+	if subject != "alice wants DELETE on prod-api" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	wantBody := "approve=https://pa.example.com/api/approvals/req-1/approve?channel=email reject=https://pa.example.com/api/approvals/req-1/reject?channel=email"
+	if body != wantBody {
+		t.Errorf("body = %q, want %q", body, wantBody)
+	}
+}
+
+func TestEmailProvider_DefaultBodyShowsReason(t *testing.T) {
+	provider, err := NewEmailProvider(config.EmailApprovalConfig{
+		SMTPHost: "smtp.example.com",
+		From:     "pa@example.com",
+		To:       []string{"oncall@example.com"},
+	}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewEmailProvider() error = %v", err)
+	}
+
+	req := &Request{ID: "req-1", Username: "alice", Method: "DELETE", Path: "/api/users/1", RequestedAt: time.Now(),
+		Metadata: map[string]string{"connection_name": "prod-api"}}
+	_, body, err := provider.render(req, "")
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if strings.Contains(body, "Reason:") {
+		t.Errorf("body shows a reason line without a reason:\n%s", body)
+	}
+
+	req.Metadata["reason"] = "INC-1234 cleanup"
+	_, body, err = provider.render(req, "")
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if !strings.Contains(body, "Reason:       INC-1234 cleanup\n") {
+		t.Errorf("body should show the connect reason:\n%s", body)
+	}
+}
+
+func TestEmailProvider_SendApprovalRequest(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	defer func() { _ = server.listener.Close() }()
+
+	host, port := server.hostPort(t)
+	provider, err := NewEmailProvider(config.EmailApprovalConfig{
+		SMTPHost: host,
+		SMTPPort: port,
+		From:     "pa@example.com",
+		To:       []string{"oncall@example.com"},
+	}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewEmailProvider() error = %v", err)
+	}
+
+	req := &Request{
+		ID:          "req-42",
+		Username:    "alice",
+		Method:      "DELETE",
+		Path:        "/api/users/1",
+		RequestedAt: time.Now(),
+	}
+
+	if err := provider.SendApprovalRequest(context.Background(), req); err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	select {
+	case msg := <-server.received:
+		if !strings.Contains(msg, "To: oncall@example.com") {
+			t.Errorf("message missing To header: %s", msg)
+		}
+		if !strings.Contains(msg, "https://pa.example.com/api/approvals/req-42/approve") {
+			t.Errorf("message missing approve link: %s", msg)
+		}
+		if !strings.Contains(msg, "https://pa.example.com/api/approvals/req-42/reject") {
+			t.Errorf("message missing reject link: %s", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for email")
+	}
+}
+
+func TestEmailProvider_SendApprovalRequest_PerRecipient(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	defer func() { _ = server.listener.Close() }()
+
+	host, port := server.hostPort(t)
+	provider, err := NewEmailProvider(config.EmailApprovalConfig{
+		SMTPHost: host,
+		SMTPPort: port,
+		From:     "pa@example.com",
+		To:       []string{"bob@example.com", "carol@example.com"},
+	}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewEmailProvider() error = %v", err)
+	}
+
+	req := &Request{ID: "req-42", Username: "alice", Method: "DELETE", Path: "/api/users/1", RequestedAt: time.Now(), RequiredApprovals: 2}
+	NewManager(time.Minute).signCallbacks(req)
+	if err := provider.SendApprovalRequest(context.Background(), req); err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	// Each recipient gets their own message with links bound to their address
+	for _, rcpt := range []string{"bob@example.com", "carol@example.com"} {
+		select {
+		case msg := <-server.received:
+			if !strings.Contains(msg, "To: "+rcpt+"\r\n") {
+				t.Errorf("message not addressed to %s alone: %s", rcpt, msg)
+			}
+			token := req.signApprover(DecisionApproved, rcpt)
+			if !strings.Contains(msg, "approver="+url.QueryEscape(rcpt)) || !strings.Contains(msg, "token="+token) {
+				t.Errorf("message for %s missing their approve link: %s", rcpt, msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for the email to %s", rcpt)
+		}
+	}
+}
+
+func TestEmailProvider_PlaintextAuth(t *testing.T) {
+	t.Run("refused without opt-in", func(t *testing.T) {
+		server := newFakeSMTPServer(t, true)
+		defer func() { _ = server.listener.Close() }()
+
+		host, port := server.hostPort(t)
+		provider, _ := NewEmailProvider(config.EmailApprovalConfig{
+			SMTPHost: host, SMTPPort: port,
+			From: "pa@example.com", To: []string{"oncall@example.com"},
+			Username: "user", Password: "secret",
+		}, "")
+
+		err := provider.SendApprovalRequest(context.Background(), &Request{ID: "req-1"})
+		if err == nil {
+			t.Fatal("SendApprovalRequest() expected error for plaintext auth without opt-in")
+		}
+	})
+
+	t.Run("allowed with opt-in", func(t *testing.T) {
+		server := newFakeSMTPServer(t, true)
+		defer func() { _ = server.listener.Close() }()
+
+		host, port := server.hostPort(t)
+		provider, _ := NewEmailProvider(config.EmailApprovalConfig{
+			SMTPHost: host, SMTPPort: port,
+			From: "pa@example.com", To: []string{"oncall@example.com"},
+			Username: "user", Password: "secret",
+			AllowPlaintextAuth: true,
+		}, "")
+
+		if err := provider.SendApprovalRequest(context.Background(), &Request{ID: "req-1"}); err != nil {
+			t.Fatalf("SendApprovalRequest() error = %v", err)
+		}
+
+		select {
+		case auth := <-server.authSeen:
+			if !strings.HasPrefix(auth, "AUTH PLAIN") {
+				t.Errorf("auth command = %q, want AUTH PLAIN", auth)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for AUTH")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package approval
+
+import "time"
+
+// maxHistoryEntries bounds the in-memory approval history
+const maxHistoryEntries = 500
+
+// LedgerEntry records one approval channel's notification or response for a request
+type LedgerEntry struct {
+	Channel     string    `json:"channel"`
+	DeliveredAt time.Time `json:"delivered_at,omitempty"`
+	Error       string    `json:"error,omitempty"` // Notification delivery error
+	RespondedAt time.Time `json:"responded_at,omitempty"`
+	Approver    string    `json:"approver,omitempty"`
+	Decision    Decision  `json:"decision,omitempty"`
+}
+
+// HistoryEntry is a resolved approval request with its full channel ledger
+type HistoryEntry struct {
+	RequestID    string            `json:"request_id"`
+	Username     string            `json:"username"`
+	ConnectionID string            `json:"connection_id"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	RequestedAt  time.Time         `json:"requested_at"`
+	ResolvedAt   time.Time         `json:"resolved_at"`
+	Decision     Decision          `json:"decision"`
+	Channel      string            `json:"channel,omitempty"` // Channel that returned the decision
+	Approvers    []string          `json:"approvers,omitempty"`
+	Ledger       []LedgerEntry     `json:"ledger"`
+}
+
+// recordResponse adds a response to the ledger, filling the channel's notification entry if unanswered
+func recordResponse(ledger []LedgerEntry, channel, approver string, decision Decision, at time.Time) []LedgerEntry {
+	for i := range ledger {
+		if ledger[i].Channel == channel && ledger[i].RespondedAt.IsZero() {
+			ledger[i].RespondedAt = at
+			ledger[i].Approver = approver
+			ledger[i].Decision = decision
+			return ledger
+		}
+	}
+
+	return append(ledger, LedgerEntry{
+		Channel:     channel,
+		RespondedAt: at,
+		Approver:    approver,
+		Decision:    decision,
+	})
+}
+
+// addHistory appends a resolved request to the history
+// Must be called with m.mu held
+func (m *Manager) addHistory(req *Request, response *Response) {
+	m.history = append(m.history, HistoryEntry{
+		RequestID:    req.ID,
+		Username:     req.Username,
+		ConnectionID: req.ConnectionID,
+		Method:       req.Method,
+		Path:         req.Path,
+		Metadata:     req.Metadata,
+		RequestedAt:  req.RequestedAt,
+		ResolvedAt:   response.RespondedAt,
+		Decision:     response.Decision,
+		Channel:      response.Channel,
+		Approvers:    response.Approvers,
+		Ledger:       response.Ledger,
+	})
+
+	if len(m.history) > maxHistoryEntries {
+		m.history = m.history[len(m.history)-maxHistoryEntries:]
+	}
+}
+
+// GetHistory returns the most recent resolved approval requests, newest first
+func (m *Manager) GetHistory(limit int) []HistoryEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if limit <= 0 || limit > len(m.history) {
+		limit = len(m.history)
+	}
+
+	result := make([]HistoryEntry, 0, limit)
+	for i := len(m.history) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, m.history[i])
+	}
+	return result
+}
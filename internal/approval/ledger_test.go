@@ -0,0 +1,124 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingProvider always fails to deliver notifications
+type failingProvider struct {
+	name string
+}
+
+func (f *failingProvider) SendApprovalRequest(ctx context.Context, req *Request) error {
+	return errors.New("delivery failed")
+}
+
+func (f *failingProvider) GetProviderName() string {
+	return f.name
+}
+
+func TestManager_Ledger(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "slack"})
+	mgr.RegisterProvider(&failingProvider{name: "webhook"})
+
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/api/users/1"}
+	requestID, respChan := startPendingApproval(t, mgr, req, 5*time.Second)
+
+	if _, err := mgr.SubmitApprovalFrom(requestID, "slack", DecisionApproved, "bob", "ok"); err != nil {
+		t.Fatalf("SubmitApprovalFrom() error = %v", err)
+	}
+
+	var resp *Response
+	select {
+	case resp = <-respChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for approval response")
+	}
+
+	if resp.Channel != "slack" {
+		t.Errorf("Channel = %q, want slack", resp.Channel)
+	}
+	if len(resp.Ledger) != 2 {
+		t.Fatalf("Ledger has %d entries, want 2: %+v", len(resp.Ledger), resp.Ledger)
+	}
+
+	slack := resp.Ledger[0]
+	if slack.Channel != "slack" || slack.DeliveredAt.IsZero() || slack.RespondedAt.IsZero() || slack.Approver != "bob" {
+		t.Errorf("slack ledger entry = %+v", slack)
+	}
+
+	webhook := resp.Ledger[1]
+	if webhook.Channel != "webhook" || webhook.Error == "" || !webhook.DeliveredAt.IsZero() {
+		t.Errorf("webhook ledger entry = %+v", webhook)
+	}
+
+	history := mgr.GetHistory(10)
+	if len(history) != 1 {
+		t.Fatalf("GetHistory() returned %d entries, want 1", len(history))
+	}
+	if history[0].RequestID != requestID || history[0].Decision != DecisionApproved || len(history[0].Ledger) != 2 {
+		t.Errorf("history entry = %+v", history[0])
+	}
+}
+
+func TestManager_Ledger_ResponseFromUnnotifiedChannel(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "slack"})
+
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/api/users/1"}
+	requestID, respChan := startPendingApproval(t, mgr, req, 5*time.Second)
+
+	if _, err := mgr.SubmitApproval(requestID, DecisionRejected, "carol", "no"); err != nil {
+		t.Fatalf("SubmitApproval() error = %v", err)
+	}
+
+	resp := <-respChan
+	if resp.Channel != "api" {
+		t.Errorf("Channel = %q, want api", resp.Channel)
+	}
+	if len(resp.Ledger) != 2 {
+		t.Fatalf("Ledger has %d entries, want 2: %+v", len(resp.Ledger), resp.Ledger)
+	}
+	if !resp.Ledger[0].RespondedAt.IsZero() {
+		t.Error("slack entry should have no response")
+	}
+	if resp.Ledger[1].Channel != "api" || resp.Ledger[1].Decision != DecisionRejected {
+		t.Errorf("api ledger entry = %+v", resp.Ledger[1])
+	}
+}
+
+func TestManager_History_Timeout(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	mgr.RegisterProvider(&mockProvider{name: "slack"})
+
+	resp, err := mgr.RequestApproval(context.Background(), &Request{Username: "alice", Method: "DELETE"}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if len(resp.Ledger) != 1 {
+		t.Errorf("Ledger has %d entries, want 1", len(resp.Ledger))
+	}
+
+	history := mgr.GetHistory(0)
+	if len(history) != 1 || history[0].Decision != DecisionTimeout {
+		t.Errorf("GetHistory() = %+v, want one timeout entry", history)
+	}
+}
+
+func TestManager_GetHistory_Limit(t *testing.T) {
+	mgr := NewManager(5 * time.Minute)
+	for i := 0; i < maxHistoryEntries+10; i++ {
+		mgr.addHistory(&Request{ID: string(rune('a' + i%26))}, &Response{Decision: DecisionApproved})
+	}
+
+	if got := len(mgr.GetHistory(0)); got != maxHistoryEntries {
+		t.Errorf("history size = %d, want %d", got, maxHistoryEntries)
+	}
+	if got := len(mgr.GetHistory(5)); got != 5 {
+		t.Errorf("GetHistory(5) returned %d entries", got)
+	}
+}
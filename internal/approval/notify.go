@@ -0,0 +1,42 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Notification is an informational alert (no decision expected) sent through
+// the approval providers, e.g. when a connection crosses its session threshold
+type Notification struct {
+	Title    string
+	Message  string
+	Metadata map[string]string
+	SentAt   time.Time
+}
+
+// Notifier is implemented by providers that can deliver informational notifications
+type Notifier interface {
+	SendNotification(ctx context.Context, n *Notification) error
+}
+
+// Notify sends a notification through every registered provider that supports it
+func (m *Manager) Notify(ctx context.Context, n *Notification) error {
+	if n.SentAt.IsZero() {
+		n.SentAt = time.Now()
+	}
+
+	var errs []error
+	for _, provider := range m.providers {
+		notifier, ok := provider.(Notifier)
+		if !ok {
+			continue
+		}
+		if err := notifier.SendNotification(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.GetProviderName(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// defaultPagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const defaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyEscalator pages an on-call engineer about a pending approval via the PagerDuty Events API v2
+type PagerDutyEscalator struct {
+	routingKey string
+	severity   string
+	eventsURL  string
+	apiBaseURL string // Base URL of the API server for approve/reject links
+	client     *http.Client
+}
+
+// NewPagerDutyEscalator creates a new PagerDuty escalator
+func NewPagerDutyEscalator(cfg config.PagerDutyEscalationConfig, apiBaseURL string) (*PagerDutyEscalator, error) {
+	if cfg.RoutingKey == "" {
+		return nil, fmt.Errorf("pagerduty escalation requires routing_key")
+	}
+
+	severity := cfg.Severity
+	if severity == "" {
+		severity = "critical"
+	}
+	eventsURL := cfg.EventsURL
+	if eventsURL == "" {
+		eventsURL = defaultPagerDutyEventsURL
+	}
+
+	return &PagerDutyEscalator{
+		routingKey: cfg.RoutingKey,
+		severity:   severity,
+		eventsURL:  eventsURL,
+		apiBaseURL: apiBaseURL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// pagerDutyEvent is a PagerDuty Events API v2 trigger event
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Component     string            `json:"component,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Escalate triggers a PagerDuty incident for the pending request
+// The dedup key is derived from the request ID, so repeated escalations update one incident.
+func (p *PagerDutyEscalator) Escalate(ctx context.Context, req *Request) error {
+	approveURL := req.callbackURL(p.apiBaseURL, DecisionApproved, "pagerduty")
+	rejectURL := req.callbackURL(p.apiBaseURL, DecisionRejected, "pagerduty")
+
+	connection := req.Metadata["connection_name"]
+	if connection == "" {
+		connection = req.ConnectionID
+	}
+
+	details := map[string]string{
+		"request_id":         req.ID,
+		"username":           req.Username,
+		"connection":         connection,
+		"request":            fmt.Sprintf("%s %s", req.Method, req.Path),
+		"requested_at":       req.RequestedAt.Format(time.RFC3339),
+		"required_approvals": strconv.Itoa(req.RequiredApprovals),
+		"approve_url":        approveURL,
+		"reject_url":         rejectURL,
+	}
+	if reason := req.Metadata["reason"]; reason != "" {
+		details["reason"] = reason
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    "port-authorizing-approval-" + req.ID,
+		Payload: pagerDutyPayload{
+			Summary:       truncateSummary(fmt.Sprintf("Approval pending: %s requests %s %s on %s", req.Username, req.Method, req.Path, connection)),
+			Source:        "port-authorizing",
+			Severity:      p.severity,
+			Timestamp:     time.Now().Format(time.RFC3339),
+			Component:     connection,
+			CustomDetails: details,
+		},
+		Links: []pagerDutyLink{
+			{Href: approveURL, Text: "Approve request"},
+			{Href: rejectURL, Text: "Reject request"},
+		},
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.eventsURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create pagerduty request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send pagerduty event: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty returned non-success status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// truncateSummary keeps an incident summary within PagerDuty's 1024 character limit
+func truncateSummary(summary string) string {
+	if len(summary) > 1024 {
+		return summary[:1021] + "..."
+	}
+	return summary
+}
+
+// GetProviderName returns the provider name
+func (p *PagerDutyEscalator) GetProviderName() string {
+	return "pagerduty"
+}
@@ -0,0 +1,91 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestNewPagerDutyEscalator(t *testing.T) {
+	if _, err := NewPagerDutyEscalator(config.PagerDutyEscalationConfig{}, "https://pa.example.com"); err == nil {
+		t.Error("NewPagerDutyEscalator() without routing key should fail")
+	}
+
+	escalator, err := NewPagerDutyEscalator(config.PagerDutyEscalationConfig{RoutingKey: "key"}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewPagerDutyEscalator() error = %v", err)
+	}
+	if escalator.severity != "critical" || escalator.eventsURL != defaultPagerDutyEventsURL {
+		t.Errorf("defaults = (%s, %s), want (critical, %s)", escalator.severity, escalator.eventsURL, defaultPagerDutyEventsURL)
+	}
+	if escalator.GetProviderName() != "pagerduty" {
+		t.Errorf("GetProviderName() = %s, want pagerduty", escalator.GetProviderName())
+	}
+}
+
+func TestPagerDutyEscalator_Escalate(t *testing.T) {
+	var event pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	escalator, err := NewPagerDutyEscalator(config.PagerDutyEscalationConfig{
+		RoutingKey: "routing-key",
+		Severity:   "error",
+		EventsURL:  server.URL,
+	}, "https://pa.example.com")
+	if err != nil {
+		t.Fatalf("NewPagerDutyEscalator() error = %v", err)
+	}
+
+	req := &Request{
+		ID:                "req-1",
+		Username:          "alice",
+		Method:            "DELETE",
+		Path:              "/api/users/1",
+		RequestedAt:       time.Now(),
+		RequiredApprovals: 2,
+		Metadata:          map[string]string{"connection_name": "prod-api"},
+	}
+	if err := escalator.Escalate(context.Background(), req); err != nil {
+		t.Fatalf("Escalate() error = %v", err)
+	}
+
+	if event.RoutingKey != "routing-key" || event.EventAction != "trigger" || event.DedupKey != "port-authorizing-approval-req-1" {
+		t.Errorf("event = %+v, want trigger for req-1", event)
+	}
+	if event.Payload.Severity != "error" {
+		t.Errorf("severity = %s, want error", event.Payload.Severity)
+	}
+	if !strings.Contains(event.Payload.Summary, "alice") || !strings.Contains(event.Payload.Summary, "prod-api") {
+		t.Errorf("summary = %q, want user and connection", event.Payload.Summary)
+	}
+	if event.Payload.CustomDetails["approve_url"] != "https://pa.example.com/api/approvals/req-1/approve?channel=pagerduty" {
+		t.Errorf("approve_url = %s", event.Payload.CustomDetails["approve_url"])
+	}
+	if len(event.Links) != 2 || event.Links[1].Href != "https://pa.example.com/api/approvals/req-1/reject?channel=pagerduty" {
+		t.Errorf("links = %+v, want approve and reject links", event.Links)
+	}
+}
+
+func TestPagerDutyEscalator_Escalate_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	escalator, _ := NewPagerDutyEscalator(config.PagerDutyEscalationConfig{RoutingKey: "key", EventsURL: server.URL}, "")
+	if err := escalator.Escalate(context.Background(), &Request{ID: "req-1"}); err == nil {
+		t.Error("Escalate() expected error for non-success status")
+	}
+}
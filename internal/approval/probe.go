@@ -0,0 +1,61 @@
+package approval
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProbeResult is the outcome of delivering a probe request through one provider
+type ProbeResult struct {
+	Provider  string        `json:"provider"`
+	Delivered bool          `json:"delivered"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// ProbeProviders sends a synthetic approval request through every provider in parallel,
+// each bounded by timeout (including its retries), and reports the outcome per provider
+// in registration order. The request is never pending and its links are unsigned, so
+// nobody can decide it.
+func (m *Manager) ProbeProviders(ctx context.Context, requestedBy string, timeout time.Duration) []ProbeResult {
+	req := &Request{
+		ID:                "test-" + uuid.New().String(),
+		Username:          requestedBy,
+		Method:            "TEST",
+		Path:              "approval provider test",
+		RequestedAt:       time.Now(),
+		RequiredApprovals: 1,
+		Metadata: map[string]string{
+			"test":    "true",
+			"message": "Test request from port-authorizing; no action is needed",
+		},
+	}
+
+	results := make([]ProbeResult, len(m.providers))
+	var wg sync.WaitGroup
+	for i, provider := range m.providers {
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			sendCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			started := time.Now()
+			err := provider.SendApprovalRequest(sendCtx, req)
+			result := ProbeResult{
+				Provider:  provider.GetProviderName(),
+				Delivered: err == nil,
+				Duration:  time.Since(started),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, provider)
+	}
+	wg.Wait()
+	return results
+}
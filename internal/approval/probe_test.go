@@ -0,0 +1,58 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManager_ProbeProviders(t *testing.T) {
+	var received webhookPayload
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ok.Close()
+
+	// A hung endpoint: never answers while the probe waits
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	mgr := NewManager(time.Minute)
+	mgr.RegisterProvider(NewWebhookProvider(ok.URL, ""))
+	slack := NewSlackProvider(hung.URL, "")
+	slack.SetRetry(RetryPolicy{MaxAttempts: 1}, nil)
+	mgr.RegisterProvider(slack)
+
+	started := time.Now()
+	results := mgr.ProbeProviders(context.Background(), "admin", 200*time.Millisecond)
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("ProbeProviders() took %v despite the timeout", elapsed)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want one per provider", results)
+	}
+	if results[0].Provider != "webhook" || !results[0].Delivered || results[0].Error != "" {
+		t.Errorf("webhook result = %+v, want delivered", results[0])
+	}
+	if results[1].Provider != "slack" || results[1].Delivered || results[1].Error == "" {
+		t.Errorf("slack result = %+v, want a timeout error", results[1])
+	}
+
+	if received.Method != "TEST" || received.Username != "admin" || received.Metadata["test"] != "true" {
+		t.Errorf("webhook payload = %+v, want the synthetic test request", received)
+	}
+	if received.ApproveURL != "/api/approvals/"+received.RequestID+"/approve?channel=webhook" {
+		t.Errorf("approve URL = %q, want an unsigned link", received.ApproveURL)
+	}
+	if mgr.GetPendingRequestsCount() != 0 {
+		t.Error("probe created a pending request")
+	}
+}
@@ -0,0 +1,87 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Delivery retry defaults, used when a RetryPolicy leaves a setting at 0
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+)
+
+// RetryPolicy retries failed deliveries to a provider with exponential backoff and jitter
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts including the first (0 = 3; 1 disables retries)
+	BaseDelay   time.Duration // Wait before the first retry, doubled for each further one (0 = 500ms)
+}
+
+// RetryHook is called before each retry of a failed delivery (e.g., for auditing).
+// req is nil when the delivery is a notification rather than an approval request.
+type RetryHook func(provider string, req *Request, attempt int, delay time.Duration, err error)
+
+// permanentError is a delivery failure that retrying cannot fix (e.g., a 4xx response)
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// statusError wraps the error for an HTTP status: client errors other than 429 are permanent
+func statusError(status int, err error) error {
+	if status >= 400 && status < 500 && status != 429 {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// retrier runs deliveries under a RetryPolicy; the zero value uses the defaults
+type retrier struct {
+	policy RetryPolicy
+	hook   RetryHook
+}
+
+// do calls send until it succeeds, fails permanently, runs out of attempts or ctx ends,
+// and returns the last error
+func (r *retrier) do(ctx context.Context, provider string, req *Request, send func() error) error {
+	attempts := r.policy.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultRetryMaxAttempts
+	}
+	delay := r.policy.BaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= attempts {
+			return err
+		}
+
+		wait := jitter(delay)
+		if r.hook != nil {
+			r.hook(provider, req, attempt+1, wait, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// jitter spreads retries out: a random wait between half and all of d
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
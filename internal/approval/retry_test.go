@@ -0,0 +1,91 @@
+package approval
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, then succeeds
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestWebhookProvider_RetriesWithBackoff(t *testing.T) {
+	server, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+
+	var attempts []int
+	provider := NewWebhookProvider(server.URL, "")
+	provider.SetRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond}, func(provider string, req *Request, attempt int, delay time.Duration, err error) {
+		if provider != "webhook" || req == nil || req.ID != "req-1" || err == nil {
+			t.Errorf("retry hook got provider=%q req=%+v err=%v", provider, req, err)
+		}
+		if delay < 5*time.Millisecond || delay > 10*time.Millisecond<<(attempt-2) {
+			t.Errorf("attempt %d delay = %v, outside the jittered backoff", attempt, delay)
+		}
+		attempts = append(attempts, attempt)
+	})
+
+	if err := provider.SendApprovalRequest(context.Background(), &Request{ID: "req-1", Username: "alice"}); err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v, want success on the third attempt", err)
+	}
+	if calls.Load() != 3 || len(attempts) != 2 || attempts[0] != 2 || attempts[1] != 3 {
+		t.Errorf("calls = %d, retried attempts = %v; want 3 calls, retries [2 3]", calls.Load(), attempts)
+	}
+}
+
+func TestSlackProvider_RetriesExhausted(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusBadGateway)
+
+	provider := NewSlackProvider(server.URL, "https://pa.example.com")
+	provider.SetRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, nil)
+
+	if err := provider.SendApprovalRequest(context.Background(), &Request{ID: "req-1"}); err == nil {
+		t.Fatal("SendApprovalRequest() succeeded, want the last error after retries")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want max_attempts (2)", calls.Load())
+	}
+}
+
+func TestWebhookProvider_NoRetryOnClientError(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusBadRequest)
+
+	provider := NewWebhookProvider(server.URL, "")
+	provider.SetRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}, nil)
+
+	if err := provider.SendApprovalRequest(context.Background(), &Request{ID: "req-1"}); err == nil {
+		t.Fatal("SendApprovalRequest() succeeded on 400")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1 (4xx is not retried)", calls.Load())
+	}
+}
+
+func TestRetrier_StopsWhenContextEnds(t *testing.T) {
+	r := retrier{policy: RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	err := r.do(ctx, "webhook", nil, func() error {
+		calls++
+		return http.ErrHandlerTimeout
+	})
+	if err != http.ErrHandlerTimeout || calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("do() = %v after %d calls in %v, want the send error once the context ends", err, calls, time.Since(start))
+	}
+}
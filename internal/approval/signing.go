@@ -0,0 +1,145 @@
+package approval
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of a webhook body
+const SignatureHeader = "X-PA-Signature"
+
+// SignPayload returns the X-PA-Signature value for a webhook body ("sha256=<hex>")
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CallbackToken returns the token authorizing one approver's decision on one request
+// The token is bound to all three, so a link can't be replayed to decide another request
+// or used to approve as someone else. Links posted to shared channels (Slack, PagerDuty,
+// webhooks) can't name who clicks them and are bound to no approver ("").
+func CallbackToken(secret, requestID string, decision Decision, approver string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(requestID + ":" + string(decision) + ":" + approver))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallbackToken reports whether token was issued for this request, decision and approver
+func VerifyCallbackToken(secret, requestID string, decision Decision, approver, token string) bool {
+	expected := CallbackToken(secret, requestID, decision, approver)
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// ErrInvalidCallbackToken is returned for an approve/reject token not issued for the request and decision
+var ErrInvalidCallbackToken = errors.New("invalid approval token")
+
+// ErrCallbackTokenUsed is returned when an approve/reject token was already used
+var ErrCallbackTokenUsed = errors.New("approval token already used")
+
+// ErrApproverRequired is returned when a shared-channel link approves a request that
+// needs several approvers: only approvals from known identities count towards a quorum
+var ErrApproverRequired = errors.New("request needs several approvers; approve from your own link or with an admin API token")
+
+// newCallbackSecret returns a random key for signing approve/reject links
+// Links only need to verify while their request is pending, which never outlives the process
+// (replicas sharing a store must share a secret instead).
+func newCallbackSecret() string {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// SetCallbackSecret signs approve/reject links with a shared secret instead of a random key
+func (m *Manager) SetCallbackSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	m.callbackSecret = secret
+}
+
+// VerifyCallback reports whether token authorizes approver's decision on the request
+func (m *Manager) VerifyCallback(requestID string, decision Decision, approver, token string) bool {
+	return VerifyCallbackToken(m.callbackSecret, requestID, decision, approver, token)
+}
+
+// ConsumeCallback verifies an approve/reject token and marks it used
+// Each link can decide a request once; a second use returns ErrCallbackTokenUsed. Links
+// bound to no approver can't approve requests needing several approvers (ErrApproverRequired).
+func (m *Manager) ConsumeCallback(requestID string, decision Decision, approver, token string) error {
+	if !m.VerifyCallback(requestID, decision, approver, token) {
+		return ErrInvalidCallbackToken
+	}
+
+	storeCtx, cancelStore := m.storeContext()
+	defer cancelStore()
+
+	_, err := m.store.Update(storeCtx, requestID, func(pending *PendingState) error {
+		if approver == "" && decision == DecisionApproved && pending.Request.RequiredApprovals > 1 {
+			return ErrApproverRequired
+		}
+		if pending.UsedTokens[token] {
+			return ErrCallbackTokenUsed
+		}
+		if pending.UsedTokens == nil {
+			pending.UsedTokens = make(map[string]bool)
+		}
+		pending.UsedTokens[token] = true
+		return nil
+	})
+	if errors.Is(err, ErrRequestNotFound) {
+		return nil // Resolved or expired; SubmitApproval reports it
+	}
+	return err
+}
+
+// signCallbacks sets the approve/reject tokens of a request's shared links, and how
+// providers that know their recipients sign links for each of them
+func (m *Manager) signCallbacks(req *Request) {
+	secret, requestID := m.callbackSecret, req.ID
+	req.ApproveToken = CallbackToken(secret, requestID, DecisionApproved, "")
+	req.RejectToken = CallbackToken(secret, requestID, DecisionRejected, "")
+	req.signApprover = func(decision Decision, approver string) string {
+		return CallbackToken(secret, requestID, decision, approver)
+	}
+}
+
+// callbackURL builds the shared approve or reject link for a request, signed when it carries a token
+func (r *Request) callbackURL(baseURL string, decision Decision, channel string) string {
+	return r.approverCallbackURL(baseURL, decision, channel, "")
+}
+
+// approverCallbackURL builds the approve or reject link of one approver, carrying their
+// identity and a token bound to it; unsigned requests get the shared link
+func (r *Request) approverCallbackURL(baseURL string, decision Decision, channel, approver string) string {
+	action, token := "approve", r.ApproveToken
+	if decision == DecisionRejected {
+		action, token = "reject", r.RejectToken
+	}
+	if approver != "" && r.signApprover == nil {
+		approver = ""
+	}
+
+	query := url.Values{}
+	if approver != "" {
+		query.Set("approver", approver)
+		token = r.signApprover(decision, approver)
+	}
+	if channel != "" {
+		query.Set("channel", channel)
+	}
+	if token != "" {
+		query.Set("token", token)
+	}
+
+	link := fmt.Sprintf("%s/api/approvals/%s/%s", baseURL, r.ID, action)
+	if encoded := query.Encode(); encoded != "" {
+		link += "?" + encoded
+	}
+	return link
+}
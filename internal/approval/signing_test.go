@@ -0,0 +1,91 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_ConsumeCallback(t *testing.T) {
+	manager := NewManager(time.Minute)
+	req := &Request{ID: "req-1"}
+	manager.signCallbacks(req)
+	_ = manager.store.Put(context.Background(), &PendingState{Request: req}, time.Minute)
+
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "", req.RejectToken); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Errorf("ConsumeCallback(reject token on approve) = %v, want ErrInvalidCallbackToken", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "", req.ApproveToken); err != nil {
+		t.Fatalf("ConsumeCallback() error = %v", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "", req.ApproveToken); !errors.Is(err, ErrCallbackTokenUsed) {
+		t.Errorf("ConsumeCallback(reused token) = %v, want ErrCallbackTokenUsed", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionRejected, "", req.RejectToken); err != nil {
+		t.Errorf("ConsumeCallback(reject token) error = %v", err)
+	}
+}
+
+func TestManager_ConsumeCallback_Approvers(t *testing.T) {
+	manager := NewManager(time.Minute)
+	req := &Request{ID: "req-1", RequiredApprovals: 2}
+	manager.signCallbacks(req)
+	_ = manager.store.Put(context.Background(), &PendingState{Request: req}, time.Minute)
+
+	// Each recipient's link approves as them, once
+	link, err := url.Parse(req.approverCallbackURL("https://pa.example.com", DecisionApproved, "email", "bob@example.com"))
+	if err != nil {
+		t.Fatalf("approverCallbackURL() error = %v", err)
+	}
+	bob, token := link.Query().Get("approver"), link.Query().Get("token")
+	if bob != "bob@example.com" {
+		t.Errorf("approver = %q, want bob@example.com", bob)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "mallory@example.com", token); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Errorf("ConsumeCallback(bob's token as mallory) = %v, want ErrInvalidCallbackToken", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, bob, token); err != nil {
+		t.Fatalf("ConsumeCallback(bob) error = %v", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, bob, token); !errors.Is(err, ErrCallbackTokenUsed) {
+		t.Errorf("ConsumeCallback(bob again) = %v, want ErrCallbackTokenUsed", err)
+	}
+	carol := req.signApprover(DecisionApproved, "carol@example.com")
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "carol@example.com", carol); err != nil {
+		t.Errorf("ConsumeCallback(carol) error = %v", err)
+	}
+
+	// Shared links can't count towards a quorum, but can still reject
+	if err := manager.ConsumeCallback("req-1", DecisionApproved, "", req.ApproveToken); !errors.Is(err, ErrApproverRequired) {
+		t.Errorf("ConsumeCallback(shared link) = %v, want ErrApproverRequired", err)
+	}
+	if err := manager.ConsumeCallback("req-1", DecisionRejected, "", req.RejectToken); err != nil {
+		t.Errorf("ConsumeCallback(shared reject link) error = %v", err)
+	}
+}
+
+func TestManager_CallbackSecret(t *testing.T) {
+	// Each manager signs with its own random key unless a shared secret is set
+	first, second := NewManager(time.Minute), NewManager(time.Minute)
+	token := CallbackToken(first.callbackSecret, "req-1", DecisionApproved, "")
+	if second.VerifyCallback("req-1", DecisionApproved, "", token) {
+		t.Error("token from one manager verified by another")
+	}
+
+	first.SetCallbackSecret("shared")
+	second.SetCallbackSecret("shared")
+	second.SetCallbackSecret("") // an empty secret keeps the current key
+	req := &Request{ID: "req-1"}
+	first.signCallbacks(req)
+	if !second.VerifyCallback("req-1", DecisionApproved, "", req.ApproveToken) {
+		t.Error("token signed with the shared secret did not verify")
+	}
+
+	link := req.callbackURL("https://pa.example.com", DecisionRejected, "slack")
+	if !strings.HasPrefix(link, "https://pa.example.com/api/approvals/req-1/reject?channel=slack&token=") {
+		t.Errorf("callbackURL() = %q, want a signed reject link", link)
+	}
+}
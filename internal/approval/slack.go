@@ -6,14 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"text/template"
 	"time"
 )
 
 // SlackProvider sends approval requests to Slack with interactive buttons
 type SlackProvider struct {
 	webhookURL string
-	apiBaseURL string // Base URL of the API server for callbacks
+	apiBaseURL string             // Base URL of the API server for callbacks
+	template   *template.Template // Custom message text (optional; replaces the default summary)
 	client     *http.Client
+	retry      retrier
 }
 
 // NewSlackProvider creates a new Slack approval provider
@@ -27,6 +31,22 @@ func NewSlackProvider(webhookURL, apiBaseURL string) *SlackProvider {
 	}
 }
 
+// SetTemplate sets a Go text/template for the approval message text (mrkdwn).
+// The rendered text replaces the default summary; the approve/reject buttons are kept.
+func (s *SlackProvider) SetTemplate(text string) error {
+	tmpl, err := parseTemplate("slack", text)
+	if err != nil {
+		return fmt.Errorf("invalid Slack template: %w", err)
+	}
+	s.template = tmpl
+	return nil
+}
+
+// SetRetry configures how failed deliveries are retried; hook, if set, is called before each retry
+func (s *SlackProvider) SetRetry(policy RetryPolicy, hook RetryHook) {
+	s.retry = retrier{policy: policy, hook: hook}
+}
+
 // slackMessage represents a Slack message with blocks
 type slackMessage struct {
 	Text        string        `json:"text"`
@@ -58,8 +78,53 @@ type slackButton struct {
 // SendApprovalRequest sends an approval request to Slack with interactive buttons
 func (s *SlackProvider) SendApprovalRequest(ctx context.Context, req *Request) error {
 	// Build Slack message with blocks
+	if s.template != nil {
+		text, err := renderTemplate(s.template, newTemplateData(req, s.apiBaseURL, "slack", ""))
+		if err != nil {
+			return err
+		}
+		message := s.buildTemplatedMessage(req, text)
+		return s.retry.do(ctx, s.GetProviderName(), req, func() error { return s.post(ctx, message) })
+	}
 	message := s.buildSlackMessage(req)
+	return s.retry.do(ctx, s.GetProviderName(), req, func() error { return s.post(ctx, message) })
+}
+
+// SendNotification posts an informational notification (no action buttons) to Slack
+func (s *SlackProvider) SendNotification(ctx context.Context, n *Notification) error {
+	message := slackMessage{
+		Text: fmt.Sprintf("⚠️ %s", n.Title),
+		Blocks: []slackBlock{
+			{
+				Type: "header",
+				Text: &slackTextBlock{Type: "plain_text", Text: "⚠️ " + n.Title},
+			},
+			{
+				Type: "section",
+				Text: &slackTextBlock{Type: "mrkdwn", Text: n.Message},
+			},
+		},
+	}
 
+	if len(n.Metadata) > 0 {
+		keys := make([]string, 0, len(n.Metadata))
+		for key := range n.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]slackTextBlock, 0, len(keys))
+		for _, key := range keys {
+			fields = append(fields, slackTextBlock{Type: "mrkdwn", Text: fmt.Sprintf("*%s:*\n%s", key, n.Metadata[key])})
+		}
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section", Fields: fields})
+	}
+
+	return s.retry.do(ctx, s.GetProviderName(), nil, func() error { return s.post(ctx, message) })
+}
+
+// post sends a message to the Slack webhook
+func (s *SlackProvider) post(ctx context.Context, message slackMessage) error {
 	jsonData, err := json.Marshal(message)
 	if err != nil {
 		return fmt.Errorf("failed to marshal Slack message: %w", err)
@@ -79,7 +144,7 @@ func (s *SlackProvider) SendApprovalRequest(ctx context.Context, req *Request) e
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("slack webhook returned non-success status: %d", resp.StatusCode)
+		return statusError(resp.StatusCode, fmt.Errorf("slack webhook returned non-success status: %d", resp.StatusCode))
 	}
 
 	return nil
@@ -90,90 +155,118 @@ func (s *SlackProvider) buildSlackMessage(req *Request) slackMessage {
 	// Determine emoji based on HTTP method
 	methodEmoji := s.getMethodEmoji(req.Method)
 
-	// Build approval URLs
-	approveURL := fmt.Sprintf("%s/api/approvals/%s/approve", s.apiBaseURL, req.ID)
-	rejectURL := fmt.Sprintf("%s/api/approvals/%s/reject", s.apiBaseURL, req.ID)
-
-	return slackMessage{
-		Text: fmt.Sprintf("🔐 Approval Required: %s %s", req.Method, req.Path),
-		Blocks: []slackBlock{
-			{
-				Type: "header",
-				Text: &slackTextBlock{
-					Type: "plain_text",
-					Text: "🔐 Command Approval Required",
-				},
+	blocks := []slackBlock{
+		{
+			Type: "header",
+			Text: &slackTextBlock{
+				Type: "plain_text",
+				Text: "🔐 Command Approval Required",
 			},
-			{
-				Type: "section",
-				Fields: []slackTextBlock{
-					{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("*User:*\n%s", req.Username),
-					},
-					{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("*Connection:*\n%s", req.ConnectionID),
-					},
-					{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("*Method:*\n%s %s", methodEmoji, req.Method),
-					},
-					{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("*Path:*\n`%s`", req.Path),
-					},
+		},
+		{
+			Type: "section",
+			Fields: []slackTextBlock{
+				{
+					Type: "mrkdwn",
+					Text: fmt.Sprintf("*User:*\n%s", req.Username),
 				},
-			},
-			{
-				Type: "section",
-				Text: &slackTextBlock{
+				{
 					Type: "mrkdwn",
-					Text: fmt.Sprintf("*Time:*\n%s", req.RequestedAt.Format(time.RFC1123)),
+					Text: fmt.Sprintf("*Connection:*\n%s", req.ConnectionID),
 				},
-			},
-			{
-				Type: "divider",
-			},
-			{
-				Type: "section",
-				Text: &slackTextBlock{
+				{
 					Type: "mrkdwn",
-					Text: "*Click a button below to approve or reject this request:*",
+					Text: fmt.Sprintf("*Method:*\n%s %s", methodEmoji, req.Method),
+				},
+				{
+					Type: "mrkdwn",
+					Text: fmt.Sprintf("*Path:*\n`%s`", req.Path),
 				},
 			},
-			{
-				Type: "actions",
-				Elements: []interface{}{
-					slackButton{
-						Type: "button",
-						Text: slackTextBlock{
-							Type: "plain_text",
-							Text: "✅ Approve",
-						},
-						URL:   approveURL,
-						Style: "primary",
-						Value: "approve",
+		},
+		{
+			Type: "section",
+			Text: &slackTextBlock{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Time:*\n%s", req.RequestedAt.Format(time.RFC1123)),
+			},
+		},
+	}
+	if reason := req.Metadata["reason"]; reason != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackTextBlock{Type: "mrkdwn", Text: fmt.Sprintf("*Reason:*\n%s", reason)},
+		})
+	}
+
+	return slackMessage{
+		Text:   fmt.Sprintf("🔐 Approval Required: %s %s", req.Method, req.Path),
+		Blocks: append(blocks, s.actionBlocks(req)...),
+	}
+}
+
+// buildTemplatedMessage constructs a message with custom text followed by the approve/reject buttons
+func (s *SlackProvider) buildTemplatedMessage(req *Request, text string) slackMessage {
+	blocks := []slackBlock{
+		{
+			Type: "section",
+			Text: &slackTextBlock{Type: "mrkdwn", Text: text},
+		},
+	}
+	return slackMessage{
+		Text:   text,
+		Blocks: append(blocks, s.actionBlocks(req)...),
+	}
+}
+
+// actionBlocks returns the approve/reject buttons and request footer shared by every approval message
+func (s *SlackProvider) actionBlocks(req *Request) []slackBlock {
+	// Build approval URLs
+	approveURL := req.callbackURL(s.apiBaseURL, DecisionApproved, "slack")
+	rejectURL := req.callbackURL(s.apiBaseURL, DecisionRejected, "slack")
+
+	return []slackBlock{
+		{
+			Type: "divider",
+		},
+		{
+			Type: "section",
+			Text: &slackTextBlock{
+				Type: "mrkdwn",
+				Text: "*Click a button below to approve or reject this request:*",
+			},
+		},
+		{
+			Type: "actions",
+			Elements: []interface{}{
+				slackButton{
+					Type: "button",
+					Text: slackTextBlock{
+						Type: "plain_text",
+						Text: "✅ Approve",
 					},
-					slackButton{
-						Type: "button",
-						Text: slackTextBlock{
-							Type: "plain_text",
-							Text: "❌ Reject",
-						},
-						URL:   rejectURL,
-						Style: "danger",
-						Value: "reject",
+					URL:   approveURL,
+					Style: "primary",
+					Value: "approve",
+				},
+				slackButton{
+					Type: "button",
+					Text: slackTextBlock{
+						Type: "plain_text",
+						Text: "❌ Reject",
 					},
+					URL:   rejectURL,
+					Style: "danger",
+					Value: "reject",
 				},
 			},
-			{
-				Type: "context",
-				Elements: []interface{}{
-					slackTextBlock{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("Request ID: `%s` | This request will timeout in 5 minutes", req.ID),
-					},
+		},
+		{
+			Type: "context",
+			Elements: []interface{}{
+				slackTextBlock{
+					Type: "mrkdwn",
+					Text: fmt.Sprintf("Request ID: `%s` | This request will timeout in 5 minutes", req.ID),
 				},
 			},
 		},
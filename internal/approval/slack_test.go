@@ -0,0 +1,52 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlackProvider_Template(t *testing.T) {
+	var received slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := NewSlackProvider(server.URL, "https://pa.example.com")
+	if err := provider.SetTemplate("*{{.Username}}* needs approval on {{.ConnectionName}}: `{{.Method}} {{.Path}}`"); err != nil {
+		t.Fatalf("SetTemplate() error = %v", err)
+	}
+
+	err := provider.SendApprovalRequest(context.Background(), &Request{
+		ID:           "req-1",
+		Username:     "alice",
+		ConnectionID: "conn-1",
+		Method:       "DELETE",
+		Path:         "/users/1",
+		RequestedAt:  time.Now(),
+		Metadata:     map[string]string{"connection_name": "users-api"},
+	})
+	if err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	want := "*alice* needs approval on users-api: `DELETE /users/1`"
+	if received.Text != want || len(received.Blocks) == 0 || received.Blocks[0].Text.Text != want {
+		t.Errorf("message = %+v, want the rendered template first", received)
+	}
+
+	hasActions := false
+	for _, block := range received.Blocks {
+		if block.Type == "actions" {
+			hasActions = true
+		}
+	}
+	if !hasActions {
+		t.Error("templated message has no approve/reject buttons")
+	}
+}
@@ -0,0 +1,192 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// ErrRequestNotFound is returned by a Store for an unknown or expired request
+var ErrRequestNotFound = errors.New("approval request not found")
+
+// ErrSelfApproval is returned when the user who asked for access approves their own request
+var ErrSelfApproval = errors.New("requesters cannot approve their own request")
+
+// errAlreadyResolved aborts a store update on a request that already has a decision
+var errAlreadyResolved = errors.New("approval request already resolved")
+
+// storeTimeout bounds each store operation
+const storeTimeout = 5 * time.Second
+
+// storeTTLMargin keeps stored requests past their timeout, so the replica waiting on
+// one can still record the timeout; the waiter deletes it when done
+const storeTTLMargin = time.Minute
+
+// defaultStorePollInterval is how often a waiting request checks the store for a
+// decision made on another replica
+const defaultStorePollInterval = time.Second
+
+// Store holds pending requests and their decisions. The default keeps them in memory;
+// a shared store (Redis) lets any replica behind a load balancer take the approve or
+// reject callback for a request another replica is waiting on.
+type Store interface {
+	// Put stores a new pending request, expiring after ttl
+	Put(ctx context.Context, state *PendingState, ttl time.Duration) error
+	// Get returns a stored request, or ErrRequestNotFound
+	Get(ctx context.Context, id string) (*PendingState, error)
+	// Update atomically applies fn to a stored request and returns the result; an error
+	// from fn aborts the update and is returned. fn may run more than once.
+	Update(ctx context.Context, id string, fn func(*PendingState) error) (*PendingState, error)
+	// Delete removes a request
+	Delete(ctx context.Context, id string) error
+	// List returns all stored requests
+	List(ctx context.Context) ([]*PendingState, error)
+}
+
+// PendingState is a request awaiting a decision, with the approvals recorded so far
+type PendingState struct {
+	Request   *Request      `json:"request"`
+	Approvers []string      `json:"approvers,omitempty"`
+	Ledger    []LedgerEntry `json:"ledger,omitempty"`
+	// UsedTokens holds the approve/reject tokens already used, so each link works once
+	UsedTokens map[string]bool `json:"used_tokens,omitempty"`
+	Resolved   bool            `json:"resolved,omitempty"`
+	Outcome    *Response       `json:"outcome,omitempty"` // Final decision, once resolved
+}
+
+// apply records a decision by approvedBy, returning the final response once the request
+// is decided: on a rejection, or when an approval reaches the quorum. The requester may
+// withdraw (reject) their request but never counts toward its quorum (ErrSelfApproval).
+func (s *PendingState) apply(channel string, decision Decision, approvedBy, reason string, now time.Time) (*SubmitResult, *Response, error) {
+	result := &SubmitResult{
+		Approvals: len(s.Approvers),
+		Required:  s.Request.RequiredApprovals,
+	}
+
+	if decision == DecisionApproved {
+		if config.SameUsername(approvedBy, s.Request.Username) {
+			return nil, nil, ErrSelfApproval
+		}
+		for _, existing := range s.Approvers {
+			if existing == approvedBy {
+				result.Duplicate = true
+				return result, nil, nil
+			}
+		}
+
+		s.Approvers = append(s.Approvers, approvedBy)
+		s.Ledger = recordResponse(s.Ledger, channel, approvedBy, decision, now)
+		result.Approvals = len(s.Approvers)
+
+		// Wait for more approvers
+		if result.Approvals < result.Required {
+			return result, nil, nil
+		}
+	} else {
+		s.Ledger = recordResponse(s.Ledger, channel, approvedBy, decision, now)
+	}
+
+	response := &Response{
+		RequestID:   s.Request.ID,
+		Decision:    decision,
+		ApprovedBy:  approvedBy,
+		Approvers:   append([]string(nil), s.Approvers...),
+		Reason:      reason,
+		RespondedAt: now,
+		Channel:     channel,
+		Ledger:      append([]LedgerEntry(nil), s.Ledger...),
+	}
+	if decision == DecisionApproved {
+		response.ApprovedBy = strings.Join(s.Approvers, ", ")
+	}
+	return result, response, nil
+}
+
+// clone copies the state's mutable fields
+func (s *PendingState) clone() *PendingState {
+	c := *s
+	c.Approvers = append([]string(nil), s.Approvers...)
+	c.Ledger = append([]LedgerEntry(nil), s.Ledger...)
+	if s.UsedTokens != nil {
+		c.UsedTokens = make(map[string]bool, len(s.UsedTokens))
+		for token := range s.UsedTokens {
+			c.UsedTokens[token] = true
+		}
+	}
+	return &c
+}
+
+// memoryStore is the default Store, private to one process. Requests are deleted by
+// the waiter that created them, so the TTL is not needed.
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[string]*PendingState
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{states: make(map[string]*PendingState)}
+}
+
+func (s *memoryStore) Put(ctx context.Context, state *PendingState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.Request.ID] = state.clone()
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (*PendingState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	return state.clone(), nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, id string, fn func(*PendingState) error) (*PendingState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	updated := state.clone()
+	if err := fn(updated); err != nil {
+		return nil, err
+	}
+	s.states[id] = updated
+	return updated.clone(), nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, id)
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context) ([]*PendingState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]*PendingState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, state.clone())
+	}
+	return states, nil
+}
+
+// SetStore replaces the in-memory store, e.g. with a RedisStore shared by all replicas.
+// Replicas sharing a store must also share the callback secret (SetCallbackSecret).
+func (m *Manager) SetStore(store Store) {
+	m.store = store
+}
+
+// storeContext returns the context bounding one store operation
+func (m *Manager) storeContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), storeTimeout)
+}
@@ -0,0 +1,390 @@
+package approval
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// redisUpdateAttempts bounds retries of an update that raced another replica's write
+const redisUpdateAttempts = 10
+
+// redisMaxIdleConns is the number of idle connections kept for reuse
+const redisMaxIdleConns = 4
+
+// RedisStore shares pending approval requests between replicas through Redis.
+// Each request is a JSON value at <prefix><id> that expires after the request's
+// timeout; <prefix>index is a set of the stored IDs, for listing. Updates are
+// optimistic transactions (WATCH/MULTI/EXEC), retried when another replica wins.
+type RedisStore struct {
+	address   string
+	username  string
+	password  string
+	db        int
+	prefix    string
+	tlsConfig *tls.Config
+	idle      chan *redisConn
+}
+
+// NewRedisStore creates a Redis-backed approval store
+func NewRedisStore(cfg config.RedisApprovalStoreConfig) (*RedisStore, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "port-authorizing:approval:"
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis address %q: %w", cfg.Address, err)
+		}
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+
+	password := cfg.Password
+	if password == "" {
+		password = os.Getenv("REDIS_PASSWORD")
+	}
+
+	return &RedisStore{
+		address:   cfg.Address,
+		username:  cfg.Username,
+		password:  password,
+		db:        cfg.DB,
+		prefix:    prefix,
+		tlsConfig: tlsConfig,
+		idle:      make(chan *redisConn, redisMaxIdleConns),
+	}, nil
+}
+
+// Put stores a new pending request
+func (s *RedisStore) Put(ctx context.Context, state *PendingState, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode approval request: %w", err)
+	}
+
+	return s.withConn(ctx, func(conn *redisConn) error {
+		if _, err := conn.do("SET", s.key(state.Request.ID), string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+			return err
+		}
+		_, err := conn.do("SADD", s.indexKey(), state.Request.ID)
+		return err
+	})
+}
+
+// Get returns a stored request
+func (s *RedisStore) Get(ctx context.Context, id string) (*PendingState, error) {
+	var state *PendingState
+	err := s.withConn(ctx, func(conn *redisConn) error {
+		reply, err := conn.do("GET", s.key(id))
+		if err != nil {
+			return err
+		}
+		state, err = decodePendingState(reply)
+		return err
+	})
+	return state, err
+}
+
+// Update applies fn to a stored request in a WATCH/MULTI/EXEC transaction, retrying
+// when the request was modified concurrently
+func (s *RedisStore) Update(ctx context.Context, id string, fn func(*PendingState) error) (*PendingState, error) {
+	var updated *PendingState
+	err := s.withConn(ctx, func(conn *redisConn) error {
+		key := s.key(id)
+		for attempt := 0; attempt < redisUpdateAttempts; attempt++ {
+			if _, err := conn.do("WATCH", key); err != nil {
+				return err
+			}
+			reply, err := conn.do("GET", key)
+			if err != nil {
+				return err
+			}
+			state, err := decodePendingState(reply)
+			if err == nil {
+				err = fn(state)
+			}
+			if err != nil {
+				if _, unwatchErr := conn.do("UNWATCH"); unwatchErr != nil {
+					return unwatchErr
+				}
+				return err
+			}
+
+			ttl, err := conn.do("PTTL", key)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(state)
+			if err != nil {
+				return fmt.Errorf("failed to encode approval request: %w", err)
+			}
+			set := []string{"SET", key, string(data)}
+			if ms, ok := ttl.(int64); ok && ms > 0 {
+				set = append(set, "PX", strconv.FormatInt(ms, 10))
+			}
+
+			if _, err := conn.do("MULTI"); err != nil {
+				return err
+			}
+			if _, err := conn.do(set...); err != nil {
+				_, _ = conn.do("DISCARD")
+				return err
+			}
+			result, err := conn.do("EXEC")
+			if err != nil {
+				return err
+			}
+			if result != nil { // A nil reply means the key changed after WATCH
+				updated = state
+				return nil
+			}
+		}
+		return fmt.Errorf("approval request %s kept changing; giving up after %d attempts", id, redisUpdateAttempts)
+	})
+	return updated, err
+}
+
+// Delete removes a request
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	return s.withConn(ctx, func(conn *redisConn) error {
+		if _, err := conn.do("DEL", s.key(id)); err != nil {
+			return err
+		}
+		_, err := conn.do("SREM", s.indexKey(), id)
+		return err
+	})
+}
+
+// List returns all stored requests, dropping expired ones from the index
+func (s *RedisStore) List(ctx context.Context) ([]*PendingState, error) {
+	var states []*PendingState
+	err := s.withConn(ctx, func(conn *redisConn) error {
+		reply, err := conn.do("SMEMBERS", s.indexKey())
+		if err != nil {
+			return err
+		}
+		members, _ := reply.([]interface{})
+		for _, member := range members {
+			id, _ := member.([]byte)
+			reply, err := conn.do("GET", s.key(string(id)))
+			if err != nil {
+				return err
+			}
+			state, err := decodePendingState(reply)
+			if errors.Is(err, ErrRequestNotFound) {
+				// Expired, e.g. its replica stopped before cleaning up
+				if _, err := conn.do("SREM", s.indexKey(), string(id)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+func (s *RedisStore) key(id string) string {
+	return s.prefix + id
+}
+
+func (s *RedisStore) indexKey() string {
+	return s.prefix + "index"
+}
+
+// decodePendingState parses a GET reply (nil when the key does not exist)
+func decodePendingState(reply interface{}) (*PendingState, error) {
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	var state PendingState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode approval request: %w", err)
+	}
+	if state.Request == nil {
+		return nil, fmt.Errorf("stored approval request has no request")
+	}
+	return &state, nil
+}
+
+// withConn runs fn on a pooled connection, bounded by ctx. Connections left broken
+// by an I/O error are closed instead of being returned to the pool.
+func (s *RedisStore) withConn(ctx context.Context, fn func(*redisConn) error) error {
+	var conn *redisConn
+	select {
+	case conn = <-s.idle:
+	default:
+		var err error
+		if conn, err = s.dial(ctx); err != nil {
+			return fmt.Errorf("failed to connect to redis: %w", err)
+		}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(storeTimeout)
+	}
+	_ = conn.conn.SetDeadline(deadline)
+
+	err := fn(conn)
+	if conn.broken {
+		_ = conn.conn.Close()
+		return err
+	}
+
+	select {
+	case s.idle <- conn:
+	default:
+		_ = conn.conn.Close()
+	}
+	return err
+}
+
+// dial opens a connection, authenticating and selecting the database
+func (s *RedisStore) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: storeTimeout}
+	var netConn net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", s.address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", s.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = netConn.SetDeadline(deadline)
+	}
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := conn.do(args...); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn speaks RESP over one connection
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	broken bool // An I/O error left the connection in an unknown state
+}
+
+// do sends a command and reads its reply: string (status), int64, []byte (bulk),
+// []interface{} (array) or nil; error replies are returned as redisError
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		c.broken = true
+		return nil, err
+	}
+
+	reply, err := c.readReply()
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.broken = true
+	}
+	return reply, err
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2) // Including the trailing CRLF
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = redisErr // Per-command error inside EXEC
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
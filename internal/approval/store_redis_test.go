@@ -0,0 +1,390 @@
+package approval
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// fakeRedis is a minimal in-memory Redis speaking the commands RedisStore uses
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	expiry   map[string]time.Time
+	versions map[string]int // Bumped on every write, for WATCH
+	sets     map[string]map[string]bool
+	password string
+	authed   []string // AUTH arguments received
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	fr := &fakeRedis{
+		values:   map[string]string{},
+		expiry:   map[string]time.Time{},
+		versions: map[string]int{},
+		sets:     map[string]map[string]bool{},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	return fr, listener.Addr().String()
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	watched := map[string]int{}
+	var queued [][]string
+	inMulti := false
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+
+		fr.mu.Lock()
+		var reply string
+		switch {
+		case inMulti && name != "EXEC" && name != "DISCARD":
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		case name == "WATCH":
+			for _, key := range args[1:] {
+				watched[key] = fr.versions[key]
+			}
+			reply = "+OK\r\n"
+		case name == "UNWATCH":
+			watched = map[string]int{}
+			reply = "+OK\r\n"
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			reply = "+OK\r\n"
+		case name == "DISCARD":
+			inMulti, queued, watched = false, nil, map[string]int{}
+			reply = "+OK\r\n"
+		case name == "EXEC":
+			changed := false
+			for key, version := range watched {
+				if fr.versions[key] != version {
+					changed = true
+				}
+			}
+			if changed {
+				reply = "*-1\r\n"
+			} else {
+				reply = fmt.Sprintf("*%d\r\n", len(queued))
+				for _, cmd := range queued {
+					reply += fr.exec(cmd)
+				}
+			}
+			inMulti, queued, watched = false, nil, map[string]int{}
+		default:
+			reply = fr.exec(args)
+		}
+		fr.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one command; must be called with fr.mu held
+func (fr *fakeRedis) exec(args []string) string {
+	fr.expire()
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		fr.authed = args[1:]
+		if args[len(args)-1] != fr.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		key := args[1]
+		fr.values[key] = args[2]
+		fr.versions[key]++
+		delete(fr.expiry, key)
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			fr.expiry[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "GET":
+		value, ok := fr.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "PTTL":
+		expiry, ok := fr.expiry[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(expiry).Milliseconds())
+	case "DEL":
+		_, ok := fr.values[args[1]]
+		delete(fr.values, args[1])
+		fr.versions[args[1]]++
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "SADD":
+		if fr.sets[args[1]] == nil {
+			fr.sets[args[1]] = map[string]bool{}
+		}
+		fr.sets[args[1]][args[2]] = true
+		return ":1\r\n"
+	case "SREM":
+		delete(fr.sets[args[1]], args[2])
+		return ":1\r\n"
+	case "SMEMBERS":
+		reply := fmt.Sprintf("*%d\r\n", len(fr.sets[args[1]]))
+		for member := range fr.sets[args[1]] {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(member), member)
+		}
+		return reply
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// expire drops keys past their TTL; must be called with fr.mu held
+func (fr *fakeRedis) expire() {
+	for key, expiry := range fr.expiry {
+		if time.Now().After(expiry) {
+			delete(fr.values, key)
+			delete(fr.expiry, key)
+			fr.versions[key]++
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil { // $<len>
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	fr, addr := newFakeRedis(t)
+	fr.password = "secret"
+
+	store, err := NewRedisStore(config.RedisApprovalStoreConfig{Address: addr, Username: "pa", Password: "secret", DB: 2})
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrRequestNotFound) {
+		t.Fatalf("Get(missing) error = %v, want ErrRequestNotFound", err)
+	}
+
+	req := &Request{ID: "req-1", Username: "alice", Method: "DELETE", Path: "/users/1", RequiredApprovals: 2,
+		Escalation: &Escalation{After: time.Second}}
+	if err := store.Put(ctx, &PendingState{Request: req}, time.Minute); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if strings.Join(fr.authed, " ") != "pa secret" {
+		t.Errorf("AUTH arguments = %v, want user and password", fr.authed)
+	}
+	if _, ok := fr.values["port-authorizing:approval:req-1"]; !ok {
+		t.Fatalf("stored keys = %v, want the request under the default prefix", fr.values)
+	}
+
+	updated, err := store.Update(ctx, "req-1", func(state *PendingState) error {
+		state.Approvers = append(state.Approvers, "bob")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(updated.Approvers) != 1 || updated.Request.Username != "alice" {
+		t.Errorf("Update() = %+v, want bob's approval on alice's request", updated)
+	}
+	if pttl := time.Until(fr.expiry["port-authorizing:approval:req-1"]); pttl <= 0 || pttl > time.Minute {
+		t.Errorf("TTL after update = %v, want the original expiry kept", pttl)
+	}
+
+	// An error from fn aborts the update
+	if _, err := store.Update(ctx, "req-1", func(state *PendingState) error {
+		state.Approvers = nil
+		return ErrCallbackTokenUsed
+	}); !errors.Is(err, ErrCallbackTokenUsed) {
+		t.Errorf("Update() error = %v, want fn's error", err)
+	}
+
+	// A write by another replica between WATCH and EXEC makes the update retry
+	calls := 0
+	if _, err := store.Update(ctx, "req-1", func(state *PendingState) error {
+		calls++
+		if calls == 1 {
+			fr.mu.Lock()
+			fr.versions["port-authorizing:approval:req-1"]++
+			fr.mu.Unlock()
+		}
+		state.Approvers = append(state.Approvers, "carol")
+		return nil
+	}); err != nil {
+		t.Fatalf("Update() with a concurrent write error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want a retry after the concurrent write", calls)
+	}
+
+	state, err := store.Get(ctx, "req-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if strings.Join(state.Approvers, ",") != "bob,carol" || state.Request.Escalation != nil {
+		t.Errorf("Get() = %+v, want both approvals and no escalator", state)
+	}
+
+	// Expired requests are dropped from the listing and the index
+	if err := store.Put(ctx, &PendingState{Request: &Request{ID: "req-2"}}, time.Millisecond); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	states, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(states) != 1 || states[0].Request.ID != "req-1" {
+		t.Errorf("List() = %+v, want only req-1", states)
+	}
+	if fr.sets["port-authorizing:approval:index"]["req-2"] {
+		t.Error("expired request left in the index")
+	}
+
+	if err := store.Delete(ctx, "req-1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "req-1"); !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrRequestNotFound", err)
+	}
+}
+
+func TestManager_SharedStoreAcrossReplicas(t *testing.T) {
+	_, addr := newFakeRedis(t)
+
+	// Two replicas behind a load balancer, sharing the store and the link secret
+	replicas := make([]*Manager, 2)
+	for i := range replicas {
+		store, err := NewRedisStore(config.RedisApprovalStoreConfig{Address: addr})
+		if err != nil {
+			t.Fatalf("NewRedisStore() error = %v", err)
+		}
+		replicas[i] = NewManager(time.Minute)
+		replicas[i].SetStore(store)
+		replicas[i].SetCallbackSecret("shared")
+		replicas[i].pollInterval = 10 * time.Millisecond
+		replicas[i].RegisterProvider(&mockProvider{name: "webhook"})
+	}
+	owner, other := replicas[0], replicas[1]
+
+	type outcome struct {
+		response *Response
+		err      error
+	}
+	done := make(chan outcome, 1)
+	req := &Request{Username: "alice", Method: "DELETE", Path: "/users/1", RequiredApprovals: 2}
+	go func() {
+		response, err := owner.RequestApproval(context.Background(), req, 5*time.Second)
+		done <- outcome{response, err}
+	}()
+
+	// The other replica sees the request
+	var pending []PendingEntry
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pending = other.ListPendingRequests()
+	}
+	if len(pending) != 1 || pending[0].Username != "alice" {
+		t.Fatalf("ListPendingRequests() on the other replica = %+v, want alice's request", pending)
+	}
+	requestID := pending[0].RequestID
+
+	// Approvals arrive at both replicas; links signed by the owner verify on the other
+	if result, err := owner.SubmitApproval(requestID, DecisionApproved, "bob", ""); err != nil || result.Resolved {
+		t.Fatalf("first approval = %+v, %v, want recorded without quorum", result, err)
+	}
+	token := CallbackToken("shared", requestID, DecisionApproved, "carol")
+	if err := other.ConsumeCallback(requestID, DecisionApproved, "carol", token); err != nil {
+		t.Fatalf("ConsumeCallback() on the other replica error = %v", err)
+	}
+	if err := owner.ConsumeCallback(requestID, DecisionApproved, "carol", token); !errors.Is(err, ErrCallbackTokenUsed) {
+		t.Errorf("ConsumeCallback() reused on the owner = %v, want ErrCallbackTokenUsed", err)
+	}
+	result, err := other.SubmitApprovalFrom(requestID, "slack", DecisionApproved, "carol", "")
+	if err != nil || !result.Resolved || result.Approvals != 2 {
+		t.Fatalf("second approval = %+v, %v, want quorum reached", result, err)
+	}
+
+	select {
+	case got := <-done:
+		if got.err != nil {
+			t.Fatalf("RequestApproval() error = %v", got.err)
+		}
+		if got.response.Decision != DecisionApproved || got.response.ApprovedBy != "bob, carol" || got.response.Channel != "slack" {
+			t.Errorf("response = %+v, want approved by bob and carol via slack", got.response)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("owner did not learn of the decision made on the other replica")
+	}
+
+	// Both replicas record the decision once, and the request is gone from the store
+	for i, replica := range replicas {
+		if history := replica.GetHistory(0); len(history) != 1 || history[0].Decision != DecisionApproved {
+			t.Errorf("replica %d history = %+v, want the approval", i, history)
+		}
+	}
+	if count := other.GetPendingRequestsCount(); count != 0 {
+		t.Errorf("pending requests after the decision = %d, want 0", count)
+	}
+	if _, err := other.SubmitApproval(requestID, DecisionRejected, "mallory", ""); err == nil {
+		t.Error("decision on a resolved request should fail")
+	}
+}
@@ -0,0 +1,89 @@
+package approval
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// templateData is the data available to approval message templates (email, Slack, webhook)
+type templateData struct {
+	RequestID         string
+	Username          string
+	ConnectionID      string
+	ConnectionName    string
+	ConnectionType    string
+	Method            string
+	Path              string
+	Body              string
+	Reason            string // Justification the user gave when connecting (optional)
+	RequestedAt       string
+	Metadata          map[string]string
+	Tags              []string
+	RequiredApprovals int
+	ApproveURL        string
+	RejectURL         string
+}
+
+// newTemplateData builds the template data for a request, with callback links for a channel
+// and, when the recipient is known, bound to the approver
+func newTemplateData(req *Request, apiBaseURL, channel, approver string) templateData {
+	data := templateData{
+		RequestID:         req.ID,
+		Username:          req.Username,
+		ConnectionID:      req.ConnectionID,
+		ConnectionName:    req.Metadata["connection_name"],
+		ConnectionType:    req.Metadata["connection_type"],
+		Method:            req.Method,
+		Path:              req.Path,
+		Body:              req.Body,
+		Reason:            req.Metadata["reason"],
+		RequestedAt:       req.RequestedAt.Format(time.RFC1123),
+		Metadata:          req.Metadata,
+		Tags:              req.Tags,
+		RequiredApprovals: req.RequiredApprovals,
+		ApproveURL:        req.approverCallbackURL(apiBaseURL, DecisionApproved, channel, approver),
+		RejectURL:         req.approverCallbackURL(apiBaseURL, DecisionRejected, channel, approver),
+	}
+	if data.ConnectionName == "" {
+		data.ConnectionName = req.ConnectionID
+	}
+	if data.RequiredApprovals < 1 {
+		data.RequiredApprovals = 1
+	}
+	return data
+}
+
+// parseTemplate parses a message template and renders it once against a sample
+// request, so unknown fields fail at startup rather than when approval is needed
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := &Request{
+		ID:           "sample",
+		Username:     "alice",
+		ConnectionID: "conn-1",
+		Method:       "GET",
+		Path:         "/",
+		RequestedAt:  time.Now(),
+		Metadata:     map[string]string{"connection_name": "sample", "connection_type": "http"},
+		Tags:         []string{"env:test"},
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, newTemplateData(sample, "", "", "")); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderTemplate executes a message template for a request
+func renderTemplate(tmpl *template.Template, data templateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
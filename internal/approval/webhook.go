@@ -6,25 +6,47 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 )
 
 // WebhookProvider sends approval requests to a generic webhook endpoint
+// With a secret, each body is signed with HMAC-SHA256 in the X-PA-Signature header.
 type WebhookProvider struct {
 	webhookURL string
+	secret     string
+	template   *template.Template // Renders the payload's message field (optional)
 	client     *http.Client
+	retry      retrier
 }
 
-// NewWebhookProvider creates a new webhook approval provider
-func NewWebhookProvider(webhookURL string) *WebhookProvider {
+// NewWebhookProvider creates a new webhook approval provider (secret may be empty)
+func NewWebhookProvider(webhookURL, secret string) *WebhookProvider {
 	return &WebhookProvider{
 		webhookURL: webhookURL,
+		secret:     secret,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
 }
 
+// SetTemplate sets a Go text/template rendered into the message field of every
+// approval payload; the rest of the payload is unchanged
+func (w *WebhookProvider) SetTemplate(text string) error {
+	tmpl, err := parseTemplate("webhook", text)
+	if err != nil {
+		return fmt.Errorf("invalid webhook template: %w", err)
+	}
+	w.template = tmpl
+	return nil
+}
+
+// SetRetry configures how failed deliveries are retried; hook, if set, is called before each retry
+func (w *WebhookProvider) SetRetry(policy RetryPolicy, hook RetryHook) {
+	w.retry = retrier{policy: policy, hook: hook}
+}
+
 // webhookPayload is the payload sent to the webhook
 type webhookPayload struct {
 	RequestID    string            `json:"request_id"`
@@ -35,7 +57,13 @@ type webhookPayload struct {
 	Body         string            `json:"body,omitempty"`
 	RequestedAt  string            `json:"requested_at"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
-	ApprovalURL  string            `json:"approval_url"` // URL to approve/reject
+	Tags         []string          `json:"tags,omitempty"`
+	Message      string            `json:"message,omitempty"` // Rendered template, when one is configured
+	ApprovalURL  string            `json:"approval_url"`      // URL to approve/reject
+	ApproveURL   string            `json:"approve_url"`       // Signed approve callback (relative to the API base URL)
+	RejectURL    string            `json:"reject_url"`        // Signed reject callback (relative to the API base URL)
+	// RequiredApprovals is the number of distinct approvers needed
+	RequiredApprovals int `json:"required_approvals"`
 }
 
 // SendApprovalRequest sends an approval request to the webhook
@@ -49,11 +77,49 @@ func (w *WebhookProvider) SendApprovalRequest(ctx context.Context, req *Request)
 		Body:         req.Body,
 		RequestedAt:  req.RequestedAt.Format(time.RFC3339),
 		Metadata:     req.Metadata,
+		Tags:         req.Tags,
 		// The approval URL should be constructed from the API base URL
 		// For now, we'll include the request ID and expect the webhook to call back
-		ApprovalURL: fmt.Sprintf("/api/approvals/%s", req.ID),
+		ApprovalURL:       fmt.Sprintf("/api/approvals/%s", req.ID),
+		ApproveURL:        req.callbackURL("", DecisionApproved, "webhook"),
+		RejectURL:         req.callbackURL("", DecisionRejected, "webhook"),
+		RequiredApprovals: req.RequiredApprovals,
+	}
+
+	if w.template != nil {
+		message, err := renderTemplate(w.template, newTemplateData(req, "", "webhook", ""))
+		if err != nil {
+			return err
+		}
+		payload.Message = message
 	}
 
+	return w.retry.do(ctx, w.GetProviderName(), req, func() error { return w.post(ctx, payload) })
+}
+
+// webhookNotificationPayload is the payload sent for informational notifications
+type webhookNotificationPayload struct {
+	Type     string            `json:"type"` // Always "notification"
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	SentAt   string            `json:"sent_at"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SendNotification sends an informational notification to the webhook
+func (w *WebhookProvider) SendNotification(ctx context.Context, n *Notification) error {
+	payload := webhookNotificationPayload{
+		Type:     "notification",
+		Title:    n.Title,
+		Message:  n.Message,
+		SentAt:   n.SentAt.Format(time.RFC3339),
+		Metadata: n.Metadata,
+	}
+	return w.retry.do(ctx, w.GetProviderName(), nil, func() error { return w.post(ctx, payload) })
+}
+
+// post sends a JSON payload to the webhook URL
+func (w *WebhookProvider) post(ctx context.Context, payload interface{}) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
@@ -66,6 +132,9 @@ func (w *WebhookProvider) SendApprovalRequest(ctx context.Context, req *Request)
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("User-Agent", "Port-Authorizing-Approval/1.0")
+	if w.secret != "" {
+		httpReq.Header.Set(SignatureHeader, SignPayload(w.secret, jsonData))
+	}
 
 	resp, err := w.client.Do(httpReq)
 	if err != nil {
@@ -74,7 +143,7 @@ func (w *WebhookProvider) SendApprovalRequest(ctx context.Context, req *Request)
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned non-success status: %d", resp.StatusCode)
+		return statusError(resp.StatusCode, fmt.Errorf("webhook returned non-success status: %d", resp.StatusCode))
 	}
 
 	return nil
@@ -2,15 +2,21 @@ package approval
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestNewWebhookProvider(t *testing.T) {
-	provider := NewWebhookProvider("https://example.com/webhook")
+	provider := NewWebhookProvider("https://example.com/webhook", "")
 
 	if provider == nil {
 		t.Fatal("NewWebhookProvider returned nil")
@@ -46,7 +52,7 @@ func TestWebhookProvider_SendApprovalRequest(t *testing.T) {
 	}))
 	defer server.Close()
 
-	provider := NewWebhookProvider(server.URL)
+	provider := NewWebhookProvider(server.URL, "")
 
 	req := &Request{
 		ID:           "test-123",
@@ -88,7 +94,7 @@ func TestWebhookProvider_SendApprovalRequest_Error(t *testing.T) {
 	}))
 	defer server.Close()
 
-	provider := NewWebhookProvider(server.URL)
+	provider := NewWebhookProvider(server.URL, "")
 
 	req := &Request{
 		ID:       "test-123",
@@ -106,7 +112,7 @@ func TestWebhookProvider_SendApprovalRequest_Error(t *testing.T) {
 }
 
 func TestWebhookProvider_SendApprovalRequest_InvalidURL(t *testing.T) {
-	provider := NewWebhookProvider("http://invalid-host-that-does-not-exist-12345")
+	provider := NewWebhookProvider("http://invalid-host-that-does-not-exist-12345", "")
 
 	req := &Request{
 		ID:       "test-123",
@@ -129,7 +135,7 @@ func BenchmarkWebhookProvider_SendApprovalRequest(b *testing.B) {
 	}))
 	defer server.Close()
 
-	provider := NewWebhookProvider(server.URL)
+	provider := NewWebhookProvider(server.URL, "")
 	req := &Request{
 		ID:       "test-123",
 		Username: "alice",
@@ -144,3 +150,122 @@ func BenchmarkWebhookProvider_SendApprovalRequest(b *testing.B) {
 		_ = provider.SendApprovalRequest(ctx, req)
 	}
 }
+
+func TestWebhookProvider_SignsPayload(t *testing.T) {
+	const secret = "webhook-secret"
+
+	var signature string
+	var body []byte
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	manager := NewManager(time.Minute)
+	manager.SetCallbackSecret(secret)
+	req := &Request{ID: "req-1", Username: "alice", Method: "DELETE", Path: "/api/users/1"}
+	manager.signCallbacks(req)
+
+	if err := NewWebhookProvider(server.URL, secret).SendApprovalRequest(context.Background(), req); err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, signature, want)
+	}
+
+	// The callback links carry tokens for their own decision only
+	approveLink, err := url.Parse(payload.ApproveURL)
+	if err != nil {
+		t.Fatalf("approve_url %q: %v", payload.ApproveURL, err)
+	}
+	token := approveLink.Query().Get("token")
+	if approveLink.Path != "/api/approvals/req-1/approve" || !manager.VerifyCallback("req-1", DecisionApproved, "", token) {
+		t.Errorf("approve_url = %q, want a signed approve link", payload.ApproveURL)
+	}
+	if manager.VerifyCallback("req-1", DecisionRejected, "", token) || manager.VerifyCallback("req-2", DecisionApproved, "", token) {
+		t.Error("approve token accepted for another decision or request")
+	}
+	if !strings.Contains(payload.RejectURL, "token="+CallbackToken(secret, "req-1", DecisionRejected, "")) {
+		t.Errorf("reject_url = %q, want a signed reject link", payload.RejectURL)
+	}
+}
+
+func TestWebhookProvider_UnsignedWithoutSecret(t *testing.T) {
+	var signature string
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req := &Request{ID: "req-1", Method: "DELETE", Path: "/api/users/1"}
+	if err := NewWebhookProvider(server.URL, "").SendApprovalRequest(context.Background(), req); err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	if signature != "" {
+		t.Errorf("%s = %q, want none without a secret", SignatureHeader, signature)
+	}
+	if payload.ApproveURL != "/api/approvals/req-1/approve?channel=webhook" {
+		t.Errorf("approve_url = %q, want an unsigned link", payload.ApproveURL)
+	}
+	if NewManager(time.Minute).VerifyCallback("req-1", DecisionApproved, "", "") {
+		t.Error("VerifyCallback() accepted a callback without a token")
+	}
+}
+
+func TestWebhookProvider_Template(t *testing.T) {
+	var receivedPayload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&receivedPayload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := NewWebhookProvider(server.URL, "")
+	err := provider.SetTemplate(`{{.Username}} wants {{.Method}} {{.Path}} on {{.ConnectionName}} ({{range .Tags}}{{.}} {{end}}) runbook: https://runbooks.example.com/{{index .Metadata "connection_name"}}`)
+	if err != nil {
+		t.Fatalf("SetTemplate() error = %v", err)
+	}
+
+	err = provider.SendApprovalRequest(context.Background(), &Request{
+		ID:           "test-123",
+		Username:     "alice",
+		ConnectionID: "conn-456",
+		Method:       "DELETE",
+		Path:         "/api/users/1",
+		RequestedAt:  time.Now(),
+		Metadata:     map[string]string{"connection_name": "users-api"},
+		Tags:         []string{"env:prod"},
+	})
+	if err != nil {
+		t.Fatalf("SendApprovalRequest() error = %v", err)
+	}
+
+	want := "alice wants DELETE /api/users/1 on users-api (env:prod ) runbook: https://runbooks.example.com/users-api"
+	if receivedPayload.Message != want {
+		t.Errorf("Message = %q, want %q", receivedPayload.Message, want)
+	}
+	if receivedPayload.RequestID != "test-123" {
+		t.Errorf("RequestID = %q, want the default payload fields alongside the message", receivedPayload.RequestID)
+	}
+}
+
+func TestWebhookProvider_TemplateValidation(t *testing.T) {
+	provider := NewWebhookProvider("http://example.com", "")
+	if err := provider.SetTemplate("{{.Username"); err == nil {
+		t.Error("SetTemplate() with a syntax error succeeded")
+	}
+	if err := provider.SetTemplate("{{.Hostname}}"); err == nil {
+		t.Error("SetTemplate() with an unknown field succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decision outcomes
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// decisionDayFormat names daily decision log files (decisions.log.2006-01-02)
+const decisionDayFormat = "2006-01-02"
+
+var (
+	decisionMu            sync.Mutex
+	decisionLogPath       string // Empty = decision log disabled
+	decisionRetentionDays int    // 0 = keep rotated files forever
+	decisionFile          *os.File
+	decisionDay           string // Day (UTC) the open decision file belongs to
+)
+
+// Decision is one authorization decision in the compliance decision log
+// Unlike operational audit entries, every field is fixed so exports stay stable.
+type Decision struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Subject      string    `json:"subject"`
+	Roles        []string  `json:"roles,omitempty"`
+	Action       string    `json:"action"` // "connect", "postgres_query" or "http_request"
+	Resource     string    `json:"resource"`
+	Request      string    `json:"request,omitempty"` // Query or "METHOD /path" for per-request checks
+	Decision     string    `json:"decision"`          // DecisionAllow or DecisionDeny
+	Policy       string    `json:"policy,omitempty"`  // Policy (or control, e.g. "geofence") that decided
+	Reason       string    `json:"reason"`
+	ConnectionID string    `json:"connection_id,omitempty"`
+}
+
+// ConfigureDecisionLog enables the decision log at path (empty to disable)
+// The file rotates daily to path.YYYY-MM-DD; rotated files older than
+// retentionDays are deleted (0 keeps them forever).
+func ConfigureDecisionLog(path string, retentionDays int) {
+	decisionMu.Lock()
+	defer decisionMu.Unlock()
+
+	if path != decisionLogPath && decisionFile != nil {
+		_ = decisionFile.Close()
+		decisionFile = nil
+		decisionDay = ""
+	}
+	if retentionDays < 0 {
+		retentionDays = 0
+	}
+	decisionLogPath = path
+	decisionRetentionDays = retentionDays
+}
+
+// DecisionLogEnabled reports whether a decision log is configured
+func DecisionLogEnabled() bool {
+	decisionMu.Lock()
+	defer decisionMu.Unlock()
+	return decisionLogPath != ""
+}
+
+// LogDecision appends an authorization decision to the decision log
+// It is a no-op when no decision log is configured.
+func LogDecision(d Decision) error {
+	decisionMu.Lock()
+	defer decisionMu.Unlock()
+
+	if decisionLogPath == "" {
+		return nil
+	}
+	if d.Timestamp.IsZero() {
+		d.Timestamp = time.Now()
+	}
+	d.Request = Redact(d.Resource, d.Request)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decision: %w", err)
+	}
+
+	file, err := openDecisionFile(d.Timestamp.UTC().Format(decisionDayFormat))
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "%s\n", data); err != nil {
+		return fmt.Errorf("failed to write decision: %w", err)
+	}
+	return nil
+}
+
+// openDecisionFile returns the decision file for day, rotating the previous
+// day's file away first. Must be called with decisionMu held.
+func openDecisionFile(day string) (*os.File, error) {
+	if decisionFile != nil && decisionDay == day {
+		return decisionFile, nil
+	}
+
+	if decisionFile != nil {
+		_ = decisionFile.Close()
+		decisionFile = nil
+	}
+
+	// A file left over from an earlier day (e.g. before a restart) is rotated too
+	if info, err := os.Stat(decisionLogPath); err == nil && info.Size() > 0 {
+		if fileDay := info.ModTime().UTC().Format(decisionDayFormat); fileDay != day {
+			if err := os.Rename(decisionLogPath, decisionLogPath+"."+fileDay); err != nil {
+				return nil, fmt.Errorf("failed to rotate decision log: %w", err)
+			}
+		}
+	}
+	pruneDecisionLogs(day)
+
+	file, err := os.OpenFile(decisionLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decision log: %w", err)
+	}
+	decisionFile = file
+	decisionDay = day
+	return file, nil
+}
+
+// pruneDecisionLogs removes rotated decision logs past the retention period
+func pruneDecisionLogs(today string) {
+	if decisionRetentionDays == 0 {
+		return
+	}
+	current, err := time.Parse(decisionDayFormat, today)
+	if err != nil {
+		return
+	}
+	cutoff := current.AddDate(0, 0, -decisionRetentionDays)
+
+	matches, _ := filepath.Glob(decisionLogPath + ".*")
+	for _, match := range matches {
+		day, err := time.Parse(decisionDayFormat, strings.TrimPrefix(match, decisionLogPath+"."))
+		if err != nil {
+			continue
+		}
+		if day.Before(cutoff) {
+			_ = os.Remove(match)
+		}
+	}
+}
+
+// closeDecisionLog closes the open decision log file
+func closeDecisionLog() {
+	decisionMu.Lock()
+	defer decisionMu.Unlock()
+
+	if decisionFile != nil {
+		_ = decisionFile.Close()
+		decisionFile = nil
+		decisionDay = ""
+	}
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogDecision_Disabled(t *testing.T) {
+	ConfigureDecisionLog("", 0)
+	if DecisionLogEnabled() {
+		t.Fatal("DecisionLogEnabled() = true with no path")
+	}
+	if err := LogDecision(Decision{Subject: "alice", Decision: DecisionAllow}); err != nil {
+		t.Errorf("LogDecision() error = %v", err)
+	}
+}
+
+func TestLogDecision_WritesStructuredRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	ConfigureDecisionLog(path, 0)
+	t.Cleanup(func() {
+		closeDecisionLog()
+		ConfigureDecisionLog("", 0)
+	})
+
+	want := Decision{
+		Subject:      "alice",
+		Roles:        []string{"developer"},
+		Action:       "postgres_query",
+		Resource:     "pg",
+		Request:      "DELETE FROM users",
+		Decision:     DecisionDeny,
+		Policy:       "whitelist",
+		Reason:       "whitelist_violation",
+		ConnectionID: "conn-1",
+	}
+	if err := LogDecision(want); err != nil {
+		t.Fatalf("LogDecision() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read decision log: %v", err)
+	}
+	var got Decision
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decision log line is not JSON: %v (%s)", err, data)
+	}
+	if got.Timestamp.IsZero() {
+		t.Error("Timestamp was not set")
+	}
+	got.Timestamp = time.Time{}
+	if got.Subject != want.Subject || got.Decision != want.Decision || got.Request != want.Request ||
+		got.Policy != want.Policy || got.Reason != want.Reason || got.ConnectionID != want.ConnectionID {
+		t.Errorf("decision = %+v, want %+v", got, want)
+	}
+}
+
+func TestLogDecision_DailyRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "decisions.log")
+
+	// Yesterday's active file and two older rotated files
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	_ = os.WriteFile(path, []byte("{}\n"), 0644)
+	_ = os.Chtimes(path, yesterday, yesterday)
+	recent := path + "." + time.Now().UTC().AddDate(0, 0, -3).Format(decisionDayFormat)
+	expired := path + "." + time.Now().UTC().AddDate(0, 0, -30).Format(decisionDayFormat)
+	_ = os.WriteFile(recent, []byte("{}\n"), 0644)
+	_ = os.WriteFile(expired, []byte("{}\n"), 0644)
+
+	ConfigureDecisionLog(path, 7)
+	t.Cleanup(func() {
+		closeDecisionLog()
+		ConfigureDecisionLog("", 0)
+	})
+
+	if err := LogDecision(Decision{Subject: "alice", Decision: DecisionAllow}); err != nil {
+		t.Fatalf("LogDecision() error = %v", err)
+	}
+
+	if _, err := os.Stat(path + "." + yesterday.Format(decisionDayFormat)); err != nil {
+		t.Errorf("yesterday's log was not rotated: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("rotated log within retention was removed: %v", err)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("rotated log past retention still exists (err = %v)", err)
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Errorf("active decision log has %d lines, want 1", n)
+	}
+}
@@ -15,14 +15,14 @@ const (
 var (
 	mu              sync.Mutex
 	logFiles        = make(map[string]*os.File)
-	recentLogs      []LogEntry
+	recentLogs      []Entry
 	maxMemoryBytes  int64 = 1 * 1024 * 1024 // Default: 1MB
 	currentMemBytes int64 = 0
 	memoryEnabled   bool  = true
 )
 
-// LogEntry represents an audit log entry
-type LogEntry struct {
+// Entry represents an audit log entry
+type Entry struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Username  string                 `json:"username"`
 	Action    string                 `json:"action"`
@@ -71,29 +71,13 @@ func Log(logPath, username, action, resource string, metadata map[string]interfa
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Get or create log file
-	logFile, exists := logFiles[logPath]
-	if !exists {
-		var err error
-		// Support stdout as special case
-		if logPath == "stdout" || logPath == "-" {
-			logFile = os.Stdout
-		} else {
-			logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-			if err != nil {
-				return fmt.Errorf("failed to open log file: %w", err)
-			}
-		}
-		logFiles[logPath] = logFile
-	}
-
 	// Create log entry
-	entry := LogEntry{
+	entry := Entry{
 		Timestamp: time.Now(),
 		Username:  username,
 		Action:    action,
 		Resource:  resource,
-		Metadata:  metadata,
+		Metadata:  redactMetadata(resource, withResourceMetadata(resource, metadata)),
 	}
 
 	// Marshal to JSON
@@ -102,9 +86,13 @@ func Log(logPath, username, action, resource string, metadata map[string]interfa
 		return fmt.Errorf("failed to marshal log entry: %w", err)
 	}
 
-	// Write to file
-	if _, err := fmt.Fprintf(logFile, "%s\n", data); err != nil {
-		return fmt.Errorf("failed to write log entry: %w", err)
+	// Route to syslog or file sink
+	if isSyslog(logPath) {
+		if err := writeSyslog(logPath, entry, data); err != nil {
+			return err
+		}
+	} else if err := writeFile(logPath, data); err != nil {
+		return err
 	}
 
 	// Also store in memory buffer for web UI (if enabled)
@@ -132,14 +120,69 @@ func Log(logPath, username, action, resource string, metadata map[string]interfa
 	return nil
 }
 
+// writeFile appends an entry to a file (or stdout) sink, rotating if needed
+// Must be called with mu held
+func writeFile(logPath string, data []byte) error {
+	logFile, err := openLogFile(logPath)
+	if err != nil {
+		return err
+	}
+
+	// Rotate before writing if the entry would exceed the size limit
+	if needsRotation(logPath, len(data)+1) {
+		if err := rotateFile(logPath); err != nil {
+			return err
+		}
+		if logFile, err = openLogFile(logPath); err != nil {
+			return err
+		}
+	}
+
+	// Write to file
+	n, err := fmt.Fprintf(logFile, "%s\n", data)
+	fileSizes[logPath] += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write log entry: %w", err)
+	}
+
+	return nil
+}
+
+// openLogFile returns the open log file for a path, opening it if needed
+// Must be called with mu held
+func openLogFile(logPath string) (*os.File, error) {
+	if logFile, exists := logFiles[logPath]; exists {
+		return logFile, nil
+	}
+
+	// Support stdout as special case
+	if isStdout(logPath) {
+		logFiles[logPath] = os.Stdout
+		return os.Stdout, nil
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	// Track current size for rotation
+	if info, err := logFile.Stat(); err == nil {
+		fileSizes[logPath] = info.Size()
+	}
+
+	logFiles[logPath] = logFile
+	return logFile, nil
+}
+
 // GetRecentLogs returns recent audit logs from memory
 // Returns empty slice if memory buffer is disabled
-func GetRecentLogs(limit int) []LogEntry {
+func GetRecentLogs(limit int) []Entry {
 	mu.Lock()
 	defer mu.Unlock()
 
 	if !memoryEnabled || len(recentLogs) == 0 {
-		return []LogEntry{}
+		return []Entry{}
 	}
 
 	if limit <= 0 || limit > len(recentLogs) {
@@ -153,7 +196,7 @@ func GetRecentLogs(limit int) []LogEntry {
 	}
 
 	// Create a copy to avoid race conditions
-	result := make([]LogEntry, limit)
+	result := make([]Entry, limit)
 	copy(result, recentLogs[start:])
 	return result
 }
@@ -170,4 +213,12 @@ func Close() {
 		}
 	}
 	logFiles = make(map[string]*os.File)
+	fileSizes = make(map[string]int64)
+
+	for _, sink := range syslogSinks {
+		sink.close()
+	}
+	syslogSinks = make(map[string]*syslogSink)
+
+	closeDecisionLog()
 }
@@ -3,6 +3,7 @@ package audit
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -274,3 +275,39 @@ func BenchmarkLog(b *testing.B) {
 		_ = Log(tmpFile.Name(), "user", "action", "target", details)
 	}
 }
+
+func TestLog_ResourceMetadata(t *testing.T) {
+	defer Close()
+	defer ConfigureResourceMetadata(nil)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	ConfigureResourceMetadata(map[string]map[string]string{
+		"prod-db": {"team": "payments", "cost_center": "cc-42", "action": "spoofed", "database": "configured"},
+	})
+
+	event := map[string]interface{}{"database": "orders"}
+	_ = Log(logPath, "alice", "postgres_query", "prod-db", event)
+	_ = Log(logPath, "alice", "connect", "staging-db", nil)
+
+	entries, _ := Query(logPath, Filter{Metadata: map[string]string{"team": "payments"}})
+	if len(entries) != 1 {
+		t.Fatalf("entries with team=payments = %d, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Action != "postgres_query" || entry.Metadata["cost_center"] != "cc-42" {
+		t.Errorf("entry = %+v, want configured metadata merged in", entry)
+	}
+	if entry.Metadata["database"] != "orders" {
+		t.Errorf("database = %v, want the event's own value", entry.Metadata["database"])
+	}
+	if _, ok := entry.Metadata["action"]; ok {
+		t.Error("reserved key action was merged into metadata")
+	}
+	if len(event) != 1 {
+		t.Errorf("caller's metadata was modified: %v", event)
+	}
+
+	if entries, _ := Query(logPath, Filter{Resource: "staging-db"}); len(entries) != 1 || entries[0].Metadata != nil {
+		t.Errorf("staging-db entries = %+v, want no metadata", entries)
+	}
+}
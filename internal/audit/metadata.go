@@ -0,0 +1,42 @@
+package audit
+
+// resourceMetadata holds configured metadata merged into every entry for a resource (connection name)
+var resourceMetadata map[string]map[string]string
+
+// reservedMetadataKeys name the core entry fields; configured metadata may not use them
+// so consumers that flatten metadata next to those fields (e.g., CSV export) stay unambiguous
+var reservedMetadataKeys = map[string]bool{
+	"timestamp": true,
+	"username":  true,
+	"action":    true,
+	"resource":  true,
+}
+
+// ConfigureResourceMetadata sets the metadata merged into every entry logged for each resource
+// (e.g., team or cost_center per connection). Keys set by the event itself always win.
+func ConfigureResourceMetadata(metadata map[string]map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resourceMetadata = metadata
+}
+
+// withResourceMetadata returns the entry metadata with the resource's configured metadata merged in.
+// The caller's map is never modified. Must be called with mu held.
+func withResourceMetadata(resource string, metadata map[string]interface{}) map[string]interface{} {
+	configured := resourceMetadata[resource]
+	if len(configured) == 0 {
+		return metadata
+	}
+
+	merged := make(map[string]interface{}, len(metadata)+len(configured))
+	for key, value := range configured {
+		if !reservedMetadataKeys[key] {
+			merged[key] = value
+		}
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Filter selects audit entries; empty fields match everything
+type Filter struct {
+	Username string
+	Action   string
+	Resource string
+	Since    time.Time
+	Until    time.Time
+	Metadata map[string]string // Metadata values the entry must have (e.g., team from connection metadata)
+	Limit    int               // Maximum entries to return (most recent), 0 for all
+}
+
+// Matches reports whether an entry satisfies the filter
+func (f Filter) Matches(entry Entry) bool {
+	if f.Username != "" && entry.Username != f.Username {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.Resource != "" && entry.Resource != f.Resource {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Timestamp.After(f.Until) {
+		return false
+	}
+	for key, want := range f.Metadata {
+		value, ok := entry.Metadata[key]
+		if !ok || fmt.Sprint(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns audit entries matching the filter, oldest first, and the total number of matches.
+// File sinks are read from disk; stdout and syslog sinks (or unreadable files) use the in-memory buffer.
+func Query(logPath string, filter Filter) ([]Entry, int) {
+	entries, err := readLogFile(logPath)
+	if err != nil {
+		entries = GetRecentLogs(0)
+	}
+
+	matched := []Entry{}
+	for _, entry := range entries {
+		if filter.Matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+
+	total := len(matched)
+	if filter.Limit > 0 && total > filter.Limit {
+		matched = matched[total-filter.Limit:]
+	}
+	return matched, total
+}
+
+// Each calls fn for every entry matching the filter, oldest first, stopping at the first error fn returns.
+// Unlike Query it never holds the log in memory: file sinks are read line by line, other sinks (or
+// unreadable files) walk the in-memory buffer. Filter.Limit is ignored.
+func Each(logPath string, filter Filter, fn func(Entry) error) error {
+	visit := func(entry Entry) error {
+		if !filter.Matches(entry) {
+			return nil
+		}
+		return fn(entry)
+	}
+
+	file, err := openLogForRead(logPath)
+	if err != nil {
+		for _, entry := range GetRecentLogs(0) {
+			if err := visit(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	defer func() { _ = file.Close() }()
+	return scanEntries(file, visit)
+}
+
+// openLogForRead opens a file sink for reading
+func openLogForRead(logPath string) (*os.File, error) {
+	if !IsFilePath(logPath) {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(logPath)
+}
+
+// readLogFile parses the entries of a file sink, skipping lines that are not valid entries
+func readLogFile(logPath string) ([]Entry, error) {
+	file, err := openLogForRead(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []Entry
+	err = scanEntries(file, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// scanEntries calls fn for each entry of a log file, skipping lines that are not valid entries
+func scanEntries(file *os.File, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
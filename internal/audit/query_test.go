@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	now := time.Now()
+	entry := Entry{Timestamp: now, Username: "alice", Action: "connect", Resource: "pg"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"username match", Filter{Username: "alice"}, true},
+		{"username mismatch", Filter{Username: "bob"}, false},
+		{"action mismatch", Filter{Action: "login"}, false},
+		{"resource match", Filter{Resource: "pg"}, true},
+		{"username is not a substring match", Filter{Username: "ali"}, false},
+		{"since before entry", Filter{Since: now.Add(-time.Minute)}, true},
+		{"since after entry", Filter{Since: now.Add(time.Minute)}, false},
+		{"until before entry", Filter{Until: now.Add(-time.Minute)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(entry); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery_File(t *testing.T) {
+	defer Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	_ = Log(logPath, "alice", "connect", "pg", nil)
+	_ = Log(logPath, "bob", "connect", "pg", nil)
+	_ = Log(logPath, "alice", "login", "api", map[string]interface{}{"ip": "127.0.0.1"})
+	_ = Log(logPath, "alice", "connect", "redis", nil)
+
+	// Unparseable lines are skipped
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	_, _ = file.WriteString("not json\n")
+	_ = file.Close()
+
+	entries, total := Query(logPath, Filter{Username: "alice"})
+	if total != 3 || len(entries) != 3 {
+		t.Fatalf("Query() returned %d entries (total %d), want 3", len(entries), total)
+	}
+	if entries[1].Action != "login" || entries[1].Metadata["ip"] != "127.0.0.1" {
+		t.Errorf("Query() entry = %+v, want typed login entry with metadata", entries[1])
+	}
+
+	entries, total = Query(logPath, Filter{Action: "connect", Limit: 2})
+	if total != 3 {
+		t.Errorf("Query() total = %d, want 3", total)
+	}
+	if len(entries) != 2 || entries[0].Username != "bob" || entries[1].Resource != "redis" {
+		t.Errorf("Query() with limit = %+v, want the 2 most recent connects", entries)
+	}
+}
+
+func TestQuery_MemoryBuffer(t *testing.T) {
+	defer Close()
+	ConfigureMemoryBuffer(0)
+	ConfigureMemoryBuffer(1)
+	defer ConfigureMemoryBuffer(1)
+
+	_ = Log("stdout", "alice", "query_test_action", "pg", nil)
+	_ = Log("stdout", "bob", "query_test_action", "pg", nil)
+
+	entries, total := Query("stdout", Filter{Action: "query_test_action", Username: "bob"})
+	if total != 1 || len(entries) != 1 || entries[0].Username != "bob" {
+		t.Errorf("Query() = %+v (total %d), want bob's entry from memory", entries, total)
+	}
+}
+
+func TestEach(t *testing.T) {
+	defer Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	_ = Log(logPath, "alice", "connect", "pg", nil)
+	_ = Log(logPath, "bob", "connect", "pg", nil)
+	_ = Log(logPath, "alice", "login", "api", nil)
+	_ = Log(logPath, "alice", "connect", "redis", nil)
+
+	var resources []string
+	err := Each(logPath, Filter{Username: "alice", Action: "connect", Limit: 1}, func(entry Entry) error {
+		resources = append(resources, entry.Resource)
+		return nil
+	})
+	if err != nil || len(resources) != 2 || resources[0] != "pg" || resources[1] != "redis" {
+		t.Errorf("Each() visited %v (err %v), want alice's connects oldest first, ignoring the limit", resources, err)
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err = Each(logPath, Filter{}, func(Entry) error {
+		visited++
+		return stop
+	})
+	if err != stop || visited != 1 {
+		t.Errorf("Each() = %v after %d entries, want the callback's error after 1", err, visited)
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"regexp"
+	"sync"
+)
+
+// RedactedValue replaces secrets masked out of audited commands and queries
+const RedactedValue = "********"
+
+// redactedFields are the metadata fields holding client payloads (SQL, SSH commands,
+// protocol commands) that redaction rules apply to
+var redactedFields = []string{"query", "statement", "command", "request"}
+
+// Redaction masks matches of Pattern in audited commands and queries
+type Redaction struct {
+	Pattern     *regexp.Regexp
+	Replacement string   // Expanded like regexp.ReplaceAllString; empty means RedactedValue
+	Resources   []string // Resources (connection names) the rule applies to; empty = all
+}
+
+// builtinRedactions mask credentials wherever they appear, before any configured rule
+var builtinRedactions = []Redaction{
+	// Redis AUTH [username] password, also inside HELLO and MIGRATE. Anchored at the
+	// command so SQL mentioning an "auth" table is left alone.
+	{Pattern: regexp.MustCompile(`(?i)^(\s*(?:HELLO\s+\S+\s+|MIGRATE\s.*\s)?AUTH2?)\s+("[^"]*"|\S+)(\s+("[^"]*"|\S+))?`), Replacement: "$1 " + RedactedValue},
+	// Redis CONFIG SET requirepass/masterauth
+	{Pattern: regexp.MustCompile(`(?i)\b(requirepass|masterauth)\s+("[^"]*"|'[^']*'|\S+)`), Replacement: "$1 " + RedactedValue},
+	// SQL [ENCRYPTED] PASSWORD '...' and IDENTIFIED BY '...'
+	{Pattern: regexp.MustCompile(`(?i)\b(PASSWORD|IDENTIFIED\s+BY)\s+'(?:[^']|'')*'`), Replacement: "$1 '" + RedactedValue + "'"},
+	// password=... in connection strings and options
+	{Pattern: regexp.MustCompile(`(?i)\b(password|passwd|pwd)=("[^"]*"|'[^']*'|[^\s;&]+)`), Replacement: "$1=" + RedactedValue},
+}
+
+var (
+	redactionMu sync.RWMutex
+	redactions  []Redaction
+)
+
+// ConfigureRedactions sets the configured redaction rules, applied after the built-in ones
+// to the command and query fields of every audit entry and decision
+func ConfigureRedactions(rules []Redaction) {
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+
+	redactions = rules
+}
+
+// redactMetadata returns the metadata with secrets masked in its payload fields.
+// The caller's map is never modified.
+func redactMetadata(resource string, metadata map[string]interface{}) map[string]interface{} {
+	var redacted map[string]interface{}
+	for _, field := range redactedFields {
+		value, ok := metadata[field].(string)
+		if !ok {
+			continue
+		}
+		masked := Redact(resource, value)
+		if masked == value {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]interface{}, len(metadata))
+			for key, value := range metadata {
+				redacted[key] = value
+			}
+		}
+		redacted[field] = masked
+	}
+	if redacted == nil {
+		return metadata
+	}
+	return redacted
+}
+
+// Redact masks secrets in a command or query logged for resource
+func Redact(resource, value string) string {
+	for _, rule := range builtinRedactions {
+		value = rule.apply(value)
+	}
+
+	redactionMu.RLock()
+	defer redactionMu.RUnlock()
+	for _, rule := range redactions {
+		if rule.appliesTo(resource) {
+			value = rule.apply(value)
+		}
+	}
+	return value
+}
+
+func (r Redaction) apply(value string) string {
+	replacement := r.Replacement
+	if replacement == "" {
+		replacement = RedactedValue
+	}
+	return r.Pattern.ReplaceAllString(value, replacement)
+}
+
+func (r Redaction) appliesTo(resource string) bool {
+	if len(r.Resources) == 0 {
+		return true
+	}
+	for _, name := range r.Resources {
+		if name == resource {
+			return true
+		}
+	}
+	return false
+}
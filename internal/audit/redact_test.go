@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedact_Builtin(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   string
+		secret string
+	}{
+		{"redis auth", "AUTH hunter2", "AUTH ********", "hunter2"},
+		{"redis auth with username", "auth default hunter2", "auth ********", "hunter2"},
+		{"redis hello auth", "HELLO 3 AUTH default hunter2 SETNAME app", "HELLO 3 AUTH ******** SETNAME app", "hunter2"},
+		{"redis requirepass", "CONFIG SET requirepass hunter2", "CONFIG SET requirepass ********", "hunter2"},
+		{"sql role password", "ALTER ROLE app WITH ENCRYPTED PASSWORD 'hun''ter2'", "ALTER ROLE app WITH ENCRYPTED PASSWORD '********'", "ter2"},
+		{"identified by", "CREATE USER app IDENTIFIED BY 'hunter2'", "CREATE USER app IDENTIFIED BY '********'", "hunter2"},
+		{"connection string", "host=db user=app password=hunter2 sslmode=require", "host=db user=app password=******** sslmode=require", "hunter2"},
+		{"sql on auth table untouched", "SELECT * FROM auth WHERE id = 1", "SELECT * FROM auth WHERE id = 1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Redact("redis", tt.value)
+			if got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if tt.secret != "" && strings.Contains(got, tt.secret) {
+				t.Errorf("Redact(%q) = %q still contains the secret", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestRedact_ConfiguredRules(t *testing.T) {
+	defer ConfigureRedactions(nil)
+	ConfigureRedactions([]Redaction{
+		{Pattern: regexp.MustCompile(`(SET \S+) .*`), Replacement: "$1 ********", Resources: []string{"cache"}},
+		{Pattern: regexp.MustCompile(`\b\d{16}\b`)},
+	})
+
+	if got := Redact("cache", "SET session:1 s3cr3t"); got != "SET session:1 ********" {
+		t.Errorf("Redact(cache) = %q, want the value masked", got)
+	}
+	if got := Redact("other", "SET session:1 s3cr3t"); got != "SET session:1 s3cr3t" {
+		t.Errorf("Redact(other) = %q, want the connection-scoped rule not applied", got)
+	}
+	if got := Redact("other", "SELECT 4111111111111111"); got != "SELECT ********" {
+		t.Errorf("Redact(other) = %q, want the global rule applied", got)
+	}
+}
+
+func TestLog_RedactsFileAndMemorySinks(t *testing.T) {
+	defer Close()
+	defer ConfigureRedactions(nil)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	ConfigureRedactions([]Redaction{{Pattern: regexp.MustCompile(`'[^']*'`), Replacement: "'?'"}})
+
+	event := map[string]interface{}{"command": "AUTH default hunter2", "connection_id": "conn-1"}
+	_ = Log(logPath, "alice", "redis_command", "cache", event)
+	_ = Log(logPath, "alice", "postgres_query", "db", map[string]interface{}{"query": "SELECT * FROM users WHERE email = 'alice@example.com'"})
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "alice@example.com"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("audit file contains %q:\n%s", secret, data)
+		}
+	}
+
+	for _, entry := range GetRecentLogs(0) {
+		for _, field := range redactedFields {
+			value, _ := entry.Metadata[field].(string)
+			if strings.Contains(value, "hunter2") || strings.Contains(value, "alice@example.com") {
+				t.Errorf("memory entry %s = %q, want it redacted", field, value)
+			}
+		}
+	}
+
+	if event["command"] != "AUTH default hunter2" {
+		t.Errorf("caller's metadata was modified: %v", event)
+	}
+}
@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	maxFileBytes    int64 = 0 // 0 = rotation disabled
+	maxBackups      int   = 0
+	compressBackups bool  = false
+	fileSizes             = make(map[string]int64)
+)
+
+// ConfigureFileRotation sets size-based rotation for file audit logs
+// maxMB: Maximum size of the active log file in megabytes (0 to disable rotation)
+// backups: Number of rotated files to keep (audit.log.1, .2, ...)
+// compress: Gzip rotated files (audit.log.1.gz, ...)
+func ConfigureFileRotation(maxMB, backups int, compress bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if maxMB <= 0 {
+		maxFileBytes = 0
+	} else {
+		maxFileBytes = int64(maxMB) * 1024 * 1024
+	}
+
+	if backups < 0 {
+		backups = 0
+	}
+	maxBackups = backups
+	compressBackups = compress
+}
+
+// isStdout reports whether a log path refers to stdout
+func isStdout(logPath string) bool {
+	return logPath == "stdout" || logPath == "-"
+}
+
+// needsRotation checks if writing n more bytes would exceed the size limit
+// Must be called with mu held
+func needsRotation(logPath string, n int) bool {
+	if maxFileBytes <= 0 || isStdout(logPath) {
+		return false
+	}
+	size := fileSizes[logPath]
+	return size > 0 && size+int64(n) > maxFileBytes
+}
+
+// rotateFile closes the active log file, shifts backups and reopens a fresh file
+// Must be called with mu held
+func rotateFile(logPath string) error {
+	if file, exists := logFiles[logPath]; exists {
+		_ = file.Close()
+		delete(logFiles, logPath)
+	}
+	delete(fileSizes, logPath)
+
+	if maxBackups == 0 {
+		if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove log file: %w", err)
+		}
+		return nil
+	}
+
+	// Drop the oldest backup, then shift the rest up by one
+	removeBackup(logPath, maxBackups)
+	for i := maxBackups - 1; i >= 1; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			from := backupName(logPath, i) + ext
+			if _, err := os.Stat(from); err == nil {
+				_ = os.Rename(from, backupName(logPath, i+1)+ext)
+			}
+		}
+	}
+
+	first := backupName(logPath, 1)
+	if err := os.Rename(logPath, first); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if compressBackups {
+		if err := compressFile(first); err != nil {
+			return fmt.Errorf("failed to compress rotated log: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// backupName returns the name of the n-th rotated file
+func backupName(logPath string, n int) string {
+	return fmt.Sprintf("%s.%d", logPath, n)
+}
+
+// removeBackup deletes the n-th rotated file (compressed or not)
+func removeBackup(logPath string, n int) {
+	_ = os.Remove(backupName(logPath, n))
+	_ = os.Remove(backupName(logPath, n) + ".gz")
+}
+
+// compressFile gzips a file to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = gz.Close()
+		_ = dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setTestRotation configures rotation with a byte-sized limit and restores defaults after the test
+func setTestRotation(t *testing.T, maxBytes int64, backups int, compress bool) {
+	t.Helper()
+
+	ConfigureFileRotation(0, backups, compress)
+	mu.Lock()
+	maxFileBytes = maxBytes
+	mu.Unlock()
+
+	t.Cleanup(func() {
+		Close()
+		ConfigureFileRotation(0, 0, false)
+	})
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return len(strings.Split(strings.TrimSpace(string(content)), "\n"))
+}
+
+func TestConfigureFileRotation(t *testing.T) {
+	ConfigureFileRotation(10, 3, true)
+	defer ConfigureFileRotation(0, 0, false)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if maxFileBytes != 10*1024*1024 {
+		t.Errorf("maxFileBytes = %d, want %d", maxFileBytes, 10*1024*1024)
+	}
+	if maxBackups != 3 {
+		t.Errorf("maxBackups = %d, want 3", maxBackups)
+	}
+	if !compressBackups {
+		t.Error("compressBackups = false, want true")
+	}
+}
+
+func TestLog_Rotation(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	setTestRotation(t, 300, 2, false)
+
+	for i := 0; i < 20; i++ {
+		if err := Log(logPath, "user", "action", "resource", map[string]interface{}{"i": i}); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+
+	for _, path := range []string{logPath, logPath + ".1", logPath + ".2"} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", path, err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s size = %d, want <= 300", path, info.Size())
+		}
+	}
+
+	if _, err := os.Stat(logPath + ".3"); !os.IsNotExist(err) {
+		t.Error("expected no more than 2 backups")
+	}
+}
+
+func TestLog_RotationCompress(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	setTestRotation(t, 300, 3, true)
+
+	for i := 0; i < 10; i++ {
+		if err := Log(logPath, "user", "action", "resource", map[string]interface{}{"i": i}); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+
+	if _, err := os.Stat(logPath + ".1"); !os.IsNotExist(err) {
+		t.Error("expected uncompressed backup to be removed")
+	}
+
+	file, err := os.Open(logPath + ".1.gz")
+	if err != nil {
+		t.Fatalf("expected compressed backup: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("failed to read compressed backup: %v", err)
+	}
+	if !strings.Contains(string(content), `"action":"action"`) {
+		t.Errorf("compressed backup missing entries: %s", content)
+	}
+}
+
+func TestLog_RotationConcurrentWrites(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	setTestRotation(t, 1024, 100, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			_ = Log(logPath, "user", "action", "resource", map[string]interface{}{"id": id})
+		}(i)
+	}
+	wg.Wait()
+
+	// Every entry must be in the active file or a backup
+	total := 0
+	files, _ := filepath.Glob(logPath + "*")
+	for _, path := range files {
+		total += countLines(t, path)
+	}
+	if total != 50 {
+		t.Errorf("found %d entries across %d files, want 50", total, len(files))
+	}
+}
+
+func TestLog_RotationNoBackups(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	setTestRotation(t, 300, 0, false)
+
+	for i := 0; i < 10; i++ {
+		if err := Log(logPath, "user", "action", "resource", map[string]interface{}{"i": i}); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+
+	if _, err := os.Stat(logPath + ".1"); !os.IsNotExist(err) {
+		t.Error("expected no backups when audit_max_backups is 0")
+	}
+	if countLines(t, logPath) >= 10 {
+		t.Error("expected active log to be truncated on rotation")
+	}
+}
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	syslogAppName = "port-authorizing"
+	// syslogPriority is facility 13 (log audit) with severity 6 (informational)
+	syslogPriority = 13*8 + 6
+	// syslogSDID is the structured data ID for audit fields (32473 is the IANA example PEN)
+	syslogSDID         = "audit@32473"
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+)
+
+var syslogSinks = make(map[string]*syslogSink)
+
+// syslogSink ships audit entries to a remote syslog server as RFC 5424 messages
+type syslogSink struct {
+	network  string // "udp" or "tcp"
+	address  string
+	hostname string
+	conn     net.Conn
+}
+
+// isSyslog reports whether a log path is a syslog URL
+// Supported: syslog://host:514 (UDP), syslog+udp://host:514, syslog+tcp://host:601
+func isSyslog(logPath string) bool {
+	return strings.HasPrefix(logPath, "syslog://") ||
+		strings.HasPrefix(logPath, "syslog+udp://") ||
+		strings.HasPrefix(logPath, "syslog+tcp://")
+}
+
+// IsFilePath reports whether a log path is a local file (not stdout or syslog),
+// i.e. whether audit history can be read back from disk
+func IsFilePath(logPath string) bool {
+	return !isStdout(logPath) && !isSyslog(logPath)
+}
+
+// newSyslogSink parses a syslog URL into a sink (connection is opened lazily)
+func newSyslogSink(logPath string) (*syslogSink, error) {
+	u, err := url.Parse(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid syslog URL %s: missing host", logPath)
+	}
+
+	network := "udp"
+	defaultPort := "514"
+	if u.Scheme == "syslog+tcp" {
+		network = "tcp"
+		defaultPort = "601"
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogSink{
+		network:  network,
+		address:  net.JoinHostPort(u.Hostname(), port),
+		hostname: hostname,
+	}, nil
+}
+
+// writeSyslog sends an entry to the syslog sink for a path
+// Must be called with mu held
+func writeSyslog(logPath string, entry Entry, data []byte) error {
+	sink, exists := syslogSinks[logPath]
+	if !exists {
+		var err error
+		sink, err = newSyslogSink(logPath)
+		if err != nil {
+			return err
+		}
+		syslogSinks[logPath] = sink
+	}
+
+	return sink.write(formatRFC5424(entry, data, sink.hostname))
+}
+
+// write sends a message, reconnecting once if the connection failed
+func (s *syslogSink) write(msg []byte) error {
+	frame := msg
+	if s.network == "tcp" {
+		// RFC 6587 octet-counting framing
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			conn, err := net.DialTimeout(s.network, s.address, syslogDialTimeout)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			s.conn = conn
+		}
+
+		_ = s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := s.conn.Write(frame); err != nil {
+			lastErr = err
+			s.close()
+			continue
+		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to write syslog entry to %s: %w", s.address, lastErr)
+}
+
+// close closes the underlying connection
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// formatRFC5424 formats an entry as an RFC 5424 syslog message.
+// The action is used as MSGID, user/resource go into structured data and the
+// full JSON entry is the message body.
+func formatRFC5424(entry Entry, data []byte, hostname string) []byte {
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	sd.WriteString(` user="` + escapeSDValue(entry.Username) + `"`)
+	sd.WriteString(` action="` + escapeSDValue(entry.Action) + `"`)
+	if entry.Resource != "" {
+		sd.WriteString(` resource="` + escapeSDValue(entry.Resource) + `"`)
+	}
+	sd.WriteString("]")
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		syslogPriority,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(hostname, 255),
+		syslogAppName,
+		os.Getpid(),
+		syslogHeaderField(entry.Action, 32),
+		sd.String(),
+		data,
+	))
+}
+
+// syslogHeaderField sanitizes a header field to printable US-ASCII without spaces
+func syslogHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// escapeSDValue escapes '"', '\' and ']' in structured data parameter values
+func escapeSDValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	return replacer.Replace(value)
+}
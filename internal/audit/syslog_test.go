@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsSyslog(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"syslog://localhost:514", true},
+		{"syslog+udp://localhost:514", true},
+		{"syslog+tcp://localhost:601", true},
+		{"audit.log", false},
+		{"stdout", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSyslog(tt.path); got != tt.want {
+			t.Errorf("isSyslog(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewSyslogSink(t *testing.T) {
+	sink, err := newSyslogSink("syslog://collector.example.com")
+	if err != nil {
+		t.Fatalf("newSyslogSink() error = %v", err)
+	}
+	if sink.network != "udp" || sink.address != "collector.example.com:514" {
+		t.Errorf("sink = %s %s, want udp collector.example.com:514", sink.network, sink.address)
+	}
+
+	sink, err = newSyslogSink("syslog+tcp://collector.example.com")
+	if err != nil {
+		t.Fatalf("newSyslogSink() error = %v", err)
+	}
+	if sink.network != "tcp" || sink.address != "collector.example.com:601" {
+		t.Errorf("sink = %s %s, want tcp collector.example.com:601", sink.network, sink.address)
+	}
+
+	if _, err := newSyslogSink("syslog://"); err == nil {
+		t.Error("newSyslogSink() expected error for missing host")
+	}
+}
+
+func TestFormatRFC5424(t *testing.T) {
+	entry := Entry{
+		Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Username:  `al"ice`,
+		Action:    "connect",
+		Resource:  "db]prod",
+	}
+
+	msg := string(formatRFC5424(entry, []byte(`{"a":1}`), "host1"))
+
+	wantPrefix := "<110>1 2025-01-02T03:04:05Z host1 port-authorizing "
+	if !strings.HasPrefix(msg, wantPrefix) {
+		t.Errorf("message = %q, want prefix %q", msg, wantPrefix)
+	}
+	if !strings.Contains(msg, ` connect [audit@32473 user="al\"ice" action="connect" resource="db\]prod"] {"a":1}`) {
+		t.Errorf("message missing MSGID/structured data/body: %q", msg)
+	}
+}
+
+func TestLog_SyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	defer Close()
+
+	logPath := "syslog://" + conn.LocalAddr().String()
+	if err := Log(logPath, "alice", "login", "api", map[string]interface{}{"ip": "127.0.0.1"}); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read syslog datagram: %v", err)
+	}
+
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<110>1 ") || !strings.Contains(msg, `user="alice"`) {
+		t.Errorf("unexpected syslog message: %q", msg)
+	}
+
+	// In-memory buffer still records the entry
+	logs := GetRecentLogs(1)
+	if len(logs) != 1 || logs[0].Action != "login" {
+		t.Errorf("GetRecentLogs() = %+v, want login entry", logs)
+	}
+}
+
+func TestLog_SyslogTCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+	defer Close()
+
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer func() { _ = c.Close() }()
+				reader := bufio.NewReader(c)
+				for {
+					// Octet-counting framing: "LEN SP MSG"
+					lenStr, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					length, _ := strconv.Atoi(strings.TrimSpace(lenStr))
+					msg := make([]byte, length)
+					if _, err := io.ReadFull(reader, msg); err != nil {
+						return
+					}
+					received <- string(msg)
+				}
+			}(conn)
+		}
+	}()
+
+	logPath := "syslog+tcp://" + listener.Addr().String()
+	if err := Log(logPath, "alice", "first", "", nil); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+
+	// Break the connection; the next write must reconnect
+	mu.Lock()
+	_ = syslogSinks[logPath].conn.Close()
+	mu.Unlock()
+
+	if err := Log(logPath, "alice", "second", "", nil); err != nil {
+		t.Fatalf("Log() after broken connection error = %v", err)
+	}
+
+	// Messages arrive on different connections, so order is not guaranteed
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			for _, action := range []string{"first", "second"} {
+				if strings.Contains(msg, `action="`+action+`"`) {
+					seen[action] = true
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for syslog messages")
+		}
+	}
+	if !seen["first"] || !seen["second"] {
+		t.Errorf("received actions = %v, want first and second", seen)
+	}
+}
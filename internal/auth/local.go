@@ -22,7 +22,7 @@ type localUser struct {
 func NewLocalProvider(users []config.User) *LocalProvider {
 	userMap := make(map[string]*localUser)
 	for _, u := range users {
-		userMap[u.Username] = &localUser{
+		userMap[config.UsernameKey(u.Username)] = &localUser{
 			username: u.Username,
 			password: u.Password,
 			roles:    u.Roles,
@@ -57,7 +57,8 @@ func (p *LocalProvider) Authenticate(credentials map[string]string) (*UserInfo,
 		return nil, fmt.Errorf("password not provided")
 	}
 
-	user, exists := p.users[username]
+	// Usernames are matched case-insensitively, ignoring surrounding whitespace
+	user, exists := p.users[config.UsernameKey(username)]
 	if !exists {
 		return nil, fmt.Errorf("invalid credentials")
 	}
@@ -77,6 +78,15 @@ func (p *LocalProvider) Authenticate(credentials map[string]string) (*UserInfo,
 	}, nil
 }
 
+// ResolveRoles returns the configured roles of a local user
+func (p *LocalProvider) ResolveRoles(username string, _ []string) ([]string, error) {
+	user, exists := p.users[config.UsernameKey(username)]
+	if !exists {
+		return nil, fmt.Errorf("user %q no longer exists", username)
+	}
+	return user.roles, nil
+}
+
 // Name returns the provider name
 func (p *LocalProvider) Name() string {
 	return p.name
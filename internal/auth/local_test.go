@@ -49,6 +49,16 @@ func TestLocalProvider_Authenticate(t *testing.T) {
 			wantRoles: []string{"developer"},
 			wantErr:   false,
 		},
+		{
+			name: "username in another case with surrounding whitespace",
+			credentials: map[string]string{
+				"username": "  Admin ",
+				"password": "admin123",
+			},
+			wantUser:  "admin",
+			wantRoles: []string{"admin", "developer"},
+			wantErr:   false,
+		},
 		{
 			name: "invalid password",
 			credentials: map[string]string{
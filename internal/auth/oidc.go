@@ -20,6 +20,7 @@ type OIDCProvider struct {
 	verifier      *oidc.IDTokenVerifier
 	rolesClaim    string
 	usernameClaim string
+	roleMapper    *oidcRoleMapper
 }
 
 // NewOIDCProvider creates a new OIDC provider
@@ -77,6 +78,11 @@ func NewOIDCProvider(cfg config.AuthProviderConfig) (*OIDCProvider, error) {
 		verifier:      verifier,
 		rolesClaim:    rolesClaim,
 		usernameClaim: usernameClaim,
+		roleMapper: &oidcRoleMapper{
+			claim:       rolesClaim,
+			mappings:    cfg.RoleMappings,
+			defaultRole: cfg.Config["default_role"],
+		},
 	}, nil
 }
 
@@ -93,6 +99,7 @@ func (p *OIDCProvider) Authenticate(credentials map[string]string) (*UserInfo, e
 	ctx := context.Background()
 
 	var rawIDToken string
+	var oauthToken *oauth2.Token
 
 	if hasToken {
 		// Direct token validation
@@ -103,6 +110,7 @@ func (p *OIDCProvider) Authenticate(credentials map[string]string) (*UserInfo, e
 		if err != nil {
 			return nil, fmt.Errorf("failed to exchange code: %w", err)
 		}
+		oauthToken = token
 
 		rawIDToken, _ = token.Extra("id_token").(string)
 		if rawIDToken == "" {
@@ -119,6 +127,7 @@ func (p *OIDCProvider) Authenticate(credentials map[string]string) (*UserInfo, e
 			if err != nil {
 				return nil, fmt.Errorf("password credentials flow failed: %w", err)
 			}
+			oauthToken = token
 
 			rawIDToken, _ = token.Extra("id_token").(string)
 			if rawIDToken == "" {
@@ -166,25 +175,26 @@ func (p *OIDCProvider) Authenticate(credentials map[string]string) (*UserInfo, e
 	email, _ := claims["email"].(string)
 
 	// Extract roles
-	roles := []string{}
-	if rolesInterface, ok := claims[p.rolesClaim]; ok {
-		_ = audit.Log("stdout", "system", "oidc_debug_roles_found", "oidc", map[string]interface{}{
-			"value": rolesInterface,
-			"type":  fmt.Sprintf("%T", rolesInterface),
-		})
-		switch v := rolesInterface.(type) {
-		case []interface{}:
-			for _, role := range v {
-				if roleStr, ok := role.(string); ok {
-					roles = append(roles, roleStr)
-				}
-			}
-		case []string:
-			roles = v
-		case string:
-			roles = []string{v}
-		}
-	} else {
+	groups, roles := p.rolesFromClaims(username, claims)
+
+	return &UserInfo{
+		Username: username,
+		Email:    email,
+		Roles:    roles,
+		Groups:   groups,
+		Metadata: map[string]string{
+			"provider":               p.name,
+			"subject":                claims["sub"].(string),
+			MetadataSessionExpiresAt: sessionExpiry(oauthToken, idTokenParsed),
+		},
+	}, nil
+}
+
+// rolesFromClaims extracts the user's groups from the roles claim and maps them to internal roles
+// The raw claim values and the mapped roles are audited to debug IdP role configuration.
+func (p *OIDCProvider) rolesFromClaims(username string, claims map[string]interface{}) ([]string, []string) {
+	raw, found := p.roleMapper.rawRoles(claims)
+	if !found {
 		availableKeys := []string{}
 		for k := range claims {
 			availableKeys = append(availableKeys, k)
@@ -194,19 +204,32 @@ func (p *OIDCProvider) Authenticate(credentials map[string]string) (*UserInfo, e
 			"available_keys": availableKeys,
 		})
 	}
-	_ = audit.Log("stdout", "system", "oidc_debug_extracted_roles", "oidc", map[string]interface{}{
-		"roles": roles,
+
+	roles := p.roleMapper.mapRoles(raw)
+	_ = audit.Log("stdout", username, "oidc_role_mapping", p.name, map[string]interface{}{
+		"roles_claim":  p.rolesClaim,
+		"claim_values": raw,
+		"roles":        roles,
+		"mapped":       len(p.roleMapper.mappings) > 0,
 	})
+	return raw, roles
+}
 
-	return &UserInfo{
-		Username: username,
-		Email:    email,
-		Roles:    roles,
-		Metadata: map[string]string{
-			"provider": p.name,
-			"subject":  claims["sub"].(string),
-		},
-	}, nil
+// ResolveRoles maps the groups recorded at login through the current role mappings
+func (p *OIDCProvider) ResolveRoles(_ string, groups []string) ([]string, error) {
+	return p.roleMapper.mapRoles(groups), nil
+}
+
+// sessionExpiry returns when the identity provider session ends (RFC 3339)
+// Keycloak reports the SSO session lifetime as refresh_expires_in; otherwise the ID token expiry is used.
+func sessionExpiry(token *oauth2.Token, idToken *oidc.IDToken) string {
+	expiresAt := idToken.Expiry
+	if token != nil {
+		if seconds, ok := token.Extra("refresh_expires_in").(float64); ok && seconds > 0 {
+			expiresAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	return expiresAt.UTC().Format(time.RFC3339)
 }
 
 // Name returns the provider name
@@ -340,37 +363,7 @@ func (p *OIDCProvider) ExchangeCodeForToken(code, redirectURL string) (*UserInfo
 	email, _ := claims["email"].(string)
 
 	// Extract roles
-	roles := []string{}
-	if rolesInterface, ok := claims[p.rolesClaim]; ok {
-		_ = audit.Log("stdout", "system", "oidc_debug_roles_found", "oidc", map[string]interface{}{
-			"value": rolesInterface,
-			"type":  fmt.Sprintf("%T", rolesInterface),
-		})
-		switch v := rolesInterface.(type) {
-		case []interface{}:
-			for _, role := range v {
-				if roleStr, ok := role.(string); ok {
-					roles = append(roles, roleStr)
-				}
-			}
-		case []string:
-			roles = v
-		case string:
-			roles = []string{v}
-		}
-	} else {
-		availableKeys := []string{}
-		for k := range claims {
-			availableKeys = append(availableKeys, k)
-		}
-		_ = audit.Log("stdout", "system", "oidc_debug_roles_not_found", "oidc", map[string]interface{}{
-			"roles_claim":    p.rolesClaim,
-			"available_keys": availableKeys,
-		})
-	}
-	_ = audit.Log("stdout", "system", "oidc_debug_extracted_roles", "oidc", map[string]interface{}{
-		"roles": roles,
-	})
+	groups, roles := p.rolesFromClaims(username, claims)
 
 	sub, _ := claims["sub"].(string)
 
@@ -378,9 +371,11 @@ func (p *OIDCProvider) ExchangeCodeForToken(code, redirectURL string) (*UserInfo
 		Username: username,
 		Email:    email,
 		Roles:    roles,
+		Groups:   groups,
 		Metadata: map[string]string{
-			"provider": p.name,
-			"subject":  sub,
+			"provider":               p.name,
+			"subject":                sub,
+			MetadataSessionExpiresAt: sessionExpiry(token, idToken),
 		},
 	}, nil
 }
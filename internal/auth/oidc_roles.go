@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"strings"
+)
+
+// oidcRoleMapper turns the roles (or groups) an identity provider puts in a claim into internal roles
+type oidcRoleMapper struct {
+	claim       string            // Claim name, or a dotted path into nested claims (e.g. realm_access.roles)
+	mappings    map[string]string // IdP group -> internal role; when set, unmapped groups are dropped
+	defaultRole string            // Role for users none of whose groups map to a role (optional)
+}
+
+// rawRoles returns the values of the roles claim, and whether the claim was present
+// A claim whose name contains dots (e.g. "https://example.com/roles") is matched
+// before the name is treated as a path.
+func (m *oidcRoleMapper) rawRoles(claims map[string]interface{}) ([]string, bool) {
+	value, ok := claims[m.claim]
+	if !ok {
+		value, ok = claimPath(claims, strings.Split(m.claim, "."))
+	}
+	if !ok {
+		return nil, false
+	}
+
+	roles := []string{}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, role := range v {
+			if roleStr, ok := role.(string); ok {
+				roles = append(roles, roleStr)
+			}
+		}
+	case []string:
+		roles = append(roles, v...)
+	case string:
+		roles = append(roles, v)
+	}
+	return roles, true
+}
+
+// claimPath walks nested claim objects along path
+func claimPath(claims map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = claims
+	for _, key := range path {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// mapRoles applies the role mappings and default role to raw IdP roles.
+// Without mappings the raw roles are used as-is.
+func (m *oidcRoleMapper) mapRoles(raw []string) []string {
+	roles := []string{}
+	seen := make(map[string]bool)
+	for _, group := range raw {
+		role := group
+		if len(m.mappings) > 0 {
+			var ok bool
+			if role, ok = m.mappings[group]; !ok {
+				continue
+			}
+		}
+		if role != "" && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 && m.defaultRole != "" {
+		roles = append(roles, m.defaultRole)
+	}
+	return roles
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOIDCRoleMapper_RawRoles(t *testing.T) {
+	claims := map[string]interface{}{
+		"roles":                     []interface{}{"admin", 42, "dev"},
+		"group":                     "ops",
+		"realm_access":              map[string]interface{}{"roles": []interface{}{"realm-admin"}},
+		"https://example.com/roles": []interface{}{"namespaced"},
+	}
+
+	tests := []struct {
+		claim     string
+		want      []string
+		wantFound bool
+	}{
+		{"roles", []string{"admin", "dev"}, true},
+		{"group", []string{"ops"}, true},
+		{"realm_access.roles", []string{"realm-admin"}, true},
+		{"https://example.com/roles", []string{"namespaced"}, true},
+		{"realm_access.missing", nil, false},
+		{"group.nested", nil, false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.claim, func(t *testing.T) {
+			mapper := &oidcRoleMapper{claim: tt.claim}
+			got, found := mapper.rawRoles(claims)
+			if found != tt.wantFound || (tt.wantFound && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("rawRoles() = %v, %v; want %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestOIDCRoleMapper_MapRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper oidcRoleMapper
+		raw    []string
+		want   []string
+	}{
+		{"no mappings passes roles through", oidcRoleMapper{}, []string{"admin", "dev"}, []string{"admin", "dev"}},
+		{
+			"mapped groups, unmapped dropped",
+			oidcRoleMapper{mappings: map[string]string{"eng-platform": "developer", "eng-sre": "admin"}},
+			[]string{"eng-platform", "all-staff", "eng-sre"},
+			[]string{"developer", "admin"},
+		},
+		{
+			"groups mapping to the same role",
+			oidcRoleMapper{mappings: map[string]string{"eng-a": "developer", "eng-b": "developer"}},
+			[]string{"eng-a", "eng-b"},
+			[]string{"developer"},
+		},
+		{
+			"default role for unmapped users",
+			oidcRoleMapper{mappings: map[string]string{"eng-sre": "admin"}, defaultRole: "viewer"},
+			[]string{"all-staff"},
+			[]string{"viewer"},
+		},
+		{"default role without claim", oidcRoleMapper{defaultRole: "viewer"}, nil, []string{"viewer"}},
+		{"no roles", oidcRoleMapper{}, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapper.mapRoles(tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mapRoles(%v) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
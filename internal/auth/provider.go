@@ -17,11 +17,25 @@ type Provider interface {
 	Type() string
 }
 
+// RoleResolver is implemented by providers that can look a user's roles up again
+// without credentials, so renewed API tokens carry the user's current roles
+type RoleResolver interface {
+	// ResolveRoles returns the current roles of username; groups are the raw identity
+	// provider groups recorded at login. It fails when the user no longer exists.
+	ResolveRoles(username string, groups []string) ([]string, error)
+}
+
+// MetadataSessionExpiresAt is the UserInfo metadata key holding when the identity provider
+// session ends (RFC 3339); API tokens are not renewed past it
+const MetadataSessionExpiresAt = "session_expires_at"
+
 // UserInfo contains authenticated user information
 type UserInfo struct {
 	Username string
 	Email    string
 	Roles    []string
+	// Groups are the identity provider's groups before role mapping (OIDC)
+	Groups   []string
 	Metadata map[string]string
 }
 
@@ -2,28 +2,114 @@ package authorization
 
 import (
 	"fmt"
-	"regexp"
+	"net"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/logging"
 )
 
+// DenyAllPattern is a whitelist pattern that matches nothing
+// It is the effective whitelist when a connection's patterns are all time-scoped and no window is active.
+const DenyAllPattern = `[^\s\S]`
+
+// allOfSeparator joins the patterns of a whitelist_mode "all" policy into one whitelist entry
+// RE2 has no lookahead, so AND groups cannot be expressed as a single regex.
+const allOfSeparator = "\x00"
+
+// AllOfPattern combines patterns into a single whitelist entry that matches only
+// when every pattern matches (see MatchPattern)
+func AllOfPattern(patterns []string) string {
+	return strings.Join(patterns, allOfSeparator)
+}
+
+// PatternParts splits a whitelist entry into its patterns: one, or several for an
+// AllOfPattern entry
+func PatternParts(source string) []string {
+	return strings.Split(source, allOfSeparator)
+}
+
+// MatchPattern reports whether a request matches a whitelist entry, case-insensitively
+// Entries built by AllOfPattern match only if all of their patterns match.
+// Patterns are compiled once and cached (see CompilePattern).
+func MatchPattern(pattern, request string) (bool, error) {
+	compiled, err := CompilePattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return compiled.Match(request), nil
+}
+
 // Authorizer handles authorization decisions
 type Authorizer struct {
 	config      *config.Config
 	policies    map[string][]*config.RolePolicy // role -> policies
 	connections map[string]*config.ConnectionConfig
+	sourceNets  map[*config.RolePolicy][]*net.IPNet // policy -> parsed source_cidrs
+	order       map[*config.RolePolicy]int          // policy -> position in the config
+	now         func() time.Time                    // Clock for policy schedules
+
+	// Views from ForSource only apply the policies whose source_cidrs contain source
+	sourceScoped bool
+	source       net.IP
+
+	// whitelists memoizes whitelists that don't depend on the clock, keyed by connection,
+	// roles and the policies left out for the source; shared with ForSource views
+	whitelists *sync.Map // string -> *cachedWhitelist
+}
+
+// cachedWhitelist is a memoized whitelist and its patterns
+type cachedWhitelist struct {
+	rules    []WhitelistRule
+	patterns []string
+}
+
+// WhitelistRule is a whitelist entry and the policy it comes from
+type WhitelistRule struct {
+	Policy  string `json:"policy,omitempty"` // Empty for a connection's legacy whitelist
+	Pattern string `json:"pattern"`
+}
+
+// String describes the rule for decision reasons, e.g. policy "dev-read" pattern "^SELECT"
+func (r WhitelistRule) String() string {
+	pattern := strings.Join(PatternParts(r.Pattern), " AND ")
+	if r.Policy == "" {
+		return fmt.Sprintf("connection whitelist pattern %q", pattern)
+	}
+	return fmt.Sprintf("policy %q pattern %q", r.Policy, pattern)
+}
+
+// rulePatterns returns the patterns of whitelist rules, in order
+func rulePatterns(rules []WhitelistRule) []string {
+	if rules == nil {
+		return nil
+	}
+	patterns := make([]string, len(rules))
+	for i, rule := range rules {
+		patterns[i] = rule.Pattern
+	}
+	return patterns
 }
 
 // NewAuthorizer creates a new authorizer
 func NewAuthorizer(cfg *config.Config) *Authorizer {
 	// Index policies by role
 	policyMap := make(map[string][]*config.RolePolicy)
+	sourceNets := make(map[*config.RolePolicy][]*net.IPNet)
+	order := make(map[*config.RolePolicy]int, len(cfg.Policies))
 	for i := range cfg.Policies {
 		policy := &cfg.Policies[i]
+		order[policy] = i
 		for _, role := range policy.Roles {
 			policyMap[role] = append(policyMap[role], policy)
 		}
+		if len(policy.SourceCIDRs) > 0 {
+			sourceNets[policy] = parseSourceCIDRs(policy.SourceCIDRs)
+		}
+		precompileWhitelists(policy)
 	}
 
 	// Index connections by name
@@ -37,153 +123,650 @@ func NewAuthorizer(cfg *config.Config) *Authorizer {
 		config:      cfg,
 		policies:    policyMap,
 		connections: connMap,
+		sourceNets:  sourceNets,
+		order:       order,
+		now:         time.Now,
+		whitelists:  &sync.Map{},
 	}
 }
 
+// ForSource returns a view of the authorizer for a client connecting from ip. A role's
+// policies whose source_cidrs don't contain ip grant nothing through the view: whitelists,
+// blacklists, table permissions and limits only come from the policies open to ip.
+func (a *Authorizer) ForSource(ip net.IP) *Authorizer {
+	view := *a
+	view.sourceScoped = true
+	view.source = ip
+	return &view
+}
+
+// SameSourcePolicies reports whether clients at first and second get the same policies of
+// the roles, that is whether ForSource views from either address grant the same
+func (a *Authorizer) SameSourcePolicies(roles []string, first, second net.IP) bool {
+	return a.ForSource(first).excludedKey(roles) == a.ForSource(second).excludedKey(roles)
+}
+
+// sourceExcludes reports whether a policy is left out of a ForSource view
+func (a *Authorizer) sourceExcludes(policy *config.RolePolicy) bool {
+	if !a.sourceScoped {
+		return false
+	}
+	nets, restricted := a.sourceNets[policy]
+	return restricted && !ipInNets(a.source, nets)
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// precompileWhitelists compiles a policy's whitelist and blacklist patterns so requests only match them
+// Invalid patterns (rejected by config validation) are logged here rather than per request.
+func precompileWhitelists(policy *config.RolePolicy) {
+	whitelist := append([]string(nil), policy.Whitelist...)
+	for _, window := range policy.TimeWhitelists {
+		whitelist = append(whitelist, window.Whitelist...)
+	}
+	if policy.WhitelistMode == "all" && len(policy.Whitelist) > 1 {
+		whitelist = append(whitelist, AllOfPattern(policy.Whitelist))
+	}
+	whitelist = append(whitelist, policy.Blacklist...)
+
+	_, errs := CompileWhitelist(whitelist)
+	for _, err := range errs {
+		logging.Component("authz").Warn("skipping invalid whitelist pattern", "policy", policy.Name, "error", err)
+	}
+}
+
+// parseSourceCIDRs parses policy source networks; bare IPs become single-host
+// networks and invalid entries (rejected by config validation) are skipped
+func parseSourceCIDRs(entries []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// AccessDecision explains the outcome of a connection access check
+type AccessDecision struct {
+	Allowed bool
+	Policy  string // Name of the policy that granted access (empty when denied)
+	Role    string // Role through which access was granted
+	Reason  string
+
+	// OutsideSchedule is set when access was denied only because no granting policy's schedule is active
+	OutsideSchedule bool
+}
+
 // CanAccessConnection checks if user with given roles can access a connection
 func (a *Authorizer) CanAccessConnection(roles []string, connectionName string) bool {
+	return a.CheckConnectionAccess(roles, connectionName).Allowed
+}
+
+// CheckConnectionAccess is CanAccessConnection with the matched policy and
+// the reason for the decision, for the decision log
+func (a *Authorizer) CheckConnectionAccess(roles []string, connectionName string) AccessDecision {
 	conn, exists := a.connections[connectionName]
 	if !exists {
-		return false
+		return AccessDecision{Reason: "unknown connection"}
 	}
 
 	// Check if any role grants access
+	now := a.currentTime()
 	for _, role := range roles {
-		if a.roleCanAccessConnection(role, conn) {
-			return true
+		if policy := a.roleAccessPolicy(role, conn, now); policy != nil {
+			return AccessDecision{
+				Allowed: true,
+				Policy:  policy.Name,
+				Role:    role,
+				Reason:  fmt.Sprintf("role %q granted by policy %q", role, policy.Name),
+			}
 		}
 	}
 
-	return false
+	// Explain denials caused only by policy schedules
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if policy.Schedule != nil && !a.sourceExcludes(policy) && a.policyGrantsConnection(policy, conn) {
+				return AccessDecision{
+					Policy:          policy.Name,
+					Role:            role,
+					Reason:          fmt.Sprintf("policy %q is outside its schedule (%s)", policy.Name, policy.Schedule.Describe()),
+					OutsideSchedule: true,
+				}
+			}
+		}
+	}
+
+	return AccessDecision{Reason: "no policy grants access to the user's roles"}
+}
+
+// currentTime returns the authorizer's clock reading (time.Now unless overridden in tests)
+func (a *Authorizer) currentTime() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
+// policyActive reports whether a policy's schedule (if any) contains now
+// Schedules that fail to evaluate (rejected by config validation) never grant access.
+func policyActive(policy *config.RolePolicy, now time.Time) bool {
+	if policy.Schedule == nil {
+		return true
+	}
+	active, err := policy.Schedule.Active(now)
+	return err == nil && active
 }
 
 // GetWhitelistForConnection returns the whitelist patterns for a user's roles on a connection
 func (a *Authorizer) GetWhitelistForConnection(roles []string, connectionName string) []string {
+	return a.GetWhitelistForConnectionAt(roles, connectionName, time.Now())
+}
+
+// GetWhitelistForConnectionAt returns the whitelist patterns in effect at the given time,
+// including time-scoped patterns whose window contains now, in policy declaration order
+// Whitelists that don't depend on the clock are built once per roles and connection;
+// callers must not modify the returned slice.
+func (a *Authorizer) GetWhitelistForConnectionAt(roles []string, connectionName string, now time.Time) []string {
+	return a.whitelistAt(roles, connectionName, now).patterns
+}
+
+// GetWhitelistRulesForConnectionAt returns the whitelist in effect at the given time with
+// the policy each pattern comes from. Rules follow policy declaration order, each policy's
+// patterns in the order written; a pattern several policies list belongs to the first.
+// Callers must not modify the returned slice.
+func (a *Authorizer) GetWhitelistRulesForConnectionAt(roles []string, connectionName string, now time.Time) []WhitelistRule {
+	return a.whitelistAt(roles, connectionName, now).rules
+}
+
+// whitelistAt builds, or returns the memoized, whitelist of roles on a connection at now
+func (a *Authorizer) whitelistAt(roles []string, connectionName string, now time.Time) *cachedWhitelist {
 	conn, exists := a.connections[connectionName]
 	if !exists {
-		return nil
+		return &cachedWhitelist{}
+	}
+
+	if a.timeDependent(roles) {
+		rules := a.buildWhitelist(roles, conn, now)
+		return &cachedWhitelist{rules: rules, patterns: rulePatterns(rules)}
+	}
+	if a.whitelists == nil {
+		rules := a.buildWhitelist(roles, conn, now)
+		return &cachedWhitelist{rules: rules, patterns: rulePatterns(rules)}
+	}
+	key := whitelistKey(roles, connectionName) + a.excludedKey(roles)
+	if cached, ok := a.whitelists.Load(key); ok {
+		return cached.(*cachedWhitelist)
+	}
+	rules := a.buildWhitelist(roles, conn, now)
+	whitelist := &cachedWhitelist{rules: rules, patterns: rulePatterns(rules)}
+	a.whitelists.Store(key, whitelist)
+	return whitelist
+}
+
+// MatchingWhitelistRule returns the first rule of the roles' whitelist on a connection at
+// now that allows a request, to explain allow decisions
+func (a *Authorizer) MatchingWhitelistRule(roles []string, connectionName, request string, now time.Time) (WhitelistRule, bool) {
+	return MatchWhitelistRule(request, a.GetWhitelistRulesForConnectionAt(roles, connectionName, now))
+}
+
+// MatchWhitelistRule returns the first rule a request matches (first match wins)
+// Invalid patterns (rejected by config validation) never match.
+func MatchWhitelistRule(request string, rules []WhitelistRule) (WhitelistRule, bool) {
+	for _, rule := range rules {
+		if matched, err := MatchPattern(rule.Pattern, request); err == nil && matched {
+			return rule, true
+		}
+	}
+	return WhitelistRule{}, false
+}
+
+// timeDependent reports whether any policy of the roles has a schedule or time-scoped patterns
+func (a *Authorizer) timeDependent(roles []string) bool {
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if policy.Schedule != nil || len(policy.TimeWhitelists) > 0 {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// whitelistKey identifies a roles and connection pair regardless of role order
+func whitelistKey(roles []string, connectionName string) string {
+	sorted := append([]string(nil), roles...)
+	sort.Strings(sorted)
+	return connectionName + "\x00" + strings.Join(sorted, "\x00")
+}
+
+// excludedKey lists the roles' policies a ForSource view leaves out, so views from
+// different networks don't share memoized whitelists
+func (a *Authorizer) excludedKey(roles []string) string {
+	var key strings.Builder
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if a.sourceExcludes(policy) {
+				fmt.Fprintf(&key, "\x00-%d", a.order[policy])
+			}
+		}
+	}
+	return key.String()
+}
+
+// buildWhitelist collects the whitelist rules of the policies matching a connection at now
+func (a *Authorizer) buildWhitelist(roles []string, conn *config.ConnectionConfig, now time.Time) []WhitelistRule {
 
 	// Legacy: if connection has direct whitelist and no tags, use it
 	//nolint:staticcheck // SA1019: Supporting deprecated Whitelist field for backwards compatibility
 	if len(conn.Whitelist) > 0 && len(conn.Tags) == 0 {
 		//nolint:staticcheck // SA1019: Supporting deprecated Whitelist field for backwards compatibility
-		return conn.Whitelist
+		rules := make([]WhitelistRule, len(conn.Whitelist))
+		//nolint:staticcheck // SA1019: Supporting deprecated Whitelist field for backwards compatibility
+		for i, pattern := range conn.Whitelist {
+			rules[i] = WhitelistRule{Pattern: pattern}
+		}
+		return rules
 	}
 
-	// Collect whitelists from all matching policies
-	whitelistMap := make(map[string]bool)
-	for _, role := range roles {
-		policies, exists := a.policies[role]
-		if !exists {
-			continue
+	// Collect whitelists from all matching policies (OR across policies)
+	seen := make(map[string]bool)
+	var whitelist []WhitelistRule
+	timeScoped := false
+	for _, policy := range a.matchingPolicies(roles, conn, now) {
+		patterns := append([]string(nil), policy.Whitelist...)
+
+		for i := range policy.TimeWhitelists {
+			window := &policy.TimeWhitelists[i]
+			timeScoped = true
+			if active, err := window.Active(now); err != nil || !active {
+				continue
+			}
+			patterns = append(patterns, window.Whitelist...)
 		}
 
-		for _, policy := range policies {
-			if a.policyMatchesConnection(policy, conn) {
-				for _, pattern := range policy.Whitelist {
-					whitelistMap[pattern] = true
-				}
+		// whitelist_mode "all": the policy's patterns form a single AND group
+		if policy.WhitelistMode == "all" && len(patterns) > 1 {
+			patterns = []string{AllOfPattern(patterns)}
+		}
+		for _, pattern := range patterns {
+			if !seen[pattern] {
+				seen[pattern] = true
+				whitelist = append(whitelist, WhitelistRule{Policy: policy.Name, Pattern: pattern})
 			}
 		}
 	}
 
-	// Convert map to slice
-	whitelist := make([]string, 0, len(whitelistMap))
-	for pattern := range whitelistMap {
-		whitelist = append(whitelist, pattern)
+	// Time-scoped patterns with no active window must not fall back to "no whitelist" (allow all)
+	if len(whitelist) == 0 && timeScoped {
+		return []WhitelistRule{{Pattern: DenyAllPattern}}
+	}
+	if whitelist == nil {
+		whitelist = []WhitelistRule{}
 	}
 
 	return whitelist
 }
 
-// roleCanAccessConnection checks if a specific role can access a connection
-func (a *Authorizer) roleCanAccessConnection(role string, conn *config.ConnectionConfig) bool {
-	policies, exists := a.policies[role]
+// GetBlacklistForConnection returns the blacklist patterns for a user's roles on a connection
+func (a *Authorizer) GetBlacklistForConnection(roles []string, connectionName string) []string {
+	return a.GetBlacklistForConnectionAt(roles, connectionName, time.Now())
+}
+
+// GetBlacklistForConnectionAt returns the blacklist patterns of the policies applying at the given time
+// Blacklists of all matching policies are combined: a pattern from any policy denies the request.
+func (a *Authorizer) GetBlacklistForConnectionAt(roles []string, connectionName string, now time.Time) []string {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var blacklist []string
+	for _, policy := range a.matchingPolicies(roles, conn, now) {
+		for _, pattern := range policy.Blacklist {
+			if !seen[pattern] {
+				seen[pattern] = true
+				blacklist = append(blacklist, pattern)
+			}
+		}
+	}
+	return blacklist
+}
+
+// ExcludedTimeWindow returns the inactive time window whose patterns would have allowed the request
+// Used to explain time-based denials; returns false if no time window matches the request
+func (a *Authorizer) ExcludedTimeWindow(roles []string, connectionName, request string, now time.Time) (*config.TimeWindowWhitelist, bool) {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return nil, false
+	}
+
+	for _, policy := range a.matchingPolicies(roles, conn, now) {
+		for i := range policy.TimeWhitelists {
+			window := &policy.TimeWhitelists[i]
+			if active, err := window.Active(now); err == nil && active {
+				continue
+			}
+			if a.ValidatePattern(request, window.Whitelist) == nil {
+				return window, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// matchingPolicies returns the policies of the given roles that apply to a connection at
+// now, in declaration order whatever the order of the roles
+func (a *Authorizer) matchingPolicies(roles []string, conn *config.ConnectionConfig, now time.Time) []*config.RolePolicy {
+	var matched []*config.RolePolicy
+	seen := make(map[*config.RolePolicy]bool)
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if seen[policy] || !a.policyMatchesConnection(policy, conn) || !policyActive(policy, now) || a.sourceExcludes(policy) {
+				continue
+			}
+			seen[policy] = true
+			matched = append(matched, policy)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return a.order[matched[i]] < a.order[matched[j]] })
+	return matched
+}
+
+// SourceAllowed checks the client IP against the source_cidrs of the policies
+// that grant the roles access to a connection. Access from ip is allowed if any
+// granting policy is unrestricted or lists a network containing it.
+func (a *Authorizer) SourceAllowed(roles []string, connectionName string, ip net.IP) bool {
+	conn, exists := a.connections[connectionName]
 	if !exists {
 		return false
 	}
 
-	// If connection has no tags, check for policies with no tags (legacy mode)
-	if len(conn.Tags) == 0 {
-		for _, policy := range policies {
-			if len(policy.Tags) == 0 {
+	now := a.currentTime()
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if !a.policyGrantsConnection(policy, conn) || !policyActive(policy, now) {
+				continue
+			}
+			if nets, restricted := a.sourceNets[policy]; !restricted || ipInNets(ip, nets) {
 				return true
 			}
 		}
+	}
+	return false
+}
+
+// GetTablePermissionsForConnection returns the table permissions of all policies that
+// apply to the roles on a connection. An empty result means table permissions are not enforced.
+func (a *Authorizer) GetTablePermissionsForConnection(roles []string, connectionName string) []config.TablePermission {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return nil
+	}
+
+	var permissions []config.TablePermission
+	for _, policy := range a.matchingPolicies(roles, conn, a.currentTime()) {
+		permissions = append(permissions, policy.TablePermissions...)
+	}
+	return permissions
+}
+
+// GetCopyDirectionsForConnection returns the COPY directions ("FROM", "TO") that the
+// policies applying to the roles on a connection allow
+func (a *Authorizer) GetCopyDirectionsForConnection(roles []string, connectionName string) []string {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return nil
+	}
+
+	var directions []string
+	seen := make(map[string]bool)
+	for _, policy := range a.matchingPolicies(roles, conn, a.currentTime()) {
+		for _, direction := range policy.Copy {
+			direction = strings.ToUpper(direction)
+			if !seen[direction] {
+				seen[direction] = true
+				directions = append(directions, direction)
+			}
+		}
+	}
+	return directions
+}
+
+// RequiresReason reports whether any policy that applies to the roles on a connection
+// requires users to give a reason when connecting
+func (a *Authorizer) RequiresReason(roles []string, connectionName string) bool {
+	conn, exists := a.connections[connectionName]
+	if !exists {
 		return false
 	}
 
-	// Check if any policy matches this connection's tags
-	for _, policy := range policies {
-		if a.policyMatchesConnection(policy, conn) {
+	for _, policy := range a.matchingPolicies(roles, conn, a.currentTime()) {
+		if policy.RequireReason {
 			return true
 		}
 	}
-
 	return false
 }
 
-// policyMatchesConnection checks if a policy's tags match a connection's tags
-func (a *Authorizer) policyMatchesConnection(policy *config.RolePolicy, conn *config.ConnectionConfig) bool {
-	if len(policy.Tags) == 0 {
+// IsReadOnlyForConnection reports whether sessions of the roles on a connection are
+// read-only: the connection sets read_only, or one of the roles is in read_only_roles
+func (a *Authorizer) IsReadOnlyForConnection(roles []string, connectionName string) bool {
+	conn, exists := a.connections[connectionName]
+	if !exists {
 		return false
 	}
+	if conn.ReadOnly {
+		return true
+	}
+	for _, role := range roles {
+		for _, readOnlyRole := range conn.ReadOnlyRoles {
+			if role == readOnlyRole {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	if len(conn.Tags) == 0 {
-		return false
+// MaxDurationForConnection returns the tightest max_duration among the policies
+// that grant the roles access to a connection, or 0 if none sets a cap
+func (a *Authorizer) MaxDurationForConnection(roles []string, connectionName string) time.Duration {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return 0
 	}
 
-	tagMatch := policy.TagMatch
-	if tagMatch == "" {
-		tagMatch = "all"
+	var limit time.Duration
+	now := a.currentTime()
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if !a.policyGrantsConnection(policy, conn) || !policyActive(policy, now) || a.sourceExcludes(policy) || policy.MaxDuration <= 0 {
+				continue
+			}
+			if limit == 0 || policy.MaxDuration < limit {
+				limit = policy.MaxDuration
+			}
+		}
 	}
+	return limit
+}
 
-	// Convert connection tags to a set for faster lookup
-	connTags := make(map[string]bool)
-	for _, tag := range conn.Tags {
-		connTags[tag] = true
+// MaxConcurrentConnectionsForConnection returns the tightest max_concurrent_connections among the
+// policies granting the roles access to a connection (0 = no cap)
+func (a *Authorizer) MaxConcurrentConnectionsForConnection(roles []string, connectionName string) int {
+	conn, exists := a.connections[connectionName]
+	if !exists {
+		return 0
 	}
 
-	if tagMatch == "any" {
-		// At least one policy tag must match
-		for _, policyTag := range policy.Tags {
-			if connTags[policyTag] {
-				return true
+	limit := 0
+	now := a.currentTime()
+	for _, role := range roles {
+		for _, policy := range a.policies[role] {
+			if !a.policyGrantsConnection(policy, conn) || !policyActive(policy, now) || a.sourceExcludes(policy) || policy.MaxConcurrentConnections <= 0 {
+				continue
+			}
+			if limit == 0 || policy.MaxConcurrentConnections < limit {
+				limit = policy.MaxConcurrentConnections
 			}
 		}
-		return false
 	}
+	return limit
+}
+
+// roleCanAccessConnection checks if a specific role can access a connection now
+func (a *Authorizer) roleCanAccessConnection(role string, conn *config.ConnectionConfig) bool {
+	return a.roleAccessPolicy(role, conn, a.currentTime()) != nil
+}
 
-	// Default: "all" - all policy tags must be present in connection
-	for _, policyTag := range policy.Tags {
-		if !connTags[policyTag] {
-			return false
+// roleAccessPolicy returns the first policy through which a role can access a connection at now
+// (in a ForSource view, the first one whose source_cidrs admit the client)
+func (a *Authorizer) roleAccessPolicy(role string, conn *config.ConnectionConfig, now time.Time) *config.RolePolicy {
+	policies, exists := a.policies[role]
+	if !exists {
+		return nil
+	}
+
+	// If connection has no tags, check for policies with no tags (legacy mode)
+	if len(conn.Tags) == 0 {
+		for _, policy := range policies {
+			if len(policy.Tags) == 0 && policyActive(policy, now) && !a.sourceExcludes(policy) {
+				return policy
+			}
+		}
+		return nil
+	}
+
+	// Check if any policy matches this connection's tags
+	for _, policy := range policies {
+		if a.policyMatchesConnection(policy, conn) && policyActive(policy, now) && !a.sourceExcludes(policy) {
+			return policy
 		}
 	}
-	return true
+
+	return nil
+}
+
+// policyGrantsConnection checks if a policy grants access to a connection,
+// including legacy untagged policies on untagged connections
+func (a *Authorizer) policyGrantsConnection(policy *config.RolePolicy, conn *config.ConnectionConfig) bool {
+	if len(conn.Tags) == 0 {
+		return len(policy.Tags) == 0
+	}
+	return a.policyMatchesConnection(policy, conn)
+}
+
+// policyMatchesConnection checks if a policy's tag expressions match a connection's tags
+func (a *Authorizer) policyMatchesConnection(policy *config.RolePolicy, conn *config.ConnectionConfig) bool {
+	if len(policy.Tags) == 0 {
+		return false
+	}
+
+	if len(conn.Tags) == 0 {
+		return false
+	}
+
+	return config.MatchTags(policy.Tags, policy.TagMatch, conn.Tags).Matched
 }
 
 // ValidatePattern checks if a query/request matches whitelist patterns
+// Any entry may match (OR); an AllOfPattern entry requires all of its patterns (AND).
 func (a *Authorizer) ValidatePattern(query string, whitelist []string) error {
-	if len(whitelist) == 0 {
-		// No whitelist means everything is allowed
-		return nil
-	}
+	_, err := firstWhitelistMatch(query, whitelist)
+	return err
+}
 
+// firstWhitelistMatch returns the first whitelist entry a query matches, or "" when
+// there is no whitelist (everything is allowed)
+func firstWhitelistMatch(query string, whitelist []string) (string, error) {
 	for _, pattern := range whitelist {
-		// Make regex case-insensitive by prepending (?i)
-		caseInsensitivePattern := "(?i)" + pattern
-		matched, err := regexp.MatchString(caseInsensitivePattern, query)
+		matched, err := MatchPattern(pattern, query)
 		if err != nil {
-			return fmt.Errorf("invalid whitelist pattern: %s", pattern)
+			return "", fmt.Errorf("invalid whitelist pattern: %s", pattern)
 		}
 		if matched {
-			return nil
+			return pattern, nil
 		}
 	}
+	if len(whitelist) > 0 {
+		return "", fmt.Errorf("query does not match any whitelist pattern")
+	}
+	return "", nil
+}
+
+// Decision is the outcome of evaluating a request against a whitelist and blacklist
+type Decision struct {
+	Allowed bool
+	Reason  string
+
+	// WhitelistPattern is the first whitelist entry that allowed the request
+	WhitelistPattern string
+
+	// Blacklisted is set when the request was denied by BlacklistPattern
+	Blacklisted      bool
+	BlacklistPattern string
+}
+
+// Evaluate checks a request against the whitelist and then the blacklist: a request
+// matching any blacklist pattern is denied even if the whitelist allows it
+func (a *Authorizer) Evaluate(query string, whitelist, blacklist []string) Decision {
+	allowedBy, err := firstWhitelistMatch(query, whitelist)
+	if err != nil {
+		return Decision{Reason: err.Error()}
+	}
+	if pattern, matched := MatchBlacklist(query, blacklist); matched {
+		return Decision{
+			Reason:           fmt.Sprintf("query matches blacklist pattern %q", pattern),
+			Blacklisted:      true,
+			BlacklistPattern: pattern,
+		}
+	}
+	if len(whitelist) == 0 {
+		return Decision{Allowed: true, Reason: "no whitelist configured"}
+	}
+	return Decision{
+		Allowed:          true,
+		Reason:           fmt.Sprintf("matches whitelist pattern %q", strings.Join(PatternParts(allowedBy), " AND ")),
+		WhitelistPattern: allowedBy,
+	}
+}
 
-	return fmt.Errorf("query does not match any whitelist pattern")
+// MatchBlacklist returns the first blacklist pattern a request matches
+// Invalid patterns (rejected by config validation) never match.
+func MatchBlacklist(request string, blacklist []string) (string, bool) {
+	for _, pattern := range blacklist {
+		if matched, err := MatchPattern(pattern, request); err == nil && matched {
+			return pattern, true
+		}
+	}
+	return "", false
 }
 
 // ListAccessibleConnections returns all connections a user with given roles can access
@@ -1,7 +1,9 @@
 package authorization
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/config"
 )
@@ -272,21 +274,57 @@ func TestAuthorizer_GetWhitelistForConnection(t *testing.T) {
 				return
 			}
 
-			// Check if all wanted patterns are present (order doesn't matter due to map iteration)
-			wantMap := make(map[string]bool)
-			for _, pattern := range tt.wantPatterns {
-				wantMap[pattern] = true
-			}
-
-			for _, pattern := range got {
-				if !wantMap[pattern] {
-					t.Errorf("GetWhitelistForConnection() contains unexpected pattern: %s", pattern)
+			// Patterns keep policy declaration order
+			for i, pattern := range got {
+				if pattern != tt.wantPatterns[i] {
+					t.Errorf("GetWhitelistForConnection() = %v, want %v in order", got, tt.wantPatterns)
+					break
 				}
 			}
 		})
 	}
 }
 
+func TestAuthorizer_WhitelistRules(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "read", Roles: []string{"dev"}, Tags: []string{"env:prod"}, Whitelist: []string{`^SELECT`, `^EXPLAIN`}},
+			{Name: "write", Roles: []string{"ops"}, Tags: []string{"env:prod"}, Whitelist: []string{`^UPDATE`, `^SELECT`}},
+			{Name: "audit", Roles: []string{"ops"}, Tags: []string{"env:prod"}, Whitelist: []string{`^SELECT .* FROM audit`}},
+		},
+		Connections: []config.ConnectionConfig{{Name: "prod-db", Tags: []string{"env:prod"}}},
+	})
+	now := time.Now()
+
+	// Declaration order whatever the role order; ^SELECT belongs to the first policy listing it
+	want := []WhitelistRule{
+		{Policy: "read", Pattern: `^SELECT`},
+		{Policy: "read", Pattern: `^EXPLAIN`},
+		{Policy: "write", Pattern: `^UPDATE`},
+		{Policy: "audit", Pattern: `^SELECT .* FROM audit`},
+	}
+	for _, roles := range [][]string{{"dev", "ops"}, {"ops", "dev"}} {
+		got := authz.GetWhitelistRulesForConnectionAt(roles, "prod-db", now)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetWhitelistRulesForConnectionAt(%v) = %v, want %v", roles, got, want)
+		}
+	}
+
+	// First match wins
+	rule, ok := authz.MatchingWhitelistRule([]string{"ops"}, "prod-db", "SELECT * FROM audit", now)
+	if !ok || rule.Policy != "write" || rule.String() != `policy "write" pattern "^SELECT"` {
+		t.Errorf("MatchingWhitelistRule() = %v, %v; want policy write pattern ^SELECT", rule, ok)
+	}
+	if _, ok := authz.MatchingWhitelistRule([]string{"dev"}, "prod-db", "DELETE FROM users", now); ok {
+		t.Error("MatchingWhitelistRule() matched a request no pattern allows")
+	}
+
+	decision := authz.Evaluate("UPDATE users SET x = 1", authz.GetWhitelistForConnection([]string{"ops"}, "prod-db"), nil)
+	if !decision.Allowed || decision.WhitelistPattern != `^UPDATE` || decision.Reason != `matches whitelist pattern "^UPDATE"` {
+		t.Errorf("Evaluate() = %+v, want allowed by ^UPDATE", decision)
+	}
+}
+
 func TestAuthorizer_ValidatePattern(t *testing.T) {
 	authz := &Authorizer{}
 
@@ -517,3 +555,98 @@ func BenchmarkGetWhitelistForConnection(b *testing.B) {
 		authz.GetWhitelistForConnection(roles, "postgres-test")
 	}
 }
+
+func TestAuthorizer_CheckConnectionAccess(t *testing.T) {
+	cfg := &config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "dev-test", Roles: []string{"developer"}, Tags: []string{"env:test"}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "postgres-test", Type: "postgres", Tags: []string{"env:test"}},
+		},
+	}
+	authz := NewAuthorizer(cfg)
+
+	tests := []struct {
+		name        string
+		roles       []string
+		connection  string
+		wantAllowed bool
+		wantPolicy  string
+	}{
+		{"granted by policy", []string{"viewer", "developer"}, "postgres-test", true, "dev-test"},
+		{"no matching policy", []string{"viewer"}, "postgres-test", false, ""},
+		{"unknown connection", []string{"developer"}, "missing", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authz.CheckConnectionAccess(tt.roles, tt.connection)
+			if got.Allowed != tt.wantAllowed || got.Policy != tt.wantPolicy {
+				t.Errorf("CheckConnectionAccess() = %+v, want allowed=%v policy=%q", got, tt.wantAllowed, tt.wantPolicy)
+			}
+			if got.Reason == "" {
+				t.Error("CheckConnectionAccess() returned no reason")
+			}
+			if got.Allowed != authz.CanAccessConnection(tt.roles, tt.connection) {
+				t.Error("CheckConnectionAccess() disagrees with CanAccessConnection()")
+			}
+		})
+	}
+}
+
+func TestAuthorizer_EvaluateBlacklist(t *testing.T) {
+	cfg := &config.Config{
+		Policies: []config.RolePolicy{
+			{
+				Name:      "dev-all",
+				Roles:     []string{"developer"},
+				Tags:      []string{"env:dev"},
+				Whitelist: []string{".*"},
+				Blacklist: []string{`^\s*DROP\b`, `\bTRUNCATE\b`},
+			},
+			{
+				Name:      "dev-grant",
+				Roles:     []string{"developer"},
+				Tags:      []string{"env:dev"},
+				Blacklist: []string{`\bGRANT\b`, `\bTRUNCATE\b`},
+			},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "dev-db", Type: "postgres", Tags: []string{"env:dev"}},
+		},
+	}
+	authz := NewAuthorizer(cfg)
+
+	blacklist := authz.GetBlacklistForConnection([]string{"developer"}, "dev-db")
+	if len(blacklist) != 3 {
+		t.Fatalf("GetBlacklistForConnection() = %v, want the 3 distinct patterns of both policies", blacklist)
+	}
+	if got := authz.GetBlacklistForConnection([]string{"admin"}, "dev-db"); len(got) != 0 {
+		t.Errorf("GetBlacklistForConnection(admin) = %v, want none", got)
+	}
+
+	whitelist := authz.GetWhitelistForConnection([]string{"developer"}, "dev-db")
+	tests := []struct {
+		query       string
+		allowed     bool
+		blacklisted bool
+	}{
+		{"SELECT * FROM users", true, false},
+		{"drop table users", false, true},
+		{"GRANT ALL ON users TO bob", false, true},
+		{"select 1; truncate users", false, true},
+	}
+	for _, tt := range tests {
+		decision := authz.Evaluate(tt.query, whitelist, blacklist)
+		if decision.Allowed != tt.allowed || decision.Blacklisted != tt.blacklisted {
+			t.Errorf("Evaluate(%q) = %+v, want allowed=%v blacklisted=%v", tt.query, decision, tt.allowed, tt.blacklisted)
+		}
+	}
+
+	// Whitelist denials take precedence in the reason
+	decision := authz.Evaluate("DROP TABLE users", []string{"^SELECT"}, blacklist)
+	if decision.Allowed || decision.Blacklisted {
+		t.Errorf("Evaluate() with non-matching whitelist = %+v, want a whitelist denial", decision)
+	}
+}
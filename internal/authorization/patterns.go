@@ -0,0 +1,89 @@
+package authorization
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// compiledPatterns caches compiled whitelist entries (and compile errors) by source
+// Entries come from configuration, so the cache stays bounded by the patterns ever configured.
+var compiledPatterns sync.Map // string -> *compiledEntry
+
+type compiledEntry struct {
+	pattern *Pattern
+	err     error
+}
+
+// Pattern is a compiled whitelist entry
+// AllOfPattern entries compile to one regex per part, all of which must match.
+type Pattern struct {
+	source string
+	parts  []*regexp.Regexp
+}
+
+// PatternError reports a whitelist entry that does not compile
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("invalid whitelist pattern %q: %v", e.Pattern, e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// CompilePattern compiles a whitelist entry case-insensitively, reusing earlier compilations
+func CompilePattern(source string) (*Pattern, error) {
+	if cached, ok := compiledPatterns.Load(source); ok {
+		entry := cached.(*compiledEntry)
+		return entry.pattern, entry.err
+	}
+
+	entry := &compiledEntry{pattern: &Pattern{source: source}}
+	for _, part := range strings.Split(source, allOfSeparator) {
+		re, err := regexp.Compile("(?i)" + part)
+		if err != nil {
+			entry = &compiledEntry{err: &PatternError{Pattern: part, Err: err}}
+			break
+		}
+		entry.pattern.parts = append(entry.pattern.parts, re)
+	}
+
+	compiledPatterns.Store(source, entry)
+	return entry.pattern, entry.err
+}
+
+// CompileWhitelist compiles a whitelist, returning the valid patterns and an error per invalid one
+func CompileWhitelist(whitelist []string) ([]*Pattern, []error) {
+	patterns := make([]*Pattern, 0, len(whitelist))
+	var errs []error
+	for _, source := range whitelist {
+		pattern, err := CompilePattern(source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, errs
+}
+
+// Match reports whether a request matches the pattern
+func (p *Pattern) Match(request string) bool {
+	for _, re := range p.parts {
+		if !re.MatchString(request) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern as configured
+func (p *Pattern) String() string {
+	return p.source
+}
@@ -0,0 +1,61 @@
+package authorization
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	first, err := CompilePattern("^GET /api/.*")
+	if err != nil {
+		t.Fatalf("CompilePattern() error = %v", err)
+	}
+	second, _ := CompilePattern("^GET /api/.*")
+	if first != second {
+		t.Error("CompilePattern() recompiled a cached pattern")
+	}
+	if !first.Match("get /api/users") || first.Match("POST /api/users") {
+		t.Error("compiled pattern should match case-insensitively")
+	}
+	if first.String() != "^GET /api/.*" {
+		t.Errorf("String() = %q", first.String())
+	}
+
+	group, err := CompilePattern(AllOfPattern([]string{"^SELECT", `LIMIT \d+`}))
+	if err != nil {
+		t.Fatalf("CompilePattern(all-of) error = %v", err)
+	}
+	if !group.Match("SELECT * FROM t LIMIT 5") || group.Match("SELECT * FROM t") {
+		t.Error("all-of pattern should require every part")
+	}
+
+	_, err = CompilePattern(AllOfPattern([]string{"^SELECT", "[a-"}))
+	var patternErr *PatternError
+	if !errors.As(err, &patternErr) || patternErr.Pattern != "[a-" {
+		t.Errorf("CompilePattern(invalid) error = %v, want PatternError for the bad part", err)
+	}
+}
+
+func TestCompileWhitelist(t *testing.T) {
+	patterns, errs := CompileWhitelist([]string{"^GET .*", "(unclosed", "^POST /login"})
+	if len(patterns) != 2 || len(errs) != 1 {
+		t.Fatalf("CompileWhitelist() = %d patterns, %d errors, want 2 and 1", len(patterns), len(errs))
+	}
+	if patterns[0].String() != "^GET .*" || patterns[1].String() != "^POST /login" {
+		t.Errorf("CompileWhitelist() kept %v, %v", patterns[0], patterns[1])
+	}
+}
+
+func BenchmarkMatchPattern(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = MatchPattern(`^PUT /api/users/[0-9]+`, "PUT /api/users/123")
+		}
+	})
+	b.Run("recompiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = regexp.MatchString(`(?i)^PUT /api/users/[0-9]+`, "PUT /api/users/123")
+		}
+	})
+}
@@ -1,7 +1,11 @@
 package authorization
 
 import (
+	"net"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/config"
 )
@@ -206,3 +210,439 @@ func TestGetConnectionInfo_Details(t *testing.T) {
 		t.Errorf("Type = %v, want postgres", info["type"])
 	}
 }
+
+func TestMaxDurationForConnection(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "senior-prod", Roles: []string{"senior"}, Tags: []string{"env:prod"}, MaxDuration: 4 * time.Hour},
+			{Name: "junior-prod", Roles: []string{"junior"}, Tags: []string{"env:prod"}, MaxDuration: 15 * time.Minute},
+			{Name: "oncall-prod", Roles: []string{"oncall"}, Tags: []string{"env:prod"}},
+			{Name: "junior-dev", Roles: []string{"junior"}, Tags: []string{"env:dev"}, MaxDuration: time.Minute},
+			{Name: "legacy", Roles: []string{"legacy"}, MaxDuration: 10 * time.Minute},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+			{Name: "untagged-db"},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		roles      []string
+		connection string
+		want       time.Duration
+	}{
+		{"single role cap", []string{"senior"}, "prod-db", 4 * time.Hour},
+		{"most restrictive role wins", []string{"senior", "junior"}, "prod-db", 15 * time.Minute},
+		{"role order does not matter", []string{"junior", "senior", "oncall"}, "prod-db", 15 * time.Minute},
+		{"uncapped policy does not lift a cap", []string{"oncall", "senior"}, "prod-db", 4 * time.Hour},
+		{"no cap", []string{"oncall"}, "prod-db", 0},
+		{"non-matching policy ignored", []string{"junior"}, "untagged-db", 0},
+		{"legacy untagged policy", []string{"legacy"}, "untagged-db", 10 * time.Minute},
+		{"unknown connection", []string{"junior"}, "missing", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.MaxDurationForConnection(tt.roles, tt.connection); got != tt.want {
+				t.Errorf("MaxDurationForConnection(%v, %q) = %v, want %v", tt.roles, tt.connection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentConnectionsForConnection(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "senior-prod", Roles: []string{"senior"}, Tags: []string{"env:prod"}, MaxConcurrentConnections: 5},
+			{Name: "junior-prod", Roles: []string{"junior"}, Tags: []string{"env:prod"}, MaxConcurrentConnections: 1},
+			{Name: "oncall-prod", Roles: []string{"oncall"}, Tags: []string{"env:prod"}},
+			{Name: "junior-dev", Roles: []string{"junior"}, Tags: []string{"env:dev"}, MaxConcurrentConnections: 10},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+			{Name: "dev-db", Tags: []string{"env:dev"}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		roles      []string
+		connection string
+		want       int
+	}{
+		{"single role cap", []string{"senior"}, "prod-db", 5},
+		{"most restrictive role wins", []string{"senior", "junior"}, "prod-db", 1},
+		{"uncapped policy does not lift a cap", []string{"oncall", "senior"}, "prod-db", 5},
+		{"no cap", []string{"oncall"}, "prod-db", 0},
+		{"policy for the connection applies", []string{"junior"}, "dev-db", 10},
+		{"unknown connection", []string{"junior"}, "missing", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.MaxConcurrentConnectionsForConnection(tt.roles, tt.connection); got != tt.want {
+				t.Errorf("MaxConcurrentConnectionsForConnection(%v, %q) = %d, want %d", tt.roles, tt.connection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTablePermissionsForConnection(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "analyst-read", Roles: []string{"analyst"}, Tags: []string{"env:prod"}, TablePermissions: []config.TablePermission{
+				{Operations: []string{"SELECT"}, Tables: []string{"users", "orders"}},
+			}},
+			{Name: "analyst-reports", Roles: []string{"reporter"}, Tags: []string{"env:prod"}, TablePermissions: []config.TablePermission{
+				{Operations: []string{"INSERT"}, Tables: []string{"reports"}},
+			}},
+			{Name: "dev", Roles: []string{"developer"}, Tags: []string{"env:prod"}},
+			{Name: "analyst-dev", Roles: []string{"analyst"}, Tags: []string{"env:dev"}, TablePermissions: []config.TablePermission{
+				{Operations: []string{"*"}, Tables: []string{"*"}},
+			}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		roles      []string
+		connection string
+		want       int
+	}{
+		{"single policy", []string{"analyst"}, "prod-db", 1},
+		{"union across roles", []string{"analyst", "reporter"}, "prod-db", 2},
+		{"policy without table permissions", []string{"developer"}, "prod-db", 0},
+		{"unknown connection", []string{"analyst"}, "missing", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.GetTablePermissionsForConnection(tt.roles, tt.connection); len(got) != tt.want {
+				t.Errorf("GetTablePermissionsForConnection(%v, %q) = %+v, want %d permissions", tt.roles, tt.connection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCopyDirectionsForConnection(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "analyst-export", Roles: []string{"analyst"}, Tags: []string{"env:prod"}, Copy: []string{"to"}},
+			{Name: "loader", Roles: []string{"loader"}, Tags: []string{"env:prod"}, Copy: []string{"FROM", "to"}},
+			{Name: "dev", Roles: []string{"developer"}, Tags: []string{"env:prod"}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  string
+	}{
+		{"single policy", []string{"analyst"}, "TO"},
+		{"union across roles", []string{"analyst", "loader"}, "TO,FROM"},
+		{"policy without copy", []string{"developer"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(authz.GetCopyDirectionsForConnection(tt.roles, "prod-db"), ","); got != tt.want {
+				t.Errorf("GetCopyDirectionsForConnection(%v) = %q, want %q", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiresReason(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "prod-oncall", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, RequireReason: true},
+			{Name: "prod-dev", Roles: []string{"developer"}, Tags: []string{"env:prod"}},
+			{Name: "dev", Roles: []string{"oncall"}, Tags: []string{"env:dev"}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+			{Name: "dev-db", Tags: []string{"env:dev"}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		roles      []string
+		connection string
+		want       bool
+	}{
+		{"policy requires reason", []string{"oncall"}, "prod-db", true},
+		{"any matching policy requires reason", []string{"developer", "oncall"}, "prod-db", true},
+		{"policy without requirement", []string{"developer"}, "prod-db", false},
+		{"other connection", []string{"oncall"}, "dev-db", false},
+		{"unknown connection", []string{"oncall"}, "missing", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.RequiresReason(tt.roles, tt.connection); got != tt.want {
+				t.Errorf("RequiresReason(%v, %q) = %v, want %v", tt.roles, tt.connection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReadOnlyForConnection(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Connections: []config.ConnectionConfig{
+			{Name: "warehouse", ReadOnly: true},
+			{Name: "prod-db", ReadOnlyRoles: []string{"analyst"}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		roles      []string
+		connection string
+		want       bool
+	}{
+		{"read-only connection", []string{"admin"}, "warehouse", true},
+		{"read-only role", []string{"developer", "analyst"}, "prod-db", true},
+		{"other role", []string{"developer"}, "prod-db", false},
+		{"unknown connection", []string{"analyst"}, "missing", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.IsReadOnlyForConnection(tt.roles, tt.connection); got != tt.want {
+				t.Errorf("IsReadOnlyForConnection(%v, %q) = %v, want %v", tt.roles, tt.connection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceAllowed(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "office", Roles: []string{"contractor"}, Tags: []string{"env:prod"}, SourceCIDRs: []string{"203.0.113.0/24", "2001:db8::/32"}},
+			{Name: "vpn-host", Roles: []string{"oncall"}, Tags: []string{"env:prod"}, SourceCIDRs: []string{"198.51.100.10"}},
+			{Name: "anywhere", Roles: []string{"admin"}, Tags: []string{"env:prod"}},
+			{Name: "other-env", Roles: []string{"contractor"}, Tags: []string{"env:dev"}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		roles []string
+		ip    string
+		want  bool
+	}{
+		{"inside cidr", []string{"contractor"}, "203.0.113.50", true},
+		{"inside ipv6 cidr", []string{"contractor"}, "2001:db8::1", true},
+		{"outside cidr", []string{"contractor"}, "198.51.100.1", false},
+		{"single host match", []string{"oncall"}, "198.51.100.10", true},
+		{"single host mismatch", []string{"oncall"}, "198.51.100.11", false},
+		{"any granting policy allows", []string{"contractor", "oncall"}, "198.51.100.10", true},
+		{"unrestricted policy allows", []string{"contractor", "admin"}, "192.0.2.1", true},
+		{"unknown ip with restriction", []string{"contractor"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authz.SourceAllowed(tt.roles, "prod-db", net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("SourceAllowed(%v, %q) = %v, want %v", tt.roles, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForSource(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "vpn-admin", Roles: []string{"dba"}, Tags: []string{"env:prod"}, SourceCIDRs: []string{"10.8.0.0/16"}, Whitelist: []string{`.*`}, MaxDuration: 8 * time.Hour},
+			{Name: "anywhere-read", Roles: []string{"dba"}, Tags: []string{"env:prod"}, Whitelist: []string{`^SELECT`}, MaxDuration: 4 * time.Hour},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+		},
+	})
+	roles := []string{"dba"}
+
+	vpn, outside := net.ParseIP("10.8.1.2"), net.ParseIP("198.51.100.1")
+	if got := authz.ForSource(vpn).GetWhitelistForConnection(roles, "prod-db"); strings.Join(got, ",") != ".*,^SELECT" {
+		t.Errorf("whitelist from the VPN = %v, want both policies", got)
+	}
+	// The VPN-only policy grants nothing from another network, memoized or not
+	for i := 0; i < 2; i++ {
+		if got := authz.ForSource(outside).GetWhitelistForConnection(roles, "prod-db"); strings.Join(got, ",") != "^SELECT" {
+			t.Errorf("whitelist from outside = %v, want only the open policy", got)
+		}
+	}
+	if got := authz.ForSource(outside).MaxDurationForConnection(roles, "prod-db"); got != 4*time.Hour {
+		t.Errorf("max duration from outside = %v, want 4h", got)
+	}
+	if got := authz.ForSource(outside).CheckConnectionAccess(roles, "prod-db"); !got.Allowed || got.Policy != "anywhere-read" {
+		t.Errorf("access from outside = %+v, want granted by anywhere-read", got)
+	}
+	if !authz.SameSourcePolicies(roles, vpn, net.ParseIP("10.8.9.9")) || authz.SameSourcePolicies(roles, vpn, outside) {
+		t.Error("SameSourcePolicies() should only match addresses that get the same policies")
+	}
+}
+
+func TestWhitelistMode(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "any", Roles: []string{"dev"}, Tags: []string{"env:prod"}, Whitelist: []string{`^SELECT`, `LIMIT \d+`}},
+			{Name: "all", Roles: []string{"analyst"}, Tags: []string{"env:prod"}, WhitelistMode: "all", Whitelist: []string{`^SELECT`, `LIMIT \d+`}},
+			{Name: "explain", Roles: []string{"explainer"}, Tags: []string{"env:prod"}, Whitelist: []string{`^EXPLAIN`}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		roles   []string
+		query   string
+		allowed bool
+	}{
+		{"or: first pattern only", []string{"dev"}, "SELECT * FROM users", true},
+		{"or: second pattern only", []string{"dev"}, "DELETE FROM users LIMIT 10", true},
+		{"and: all patterns", []string{"analyst"}, "select * from users limit 10", true},
+		{"and: missing limit", []string{"analyst"}, "SELECT * FROM users", false},
+		{"and: missing select", []string{"analyst"}, "DELETE FROM users LIMIT 10", false},
+		{"and group or other policy", []string{"analyst", "explainer"}, "EXPLAIN SELECT * FROM users", true},
+		{"and group or other policy, neither", []string{"analyst", "explainer"}, "SELECT * FROM users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whitelist := authz.GetWhitelistForConnection(tt.roles, "prod-db")
+			err := authz.ValidatePattern(tt.query, whitelist)
+			if (err == nil) != tt.allowed {
+				t.Errorf("ValidatePattern(%q) error = %v, want allowed %v", tt.query, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestPolicySchedule(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "prod-business-hours", Roles: []string{"dev"}, Tags: []string{"env:prod"}, Whitelist: []string{"^SELECT"},
+				Schedule: &config.Schedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00", Timezone: "UTC"}},
+			{Name: "dev-always", Roles: []string{"dev"}, Tags: []string{"env:dev"}},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "prod-db", Tags: []string{"env:prod"}},
+			{Name: "dev-db", Tags: []string{"env:dev"}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantAccess bool
+		wantList   []string
+	}{
+		{"inside schedule", time.Date(2026, 1, 14, 10, 0, 0, 0, time.UTC), true, []string{"dev-db", "prod-db"}},
+		{"after hours", time.Date(2026, 1, 14, 18, 0, 0, 0, time.UTC), false, []string{"dev-db"}},
+		{"weekend", time.Date(2026, 1, 17, 10, 0, 0, 0, time.UTC), false, []string{"dev-db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz.now = func() time.Time { return tt.now }
+
+			access := authz.CheckConnectionAccess([]string{"dev"}, "prod-db")
+			if access.Allowed != tt.wantAccess {
+				t.Errorf("CheckConnectionAccess().Allowed = %v, want %v", access.Allowed, tt.wantAccess)
+			}
+			if access.OutsideSchedule == tt.wantAccess {
+				t.Errorf("CheckConnectionAccess().OutsideSchedule = %v, want %v", access.OutsideSchedule, !tt.wantAccess)
+			}
+
+			list := authz.ListAccessibleConnections([]string{"dev"})
+			sort.Strings(list)
+			if strings.Join(list, ",") != strings.Join(tt.wantList, ",") {
+				t.Errorf("ListAccessibleConnections() = %v, want %v", list, tt.wantList)
+			}
+
+			whitelist := authz.GetWhitelistForConnectionAt([]string{"dev"}, "prod-db", tt.now)
+			if (len(whitelist) > 0) != tt.wantAccess {
+				t.Errorf("GetWhitelistForConnectionAt() = %v, want patterns only inside schedule", whitelist)
+			}
+		})
+	}
+}
+
+func TestTagExpressions(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "legacy", Roles: []string{"legacy"}, Tags: []string{"env:dev", "team:backend"}},
+			{Name: "non-prod", Roles: []string{"dev"}, Tags: []string{"env in [dev, staging]", "team=backend"}},
+			{Name: "not-prod", Roles: []string{"contractor"}, Tags: []string{"team:backend", "team:data", "!env:prod"}, TagMatch: "any"},
+		},
+		Connections: []config.ConnectionConfig{
+			{Name: "dev-db", Tags: []string{"env:dev", "team:backend"}},
+			{Name: "staging-api", Tags: []string{"env=staging", "team=backend"}},
+			{Name: "prod-db", Tags: []string{"env:prod", "team:backend"}},
+			{Name: "data-lake", Tags: []string{"env:dev", "team:data"}},
+		},
+	})
+
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"legacy", "dev-db"},
+		{"dev", "dev-db,staging-api"},
+		{"contractor", "data-lake,dev-db,staging-api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			got := authz.ListAccessibleConnections([]string{tt.role})
+			sort.Strings(got)
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("ListAccessibleConnections(%s) = %v, want %s", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhitelistMemoization(t *testing.T) {
+	authz := NewAuthorizer(&config.Config{
+		Policies: []config.RolePolicy{
+			{Name: "read", Roles: []string{"dev"}, Tags: []string{"env:prod"}, Whitelist: []string{`^SELECT`}},
+			{Name: "explain", Roles: []string{"ops"}, Tags: []string{"env:prod"}, Whitelist: []string{`^EXPLAIN`}},
+			{
+				Name: "nightly", Roles: []string{"batch"}, Tags: []string{"env:prod"},
+				TimeWhitelists: []config.TimeWindowWhitelist{{Start: "22:00", End: "06:00", Whitelist: []string{`^DELETE`}}},
+			},
+		},
+		Connections: []config.ConnectionConfig{{Name: "prod-db", Tags: []string{"env:prod"}}},
+	})
+
+	first := authz.GetWhitelistForConnection([]string{"dev", "ops"}, "prod-db")
+	second := authz.GetWhitelistForConnection([]string{"ops", "dev"}, "prod-db")
+	if len(first) != 2 || &first[0] != &second[0] {
+		t.Errorf("whitelist for the same roles was rebuilt: %v, %v", first, second)
+	}
+
+	// Time-scoped whitelists follow the clock
+	night := time.Date(2025, 1, 15, 23, 0, 0, 0, time.UTC)
+	noon := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	if got := authz.GetWhitelistForConnectionAt([]string{"batch"}, "prod-db", night); len(got) != 1 || got[0] != `^DELETE` {
+		t.Errorf("whitelist at night = %v, want the nightly window", got)
+	}
+	if got := authz.GetWhitelistForConnectionAt([]string{"batch"}, "prod-db", noon); len(got) != 1 || got[0] != DenyAllPattern {
+		t.Errorf("whitelist at noon = %v, want deny-all", got)
+	}
+}
@@ -0,0 +1,51 @@
+package authorization
+
+import "time"
+
+// WhitelistResolver resolves a user's effective whitelist on a connection at request time,
+// so time-scoped patterns follow the clock for the lifetime of a connection
+type WhitelistResolver struct {
+	authz          *Authorizer
+	roles          []string
+	connectionName string
+	now            func() time.Time
+}
+
+// NewWhitelistResolver creates a resolver for a user's roles on a connection
+func (a *Authorizer) NewWhitelistResolver(roles []string, connectionName string) *WhitelistResolver {
+	return &WhitelistResolver{
+		authz:          a,
+		roles:          roles,
+		connectionName: connectionName,
+		now:            time.Now,
+	}
+}
+
+// Whitelist returns the patterns in effect now
+func (r *WhitelistResolver) Whitelist() []string {
+	return r.authz.GetWhitelistForConnectionAt(r.roles, r.connectionName, r.now())
+}
+
+// Blacklist returns the blacklist patterns in effect now
+func (r *WhitelistResolver) Blacklist() []string {
+	return r.authz.GetBlacklistForConnectionAt(r.roles, r.connectionName, r.now())
+}
+
+// MatchedRule describes the whitelist rule that allows a request now (e.g. policy "dev-read"
+// pattern "^SELECT"), or "" if none does
+func (r *WhitelistResolver) MatchedRule(request string) string {
+	rule, ok := r.authz.MatchingWhitelistRule(r.roles, r.connectionName, request, r.now())
+	if !ok {
+		return ""
+	}
+	return rule.String()
+}
+
+// ExcludedWindow describes the inactive time window that would have allowed a request, or "" if none
+func (r *WhitelistResolver) ExcludedWindow(request string) string {
+	window, ok := r.authz.ExcludedTimeWindow(r.roles, r.connectionName, request, r.now())
+	if !ok {
+		return ""
+	}
+	return window.Describe()
+}
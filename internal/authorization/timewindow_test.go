@@ -0,0 +1,108 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func newTimeWindowAuthorizer(policyWhitelist []string) *Authorizer {
+	return NewAuthorizer(&config.Config{
+		Connections: []config.ConnectionConfig{
+			{Name: "pg", Type: "postgres", Tags: []string{"env:prod"}},
+		},
+		Policies: []config.RolePolicy{
+			{
+				Name:      "dev-prod",
+				Roles:     []string{"developer"},
+				Tags:      []string{"env:prod"},
+				Whitelist: policyWhitelist,
+				TimeWhitelists: []config.TimeWindowWhitelist{
+					{
+						Name:      "business-hours",
+						Days:      []string{"mon", "tue", "wed", "thu", "fri"},
+						Start:     "09:00",
+						End:       "18:00",
+						Whitelist: []string{"^UPDATE.*"},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestAuthorizer_GetWhitelistForConnectionAt(t *testing.T) {
+	wednesdayNoon := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	wednesdayNight := time.Date(2025, 1, 15, 22, 0, 0, 0, time.UTC)
+	saturdayNoon := time.Date(2025, 1, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		policyWhitelist []string
+		now             time.Time
+		query           string
+		wantAllowed     bool
+	}{
+		{"reads anytime", []string{"^SELECT.*"}, wednesdayNight, "SELECT 1", true},
+		{"writes during window", []string{"^SELECT.*"}, wednesdayNoon, "UPDATE users SET a = 1", true},
+		{"writes outside hours", []string{"^SELECT.*"}, wednesdayNight, "UPDATE users SET a = 1", false},
+		{"writes on weekend", []string{"^SELECT.*"}, saturdayNoon, "UPDATE users SET a = 1", false},
+		{"only time-scoped patterns deny all outside window", nil, wednesdayNight, "SELECT 1", false},
+		{"only time-scoped patterns inside window", nil, wednesdayNoon, "UPDATE users SET a = 1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := newTimeWindowAuthorizer(tt.policyWhitelist)
+			whitelist := authz.GetWhitelistForConnectionAt([]string{"developer"}, "pg", tt.now)
+			if len(whitelist) == 0 {
+				t.Fatal("GetWhitelistForConnectionAt() returned an empty whitelist (allows everything)")
+			}
+
+			err := authz.ValidatePattern(tt.query, whitelist)
+			if (err == nil) != tt.wantAllowed {
+				t.Errorf("ValidatePattern(%q) error = %v, want allowed = %v (whitelist %v)", tt.query, err, tt.wantAllowed, whitelist)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_ExcludedTimeWindow(t *testing.T) {
+	authz := newTimeWindowAuthorizer([]string{"^SELECT.*"})
+	night := time.Date(2025, 1, 15, 22, 0, 0, 0, time.UTC)
+	noon := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	window, ok := authz.ExcludedTimeWindow([]string{"developer"}, "pg", "UPDATE users SET a = 1", night)
+	if !ok || window.Name != "business-hours" {
+		t.Errorf("ExcludedTimeWindow() = %v, %v, want business-hours window", window, ok)
+	}
+
+	if _, ok := authz.ExcludedTimeWindow([]string{"developer"}, "pg", "DELETE FROM users", night); ok {
+		t.Error("ExcludedTimeWindow() matched a query no window allows")
+	}
+
+	if _, ok := authz.ExcludedTimeWindow([]string{"developer"}, "pg", "UPDATE users SET a = 1", noon); ok {
+		t.Error("ExcludedTimeWindow() returned an active window")
+	}
+}
+
+func TestWhitelistResolver(t *testing.T) {
+	authz := newTimeWindowAuthorizer([]string{"^SELECT.*"})
+	resolver := authz.NewWhitelistResolver([]string{"developer"}, "pg")
+
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+	if err := authz.ValidatePattern("UPDATE t SET a = 1", resolver.Whitelist()); err != nil {
+		t.Errorf("UPDATE during window blocked: %v", err)
+	}
+
+	// The same resolver follows the clock past the end of the window
+	now = time.Date(2025, 1, 15, 19, 0, 0, 0, time.UTC)
+	if err := authz.ValidatePattern("UPDATE t SET a = 1", resolver.Whitelist()); err == nil {
+		t.Error("UPDATE after window allowed")
+	}
+	if got := resolver.ExcludedWindow("UPDATE t SET a = 1"); got != "business-hours (mon,tue,wed,thu,fri 09:00-18:00 UTC)" {
+		t.Errorf("ExcludedWindow() = %q", got)
+	}
+}
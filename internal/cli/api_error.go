@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Error codes the CLI branches on (see the server's ErrorCode values)
+const (
+	errCodeReasonRequired = "reason_required"
+)
+
+// apiError is an error response from the server: {"error": {"code": "...", "message": "..."}}
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// UnmarshalJSON also accepts the plain string errors sent by older servers
+func (e *apiError) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*e = apiError{Message: message}
+		return nil
+	}
+	type plain apiError
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// parseAPIError extracts the error from a response body. A body that isn't a JSON
+// error response becomes the message as-is.
+func parseAPIError(body []byte) *apiError {
+	var resp struct {
+		Error *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != nil && resp.Error.Message != "" {
+		return resp.Error
+	}
+	return &apiError{Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var approvalReason string
+
+var approvalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "Manage pending approval requests",
+	Long:  "List pending approval requests on the API server and approve or reject them",
+}
+
+var approvalsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pending approval requests",
+	Args:  cobra.NoArgs,
+	RunE:  runApprovalsList,
+}
+
+var approvalsApproveCmd = &cobra.Command{
+	Use:   "approve <request_id>",
+	Short: "Approve a pending request",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApprovalsApprove,
+}
+
+var approvalsRejectCmd = &cobra.Command{
+	Use:   "reject <request_id>",
+	Short: "Reject a pending request",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApprovalsReject,
+}
+
+func init() {
+	approvalsApproveCmd.Flags().StringVar(&approvalReason, "reason", "", "Reason recorded with the approval")
+	approvalsRejectCmd.Flags().StringVar(&approvalReason, "reason", "", "Reason recorded with the rejection")
+
+	approvalsCmd.AddCommand(approvalsListCmd)
+	approvalsCmd.AddCommand(approvalsApproveCmd)
+	approvalsCmd.AddCommand(approvalsRejectCmd)
+}
+
+type pendingApproval struct {
+	RequestID         string            `json:"request_id"`
+	Username          string            `json:"username"`
+	ConnectionID      string            `json:"connection_id"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	Metadata          map[string]string `json:"metadata"`
+	RequestedAt       time.Time         `json:"requested_at"`
+	Approvals         int               `json:"approvals"`
+	RequiredApprovals int               `json:"required_approvals"`
+}
+
+type pendingApprovalsResponse struct {
+	PendingCount int               `json:"pending_count"`
+	Requests     []pendingApproval `json:"requests"`
+}
+
+func runApprovalsList(cmd *cobra.Command, args []string) error {
+	body, err := doApprovalsRequest(cmd, "GET", "/api/approvals/pending")
+	if err != nil {
+		return err
+	}
+
+	var pending pendingApprovalsResponse
+	if err := json.Unmarshal(body, &pending); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if len(pending.Requests) == 0 {
+		_, _ = fmt.Fprintln(out, "No pending approval requests")
+		return nil
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REQUEST ID\tUSER\tCONNECTION\tREQUEST\tAPPROVALS\tAGE")
+	for _, req := range pending.Requests {
+		connection := req.Metadata["connection_name"]
+		if connection == "" {
+			connection = req.ConnectionID
+		}
+		required := req.RequiredApprovals
+		if required < 1 {
+			required = 1
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s %s\t%d/%d\t%s\n",
+			req.RequestID, req.Username, connection, req.Method, req.Path,
+			req.Approvals, required, formatAge(now.Sub(req.RequestedAt)))
+	}
+	return w.Flush()
+}
+
+func runApprovalsApprove(cmd *cobra.Command, args []string) error {
+	return submitApprovalDecision(cmd, args[0], "approve")
+}
+
+func runApprovalsReject(cmd *cobra.Command, args []string) error {
+	return submitApprovalDecision(cmd, args[0], "reject")
+}
+
+// submitApprovalDecision approves or rejects a request as the user of the current token
+func submitApprovalDecision(cmd *cobra.Command, requestID, action string) error {
+	ctx, err := GetCurrentContext()
+	if err != nil {
+		return fmt.Errorf("not logged in: %w. Please run 'login' first", err)
+	}
+
+	query := url.Values{}
+	if claims, err := decodeTokenClaims(ctx.Token); err == nil && claims.Username != "" {
+		query.Set("approver", claims.Username)
+	}
+	if approvalReason != "" {
+		query.Set("reason", approvalReason)
+	}
+
+	path := fmt.Sprintf("/api/approvals/%s/%s", url.PathEscape(requestID), action)
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+
+	body, err := doApprovalsRequest(cmd, "POST", path)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Status    string `json:"status"`
+		Remaining int    `json:"remaining"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if result.Status == "pending" {
+		_, _ = fmt.Fprintf(out, "✓ Approval recorded for %s, awaiting %d more approval(s)\n", requestID, result.Remaining)
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "✓ Request %s %s\n", requestID, result.Status)
+	return nil
+}
+
+// doApprovalsRequest sends an authenticated request to the API server of the current context
+func doApprovalsRequest(cmd *cobra.Command, method, path string) ([]byte, error) {
+	ctx, err := GetCurrentContext()
+	if err != nil {
+		return nil, fmt.Errorf("not logged in: %w. Please run 'login' first", err)
+	}
+	if ctx.Token == "" {
+		return nil, fmt.Errorf("no token found for context '%s'. Please run 'login'", ctx.Name)
+	}
+
+	apiURL := ctx.APIURL
+
+	// Allow override from command line flag (only if explicitly provided)
+	if cmd.Root().PersistentFlags().Changed("api-url") {
+		apiURL, _ = cmd.Root().PersistentFlags().GetString("api-url")
+	}
+
+	req, err := http.NewRequest(method, apiURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ctx.Token))
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("session for context '%s' is expired or invalid. Please run 'login' again", ctx.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed: %w", parseAPIError(body))
+	}
+
+	return body, nil
+}
+
+// formatAge renders how long a request has been pending
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
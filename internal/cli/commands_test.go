@@ -2,12 +2,19 @@ package cli
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/spf13/cobra"
 )
 
@@ -182,6 +189,104 @@ func TestRunList_Success(t *testing.T) {
 	}
 }
 
+func TestRunList_Output(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]connectionInfo{{
+			Name:        "test-db",
+			Type:        "postgres",
+			Description: "Test database",
+			Tags:        []string{"env:test", "team:backend"},
+			Metadata:    map[string]string{"description": "Test database", "environment": "test"},
+			MaxDuration: "30m0s",
+		}})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+	_ = SaveContext(Context{Name: "test", APIURL: server.URL, Token: "valid-token"}, true)
+
+	rootCmd := &cobra.Command{}
+	rootCmd.PersistentFlags().String("api-url", server.URL, "")
+	listCmd := &cobra.Command{Use: "list", RunE: runList}
+	rootCmd.AddCommand(listCmd)
+	defer func() { listOutput = "text" }()
+
+	var text bytes.Buffer
+	listCmd.SetOut(&text)
+	listOutput = "text"
+	if err := listCmd.RunE(listCmd, []string{}); err != nil {
+		t.Fatalf("runList() error = %v", err)
+	}
+	for _, want := range []string{"test-db [postgres] - Test database", "tags: env:test, team:backend", "max duration: 30m0s", "environment: test"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var jsonOut bytes.Buffer
+	listCmd.SetOut(&jsonOut)
+	listOutput = "json"
+	if err := listCmd.RunE(listCmd, []string{}); err != nil {
+		t.Fatalf("runList(--output json) error = %v", err)
+	}
+	var connections []connectionInfo
+	if err := json.Unmarshal(jsonOut.Bytes(), &connections); err != nil {
+		t.Fatalf("json output is not valid JSON: %v\n%s", err, jsonOut.String())
+	}
+	if len(connections) != 1 || connections[0].MaxDuration != "30m0s" || len(connections[0].Tags) != 2 {
+		t.Errorf("json output = %+v, want the connection with tags and max duration", connections)
+	}
+
+	listOutput = "yaml"
+	if err := listCmd.RunE(listCmd, []string{}); err == nil {
+		t.Error("runList(--output yaml) succeeded, want an unsupported format error")
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_ = json.NewEncoder(w).Encode(connectionPolicy{
+			Connection:       "test-db",
+			Type:             "postgres",
+			Whitelist:        []string{"^SELECT.*"},
+			Blacklist:        []string{"(?i)pg_sleep"},
+			TablePermissions: []tablePermission{{Operations: []string{"SELECT"}, Tables: []string{"orders"}}},
+			ReadOnly:         true,
+		})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+	_ = SaveContext(Context{Name: "test", APIURL: server.URL, Token: "valid-token"}, true)
+
+	rootCmd := &cobra.Command{}
+	rootCmd.PersistentFlags().String("api-url", server.URL, "")
+	cmd := &cobra.Command{Use: "policy", RunE: runPolicy}
+	rootCmd.AddCommand(cmd)
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	if err := cmd.RunE(cmd, []string{"test-db"}); err != nil {
+		t.Fatalf("runPolicy() error = %v", err)
+	}
+	if requested != "/api/connections/test-db/policy" {
+		t.Errorf("requested %q", requested)
+	}
+	for _, want := range []string{"test-db [postgres]", "• ^SELECT.*", "• (?i)pg_sleep", "SELECT on orders", "Read-only"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
 func TestRunList_NoToken(t *testing.T) {
 	tmpDir := t.TempDir()
 	oldHome := os.Getenv("HOME")
@@ -271,6 +376,238 @@ func TestRunConnect_NoToken(t *testing.T) {
 	}
 }
 
+// tunnelServer is a fake API that accepts tunnels; serve runs each one, by number from 1
+func tunnelServer(t *testing.T, serve func(n int, ws *websocket.Conn)) (string, *atomic.Int32) {
+	t.Helper()
+	var tunnels atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/proxy/conn-1" || r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.Close() }()
+		serve(int(tunnels.Add(1)), ws)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &tunnels
+}
+
+// echoTunnel echoes binary messages; after limit messages (0 = no limit) it drops the
+// network connection without a close frame
+func echoTunnel(ws *websocket.Conn, limit int) {
+	for i := 0; limit == 0 || i < limit; i++ {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+			return
+		}
+	}
+	_ = ws.UnderlyingConn().Close()
+}
+
+func testTunnelTarget(apiURL, connType string) tunnelTarget {
+	return tunnelTarget{
+		connectionID: "conn-1",
+		connType:     connType,
+		apiURL:       apiURL,
+		session:      &sessionToken{token: "test-token"},
+		expiry:       newConnectionExpiry(time.Now().Add(time.Minute)),
+	}
+}
+
+// roundTrip writes msg to the local side of a tunnel and reads the echo
+func roundTrip(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("write %q error = %v", msg, err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != msg {
+		t.Fatalf("read echo = %q, %v; want %q", buf, err, msg)
+	}
+}
+
+func TestHandleLocalConnection_Reconnect(t *testing.T) {
+	defer func() { autoReconnect = false }()
+	autoReconnect = true
+
+	apiURL, tunnels := tunnelServer(t, func(n int, ws *websocket.Conn) {
+		if n == 1 {
+			echoTunnel(ws, 1) // The first tunnel fails after one message
+			return
+		}
+		echoTunnel(ws, 0)
+	})
+
+	local, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		handleLocalConnection(local, testTunnelTarget(apiURL, "http"))
+		close(done)
+	}()
+
+	roundTrip(t, client, "first")
+	for deadline := time.Now().Add(5 * time.Second); tunnels.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Sent after the first tunnel failed: delivered over the re-established one
+	roundTrip(t, client, "second")
+	if got := tunnels.Load(); got != 2 {
+		t.Errorf("tunnels opened = %d, want 2", got)
+	}
+
+	_ = client.Close()
+	<-done
+}
+
+func TestHandleLocalConnection_NoReconnect(t *testing.T) {
+	tests := []struct {
+		name      string
+		reconnect bool
+		connType  string
+		serve     func(ws *websocket.Conn)
+	}{
+		{"flag not set", false, "tcp", func(ws *websocket.Conn) { echoTunnel(ws, 1) }},
+		{"session protocol", true, "postgres", func(ws *websocket.Conn) { echoTunnel(ws, 1) }},
+		{"stateful tcp stream", true, "tcp", func(ws *websocket.Conn) { echoTunnel(ws, 1) }},
+		{"stateful kafka stream", true, "kafka", func(ws *websocket.Conn) { echoTunnel(ws, 1) }},
+		{"closed by server", true, "tcp", func(ws *websocket.Conn) {
+			_, data, _ := ws.ReadMessage()
+			_ = ws.WriteMessage(websocket.BinaryMessage, data)
+			_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() { autoReconnect = false }()
+			autoReconnect = tt.reconnect
+
+			apiURL, tunnels := tunnelServer(t, func(n int, ws *websocket.Conn) { tt.serve(ws) })
+
+			local, client := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				handleLocalConnection(local, testTunnelTarget(apiURL, tt.connType))
+				close(done)
+			}()
+
+			roundTrip(t, client, "first")
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("local connection still open after the tunnel ended")
+			}
+			if got := tunnels.Load(); got != 1 {
+				t.Errorf("tunnels opened = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestHandleLocalConnection_ExtendedNotice(t *testing.T) {
+	extendedTo := time.Now().Add(time.Hour).Truncate(time.Second)
+	apiURL, _ := tunnelServer(t, func(n int, ws *websocket.Conn) {
+		notice, _ := json.Marshal(tunnelNotice{Type: "connection_extended", ExpiresAt: extendedTo})
+		_ = ws.WriteMessage(websocket.TextMessage, notice)
+		echoTunnel(ws, 0)
+	})
+
+	target := testTunnelTarget(apiURL, "tcp")
+	changed := target.expiry.Changed()
+	local, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		handleLocalConnection(local, target)
+		close(done)
+	}()
+
+	// The notice is not passed to the local app
+	roundTrip(t, client, "ping")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expiry did not move")
+	}
+	if got := target.expiry.Get(); !got.Equal(extendedTo) {
+		t.Errorf("expiry = %v, want %v", got, extendedTo)
+	}
+
+	_ = client.Close()
+	<-done
+}
+
+func TestConnectionExpiry_Extend(t *testing.T) {
+	start := time.Now().Add(time.Minute)
+	expiry := newConnectionExpiry(start)
+	if expiry.Extend(start.Add(-time.Second)) || expiry.Extend(start) {
+		t.Error("Extend() to an earlier or equal expiry reported a change")
+	}
+	if !expiry.Extend(start.Add(time.Minute)) || !expiry.Get().Equal(start.Add(time.Minute)) {
+		t.Errorf("Extend() did not move the expiry: %v", expiry.Get())
+	}
+
+	var unknown *connectionExpiry
+	if !unknown.Get().IsZero() || unknown.Extend(start) {
+		t.Error("nil expiry should be unknown and never extend")
+	}
+}
+
+func TestDialTunnel_Retries(t *testing.T) {
+	defer func() { autoReconnect = false }()
+	autoReconnect = true
+
+	var attempts atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = ws.Close()
+	}))
+	defer server.Close()
+
+	ws, err := dialTunnel(testTunnelTarget(server.URL, "tcp"))
+	if err != nil {
+		t.Fatalf("dialTunnel() error = %v, want success after a retry", err)
+	}
+	_ = ws.Close()
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+
+	// A refused tunnel (expired connection) is not retried
+	apiURL, _ := tunnelServer(t, func(int, *websocket.Conn) {})
+	target := testTunnelTarget(apiURL, "tcp")
+	target.connectionID = "expired"
+	if _, err := dialTunnel(target); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("dialTunnel() error = %v, want the 404 without retrying", err)
+	}
+}
+
+func TestNextReconnectDelay(t *testing.T) {
+	delay := reconnectInitialDelay
+	for i := 0; i < 10; i++ {
+		delay = nextReconnectDelay(delay)
+	}
+	if delay != reconnectMaxDelay {
+		t.Errorf("delay after 10 attempts = %s, want the %s cap", delay, reconnectMaxDelay)
+	}
+}
+
 func TestRunConnect_InvalidToken(t *testing.T) {
 	tmpDir := t.TempDir()
 	oldHome := os.Getenv("HOME")
@@ -301,6 +638,100 @@ func TestRunConnect_InvalidToken(t *testing.T) {
 	}
 }
 
+func TestRequestConnection_Reason(t *testing.T) {
+	var gotReason string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotReason = req.Reason
+		if req.Reason == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"A reason is required to connect to this connection","reason_required":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"connection_id":"conn-1"}`))
+	}))
+	defer server.Close()
+
+	status, body, err := requestConnection(server.URL, "token", "prod-db", "")
+	if err != nil {
+		t.Fatalf("requestConnection() error = %v", err)
+	}
+	if status != http.StatusBadRequest || !reasonRequired(body) {
+		t.Errorf("requestConnection() without reason = %d %s, want 400 with reason_required", status, body)
+	}
+
+	status, _, err = requestConnection(server.URL, "token", "prod-db", "INC-1234")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("requestConnection() with reason = %d, %v", status, err)
+	}
+	if gotReason != "INC-1234" {
+		t.Errorf("server received reason %q, want INC-1234", gotReason)
+	}
+
+	if reasonRequired([]byte(`{"error":"Access denied"}`)) {
+		t.Error("reasonRequired() = true for an unrelated error")
+	}
+	if !reasonRequired([]byte(`{"error":{"code":"reason_required","message":"A reason is required"}}`)) {
+		t.Error("reasonRequired() = false for the reason_required code")
+	}
+}
+
+func TestRequestExtension(t *testing.T) {
+	expiresAt := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+	var gotPath, gotDuration string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		var req struct {
+			Duration string `json:"duration"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotDuration = req.Duration
+		if req.Duration == "2h" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":"extension_limit_reached","message":"Connection cannot be extended past its maximum duration"}}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(extendResponse{ConnectionID: "conn-1", ExpiresAt: expiresAt})
+	}))
+	defer server.Close()
+
+	extended, err := requestExtension(server.URL, "token", "conn-1", "30m", "")
+	if err != nil {
+		t.Fatalf("requestExtension() error = %v", err)
+	}
+	if gotPath != "/api/connect/conn-1/extend" || gotDuration != "30m" {
+		t.Errorf("server received %s with duration %q", gotPath, gotDuration)
+	}
+	if !extended.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires_at = %v, want %v", extended.ExpiresAt, expiresAt)
+	}
+
+	if _, err := requestExtension(server.URL, "token", "conn-1", "2h", ""); err == nil || !strings.Contains(err.Error(), "maximum duration") {
+		t.Errorf("requestExtension() past the max error = %v", err)
+	}
+}
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		body        string
+		wantCode    string
+		wantMessage string
+	}{
+		{`{"error":{"code":"connection_not_found","message":"Connection not found"}}`, "connection_not_found", "Connection not found"},
+		{`{"error":"Invalid credentials"}`, "", "Invalid credentials"},
+		{"upstream timed out\n", "", "upstream timed out"},
+	}
+	for _, tt := range tests {
+		got := parseAPIError([]byte(tt.body))
+		if got.Code != tt.wantCode || got.Message != tt.wantMessage {
+			t.Errorf("parseAPIError(%q) = %+v, want code %q message %q", tt.body, got, tt.wantCode, tt.wantMessage)
+		}
+	}
+}
+
 func BenchmarkRunLogin(b *testing.B) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		response := loginResponse{
@@ -370,3 +801,354 @@ func BenchmarkRunList(b *testing.B) {
 		_ = listCmd.RunE(listCmd, []string{})
 	}
 }
+
+func TestRunLogout(t *testing.T) {
+	tests := []struct {
+		name       string
+		context    string
+		all        bool
+		wantErr    bool
+		wantTokens map[string]string
+	}{
+		{
+			name:       "current context",
+			wantTokens: map[string]string{"dev": "", "prod": "prod-token"},
+		},
+		{
+			name:       "named context",
+			context:    "prod",
+			wantTokens: map[string]string{"dev": "dev-token", "prod": ""},
+		},
+		{
+			name:       "all contexts",
+			all:        true,
+			wantTokens: map[string]string{"dev": "", "prod": ""},
+		},
+		{
+			name:       "unknown context is not an error",
+			context:    "staging",
+			wantTokens: map[string]string{"dev": "dev-token", "prod": "prod-token"},
+		},
+		{
+			name:       "context and all are exclusive",
+			context:    "prod",
+			all:        true,
+			wantErr:    true,
+			wantTokens: map[string]string{"dev": "dev-token", "prod": "prod-token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			oldHome := os.Getenv("HOME")
+			_ = os.Setenv("HOME", tmpDir)
+			defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+			_ = SaveContext(Context{Name: "prod", APIURL: "https://prod", Token: "prod-token"}, false)
+			_ = SaveContext(Context{Name: "dev", APIURL: "http://dev", Token: "dev-token"}, true)
+
+			logoutContext = tt.context
+			logoutAll = tt.all
+			defer func() { logoutContext, logoutAll = "", false }()
+
+			err := runLogout(logoutCmd, []string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runLogout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if len(cfg.Contexts) != 2 {
+				t.Errorf("contexts = %d, want 2 (logout keeps contexts)", len(cfg.Contexts))
+			}
+			for _, ctx := range cfg.Contexts {
+				if ctx.Token != tt.wantTokens[ctx.Name] {
+					t.Errorf("context %s token = %q, want %q", ctx.Name, ctx.Token, tt.wantTokens[ctx.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestRunLogout_NotLoggedIn(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+	if err := runLogout(logoutCmd, []string{}); err != nil {
+		t.Errorf("runLogout() error = %v, want nil when not logged in", err)
+	}
+
+	logoutAll = true
+	defer func() { logoutAll = false }()
+	if err := runLogout(logoutCmd, []string{}); err != nil {
+		t.Errorf("runLogout(--all) error = %v, want nil when not logged in", err)
+	}
+}
+
+func TestRunWhoami(t *testing.T) {
+	makeToken := func(claims map[string]interface{}) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+		payload, _ := json.Marshal(claims)
+		return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantErr  bool
+		wantText []string
+	}{
+		{
+			name: "valid token",
+			token: makeToken(map[string]interface{}{
+				"username": "alice",
+				"roles":    []string{"developer", "qa"},
+				"email":    "alice@example.com",
+				"exp":      time.Now().Add(2 * time.Hour).Unix(),
+			}),
+			wantText: []string{"Username: alice", "Roles:    developer, qa", "Email:    alice@example.com", "remaining"},
+		},
+		{
+			name: "expired token",
+			token: makeToken(map[string]interface{}{
+				"username": "alice",
+				"exp":      time.Now().Add(-time.Hour).Unix(),
+			}),
+			wantText: []string{"EXPIRED", "login"},
+		},
+		{
+			name:    "malformed token",
+			token:   "not-a-jwt",
+			wantErr: true,
+		},
+		{
+			name:    "no token",
+			token:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			oldHome := os.Getenv("HOME")
+			_ = os.Setenv("HOME", tmpDir)
+			defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+			_ = SaveContext(Context{Name: "default", APIURL: "http://localhost:8080", Token: tt.token}, true)
+
+			out := &bytes.Buffer{}
+			whoamiCmd.SetOut(out)
+			defer whoamiCmd.SetOut(nil)
+
+			err := runWhoami(whoamiCmd, []string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runWhoami() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, text := range tt.wantText {
+				if !strings.Contains(out.String(), text) {
+					t.Errorf("output = %q, want it to contain %q", out.String(), text)
+				}
+			}
+		})
+	}
+}
+
+func TestRunApprovals(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"username":"bob"}`))
+	token := header + "." + payload + ".signature"
+
+	var gotApprover, gotReason, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		gotPath = r.URL.Path
+		switch r.URL.Path {
+		case "/api/approvals/pending":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"pending_count": 1,
+				"requests": []map[string]interface{}{{
+					"request_id":         "req-1",
+					"username":           "alice",
+					"connection_id":      "conn-1",
+					"method":             "DELETE",
+					"path":               "/api/users/1",
+					"metadata":           map[string]string{"connection_name": "prod-api"},
+					"requested_at":       time.Now().Add(-90 * time.Second),
+					"approvals":          0,
+					"required_approvals": 1,
+				}},
+			})
+		case "/api/approvals/req-1/approve", "/api/approvals/req-1/reject":
+			gotApprover = r.URL.Query().Get("approver")
+			gotReason = r.URL.Query().Get("reason")
+			status := "approved"
+			if strings.HasSuffix(r.URL.Path, "/reject") {
+				status = "rejected"
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"status": status, "request_id": "req-1"})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+	// The stored API URL is stale; --api-url must take precedence
+	_ = SaveContext(Context{Name: "default", APIURL: "http://127.0.0.1:1", Token: token}, true)
+
+	rootCmd := &cobra.Command{}
+	rootCmd.PersistentFlags().String("api-url", "http://localhost:8080", "")
+	_ = rootCmd.PersistentFlags().Set("api-url", server.URL)
+	cmd := &cobra.Command{Use: "approvals"}
+	rootCmd.AddCommand(cmd)
+
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+
+	if err := runApprovalsList(cmd, nil); err != nil {
+		t.Fatalf("runApprovalsList() error = %v", err)
+	}
+	for _, text := range []string{"req-1", "alice", "prod-api", "DELETE /api/users/1", "0/1", "1m30s"} {
+		if !strings.Contains(out.String(), text) {
+			t.Errorf("list output = %q, want it to contain %q", out.String(), text)
+		}
+	}
+
+	approvalReason = "looks fine"
+	defer func() { approvalReason = "" }()
+	if err := runApprovalsApprove(cmd, []string{"req-1"}); err != nil {
+		t.Fatalf("runApprovalsApprove() error = %v", err)
+	}
+	if gotApprover != "bob" || gotReason != "looks fine" {
+		t.Errorf("approve sent approver=%q reason=%q, want bob and the --reason flag", gotApprover, gotReason)
+	}
+
+	if err := runApprovalsReject(cmd, []string{"req-1"}); err != nil {
+		t.Fatalf("runApprovalsReject() error = %v", err)
+	}
+	if gotPath != "/api/approvals/req-1/reject" || !strings.Contains(out.String(), "req-1 rejected") {
+		t.Errorf("reject path = %q, output = %q", gotPath, out.String())
+	}
+
+	_ = SaveContext(Context{Name: "default", APIURL: server.URL, Token: "expired-token"}, true)
+	err := runApprovalsList(cmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "login") {
+		t.Errorf("runApprovalsList() with rejected token error = %v, want re-login prompt", err)
+	}
+}
+
+func TestRunContextCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+	_ = SaveContext(Context{Name: "dev", APIURL: "http://localhost:8080", Token: "dev-token"}, true)
+	_ = SaveContext(Context{Name: "prod", APIURL: "https://pa.example.com"}, false)
+
+	run := func(runE func(*cobra.Command, []string) error, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		cmd := &cobra.Command{}
+		cmd.SetOut(out)
+		err := runE(cmd, args)
+		return out.String(), err
+	}
+
+	out, err := run(runContextList)
+	if err != nil {
+		t.Fatalf("context list error = %v", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "dev") && !strings.HasPrefix(line, "*") {
+			t.Errorf("current context dev not marked in %q", line)
+		}
+		if strings.Contains(line, "prod") && strings.HasPrefix(line, "*") {
+			t.Errorf("non-current context prod marked in %q", line)
+		}
+	}
+
+	out, err = run(runContextUse, "prod")
+	if err != nil {
+		t.Fatalf("context use error = %v", err)
+	}
+	if !strings.Contains(out, "Not authenticated") {
+		t.Errorf("context use output = %q, want a login hint for a context without token", out)
+	}
+	if ctx, _ := GetCurrentContext(); ctx == nil || ctx.Name != "prod" {
+		t.Errorf("current context = %v, want prod", ctx)
+	}
+
+	if _, err := run(runContextRename, "prod", "dev"); err == nil {
+		t.Error("renaming to an existing context name succeeded")
+	}
+	if _, err := run(runContextRename, "prod", " "); err == nil {
+		t.Error("renaming to an empty name succeeded")
+	}
+	if _, err := run(runContextRename, "prod", "production"); err != nil {
+		t.Fatalf("context rename error = %v", err)
+	}
+	if ctx, _ := GetCurrentContext(); ctx == nil || ctx.Name != "production" || ctx.APIURL != "https://pa.example.com" {
+		t.Errorf("current context after rename = %+v, want production at https://pa.example.com", ctx)
+	}
+
+	if _, err := run(runContextDelete, "production"); err == nil {
+		t.Error("deleting the current context succeeded while others exist")
+	}
+	if _, err := run(runContextDelete, "dev"); err != nil {
+		t.Fatalf("context delete error = %v", err)
+	}
+	if _, err := GetContext("dev"); err == nil {
+		t.Error("deleted context dev still exists")
+	}
+}
+
+func TestRunLogin_UsesContextAPIURL(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		response := loginResponse{Token: "prod-token", ExpiresAt: "2025-12-31T23:59:59Z"}
+		response.User.Username = "admin"
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+	_ = SaveContext(Context{Name: "prod", APIURL: server.URL}, true)
+
+	// The --api-url default must not override the context's own URL
+	rootCmd := &cobra.Command{}
+	rootCmd.PersistentFlags().String("api-url", "http://localhost:1", "")
+	loginCmd := &cobra.Command{Use: "login", RunE: runLogin}
+	rootCmd.AddCommand(loginCmd)
+
+	username, password, loginProvider, contextName = "admin", "admin123", "", ""
+	defer func() { contextName = "" }()
+
+	if err := loginCmd.RunE(loginCmd, []string{}); err != nil {
+		t.Fatalf("runLogin() error = %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("login requests to the context's API URL = %d, want 1", hits)
+	}
+	ctx, err := GetCurrentContext()
+	if err != nil || ctx.Name != "prod" || ctx.Token != "prod-token" || ctx.APIURL != server.URL {
+		t.Errorf("current context = %+v (err %v), want prod with the new token at %s", ctx, err, server.URL)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Context represents an API server context
@@ -227,6 +228,14 @@ func SetCurrentContext(name string) error {
 
 // RenameContext renames an existing context
 func RenameContext(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("context name cannot be empty")
+	}
+	if newName == oldName {
+		return fmt.Errorf("context '%s' is already named '%s'", oldName, newName)
+	}
+
 	cfg, err := LoadConfig()
 	if err != nil {
 		return err
@@ -260,3 +269,36 @@ func RenameContext(oldName, newName string) error {
 
 	return SaveConfig(cfg)
 }
+
+// ClearTokens removes saved tokens from the named contexts (all contexts if no names are given)
+// Contexts are kept so their API URL can be reused on the next login.
+// Returns the names of the contexts whose token was removed.
+func ClearTokens(names ...string) ([]string, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	cleared := []string{}
+	for i, ctx := range cfg.Contexts {
+		if len(names) > 0 && !selected[ctx.Name] {
+			continue
+		}
+		if ctx.Token == "" {
+			continue
+		}
+		cfg.Contexts[i].Token = ""
+		cleared = append(cleared, ctx.Name)
+	}
+
+	if len(cleared) == 0 {
+		return cleared, nil
+	}
+
+	return cleared, SaveConfig(cfg)
+}
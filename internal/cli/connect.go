@@ -1,8 +1,13 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,7 +15,9 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -27,20 +34,232 @@ var connectCmd = &cobra.Command{
 }
 
 var (
-	localPort int
+	localPort      int
+	explainPreview bool
+	traceConnect   bool
+	connectReason  string
+	connectDB      string
+	autoReconnect  bool
+	compressTunnel bool
+	promptExtend   bool
+
+	// traceParent is the W3C traceparent sent with the connect request and every tunnel (--trace)
+	traceParent string
+
+	// bannerAccepted is set once the user agreed to a banner that requires acknowledgement
+	bannerAccepted bool
 )
 
 func init() {
 	connectCmd.Flags().IntVarP(&localPort, "local-port", "l", 0, "Local port to listen on (required)")
+	connectCmd.Flags().BoolVar(&explainPreview, "explain", false, "Preview queries with EXPLAIN instead of executing them (postgres only)")
+	connectCmd.Flags().BoolVar(&traceConnect, "trace", false, "Send a traceparent header so the connection can be followed in the server's traces")
+	connectCmd.Flags().StringVar(&connectReason, "reason", "", "Why you are connecting (recorded in the audit log and shown to approvers; prompted for when a policy requires one)")
+	connectCmd.Flags().StringVar(&connectDB, "database", "", "Database to use (postgres only; one of the connection's allowed_databases)")
+	connectCmd.Flags().BoolVar(&autoReconnect, "reconnect", false, "Re-establish tunnels to the API after transient network failures, until the connection expires. HTTP requests resume on the open local connection; other protocols (postgres, tcp, kafka, ssh, ...) close it and the client must reconnect, as backend sessions don't survive the tunnel")
+	connectCmd.Flags().BoolVar(&promptExtend, "prompt-extend", false, "Offer to extend the connection shortly before it expires")
+	connectCmd.Flags().BoolVar(&compressTunnel, "compress", false, "Compress tunnel traffic (permessage-deflate) when the server allows it; saves bandwidth on large text results at some CPU cost")
 	_ = connectCmd.MarkFlagRequired("local-port")
 }
 
 type connectResponse struct {
-	ConnectionID string `json:"connection_id"`
-	ExpiresAt    string `json:"expires_at"`
-	ProxyURL     string `json:"proxy_url"`
-	Type         string `json:"type,omitempty"`     // Connection type (postgres, http, tcp)
-	Database     string `json:"database,omitempty"` // For postgres connections
+	ConnectionID string  `json:"connection_id"`
+	ExpiresAt    string  `json:"expires_at"`
+	ProxyURL     string  `json:"proxy_url"`
+	Type         string  `json:"type,omitempty"`          // Connection type (postgres, http, tcp, ssh, kafka)
+	Database     string  `json:"database,omitempty"`      // For postgres connections
+	KafkaBrokers []int32 `json:"kafka_brokers,omitempty"` // For kafka connections: a local listener is opened per broker
+	// Banner is a usage notice; with BannerRequireAck every tunnel must acknowledge it
+	Banner           string `json:"banner,omitempty"`
+	BannerRequireAck bool   `json:"banner_require_ack,omitempty"`
+}
+
+// requestConnection asks the API for a connection (on the --database database, if set),
+// returning the response status and body
+func requestConnection(apiURL, token, connectionName, reason string) (int, []byte, error) {
+	var reqBody io.Reader
+	if reason != "" || connectDB != "" {
+		fields := map[string]string{}
+		if reason != "" {
+			fields["reason"] = reason
+		}
+		if connectDB != "" {
+			fields["database"] = connectDB
+		}
+		payload, err := json.Marshal(fields)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/connect/%s", apiURL, connectionName), reqBody)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if traceParent != "" {
+		req.Header.Set("traceparent", traceParent)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// reasonRequired reports whether a connect error response asks for a reason
+// (older servers only set the reason_required flag)
+func reasonRequired(body []byte) bool {
+	if parseAPIError(body).Code == errCodeReasonRequired {
+		return true
+	}
+	var errResp struct {
+		ReasonRequired bool `json:"reason_required"`
+	}
+	return json.Unmarshal(body, &errResp) == nil && errResp.ReasonRequired
+}
+
+// Backoff between tunnel reconnect attempts (--reconnect)
+const (
+	reconnectInitialDelay = time.Second
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// resumableProtocols are the connection types whose tunnels can be resumed on the same
+// local connection: stateless, request by request. Every tunnel dials a fresh backend
+// socket, so stateful streams (tcp, kafka, postgres, ...) would continue mid-session on a
+// backend expecting a new handshake or login; their clients see the disconnect and
+// reconnect themselves.
+var resumableProtocols = map[string]bool{
+	"http": true,
+}
+
+func resumableProtocol(connType string) bool {
+	return resumableProtocols[connType]
+}
+
+// nextReconnectDelay doubles a reconnect delay, up to reconnectMaxDelay
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > reconnectMaxDelay {
+		return reconnectMaxDelay
+	}
+	return delay
+}
+
+// tunnelTarget is the server-side connection local connections are tunneled to
+type tunnelTarget struct {
+	connectionID string
+	connType     string
+	apiURL       string
+	session      *sessionToken
+	expiry       *connectionExpiry // Nil if unknown
+	headers      http.Header       // Extra tunnel headers (kafka broker routing)
+}
+
+// extendPromptLead is how long before expiry --prompt-extend offers an extension
+const extendPromptLead = 2 * time.Minute
+
+// connectionExpiry is when the tunneled connection expires; extensions move it
+type connectionExpiry struct {
+	mu      sync.Mutex
+	at      time.Time
+	changed chan struct{} // Closed (and replaced) when the expiry moves
+}
+
+func newConnectionExpiry(at time.Time) *connectionExpiry {
+	return &connectionExpiry{at: at, changed: make(chan struct{})}
+}
+
+// Get returns the current expiry, zero if unknown
+func (e *connectionExpiry) Get() time.Time {
+	if e == nil {
+		return time.Time{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.at
+}
+
+// Changed returns a channel closed the next time the expiry moves
+func (e *connectionExpiry) Changed() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.changed
+}
+
+// Extend moves the expiry out to at, reporting whether it moved
+// (every tunnel hears about the same extension)
+func (e *connectionExpiry) Extend(at time.Time) bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !at.After(e.at) {
+		return false
+	}
+	e.at = at
+	close(e.changed)
+	e.changed = make(chan struct{})
+	return true
+}
+
+// tunnelNotice is a JSON text message from the server about the connection
+type tunnelNotice struct {
+	Type      string    `json:"type"` // connection_extended
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tunnelLostError is a tunnel that failed, as opposed to one the server closed
+type tunnelLostError struct {
+	err error
+}
+
+func (e *tunnelLostError) Error() string {
+	return "tunnel lost: " + e.err.Error()
+}
+
+func (e *tunnelLostError) Unwrap() error {
+	return e.err
+}
+
+// tunnelReadError classifies why reading a tunnel stopped: nil when the server closed it
+// normally, a *tunnelLostError when the transport failed (network error, abnormal
+// closure, server restarting or failing), otherwise the server's close reason
+func tunnelReadError(err error) error {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return &tunnelLostError{err: fmt.Errorf("websocket read error: %w", err)}
+	}
+	switch closeErr.Code {
+	case websocket.CloseNormalClosure:
+		return nil
+	case websocket.CloseAbnormalClosure, websocket.CloseGoingAway, websocket.CloseInternalServerErr:
+		return &tunnelLostError{err: fmt.Errorf("websocket read error: %w", err)}
+	default:
+		return fmt.Errorf("websocket read error: %w", err)
+	}
+}
+
+// bannerMessage is the banner acknowledgement handshake sent over the tunnel
+type bannerMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	Token   string `json:"token"`
 }
 
 func runConnect(cmd *cobra.Command, args []string) error {
@@ -65,28 +284,36 @@ func runConnect(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("authentication expired or invalid: %w\nPlease login again: ./port-authorizing-cli login", err)
 	}
 
-	// Request connection from API (duration is set by server config)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/connect/%s", apiURL, connectionName), nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if traceConnect {
+		traceParent, err = newTraceParent()
+		if err != nil {
+			return fmt.Errorf("failed to generate trace ID: %w", err)
+		}
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Request connection from API (duration is set by server config)
+	reason := strings.TrimSpace(connectReason)
+	status, body, err := requestConnection(apiURL, token, connectionName, reason)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	// Ask for a reason when the user's policy requires one and none was given
+	if status == http.StatusBadRequest && reason == "" && reasonRequired(body) {
+		fmt.Print("A reason is required to connect. Reason: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		reason = strings.TrimSpace(answer)
+		if reason == "" {
+			return fmt.Errorf("a reason is required to connect to %s (use --reason)", connectionName)
+		}
+		status, body, err = requestConnection(apiURL, token, connectionName, reason)
+		if err != nil {
+			return err
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("connection failed: %s", string(body))
+	if status != http.StatusOK {
+		return fmt.Errorf("connection failed: %w", parseAPIError(body))
 	}
 
 	var connResp connectResponse
@@ -94,11 +321,29 @@ func runConnect(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	// Show the connection banner, asking for consent when the server requires it
+	if connResp.Banner != "" {
+		fmt.Printf("\n%s\n\n", connResp.Banner)
+	}
+	if connResp.BannerRequireAck {
+		fmt.Print("Type 'yes' to acknowledge and continue: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "yes") {
+			return fmt.Errorf("banner not acknowledged; connection will not be used")
+		}
+		bannerAccepted = true
+	}
+
 	fmt.Printf("✓ Connection established: %s\n", connectionName)
 	fmt.Printf("  Connection ID: %s\n", connResp.ConnectionID)
 	fmt.Printf("  Expires at: %s\n", connResp.ExpiresAt)
 	fmt.Printf("  Local port: %d\n", localPort)
+	if traceParent != "" {
+		fmt.Printf("  Trace ID: %s\n", strings.Split(traceParent, "-")[1])
+	}
 	fmt.Printf("  Server will auto-disconnect at expiry\n")
+	fmt.Printf("  Need more time? port-authorizing extend %s\n", connResp.ConnectionID)
+	fmt.Printf("  Blocked requests? See what you may run: port-authorizing policy %s\n", connectionName)
 
 	// Show connection examples based on service type
 	if connResp.Type == "postgres" {
@@ -116,23 +361,110 @@ func runConnect(cmd *cobra.Command, args []string) error {
 		fmt.Printf("\n  🔒 Backend credentials are hidden - managed by server.\n")
 		fmt.Printf("  🔒 All queries logged with your username.\n")
 	}
+	if connResp.Type == "ssh" {
+		fmt.Printf("\n📝 SSH Connection Info:\n")
+		fmt.Printf("  ssh -p %d localhost\n", localPort)
+		fmt.Printf("  sftp -P %d localhost\n", localPort)
+		fmt.Printf("\n  🔒 No SSH credentials needed - the server logs in to the backend for you.\n")
+		fmt.Printf("  🔒 Commands and file transfers are logged with your username.\n")
+	}
+
+	// Kafka clients reconnect to each broker, so every broker gets its own local port
+	var streamHeaders map[int]http.Header
+	if connResp.Type == "kafka" {
+		streamHeaders = kafkaStreamHeaders(localPort, connResp.KafkaBrokers)
+		fmt.Printf("\n📝 Kafka Connection Info:\n")
+		fmt.Printf("  Bootstrap server: localhost:%d\n", localPort)
+		for i, id := range connResp.KafkaBrokers {
+			fmt.Printf("  Broker %d: localhost:%d\n", id, localPort+1+i)
+		}
+		fmt.Printf("\n  🔒 Broker addresses in metadata point back to these local ports.\n")
+		fmt.Printf("  🔒 Produce/fetch requests are checked per topic and logged with your username.\n")
+	}
 
 	fmt.Println("\nStarting local proxy server...")
 
+	// Renew the token before it expires so tunnels opened late in the session still authenticate
+	session := newSessionToken(*ctx, apiURL)
+	stopRefresh := make(chan struct{})
+	defer close(stopRefresh)
+	go session.keepFresh(stopRefresh)
+
 	// Start local proxy server with expiry time
-	if err := startLocalProxy(localPort, connResp.ConnectionID, token, connResp.ExpiresAt, apiURL); err != nil {
+	if err := startLocalProxy(localPort, connResp.ConnectionID, connResp.Type, session, connResp.ExpiresAt, apiURL, streamHeaders); err != nil {
 		return fmt.Errorf("failed to start local proxy: %w", err)
 	}
 
 	return nil
 }
 
-func startLocalProxy(port int, connectionID, token string, expiresAt string, apiURL string) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return fmt.Errorf("failed to listen on port %d: %w", port, err)
+// newTraceParent returns a W3C traceparent header value for a new, sampled trace
+func newTraceParent() (string, error) {
+	id := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(id[:16]), hex.EncodeToString(id[16:])), nil
+}
+
+// kafkaStreamHeaders assigns each broker the local port after the bootstrap port
+// (in broker order) and returns the tunnel headers for every local port, telling
+// the server which broker a stream targets and where each broker is listened for
+func kafkaStreamHeaders(port int, brokers []int32) map[int]http.Header {
+	listeners := make([]string, 0, len(brokers))
+	for i, id := range brokers {
+		listeners = append(listeners, fmt.Sprintf("%d=localhost:%d", id, port+1+i))
+	}
+
+	newHeaders := func() http.Header {
+		h := http.Header{}
+		h.Set("X-Kafka-Bootstrap", fmt.Sprintf("localhost:%d", port))
+		if len(listeners) > 0 {
+			h.Set("X-Kafka-Listeners", strings.Join(listeners, ","))
+		}
+		return h
+	}
+
+	headers := map[int]http.Header{port: newHeaders()}
+	for i, id := range brokers {
+		h := newHeaders()
+		h.Set("X-Kafka-Broker", strconv.Itoa(int(id)))
+		headers[port+1+i] = h
+	}
+	return headers
+}
+
+// startLocalProxy listens on port and tunnels every local connection to the server.
+// streamHeaders, if set, lists every local port to listen on with the extra
+// headers its tunnels send (port must be one of them).
+func startLocalProxy(port int, connectionID, connType string, session *sessionToken, expiresAt string, apiURL string, streamHeaders map[int]http.Header) error {
+	if streamHeaders == nil {
+		streamHeaders = map[int]http.Header{port: nil}
+	}
+
+	// Accept connections in goroutines
+	type localConn struct {
+		conn    net.Conn
+		headers http.Header
+	}
+	connChan := make(chan localConn)
+	for listenPort, headers := range streamHeaders {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", listenPort))
+		if err != nil {
+			return fmt.Errorf("failed to listen on port %d: %w", listenPort, err)
+		}
+		defer func() { _ = listener.Close() }()
+
+		go func(listener net.Listener, headers http.Header) {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				connChan <- localConn{conn: conn, headers: headers}
+			}
+		}(listener, headers)
 	}
-	defer func() { _ = listener.Close() }()
 
 	fmt.Printf("✓ Proxy server listening on localhost:%d\n", port)
 	fmt.Printf("Connection will expire at: %s\n", expiresAt)
@@ -143,39 +475,25 @@ func startLocalProxy(port int, connectionID, token string, expiresAt string, api
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// Parse expiry time
-	expiry, err := time.Parse(time.RFC3339, expiresAt)
-	if err != nil {
+	var expiry *connectionExpiry
+	if at, err := time.Parse(time.RFC3339, expiresAt); err != nil {
 		fmt.Printf("Warning: could not parse expiry time: %v\n", err)
 	} else {
-		// Start timeout monitor
-		go func() {
-			timeUntilExpiry := time.Until(expiry)
-			if timeUntilExpiry > 0 {
-				<-time.After(timeUntilExpiry)
-				fmt.Printf("\n⏱  Connection timeout reached at %s\n", expiresAt)
-				fmt.Println("Server has disconnected the connection.")
-				fmt.Println("Run 'connect' again to establish a new connection.")
-				os.Exit(0)
-			}
-		}()
+		// Start timeout monitor, following extensions
+		expiry = newConnectionExpiry(at)
+		go monitorExpiry(connectionID, apiURL, session, expiry)
 	}
 
-	// Accept connections in goroutine
-	connChan := make(chan net.Conn)
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				return
-			}
-			connChan <- conn
-		}
-	}()
-
 	// Main loop
-	// Create closure to capture apiURL
-	handleConnection := func(conn net.Conn) {
-		handleLocalConnection(conn, connectionID, token, apiURL)
+	handleConnection := func(local localConn) {
+		handleLocalConnection(local.conn, tunnelTarget{
+			connectionID: connectionID,
+			connType:     connType,
+			apiURL:       apiURL,
+			session:      session,
+			expiry:       expiry,
+			headers:      local.headers,
+		})
 	}
 
 	for {
@@ -189,116 +507,287 @@ func startLocalProxy(port int, connectionID, token string, expiresAt string, api
 	}
 }
 
-func handleLocalConnection(localConn net.Conn, connectionID, token, apiURL string) {
-	defer func() { _ = localConn.Close() }()
+// monitorExpiry exits once the connection expires. With --prompt-extend it offers
+// to extend the connection extendPromptLead before each expiry.
+func monitorExpiry(connectionID, apiURL string, session *sessionToken, expiry *connectionExpiry) {
+	var prompted time.Time // Expiry the user was already asked about
+	for {
+		at := expiry.Get()
+		changed := expiry.Changed()
 
-	// Convert HTTP URL to WebSocket URL
-	wsURL := strings.Replace(apiURL, "http://", "ws://", 1)
-	wsURL = strings.Replace(wsURL, "https://", "wss://", 1)
-	wsURL = fmt.Sprintf("%s/api/proxy/%s", wsURL, connectionID)
+		var prompt <-chan time.Time
+		if promptExtend && !prompted.Equal(at) {
+			prompt = time.After(time.Until(at.Add(-extendPromptLead)))
+		}
 
-	// Parse URL and add auth header
-	u, err := url.Parse(wsURL)
-	if err != nil {
-		fmt.Printf("Error parsing WebSocket URL: %v\n", err)
-		return
+		select {
+		case <-changed:
+		case <-prompt:
+			// Answered in the background so the connection still ends on time
+			prompted = at
+			go promptExtension(connectionID, apiURL, session, expiry)
+		case <-time.After(time.Until(at)):
+			fmt.Printf("\n⏱  Connection timeout reached at %s\n", at.Format(time.RFC3339))
+			fmt.Println("Server has disconnected the connection.")
+			fmt.Println("Run 'connect' again to establish a new connection.")
+			os.Exit(0)
+		}
 	}
+}
 
-	// Create WebSocket connection with auth header
-	headers := http.Header{}
-	headers.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	// Establish WebSocket connection to API server
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+// promptExtension asks the user whether to extend the connection and does so
+func promptExtension(connectionID, apiURL string, session *sessionToken, expiry *connectionExpiry) {
+	fmt.Printf("\n⏱  Connection expires at %s. Extend it? [y/N]: ", expiry.Get().Format(time.RFC3339))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") && !strings.EqualFold(strings.TrimSpace(answer), "yes") {
+		return
 	}
 
-	wsConn, resp, err := dialer.Dial(u.String(), headers)
+	extended, err := requestExtension(apiURL, session.Get(), connectionID, "", "")
 	if err != nil {
-		if resp != nil {
-			fmt.Printf("Error connecting to API (HTTP %d): %v\n", resp.StatusCode, err)
-		} else {
-			fmt.Printf("Error connecting to API: %v\n", err)
-		}
+		fmt.Printf("⚠️  %v\n", err)
 		return
 	}
-	defer func() { _ = wsConn.Close() }()
+	if expiry.Extend(extended.ExpiresAt) {
+		fmt.Printf("✓ Connection extended until %s\n", extended.ExpiresAt.Format(time.RFC3339))
+	}
+}
 
-	// Setup ping/pong to keep connection alive (prevent ALB timeout)
-	_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	wsConn.SetPongHandler(func(string) error {
-		_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
+// handleLocalConnection tunnels one local connection to the server. With --reconnect,
+// a tunnel lost to a network failure is re-established until the connection expires;
+// data the failed tunnel had accepted but not delivered is lost.
+func handleLocalConnection(localConn net.Conn, target tunnelTarget) {
+	defer func() { _ = localConn.Close() }()
+
+	wsConn, err := dialTunnel(target)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
 
-	// Start ping sender (every 30 seconds)
-	done := make(chan error, 3)
+	// Local data is read in the background so it outlives a lost tunnel
+	stop := make(chan struct{})
+	defer close(stop)
+	localData := make(chan []byte)
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
+		defer close(localData)
 		for {
-			select {
-			case <-ticker.C:
-				if err := wsConn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					done <- err
+			buf := make([]byte, 32768) // 32KB buffer
+			n, err := localConn.Read(buf)
+			if n > 0 {
+				select {
+				case localData <- buf[:n]:
+				case <-stop:
 					return
 				}
-			case <-done:
+			}
+			if err != nil {
+				select {
+				case <-stop: // Closed by us when the tunnel ended
+				default:
+					if err != io.EOF {
+						fmt.Printf("Connection error: local read error: %v\n", err)
+					}
+				}
 				return
 			}
 		}
 	}()
 
-	// Forward data from local connection to WebSocket (Local App → API → Backend)
-	go func() {
-		for {
-			buf := make([]byte, 32768) // 32KB buffer
-			n, err := localConn.Read(buf)
+	var unsent []byte
+	for {
+		unsent, err = forwardTunnel(localConn, wsConn, localData, unsent, target.expiry)
+		_ = wsConn.Close()
+
+		var lost *tunnelLostError
+		if !errors.As(err, &lost) || !autoReconnect {
 			if err != nil {
-				if err != io.EOF {
-					done <- fmt.Errorf("local read error: %w", err)
-				}
-				done <- nil
-				return
+				fmt.Printf("Connection error: %v\n", err)
 			}
+			return
+		}
+		if !resumableProtocol(target.connType) {
+			// The server starts a new backend session per tunnel; the client must reconnect
+			// (psql does so automatically) and its new tunnel is retried until expiry
+			fmt.Printf("\n⚠️  Tunnel lost (%v); reconnect your client to continue\n", lost.err)
+			return
+		}
 
-			// Send binary data over WebSocket
-			if err := wsConn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-				done <- fmt.Errorf("websocket write error: %w", err)
-				return
+		fmt.Printf("\n⚠️  Tunnel lost (%v); reconnecting...\n", lost.err)
+		if wsConn, err = dialTunnel(target); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		fmt.Println("✓ Tunnel re-established")
+	}
+}
+
+// dialTunnel opens a tunnel to the server and completes the banner handshake.
+// With --reconnect, network failures and server errors are retried with capped
+// backoff until the connection expires; refusals (expired, forbidden) are not.
+func dialTunnel(target tunnelTarget) (*websocket.Conn, error) {
+	// Convert HTTP URL to WebSocket URL
+	wsURL := strings.Replace(target.apiURL, "http://", "ws://", 1)
+	wsURL = strings.Replace(wsURL, "https://", "wss://", 1)
+	wsURL = fmt.Sprintf("%s/api/proxy/%s", wsURL, target.connectionID)
+
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing WebSocket URL: %w", err)
+	}
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  10 * time.Second,
+		EnableCompression: compressTunnel, // Used only if the server agrees (server.websocket_compression)
+	}
+
+	delay := reconnectInitialDelay
+	for attempt := 1; ; attempt++ {
+		// The token is read on every attempt, so retries use a renewed one
+		wsConn, resp, err := dialer.Dial(u.String(), tunnelHeaders(target))
+		if err == nil {
+			// Answer the server's banner acknowledgement request before forwarding anything
+			if bannerAccepted {
+				if err := acknowledgeBanner(wsConn); err != nil {
+					_ = wsConn.Close()
+					return nil, fmt.Errorf("banner acknowledgement failed: %w", err)
+				}
 			}
+			return wsConn, nil
 		}
-	}()
+
+		if resp != nil {
+			err = fmt.Errorf("error connecting to API (HTTP %d): %w", resp.StatusCode, err)
+		} else {
+			err = fmt.Errorf("error connecting to API: %w", err)
+		}
+		retryable := resp == nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		if !autoReconnect || !retryable {
+			return nil, err
+		}
+		if expiry := target.expiry.Get(); !expiry.IsZero() && time.Now().Add(delay).After(expiry) {
+			return nil, fmt.Errorf("%w; giving up, the connection expires at %s", err, expiry.Format(time.RFC3339))
+		}
+
+		fmt.Printf("↻ Reconnect attempt %d failed (%v); retrying in %s\n", attempt, err, delay)
+		time.Sleep(delay)
+		delay = nextReconnectDelay(delay)
+	}
+}
+
+// tunnelHeaders builds the headers of a tunnel request
+func tunnelHeaders(target tunnelTarget) http.Header {
+	headers := http.Header{}
+	headers.Add("Authorization", fmt.Sprintf("Bearer %s", target.session.Get()))
+	if explainPreview {
+		headers.Add("X-Query-Preview", "explain")
+	}
+	if traceParent != "" {
+		headers.Add("traceparent", traceParent)
+	}
+	for name, values := range target.headers {
+		headers[name] = values
+	}
+	return headers
+}
+
+// forwardTunnel pipes data between the local connection and one tunnel until either
+// side ends. pending is local data a previous tunnel failed to send. A tunnel that
+// fails (rather than being closed by the server) returns a *tunnelLostError along
+// with the local data it could not send. Extensions the server announces move expiry.
+func forwardTunnel(localConn net.Conn, wsConn *websocket.Conn, localData <-chan []byte, pending []byte, expiry *connectionExpiry) ([]byte, error) {
+	// Setup ping/pong to keep connection alive (prevent ALB timeout)
+	_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	wsConn.SetPongHandler(func(string) error {
+		_ = wsConn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
 
 	// Forward data from WebSocket to local connection (Backend → API → Local App)
+	readDone := make(chan error, 1)
 	go func() {
 		for {
 			messageType, data, err := wsConn.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-					done <- fmt.Errorf("websocket read error: %w", err)
-				}
-				done <- nil
+				readDone <- tunnelReadError(err)
 				return
 			}
 
-			// Only process binary messages (skip ping/pong/text)
-			if messageType == websocket.BinaryMessage {
+			// Binary messages carry tunnel data; text messages are server notices
+			// (e.g. the expiry warning) meant for the user, not the local app
+			switch messageType {
+			case websocket.BinaryMessage:
 				if _, err := localConn.Write(data); err != nil {
-					done <- fmt.Errorf("local write error: %w", err)
+					readDone <- fmt.Errorf("local write error: %w", err)
 					return
 				}
+			case websocket.TextMessage:
+				var notice tunnelNotice
+				if json.Unmarshal(data, &notice) == nil && notice.Type == "connection_extended" {
+					if expiry.Extend(notice.ExpiresAt) {
+						fmt.Printf("\n✓ Connection extended until %s\n", notice.ExpiresAt.Format(time.RFC3339))
+					}
+					continue
+				}
+				fmt.Printf("\n⚠️  %s\n", data)
 			}
 		}
 	}()
 
-	// Wait for any goroutine to finish or error
-	err = <-done
-	if err != nil && err != io.EOF {
-		fmt.Printf("Connection error: %v\n", err)
+	// Wait for the reader to stop before the local connection is handed to another tunnel
+	finish := func(unsent []byte, err error) ([]byte, error) {
+		_ = wsConn.Close()
+		<-readDone
+		return unsent, err
+	}
+
+	if pending != nil {
+		if err := wsConn.WriteMessage(websocket.BinaryMessage, pending); err != nil {
+			return finish(pending, &tunnelLostError{err: fmt.Errorf("websocket write error: %w", err)})
+		}
+	}
+
+	// Ping every 30 seconds; forward data from local connection to WebSocket (Local App → API → Backend)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := wsConn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return finish(nil, &tunnelLostError{err: fmt.Errorf("websocket ping error: %w", err)})
+			}
+		case data, ok := <-localData:
+			if !ok {
+				return finish(nil, nil)
+			}
+			if err := wsConn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return finish(data, &tunnelLostError{err: fmt.Errorf("websocket write error: %w", err)})
+			}
+		case err := <-readDone:
+			readDone <- err
+			return finish(nil, err)
+		}
 	}
 }
 
+// acknowledgeBanner completes the banner handshake on a new tunnel, echoing the
+// server's token to record the consent the user gave at connect time
+func acknowledgeBanner(wsConn *websocket.Conn) error {
+	_ = wsConn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	messageType, data, err := wsConn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("no banner from server: %w", err)
+	}
+
+	var request bannerMessage
+	if messageType != websocket.TextMessage || json.Unmarshal(data, &request) != nil || request.Type != "banner_ack_request" {
+		return fmt.Errorf("unexpected message from server")
+	}
+
+	ack, _ := json.Marshal(bannerMessage{Type: "banner_ack", Token: request.Token})
+	return wsConn.WriteMessage(websocket.TextMessage, ack)
+}
+
 // validateToken checks if JWT token is still valid
 func validateToken(token string) error {
 	// Split JWT token (format: header.payload.signature)
@@ -334,23 +823,40 @@ func validateToken(token string) error {
 	return nil
 }
 
-// getUsernameFromToken extracts the username from a JWT token
-func getUsernameFromToken(token string) (string, error) {
+// tokenClaims are the identity claims carried by an API token
+type tokenClaims struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	Email    string   `json:"email"`
+	Exp      int64    `json:"exp"`
+	Iat      int64    `json:"iat"`
+}
+
+// decodeTokenClaims decodes the payload of a JWT token without verifying its signature
+func decodeTokenClaims(token string) (*tokenClaims, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
-		return "", fmt.Errorf("invalid token format")
+		return nil, fmt.Errorf("invalid token format")
 	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return "", fmt.Errorf("failed to decode token: %w", err)
+		return nil, fmt.Errorf("failed to decode token: %w", err)
 	}
 
-	var claims struct {
-		Username string `json:"username"`
-	}
+	var claims tokenClaims
 	if err := json.Unmarshal(payload, &claims); err != nil {
-		return "", fmt.Errorf("failed to parse token claims: %w", err)
+		return nil, fmt.Errorf("failed to parse token claims: %w", err)
+	}
+
+	return &claims, nil
+}
+
+// getUsernameFromToken extracts the username from a JWT token
+func getUsernameFromToken(token string) (string, error) {
+	claims, err := decodeTokenClaims(token)
+	if err != nil {
+		return "", err
 	}
 
 	return claims.Username, nil
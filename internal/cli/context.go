@@ -2,7 +2,6 @@ package cli
 
 import (
 	"fmt"
-	"os"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -11,7 +10,9 @@ import (
 var contextCmd = &cobra.Command{
 	Use:   "context",
 	Short: "Manage API server contexts",
-	Long:  "Manage multiple API server contexts (similar to kubectl contexts)",
+	Long: `Manage multiple API server contexts (similar to kubectl contexts).
+Each context stores its own API URL and token; login, list, connect and approvals use the current one.
+Create a context by logging in to it: login --context prod --api-url https://pa.example.com`,
 }
 
 var contextListCmd = &cobra.Command{
@@ -61,17 +62,14 @@ func runContextList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	out := cmd.OutOrStdout()
 	if len(cfg.Contexts) == 0 {
-		fmt.Println("No contexts configured. Run 'login' to create one.")
+		_, _ = fmt.Fprintln(out, "No contexts configured. Run 'login' to create one.")
 		return nil
 	}
 
-	fmt.Println("\nAvailable Contexts:")
-	fmt.Println("===================")
-
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
 	_, _ = fmt.Fprintln(w, "CURRENT\tNAME\tAPI URL\tAUTHENTICATED")
-	_, _ = fmt.Fprintln(w, "-------\t----\t-------\t-------------")
 
 	for _, ctx := range cfg.Contexts {
 		current := " "
@@ -87,10 +85,7 @@ func runContextList(cmd *cobra.Command, args []string) error {
 		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, ctx.Name, ctx.APIURL, authenticated)
 	}
 
-	_ = w.Flush()
-	fmt.Println()
-
-	return nil
+	return w.Flush()
 }
 
 func runContextCurrent(cmd *cobra.Command, args []string) error {
@@ -99,12 +94,13 @@ func runContextCurrent(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("Current context: %s\n", ctx.Name)
-	fmt.Printf("API URL: %s\n", ctx.APIURL)
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "Current context: %s\n", ctx.Name)
+	_, _ = fmt.Fprintf(out, "API URL: %s\n", ctx.APIURL)
 	if ctx.Token != "" {
-		fmt.Println("Status: Authenticated")
+		_, _ = fmt.Fprintln(out, "Status: Authenticated")
 	} else {
-		fmt.Println("Status: Not authenticated (run 'login')")
+		_, _ = fmt.Fprintln(out, "Status: Not authenticated (run 'login')")
 	}
 
 	return nil
@@ -117,7 +113,11 @@ func runContextUse(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("✓ Switched to context '%s'\n", contextName)
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "✓ Switched to context '%s'\n", contextName)
+	if ctx, err := GetContext(contextName); err == nil && ctx.Token == "" {
+		_, _ = fmt.Fprintf(out, "  Not authenticated; run 'login' to sign in to %s\n", ctx.APIURL)
+	}
 	return nil
 }
 
@@ -128,7 +128,7 @@ func runContextDelete(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("✓ Deleted context '%s'\n", contextName)
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✓ Deleted context '%s'\n", contextName)
 	return nil
 }
 
@@ -140,7 +140,7 @@ func runContextRename(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("✓ Renamed context '%s' to '%s'\n", oldName, newName)
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✓ Renamed context '%s' to '%s'\n", oldName, newName)
 	return nil
 }
 
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var extendCmd = &cobra.Command{
+	Use:   "extend <connection-id>",
+	Short: "Extend a live connection",
+	Long:  "Push out the expiry of a connection opened with 'connect', up to the maximum duration your policy allows. Connections that require approval wait for a fresh approval.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runExtend,
+}
+
+var (
+	extendDuration string
+	extendReason   string
+)
+
+func init() {
+	extendCmd.Flags().StringVar(&extendDuration, "duration", "", "How much time to add (e.g. 30m); defaults to the connection's duration")
+	extendCmd.Flags().StringVar(&extendReason, "reason", "", "Why you need more time (shown to approvers)")
+}
+
+type extendResponse struct {
+	ConnectionID      string    `json:"connection_id"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	MaxExpiresAt      time.Time `json:"max_expires_at"`
+}
+
+// requestExtension asks the API to extend a connection by duration ("" for the
+// connection's own duration)
+func requestExtension(apiURL, token, connectionID, duration, reason string) (*extendResponse, error) {
+	fields := map[string]string{}
+	if duration != "" {
+		fields["duration"] = duration
+	}
+	if reason != "" {
+		fields["reason"] = reason
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/connect/%s/extend", apiURL, url.PathEscape(connectionID)), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("extension failed: %w", parseAPIError(body))
+	}
+
+	var extended extendResponse
+	if err := json.Unmarshal(body, &extended); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &extended, nil
+}
+
+func runExtend(cmd *cobra.Command, args []string) error {
+	ctx, err := GetCurrentContext()
+	if err != nil {
+		return fmt.Errorf("not logged in: %w. Please run 'login' first", err)
+	}
+
+	apiURL := ctx.APIURL
+	if cmd.Root().PersistentFlags().Changed("api-url") {
+		apiURL, _ = cmd.Root().PersistentFlags().GetString("api-url")
+	}
+
+	extended, err := requestExtension(apiURL, ctx.Token, args[0], extendDuration, extendReason)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "✓ Connection %s extended\n", extended.ConnectionID)
+	_, _ = fmt.Fprintf(out, "  Expires at: %s (was %s)\n", extended.ExpiresAt.Format(time.RFC3339), extended.PreviousExpiresAt.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(out, "  Can be extended until: %s\n", extended.MaxExpiresAt.Format(time.RFC3339))
+	return nil
+}
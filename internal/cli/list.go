@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -16,10 +18,20 @@ var listCmd = &cobra.Command{
 	RunE:  runList,
 }
 
+// listOutput selects the list output format: text or json
+var listOutput string
+
+func init() {
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "text", "Output format: text or json")
+}
+
 type connectionInfo struct {
-	Name     string            `json:"name"`
-	Type     string            `json:"type"`
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	MaxDuration string            `json:"max_duration,omitempty"` // How long a connection would last for you
 }
 
 func runList(cmd *cobra.Command, args []string) error {
@@ -29,6 +41,10 @@ func runList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("not logged in: %w. Please run 'login' first", err)
 	}
 
+	if listOutput != "" && listOutput != "text" && listOutput != "json" {
+		return fmt.Errorf("unsupported output format %q (text or json)", listOutput)
+	}
+
 	apiURL := ctx.APIURL
 	token := ctx.Token
 
@@ -59,7 +75,7 @@ func runList(cmd *cobra.Command, args []string) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("request failed: %s", string(body))
+		return fmt.Errorf("request failed: %w", parseAPIError(body))
 	}
 
 	// Parse response
@@ -68,18 +84,41 @@ func runList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	out := cmd.OutOrStdout()
+	if listOutput == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(connections)
+	}
+
 	// Display connections
-	fmt.Println("\nAvailable Connections:")
-	fmt.Println("----------------------")
+	_, _ = fmt.Fprintln(out, "\nAvailable Connections:")
+	_, _ = fmt.Fprintln(out, "----------------------")
 	for _, conn := range connections {
-		fmt.Printf("  • %s [%s]\n", conn.Name, conn.Type)
-		if len(conn.Metadata) > 0 {
-			for key, value := range conn.Metadata {
-				fmt.Printf("    %s: %s\n", key, value)
+		if conn.Description != "" {
+			_, _ = fmt.Fprintf(out, "  • %s [%s] - %s\n", conn.Name, conn.Type, conn.Description)
+		} else {
+			_, _ = fmt.Fprintf(out, "  • %s [%s]\n", conn.Name, conn.Type)
+		}
+		if len(conn.Tags) > 0 {
+			_, _ = fmt.Fprintf(out, "    tags: %s\n", strings.Join(conn.Tags, ", "))
+		}
+		if conn.MaxDuration != "" {
+			_, _ = fmt.Fprintf(out, "    max duration: %s\n", conn.MaxDuration)
+		}
+
+		keys := make([]string, 0, len(conn.Metadata))
+		for key := range conn.Metadata {
+			if key != "description" {
+				keys = append(keys, key)
 			}
 		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			_, _ = fmt.Fprintf(out, "    %s: %s\n", key, conn.Metadata[key])
+		}
 	}
-	fmt.Println()
+	_, _ = fmt.Fprintln(out)
 
 	return nil
 }
@@ -44,6 +44,8 @@ type loginResponse struct {
 		Email    string   `json:"email"`
 		Roles    []string `json:"roles"`
 	} `json:"user"`
+	// Error is sent instead of a token when the server rejects a browser (OIDC) login
+	Error string `json:"error,omitempty"`
 }
 
 func runLogin(cmd *cobra.Command, args []string) error {
@@ -57,16 +59,16 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Get API URL from parent command flags
+	// An explicit --api-url wins; otherwise re-use the context's own API URL
 	apiURL, _ := cmd.Root().PersistentFlags().GetString("api-url")
-	if apiURL == "" {
-		// Try to get from existing context
+	if !cmd.Root().PersistentFlags().Changed("api-url") {
 		if ctx, err := GetContext(contextName); err == nil && ctx.APIURL != "" {
 			apiURL = ctx.APIURL
-		} else {
-			apiURL = "http://localhost:8080"
 		}
 	}
+	if apiURL == "" {
+		apiURL = "http://localhost:8080"
+	}
 
 	// Determine authentication method
 	if loginProvider == "oidc" {
@@ -110,7 +112,7 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("login failed: %s", string(body))
+		return fmt.Errorf("login failed: %w", parseAPIError(body))
 	}
 
 	// Parse response
@@ -43,7 +43,7 @@ func fetchServerInfo(apiURL string) (*serverInfo, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned error: %s", string(body))
+		return nil, fmt.Errorf("server returned error: %w", parseAPIError(body))
 	}
 
 	var info serverInfo
@@ -108,6 +108,9 @@ func runOIDCLogin(apiURL, contextName string) error {
 	if err := ws.ReadJSON(&loginResp); err != nil {
 		return fmt.Errorf("failed to receive authentication response: %w", err)
 	}
+	if loginResp.Error != "" {
+		return fmt.Errorf("authentication failed: %s", loginResp.Error)
+	}
 
 	// Save token and context
 	ctx := Context{
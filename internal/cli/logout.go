@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove saved credentials",
+	Long: `Remove the saved token for the current context, a named context (--context), or all contexts (--all).
+Contexts and their API URLs are kept; use 'context delete' to remove a context entirely.`,
+	Args: cobra.NoArgs,
+	RunE: runLogout,
+}
+
+var (
+	logoutContext string
+	logoutAll     bool
+)
+
+func init() {
+	logoutCmd.Flags().StringVarP(&logoutContext, "context", "c", "", "Context to log out of (default: current context)")
+	logoutCmd.Flags().BoolVar(&logoutAll, "all", false, "Log out of all contexts")
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	if logoutAll && logoutContext != "" {
+		return fmt.Errorf("--context and --all cannot be used together")
+	}
+
+	var names []string
+	if !logoutAll {
+		name := logoutContext
+		if name == "" {
+			ctx, err := GetCurrentContext()
+			if err != nil {
+				fmt.Println("Not logged in")
+				return nil
+			}
+			name = ctx.Name
+		}
+		names = []string{name}
+	}
+
+	cleared, err := ClearTokens(names...)
+	if err != nil {
+		return fmt.Errorf("failed to clear credentials: %w", err)
+	}
+
+	if len(cleared) == 0 {
+		if logoutAll {
+			fmt.Println("Not logged in to any context")
+		} else {
+			fmt.Printf("Not logged in to context '%s'\n", names[0])
+		}
+		return nil
+	}
+
+	for _, name := range cleared {
+		fmt.Printf("✓ Logged out of context '%s'\n", name)
+	}
+	return nil
+}
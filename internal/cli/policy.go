@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy <connection-name>",
+	Short: "Show what you are allowed to do on a connection",
+	Long:  "Display your effective whitelist, blacklist and restrictions on a connection, as granted by your roles",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runPolicy,
+}
+
+// policyOutput selects the policy output format: text or json
+var policyOutput string
+
+func init() {
+	policyCmd.Flags().StringVarP(&policyOutput, "output", "o", "text", "Output format: text or json")
+}
+
+type tablePermission struct {
+	Operations []string `json:"operations"`
+	Tables     []string `json:"tables"`
+}
+
+type connectionPolicy struct {
+	Connection       string            `json:"connection"`
+	Type             string            `json:"type"`
+	Whitelist        []string          `json:"whitelist"`
+	Blacklist        []string          `json:"blacklist,omitempty"`
+	TablePermissions []tablePermission `json:"table_permissions,omitempty"`
+	CopyDirections   []string          `json:"copy_directions,omitempty"`
+	ReadOnly         bool              `json:"read_only,omitempty"`
+	RequireReason    bool              `json:"require_reason,omitempty"`
+	MaxDuration      string            `json:"max_duration,omitempty"`
+}
+
+func runPolicy(cmd *cobra.Command, args []string) error {
+	connectionName := args[0]
+
+	ctx, err := GetCurrentContext()
+	if err != nil {
+		return fmt.Errorf("not logged in: %w. Please run 'login' first", err)
+	}
+
+	if policyOutput != "" && policyOutput != "text" && policyOutput != "json" {
+		return fmt.Errorf("unsupported output format %q (text or json)", policyOutput)
+	}
+
+	apiURL := ctx.APIURL
+	if cmd.Root().PersistentFlags().Changed("api-url") {
+		apiURL, _ = cmd.Root().PersistentFlags().GetString("api-url")
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/connections/%s/policy", apiURL, url.PathEscape(connectionName)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ctx.Token))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed: %w", parseAPIError(body))
+	}
+
+	var policy connectionPolicy
+	if err := json.Unmarshal(body, &policy); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if policyOutput == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(policy)
+	}
+
+	_, _ = fmt.Fprintf(out, "\nYour policy on %s [%s]:\n", policy.Connection, policy.Type)
+	if len(policy.Whitelist) == 0 {
+		_, _ = fmt.Fprintln(out, "  Allowed: anything (no whitelist)")
+	} else {
+		_, _ = fmt.Fprintln(out, "  Allowed (must match one of):")
+		for _, pattern := range policy.Whitelist {
+			_, _ = fmt.Fprintf(out, "    • %s\n", pattern)
+		}
+	}
+	if len(policy.Blacklist) > 0 {
+		_, _ = fmt.Fprintln(out, "  Blocked (even when allowed above):")
+		for _, pattern := range policy.Blacklist {
+			_, _ = fmt.Fprintf(out, "    • %s\n", pattern)
+		}
+	}
+	if len(policy.TablePermissions) > 0 {
+		_, _ = fmt.Fprintln(out, "  Table permissions:")
+		for _, permission := range policy.TablePermissions {
+			_, _ = fmt.Fprintf(out, "    • %s on %s\n", strings.Join(permission.Operations, ", "), strings.Join(permission.Tables, ", "))
+		}
+	}
+	if len(policy.CopyDirections) > 0 {
+		_, _ = fmt.Fprintf(out, "  COPY: %s\n", strings.Join(policy.CopyDirections, ", "))
+	}
+	if policy.ReadOnly {
+		_, _ = fmt.Fprintln(out, "  Read-only: only SELECT and EXPLAIN are forwarded")
+	}
+	if policy.RequireReason {
+		_, _ = fmt.Fprintln(out, "  A reason is required to connect (--reason)")
+	}
+	if policy.MaxDuration != "" {
+		_, _ = fmt.Fprintf(out, "  Max duration: %s\n", policy.MaxDuration)
+	}
+	_, _ = fmt.Fprintln(out)
+
+	return nil
+}
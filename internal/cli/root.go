@@ -26,9 +26,14 @@ approval workflows, and comprehensive audit logging.`,
 
 	// Add subcommands
 	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(whoamiCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(connectCmd)
+	rootCmd.AddCommand(extendCmd)
+	rootCmd.AddCommand(policyCmd)
 	rootCmd.AddCommand(contextCmd)
+	rootCmd.AddCommand(approvalsCmd)
 }
 
 // Execute runs the root command
@@ -41,6 +46,16 @@ func NewLoginCmd() *cobra.Command {
 	return loginCmd
 }
 
+// NewLogoutCmd returns the logout command
+func NewLogoutCmd() *cobra.Command {
+	return logoutCmd
+}
+
+// NewWhoamiCmd returns the whoami command
+func NewWhoamiCmd() *cobra.Command {
+	return whoamiCmd
+}
+
 // NewListCmd returns the list command
 func NewListCmd() *cobra.Command {
 	return listCmd
@@ -50,3 +65,8 @@ func NewListCmd() *cobra.Command {
 func NewConnectCmd() *cobra.Command {
 	return connectCmd
 }
+
+// NewApprovalsCmd returns the approvals command
+func NewApprovalsCmd() *cobra.Command {
+	return approvalsCmd
+}
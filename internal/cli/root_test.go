@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -33,6 +34,26 @@ func TestNewLoginCmd(t *testing.T) {
 	}
 }
 
+func TestNewLogoutCmd(t *testing.T) {
+	cmd := NewLogoutCmd()
+
+	if cmd == nil {
+		t.Fatal("NewLogoutCmd() returned nil")
+	}
+
+	if cmd.Use != "logout" {
+		t.Errorf("Use = %s, want 'logout'", cmd.Use)
+	}
+
+	if cmd.Flags().Lookup("context") == nil {
+		t.Error("context flag should be defined")
+	}
+
+	if cmd.Flags().Lookup("all") == nil {
+		t.Error("all flag should be defined")
+	}
+}
+
 func TestNewListCmd(t *testing.T) {
 	cmd := NewListCmd()
 
@@ -69,6 +90,24 @@ func TestNewConnectCmd(t *testing.T) {
 	if cmd.Flags().Lookup("local-port") == nil {
 		t.Error("local-port flag should be defined")
 	}
+	if cmd.Flags().Lookup("trace") == nil {
+		t.Error("trace flag should be defined")
+	}
+}
+
+func TestNewTraceParent(t *testing.T) {
+	traceParent, err := newTraceParent()
+	if err != nil {
+		t.Fatalf("newTraceParent() error = %v", err)
+	}
+	if !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(traceParent) {
+		t.Errorf("newTraceParent() = %q, want a W3C traceparent", traceParent)
+	}
+
+	other, _ := newTraceParent()
+	if other == traceParent {
+		t.Error("newTraceParent() returned the same value twice")
+	}
 }
 
 func BenchmarkNewLoginCmd(b *testing.B) {
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenRefreshMargin is how long before expiry a connect session renews its token
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRefreshRetry is how long to wait after a renewal failed for a transient reason
+	tokenRefreshRetry = 30 * time.Second
+)
+
+// errRefreshDenied is returned when the server refuses to renew a token
+// (e.g., the renewal window or the OIDC session ended); retrying will not help.
+var errRefreshDenied = errors.New("token renewal denied")
+
+// sessionToken is the API token of a connect session, renewed shortly before it expires
+// New tunnels authenticate with the current token, so long sessions outlive token_expiry.
+type sessionToken struct {
+	mu      sync.RWMutex
+	token   string
+	apiURL  string
+	context Context // CLI context the renewed token is saved to
+}
+
+func newSessionToken(ctx Context, apiURL string) *sessionToken {
+	return &sessionToken{token: ctx.Token, apiURL: apiURL, context: ctx}
+}
+
+// Get returns the current token
+func (s *sessionToken) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token
+}
+
+// keepFresh renews the token tokenRefreshMargin before it expires until stop is closed
+func (s *sessionToken) keepFresh(stop <-chan struct{}) {
+	retry := false
+	for {
+		claims, err := decodeTokenClaims(s.Get())
+		if err != nil || claims.Exp == 0 {
+			return
+		}
+		expiry := time.Unix(claims.Exp, 0)
+
+		wait := time.Until(expiry.Add(-tokenRefreshMargin))
+		if retry {
+			wait = tokenRefreshRetry
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		if time.Now().After(expiry) {
+			fmt.Println("\n⚠️  Token expired; open tunnels stay up but new ones need 'login' again")
+			return
+		}
+
+		err = s.refresh()
+		switch {
+		case err == nil:
+			retry = false
+		case errors.Is(err, errRefreshDenied):
+			fmt.Printf("\n⚠️  %v\n   Run 'login' again before the token expires at %s\n", err, expiry.Format(time.RFC3339))
+			return
+		default:
+			fmt.Printf("\n⚠️  Token renewal failed, retrying: %v\n", err)
+			retry = true
+		}
+	}
+}
+
+// refresh exchanges the current token for a new one and saves it to the CLI context
+func (s *sessionToken) refresh() error {
+	renewed, err := refreshToken(s.apiURL, s.Get())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.token = renewed.Token
+	s.context.Token = renewed.Token
+	saved := s.context
+	s.mu.Unlock()
+
+	if err := SaveContext(saved, false); err != nil {
+		fmt.Printf("\n⚠️  Renewed token could not be saved: %v\n", err)
+	}
+	return nil
+}
+
+// refreshToken asks the API server for a new token with a fresh expiry
+func refreshToken(apiURL, token string) (*loginResponse, error) {
+	req, err := http.NewRequest("POST", apiURL+"/api/token/refresh", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: %s", errRefreshDenied, parseAPIError(body).Message)
+	default:
+		return nil, fmt.Errorf("token refresh failed (HTTP %d): %s", resp.StatusCode, string(body))
+	}
+
+	var renewed loginResponse
+	if err := json.Unmarshal(body, &renewed); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &renewed, nil
+}
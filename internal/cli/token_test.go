@@ -3,6 +3,9 @@ package cli
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -331,3 +334,74 @@ func BenchmarkGetUsernameFromToken(b *testing.B) {
 		_, _ = getUsernameFromToken(token)
 	}
 }
+
+func TestSessionToken_KeepFresh(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	makeToken := func(username string, expiresIn time.Duration) string {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"username": username,
+			"exp":      time.Now().Add(expiresIn).Unix(),
+		})
+		return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+	}
+
+	expiring := makeToken("alice", time.Minute)
+	renewed := makeToken("alice", time.Hour)
+	denied := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/token/refresh" || r.Header.Get("Authorization") != "Bearer "+expiring {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if denied {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"token can no longer be renewed"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": renewed})
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	oldHome := os.Getenv("HOME")
+	_ = os.Setenv("HOME", tmpDir)
+	defer func() { _ = os.Setenv("HOME", oldHome) }()
+
+	ctx := Context{Name: "test", APIURL: server.URL, Token: expiring}
+	_ = SaveContext(ctx, true)
+
+	// A token within the refresh margin is renewed right away and saved to the context
+	session := newSessionToken(ctx, server.URL)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		session.keepFresh(stop)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for session.Get() != renewed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	if session.Get() != renewed {
+		t.Fatal("token was not renewed")
+	}
+	if saved, err := GetContext("test"); err != nil || saved.Token != renewed {
+		t.Errorf("saved context = %+v, %v; want the renewed token", saved, err)
+	}
+
+	// A refused renewal is final: keepFresh stops and keeps the old token
+	denied = true
+	session = newSessionToken(ctx, server.URL)
+	session.keepFresh(make(chan struct{}))
+	if session.Get() != expiring {
+		t.Error("token changed after a denied renewal")
+	}
+	if _, err := refreshToken(server.URL, expiring); !errors.Is(err, errRefreshDenied) {
+		t.Errorf("refreshToken() error = %v, want errRefreshDenied", err)
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the identity of the current token",
+	Long:  "Decode the current context's token locally and show its username, roles, email, and remaining validity",
+	Args:  cobra.NoArgs,
+	RunE:  runWhoami,
+}
+
+func runWhoami(cmd *cobra.Command, args []string) error {
+	ctx, err := GetCurrentContext()
+	if err != nil {
+		return fmt.Errorf("not logged in: %w", err)
+	}
+	if ctx.Token == "" {
+		return fmt.Errorf("no token found for context '%s'. Please run 'login'", ctx.Name)
+	}
+
+	claims, err := decodeTokenClaims(ctx.Token)
+	if err != nil {
+		return fmt.Errorf("invalid token for context '%s': %w. Please run 'login'", ctx.Name, err)
+	}
+
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "Context:  %s (%s)\n", ctx.Name, ctx.APIURL)
+	_, _ = fmt.Fprintf(out, "Username: %s\n", claims.Username)
+	_, _ = fmt.Fprintf(out, "Roles:    %s\n", formatRoles(claims.Roles))
+	if claims.Email != "" {
+		_, _ = fmt.Fprintf(out, "Email:    %s\n", claims.Email)
+	}
+	_, _ = fmt.Fprintf(out, "Validity: %s\n", formatValidity(claims.Exp, time.Now()))
+
+	return nil
+}
+
+// formatRoles renders a role list for display
+func formatRoles(roles []string) string {
+	if len(roles) == 0 {
+		return "(none)"
+	}
+	return strings.Join(roles, ", ")
+}
+
+// formatValidity describes how long a token remains valid
+func formatValidity(exp int64, now time.Time) string {
+	if exp == 0 {
+		return "no expiration"
+	}
+
+	expiresAt := time.Unix(exp, 0)
+	if !now.Before(expiresAt) {
+		return fmt.Sprintf("EXPIRED at %s. Please run 'login' again", expiresAt.Format(time.RFC3339))
+	}
+
+	remaining := expiresAt.Sub(now).Truncate(time.Second)
+	return fmt.Sprintf("%s remaining (expires %s)", remaining, expiresAt.Format(time.RFC3339))
+}
@@ -18,6 +18,8 @@ type Config struct {
 	Logging     LoggingConfig      `yaml:"logging"`
 	Approval    *ApprovalConfig    `yaml:"approval,omitempty"`
 	Storage     *StorageConfig     `yaml:"storage,omitempty"`
+	// Observability configures OpenTelemetry tracing (tracing is off when omitted)
+	Observability *ObservabilityConfig `yaml:"observability,omitempty"`
 }
 
 // ServerConfig contains server settings
@@ -25,26 +27,88 @@ type ServerConfig struct {
 	Port                  int           `yaml:"port"`
 	MaxConnectionDuration time.Duration `yaml:"max_connection_duration"`
 	BaseURL               string        `yaml:"base_url,omitempty"` // Base URL for callbacks (e.g., for Slack approval buttons)
+	// TrustedProxies lists proxy IPs/CIDRs whose X-Forwarded-For header is trusted for client IP resolution
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+	// RequestTimeout is the default HTTP proxy response time budget for connections without request_timeout (0 = 30s)
+	RequestTimeout time.Duration `yaml:"request_timeout,omitempty"`
+	// IdleTimeout closes connections without traffic for this long, unless they set idle_timeout (0 = off)
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	// WebSocketPingInterval is how often the server pings CLI tunnels to keep them alive (0 = 30s)
+	WebSocketPingInterval time.Duration `yaml:"websocket_ping_interval,omitempty"`
+	// WebSocketCompression negotiates permessage-deflate with CLIs that ask for it (connect --compress),
+	// trading CPU for bandwidth on text-heavy results
+	WebSocketCompression bool `yaml:"websocket_compression,omitempty"`
+	// MaxBytesIn/MaxBytesOut are the per-session byte quotas for connections that don't set their own (0 = unlimited)
+	MaxBytesIn  int64 `yaml:"max_bytes_in,omitempty"`
+	MaxBytesOut int64 `yaml:"max_bytes_out,omitempty"`
+	// MaxRequestBytes caps a single query, command or HTTP request for connections that don't set their own (0 = unlimited)
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty"`
+	// MaxConcurrentConnections caps the active connections per user (0 = unlimited); policies may set a lower cap
+	MaxConcurrentConnections int `yaml:"max_concurrent_connections,omitempty"`
+	// HTTP tunes the API's HTTP server timeouts and limits
+	HTTP HTTPServerConfig `yaml:"http,omitempty"`
+}
+
+// HTTPServerConfig contains the API HTTP server's timeouts and header limit.
+// Hijacked proxy streams don't use these: their deadline is the connection's expiry.
+type HTTPServerConfig struct {
+	ReadTimeout    time.Duration `yaml:"read_timeout,omitempty"`     // Reading a whole request, body included (0 = 15s)
+	WriteTimeout   time.Duration `yaml:"write_timeout,omitempty"`    // Writing a response (0 = 15s)
+	IdleTimeout    time.Duration `yaml:"idle_timeout,omitempty"`     // Keep-alive wait for the next request (0 = 60s)
+	MaxHeaderBytes int           `yaml:"max_header_bytes,omitempty"` // Request header size limit (0 = 1 MiB)
 }
 
 // AuthConfig contains authentication settings
 type AuthConfig struct {
-	JWTSecret   string               `yaml:"jwt_secret"`
+	// JWTSecret signs new tokens (and verifies them). To rotate it without logging
+	// everyone out:
+	//  1. Move the current secret to JWTSecrets and set JWTSecret to the new one.
+	//     New tokens are signed with the new secret; old ones still verify.
+	//  2. Once token_expiry has passed, every token signed with the old secret has
+	//     expired or been refreshed under the new one: remove it from JWTSecrets.
+	JWTSecret string `yaml:"jwt_secret"`
+	// JWTSecrets are additional secrets accepted when verifying tokens, never for signing
+	JWTSecrets []string `yaml:"jwt_secrets,omitempty"`
+	// JWTIssuer and JWTAudience are set as iss and aud on new tokens, and tokens whose iss
+	// or aud differ are rejected, so tokens from another environment sharing the secret
+	// are not accepted. Tokens issued before they were set are rejected too: users log in again.
+	JWTIssuer   string               `yaml:"jwt_issuer,omitempty"`
+	JWTAudience string               `yaml:"jwt_audience,omitempty"`
 	TokenExpiry time.Duration        `yaml:"token_expiry"`
 	Providers   []AuthProviderConfig `yaml:"providers"`
+	// TokenRenewalWindow is how long after login a token can keep being refreshed (0 = 24h)
+	TokenRenewalWindow time.Duration `yaml:"token_renewal_window,omitempty"`
+	// RequireRole rejects logins that resolve to no roles instead of issuing a token that grants nothing
+	RequireRole bool `yaml:"require_role,omitempty"`
+	// Lockout throttles failed password logins per username and per client IP
+	Lockout LockoutConfig `yaml:"lockout,omitempty"`
 	// Legacy: local users (kept for backward compatibility)
 	Users []User `yaml:"users,omitempty"`
 }
 
+// LockoutConfig throttles failed logins: after two free failures each failure doubles the wait
+// before the next attempt (starting at backoff), and max_failures within window lock the username or IP out
+type LockoutConfig struct {
+	Disabled        bool          `yaml:"disabled,omitempty"`         // Turn throttling off
+	MaxFailures     int           `yaml:"max_failures,omitempty"`     // Failures within window that trigger a lockout (0 = 5)
+	Window          time.Duration `yaml:"window,omitempty"`           // How long failures are counted (0 = 15m)
+	LockoutDuration time.Duration `yaml:"lockout_duration,omitempty"` // How long a lockout lasts (0 = 15m)
+	Backoff         time.Duration `yaml:"backoff,omitempty"`          // Wait after the first failure, doubled per failure (0 = 1s)
+	MaxTracked      int           `yaml:"max_tracked,omitempty"`      // Usernames and IPs tracked at once; oldest are evicted (0 = 10000)
+}
+
 // AuthProviderConfig defines an authentication provider
 type AuthProviderConfig struct {
 	Name    string            `yaml:"name"`    // Unique identifier
 	Type    string            `yaml:"type"`    // local, oidc, saml2, ldap
 	Enabled bool              `yaml:"enabled"` // Whether this provider is active
 	Config  map[string]string `yaml:"config"`  // Provider-specific configuration
+	// RoleMappings maps identity provider groups to internal roles (OIDC); unmapped groups are dropped
+	RoleMappings map[string]string `yaml:"role_mappings,omitempty"`
 }
 
-// OIDC Config keys: issuer, client_id, client_secret, redirect_url
+// OIDC Config keys: issuer, client_id, client_secret, redirect_url, roles_claim (name or dotted path,
+// e.g. realm_access.roles), username_claim, default_role (for users with no mapped role)
 // SAML2 Config keys: idp_metadata_url, sp_entity_id, sp_acs_url, sp_cert, sp_key
 // LDAP Config keys: url, bind_dn, bind_password, user_base_dn, user_filter, group_base_dn
 
@@ -58,29 +122,136 @@ type User struct {
 // ConnectionConfig defines an available connection endpoint
 type ConnectionConfig struct {
 	Name     string            `yaml:"name" json:"name"`
-	Type     string            `yaml:"type" json:"type"` // postgres, http, tcp
+	Type     string            `yaml:"type" json:"type"` // postgres, http, https, tcp, grpc, mongodb, ssh, kafka
 	Host     string            `yaml:"host" json:"host"`
 	Port     int               `yaml:"port" json:"port"`
 	Scheme   string            `yaml:"scheme,omitempty" json:"scheme,omitempty"`     // for HTTP: http/https
 	Duration time.Duration     `yaml:"duration,omitempty" json:"duration,omitempty"` // connection timeout duration
 	Tags     []string          `yaml:"tags,omitempty" json:"tags,omitempty"`         // Tags for policy matching (env:prod, team:backend, etc.)
 	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// Backend failover (postgres, tcp, mongodb, ssh, kafka): sessions move on to the next healthy host when one is unreachable
+	Hosts               []string      `yaml:"hosts,omitempty" json:"hosts,omitempty"`                                 // More backends ("host:port"), tried after host:port
+	HostSelection       string        `yaml:"host_selection,omitempty" json:"host_selection,omitempty"`               // failover (default: first healthy host) or round_robin
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty" json:"health_check_interval,omitempty"` // How often failed hosts are probed to bring them back (default 10s)
 	// Backend credentials (for protocols like Postgres where proxy re-authenticates)
 	BackendUsername string `yaml:"backend_username,omitempty" json:"backend_username,omitempty"`
 	BackendPassword string `yaml:"backend_password,omitempty" json:"backend_password,omitempty"`
 	BackendDatabase string `yaml:"backend_database,omitempty" json:"backend_database,omitempty"`
+	// AllowedDatabases (postgres) are the databases a user may pick when connecting, in
+	// addition to backend_database (the default); sessions on any other database are denied
+	AllowedDatabases []string `yaml:"allowed_databases,omitempty" json:"allowed_databases,omitempty"`
+	// Backend TLS (postgres, tcp): dial the backend over TLS, with SNI and verification against Host
+	BackendTLS           bool   `yaml:"backend_tls,omitempty" json:"backend_tls,omitempty"`
+	BackendCACert        string `yaml:"backend_ca_cert,omitempty" json:"backend_ca_cert,omitempty"`                 // PEM CA bundle path (default: system roots)
+	BackendTLSSkipVerify bool   `yaml:"backend_tls_skip_verify,omitempty" json:"backend_tls_skip_verify,omitempty"` // Skip certificate verification (not recommended)
+	BackendClientCert    string `yaml:"backend_client_cert,omitempty" json:"backend_client_cert,omitempty"`         // PEM client certificate path (mutual TLS)
+	BackendClientKey     string `yaml:"backend_client_key,omitempty" json:"backend_client_key,omitempty"`           // PEM client key path (mutual TLS)
+	// SSH (ssh): the proxy terminates client sessions and logs in to the backend as backend_username
+	SSHPrivateKey     string `yaml:"ssh_private_key,omitempty" json:"ssh_private_key,omitempty"`           // PEM private key path for backend login (alternative or addition to backend_password)
+	SSHHostKey        string `yaml:"ssh_host_key,omitempty" json:"ssh_host_key,omitempty"`                 // PEM host key path presented to clients (default: ephemeral key per server process)
+	SSHBackendHostKey string `yaml:"ssh_backend_host_key,omitempty" json:"ssh_backend_host_key,omitempty"` // Expected backend host key ("ssh-ed25519 AAAA..."); unset = accept any, audited
+	// ExplainPreview allows clients to open the connection in EXPLAIN-only preview mode (postgres)
+	ExplainPreview bool `yaml:"explain_preview,omitempty" json:"explain_preview,omitempty"`
+	// Read-only mode (postgres): only SELECT and EXPLAIN are forwarded, regardless of policy
+	ReadOnly      bool     `yaml:"read_only,omitempty" json:"read_only,omitempty"`             // Every session on this connection is read-only
+	ReadOnlyRoles []string `yaml:"read_only_roles,omitempty" json:"read_only_roles,omitempty"` // Sessions of users with any of these roles are read-only
+	ReplicaHost   string   `yaml:"replica_host,omitempty" json:"replica_host,omitempty"`       // Read-only sessions connect here instead of host (optional)
+	ReplicaPort   int      `yaml:"replica_port,omitempty" json:"replica_port,omitempty"`       // Port of replica_host (default: port)
+	// Backend connection pooling (postgres): sessions reuse idle backend connections, reset with DISCARD ALL between users
+	PoolMax         int           `yaml:"pool_max,omitempty" json:"pool_max,omitempty"`                   // Max idle backend connections kept for reuse (0 = no pooling)
+	PoolIdle        time.Duration `yaml:"pool_idle,omitempty" json:"pool_idle,omitempty"`                 // Close pooled connections idle this long (0 = 5m)
+	PoolMaxLifetime time.Duration `yaml:"pool_max_lifetime,omitempty" json:"pool_max_lifetime,omitempty"` // Never reuse a backend connection older than this (0 = 30m)
+	// DetectProtocol (tcp) sniffs each session: Postgres sessions get the Postgres proxy's controls, others are passed through
+	DetectProtocol bool `yaml:"detect_protocol,omitempty" json:"detect_protocol,omitempty"`
+	// ValidateOnConnect checks backend reachability (and auth for postgres) before a connection is returned
+	ValidateOnConnect bool `yaml:"validate_on_connect,omitempty" json:"validate_on_connect,omitempty"`
+	// SessionAlertThreshold notifies operators (via approval providers) when active sessions reach this count (0 = off)
+	SessionAlertThreshold int `yaml:"session_alert_threshold,omitempty" json:"session_alert_threshold,omitempty"`
+	// RequestTimeout bounds the total time an HTTP request waits for the backend response (0 = server default)
+	RequestTimeout time.Duration `yaml:"request_timeout,omitempty" json:"request_timeout,omitempty"`
+	// ForwardedHeaders (http) tells the backend who a request is from: X-Forwarded-For/-Proto/-Host
+	// and X-PA-User, the authenticated username
+	ForwardedHeaders bool `yaml:"forwarded_headers,omitempty" json:"forwarded_headers,omitempty"`
+	// IdleTimeout closes the connection after this long without traffic (0 = server default)
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty" json:"idle_timeout,omitempty"`
+	// MaxBytesIn caps the bytes a session may send to the backend (0 = server default)
+	MaxBytesIn int64 `yaml:"max_bytes_in,omitempty" json:"max_bytes_in,omitempty"`
+	// MaxBytesOut caps the bytes a session may receive from the backend (0 = server default)
+	MaxBytesOut int64 `yaml:"max_bytes_out,omitempty" json:"max_bytes_out,omitempty"`
+	// MaxRequestBytes caps a single query, command or HTTP request the proxy buffers (0 = server default)
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty" json:"max_request_bytes,omitempty"`
+	// Geofence restricts connects by client country (requires security.geoip_database)
+	Geofence *GeofenceConfig `yaml:"geofence,omitempty" json:"geofence,omitempty"`
+	// Banner is shown to users when they connect (e.g., usage policy or legal notice)
+	Banner *BannerConfig `yaml:"banner,omitempty" json:"banner,omitempty"`
+	// RequireApproval holds every connect to this connection until an approver agrees (requires approval providers)
+	RequireApproval bool          `yaml:"require_approval,omitempty" json:"require_approval,omitempty"`
+	ApprovalTimeout time.Duration `yaml:"approval_timeout,omitempty" json:"approval_timeout,omitempty"` // How long a connect waits for approval (default 5m)
 	// Deprecated: use policies instead
 	Whitelist []string `yaml:"whitelist,omitempty" json:"whitelist,omitempty"` // DEPRECATED: regex patterns, use policies instead
 }
 
+// BannerConfig is a notice shown to users on connect, optionally requiring consent
+type BannerConfig struct {
+	Message    string        `yaml:"message" json:"message"`
+	RequireAck bool          `yaml:"require_ack,omitempty" json:"require_ack,omitempty"` // Streams proceed only after the user acknowledges
+	AckTimeout time.Duration `yaml:"ack_timeout,omitempty" json:"ack_timeout,omitempty"` // How long to wait for the acknowledgement (default 60s)
+}
+
+// GeofenceConfig restricts connections by the client's country (ISO 3166-1 alpha-2 codes)
+type GeofenceConfig struct {
+	AllowedCountries []string `yaml:"allowed_countries,omitempty" json:"allowed_countries,omitempty"` // Empty = all countries not blocked
+	BlockedCountries []string `yaml:"blocked_countries,omitempty" json:"blocked_countries,omitempty"` // Takes precedence over allowed
+	AllowUnknown     bool     `yaml:"allow_unknown,omitempty" json:"allow_unknown,omitempty"`         // Allow IPs with no country (e.g., private ranges)
+}
+
 // RolePolicy defines access policies for roles
 type RolePolicy struct {
 	Name      string            `yaml:"name" json:"name"`                               // Policy name
 	Roles     []string          `yaml:"roles" json:"roles"`                             // Which roles this policy applies to
-	Tags      []string          `yaml:"tags" json:"tags"`                               // Connection tags this policy applies to (e.g., "env:dev", "team:backend")
+	Tags      []string          `yaml:"tags" json:"tags"`                               // Tag expressions this policy applies to (e.g., "env:dev", "team=backend", "env in [dev,staging]", "!env:prod")
 	TagMatch  string            `yaml:"tag_match,omitempty" json:"tag_match,omitempty"` // "all" (default) or "any"
 	Whitelist []string          `yaml:"whitelist,omitempty" json:"whitelist,omitempty"` // Allowed patterns for matched connections
 	Metadata  map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`   // Additional metadata
+
+	// Blacklist patterns deny matching requests even when the whitelist allows them (e.g., DROP, TRUNCATE, GRANT)
+	Blacklist []string `yaml:"blacklist,omitempty" json:"blacklist,omitempty"`
+
+	// TimeWhitelists are patterns allowed only during specific time windows (e.g., writes during business hours)
+	TimeWhitelists []TimeWindowWhitelist `yaml:"time_whitelists,omitempty" json:"time_whitelists,omitempty"`
+
+	// MaxDuration caps connections granted through this policy (0 = no cap); the tightest matching policy wins
+	MaxDuration time.Duration `yaml:"max_duration,omitempty" json:"max_duration,omitempty"`
+
+	// MaxConcurrentConnections caps the active connections of a user connecting through this policy,
+	// counted across all connections (0 = no cap); the tightest matching policy wins
+	MaxConcurrentConnections int `yaml:"max_concurrent_connections,omitempty" json:"max_concurrent_connections,omitempty"`
+
+	// SourceCIDRs restricts this policy to clients connecting from these networks (IPs or CIDRs; empty = anywhere)
+	SourceCIDRs []string `yaml:"source_cidrs,omitempty" json:"source_cidrs,omitempty"`
+
+	// WhitelistMode is "any" (default: a request must match one pattern) or "all" (it must match every pattern)
+	WhitelistMode string `yaml:"whitelist_mode,omitempty" json:"whitelist_mode,omitempty"`
+
+	// Schedule limits when this policy grants access (e.g., business hours); nil = always
+	Schedule *Schedule `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+
+	// TablePermissions restrict Postgres queries to operations on specific tables (e.g., SELECT on users, orders)
+	TablePermissions []TablePermission `yaml:"table_permissions,omitempty" json:"table_permissions,omitempty"`
+
+	// RequireReason makes users state why they are connecting; the reason is audited and shown to approvers
+	RequireReason bool `yaml:"require_reason,omitempty" json:"require_reason,omitempty"`
+
+	// Copy lists the Postgres COPY directions this policy allows ("from" loads data, "to" exports it);
+	// COPY statements are blocked unless a matching policy allows their direction
+	Copy []string `yaml:"copy,omitempty" json:"copy,omitempty"`
+}
+
+// TablePermission allows SQL operations on a set of tables
+// Tables may be schema-qualified ("billing.invoices"), a whole schema ("billing.*") or "*".
+type TablePermission struct {
+	Operations []string `yaml:"operations" json:"operations"` // SELECT, INSERT, UPDATE, DELETE, TRUNCATE, CREATE, DROP, ALTER or "*"
+	Tables     []string `yaml:"tables" json:"tables"`
 }
 
 // SecurityConfig contains security settings
@@ -88,13 +259,44 @@ type SecurityConfig struct {
 	EnableLLMAnalysis bool   `yaml:"enable_llm_analysis"`
 	LLMProvider       string `yaml:"llm_provider,omitempty"`
 	LLMAPIKey         string `yaml:"llm_api_key,omitempty"`
+	GeoIPDatabase     string `yaml:"geoip_database,omitempty"` // Path to a MaxMind GeoIP2/GeoLite2 Country database (.mmdb)
+	// AuditRedactions mask secrets in audited commands and queries, on top of the
+	// built-in masking of AUTH arguments and passwords
+	AuditRedactions []AuditRedaction `yaml:"audit_redactions,omitempty"`
+	// BlockMultiStatement rejects stacked statements ("SELECT 1; DROP TABLE t") and
+	// operations the whitelist's leading keywords don't cover on Postgres connections
+	// guarded by whitelist patterns alone (no table_permissions). Default true.
+	BlockMultiStatement *bool `yaml:"block_multi_statement,omitempty"`
+}
+
+// AuditRedaction masks every match of Pattern in the query/command fields of audit entries
+type AuditRedaction struct {
+	Pattern     string   `yaml:"pattern"`               // Regular expression (case-sensitive; prefix (?i) to ignore case)
+	Replacement string   `yaml:"replacement,omitempty"` // Default "********"; may reference groups, e.g. "$1 ********"
+	Connections []string `yaml:"connections,omitempty"` // Connections the rule applies to (empty = all)
 }
 
 // LoggingConfig contains logging settings
 type LoggingConfig struct {
 	AuditLogPath  string `yaml:"audit_log_path"`
-	LogLevel      string `yaml:"log_level"`
+	LogLevel      string `yaml:"log_level"`                 // Server log level: debug, info, warn, error (audit logging is unaffected)
+	LogFormat     string `yaml:"log_format,omitempty"`      // Server log format: text (default) or json
 	AuditMemoryMB int    `yaml:"audit_memory_mb,omitempty"` // Max memory for in-memory audit buffer (0 to disable, default 1MB)
+	// File rotation (only applies when audit_log_path is a file)
+	AuditMaxMB      int  `yaml:"audit_max_mb,omitempty"`      // Rotate when the audit log exceeds this size (0 to disable)
+	AuditMaxBackups int  `yaml:"audit_max_backups,omitempty"` // Number of rotated files to keep (audit.log.1, .2, ...)
+	AuditCompress   bool `yaml:"audit_compress,omitempty"`    // Gzip rotated files
+	// Authorization decision log (compliance), kept separate from the operational audit log
+	DecisionLogPath          string `yaml:"decision_log_path,omitempty"`           // Append-only JSON lines file (empty to disable)
+	DecisionLogRetentionDays int    `yaml:"decision_log_retention_days,omitempty"` // Delete daily rotated files older than this (0 keeps forever)
+}
+
+// ObservabilityConfig configures OpenTelemetry trace export over OTLP/HTTP
+// Changes take effect on restart.
+type ObservabilityConfig struct {
+	OTLPEndpoint string  `yaml:"otlp_endpoint,omitempty"` // Collector URL, e.g. http://otel-collector:4318 (empty disables tracing)
+	SampleRate   float64 `yaml:"sample_rate,omitempty"`   // Fraction of new traces to sample, 0-1 (0 = 1.0); incoming traceparent decisions are honored
+	ServiceName  string  `yaml:"service_name,omitempty"`  // service.name resource attribute (default: port-authorizing)
 }
 
 // ApprovalConfig contains approval workflow settings
@@ -103,6 +305,26 @@ type ApprovalConfig struct {
 	Patterns []ApprovalPatternConfig `yaml:"patterns"`
 	Webhook  *WebhookApprovalConfig  `yaml:"webhook,omitempty"`
 	Slack    *SlackApprovalConfig    `yaml:"slack,omitempty"`
+	Email    *EmailApprovalConfig    `yaml:"email,omitempty"`
+	// Store shares pending approvals between replicas (default: in memory, single replica)
+	Store *ApprovalStoreConfig `yaml:"store,omitempty"`
+}
+
+// ApprovalStoreConfig selects where pending approval requests are kept. Behind a load
+// balancer, use a shared store so an approve/reject callback can reach any replica.
+type ApprovalStoreConfig struct {
+	Type  string                    `yaml:"type"` // memory (default) or redis
+	Redis *RedisApprovalStoreConfig `yaml:"redis,omitempty"`
+}
+
+// RedisApprovalStoreConfig configures the Redis approval store
+type RedisApprovalStoreConfig struct {
+	Address  string `yaml:"address"`            // host:port
+	Username string `yaml:"username,omitempty"` // Redis 6 ACL user
+	Password string `yaml:"password,omitempty"` // Default: $REDIS_PASSWORD
+	DB       int    `yaml:"db,omitempty"`
+	Prefix   string `yaml:"prefix,omitempty"` // Key prefix (default: port-authorizing:approval:)
+	TLS      bool   `yaml:"tls,omitempty"`
 }
 
 // ApprovalPatternConfig defines which requests require approval
@@ -111,16 +333,65 @@ type ApprovalPatternConfig struct {
 	Tags           []string `yaml:"tags,omitempty" json:"tags,omitempty"`           // Connection tags (e.g., "env:prod", "team:backend")
 	TagMatch       string   `yaml:"tag_match,omitempty" json:"tag_match,omitempty"` // "all" (default) or "any"
 	TimeoutSeconds int      `yaml:"timeout_seconds" json:"timeout_seconds"`         // Approval timeout in seconds
+	// RequiredApprovals is the number of distinct approvers needed (N-of-M, default 1)
+	RequiredApprovals int `yaml:"required_approvals,omitempty" json:"required_approvals,omitempty"`
+	// Escalation pages an on-call engineer if no decision arrives in time (optional)
+	Escalation *ApprovalEscalationConfig `yaml:"escalation,omitempty" json:"escalation,omitempty"`
+	// ApprovalCacheSeconds auto-approves identical requests (same user, connection and request)
+	// for this long after an approval; 0 = ask every time
+	ApprovalCacheSeconds int `yaml:"approval_cache_seconds,omitempty" json:"approval_cache_seconds,omitempty"`
+}
+
+// ApprovalEscalationConfig escalates a pending approval before it times out
+type ApprovalEscalationConfig struct {
+	AfterSeconds int                        `yaml:"after_seconds" json:"after_seconds"` // Escalate when undecided this long; must be below timeout_seconds
+	PagerDuty    *PagerDutyEscalationConfig `yaml:"pagerduty,omitempty" json:"pagerduty,omitempty"`
+}
+
+// PagerDutyEscalationConfig triggers a PagerDuty incident through the Events API v2
+type PagerDutyEscalationConfig struct {
+	RoutingKey string `yaml:"routing_key" json:"routing_key"`                   // Integration key of the on-call service
+	Severity   string `yaml:"severity,omitempty" json:"severity,omitempty"`     // critical (default), error, warning or info
+	EventsURL  string `yaml:"events_url,omitempty" json:"events_url,omitempty"` // Default: https://events.pagerduty.com/v2/enqueue
 }
 
 // WebhookApprovalConfig configures generic webhook approvals
 type WebhookApprovalConfig struct {
 	URL string `yaml:"url" json:"url"` // Webhook endpoint URL
+	// Secret signs webhook bodies (X-PA-Signature) and the approve/reject links of every channel
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// Template is a Go text/template rendered into the payload's message field
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+	// Retry retries failed deliveries with exponential backoff
+	Retry *DeliveryRetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`
 }
 
 // SlackApprovalConfig configures Slack approvals
 type SlackApprovalConfig struct {
-	WebhookURL string `yaml:"webhook_url" json:"webhook_url"` // Slack incoming webhook URL
+	WebhookURL string               `yaml:"webhook_url" json:"webhook_url"`               // Slack incoming webhook URL
+	Template   string               `yaml:"template,omitempty" json:"template,omitempty"` // Go text/template for the message text (mrkdwn); buttons are always added
+	Retry      *DeliveryRetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`       // Retries of failed deliveries
+}
+
+// DeliveryRetryConfig retries failed approval deliveries with exponential backoff and jitter,
+// within the approval timeout. Client errors (4xx other than 429) are not retried.
+type DeliveryRetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"` // Attempts including the first (0 = 3; 1 disables retries)
+	BaseDelay   time.Duration `yaml:"base_delay,omitempty" json:"base_delay,omitempty"`     // Wait before the first retry, doubled per retry (0 = 500ms)
+}
+
+// EmailApprovalConfig configures email (SMTP) approvals
+type EmailApprovalConfig struct {
+	SMTPHost           string   `yaml:"smtp_host" json:"smtp_host"`                                           // SMTP server hostname
+	SMTPPort           int      `yaml:"smtp_port" json:"smtp_port"`                                           // SMTP server port (default: 587)
+	From               string   `yaml:"from" json:"from"`                                                     // Sender address
+	To                 []string `yaml:"to" json:"to"`                                                         // Recipient addresses (e.g., on-call mailbox)
+	Username           string   `yaml:"username,omitempty" json:"username,omitempty"`                         // SMTP auth username
+	Password           string   `yaml:"password,omitempty" json:"password,omitempty"`                         // SMTP auth password
+	TLS                bool     `yaml:"tls,omitempty" json:"tls,omitempty"`                                   // Use implicit TLS (SMTPS, usually port 465) instead of STARTTLS
+	AllowPlaintextAuth bool     `yaml:"allow_plaintext_auth,omitempty" json:"allow_plaintext_auth,omitempty"` // Allow auth without TLS when the server does not offer STARTTLS
+	SubjectTemplate    string   `yaml:"subject_template,omitempty" json:"subject_template,omitempty"`         // Go text/template for the subject
+	BodyTemplate       string   `yaml:"body_template,omitempty" json:"body_template,omitempty"`               // Go text/template for the body
 }
 
 // LoadConfig loads configuration from a YAML file
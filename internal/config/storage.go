@@ -2,17 +2,30 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// ErrVersionConflict is returned by SaveIfVersion when the stored configuration
+// changed since the expected version was read
+var ErrVersionConflict = errors.New("configuration was modified since it was read")
+
 // StorageBackend defines the interface for configuration storage
 type StorageBackend interface {
 	Load(ctx context.Context) (*Config, error)
 	Save(ctx context.Context, cfg *Config, comment string) error
+	// SaveIfVersion saves only if the stored configuration is still at
+	// expectedVersion (as returned by CurrentVersion; "" = nothing stored yet)
+	SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error
+	// CurrentVersion returns an opaque token identifying the stored configuration
+	CurrentVersion(ctx context.Context) (string, error)
 	ListVersions(ctx context.Context) ([]Version, error)
 	LoadVersion(ctx context.Context, id string) (*Config, error)
 	Rollback(ctx context.Context, id string) (*Config, error)
+	// Watch sends the newly stored configuration whenever it changes, including
+	// changes made outside this process; the channel is closed when ctx is done
+	Watch(ctx context.Context) <-chan *Config
 }
 
 // Version represents a stored configuration version
@@ -21,20 +34,56 @@ type Version struct {
 	Timestamp time.Time `json:"timestamp"`
 	Comment   string    `json:"comment"`
 	Author    string    `json:"author,omitempty"` // User who made the change
+	ETag      string    `json:"etag,omitempty"`   // CurrentVersion token (current version only)
 }
 
 // StorageConfig defines the configuration for the storage backend
 type StorageConfig struct {
-	Type         string `yaml:"type"`                    // file, kubernetes
+	Type         string `yaml:"type"`                    // file, kubernetes, vault, s3, git, consul, etcd
 	Path         string `yaml:"path,omitempty"`          // For file backend
 	Versions     int    `yaml:"versions,omitempty"`      // Number of versions to keep (default: 5)
 	Namespace    string `yaml:"namespace,omitempty"`     // For Kubernetes backend
 	ResourceType string `yaml:"resource_type,omitempty"` // configmap or secret
 	ResourceName string `yaml:"resource_name,omitempty"` // Name of configmap/secret
+
+	// WatchInterval is how often backends without native change notification poll
+	// for external edits (0 = 30s); kubernetes and etcd watch natively
+	WatchInterval time.Duration `yaml:"watch_interval,omitempty"`
+
+	Vault  *VaultStorageConfig  `yaml:"vault,omitempty"`  // For Vault backend
+	S3     *S3StorageConfig     `yaml:"s3,omitempty"`     // For S3 backend
+	Git    *GitStorageConfig    `yaml:"git,omitempty"`    // For Git backend
+	Consul *ConsulStorageConfig `yaml:"consul,omitempty"` // For Consul backend
+	Etcd   *EtcdStorageConfig   `yaml:"etcd,omitempty"`   // For etcd backend
+}
+
+type authorContextKey struct{}
+
+// WithAuthor returns a context carrying the user responsible for a config change,
+// recorded by backends that keep per-version authors
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorContextKey{}, author)
+}
+
+// AuthorFromContext returns the author set with WithAuthor, or an empty string
+func AuthorFromContext(ctx context.Context) string {
+	author, _ := ctx.Value(authorContextKey{}).(string)
+	return author
 }
 
 // NewStorageBackend creates a new storage backend based on config
 func NewStorageBackend(cfg *StorageConfig) (StorageBackend, error) {
+	backend, err := newStorageBackend(cfg)
+	if err != nil || cfg == nil || cfg.WatchInterval <= 0 {
+		return backend, err
+	}
+	if poller, ok := backend.(interface{ setWatchInterval(time.Duration) }); ok {
+		poller.setWatchInterval(cfg.WatchInterval)
+	}
+	return backend, nil
+}
+
+func newStorageBackend(cfg *StorageConfig) (StorageBackend, error) {
 	if cfg == nil {
 		// Default to file backend with current config
 		return NewFileBackend("config.yaml", 5)
@@ -69,7 +118,128 @@ func NewStorageBackend(cfg *StorageConfig) (StorageBackend, error) {
 		}
 		return NewK8sBackend(cfg.Namespace, resourceType, cfg.ResourceName, versions)
 
+	case "vault":
+		if cfg.Vault == nil {
+			return nil, fmt.Errorf("vault backend requires vault configuration")
+		}
+		return NewVaultBackend(cfg.Vault, cfg.Versions)
+
+	case "s3":
+		if cfg.S3 == nil || cfg.S3.Bucket == "" {
+			return nil, fmt.Errorf("s3 backend requires bucket")
+		}
+		versions := cfg.Versions
+		if versions <= 0 {
+			versions = 5
+		}
+		return NewS3Backend(cfg.S3, versions)
+
+	case "git":
+		if cfg.Git == nil || cfg.Git.Repository == "" {
+			return nil, fmt.Errorf("git backend requires repository")
+		}
+		return NewGitBackend(cfg.Git, cfg.Versions)
+
+	case "consul":
+		if cfg.Consul == nil || cfg.Consul.Key == "" {
+			return nil, fmt.Errorf("consul backend requires key")
+		}
+		return NewConsulBackend(cfg.Consul, cfg.Versions)
+
+	case "etcd":
+		if cfg.Etcd == nil || len(cfg.Etcd.Endpoints) == 0 {
+			return nil, fmt.Errorf("etcd backend requires endpoints")
+		}
+		return NewEtcdBackend(cfg.Etcd, cfg.Versions)
+
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
 	}
 }
+
+// defaultWatchInterval is how often backends without native change notification poll
+const defaultWatchInterval = 30 * time.Second
+
+// watchRetryDelay is how long watches wait before retrying after an error
+const watchRetryDelay = 5 * time.Second
+
+// pollWatcher implements Watch for backends without native change notification
+// by polling CurrentVersion
+type pollWatcher struct {
+	interval time.Duration
+}
+
+func (p *pollWatcher) setWatchInterval(interval time.Duration) {
+	p.interval = interval
+}
+
+// poll sends backend's configuration whenever its CurrentVersion changes
+func (p *pollWatcher) poll(ctx context.Context, backend StorageBackend) <-chan *Config {
+	interval := p.interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	updates := make(chan *Config)
+	go func() {
+		defer close(updates)
+
+		version, err := backend.CurrentVersion(ctx)
+		known := err == nil
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := backend.CurrentVersion(ctx)
+			if err != nil {
+				continue // Transient; try again on the next tick
+			}
+			if known && current == version {
+				continue
+			}
+			if !known {
+				// The first successful read is the baseline, not a change
+				version, known = current, true
+				continue
+			}
+
+			cfg, err := backend.Load(ctx)
+			if err != nil {
+				continue
+			}
+			version = current
+			if !sendConfig(ctx, updates, cfg) {
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+// sendConfig delivers cfg on updates, reporting false if ctx ended first
+func sendConfig(ctx context.Context, updates chan<- *Config, cfg *Config) bool {
+	select {
+	case updates <- cfg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleepContext waits for d, reporting false if ctx ended first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConsulStorageConfig configures the Consul KV storage backend
+type ConsulStorageConfig struct {
+	Address    string `yaml:"address,omitempty"`    // Consul HTTP address (default: $CONSUL_HTTP_ADDR, then http://127.0.0.1:8500)
+	Token      string `yaml:"token,omitempty"`      // ACL token (default: $CONSUL_HTTP_TOKEN)
+	Key        string `yaml:"key"`                  // KV key holding the config YAML (e.g., port-authorizing/config)
+	Datacenter string `yaml:"datacenter,omitempty"` // Datacenter to use (default: the agent's)
+}
+
+// consulVersionFormat names version keys; it sorts chronologically as a string
+const consulVersionFormat = "20060102-150405.000000"
+
+// consulVersionMeta is the JSON stored in the ".meta" key next to a config value
+type consulVersionMeta struct {
+	Comment   string    `json:"comment,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ConsulBackend implements StorageBackend using Consul's KV store.
+// The active config is stored as YAML at <key> with its comment/author/timestamp at
+// <key>.meta. Each save atomically (in one transaction) copies the previous pair to
+// <key>.versions/<timestamp> and <key>.versions/<timestamp>.meta. The key's
+// ModifyIndex is the version token used for optimistic concurrency.
+type ConsulBackend struct {
+	client      *http.Client
+	address     string
+	token       string
+	key         string
+	datacenter  string
+	maxVersions int
+
+	pollWatcher
+}
+
+// NewConsulBackend creates a new Consul KV storage backend
+func NewConsulBackend(cfg *ConsulStorageConfig, maxVersions int) (*ConsulBackend, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("consul configuration is required")
+	}
+
+	key := strings.Trim(cfg.Key, "/")
+	if key == "" {
+		return nil, fmt.Errorf("consul key is required")
+	}
+
+	address := firstNonEmpty(cfg.Address, os.Getenv("CONSUL_HTTP_ADDR"), "http://127.0.0.1:8500")
+	if !strings.Contains(address, "://") {
+		address = "http://" + address // CONSUL_HTTP_ADDR is commonly host:port
+	}
+
+	if maxVersions <= 0 {
+		maxVersions = 5
+	}
+
+	return &ConsulBackend{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		address:     strings.TrimRight(address, "/"),
+		token:       firstNonEmpty(cfg.Token, os.Getenv("CONSUL_HTTP_TOKEN")),
+		key:         key,
+		datacenter:  cfg.Datacenter,
+		maxVersions: maxVersions,
+	}, nil
+}
+
+// Load reads the configuration from Consul
+func (c *ConsulBackend) Load(ctx context.Context) (*Config, error) {
+	entry, err := c.get(ctx, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", c.key, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("key %s does not exist", c.key)
+	}
+	return parseConsulConfig(entry.Value)
+}
+
+// Save writes the configuration to Consul, keeping the previous one as a version
+func (c *ConsulBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	return c.save(ctx, cfg, nil, comment)
+}
+
+// SaveIfVersion saves the configuration only if the key's ModifyIndex is still
+// expectedVersion, using a check-and-set transaction
+func (c *ConsulBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	var index uint64
+	if expectedVersion != "" {
+		n, err := strconv.ParseUint(expectedVersion, 10, 64)
+		if err != nil || n == 0 {
+			return ErrVersionConflict
+		}
+		index = n
+	}
+	return c.save(ctx, cfg, &index, comment)
+}
+
+// CurrentVersion returns the key's ModifyIndex ("" if the key does not exist)
+func (c *ConsulBackend) CurrentVersion(ctx context.Context) (string, error) {
+	entry, err := c.get(ctx, c.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key %s: %w", c.key, err)
+	}
+	if entry == nil {
+		return "", nil
+	}
+	return strconv.FormatUint(entry.ModifyIndex, 10), nil
+}
+
+// save writes the config and its metadata, backing up the current pair, in one
+// transaction. With cas set the transaction fails unless the key's ModifyIndex is
+// still *cas (0 = the key must not exist).
+func (c *ConsulBackend) save(ctx context.Context, cfg *Config, cas *uint64, comment string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	meta, err := json.Marshal(consulVersionMeta{
+		Comment:   comment,
+		Author:    AuthorFromContext(ctx),
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	current, err := c.get(ctx, c.key)
+	if err != nil {
+		return fmt.Errorf("failed to read key %s: %w", c.key, err)
+	}
+
+	var ops []consulTxnOp
+	if cas != nil {
+		ops = append(ops, consulKVOp("cas", c.key, data, *cas))
+	} else if current != nil {
+		// Fail rather than back up a value that changed after it was read
+		ops = append(ops, consulKVOp("cas", c.key, data, current.ModifyIndex))
+	} else {
+		ops = append(ops, consulKVOp("set", c.key, data, 0))
+	}
+	ops = append(ops, consulKVOp("set", c.metaKey(), meta, 0))
+
+	if current != nil {
+		id := time.Now().UTC().Format(consulVersionFormat)
+		ops = append(ops, consulKVOp("set", c.versionKey(id), current.Value, 0))
+		previousMeta, err := c.get(ctx, c.metaKey())
+		if err != nil {
+			return fmt.Errorf("failed to read key %s: %w", c.metaKey(), err)
+		}
+		if previousMeta != nil {
+			ops = append(ops, consulKVOp("set", c.versionKey(id)+".meta", previousMeta.Value, 0))
+		}
+	}
+
+	if err := c.txn(ctx, ops); err != nil {
+		if cerr, ok := err.(*consulError); ok && cerr.StatusCode == http.StatusConflict {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	if err := c.rotateVersions(ctx); err != nil {
+		return fmt.Errorf("failed to rotate versions: %w", err)
+	}
+	return nil
+}
+
+// rotateVersions removes the oldest version keys beyond maxVersions
+func (c *ConsulBackend) rotateVersions(ctx context.Context) error {
+	ids, err := c.listVersionIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := c.maxVersions; i < len(ids); i++ {
+		for _, key := range []string{c.versionKey(ids[i]), c.versionKey(ids[i]) + ".meta"} {
+			if err := c.request(ctx, http.MethodDelete, "/v1/kv/"+key, nil, nil, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListVersions returns the current configuration followed by previous versions, newest first
+func (c *ConsulBackend) ListVersions(ctx context.Context) ([]Version, error) {
+	etag, err := c.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := Version{
+		ID:        "current",
+		Timestamp: time.Now(),
+		Comment:   "Current configuration",
+		ETag:      etag,
+	}
+	if meta, err := c.readMeta(ctx, c.metaKey()); err == nil && meta != nil {
+		if meta.Comment != "" {
+			current.Comment = meta.Comment
+		}
+		if !meta.Timestamp.IsZero() {
+			current.Timestamp = meta.Timestamp
+		}
+		current.Author = meta.Author
+	}
+
+	ids, err := c.listVersionIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+
+	versions := []Version{current}
+	for _, id := range ids {
+		version := Version{ID: id}
+		if meta, err := c.readMeta(ctx, c.versionKey(id)+".meta"); err == nil && meta != nil {
+			version.Timestamp = meta.Timestamp
+			version.Comment = meta.Comment
+			version.Author = meta.Author
+		}
+		if version.Timestamp.IsZero() {
+			version.Timestamp, _ = time.Parse(consulVersionFormat, id)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// LoadVersion loads a specific configuration version
+func (c *ConsulBackend) LoadVersion(ctx context.Context, id string) (*Config, error) {
+	if id == "current" {
+		return c.Load(ctx)
+	}
+
+	if _, err := time.Parse(consulVersionFormat, id); err != nil {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	entry, err := c.get(ctx, c.versionKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", id, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("version %s not found", id)
+	}
+	return parseConsulConfig(entry.Value)
+}
+
+// Rollback restores a previous configuration version
+func (c *ConsulBackend) Rollback(ctx context.Context, id string) (*Config, error) {
+	cfg, err := c.LoadVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := fmt.Sprintf("Rolled back to version %s", id)
+	if err := c.Save(ctx, cfg, comment); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Watch polls for configuration changes, including edits made outside this process
+func (c *ConsulBackend) Watch(ctx context.Context) <-chan *Config {
+	return c.poll(ctx, c)
+}
+
+func (c *ConsulBackend) metaKey() string {
+	return c.key + ".meta"
+}
+
+func (c *ConsulBackend) versionsPrefix() string {
+	return c.key + ".versions/"
+}
+
+func (c *ConsulBackend) versionKey(id string) string {
+	return c.versionsPrefix() + id
+}
+
+// listVersionIDs returns version IDs sorted newest first
+func (c *ConsulBackend) listVersionIDs(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := c.request(ctx, http.MethodGet, "/v1/kv/"+c.versionsPrefix(), url.Values{"keys": {""}}, nil, &keys)
+	if err != nil {
+		if cerr, ok := err.(*consulError); ok && cerr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, c.versionsPrefix())
+		if _, err := time.Parse(consulVersionFormat, id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// readMeta reads a ".meta" key (nil if it does not exist)
+func (c *ConsulBackend) readMeta(ctx context.Context, key string) (*consulVersionMeta, error) {
+	entry, err := c.get(ctx, key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	var meta consulVersionMeta
+	if err := json.Unmarshal(entry.Value, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// consulKVPair is a KV entry as returned by the Consul API (Value is base64 in JSON)
+type consulKVPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// get reads a single key (nil if it does not exist)
+func (c *ConsulBackend) get(ctx context.Context, key string) (*consulKVPair, error) {
+	var entries []consulKVPair
+	if err := c.request(ctx, http.MethodGet, "/v1/kv/"+key, nil, nil, &entries); err != nil {
+		if cerr, ok := err.(*consulError); ok && cerr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// consulTxnOp is one operation of a Consul transaction
+type consulTxnOp struct {
+	KV consulTxnKV `json:"KV"`
+}
+
+type consulTxnKV struct {
+	Verb  string `json:"Verb"`
+	Key   string `json:"Key"`
+	Value []byte `json:"Value,omitempty"`
+	Index uint64 `json:"Index,omitempty"`
+}
+
+func consulKVOp(verb, key string, value []byte, index uint64) consulTxnOp {
+	return consulTxnOp{KV: consulTxnKV{Verb: verb, Key: key, Value: value, Index: index}}
+}
+
+// txn applies ops atomically; Consul answers 409 when any of them (e.g. a cas) fails
+func (c *ConsulBackend) txn(ctx context.Context, ops []consulTxnOp) error {
+	return c.request(ctx, http.MethodPut, "/v1/txn", nil, ops, nil)
+}
+
+// consulError is an error response returned by the Consul API
+type consulError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *consulError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("consul returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("consul returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// request sends a single Consul API request and decodes the JSON response into out
+func (c *ConsulBackend) request(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	if c.datacenter != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("dc", c.datacenter)
+	}
+	target := c.address + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return &consulError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func parseConsulConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &cfg, nil
+}
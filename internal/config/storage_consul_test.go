@@ -0,0 +1,230 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul is a minimal in-memory Consul KV store with transactions
+type fakeConsul struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	indexes map[string]uint64
+	index   uint64
+	token   string
+	dc      string
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *httptest.Server) {
+	t.Helper()
+	fc := &fakeConsul{values: map[string][]byte{}, indexes: map[string]uint64{}}
+	srv := httptest.NewServer(http.HandlerFunc(fc.serve))
+	t.Cleanup(srv.Close)
+	return fc, srv
+}
+
+func (fc *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.token = r.Header.Get("X-Consul-Token")
+	fc.dc = r.URL.Query().Get("dc")
+
+	if r.URL.Path == "/v1/txn" && r.Method == http.MethodPut {
+		var ops []consulTxnOp
+		_ = json.NewDecoder(r.Body).Decode(&ops)
+		for _, op := range ops {
+			if op.KV.Verb == "cas" && fc.indexes[op.KV.Key] != op.KV.Index {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"Errors": []map[string]string{{"What": "index mismatch"}}})
+				return
+			}
+		}
+		fc.index++
+		for _, op := range ops {
+			fc.values[op.KV.Key] = op.KV.Value
+			fc.indexes[op.KV.Key] = fc.index
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Results": []interface{}{}})
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		if _, ok := r.URL.Query()["keys"]; ok {
+			var keys []string
+			for k := range fc.values {
+				if strings.HasPrefix(k, key) {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sort.Strings(keys)
+			_ = json.NewEncoder(w).Encode(keys)
+			return
+		}
+		value, ok := fc.values[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]consulKVPair{{Key: key, Value: value, ModifyIndex: fc.indexes[key]}})
+
+	case http.MethodDelete:
+		delete(fc.values, key)
+		delete(fc.indexes, key)
+		_, _ = w.Write([]byte("true"))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestConsulBackend_SaveLoadVersions(t *testing.T) {
+	fc, srv := newFakeConsul(t)
+
+	backend, err := NewConsulBackend(&ConsulStorageConfig{
+		Address:    srv.URL,
+		Token:      "acl-token",
+		Key:        "/port-authorizing/config/",
+		Datacenter: "dc2",
+	}, 2)
+	if err != nil {
+		t.Fatalf("NewConsulBackend() error = %v", err)
+	}
+
+	ctx := WithAuthor(context.Background(), "alice")
+	for port := 8081; port <= 8084; port++ {
+		cfg := &Config{Server: ServerConfig{Port: port}}
+		if err := backend.Save(ctx, cfg, "set port "+strconv.Itoa(port)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		time.Sleep(time.Millisecond) // Version IDs have microsecond resolution
+	}
+
+	if fc.token != "acl-token" || fc.dc != "dc2" {
+		t.Errorf("token/dc = %q/%q, want acl-token/dc2", fc.token, fc.dc)
+	}
+	if _, ok := fc.values["port-authorizing/config"]; !ok {
+		t.Fatalf("config not stored at the trimmed key: %v", fc.values)
+	}
+
+	cfg, err := backend.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8084 {
+		t.Errorf("Load() port = %d, want 8084", cfg.Server.Port)
+	}
+
+	versions, err := backend.ListVersions(context.Background())
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	// Current plus the two most recent backups (8083, 8082); 8081 was rotated out
+	if len(versions) != 3 {
+		t.Fatalf("ListVersions() returned %d versions, want 3: %+v", len(versions), versions)
+	}
+	if versions[0].ID != "current" || versions[0].Comment != "set port 8084" || versions[0].Author != "alice" || versions[0].ETag == "" {
+		t.Errorf("current version = %+v", versions[0])
+	}
+	if versions[1].Comment != "set port 8083" || versions[2].Comment != "set port 8082" || versions[1].Author != "alice" {
+		t.Errorf("previous versions = %+v", versions[1:])
+	}
+	if len(fc.values) != 2+2*2 {
+		t.Errorf("stored keys = %d, want config, meta and two versions with meta", len(fc.values))
+	}
+
+	previous, err := backend.LoadVersion(context.Background(), versions[2].ID)
+	if err != nil {
+		t.Fatalf("LoadVersion() error = %v", err)
+	}
+	if previous.Server.Port != 8082 {
+		t.Errorf("LoadVersion() port = %d, want 8082", previous.Server.Port)
+	}
+
+	if _, err := backend.LoadVersion(context.Background(), "../config"); err == nil {
+		t.Error("LoadVersion() with invalid id should fail")
+	}
+
+	restored, err := backend.Rollback(context.Background(), versions[2].ID)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if restored.Server.Port != 8082 {
+		t.Errorf("Rollback() port = %d, want 8082", restored.Server.Port)
+	}
+	versions, _ = backend.ListVersions(context.Background())
+	if !strings.HasPrefix(versions[0].Comment, "Rolled back to version") {
+		t.Errorf("rollback comment = %q", versions[0].Comment)
+	}
+}
+
+func TestConsulBackend_SaveIfVersion(t *testing.T) {
+	_, srv := newFakeConsul(t)
+
+	backend, err := NewConsulBackend(&ConsulStorageConfig{Address: srv.URL, Key: "port-authorizing/config"}, 5)
+	if err != nil {
+		t.Fatalf("NewConsulBackend() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if version, err := backend.CurrentVersion(ctx); err != nil || version != "" {
+		t.Fatalf("CurrentVersion() on missing key = %q, %v, want empty", version, err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial"); err != nil {
+		t.Fatalf("SaveIfVersion() on missing key error = %v", err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial again"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() on existing key with empty version error = %v, want ErrVersionConflict", err)
+	}
+	stale, _ := backend.CurrentVersion(ctx)
+	if err := backend.Save(ctx, &Config{Server: ServerConfig{Port: 8082}}, "concurrent"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, stale, "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() with stale version error = %v, want ErrVersionConflict", err)
+	}
+
+	versions, err := backend.ListVersions(ctx)
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, versions[0].ETag, "fresh"); err != nil {
+		t.Fatalf("SaveIfVersion() with current version error = %v", err)
+	}
+	if cfg, _ := backend.Load(ctx); cfg.Server.Port != 8083 {
+		t.Errorf("Load() port = %d, want 8083", cfg.Server.Port)
+	}
+}
+
+func TestNewConsulBackend(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_ADDR", "consul.service:8500")
+	t.Setenv("CONSUL_HTTP_TOKEN", "env-token")
+
+	if _, err := NewConsulBackend(&ConsulStorageConfig{}, 5); err == nil {
+		t.Error("NewConsulBackend() without key should fail")
+	}
+
+	backend, err := NewConsulBackend(&ConsulStorageConfig{Key: "app/config"}, 0)
+	if err != nil {
+		t.Fatalf("NewConsulBackend() error = %v", err)
+	}
+	if backend.address != "http://consul.service:8500" || backend.token != "env-token" || backend.maxVersions != 5 {
+		t.Errorf("backend = %+v, want address and token from the environment", backend)
+	}
+}
@@ -0,0 +1,615 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EtcdStorageConfig configures the etcd v3 storage backend
+type EtcdStorageConfig struct {
+	Endpoints          []string `yaml:"endpoints"`             // Client URLs, tried in order (e.g., https://etcd-0:2379)
+	Prefix             string   `yaml:"prefix,omitempty"`      // Key prefix (default: /port-authorizing/)
+	Username           string   `yaml:"username,omitempty"`    // For etcd authentication
+	Password           string   `yaml:"password,omitempty"`    // Default: $ETCD_PASSWORD
+	CACert             string   `yaml:"ca_cert,omitempty"`     // PEM CA bundle path (default: system roots)
+	ClientCert         string   `yaml:"client_cert,omitempty"` // PEM client certificate path (mutual TLS)
+	ClientKey          string   `yaml:"client_key,omitempty"`  // PEM client key path
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// etcdSaveAttempts bounds retries of an unconditional Save that races another writer
+const etcdSaveAttempts = 5
+
+// etcdVersionMeta is the JSON stored in the metadata key with each config revision.
+// Previous links to the config's prior revision, so history can be walked back.
+type etcdVersionMeta struct {
+	Comment   string    `json:"comment,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Previous  int64     `json:"previous,omitempty"`
+}
+
+// EtcdBackend implements StorageBackend using etcd v3 (through its JSON gateway).
+// The config YAML is stored at <prefix>config and its comment/author at <prefix>meta,
+// both written in one transaction that compares the config's mod_revision. Versions
+// are the config key's revisions, read back from etcd's history (until compacted).
+type EtcdBackend struct {
+	client      *http.Client
+	endpoints   []string
+	prefix      string
+	username    string
+	password    string
+	maxVersions int
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewEtcdBackend creates a new etcd storage backend
+func NewEtcdBackend(cfg *EtcdStorageConfig, maxVersions int) (*EtcdBackend, error) {
+	if cfg == nil || len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd endpoints are required")
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "/port-authorizing/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CACert != "" || cfg.ClientCert != "" || cfg.ClientKey != "" || cfg.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}
+		if cfg.CACert != "" {
+			pem, err := os.ReadFile(cfg.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read etcd ca_cert: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("etcd ca_cert %s contains no PEM certificates", cfg.CACert)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if cfg.ClientCert != "" || cfg.ClientKey != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load etcd client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	endpoints := make([]string, len(cfg.Endpoints))
+	for i, endpoint := range cfg.Endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		endpoints[i] = strings.TrimRight(endpoint, "/")
+	}
+
+	if maxVersions <= 0 {
+		maxVersions = 5
+	}
+
+	return &EtcdBackend{
+		client:      &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		endpoints:   endpoints,
+		prefix:      prefix,
+		username:    cfg.Username,
+		password:    firstNonEmpty(cfg.Password, os.Getenv("ETCD_PASSWORD")),
+		maxVersions: maxVersions,
+	}, nil
+}
+
+// Load reads the configuration from etcd
+func (e *EtcdBackend) Load(ctx context.Context) (*Config, error) {
+	return e.readConfig(ctx, 0)
+}
+
+// Save writes the configuration and its metadata in one transaction
+func (e *EtcdBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	var err error
+	for attempt := 0; attempt < etcdSaveAttempts; attempt++ {
+		var current *etcdKeyValue
+		if current, err = e.get(ctx, e.configKey(), 0); err != nil {
+			return fmt.Errorf("failed to read key %s: %w", e.configKey(), err)
+		}
+		var revision int64
+		if current != nil {
+			revision = int64(current.ModRevision)
+		}
+		if err = e.save(ctx, cfg, revision, comment); !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// SaveIfVersion saves the configuration only if the config key's mod_revision is
+// still expectedVersion
+func (e *EtcdBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	var revision int64
+	if expectedVersion != "" {
+		n, err := strconv.ParseInt(expectedVersion, 10, 64)
+		if err != nil || n <= 0 {
+			return ErrVersionConflict
+		}
+		revision = n
+	}
+	return e.save(ctx, cfg, revision, comment)
+}
+
+// CurrentVersion returns the config key's mod_revision ("" if the key does not exist)
+func (e *EtcdBackend) CurrentVersion(ctx context.Context) (string, error) {
+	current, err := e.get(ctx, e.configKey(), 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key %s: %w", e.configKey(), err)
+	}
+	if current == nil {
+		return "", nil
+	}
+	return strconv.FormatInt(int64(current.ModRevision), 10), nil
+}
+
+// save writes the config and metadata if the config key is still at revision (0 = must not exist)
+func (e *EtcdBackend) save(ctx context.Context, cfg *Config, revision int64, comment string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	meta, err := json.Marshal(etcdVersionMeta{
+		Comment:   comment,
+		Author:    AuthorFromContext(ctx),
+		Timestamp: time.Now().UTC(),
+		Previous:  revision,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	req := etcdTxnRequest{
+		Compare: []etcdCompare{{
+			Target:      "MOD",
+			Result:      "EQUAL",
+			Key:         []byte(e.configKey()),
+			ModRevision: etcdInt(revision),
+		}},
+		Success: []etcdRequestOp{
+			{RequestPut: &etcdPutRequest{Key: []byte(e.configKey()), Value: data}},
+			{RequestPut: &etcdPutRequest{Key: []byte(e.metaKey()), Value: meta}},
+		},
+	}
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := e.do(ctx, "/v3/kv/txn", req, &resp); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if !resp.Succeeded {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// ListVersions returns the current configuration followed by its previous revisions,
+// newest first, as far back as maxVersions and etcd's compacted history allow
+func (e *EtcdBackend) ListVersions(ctx context.Context) ([]Version, error) {
+	current, err := e.get(ctx, e.configKey(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", e.configKey(), err)
+	}
+
+	versions := []Version{{
+		ID:        "current",
+		Timestamp: time.Now(),
+		Comment:   "Current configuration",
+	}}
+	if current == nil {
+		return versions, nil
+	}
+	versions[0].ETag = strconv.FormatInt(int64(current.ModRevision), 10)
+
+	meta, err := e.readMeta(ctx, int64(current.ModRevision))
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		if meta.Comment != "" {
+			versions[0].Comment = meta.Comment
+		}
+		if !meta.Timestamp.IsZero() {
+			versions[0].Timestamp = meta.Timestamp
+		}
+		versions[0].Author = meta.Author
+	}
+
+	for meta != nil && meta.Previous > 0 && len(versions) <= e.maxVersions {
+		revision := meta.Previous
+		if meta, err = e.readMeta(ctx, revision); err != nil {
+			if isEtcdCompacted(err) {
+				break // Older history is gone
+			}
+			return nil, err
+		}
+		version := Version{ID: strconv.FormatInt(revision, 10)}
+		if meta != nil {
+			version.Timestamp = meta.Timestamp
+			version.Comment = meta.Comment
+			version.Author = meta.Author
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// LoadVersion loads the configuration as of a revision
+func (e *EtcdBackend) LoadVersion(ctx context.Context, id string) (*Config, error) {
+	if id == "current" {
+		return e.Load(ctx)
+	}
+
+	revision, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || revision <= 0 {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	cfg, err := e.readConfig(ctx, revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", id, err)
+	}
+	return cfg, nil
+}
+
+// Rollback restores a previous revision as a new revision
+func (e *EtcdBackend) Rollback(ctx context.Context, id string) (*Config, error) {
+	cfg, err := e.LoadVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := fmt.Sprintf("Rolled back to version %s", id)
+	if err := e.Save(ctx, cfg, comment); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Watch follows the config key with an etcd watch stream, resuming after the last
+// revision seen when the stream breaks
+func (e *EtcdBackend) Watch(ctx context.Context) <-chan *Config {
+	updates := make(chan *Config)
+	go func() {
+		defer close(updates)
+
+		var revision int64
+		if current, err := e.get(ctx, e.configKey(), 0); err == nil && current != nil {
+			revision = int64(current.ModRevision)
+		}
+		for ctx.Err() == nil {
+			err := e.watch(ctx, revision, func(kv etcdKeyValue) bool {
+				revision = int64(kv.ModRevision)
+				var cfg Config
+				if err := yaml.Unmarshal(kv.Value, &cfg); err != nil {
+					return true
+				}
+				return sendConfig(ctx, updates, &cfg)
+			})
+			if errors.Is(err, errEtcdWatchCompacted) {
+				revision = 0 // Missed revisions were compacted; resume from the current one
+				if current, err := e.get(ctx, e.configKey(), 0); err == nil && current != nil {
+					revision = int64(current.ModRevision)
+				}
+			}
+			if !sleepContext(ctx, watchRetryDelay) {
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+// errEtcdWatchCompacted ends a watch whose start revision was already compacted
+var errEtcdWatchCompacted = errors.New("etcd watch revision was compacted")
+
+// watch streams puts to the config key after revision to onPut until the stream
+// ends, ctx is done or onPut returns false
+func (e *EtcdBackend) watch(ctx context.Context, revision int64, onPut func(etcdKeyValue) bool) error {
+	token, err := e.currentToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            []byte(e.configKey()),
+			"start_revision": etcdInt(revision + 1),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The stream stays open, so it cannot use the client's request timeout
+	client := &http.Client{Transport: e.client.Transport}
+	var resp *http.Response
+	for _, endpoint := range e.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/watch", bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		if resp, err = client.Do(req); err == nil {
+			break
+		}
+	}
+	if resp == nil {
+		return fmt.Errorf("no etcd endpoint reachable")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return &etcdError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Events []struct {
+					Type string       `json:"type"`
+					Kv   etcdKeyValue `json:"kv"`
+				} `json:"events"`
+				CompactRevision etcdInt `json:"compact_revision"`
+				Canceled        bool    `json:"canceled"`
+			} `json:"result"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			return err
+		}
+		if message.Result.CompactRevision > 0 {
+			return errEtcdWatchCompacted
+		}
+		if message.Result.Canceled {
+			return fmt.Errorf("etcd canceled the watch")
+		}
+		for _, event := range message.Result.Events {
+			if event.Type != "" && event.Type != "PUT" {
+				continue // Deletes leave the running config in place
+			}
+			if !onPut(event.Kv) {
+				return nil
+			}
+		}
+	}
+}
+
+func (e *EtcdBackend) configKey() string {
+	return e.prefix + "config"
+}
+
+func (e *EtcdBackend) metaKey() string {
+	return e.prefix + "meta"
+}
+
+// readConfig reads the config as of revision (0 = latest)
+func (e *EtcdBackend) readConfig(ctx context.Context, revision int64) (*Config, error) {
+	kv, err := e.get(ctx, e.configKey(), revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", e.configKey(), err)
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("key %s does not exist", e.configKey())
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(kv.Value, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// readMeta reads the metadata written with the config at revision (nil if there is none)
+func (e *EtcdBackend) readMeta(ctx context.Context, revision int64) (*etcdVersionMeta, error) {
+	kv, err := e.get(ctx, e.metaKey(), revision)
+	if err != nil || kv == nil || int64(kv.ModRevision) != revision {
+		return nil, err // Metadata from another revision belongs to an external edit
+	}
+	var meta etcdVersionMeta
+	if err := json.Unmarshal(kv.Value, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// etcdInt is an int64 in the gateway's JSON, where it is encoded as a string
+type etcdInt int64
+
+func (i etcdInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(i), 10))
+}
+
+func (i *etcdInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = etcdInt(n)
+	return nil
+}
+
+// etcdKeyValue is a key as returned by range requests (bytes are base64 in JSON)
+type etcdKeyValue struct {
+	Key         []byte  `json:"key"`
+	Value       []byte  `json:"value"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdCompare struct {
+	Target      string  `json:"target"`
+	Result      string  `json:"result"`
+	Key         []byte  `json:"key"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdPutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdRequestOp struct {
+	RequestPut *etcdPutRequest `json:"request_put,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []etcdCompare   `json:"compare"`
+	Success []etcdRequestOp `json:"success"`
+}
+
+// get reads a key as of revision (0 = latest); nil if it does not exist
+func (e *EtcdBackend) get(ctx context.Context, key string, revision int64) (*etcdKeyValue, error) {
+	req := map[string]interface{}{"key": []byte(key)}
+	if revision > 0 {
+		req["revision"] = etcdInt(revision)
+	}
+	var resp struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := e.do(ctx, "/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return &resp.Kvs[0], nil
+}
+
+// etcdError is an error response returned by the etcd gateway
+type etcdError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *etcdError) Error() string {
+	return fmt.Sprintf("etcd returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// isEtcdCompacted reports whether a read asked for history etcd already compacted
+func isEtcdCompacted(err error) bool {
+	var eerr *etcdError
+	return errors.As(err, &eerr) && strings.Contains(eerr.Message, "compacted")
+}
+
+// do sends an authenticated request, logging in when credentials are configured and
+// again once if the token was rejected
+func (e *EtcdBackend) do(ctx context.Context, path string, body, out interface{}) error {
+	token, err := e.currentToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = e.request(ctx, path, token, body, out)
+	var eerr *etcdError
+	if errors.As(err, &eerr) && e.username != "" && strings.Contains(eerr.Message, "token") {
+		if token, err = e.currentToken(ctx, true); err != nil {
+			return err
+		}
+		err = e.request(ctx, path, token, body, out)
+	}
+	return err
+}
+
+// currentToken returns the auth token, authenticating when needed ("" without credentials)
+func (e *EtcdBackend) currentToken(ctx context.Context, refresh bool) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.username == "" || (e.token != "" && !refresh) {
+		return e.token, nil
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"name": e.username, "password": e.password}
+	if err := e.request(ctx, "/v3/auth/authenticate", "", body, &resp); err != nil {
+		return "", fmt.Errorf("etcd authentication failed: %w", err)
+	}
+	e.token = resp.Token
+	return e.token, nil
+}
+
+// request sends a gateway request to the first endpoint that answers
+func (e *EtcdBackend) request(ctx context.Context, path, token string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range e.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			lastErr = err // Try the next endpoint
+			continue
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 300 {
+			eerr := &etcdError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+			var errResp struct {
+				Error   string `json:"error"`
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(respBody, &errResp) == nil {
+				eerr.Message = firstNonEmpty(errResp.Message, errResp.Error, eerr.Message)
+			}
+			return eerr
+		}
+		if out == nil || len(respBody) == 0 {
+			return nil
+		}
+		return json.Unmarshal(respBody, out)
+	}
+	return lastErr
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEtcdRevision is one historical value of a key
+type fakeEtcdRevision struct {
+	revision int64
+	value    []byte
+}
+
+// fakeEtcd is a minimal in-memory etcd v3 JSON gateway with revision history
+type fakeEtcd struct {
+	mu        sync.Mutex
+	history   map[string][]fakeEtcdRevision
+	revision  int64
+	compacted int64
+	auth      string
+}
+
+func newFakeEtcd(t *testing.T) (*fakeEtcd, *httptest.Server) {
+	t.Helper()
+	fe := &fakeEtcd{history: map[string][]fakeEtcdRevision{}, revision: 1}
+	srv := httptest.NewServer(http.HandlerFunc(fe.serve))
+	t.Cleanup(srv.Close)
+	return fe, srv
+}
+
+// at returns the key's value as of revision (0 = latest)
+func (fe *fakeEtcd) at(key string, revision int64) *fakeEtcdRevision {
+	var found *fakeEtcdRevision
+	for i, rev := range fe.history[key] {
+		if revision == 0 || rev.revision <= revision {
+			found = &fe.history[key][i]
+		}
+	}
+	return found
+}
+
+func (fe *fakeEtcd) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v3/watch" {
+		fe.serveWatch(w, r)
+		return
+	}
+
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v3/auth/authenticate":
+		var req struct{ Name, Password string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Name != "root" || req.Password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"etcdserver: authentication failed, invalid user ID or password","code":3}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"tok-1"}`))
+		return
+	}
+
+	fe.auth = r.Header.Get("Authorization")
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req struct {
+			Key      []byte  `json:"key"`
+			Revision etcdInt `json:"revision"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Revision > 0 && int64(req.Revision) < fe.compacted {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"etcdserver: mvcc: required revision has been compacted","code":11}`))
+			return
+		}
+		resp := map[string]interface{}{}
+		if rev := fe.at(string(req.Key), int64(req.Revision)); rev != nil {
+			resp["kvs"] = []etcdKeyValue{{Key: req.Key, Value: rev.value, ModRevision: etcdInt(rev.revision)}}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+
+	case "/v3/kv/txn":
+		var req etcdTxnRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		for _, cmp := range req.Compare {
+			var current int64
+			if rev := fe.at(string(cmp.Key), 0); rev != nil {
+				current = rev.revision
+			}
+			if cmp.Target != "MOD" || cmp.Result != "EQUAL" || current != int64(cmp.ModRevision) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"succeeded": false})
+				return
+			}
+		}
+		fe.revision++
+		for _, op := range req.Success {
+			key := string(op.RequestPut.Key)
+			fe.history[key] = append(fe.history[key], fakeEtcdRevision{revision: fe.revision, value: op.RequestPut.Value})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"succeeded": true})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveWatch streams puts to the watched key from start_revision until the client leaves
+func (fe *fakeEtcd) serveWatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CreateRequest struct {
+			Key           []byte  `json:"key"`
+			StartRevision etcdInt `json:"start_revision"`
+		} `json:"create_request"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	key, next := string(req.CreateRequest.Key), int64(req.CreateRequest.StartRevision)
+
+	encoder := json.NewEncoder(w)
+	_ = encoder.Encode(map[string]interface{}{"result": map[string]interface{}{"created": true}})
+	w.(http.Flusher).Flush()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		fe.mu.Lock()
+		var events []map[string]interface{}
+		for _, rev := range fe.history[key] {
+			if rev.revision >= next {
+				events = append(events, map[string]interface{}{
+					"kv": etcdKeyValue{Key: []byte(key), Value: rev.value, ModRevision: etcdInt(rev.revision)},
+				})
+				next = rev.revision + 1
+			}
+		}
+		fe.mu.Unlock()
+
+		if len(events) > 0 {
+			_ = encoder.Encode(map[string]interface{}{"result": map[string]interface{}{"events": events}})
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestEtcdBackend_SaveLoadVersions(t *testing.T) {
+	fe, srv := newFakeEtcd(t)
+
+	backend, err := NewEtcdBackend(&EtcdStorageConfig{
+		Endpoints: []string{"http://127.0.0.1:1", srv.URL}, // First endpoint is down
+		Prefix:    "/apps/port-authorizing",
+		Username:  "root",
+		Password:  "secret",
+	}, 2)
+	if err != nil {
+		t.Fatalf("NewEtcdBackend() error = %v", err)
+	}
+
+	ctx := WithAuthor(context.Background(), "alice")
+	for port := 8081; port <= 8084; port++ {
+		cfg := &Config{Server: ServerConfig{Port: port}}
+		if err := backend.Save(ctx, cfg, "set port "+strconv.Itoa(port)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	if fe.auth != "tok-1" {
+		t.Errorf("Authorization = %q, want the token from authenticate", fe.auth)
+	}
+	if len(fe.history["/apps/port-authorizing/config"]) != 4 || len(fe.history["/apps/port-authorizing/meta"]) != 4 {
+		t.Fatalf("history = %v, want four revisions of config and meta under the prefix", fe.history)
+	}
+
+	cfg, err := backend.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8084 {
+		t.Errorf("Load() port = %d, want 8084", cfg.Server.Port)
+	}
+
+	versions, err := backend.ListVersions(context.Background())
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	// Current plus the two previous revisions (8083, 8082), capped by maxVersions
+	if len(versions) != 3 {
+		t.Fatalf("ListVersions() returned %d versions, want 3: %+v", len(versions), versions)
+	}
+	if versions[0].ID != "current" || versions[0].Comment != "set port 8084" || versions[0].Author != "alice" || versions[0].ETag == "" {
+		t.Errorf("current version = %+v", versions[0])
+	}
+	if versions[1].Comment != "set port 8083" || versions[2].Comment != "set port 8082" || versions[1].Author != "alice" {
+		t.Errorf("previous versions = %+v", versions[1:])
+	}
+
+	previous, err := backend.LoadVersion(context.Background(), versions[2].ID)
+	if err != nil {
+		t.Fatalf("LoadVersion() error = %v", err)
+	}
+	if previous.Server.Port != 8082 {
+		t.Errorf("LoadVersion() port = %d, want 8082", previous.Server.Port)
+	}
+
+	if _, err := backend.LoadVersion(context.Background(), "latest"); err == nil {
+		t.Error("LoadVersion() with invalid id should fail")
+	}
+
+	restored, err := backend.Rollback(context.Background(), versions[2].ID)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if restored.Server.Port != 8082 {
+		t.Errorf("Rollback() port = %d, want 8082", restored.Server.Port)
+	}
+	versions, _ = backend.ListVersions(context.Background())
+	if !strings.HasPrefix(versions[0].Comment, "Rolled back to version") {
+		t.Errorf("rollback comment = %q", versions[0].Comment)
+	}
+
+	// Compacted history ends the list instead of failing it
+	fe.compacted = fe.revision
+	versions, err = backend.ListVersions(context.Background())
+	if err != nil {
+		t.Fatalf("ListVersions() after compaction error = %v", err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("ListVersions() after compaction = %+v, want only current", versions)
+	}
+}
+
+func TestEtcdBackend_SaveIfVersion(t *testing.T) {
+	_, srv := newFakeEtcd(t)
+
+	backend, err := NewEtcdBackend(&EtcdStorageConfig{Endpoints: []string{srv.URL}}, 5)
+	if err != nil {
+		t.Fatalf("NewEtcdBackend() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if version, err := backend.CurrentVersion(ctx); err != nil || version != "" {
+		t.Fatalf("CurrentVersion() on missing key = %q, %v, want empty", version, err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial"); err != nil {
+		t.Fatalf("SaveIfVersion() on missing key error = %v", err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial again"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() on existing key with empty version error = %v, want ErrVersionConflict", err)
+	}
+	stale, _ := backend.CurrentVersion(ctx)
+	if err := backend.Save(ctx, &Config{Server: ServerConfig{Port: 8082}}, "concurrent"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, stale, "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() with stale version error = %v, want ErrVersionConflict", err)
+	}
+
+	versions, err := backend.ListVersions(ctx)
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, versions[0].ETag, "fresh"); err != nil {
+		t.Fatalf("SaveIfVersion() with current version error = %v", err)
+	}
+	if cfg, _ := backend.Load(ctx); cfg.Server.Port != 8083 {
+		t.Errorf("Load() port = %d, want 8083", cfg.Server.Port)
+	}
+}
+
+func TestNewEtcdBackend(t *testing.T) {
+	t.Setenv("ETCD_PASSWORD", "env-secret")
+
+	if _, err := NewEtcdBackend(&EtcdStorageConfig{}, 5); err == nil {
+		t.Error("NewEtcdBackend() without endpoints should fail")
+	}
+	if _, err := NewEtcdBackend(&EtcdStorageConfig{Endpoints: []string{"etcd:2379"}, CACert: "/nonexistent/ca.pem"}, 5); err == nil {
+		t.Error("NewEtcdBackend() with a missing ca_cert should fail")
+	}
+
+	backend, err := NewEtcdBackend(&EtcdStorageConfig{Endpoints: []string{"etcd:2379/"}, Username: "root"}, 0)
+	if err != nil {
+		t.Fatalf("NewEtcdBackend() error = %v", err)
+	}
+	if backend.endpoints[0] != "http://etcd:2379" || backend.prefix != "/port-authorizing/" || backend.password != "env-secret" || backend.maxVersions != 5 {
+		t.Errorf("backend = %+v, want defaults and password from the environment", backend)
+	}
+}
+
+func TestEtcdBackend_Watch(t *testing.T) {
+	_, srv := newFakeEtcd(t)
+
+	backend, err := NewEtcdBackend(&EtcdStorageConfig{Endpoints: []string{srv.URL}}, 5)
+	if err != nil {
+		t.Fatalf("NewEtcdBackend() error = %v", err)
+	}
+	if err := backend.Save(context.Background(), &Config{Server: ServerConfig{Port: 8081}}, "initial"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := backend.Watch(ctx)
+
+	// Another writer changes the config once the watch has its baseline; the
+	// existing revision is not replayed
+	time.Sleep(50 * time.Millisecond)
+	other, _ := NewEtcdBackend(&EtcdStorageConfig{Endpoints: []string{srv.URL}}, 5)
+	if err := other.Save(context.Background(), &Config{Server: ServerConfig{Port: 8082}}, "external"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	select {
+	case cfg := <-updates:
+		if cfg.Server.Port != 8082 {
+			t.Errorf("watched port = %d, want 8082", cfg.Server.Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not report the external change")
+	}
+
+	cancel()
+	for range updates {
+	}
+}
@@ -2,11 +2,15 @@ package config
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -16,6 +20,9 @@ import (
 type FileBackend struct {
 	path        string
 	maxVersions int
+	mu          sync.Mutex // Serializes saves so version checks and writes are atomic
+
+	pollWatcher
 }
 
 // NewFileBackend creates a new file-based storage backend
@@ -50,6 +57,44 @@ func (f *FileBackend) Load(ctx context.Context) (*Config, error) {
 
 // Save writes the configuration to file and creates a versioned backup
 func (f *FileBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.save(cfg, comment)
+}
+
+// SaveIfVersion saves the configuration only if the file still has expectedVersion
+func (f *FileBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, err := f.currentVersion()
+	if err != nil {
+		return err
+	}
+	if current != expectedVersion {
+		return ErrVersionConflict
+	}
+	return f.save(cfg, comment)
+}
+
+// CurrentVersion returns a hash of the config file ("" if it does not exist)
+func (f *FileBackend) CurrentVersion(ctx context.Context) (string, error) {
+	return f.currentVersion()
+}
+
+func (f *FileBackend) currentVersion() (string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+func (f *FileBackend) save(cfg *Config, comment string) error {
 	// Marshal config to YAML
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
@@ -63,8 +108,9 @@ func (f *FileBackend) Save(ctx context.Context, cfg *Config, comment string) err
 		}
 	}
 
-	// Write new config
-	if err := os.WriteFile(f.path, data, 0644); err != nil {
+	// Write new config to a temporary file and rename it into place, so
+	// readers never see a partially written config
+	if err := writeFileAtomic(f.path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
@@ -76,6 +122,31 @@ func (f *FileBackend) Save(ctx context.Context, cfg *Config, comment string) err
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames it over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // createBackup creates a versioned backup of the current config
 func (f *FileBackend) createBackup(comment string) error {
 	timestamp := time.Now().Format("20060102-150405")
@@ -157,11 +228,17 @@ func (f *FileBackend) ListVersions(ctx context.Context) ([]Version, error) {
 		return backups[i] > backups[j]
 	})
 
+	etag, err := f.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	versions := []Version{
 		{
 			ID:        "current",
 			Timestamp: time.Now(),
 			Comment:   "Current configuration",
+			ETag:      etag,
 		},
 	}
 
@@ -260,3 +337,8 @@ func (f *FileBackend) Rollback(ctx context.Context, id string) (*Config, error)
 
 	return cfg, nil
 }
+
+// Watch polls for configuration changes, including edits made outside this process
+func (f *FileBackend) Watch(ctx context.Context) <-chan *Config {
+	return f.poll(ctx, f)
+}
@@ -0,0 +1,418 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GitStorageConfig configures the Git storage backend
+type GitStorageConfig struct {
+	Repository  string `yaml:"repository"`             // Local path (e.g. a bare repo) or remote URL
+	Branch      string `yaml:"branch,omitempty"`       // Branch holding the config (default: main)
+	Path        string `yaml:"path,omitempty"`         // File path within the repository (default: config.yaml)
+	WorkDir     string `yaml:"work_dir,omitempty"`     // Local checkout used to commit (default: a temporary directory)
+	Token       string `yaml:"token,omitempty"`        // Access token for HTTPS remotes (default: $GIT_TOKEN)
+	Username    string `yaml:"username,omitempty"`     // Username sent with the token (default: x-access-token)
+	EmailDomain string `yaml:"email_domain,omitempty"` // Domain for author emails of non-email usernames (default: port-authorizing.local)
+}
+
+// gitCommitter is the committer of every commit; the author is the admin who made the change
+const gitCommitter = "port-authorizing"
+
+// gitIdentityReplacer strips characters git does not allow in author names and emails
+var gitIdentityReplacer = strings.NewReplacer("<", "", ">", "", "\n", " ")
+
+// gitRevisionPattern matches the commit IDs accepted by LoadVersion and Rollback
+var gitRevisionPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// GitBackend implements StorageBackend by committing the config file to a Git
+// repository. Each save is a commit (message = comment, author = the admin in
+// the context) pushed to the configured branch; versions are the file's commits.
+// It uses the git command line, which must be installed.
+type GitBackend struct {
+	repository  string
+	branch      string
+	path        string
+	workDir     string
+	authHeader  string // http.extraHeader value for HTTPS remotes ("" = none)
+	emailDomain string
+	maxVersions int
+
+	mu sync.Mutex // Serializes operations on the working copy
+
+	pollWatcher
+}
+
+// NewGitBackend creates a new Git storage backend
+func NewGitBackend(cfg *GitStorageConfig, maxVersions int) (*GitBackend, error) {
+	if cfg == nil || cfg.Repository == "" {
+		return nil, fmt.Errorf("git repository is required")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git backend requires the git command: %w", err)
+	}
+
+	filePath := path.Clean(strings.TrimPrefix(firstNonEmpty(cfg.Path, "config.yaml"), "/"))
+	if filePath == "." || strings.HasPrefix(filePath, "../") {
+		return nil, fmt.Errorf("invalid git path %q", cfg.Path)
+	}
+
+	b := &GitBackend{
+		repository:  cfg.Repository,
+		branch:      firstNonEmpty(cfg.Branch, "main"),
+		path:        filePath,
+		workDir:     cfg.WorkDir,
+		emailDomain: firstNonEmpty(cfg.EmailDomain, "port-authorizing.local"),
+		maxVersions: maxVersions,
+	}
+
+	if token := firstNonEmpty(cfg.Token, os.Getenv("GIT_TOKEN")); token != "" {
+		credentials := firstNonEmpty(cfg.Username, "x-access-token") + ":" + token
+		b.authHeader = "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	if b.workDir == "" {
+		dir, err := os.MkdirTemp("", "port-authorizing-git-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create git work directory: %w", err)
+		}
+		b.workDir = dir
+	}
+	if err := b.initWorkDir(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Load reads the configuration from the latest commit of the branch
+func (g *GitBackend) Load(ctx context.Context) (*Config, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.sync(ctx); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(g.filePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return parseGitConfig(data)
+}
+
+// Save commits the configuration and pushes it to the branch
+func (g *GitBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.sync(ctx); err != nil {
+		return err
+	}
+	return g.commitConfig(ctx, cfg, comment)
+}
+
+// SaveIfVersion commits the configuration only if the branch is still at the
+// expected commit; a push rejected because the branch moved is a conflict too
+func (g *GitBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	head, err := g.sync(ctx)
+	if err != nil {
+		return err
+	}
+	if head != expectedVersion {
+		return ErrVersionConflict
+	}
+	return g.commitConfig(ctx, cfg, comment)
+}
+
+// CurrentVersion returns the latest commit of the branch ("" if it has none)
+func (g *GitBackend) CurrentVersion(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sync(ctx)
+}
+
+// ListVersions returns the current configuration followed by earlier commits of the file
+func (g *GitBackend) ListVersions(ctx context.Context) ([]Version, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	head, err := g.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head == "" {
+		return []Version{{ID: "current", Timestamp: time.Now(), Comment: "Current configuration"}}, nil
+	}
+
+	args := []string{"log", "--format=%H%x1f%an%x1f%aI%x1f%s", "HEAD"}
+	if g.maxVersions > 0 {
+		args = append(args, "-n", strconv.Itoa(g.maxVersions+1))
+	}
+	out, err := g.git(ctx, append(args, "--", g.path)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	var versions []Version
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		timestamp, _ := time.Parse(time.RFC3339, fields[2])
+		version := Version{
+			ID:        fields[0],
+			Timestamp: timestamp,
+			Comment:   fields[3],
+			Author:    fields[1],
+		}
+		if len(versions) == 0 {
+			version.ID = "current"
+			version.ETag = head
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// LoadVersion loads the configuration as of a commit
+func (g *GitBackend) LoadVersion(ctx context.Context, id string) (*Config, error) {
+	if id == "current" {
+		return g.Load(ctx)
+	}
+	if !gitRevisionPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.sync(ctx); err != nil {
+		return nil, err
+	}
+	out, err := g.git(ctx, "show", id+":"+g.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", id, err)
+	}
+	return parseGitConfig([]byte(out))
+}
+
+// Rollback checks out the file as of a commit and commits it as a new version
+func (g *GitBackend) Rollback(ctx context.Context, id string) (*Config, error) {
+	if !gitRevisionPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := g.sync(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := g.git(ctx, "checkout", id, "--", g.path); err != nil {
+		return nil, fmt.Errorf("failed to check out version %s: %w", id, err)
+	}
+
+	data, err := os.ReadFile(g.filePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := parseGitConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.commit(ctx, fmt.Sprintf("Rolled back to version %s", id)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Watch polls for configuration changes, including edits made outside this process
+func (g *GitBackend) Watch(ctx context.Context) <-chan *Config {
+	return g.poll(ctx, g)
+}
+
+// initWorkDir prepares the working copy with the repository as its origin
+func (g *GitBackend) initWorkDir(ctx context.Context) error {
+	if err := os.MkdirAll(g.workDir, 0700); err != nil {
+		return fmt.Errorf("failed to create git work directory: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(g.workDir, ".git")); os.IsNotExist(err) {
+		if _, err := g.git(ctx, "init", "-q"); err != nil {
+			return fmt.Errorf("failed to initialize git work directory: %w", err)
+		}
+	}
+
+	if _, err := g.git(ctx, "remote", "get-url", "origin"); err != nil {
+		_, err = g.git(ctx, "remote", "add", "origin", g.repository)
+		if err != nil {
+			return fmt.Errorf("failed to add git remote: %w", err)
+		}
+	} else if _, err := g.git(ctx, "remote", "set-url", "origin", g.repository); err != nil {
+		return fmt.Errorf("failed to set git remote: %w", err)
+	}
+	return nil
+}
+
+// sync resets the working copy to the remote branch and returns its commit
+// ("" while the branch does not exist yet)
+func (g *GitBackend) sync(ctx context.Context) (string, error) {
+	if _, err := g.remoteGit(ctx, "fetch", "-q", "--prune", "origin"); err != nil {
+		return "", fmt.Errorf("failed to fetch from git repository: %w", err)
+	}
+
+	remoteRef := "refs/remotes/origin/" + g.branch
+	head, err := g.git(ctx, "rev-parse", "-q", "--verify", remoteRef+"^{commit}")
+	if err != nil {
+		// Empty repository or new branch: the next commit starts the branch,
+		// dropping any local commit whose push failed
+		_, _ = g.git(ctx, "update-ref", "-d", "refs/heads/"+g.branch)
+		if _, err := g.git(ctx, "symbolic-ref", "HEAD", "refs/heads/"+g.branch); err != nil {
+			return "", fmt.Errorf("failed to prepare branch %s: %w", g.branch, err)
+		}
+		if _, err := g.git(ctx, "read-tree", "--empty"); err != nil {
+			return "", fmt.Errorf("failed to prepare branch %s: %w", g.branch, err)
+		}
+		return "", nil
+	}
+
+	// Discard local changes and unpushed commits
+	if _, err := g.git(ctx, "checkout", "-q", "-f", "-B", g.branch, remoteRef); err != nil {
+		return "", fmt.Errorf("failed to check out branch %s: %w", g.branch, err)
+	}
+	return strings.TrimSpace(head), nil
+}
+
+// commitConfig writes the config file, commits it and pushes the commit
+func (g *GitBackend) commitConfig(ctx context.Context, cfg *Config, comment string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(g.filePath()), 0700); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.WriteFile(g.filePath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return g.commit(ctx, comment)
+}
+
+// commit commits the config file as the admin in ctx and pushes it; a rejected
+// push means the branch moved since sync and is reported as ErrVersionConflict
+func (g *GitBackend) commit(ctx context.Context, comment string) error {
+	if _, err := g.git(ctx, "add", "--", g.path); err != nil {
+		return fmt.Errorf("failed to stage config: %w", err)
+	}
+
+	if comment == "" {
+		comment = "Update configuration"
+	}
+	author := gitIdentityReplacer.Replace(AuthorFromContext(ctx))
+	if author == "" {
+		author = gitCommitter
+	}
+	email := author
+	if !strings.Contains(email, "@") {
+		email = strings.ReplaceAll(author, " ", ".") + "@" + g.emailDomain
+	}
+
+	_, err := g.git(ctx,
+		"-c", "user.name="+gitCommitter,
+		"-c", "user.email="+gitCommitter+"@"+g.emailDomain,
+		"-c", "commit.gpgsign=false",
+		"commit", "-q", "--allow-empty",
+		"--author", fmt.Sprintf("%s <%s>", author, email),
+		"-m", comment)
+	if err != nil {
+		return fmt.Errorf("failed to commit config: %w", err)
+	}
+
+	if _, err := g.remoteGit(ctx, "push", "-q", "origin", "HEAD:refs/heads/"+g.branch); err != nil {
+		if strings.Contains(err.Error(), "[rejected]") || strings.Contains(err.Error(), "non-fast-forward") ||
+			strings.Contains(err.Error(), "fetch first") {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("failed to push config: %w", err)
+	}
+	return nil
+}
+
+func (g *GitBackend) filePath() string {
+	return filepath.Join(g.workDir, filepath.FromSlash(g.path))
+}
+
+// remoteGit runs a git command that talks to the remote, with the access token if configured.
+// The auth header is passed as environment config (git 2.31+): arguments show up in the
+// process list for every local user.
+func (g *GitBackend) remoteGit(ctx context.Context, args ...string) (string, error) {
+	var env []string
+	if g.authHeader != "" {
+		env = []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=" + g.authHeader}
+	}
+	return g.run(ctx, env, args...)
+}
+
+// git runs a git command in the working copy and returns its output
+func (g *GitBackend) git(ctx context.Context, args ...string) (string, error) {
+	return g.run(ctx, nil, args...)
+}
+
+// run runs git in the working copy with extra environment variables
+func (g *GitBackend) run(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.workDir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Only name the subcommand: the arguments include -c options and commit messages
+		command := gitSubcommand(args)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", command, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", command, err)
+	}
+	return stdout.String(), nil
+}
+
+// gitSubcommand returns the subcommand of a git invocation, skipping "-c key=value" options
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+func parseGitConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := filepath.Join(t.TempDir(), "config.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v: %s", err, out)
+	}
+	return repo
+}
+
+func newTestGitBackend(t *testing.T, repo string, maxVersions int) *GitBackend {
+	t.Helper()
+	backend, err := NewGitBackend(&GitStorageConfig{Repository: repo, Path: "env/prod/config.yaml", WorkDir: t.TempDir()}, maxVersions)
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	return backend
+}
+
+func TestGitBackend_SaveLoadVersions(t *testing.T) {
+	repo := newTestGitRepo(t)
+	backend := newTestGitBackend(t, repo, 2)
+	ctx := WithAuthor(context.Background(), "alice")
+
+	if _, err := backend.Load(ctx); err == nil {
+		t.Error("Load() on empty repository should fail")
+	}
+
+	for port := 8081; port <= 8084; port++ {
+		cfg := &Config{Server: ServerConfig{Port: port}}
+		if err := backend.Save(ctx, cfg, "set port "+strconv.Itoa(port)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	// The commits land in the bare repository with the admin as author
+	out, err := exec.Command("git", "--git-dir", repo, "log", "--format=%an|%cn|%s", "main").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 4 || lines[0] != "alice|port-authorizing|set port 8084" {
+		t.Errorf("repository log = %q", lines)
+	}
+
+	cfg, err := backend.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8084 {
+		t.Errorf("Load() port = %d, want 8084", cfg.Server.Port)
+	}
+
+	versions, err := backend.ListVersions(ctx)
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("ListVersions() returned %d versions, want 3: %+v", len(versions), versions)
+	}
+	if versions[0].ID != "current" || versions[0].Comment != "set port 8084" || versions[0].Author != "alice" || versions[0].ETag == "" {
+		t.Errorf("current version = %+v", versions[0])
+	}
+	if versions[1].Comment != "set port 8083" {
+		t.Errorf("previous version = %+v", versions[1])
+	}
+
+	previous, err := backend.LoadVersion(ctx, versions[2].ID)
+	if err != nil {
+		t.Fatalf("LoadVersion() error = %v", err)
+	}
+	if previous.Server.Port != 8082 {
+		t.Errorf("LoadVersion() port = %d, want 8082", previous.Server.Port)
+	}
+	if _, err := backend.LoadVersion(ctx, "HEAD~1"); err == nil {
+		t.Error("LoadVersion() with a non-commit id should fail")
+	}
+
+	rolledBack := versions[2].ID
+	restored, err := backend.Rollback(ctx, rolledBack)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if restored.Server.Port != 8082 {
+		t.Errorf("Rollback() port = %d, want 8082", restored.Server.Port)
+	}
+
+	// A second checkout of the same repository sees the rollback
+	other := newTestGitBackend(t, repo, 2)
+	cfg, err = other.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() from another work directory error = %v", err)
+	}
+	if cfg.Server.Port != 8082 {
+		t.Errorf("Load() after rollback port = %d, want 8082", cfg.Server.Port)
+	}
+	versions, _ = other.ListVersions(ctx)
+	if want := "Rolled back to version " + rolledBack; versions[0].Comment != want {
+		t.Errorf("current comment = %q, want %q", versions[0].Comment, want)
+	}
+}
+
+func TestGitBackend_SaveIfVersion(t *testing.T) {
+	repo := newTestGitRepo(t)
+	first := newTestGitBackend(t, repo, 5)
+	second := newTestGitBackend(t, repo, 5)
+	ctx := context.Background()
+
+	if err := first.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial"); err != nil {
+		t.Fatalf("SaveIfVersion() on empty repository error = %v", err)
+	}
+
+	read, err := second.CurrentVersion(ctx)
+	if err != nil || read == "" {
+		t.Fatalf("CurrentVersion() = %q, %v", read, err)
+	}
+
+	// Another replica commits in between
+	if err := first.Save(ctx, &Config{Server: ServerConfig{Port: 8082}}, "concurrent"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := second.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, read, "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() with stale version error = %v, want ErrVersionConflict", err)
+	}
+
+	current, _ := second.CurrentVersion(ctx)
+	if err := second.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, current, "fresh"); err != nil {
+		t.Fatalf("SaveIfVersion() with current version error = %v", err)
+	}
+	cfg, err := first.Load(ctx)
+	if err != nil || cfg.Server.Port != 8083 {
+		t.Errorf("Load() = %+v, %v, want port 8083", cfg, err)
+	}
+}
+
+func TestGitBackend_TokenNotInArguments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script wrapper")
+	}
+	repo := newTestGitRepo(t)
+	realGit, _ := exec.LookPath("git")
+
+	// A git wrapper records each invocation's arguments and config environment
+	bin := t.TempDir()
+	logPath := filepath.Join(bin, "calls.log")
+	script := "#!/bin/sh\n" +
+		"echo \"args: $*\" >> " + logPath + "\n" +
+		"echo \"env: $GIT_CONFIG_KEY_0=$GIT_CONFIG_VALUE_0\" >> " + logPath + "\n" +
+		"exec " + realGit + " \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	backend, err := NewGitBackend(&GitStorageConfig{Repository: repo, Token: "s3cret-token", WorkDir: t.TempDir()}, 5)
+	if err != nil {
+		t.Fatalf("NewGitBackend() error = %v", err)
+	}
+	if err := backend.Save(context.Background(), &Config{Server: ServerConfig{Port: 8081}}, "initial"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte("x-access-token:s3cret-token"))
+	sawHeader := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "args: ") && (strings.Contains(line, encoded) || strings.Contains(line, "extraHeader")) {
+			t.Errorf("git arguments carry the token: %s", line)
+		}
+		if line == "env: http.extraHeader=Authorization: Basic "+encoded {
+			sawHeader = true
+		}
+	}
+	if !sawHeader {
+		t.Errorf("no git call received the auth header through its environment:\n%s", data)
+	}
+}
@@ -8,7 +8,10 @@ import (
 
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -77,6 +80,49 @@ func (k *K8sBackend) Load(ctx context.Context) (*Config, error) {
 
 // Save writes the configuration to Kubernetes ConfigMap/Secret with versioning
 func (k *K8sBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	return k.save(ctx, cfg, "", comment)
+}
+
+// SaveIfVersion saves the configuration only if the resource still has the
+// expected resourceVersion; the API server rejects the update otherwise
+func (k *K8sBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	current, err := k.CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current != expectedVersion {
+		return ErrVersionConflict
+	}
+	return k.save(ctx, cfg, expectedVersion, comment)
+}
+
+// CurrentVersion returns the resourceVersion of the ConfigMap/Secret ("" if it does not exist)
+func (k *K8sBackend) CurrentVersion(ctx context.Context) (string, error) {
+	var resourceVersion string
+	var err error
+	if k.resourceType == "configmap" {
+		var cm *corev1.ConfigMap
+		if cm, err = k.client.CoreV1().ConfigMaps(k.namespace).Get(ctx, k.resourceName, metav1.GetOptions{}); err == nil {
+			resourceVersion = cm.ResourceVersion
+		}
+	} else {
+		var secret *corev1.Secret
+		if secret, err = k.client.CoreV1().Secrets(k.namespace).Get(ctx, k.resourceName, metav1.GetOptions{}); err == nil {
+			resourceVersion = secret.ResourceVersion
+		}
+	}
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read resource: %w", err)
+	}
+	return resourceVersion, nil
+}
+
+// save writes the main resource; with a non-empty resourceVersion the update
+// only succeeds if the resource is still at that version
+func (k *K8sBackend) save(ctx context.Context, cfg *Config, resourceVersion, comment string) error {
 	// Marshal config
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
@@ -89,7 +135,10 @@ func (k *K8sBackend) Save(ctx context.Context, cfg *Config, comment string) erro
 	}
 
 	// Update main resource
-	if err := k.writeResource(ctx, k.resourceName, string(data), comment); err != nil {
+	if err := k.writeResourceVersion(ctx, k.resourceName, string(data), comment, resourceVersion); err != nil {
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			return ErrVersionConflict
+		}
 		return fmt.Errorf("failed to write resource: %w", err)
 	}
 
@@ -155,11 +204,17 @@ func (k *K8sBackend) ListVersions(ctx context.Context) ([]Version, error) {
 		return versionNames[i] > versionNames[j]
 	})
 
+	etag, err := k.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	versions := []Version{
 		{
 			ID:        "current",
 			Timestamp: time.Now(),
 			Comment:   "Current configuration",
+			ETag:      etag,
 		},
 	}
 
@@ -220,6 +275,74 @@ func (k *K8sBackend) Rollback(ctx context.Context, id string) (*Config, error) {
 	return cfg, nil
 }
 
+// Watch follows the ConfigMap/Secret with a Kubernetes watch, so edits made with
+// kubectl or by another replica are seen as soon as the API server reports them
+func (k *K8sBackend) Watch(ctx context.Context) <-chan *Config {
+	updates := make(chan *Config)
+	go func() {
+		defer close(updates)
+
+		version, _ := k.CurrentVersion(ctx)
+		for ctx.Err() == nil {
+			opts := metav1.ListOptions{
+				FieldSelector:   fields.OneTermEqualSelector("metadata.name", k.resourceName).String(),
+				ResourceVersion: version,
+			}
+			var watcher watch.Interface
+			var err error
+			if k.resourceType == "configmap" {
+				watcher, err = k.client.CoreV1().ConfigMaps(k.namespace).Watch(ctx, opts)
+			} else {
+				watcher, err = k.client.CoreV1().Secrets(k.namespace).Watch(ctx, opts)
+			}
+			if err != nil {
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					version = "" // Restart from the current state
+				}
+				if !sleepContext(ctx, watchRetryDelay) {
+					return
+				}
+				continue
+			}
+
+			for event := range watcher.ResultChan() {
+				if event.Type == watch.Error {
+					version = "" // Usually an expired resourceVersion; restart from the current state
+					break
+				}
+				if event.Type != watch.Added && event.Type != watch.Modified {
+					continue
+				}
+
+				var resourceVersion, data string
+				switch obj := event.Object.(type) {
+				case *corev1.ConfigMap:
+					resourceVersion, data = obj.ResourceVersion, obj.Data["config.yaml"]
+				case *corev1.Secret:
+					resourceVersion, data = obj.ResourceVersion, string(obj.Data["config.yaml"])
+				default:
+					continue
+				}
+				if resourceVersion == version {
+					continue
+				}
+				version = resourceVersion
+
+				var cfg Config
+				if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+					continue
+				}
+				if !sendConfig(ctx, updates, &cfg) {
+					watcher.Stop()
+					return
+				}
+			}
+			watcher.Stop()
+		}
+	}()
+	return updates
+}
+
 // Helper methods for ConfigMap/Secret operations
 
 func (k *K8sBackend) readResource(ctx context.Context, name string) (string, error) {
@@ -240,6 +363,12 @@ func (k *K8sBackend) readResource(ctx context.Context, name string) (string, err
 }
 
 func (k *K8sBackend) writeResource(ctx context.Context, name, data, comment string) error {
+	return k.writeResourceVersion(ctx, name, data, comment, "")
+}
+
+// writeResourceVersion creates or updates a resource; a non-empty resourceVersion
+// makes the update conditional on the resource still being at that version
+func (k *K8sBackend) writeResourceVersion(ctx context.Context, name, data, comment, resourceVersion string) error {
 	annotations := map[string]string{
 		"port-authorizing.io/comment":   comment,
 		"port-authorizing.io/timestamp": time.Now().Format(time.RFC3339),
@@ -266,6 +395,9 @@ func (k *K8sBackend) writeResource(ctx context.Context, name, data, comment stri
 
 		// Update existing
 		cm.ResourceVersion = existing.ResourceVersion
+		if resourceVersion != "" {
+			cm.ResourceVersion = resourceVersion
+		}
 		_, err = k.client.CoreV1().ConfigMaps(k.namespace).Update(ctx, cm, metav1.UpdateOptions{})
 		return err
 	}
@@ -291,6 +423,9 @@ func (k *K8sBackend) writeResource(ctx context.Context, name, data, comment stri
 
 	// Update existing
 	secret.ResourceVersion = existing.ResourceVersion
+	if resourceVersion != "" {
+		secret.ResourceVersion = resourceVersion
+	}
 	_, err = k.client.CoreV1().Secrets(k.namespace).Update(ctx, secret, metav1.UpdateOptions{})
 	return err
 }
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gopkg.in/yaml.v3"
+)
+
+// S3StorageConfig configures the S3 storage backend.
+// Credentials come from the default AWS chain (environment, shared config, instance role).
+type S3StorageConfig struct {
+	Bucket   string `yaml:"bucket"`             // Bucket holding the configuration
+	Prefix   string `yaml:"prefix,omitempty"`   // Key prefix (e.g., "port-authorizing/")
+	Region   string `yaml:"region,omitempty"`   // AWS region (default: from environment)
+	Endpoint string `yaml:"endpoint,omitempty"` // Custom endpoint for S3-compatible stores such as MinIO
+}
+
+// S3 object metadata keys (stored as x-amz-meta-*)
+const (
+	s3MetaComment   = "comment"
+	s3MetaAuthor    = "author"
+	s3MetaTimestamp = "timestamp"
+)
+
+// s3VersionFormat names version objects; it sorts chronologically as a string
+const s3VersionFormat = "20060102-150405.000000"
+
+// S3Backend implements StorageBackend using an S3 bucket.
+// The active config is stored at <prefix>config.yaml and each save first copies
+// it to <prefix>versions/<timestamp>.yaml, keeping its comment/author metadata.
+type S3Backend struct {
+	client      *s3.Client
+	bucket      string
+	prefix      string
+	maxVersions int
+
+	pollWatcher
+}
+
+// NewS3Backend creates a new S3-based storage backend
+func NewS3Backend(cfg *S3StorageConfig, maxVersions int) (*S3Backend, error) {
+	if cfg == nil || cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true // MinIO and most S3-compatible stores expect path-style URLs
+		}
+	})
+
+	return newS3BackendWithClient(client, cfg.Bucket, cfg.Prefix, maxVersions), nil
+}
+
+func newS3BackendWithClient(client *s3.Client, bucket, prefix string, maxVersions int) *S3Backend {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Backend{
+		client:      client,
+		bucket:      bucket,
+		prefix:      prefix,
+		maxVersions: maxVersions,
+	}
+}
+
+// Load reads the configuration from S3
+func (b *S3Backend) Load(ctx context.Context) (*Config, error) {
+	return b.readConfig(ctx, b.configKey())
+}
+
+// Save writes the configuration to S3, keeping the previous one as a version
+func (b *S3Backend) Save(ctx context.Context, cfg *Config, comment string) error {
+	return b.save(ctx, cfg, nil, comment)
+}
+
+// SaveIfVersion saves the configuration only if the config object still has
+// the expected ETag, using a conditional PutObject
+func (b *S3Backend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	current, err := b.CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current != expectedVersion {
+		return ErrVersionConflict
+	}
+	return b.save(ctx, cfg, &expectedVersion, comment)
+}
+
+// CurrentVersion returns the ETag of the config object without quotes ("" if it does not exist)
+func (b *S3Backend) CurrentVersion(ctx context.Context) (string, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.configKey()),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read object %s: %w", b.configKey(), err)
+	}
+	return strings.Trim(aws.ToString(out.ETag), `"`), nil
+}
+
+// save writes the config object; with expectedETag set the write is
+// conditional on the object still having that ETag ("" = must not exist)
+func (b *S3Backend) save(ctx context.Context, cfg *Config, expectedETag *string, comment string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	// Create version backup
+	if err := b.createVersionBackup(ctx); err != nil {
+		return fmt.Errorf("failed to create version backup: %w", err)
+	}
+
+	metadata := map[string]string{
+		s3MetaComment:   url.QueryEscape(comment),
+		s3MetaTimestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if author := AuthorFromContext(ctx); author != "" {
+		metadata[s3MetaAuthor] = url.QueryEscape(author)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(b.configKey()),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/yaml"),
+		Metadata:    metadata,
+	}
+	if expectedETag != nil {
+		if *expectedETag == "" {
+			input.IfNoneMatch = aws.String("*")
+		} else {
+			input.IfMatch = aws.String(`"` + *expectedETag + `"`)
+		}
+	}
+	if _, err := b.client.PutObject(ctx, input); err != nil {
+		if isS3PreconditionFailed(err) {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	// Rotate old versions
+	if err := b.rotateVersions(ctx); err != nil {
+		return fmt.Errorf("failed to rotate versions: %w", err)
+	}
+
+	return nil
+}
+
+// createVersionBackup copies the current config (with its metadata) to a version key
+func (b *S3Backend) createVersionBackup(ctx context.Context) error {
+	_, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.configKey()),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			// No current config, nothing to backup
+			return nil
+		}
+		return err
+	}
+
+	id := time.Now().UTC().Format(s3VersionFormat)
+	_, err = b.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(b.bucket),
+		Key:        aws.String(b.versionKey(id)),
+		CopySource: aws.String(url.PathEscape(b.bucket) + "/" + escapeS3Key(b.configKey())),
+	})
+	return err
+}
+
+// rotateVersions removes the oldest version objects beyond maxVersions
+func (b *S3Backend) rotateVersions(ctx context.Context) error {
+	if b.maxVersions <= 0 {
+		return nil
+	}
+
+	ids, err := b.listVersionIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := b.maxVersions; i < len(ids); i++ {
+		_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.versionKey(ids[i])),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListVersions returns list of available configuration versions
+func (b *S3Backend) ListVersions(ctx context.Context) ([]Version, error) {
+	ids, err := b.listVersionIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := b.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := Version{
+		ID:        "current",
+		Timestamp: time.Now(),
+		Comment:   "Current configuration",
+		ETag:      etag,
+	}
+	if meta, err := b.objectMetadata(ctx, b.configKey()); err == nil {
+		if meta.Comment != "" {
+			current.Comment = meta.Comment
+		}
+		if !meta.Timestamp.IsZero() {
+			current.Timestamp = meta.Timestamp
+		}
+		current.Author = meta.Author
+	}
+
+	versions := []Version{current}
+	for _, id := range ids {
+		meta, err := b.objectMetadata(ctx, b.versionKey(id))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{
+			ID:        id,
+			Timestamp: meta.Timestamp,
+			Comment:   meta.Comment,
+			Author:    meta.Author,
+		})
+	}
+
+	return versions, nil
+}
+
+// LoadVersion loads a specific configuration version
+func (b *S3Backend) LoadVersion(ctx context.Context, id string) (*Config, error) {
+	if id == "current" {
+		return b.Load(ctx)
+	}
+
+	if _, err := time.Parse(s3VersionFormat, id); err != nil {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	cfg, err := b.readConfig(ctx, b.versionKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", id, err)
+	}
+	return cfg, nil
+}
+
+// Rollback restores a previous configuration version
+func (b *S3Backend) Rollback(ctx context.Context, id string) (*Config, error) {
+	cfg, err := b.LoadVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := fmt.Sprintf("Rolled back to version %s", id)
+	if err := b.Save(ctx, cfg, comment); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Watch polls for configuration changes, including edits made outside this process
+func (b *S3Backend) Watch(ctx context.Context) <-chan *Config {
+	return b.poll(ctx, b)
+}
+
+// Helper methods for S3 object operations
+
+func (b *S3Backend) configKey() string {
+	return b.prefix + "config.yaml"
+}
+
+func (b *S3Backend) versionKey(id string) string {
+	return b.prefix + "versions/" + id + ".yaml"
+}
+
+func (b *S3Backend) readConfig(ctx context.Context, key string) (*Config, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	defer func() { _ = out.Body.Close() }()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// listVersionIDs returns version IDs sorted newest first
+func (b *S3Backend) listVersionIDs(ctx context.Context) ([]string, error) {
+	prefix := b.prefix + "versions/"
+	var ids []string
+
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(obj.Key), prefix)
+			if path.Ext(name) != ".yaml" || strings.Contains(name, "/") {
+				continue
+			}
+			ids = append(ids, strings.TrimSuffix(name, ".yaml"))
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+func (b *S3Backend) objectMetadata(ctx context.Context, key string) (*versionMetadata, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &versionMetadata{
+		Comment: unescapeS3Meta(out.Metadata[s3MetaComment]),
+		Author:  unescapeS3Meta(out.Metadata[s3MetaAuthor]),
+	}
+
+	if ts := out.Metadata[s3MetaTimestamp]; ts != "" {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			metadata.Timestamp = t
+		}
+	} else if out.LastModified != nil {
+		metadata.Timestamp = *out.LastModified
+	}
+
+	return metadata, nil
+}
+
+// unescapeS3Meta decodes metadata values, which are query-escaped since S3 only allows ASCII
+func unescapeS3Meta(value string) string {
+	if decoded, err := url.QueryUnescape(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// escapeS3Key escapes each path segment of a key for use in a copy source
+func escapeS3Key(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func isS3NotFound(err error) bool {
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	return errors.As(err, &notFound) || errors.As(err, &noSuchKey)
+}
+
+// isS3PreconditionFailed reports whether a conditional write lost to a concurrent one
+func isS3PreconditionFailed(err error) bool {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	status := respErr.HTTPStatusCode()
+	return status == http.StatusPreconditionFailed || status == http.StatusConflict
+}
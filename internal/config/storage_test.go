@@ -2,8 +2,10 @@ package config
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,6 +48,30 @@ func TestNewStorageBackend(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "vault backend without vault config",
+			cfg: &StorageConfig{
+				Type: "vault",
+			},
+			wantErr: true,
+		},
+		{
+			name: "vault backend with token",
+			cfg: &StorageConfig{
+				Type:  "vault",
+				Vault: &VaultStorageConfig{Address: "http://127.0.0.1:8200", Path: "port-authorizing", Token: "root"},
+			},
+			wantErr:  false,
+			wantType: "*config.VaultBackend",
+		},
+		{
+			name: "s3 backend without bucket",
+			cfg: &StorageConfig{
+				Type: "s3",
+				S3:   &S3StorageConfig{Region: "us-east-1"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "unsupported type",
 			cfg: &StorageConfig{
@@ -120,6 +146,59 @@ func TestFileBackend_LoadSaveRoundtrip(t *testing.T) {
 	}
 }
 
+func TestFileBackend_SaveIfVersion(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "test-config.yaml")
+	backend, err := NewFileBackend(configPath, 5)
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if version, err := backend.CurrentVersion(ctx); err != nil || version != "" {
+		t.Fatalf("CurrentVersion() on missing file = %q, %v, want empty", version, err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial"); err != nil {
+		t.Fatalf("SaveIfVersion() on missing file error = %v", err)
+	}
+
+	// Two admins read the same version; the second save must not clobber the first
+	read, err := backend.CurrentVersion(ctx)
+	if err != nil || read == "" {
+		t.Fatalf("CurrentVersion() = %q, %v", read, err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8082}}, read, "first admin"); err != nil {
+		t.Fatalf("SaveIfVersion() error = %v", err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, read, "second admin"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() with stale version error = %v, want ErrVersionConflict", err)
+	}
+
+	cfg, err := backend.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8082 {
+		t.Errorf("Load() port = %d, want 8082 (first save kept)", cfg.Server.Port)
+	}
+
+	versions, err := backend.ListVersions(ctx)
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	current, _ := backend.CurrentVersion(ctx)
+	if versions[0].ETag != current || current == read {
+		t.Errorf("current version ETag = %q, want %q (changed from %q)", versions[0].ETag, current, read)
+	}
+
+	// No temporary files are left behind by atomic writes
+	entries, _ := os.ReadDir(filepath.Dir(configPath))
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("leftover temporary file %s", entry.Name())
+		}
+	}
+}
+
 func TestFileBackend_Versioning(t *testing.T) {
 	// Create temporary directory
 	tmpDir := t.TempDir()
@@ -238,6 +317,40 @@ func TestFileBackend_Rollback(t *testing.T) {
 	}
 }
 
+func TestFileBackend_Watch(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("server:\n  port: 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := NewStorageBackend(&StorageConfig{Type: "file", Path: configPath, WatchInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewStorageBackend() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := backend.Watch(ctx)
+
+	// Give the watch time to read its baseline, then edit the file behind its back
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(configPath, []byte("server:\n  port: 9090\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-updates:
+		if cfg.Server.Port != 9090 {
+			t.Errorf("watched port = %d, want 9090", cfg.Server.Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not report the external edit")
+	}
+
+	cancel()
+	for range updates {
+	}
+}
+
 func BenchmarkFileBackend_Save(b *testing.B) {
 	tmpDir := b.TempDir()
 	configPath := filepath.Join(tmpDir, "bench-config.yaml")
@@ -0,0 +1,569 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VaultStorageConfig configures the Vault KV v2 storage backend
+type VaultStorageConfig struct {
+	Address      string `yaml:"address,omitempty"`       // Vault address (default: $VAULT_ADDR)
+	Mount        string `yaml:"mount,omitempty"`         // KV v2 mount (default: secret)
+	Path         string `yaml:"path"`                    // Secret path within the mount
+	Namespace    string `yaml:"namespace,omitempty"`     // Vault Enterprise namespace
+	AuthMethod   string `yaml:"auth_method,omitempty"`   // token (default) or approle
+	Token        string `yaml:"token,omitempty"`         // For token auth (default: $VAULT_TOKEN)
+	RoleID       string `yaml:"role_id,omitempty"`       // For approle auth (default: $VAULT_ROLE_ID)
+	SecretID     string `yaml:"secret_id,omitempty"`     // For approle auth (default: $VAULT_SECRET_ID)
+	AppRoleMount string `yaml:"approle_mount,omitempty"` // AppRole auth mount (default: approle)
+}
+
+// vaultConfigKey is the key holding the config YAML inside the KV secret
+const vaultConfigKey = "config.yaml"
+
+// VaultBackend implements StorageBackend using a HashiCorp Vault KV v2 secret.
+// Versioning is delegated to Vault; comment and author of each version are
+// kept in the secret's custom metadata as "v<N>-comment" and "v<N>-author".
+type VaultBackend struct {
+	client      *http.Client
+	address     string
+	mount       string
+	path        string
+	namespace   string
+	authMethod  string
+	roleID      string
+	secretID    string
+	appRoleAuth string
+	maxVersions int
+
+	mu    sync.Mutex
+	token string
+
+	pollWatcher
+}
+
+// NewVaultBackend creates a new Vault KV v2 storage backend
+func NewVaultBackend(cfg *VaultStorageConfig, maxVersions int) (*VaultBackend, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("vault configuration is required")
+	}
+
+	address := cfg.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+
+	path := strings.Trim(cfg.Path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("vault path is required")
+	}
+
+	mount := strings.Trim(cfg.Mount, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+
+	// Custom metadata is limited to 64 keys in Vault; two are used per version
+	if maxVersions <= 0 {
+		maxVersions = 5
+	}
+	if maxVersions > 32 {
+		return nil, fmt.Errorf("vault backend supports at most 32 versions")
+	}
+
+	b := &VaultBackend{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		address:     strings.TrimRight(address, "/"),
+		mount:       mount,
+		path:        path,
+		namespace:   cfg.Namespace,
+		authMethod:  cfg.AuthMethod,
+		maxVersions: maxVersions,
+	}
+
+	switch cfg.AuthMethod {
+	case "", "token":
+		b.authMethod = "token"
+		b.token = cfg.Token
+		if b.token == "" {
+			b.token = os.Getenv("VAULT_TOKEN")
+		}
+		if b.token == "" {
+			return nil, fmt.Errorf("vault token is required for token auth")
+		}
+
+	case "approle":
+		b.roleID = firstNonEmpty(cfg.RoleID, os.Getenv("VAULT_ROLE_ID"))
+		b.secretID = firstNonEmpty(cfg.SecretID, os.Getenv("VAULT_SECRET_ID"))
+		if b.roleID == "" || b.secretID == "" {
+			return nil, fmt.Errorf("vault role_id and secret_id are required for approle auth")
+		}
+		b.appRoleAuth = strings.Trim(cfg.AppRoleMount, "/")
+		if b.appRoleAuth == "" {
+			b.appRoleAuth = "approle"
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported vault auth method: %s", cfg.AuthMethod)
+	}
+
+	return b, nil
+}
+
+// Load reads the latest configuration version from Vault
+func (v *VaultBackend) Load(ctx context.Context) (*Config, error) {
+	return v.readVersion(ctx, 0)
+}
+
+// Save writes the configuration as a new KV version and records its metadata
+func (v *VaultBackend) Save(ctx context.Context, cfg *Config, comment string) error {
+	return v.save(ctx, cfg, nil, comment)
+}
+
+// SaveIfVersion saves the configuration only if the latest KV version is still
+// expectedVersion, using Vault's check-and-set
+func (v *VaultBackend) SaveIfVersion(ctx context.Context, cfg *Config, expectedVersion, comment string) error {
+	cas := 0
+	if expectedVersion != "" {
+		n, err := strconv.Atoi(expectedVersion)
+		if err != nil || n <= 0 {
+			return ErrVersionConflict
+		}
+		cas = n
+	}
+	return v.save(ctx, cfg, &cas, comment)
+}
+
+// CurrentVersion returns the latest KV version number ("" if the secret does not exist)
+func (v *VaultBackend) CurrentVersion(ctx context.Context) (string, error) {
+	meta, err := v.readMetadata(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if meta.CurrentVersion == 0 {
+		return "", nil
+	}
+	return strconv.Itoa(meta.CurrentVersion), nil
+}
+
+// save writes a new KV version; with cas set Vault rejects the write unless
+// the latest version is *cas (0 = the secret must not exist)
+func (v *VaultBackend) save(ctx context.Context, cfg *Config, cas *int, comment string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"data": map[string]string{vaultConfigKey: string(data)},
+	}
+	if cas != nil {
+		body["options"] = map[string]int{"cas": *cas}
+	}
+
+	var resp struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodPost, v.dataPath(), nil, body, &resp); err != nil {
+		if cas != nil && isVaultCASMismatch(err) {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+
+	if err := v.writeVersionMetadata(ctx, resp.Data.Version, comment, AuthorFromContext(ctx)); err != nil {
+		return fmt.Errorf("failed to write version metadata: %w", err)
+	}
+
+	return nil
+}
+
+// writeVersionMetadata stores comment/author for a version and drops entries
+// for versions Vault no longer keeps
+func (v *VaultBackend) writeVersionMetadata(ctx context.Context, version int, comment, author string) error {
+	meta, err := v.readMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldest := version - v.maxVersions + 1
+	custom := make(map[string]string)
+	for key, value := range meta.CustomMetadata {
+		if n, ok := parseVaultMetadataKey(key); ok && n < oldest {
+			continue
+		}
+		custom[key] = value
+	}
+	if comment != "" {
+		custom[fmt.Sprintf("v%d-comment", version)] = comment
+	}
+	if author != "" {
+		custom[fmt.Sprintf("v%d-author", version)] = author
+	}
+
+	body := map[string]interface{}{
+		"max_versions":    v.maxVersions,
+		"custom_metadata": custom,
+	}
+	return v.do(ctx, http.MethodPost, v.metadataPath(), nil, body, nil)
+}
+
+// ListVersions returns the current configuration followed by previous versions kept in Vault
+func (v *VaultBackend) ListVersions(ctx context.Context) ([]Version, error) {
+	meta, err := v.readMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	current := Version{
+		ID:        "current",
+		Timestamp: time.Now(),
+		Comment:   "Current configuration",
+	}
+	if meta.CurrentVersion > 0 {
+		current.ETag = strconv.Itoa(meta.CurrentVersion)
+	}
+	if info, ok := meta.Versions[strconv.Itoa(meta.CurrentVersion)]; ok {
+		current.Timestamp = info.CreatedTime
+		if comment := meta.CustomMetadata[fmt.Sprintf("v%d-comment", meta.CurrentVersion)]; comment != "" {
+			current.Comment = comment
+		}
+		current.Author = meta.CustomMetadata[fmt.Sprintf("v%d-author", meta.CurrentVersion)]
+	}
+
+	var numbers []int
+	for key, info := range meta.Versions {
+		n, err := strconv.Atoi(key)
+		if err != nil || n == meta.CurrentVersion || info.Destroyed || !info.DeletionTime.IsZero() {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+
+	// Newest first
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	versions := []Version{current}
+	for _, n := range numbers {
+		versions = append(versions, Version{
+			ID:        strconv.Itoa(n),
+			Timestamp: meta.Versions[strconv.Itoa(n)].CreatedTime,
+			Comment:   meta.CustomMetadata[fmt.Sprintf("v%d-comment", n)],
+			Author:    meta.CustomMetadata[fmt.Sprintf("v%d-author", n)],
+		})
+	}
+
+	return versions, nil
+}
+
+// LoadVersion loads a specific configuration version
+func (v *VaultBackend) LoadVersion(ctx context.Context, id string) (*Config, error) {
+	if id == "current" {
+		return v.Load(ctx)
+	}
+
+	version, err := strconv.Atoi(id)
+	if err != nil || version <= 0 {
+		return nil, fmt.Errorf("invalid version id: %s", id)
+	}
+
+	return v.readVersion(ctx, version)
+}
+
+// Rollback restores a previous configuration version as a new version
+func (v *VaultBackend) Rollback(ctx context.Context, id string) (*Config, error) {
+	cfg, err := v.LoadVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := fmt.Sprintf("Rolled back to version %s", id)
+	if err := v.Save(ctx, cfg, comment); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Watch polls for configuration changes, including edits made outside this process
+func (v *VaultBackend) Watch(ctx context.Context) <-chan *Config {
+	return v.poll(ctx, v)
+}
+
+// readVersion reads and parses a KV version (0 = latest)
+func (v *VaultBackend) readVersion(ctx context.Context, version int) (*Config, error) {
+	query := url.Values{}
+	if version > 0 {
+		query.Set("version", strconv.Itoa(version))
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, v.dataPath(), query, nil, &resp); err != nil {
+		if version > 0 {
+			return nil, fmt.Errorf("failed to read version %d: %w", version, err)
+		}
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	data, ok := resp.Data.Data[vaultConfigKey]
+	if !ok {
+		return nil, fmt.Errorf("secret has no %q key", vaultConfigKey)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+type vaultMetadata struct {
+	CurrentVersion int                          `json:"current_version"`
+	CustomMetadata map[string]string            `json:"custom_metadata"`
+	Versions       map[string]vaultVersionState `json:"versions"`
+}
+
+type vaultVersionState struct {
+	CreatedTime  time.Time `json:"created_time"`
+	DeletionTime time.Time `json:"deletion_time"`
+	Destroyed    bool      `json:"destroyed"`
+}
+
+// UnmarshalJSON tolerates the empty deletion_time string Vault returns for live versions
+func (s *vaultVersionState) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		CreatedTime  string `json:"created_time"`
+		DeletionTime string `json:"deletion_time"`
+		Destroyed    bool   `json:"destroyed"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.Destroyed = raw.Destroyed
+	if raw.CreatedTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw.CreatedTime)
+		if err != nil {
+			return err
+		}
+		s.CreatedTime = t
+	}
+	if raw.DeletionTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw.DeletionTime)
+		if err != nil {
+			return err
+		}
+		s.DeletionTime = t
+	}
+
+	return nil
+}
+
+// readMetadata reads the secret's metadata; a missing secret yields empty metadata
+func (v *VaultBackend) readMetadata(ctx context.Context) (*vaultMetadata, error) {
+	var resp struct {
+		Data vaultMetadata `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, v.metadataPath(), nil, nil, &resp); err != nil {
+		if isVaultNotFound(err) {
+			return &vaultMetadata{}, nil
+		}
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
+
+func (v *VaultBackend) dataPath() string {
+	return fmt.Sprintf("/v1/%s/data/%s", v.mount, v.path)
+}
+
+func (v *VaultBackend) metadataPath() string {
+	return fmt.Sprintf("/v1/%s/metadata/%s", v.mount, v.path)
+}
+
+// parseVaultMetadataKey extracts the version number from a "v<N>-<field>" key
+func parseVaultMetadataKey(key string) (int, bool) {
+	if !strings.HasPrefix(key, "v") {
+		return 0, false
+	}
+	number, _, found := strings.Cut(key[1:], "-")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// vaultError is an error response returned by the Vault API
+type vaultError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *vaultError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("vault returned status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+func isVaultNotFound(err error) bool {
+	verr, ok := err.(*vaultError)
+	return ok && verr.StatusCode == http.StatusNotFound
+}
+
+// isVaultCASMismatch reports whether a write was rejected by check-and-set
+func isVaultCASMismatch(err error) bool {
+	verr, ok := err.(*vaultError)
+	if !ok || verr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, message := range verr.Errors {
+		if strings.Contains(message, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// do performs an authenticated Vault API request. With AppRole auth the
+// token is obtained lazily and refreshed once if Vault rejects it.
+func (v *VaultBackend) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	token, err := v.currentToken(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	err = v.request(ctx, method, path, query, token, body, out)
+	if verr, ok := err.(*vaultError); ok && verr.StatusCode == http.StatusForbidden && v.authMethod == "approle" {
+		if token, err = v.currentToken(ctx, true); err != nil {
+			return err
+		}
+		err = v.request(ctx, method, path, query, token, body, out)
+	}
+
+	return err
+}
+
+// currentToken returns the Vault token, logging in via AppRole when needed
+func (v *VaultBackend) currentToken(ctx context.Context, refresh bool) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.authMethod != "approle" || (v.token != "" && !refresh) {
+		return v.token, nil
+	}
+
+	body := map[string]string{
+		"role_id":   v.roleID,
+		"secret_id": v.secretID,
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := v.request(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", v.appRoleAuth), nil, "", body, &resp); err != nil {
+		return "", fmt.Errorf("approle login failed: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("approle login returned no token")
+	}
+
+	v.token = resp.Auth.ClientToken
+	return v.token, nil
+}
+
+// request sends a single Vault API request and decodes the JSON response into out
+func (v *VaultBackend) request(ctx context.Context, method, path string, query url.Values, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	target := v.address + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		verr := &vaultError{StatusCode: resp.StatusCode}
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil {
+			verr.Errors = errResp.Errors
+		}
+		return verr
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault is a minimal in-memory KV v2 engine mounted at "kv" with AppRole auth
+type fakeVault struct {
+	mu          sync.Mutex
+	versions    []string // config data, index = version-1
+	created     []time.Time
+	custom      map[string]string
+	maxVersions int
+	tokens      map[string]bool
+	logins      int
+	namespace   string
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	fv := &fakeVault{custom: map[string]string{}, tokens: map[string]bool{"root": true}}
+	srv := httptest.NewServer(http.HandlerFunc(fv.serve))
+	t.Cleanup(srv.Close)
+	return fv, srv
+}
+
+func (fv *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	fv.namespace = r.Header.Get("X-Vault-Namespace")
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			writeFakeVault(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		fv.logins++
+		token := "approle-token-" + strconv.Itoa(fv.logins)
+		fv.tokens[token] = true
+		writeFakeVault(w, http.StatusOK, map[string]interface{}{"auth": map[string]string{"client_token": token}})
+		return
+	}
+
+	if !fv.tokens[r.Header.Get("X-Vault-Token")] {
+		writeFakeVault(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/kv/data/port-authorizing" && r.Method == http.MethodGet:
+		version := len(fv.versions)
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, _ = strconv.Atoi(v)
+		}
+		if version < 1 || version > len(fv.versions) || fv.versions[version-1] == "" {
+			writeFakeVault(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		writeFakeVault(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"data": map[string]string{"config.yaml": fv.versions[version-1]}},
+		})
+
+	case r.URL.Path == "/v1/kv/data/port-authorizing" && r.Method == http.MethodPost:
+		var body struct {
+			Data    map[string]string `json:"data"`
+			Options map[string]int    `json:"options"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if cas, ok := body.Options["cas"]; ok && cas != len(fv.versions) {
+			writeFakeVault(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+		fv.versions = append(fv.versions, body.Data["config.yaml"])
+		fv.created = append(fv.created, time.Now().UTC())
+		// Forget versions beyond max_versions, like Vault does
+		if fv.maxVersions > 0 {
+			for i := 0; i < len(fv.versions)-fv.maxVersions; i++ {
+				fv.versions[i] = ""
+			}
+		}
+		writeFakeVault(w, http.StatusOK, map[string]interface{}{"data": map[string]int{"version": len(fv.versions)}})
+
+	case r.URL.Path == "/v1/kv/metadata/port-authorizing" && r.Method == http.MethodGet:
+		if len(fv.versions) == 0 {
+			writeFakeVault(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		versions := map[string]interface{}{}
+		for i, data := range fv.versions {
+			if data == "" {
+				continue
+			}
+			versions[strconv.Itoa(i+1)] = map[string]interface{}{
+				"created_time":  fv.created[i].Format(time.RFC3339Nano),
+				"deletion_time": "",
+				"destroyed":     false,
+			}
+		}
+		writeFakeVault(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"current_version": len(fv.versions),
+			"custom_metadata": fv.custom,
+			"versions":        versions,
+		}})
+
+	case r.URL.Path == "/v1/kv/metadata/port-authorizing" && r.Method == http.MethodPost:
+		var body struct {
+			MaxVersions    int               `json:"max_versions"`
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		fv.maxVersions = body.MaxVersions
+		fv.custom = body.CustomMetadata
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeFakeVault(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func writeFakeVault(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestVaultBackend_SaveLoadVersions(t *testing.T) {
+	fv, srv := newFakeVault(t)
+
+	backend, err := NewVaultBackend(&VaultStorageConfig{
+		Address:   srv.URL,
+		Mount:     "kv",
+		Path:      "port-authorizing",
+		Token:     "root",
+		Namespace: "team-a",
+	}, 2)
+	if err != nil {
+		t.Fatalf("NewVaultBackend() error = %v", err)
+	}
+
+	ctx := WithAuthor(context.Background(), "alice")
+	for port := 8081; port <= 8083; port++ {
+		cfg := &Config{Server: ServerConfig{Port: port}}
+		if err := backend.Save(ctx, cfg, "set port "+strconv.Itoa(port)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	if fv.namespace != "team-a" {
+		t.Errorf("X-Vault-Namespace = %q, want team-a", fv.namespace)
+	}
+
+	cfg, err := backend.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8083 {
+		t.Errorf("Load() port = %d, want 8083", cfg.Server.Port)
+	}
+
+	versions, err := backend.ListVersions(context.Background())
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("ListVersions() returned %d versions, want 2: %+v", len(versions), versions)
+	}
+	if versions[0].ID != "current" || versions[0].Comment != "set port 8083" || versions[0].Author != "alice" {
+		t.Errorf("current version = %+v", versions[0])
+	}
+	if versions[1].ID != "2" || versions[1].Comment != "set port 8082" || versions[1].Author != "alice" {
+		t.Errorf("previous version = %+v", versions[1])
+	}
+
+	// Metadata for versions Vault no longer keeps is pruned
+	if _, ok := fv.custom["v1-comment"]; ok {
+		t.Errorf("custom metadata still contains pruned version: %v", fv.custom)
+	}
+
+	previous, err := backend.LoadVersion(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("LoadVersion() error = %v", err)
+	}
+	if previous.Server.Port != 8082 {
+		t.Errorf("LoadVersion(2) port = %d, want 8082", previous.Server.Port)
+	}
+
+	if _, err := backend.LoadVersion(context.Background(), "abc"); err == nil {
+		t.Error("LoadVersion() with invalid id should fail")
+	}
+
+	restored, err := backend.Rollback(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if restored.Server.Port != 8082 {
+		t.Errorf("Rollback() port = %d, want 8082", restored.Server.Port)
+	}
+	if got := fv.custom["v4-comment"]; got != "Rolled back to version 2" {
+		t.Errorf("rollback comment = %q", got)
+	}
+}
+
+func TestVaultBackend_SaveIfVersion(t *testing.T) {
+	_, srv := newFakeVault(t)
+
+	backend, err := NewVaultBackend(&VaultStorageConfig{Address: srv.URL, Mount: "kv", Path: "port-authorizing", Token: "root"}, 5)
+	if err != nil {
+		t.Fatalf("NewVaultBackend() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if version, err := backend.CurrentVersion(ctx); err != nil || version != "" {
+		t.Fatalf("CurrentVersion() on missing secret = %q, %v, want empty", version, err)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8081}}, "", "initial"); err != nil {
+		t.Fatalf("SaveIfVersion() on missing secret error = %v", err)
+	}
+	if err := backend.Save(ctx, &Config{Server: ServerConfig{Port: 8082}}, "concurrent"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, "1", "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("SaveIfVersion() with stale version error = %v, want ErrVersionConflict", err)
+	}
+
+	versions, err := backend.ListVersions(ctx)
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+	if versions[0].ETag != "2" {
+		t.Fatalf("current version ETag = %q, want 2", versions[0].ETag)
+	}
+	if err := backend.SaveIfVersion(ctx, &Config{Server: ServerConfig{Port: 8083}}, versions[0].ETag, "fresh"); err != nil {
+		t.Fatalf("SaveIfVersion() with current version error = %v", err)
+	}
+	if version, _ := backend.CurrentVersion(ctx); version != "3" {
+		t.Errorf("CurrentVersion() = %q, want 3", version)
+	}
+}
+
+func TestVaultBackend_AppRole(t *testing.T) {
+	fv, srv := newFakeVault(t)
+
+	backend, err := NewVaultBackend(&VaultStorageConfig{
+		Address:    srv.URL,
+		Mount:      "kv",
+		Path:       "port-authorizing",
+		AuthMethod: "approle",
+		RoleID:     "role",
+		SecretID:   "secret",
+	}, 5)
+	if err != nil {
+		t.Fatalf("NewVaultBackend() error = %v", err)
+	}
+
+	if err := backend.Save(context.Background(), &Config{Server: ServerConfig{Port: 9000}}, "initial"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if fv.logins != 1 {
+		t.Errorf("logins = %d, want 1", fv.logins)
+	}
+
+	// Revoke the token; the backend should log in again and retry
+	fv.mu.Lock()
+	fv.tokens = map[string]bool{}
+	fv.mu.Unlock()
+
+	cfg, err := backend.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() after token revocation error = %v", err)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("Load() port = %d, want 9000", cfg.Server.Port)
+	}
+	if fv.logins != 2 {
+		t.Errorf("logins = %d, want 2", fv.logins)
+	}
+}
+
+func TestNewVaultBackend_Errors(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "")
+	t.Setenv("VAULT_SECRET_ID", "")
+
+	tests := []struct {
+		name string
+		cfg  *VaultStorageConfig
+	}{
+		{"missing address", &VaultStorageConfig{Path: "p", Token: "t"}},
+		{"missing path", &VaultStorageConfig{Address: "http://vault", Token: "t"}},
+		{"missing token", &VaultStorageConfig{Address: "http://vault", Path: "p"}},
+		{"missing approle secret", &VaultStorageConfig{Address: "http://vault", Path: "p", AuthMethod: "approle", RoleID: "r"}},
+		{"unknown auth method", &VaultStorageConfig{Address: "http://vault", Path: "p", AuthMethod: "ldap"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVaultBackend(tt.cfg, 5); err == nil {
+				t.Error("NewVaultBackend() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagExpression is a policy tag matcher evaluated against a connection's tags
+// Connection tags are "key:value" (or "key=value") pairs or plain strings. Supported forms:
+//
+//	env:prod             tag equals env:prod (plain tags match exactly)
+//	team=backend         key team has value backend
+//	env in [prod,dev]    key env has one of the listed values
+//	!env:prod            negation of any of the above
+type TagExpression struct {
+	Raw    string   // Expression as written in the policy
+	Negate bool     // Leading "!"
+	Key    string   // Tag key ("" for a plain tag)
+	Values []string // Accepted values (the whole tag for a plain tag)
+}
+
+// ParseTagExpression parses a policy tag expression
+func ParseTagExpression(expr string) (TagExpression, error) {
+	parsed := TagExpression{Raw: expr}
+	body := strings.TrimSpace(expr)
+	if strings.HasPrefix(body, "!") {
+		parsed.Negate = true
+		body = strings.TrimSpace(body[1:])
+	}
+	if body == "" {
+		return parsed, fmt.Errorf("empty tag expression %q", expr)
+	}
+
+	// key in [v1, v2]
+	if key, list, found := cutFold(body, " in "); found {
+		key, list = strings.TrimSpace(key), strings.TrimSpace(list)
+		if key == "" || !strings.HasPrefix(list, "[") || !strings.HasSuffix(list, "]") {
+			return parsed, fmt.Errorf("invalid tag expression %q: want \"key in [value, ...]\"", expr)
+		}
+		for _, value := range strings.Split(list[1:len(list)-1], ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				parsed.Values = append(parsed.Values, value)
+			}
+		}
+		if len(parsed.Values) == 0 {
+			return parsed, fmt.Errorf("invalid tag expression %q: empty value list", expr)
+		}
+		parsed.Key = key
+		return parsed, nil
+	}
+
+	// key=value or key:value
+	if key, value, ok := splitTag(body); ok {
+		parsed.Key, parsed.Values = key, []string{value}
+		return parsed, nil
+	}
+
+	parsed.Values = []string{body}
+	return parsed, nil
+}
+
+// Matches reports whether the expression holds for a connection's tags
+func (e TagExpression) Matches(tags []string) bool {
+	return e.matchesAny(tags) != e.Negate
+}
+
+// matchesAny reports whether any tag satisfies the expression, ignoring negation
+func (e TagExpression) matchesAny(tags []string) bool {
+	for _, tag := range tags {
+		if e.Key == "" {
+			if tag == e.Values[0] {
+				return true
+			}
+			continue
+		}
+		key, value, ok := splitTag(tag)
+		if !ok || key != e.Key {
+			continue
+		}
+		for _, accepted := range e.Values {
+			if value == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TagMatchResult explains how a policy's tag expressions evaluated against a connection
+type TagMatchResult struct {
+	Matched   bool     `json:"matched"`
+	Satisfied []string `json:"satisfied,omitempty"` // Expressions that held
+	Failed    []string `json:"failed,omitempty"`    // Expressions that did not hold (or are invalid)
+}
+
+// MatchTags evaluates policy tag expressions against a connection's tags
+// Positive expressions combine per tagMatch ("all", the default, or "any"); negated
+// expressions are exclusions that must always hold. Invalid expressions never match.
+func MatchTags(expressions []string, tagMatch string, tags []string) TagMatchResult {
+	var result TagMatchResult
+	positives, positivesHeld := 0, 0
+	exclusionsHeld := true
+
+	for _, raw := range expressions {
+		expr, err := ParseTagExpression(raw)
+		held := err == nil && expr.Matches(tags)
+		if held {
+			result.Satisfied = append(result.Satisfied, raw)
+		} else {
+			result.Failed = append(result.Failed, raw)
+		}
+
+		if err == nil && expr.Negate {
+			exclusionsHeld = exclusionsHeld && held
+			continue
+		}
+		positives++
+		if held {
+			positivesHeld++
+		}
+	}
+
+	switch {
+	case !exclusionsHeld:
+		result.Matched = false
+	case positives == 0:
+		result.Matched = len(expressions) > 0
+	case tagMatch == "any":
+		result.Matched = positivesHeld > 0
+	default:
+		result.Matched = positivesHeld == positives
+	}
+	return result
+}
+
+// splitTag splits a "key:value" or "key=value" tag at the first separator
+func splitTag(tag string) (string, string, bool) {
+	i := strings.IndexAny(tag, ":=")
+	if i <= 0 || i == len(tag)-1 {
+		return "", "", false
+	}
+	return tag[:i], tag[i+1:], true
+}
+
+// cutFold is strings.Cut with a case-insensitive separator. It compares slices of s
+// itself: lowercasing s first can change its byte length and misplace the cut.
+func cutFold(s, sep string) (string, string, bool) {
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(sep)], sep) {
+			return s[:i], s[i+len(sep):], true
+		}
+	}
+	return s, "", false
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagExpression(t *testing.T) {
+	tests := []struct {
+		expr       string
+		wantNegate bool
+		wantKey    string
+		wantValues string
+		wantErr    bool
+	}{
+		{"env:prod", false, "env", "prod", false},
+		{"team=backend", false, "team", "backend", false},
+		{"env in [prod, staging]", false, "env", "prod,staging", false},
+		{"!env IN [prod]", true, "env", "prod", false},
+		{"! team=legacy", true, "team", "legacy", false},
+		{"pci", false, "", "pci", false},
+		{"!", false, "", "", true},
+		{"env in prod", false, "", "", true},
+		{"env in []", false, "", "", true},
+		// Lowercasing Ⱥ shrinks it by a byte; the cut must still land on " in "
+		{"ȺȺȺȺȺȺȺȺ in [a]", false, "ȺȺȺȺȺȺȺȺ", "a", false},
+		{"Ⱥ IN [a, b]", false, "Ⱥ", "a,b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseTagExpression(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTagExpression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if expr.Negate != tt.wantNegate || expr.Key != tt.wantKey || strings.Join(expr.Values, ",") != tt.wantValues {
+				t.Errorf("ParseTagExpression() = %+v, want negate=%v key=%q values=%q", expr, tt.wantNegate, tt.wantKey, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	prodBackend := []string{"env:prod", "team=backend", "pci"}
+
+	tests := []struct {
+		name          string
+		expressions   []string
+		tagMatch      string
+		tags          []string
+		want          bool
+		wantSatisfied string
+	}{
+		{"plain tags all", []string{"env:prod", "pci"}, "", prodBackend, true, "env:prod,pci"},
+		{"plain tags all missing one", []string{"env:prod", "env:dev"}, "all", prodBackend, false, "env:prod"},
+		{"plain tags any", []string{"env:dev", "pci"}, "any", prodBackend, true, "pci"},
+		{"separators are interchangeable", []string{"env=prod", "team:backend"}, "all", prodBackend, true, "env=prod,team:backend"},
+		{"in list", []string{"env in [staging, prod]"}, "all", prodBackend, true, "env in [staging, prod]"},
+		{"in list no match", []string{"env in [staging,dev]"}, "all", prodBackend, false, ""},
+		{"value must match whole", []string{"env=pro"}, "all", prodBackend, false, ""},
+		{"negation excludes", []string{"team=backend", "!env:prod"}, "all", prodBackend, false, "team=backend"},
+		{"negation holds", []string{"team=backend", "!env in [dev,staging]"}, "all", prodBackend, true, "team=backend,!env in [dev,staging]"},
+		{"negation applies in any mode", []string{"env:dev", "pci", "!team=backend"}, "any", prodBackend, false, "pci"},
+		{"only negations", []string{"!env:dev"}, "all", prodBackend, true, "!env:dev"},
+		{"invalid expression never matches", []string{"env in prod"}, "any", prodBackend, false, ""},
+		{"no expressions", nil, "all", prodBackend, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := MatchTags(tt.expressions, tt.tagMatch, tt.tags)
+			if result.Matched != tt.want {
+				t.Errorf("MatchTags() matched = %v, want %v (%+v)", result.Matched, tt.want, result)
+			}
+			if got := strings.Join(result.Satisfied, ","); got != tt.wantSatisfied {
+				t.Errorf("MatchTags() satisfied = %q, want %q", got, tt.wantSatisfied)
+			}
+			if len(result.Satisfied)+len(result.Failed) != len(tt.expressions) {
+				t.Errorf("MatchTags() explained %d of %d expressions", len(result.Satisfied)+len(result.Failed), len(tt.expressions))
+			}
+		})
+	}
+}
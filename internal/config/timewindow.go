@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps accepted day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeWindowWhitelist grants whitelist patterns only during a recurring time window
+// Windows with end <= start wrap past midnight (e.g., 22:00-06:00)
+type TimeWindowWhitelist struct {
+	Name      string   `yaml:"name,omitempty" json:"name,omitempty"`         // Window name (shown in audit logs)
+	Days      []string `yaml:"days,omitempty" json:"days,omitempty"`         // mon, tue, ... sun (default: every day)
+	Start     string   `yaml:"start,omitempty" json:"start,omitempty"`       // HH:MM (default: 00:00)
+	End       string   `yaml:"end,omitempty" json:"end,omitempty"`           // HH:MM (default: 24:00)
+	Timezone  string   `yaml:"timezone,omitempty" json:"timezone,omitempty"` // IANA timezone (default: UTC)
+	Whitelist []string `yaml:"whitelist" json:"whitelist"`                   // Patterns allowed during the window
+}
+
+// Active reports whether the window contains the given time
+func (w *TimeWindowWhitelist) Active(now time.Time) (bool, error) {
+	return w.schedule().Active(now)
+}
+
+// Validate checks the window's days, times and timezone
+func (w *TimeWindowWhitelist) Validate() error {
+	return w.schedule().Validate()
+}
+
+// Describe returns a short human-readable description of the window
+func (w *TimeWindowWhitelist) Describe() string {
+	desc := w.schedule().Describe()
+	if w.Name != "" {
+		desc = fmt.Sprintf("%s (%s)", w.Name, desc)
+	}
+	return desc
+}
+
+// schedule returns the window's recurring time range
+func (w *TimeWindowWhitelist) schedule() *Schedule {
+	return &Schedule{Days: w.Days, Start: w.Start, End: w.End, Timezone: w.Timezone}
+}
+
+// Schedule is a recurring weekly time window (e.g., business hours)
+// Windows with end <= start wrap past midnight. Wall-clock times are evaluated in
+// Timezone, so windows follow daylight saving changes.
+type Schedule struct {
+	Days     []string `yaml:"days,omitempty" json:"days,omitempty"`         // mon, tue, ... sun (default: every day)
+	Start    string   `yaml:"start,omitempty" json:"start,omitempty"`       // HH:MM (default: 00:00)
+	End      string   `yaml:"end,omitempty" json:"end,omitempty"`           // HH:MM (default: 24:00)
+	Timezone string   `yaml:"timezone,omitempty" json:"timezone,omitempty"` // IANA timezone (default: UTC)
+}
+
+// Active reports whether the schedule contains the given time
+func (s *Schedule) Active(now time.Time) (bool, error) {
+	loc := time.UTC
+	if s.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return false, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	start, err := parseClock(s.Start, 0)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(s.End, 24*60)
+	if err != nil {
+		return false, err
+	}
+	days, err := parseDays(s.Days)
+	if err != nil {
+		return false, err
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+	yesterday := (today + 6) % 7
+
+	dayAllowed := func(d time.Weekday) bool {
+		return len(days) == 0 || days[d]
+	}
+
+	if start < end {
+		return dayAllowed(today) && minute >= start && minute < end, nil
+	}
+
+	// Wraps past midnight: the early-morning part belongs to the previous day's window
+	return (dayAllowed(today) && minute >= start) || (dayAllowed(yesterday) && minute < end), nil
+}
+
+// Validate checks the schedule's days, times and timezone
+func (s *Schedule) Validate() error {
+	_, err := s.Active(time.Now())
+	return err
+}
+
+// Describe returns a short human-readable description of the schedule
+func (s *Schedule) Describe() string {
+	days := "daily"
+	if len(s.Days) > 0 {
+		days = strings.Join(s.Days, ",")
+	}
+	start, end := s.Start, s.End
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "24:00"
+	}
+	tz := s.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s %s-%s %s", days, start, end, tz)
+}
+
+// parseClock parses HH:MM into minutes since midnight
+func parseClock(value string, defaultMinutes int) (int, error) {
+	if value == "" {
+		return defaultMinutes, nil
+	}
+
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil || len(value) != len("15:04") {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDays converts day names into a weekday set
+func parseDays(names []string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		day, ok := weekdays[key]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q (expected mon, tue, wed, thu, fri, sat, sun)", name)
+		}
+		days[day] = true
+	}
+	return days, nil
+}
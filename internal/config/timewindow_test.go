@@ -0,0 +1,130 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowWhitelist_Active(t *testing.T) {
+	// Wednesday 2025-01-15
+	at := func(hour, minute int, loc *time.Location) time.Time {
+		return time.Date(2025, 1, 15, hour, minute, 0, 0, loc)
+	}
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		window TimeWindowWhitelist
+		now    time.Time
+		want   bool
+	}{
+		{"inside business hours", TimeWindowWhitelist{Start: "09:00", End: "18:00"}, at(10, 0, time.UTC), true},
+		{"before start", TimeWindowWhitelist{Start: "09:00", End: "18:00"}, at(8, 59, time.UTC), false},
+		{"end is exclusive", TimeWindowWhitelist{Start: "09:00", End: "18:00"}, at(18, 0, time.UTC), false},
+		{"allowed day", TimeWindowWhitelist{Days: []string{"mon", "wed"}}, at(12, 0, time.UTC), true},
+		{"excluded day", TimeWindowWhitelist{Days: []string{"sat", "Sunday"}}, at(12, 0, time.UTC), false},
+		{"timezone applied", TimeWindowWhitelist{Start: "09:00", End: "18:00", Timezone: "Europe/Madrid"}, at(8, 30, time.UTC), true},
+		{"timezone applied outside", TimeWindowWhitelist{Start: "09:00", End: "18:00", Timezone: "Europe/Madrid"}, at(17, 30, time.UTC), false},
+		{"overnight late part", TimeWindowWhitelist{Start: "22:00", End: "06:00"}, at(23, 0, time.UTC), true},
+		{"overnight early part", TimeWindowWhitelist{Start: "22:00", End: "06:00"}, at(5, 0, time.UTC), true},
+		{"overnight outside", TimeWindowWhitelist{Start: "22:00", End: "06:00"}, at(12, 0, time.UTC), false},
+		// Tuesday night window still active early Wednesday
+		{"overnight uses previous day", TimeWindowWhitelist{Days: []string{"tue"}, Start: "22:00", End: "06:00"}, at(5, 0, time.UTC), true},
+		{"local time in window timezone", TimeWindowWhitelist{Start: "09:00", End: "10:00", Timezone: "Europe/Madrid"}, at(9, 30, madrid), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.window.Active(tt.now)
+			if err != nil {
+				t.Fatalf("Active() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindowWhitelist_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  TimeWindowWhitelist
+		wantErr bool
+	}{
+		{"defaults", TimeWindowWhitelist{}, false},
+		{"full day", TimeWindowWhitelist{Start: "00:00", End: "24:00"}, false},
+		{"bad time", TimeWindowWhitelist{Start: "9am"}, true},
+		{"out of range", TimeWindowWhitelist{End: "25:00"}, true},
+		{"bad day", TimeWindowWhitelist{Days: []string{"funday"}}, true},
+		{"bad timezone", TimeWindowWhitelist{Timezone: "Mars/Olympus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimeWindowWhitelist_Describe(t *testing.T) {
+	window := TimeWindowWhitelist{Name: "writes", Days: []string{"mon", "fri"}, Start: "09:00", End: "18:00", Timezone: "Europe/Madrid"}
+	want := "writes (mon,fri 09:00-18:00 Europe/Madrid)"
+	if got := window.Describe(); got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+
+	if got := (&TimeWindowWhitelist{}).Describe(); got != "daily 00:00-24:00 UTC" {
+		t.Errorf("Describe() = %q, want defaults", got)
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	businessHours := Schedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00", Timezone: "America/New_York"}
+	tokyo := Schedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00", Timezone: "Asia/Tokyo"}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		now      time.Time
+		want     bool
+	}{
+		// New York is UTC-5 in winter and UTC-4 in summer
+		{"winter open", businessHours, time.Date(2026, 1, 14, 14, 0, 0, 0, time.UTC), true},
+		{"winter before open", businessHours, time.Date(2026, 1, 14, 13, 59, 0, 0, time.UTC), false},
+		{"summer open", businessHours, time.Date(2026, 7, 15, 13, 0, 0, 0, time.UTC), true},
+		{"summer closed", businessHours, time.Date(2026, 7, 15, 21, 0, 0, 0, time.UTC), false},
+		// DST starts Sunday 2026-03-08; Monday 2026-03-09 opens at 13:00 UTC
+		{"first day of DST open", businessHours, time.Date(2026, 3, 9, 13, 0, 0, 0, time.UTC), true},
+		{"last day before DST closed at same UTC", businessHours, time.Date(2026, 3, 6, 13, 0, 0, 0, time.UTC), false},
+		// DST ends Sunday 2026-11-01; Monday 2026-11-02 closes at 22:00 UTC
+		{"first day after DST still open", businessHours, time.Date(2026, 11, 2, 21, 30, 0, 0, time.UTC), true},
+		{"friday before DST end closed", businessHours, time.Date(2026, 10, 30, 21, 30, 0, 0, time.UTC), false},
+		// Friday 23:30 UTC is already Saturday in Tokyo
+		{"weekday in utc, weekend locally", tokyo, time.Date(2026, 1, 16, 23, 30, 0, 0, time.UTC), false},
+		// Sunday 23:30 UTC is Monday 08:30 in Tokyo, Monday 00:30 UTC is 09:30
+		{"weekend in utc, before open locally", tokyo, time.Date(2026, 1, 18, 23, 30, 0, 0, time.UTC), false},
+		{"weekend in utc, open locally", tokyo, time.Date(2026, 1, 19, 0, 30, 0, 0, time.UTC), true},
+		{"default is always", Schedule{}, time.Date(2026, 1, 18, 3, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.schedule.Active(tt.now)
+			if err != nil {
+				t.Fatalf("Active() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Active(%s) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
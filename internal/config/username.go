@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// usernameFolder case-folds usernames for uniqueness checks and login lookup
+var usernameFolder = cases.Fold()
+
+// NormalizeUsername trims surrounding whitespace and NFC-normalizes a local
+// username, rejecting empty names and names containing control or invisible
+// formatting characters
+func NormalizeUsername(username string) (string, error) {
+	normalized := norm.NFC.String(strings.TrimSpace(username))
+	if normalized == "" {
+		return "", fmt.Errorf("username is empty")
+	}
+	for _, r := range normalized {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return "", fmt.Errorf("username %q contains a control character", username)
+		}
+	}
+	return normalized, nil
+}
+
+// UsernameKey returns the case-insensitive identity of a username: two local
+// users with the same key are the same user
+func UsernameKey(username string) string {
+	return usernameFolder.String(norm.NFC.String(strings.TrimSpace(username)))
+}
+
+// SameUsername reports whether two usernames identify the same local user
+func SameUsername(a, b string) bool {
+	return UsernameKey(a) == UsernameKey(b)
+}
@@ -0,0 +1,54 @@
+package config
+
+import "testing"
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"alice", "alice", false},
+		{"  alice\t", "alice", false},
+		{"Zoë", "Zoë", false},
+		{"Zoe\u0308", "Zo\u00eb", false}, // Decomposed diaeresis is composed (NFC)
+		{"", "", true},
+		{" \t ", "", true},
+		{"ali\nce", "", true},
+		{"ali\u200bce", "", true}, // Zero-width space
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizeUsername(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeUsername(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeUsername(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameUsername(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"admin", "Admin", true},
+		{"admin", " ADMIN ", true},
+		{"Zoë", "ZOË", true},
+		{"Zoe\u0308", "zo\u00eb", true},
+		{"straße", "STRASSE", true},
+		{"ΣΊΣΥΦΟΣ", "σίσυφος", true},
+		{"alice", "alicia", false},
+		{"zoe", "zoë", false},
+	}
+
+	for _, tt := range tests {
+		if got := SameUsername(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameUsername(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
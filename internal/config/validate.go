@@ -0,0 +1,708 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ValidationError describes a single configuration problem
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors is the list of problems found by Validate
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d configuration problem(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+// validator collects problems while walking a config
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks a configuration for problems that would otherwise only surface at runtime.
+// Returns nil if the config is valid, or ValidationErrors listing every problem found.
+func Validate(cfg *Config) error {
+	if cfg == nil {
+		return ValidationErrors{{Field: "config", Message: "config is empty"}}
+	}
+
+	v := &validator{}
+	v.validateServer(cfg)
+	v.validateAuth(cfg)
+	v.validateConnections(cfg)
+	v.validatePolicies(cfg)
+	v.validateLogging(cfg)
+	v.validateSecurity(cfg)
+	v.validateApproval(cfg)
+	v.validateStorage(cfg)
+	v.validateObservability(cfg)
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (v *validator) validateServer(cfg *Config) {
+	if cfg.Server.Port < 0 || cfg.Server.Port > 65535 {
+		v.add("server.port", "port %d out of range (1-65535)", cfg.Server.Port)
+	}
+	if cfg.Server.MaxConnectionDuration < 0 {
+		v.add("server.max_connection_duration", "must not be negative")
+	}
+	if cfg.Server.RequestTimeout < 0 {
+		v.add("server.request_timeout", "must not be negative")
+	}
+	if cfg.Server.IdleTimeout < 0 {
+		v.add("server.idle_timeout", "must not be negative")
+	}
+	if cfg.Server.MaxBytesIn < 0 {
+		v.add("server.max_bytes_in", "must not be negative")
+	}
+	if cfg.Server.MaxBytesOut < 0 {
+		v.add("server.max_bytes_out", "must not be negative")
+	}
+	if cfg.Server.MaxRequestBytes < 0 {
+		v.add("server.max_request_bytes", "must not be negative")
+	}
+	if cfg.Server.MaxConcurrentConnections < 0 {
+		v.add("server.max_concurrent_connections", "must not be negative")
+	}
+	if cfg.Server.HTTP.ReadTimeout < 0 {
+		v.add("server.http.read_timeout", "must not be negative")
+	}
+	if cfg.Server.HTTP.WriteTimeout < 0 {
+		v.add("server.http.write_timeout", "must not be negative")
+	}
+	if cfg.Server.HTTP.IdleTimeout < 0 {
+		v.add("server.http.idle_timeout", "must not be negative")
+	}
+	if cfg.Server.HTTP.MaxHeaderBytes < 0 {
+		v.add("server.http.max_header_bytes", "must not be negative")
+	}
+	if cfg.Server.WebSocketPingInterval < 0 || cfg.Server.WebSocketPingInterval >= 60*time.Second {
+		v.add("server.websocket_ping_interval", "must be between 0 and 60s (the CLI's read deadline)")
+	}
+	for i, entry := range cfg.Server.TrustedProxies {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				v.add(fmt.Sprintf("server.trusted_proxies[%d]", i), "invalid CIDR %q", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			v.add(fmt.Sprintf("server.trusted_proxies[%d]", i), "invalid IP %q", entry)
+		}
+	}
+}
+
+func (v *validator) validateAuth(cfg *Config) {
+	if cfg.Auth.JWTSecret == "" {
+		v.add("auth.jwt_secret", "is required")
+	}
+	for i, secret := range cfg.Auth.JWTSecrets {
+		if secret == "" {
+			v.add(fmt.Sprintf("auth.jwt_secrets[%d]", i), "must not be empty")
+		}
+	}
+	if cfg.Auth.TokenRenewalWindow < 0 {
+		v.add("auth.token_renewal_window", "must not be negative")
+	}
+	lockout := cfg.Auth.Lockout
+	if lockout.MaxFailures < 0 {
+		v.add("auth.lockout.max_failures", "must not be negative")
+	}
+	if lockout.Window < 0 {
+		v.add("auth.lockout.window", "must not be negative")
+	}
+	if lockout.LockoutDuration < 0 {
+		v.add("auth.lockout.lockout_duration", "must not be negative")
+	}
+	if lockout.Backoff < 0 {
+		v.add("auth.lockout.backoff", "must not be negative")
+	}
+	if lockout.MaxTracked < 0 {
+		v.add("auth.lockout.max_tracked", "must not be negative")
+	}
+
+	providerNames := make(map[string]bool)
+	for i, provider := range cfg.Auth.Providers {
+		field := fmt.Sprintf("auth.providers[%d]", i)
+		if provider.Name == "" {
+			v.add(field+".name", "is required")
+		} else if providerNames[provider.Name] {
+			v.add(field+".name", "duplicate provider name %q", provider.Name)
+		}
+		providerNames[provider.Name] = true
+
+		switch provider.Type {
+		case "local", "oidc", "saml2", "ldap":
+		default:
+			v.add(field+".type", "unknown provider type %q (local, oidc, saml2, ldap)", provider.Type)
+		}
+		if len(provider.RoleMappings) > 0 && provider.Type != "oidc" {
+			v.add(field+".role_mappings", "role mappings are only supported for oidc providers")
+		}
+		for group, role := range provider.RoleMappings {
+			if strings.TrimSpace(role) == "" {
+				v.add(field+".role_mappings", "group %q maps to an empty role", group)
+			}
+		}
+	}
+
+	usernames := make(map[string]bool)
+	for i, user := range cfg.Auth.Users {
+		field := fmt.Sprintf("auth.users[%d]", i)
+		if user.Username == "" {
+			v.add(field+".username", "is required")
+			continue
+		}
+		normalized, err := NormalizeUsername(user.Username)
+		if err != nil {
+			v.add(field+".username", "%v", err)
+			continue
+		}
+		if normalized != user.Username {
+			v.add(field+".username", "%q is not normalized (use %q)", user.Username, normalized)
+		}
+		// Usernames are unique regardless of case
+		key := UsernameKey(user.Username)
+		if usernames[key] {
+			v.add(field+".username", "duplicate username %q", user.Username)
+		}
+		usernames[key] = true
+	}
+}
+
+func (v *validator) validateConnections(cfg *Config) {
+	names := make(map[string]bool)
+	for i, conn := range cfg.Connections {
+		field := fmt.Sprintf("connections[%d]", i)
+		if conn.Name == "" {
+			v.add(field+".name", "is required")
+		} else if names[conn.Name] {
+			v.add(field+".name", "duplicate connection name %q", conn.Name)
+		}
+		names[conn.Name] = true
+
+		switch conn.Type {
+		case "postgres", "http", "https", "tcp", "grpc", "mongodb", "ssh", "kafka":
+		default:
+			v.add(field+".type", "unsupported connection type %q (postgres, http, https, tcp, grpc, mongodb, ssh, kafka)", conn.Type)
+		}
+		if conn.Type == "ssh" {
+			if conn.BackendUsername == "" {
+				v.add(field+".backend_username", "is required for ssh connections")
+			}
+			if conn.BackendPassword == "" && conn.SSHPrivateKey == "" {
+				v.add(field+".ssh_private_key", "ssh connections need ssh_private_key or backend_password")
+			}
+		}
+
+		if conn.Host == "" {
+			v.add(field+".host", "is required")
+		}
+		if conn.Port < 1 || conn.Port > 65535 {
+			v.add(field+".port", "port %d out of range (1-65535)", conn.Port)
+		}
+		for j, addr := range conn.Hosts {
+			if host, port, err := net.SplitHostPort(addr); err != nil || host == "" {
+				v.add(fmt.Sprintf("%s.hosts[%d]", field, j), "invalid backend %q, want host:port", addr)
+			} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				v.add(fmt.Sprintf("%s.hosts[%d]", field, j), "port %q out of range (1-65535)", port)
+			}
+		}
+		if len(conn.Hosts) > 0 && (conn.Type == "http" || conn.Type == "https" || conn.Type == "grpc") {
+			v.add(field+".hosts", "backend failover is not supported for %s connections", conn.Type)
+		}
+		if conn.HostSelection != "" && conn.HostSelection != "failover" && conn.HostSelection != "round_robin" {
+			v.add(field+".host_selection", "unknown mode %q (failover, round_robin)", conn.HostSelection)
+		}
+		if conn.HealthCheckInterval < 0 {
+			v.add(field+".health_check_interval", "must not be negative")
+		}
+		if conn.Duration < 0 {
+			v.add(field+".duration", "must not be negative")
+		}
+		if conn.RequestTimeout < 0 {
+			v.add(field+".request_timeout", "must not be negative")
+		}
+		if conn.IdleTimeout < 0 {
+			v.add(field+".idle_timeout", "must not be negative")
+		}
+		if conn.MaxBytesIn < 0 {
+			v.add(field+".max_bytes_in", "must not be negative")
+		}
+		if conn.MaxBytesOut < 0 {
+			v.add(field+".max_bytes_out", "must not be negative")
+		}
+		if conn.MaxRequestBytes < 0 {
+			v.add(field+".max_request_bytes", "must not be negative")
+		}
+		if conn.SessionAlertThreshold < 0 {
+			v.add(field+".session_alert_threshold", "must not be negative")
+		}
+		if conn.PoolMax < 0 {
+			v.add(field+".pool_max", "must not be negative")
+		} else if conn.PoolMax > 0 && conn.Type != "postgres" {
+			v.add(field+".pool_max", "backend pooling is only supported for postgres connections")
+		}
+		if conn.PoolIdle < 0 {
+			v.add(field+".pool_idle", "must not be negative")
+		}
+		if conn.PoolMaxLifetime < 0 {
+			v.add(field+".pool_max_lifetime", "must not be negative")
+		}
+		if (conn.ReadOnly || len(conn.ReadOnlyRoles) > 0 || conn.ReplicaHost != "") && conn.Type != "postgres" {
+			v.add(field+".read_only", "read-only mode and replica routing are only supported for postgres connections")
+		}
+		if len(conn.AllowedDatabases) > 0 && conn.Type != "postgres" {
+			v.add(field+".allowed_databases", "is only supported for postgres connections")
+		}
+		for j, database := range conn.AllowedDatabases {
+			if database == "" {
+				v.add(fmt.Sprintf("%s.allowed_databases[%d]", field, j), "must not be empty")
+			}
+		}
+		if conn.ReplicaHost != "" && !conn.ReadOnly && len(conn.ReadOnlyRoles) == 0 {
+			v.add(field+".replica_host", "only read-only sessions use the replica; set read_only or read_only_roles")
+		}
+		if conn.ReplicaPort < 0 || conn.ReplicaPort > 65535 {
+			v.add(field+".replica_port", "port %d out of range (1-65535)", conn.ReplicaPort)
+		} else if conn.ReplicaPort != 0 && conn.ReplicaHost == "" {
+			v.add(field+".replica_port", "requires replica_host")
+		}
+		if (conn.BackendClientCert == "") !=(conn.BackendClientKey == "") {
+			v.add(field+".backend_client_cert", "backend_client_cert and backend_client_key must be set together")
+		}
+
+		v.validatePatterns(field+".whitelist", conn.Whitelist)
+
+		if conn.Geofence != nil {
+			for j, country := range append(append([]string{}, conn.Geofence.AllowedCountries...), conn.Geofence.BlockedCountries...) {
+				if len(country) != 2 {
+					v.add(fmt.Sprintf("%s.geofence[%d]", field, j), "invalid ISO country code %q", country)
+				}
+			}
+			if cfg.Security.GeoIPDatabase == "" {
+				v.add(field+".geofence", "requires security.geoip_database")
+			}
+		}
+		if conn.Banner != nil {
+			if strings.TrimSpace(conn.Banner.Message) == "" {
+				v.add(field+".banner.message", "is required")
+			}
+			if conn.Banner.AckTimeout < 0 {
+				v.add(field+".banner.ack_timeout", "must not be negative")
+			}
+		}
+		if conn.DetectProtocol && conn.Type != "tcp" {
+			v.add(field+".detect_protocol", "protocol detection is only supported for tcp connections")
+		}
+		if conn.RequireApproval && (cfg.Approval == nil || !cfg.Approval.Enabled) {
+			v.add(field+".require_approval", "requires approval.enabled")
+		}
+		if conn.ApprovalTimeout < 0 {
+			v.add(field+".approval_timeout", "must not be negative")
+		}
+	}
+}
+
+// tablePermissionOperations are the operations a table permission can grant
+var tablePermissionOperations = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"TRUNCATE": true, "CREATE": true, "DROP": true, "ALTER": true, "*": true,
+}
+
+func (v *validator) validatePolicies(cfg *Config) {
+	// Roles can only be checked when all users are local; external providers supply their own roles
+	knownRoles := make(map[string]bool)
+	for _, user := range cfg.Auth.Users {
+		for _, role := range user.Roles {
+			knownRoles[role] = true
+		}
+	}
+	checkRoles := len(cfg.Auth.Users) > 0
+	for _, provider := range cfg.Auth.Providers {
+		if provider.Enabled {
+			checkRoles = false
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, policy := range cfg.Policies {
+		field := fmt.Sprintf("policies[%d]", i)
+		if policy.Name == "" {
+			v.add(field+".name", "is required")
+		} else if names[policy.Name] {
+			v.add(field+".name", "duplicate policy name %q", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if len(policy.Roles) == 0 {
+			v.add(field+".roles", "at least one role is required")
+		}
+		if policy.MaxDuration < 0 {
+			v.add(field+".max_duration", "must not be negative")
+		}
+		if policy.MaxConcurrentConnections < 0 {
+			v.add(field+".max_concurrent_connections", "must not be negative")
+		}
+		for j, entry := range policy.SourceCIDRs {
+			if strings.Contains(entry, "/") {
+				if _, _, err := net.ParseCIDR(entry); err != nil {
+					v.add(fmt.Sprintf("%s.source_cidrs[%d]", field, j), "invalid CIDR %q", entry)
+				}
+			} else if net.ParseIP(entry) == nil {
+				v.add(fmt.Sprintf("%s.source_cidrs[%d]", field, j), "invalid IP %q", entry)
+			}
+		}
+		if checkRoles {
+			for _, role := range policy.Roles {
+				if !knownRoles[role] {
+					v.add(field+".roles", "role %q is not assigned to any user", role)
+				}
+			}
+		}
+
+		if policy.TagMatch != "" && policy.TagMatch != "all" && policy.TagMatch != "any" {
+			v.add(field+".tag_match", "must be \"all\" or \"any\"")
+		}
+		for j, tag := range policy.Tags {
+			if _, err := ParseTagExpression(tag); err != nil {
+				v.add(fmt.Sprintf("%s.tags[%d]", field, j), "%v", err)
+			}
+		}
+		if policy.WhitelistMode != "" && policy.WhitelistMode != "all" && policy.WhitelistMode != "any" {
+			v.add(field+".whitelist_mode", "must be \"all\" or \"any\"")
+		}
+
+		v.validatePatterns(field+".whitelist", policy.Whitelist)
+		v.validatePatterns(field+".blacklist", policy.Blacklist)
+
+		if policy.Schedule != nil {
+			if err := policy.Schedule.Validate(); err != nil {
+				v.add(field+".schedule", "%v", err)
+			}
+		}
+
+		for j, permission := range policy.TablePermissions {
+			permissionField := fmt.Sprintf("%s.table_permissions[%d]", field, j)
+			if len(permission.Operations) == 0 {
+				v.add(permissionField+".operations", "at least one operation is required")
+			}
+			for _, op := range permission.Operations {
+				if !tablePermissionOperations[strings.ToUpper(op)] {
+					v.add(permissionField+".operations", "unknown operation %q (SELECT, INSERT, UPDATE, DELETE, TRUNCATE, CREATE, DROP, ALTER, *)", op)
+				}
+			}
+			if len(permission.Tables) == 0 {
+				v.add(permissionField+".tables", "at least one table is required")
+			}
+		}
+
+		for j, direction := range policy.Copy {
+			if d := strings.ToLower(direction); d != "from" && d != "to" {
+				v.add(fmt.Sprintf("%s.copy[%d]", field, j), "must be \"from\" or \"to\"")
+			}
+		}
+
+		for j := range policy.TimeWhitelists {
+			window := &policy.TimeWhitelists[j]
+			windowField := fmt.Sprintf("%s.time_whitelists[%d]", field, j)
+			if err := window.Validate(); err != nil {
+				v.add(windowField, "%v", err)
+			}
+			if len(window.Whitelist) == 0 {
+				v.add(windowField+".whitelist", "at least one pattern is required")
+			}
+			v.validatePatterns(windowField+".whitelist", window.Whitelist)
+		}
+	}
+}
+
+// logLevels and logFormats are the accepted logging.log_level and logging.log_format values
+var (
+	logLevels  = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+	logFormats = map[string]bool{"text": true, "json": true}
+)
+
+func (v *validator) validateLogging(cfg *Config) {
+	if cfg.Logging.LogLevel != "" && !logLevels[strings.ToLower(cfg.Logging.LogLevel)] {
+		v.add("logging.log_level", "must be one of debug, info, warn, error")
+	}
+	if cfg.Logging.LogFormat != "" && !logFormats[strings.ToLower(cfg.Logging.LogFormat)] {
+		v.add("logging.log_format", "must be one of text, json")
+	}
+	if cfg.Logging.AuditMemoryMB < 0 {
+		v.add("logging.audit_memory_mb", "must not be negative")
+	}
+	if cfg.Logging.AuditMaxMB < 0 {
+		v.add("logging.audit_max_mb", "must not be negative")
+	}
+	if cfg.Logging.AuditMaxBackups < 0 {
+		v.add("logging.audit_max_backups", "must not be negative")
+	}
+	if cfg.Logging.DecisionLogRetentionDays < 0 {
+		v.add("logging.decision_log_retention_days", "must not be negative")
+	}
+}
+
+func (v *validator) validateSecurity(cfg *Config) {
+	connections := make(map[string]bool, len(cfg.Connections))
+	for _, conn := range cfg.Connections {
+		connections[conn.Name] = true
+	}
+
+	for i, rule := range cfg.Security.AuditRedactions {
+		field := fmt.Sprintf("security.audit_redactions[%d]", i)
+		if rule.Pattern == "" {
+			v.add(field+".pattern", "is required")
+		} else if _, err := regexp.Compile(rule.Pattern); err != nil {
+			v.add(field+".pattern", "invalid regex: %v", err)
+		}
+		for j, name := range rule.Connections {
+			if !connections[name] {
+				v.add(fmt.Sprintf("%s.connections[%d]", field, j), "unknown connection %q", name)
+			}
+		}
+	}
+}
+
+func (v *validator) validateApproval(cfg *Config) {
+	if cfg.Approval == nil {
+		return
+	}
+
+	for i, pattern := range cfg.Approval.Patterns {
+		field := fmt.Sprintf("approval.patterns[%d]", i)
+		if pattern.Pattern == "" {
+			v.add(field+".pattern", "is required")
+		} else if _, err := regexp.Compile("(?i)" + pattern.Pattern); err != nil {
+			v.add(field+".pattern", "invalid regex: %v", err)
+		}
+		if pattern.TagMatch != "" && pattern.TagMatch != "all" && pattern.TagMatch != "any" {
+			v.add(field+".tag_match", "must be \"all\" or \"any\"")
+		}
+		if pattern.TimeoutSeconds < 0 {
+			v.add(field+".timeout_seconds", "must not be negative")
+		}
+		if pattern.RequiredApprovals < 0 {
+			v.add(field+".required_approvals", "must not be negative")
+		}
+		if pattern.ApprovalCacheSeconds < 0 {
+			v.add(field+".approval_cache_seconds", "must not be negative")
+		}
+		if pattern.Escalation != nil {
+			v.validateEscalation(field+".escalation", pattern.Escalation, pattern.TimeoutSeconds)
+		}
+	}
+
+	if cfg.Approval.Webhook != nil && cfg.Approval.Webhook.URL != "" {
+		v.validateURL("approval.webhook.url", cfg.Approval.Webhook.URL)
+		if _, err := template.New("webhook").Parse(cfg.Approval.Webhook.Template); err != nil {
+			v.add("approval.webhook.template", "invalid template: %v", err)
+		}
+		v.validateDeliveryRetry("approval.webhook.retry", cfg.Approval.Webhook.Retry)
+	}
+	if cfg.Approval.Slack != nil && cfg.Approval.Slack.WebhookURL != "" {
+		v.validateURL("approval.slack.webhook_url", cfg.Approval.Slack.WebhookURL)
+		if _, err := template.New("slack").Parse(cfg.Approval.Slack.Template); err != nil {
+			v.add("approval.slack.template", "invalid template: %v", err)
+		}
+		v.validateDeliveryRetry("approval.slack.retry", cfg.Approval.Slack.Retry)
+	}
+	if email := cfg.Approval.Email; email != nil && email.SMTPHost != "" {
+		if email.From == "" {
+			v.add("approval.email.from", "is required")
+		}
+		if len(email.To) == 0 {
+			v.add("approval.email.to", "at least one recipient is required")
+		}
+		if email.SMTPPort < 0 || email.SMTPPort > 65535 {
+			v.add("approval.email.smtp_port", "port %d out of range (1-65535)", email.SMTPPort)
+		}
+		if _, err := template.New("subject").Parse(email.SubjectTemplate); err != nil {
+			v.add("approval.email.subject_template", "invalid template: %v", err)
+		}
+		if _, err := template.New("body").Parse(email.BodyTemplate); err != nil {
+			v.add("approval.email.body_template", "invalid template: %v", err)
+		}
+	}
+
+	if store := cfg.Approval.Store; store != nil {
+		switch store.Type {
+		case "", "memory":
+		case "redis":
+			if store.Redis == nil || store.Redis.Address == "" {
+				v.add("approval.store.redis.address", "is required for the redis store")
+			} else if _, _, err := net.SplitHostPort(store.Redis.Address); err != nil {
+				v.add("approval.store.redis.address", "must be host:port: %v", err)
+			}
+			if store.Redis != nil && store.Redis.DB < 0 {
+				v.add("approval.store.redis.db", "must not be negative")
+			}
+		default:
+			v.add("approval.store.type", "unsupported approval store %q (memory or redis)", store.Type)
+		}
+	}
+
+	if cfg.Approval.Enabled && cfg.Server.BaseURL == "" &&
+		((cfg.Approval.Slack != nil && cfg.Approval.Slack.WebhookURL != "") || (cfg.Approval.Email != nil && cfg.Approval.Email.SMTPHost != "")) {
+		v.add("server.base_url", "is required for Slack and email approval links")
+	}
+	if cfg.Approval.Enabled && cfg.Server.BaseURL == "" {
+		for i, pattern := range cfg.Approval.Patterns {
+			if pattern.Escalation != nil {
+				v.add("server.base_url", "is required for the approval links in approval.patterns[%d].escalation pages", i)
+				break
+			}
+		}
+	}
+}
+
+func (v *validator) validateDeliveryRetry(field string, retry *DeliveryRetryConfig) {
+	if retry == nil {
+		return
+	}
+	if retry.MaxAttempts < 0 {
+		v.add(field+".max_attempts", "must not be negative")
+	}
+	if retry.BaseDelay < 0 {
+		v.add(field+".base_delay", "must not be negative")
+	}
+}
+
+// pagerDutySeverities are the severities accepted by the PagerDuty Events API
+var pagerDutySeverities = map[string]bool{"critical": true, "error": true, "warning": true, "info": true}
+
+func (v *validator) validateEscalation(field string, escalation *ApprovalEscalationConfig, timeoutSeconds int) {
+	if escalation.AfterSeconds <= 0 {
+		v.add(field+".after_seconds", "must be positive")
+	} else if timeoutSeconds > 0 && escalation.AfterSeconds >= timeoutSeconds {
+		v.add(field+".after_seconds", "must be less than timeout_seconds (%d), or the request times out before escalating", timeoutSeconds)
+	}
+
+	pd := escalation.PagerDuty
+	if pd == nil {
+		v.add(field+".pagerduty", "an escalation provider is required")
+		return
+	}
+	if pd.RoutingKey == "" {
+		v.add(field+".pagerduty.routing_key", "is required")
+	}
+	if pd.Severity != "" && !pagerDutySeverities[pd.Severity] {
+		v.add(field+".pagerduty.severity", "must be one of critical, error, warning, info")
+	}
+	if pd.EventsURL != "" {
+		v.validateURL(field+".pagerduty.events_url", pd.EventsURL)
+	}
+}
+
+func (v *validator) validateStorage(cfg *Config) {
+	if cfg.Storage == nil {
+		return
+	}
+
+	switch cfg.Storage.Type {
+	case "", "file":
+	case "kubernetes":
+		if cfg.Storage.Namespace == "" {
+			v.add("storage.namespace", "is required for kubernetes storage")
+		}
+		if cfg.Storage.ResourceName == "" {
+			v.add("storage.resource_name", "is required for kubernetes storage")
+		}
+		if rt := cfg.Storage.ResourceType; rt != "" && rt != "configmap" && rt != "secret" {
+			v.add("storage.resource_type", "must be \"configmap\" or \"secret\"")
+		}
+	case "vault":
+		vault := cfg.Storage.Vault
+		if vault == nil || vault.Path == "" {
+			v.add("storage.vault.path", "is required for vault storage")
+		}
+		if vault != nil && vault.AuthMethod != "" && vault.AuthMethod != "token" && vault.AuthMethod != "approle" {
+			v.add("storage.vault.auth_method", "must be \"token\" or \"approle\"")
+		}
+		if cfg.Storage.Versions > 32 {
+			v.add("storage.versions", "must be at most 32 for vault storage")
+		}
+	case "s3":
+		if cfg.Storage.S3 == nil || cfg.Storage.S3.Bucket == "" {
+			v.add("storage.s3.bucket", "is required for s3 storage")
+		}
+		if s3 := cfg.Storage.S3; s3 != nil && s3.Endpoint != "" {
+			if u, err := url.Parse(s3.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				v.add("storage.s3.endpoint", "invalid URL %q", s3.Endpoint)
+			}
+		}
+	case "git":
+		if cfg.Storage.Git == nil || cfg.Storage.Git.Repository == "" {
+			v.add("storage.git.repository", "is required for git storage")
+		}
+	case "consul":
+		if cfg.Storage.Consul == nil || strings.Trim(cfg.Storage.Consul.Key, "/") == "" {
+			v.add("storage.consul.key", "is required for consul storage")
+		}
+	case "etcd":
+		if cfg.Storage.Etcd == nil || len(cfg.Storage.Etcd.Endpoints) == 0 {
+			v.add("storage.etcd.endpoints", "is required for etcd storage")
+		}
+	default:
+		v.add("storage.type", "unsupported storage type %q (file, kubernetes, vault, s3, git, consul, etcd)", cfg.Storage.Type)
+	}
+
+	if cfg.Storage.Versions < 0 {
+		v.add("storage.versions", "must not be negative")
+	}
+}
+
+func (v *validator) validateObservability(cfg *Config) {
+	if cfg.Observability == nil {
+		return
+	}
+
+	if cfg.Observability.OTLPEndpoint != "" {
+		v.validateURL("observability.otlp_endpoint", cfg.Observability.OTLPEndpoint)
+	}
+	if rate := cfg.Observability.SampleRate; rate < 0 || rate > 1 {
+		v.add("observability.sample_rate", "must be between 0 and 1")
+	}
+}
+
+// validatePatterns checks that whitelist and blacklist patterns compile (case-insensitive, as used at runtime)
+func (v *validator) validatePatterns(field string, patterns []string) {
+	for i, pattern := range patterns {
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "invalid regex: %v", err)
+		}
+	}
+}
+
+// validateURL checks that a URL is absolute http(s)
+func (v *validator) validateURL(field, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, "invalid URL %q", raw)
+	}
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validTestConfig() *Config {
+	return &Config{
+		Server: ServerConfig{Port: 8080},
+		Auth: AuthConfig{
+			JWTSecret: "secret",
+			Users: []User{
+				{Username: "admin", Password: "admin", Roles: []string{"admin"}},
+			},
+		},
+		Connections: []ConnectionConfig{
+			{Name: "pg", Type: "postgres", Host: "localhost", Port: 5432, Whitelist: []string{"^SELECT.*"}},
+		},
+		Policies: []RolePolicy{
+			{Name: "admins", Roles: []string{"admin"}, Tags: []string{"env:dev"}, Whitelist: []string{".*"}},
+		},
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	if err := Validate(validTestConfig()); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+}
+
+func TestValidate_Problems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		field  string
+	}{
+		{"missing jwt secret", func(cfg *Config) { cfg.Auth.JWTSecret = "" }, "auth.jwt_secret"},
+		{"empty verification jwt secret", func(cfg *Config) { cfg.Auth.JWTSecrets = []string{"old", ""} }, "auth.jwt_secrets[1]"},
+		{"negative token renewal window", func(cfg *Config) { cfg.Auth.TokenRenewalWindow = -time.Hour }, "auth.token_renewal_window"},
+		{"server port out of range", func(cfg *Config) { cfg.Server.Port = 70000 }, "server.port"},
+		{"invalid trusted proxy", func(cfg *Config) { cfg.Server.TrustedProxies = []string{"10.0.0.0/99"} }, "server.trusted_proxies[0]"},
+		{"unknown provider type", func(cfg *Config) {
+			cfg.Auth.Providers = []AuthProviderConfig{{Name: "x", Type: "kerberos"}}
+		}, "auth.providers[0].type"},
+		{"duplicate username", func(cfg *Config) {
+			cfg.Auth.Users = append(cfg.Auth.Users, User{Username: "admin", Roles: []string{"admin"}})
+		}, "auth.users[1].username"},
+		{"duplicate username in another case", func(cfg *Config) {
+			cfg.Auth.Users = append(cfg.Auth.Users, User{Username: "ADMIN", Roles: []string{"admin"}})
+		}, "auth.users[1].username"},
+		{"username with surrounding whitespace", func(cfg *Config) { cfg.Auth.Users[0].Username = " admin " }, "auth.users[0].username"},
+		{"username with control character", func(cfg *Config) { cfg.Auth.Users[0].Username = "ad\x00min" }, "auth.users[0].username"},
+		{"role mappings on non-oidc provider", func(cfg *Config) {
+			cfg.Auth.Providers = []AuthProviderConfig{{Name: "corp", Type: "ldap", RoleMappings: map[string]string{"ops": "admin"}}}
+		}, "auth.providers[0].role_mappings"},
+		{"negative lockout window", func(cfg *Config) { cfg.Auth.Lockout.Window = -time.Minute }, "auth.lockout.window"},
+		{"duplicate connection", func(cfg *Config) {
+			cfg.Connections = append(cfg.Connections, cfg.Connections[0])
+		}, "connections[1].name"},
+		{"unsupported connection type", func(cfg *Config) { cfg.Connections[0].Type = "mysql" }, "connections[0].type"},
+		{"connection port", func(cfg *Config) { cfg.Connections[0].Port = 0 }, "connections[0].port"},
+		{"connection pool on non-postgres", func(cfg *Config) {
+			cfg.Connections[0].Type = "tcp"
+			cfg.Connections[0].PoolMax = 4
+		}, "connections[0].pool_max"},
+		{"read-only on non-postgres", func(cfg *Config) {
+			cfg.Connections[0].Type = "tcp"
+			cfg.Connections[0].ReadOnly = true
+		}, "connections[0].read_only"},
+		{"allowed databases on non-postgres", func(cfg *Config) {
+			cfg.Connections[0].Type = "tcp"
+			cfg.Connections[0].AllowedDatabases = []string{"analytics"}
+		}, "connections[0].allowed_databases"},
+		{"empty allowed database", func(cfg *Config) { cfg.Connections[0].AllowedDatabases = []string{""} }, "connections[0].allowed_databases[0]"},
+		{"replica without read-only sessions", func(cfg *Config) { cfg.Connections[0].ReplicaHost = "replica" }, "connections[0].replica_host"},
+		{"replica port out of range", func(cfg *Config) {
+			cfg.Connections[0].ReadOnly = true
+			cfg.Connections[0].ReplicaHost = "replica"
+			cfg.Connections[0].ReplicaPort = 70000
+		}, "connections[0].replica_port"},
+		{"negative pool idle", func(cfg *Config) { cfg.Connections[0].PoolIdle = -time.Minute }, "connections[0].pool_idle"},
+		{"protocol detection on non-tcp", func(cfg *Config) { cfg.Connections[0].DetectProtocol = true }, "connections[0].detect_protocol"},
+		{"connection approval without approvals enabled", func(cfg *Config) { cfg.Connections[0].RequireApproval = true }, "connections[0].require_approval"},
+		{"negative connection approval timeout", func(cfg *Config) { cfg.Connections[0].ApprovalTimeout = -time.Minute }, "connections[0].approval_timeout"},
+		{"connection whitelist regex", func(cfg *Config) { cfg.Connections[0].Whitelist = []string{"^SELECT ("} }, "connections[0].whitelist[0]"},
+		{"policy whitelist regex", func(cfg *Config) { cfg.Policies[0].Whitelist = []string{"[a-"} }, "policies[0].whitelist[0]"},
+		{"policy blacklist regex", func(cfg *Config) { cfg.Policies[0].Blacklist = []string{"DROP ("} }, "policies[0].blacklist[0]"},
+		{"ssh without backend username", func(cfg *Config) {
+			cfg.Connections[0].Type = "ssh"
+			cfg.Connections[0].BackendPassword = "secret"
+		}, "connections[0].backend_username"},
+		{"ssh without backend credential", func(cfg *Config) {
+			cfg.Connections[0].Type = "ssh"
+			cfg.Connections[0].BackendUsername = "ops"
+		}, "connections[0].ssh_private_key"},
+		{"policy unknown role", func(cfg *Config) { cfg.Policies[0].Roles = []string{"ghost"} }, "policies[0].roles"},
+		{"policy tag match", func(cfg *Config) { cfg.Policies[0].TagMatch = "some" }, "policies[0].tag_match"},
+		{"policy tag expression", func(cfg *Config) { cfg.Policies[0].Tags = []string{"env in prod"} }, "policies[0].tags[0]"},
+		{"policy tag value list", func(cfg *Config) { cfg.Policies[0].Tags = []string{"!env in [ ]"} }, "policies[0].tags[0]"},
+		{"websocket ping interval too long", func(cfg *Config) { cfg.Server.WebSocketPingInterval = time.Minute }, "server.websocket_ping_interval"},
+		{"policy whitelist mode", func(cfg *Config) { cfg.Policies[0].WhitelistMode = "both" }, "policies[0].whitelist_mode"},
+		{"policy table permission operation", func(cfg *Config) {
+			cfg.Policies[0].TablePermissions = []TablePermission{{Operations: []string{"READ"}, Tables: []string{"users"}}}
+		}, "policies[0].table_permissions[0].operations"},
+		{"policy table permission tables", func(cfg *Config) {
+			cfg.Policies[0].TablePermissions = []TablePermission{{Operations: []string{"SELECT"}}}
+		}, "policies[0].table_permissions[0].tables"},
+		{"policy copy direction", func(cfg *Config) { cfg.Policies[0].Copy = []string{"to", "both"} }, "policies[0].copy[1]"},
+		{"policy schedule", func(cfg *Config) { cfg.Policies[0].Schedule = &Schedule{Timezone: "Mars/Olympus"} }, "policies[0].schedule"},
+		{"approval pattern regex", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Patterns: []ApprovalPatternConfig{{Pattern: "^DELETE ("}}}
+		}, "approval.patterns[0].pattern"},
+		{"approval negative quorum", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Patterns: []ApprovalPatternConfig{{Pattern: "^DELETE", RequiredApprovals: -1}}}
+		}, "approval.patterns[0].required_approvals"},
+		{"approval cache window", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Patterns: []ApprovalPatternConfig{{Pattern: "^DELETE", ApprovalCacheSeconds: -1}}}
+		}, "approval.patterns[0].approval_cache_seconds"},
+		{"approval escalation after timeout", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Patterns: []ApprovalPatternConfig{{Pattern: "^DELETE", TimeoutSeconds: 60, Escalation: &ApprovalEscalationConfig{
+				AfterSeconds: 60, PagerDuty: &PagerDutyEscalationConfig{RoutingKey: "key"},
+			}}}}
+		}, "approval.patterns[0].escalation.after_seconds"},
+		{"approval escalation routing key", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Patterns: []ApprovalPatternConfig{{Pattern: "^DELETE", Escalation: &ApprovalEscalationConfig{
+				AfterSeconds: 30, PagerDuty: &PagerDutyEscalationConfig{},
+			}}}}
+		}, "approval.patterns[0].escalation.pagerduty.routing_key"},
+		{"approval store type", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Store: &ApprovalStoreConfig{Type: "memcached"}}
+		}, "approval.store.type"},
+		{"approval redis address", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Store: &ApprovalStoreConfig{Type: "redis", Redis: &RedisApprovalStoreConfig{Address: "redis"}}}
+		}, "approval.store.redis.address"},
+		{"approval webhook url", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Webhook: &WebhookApprovalConfig{URL: "not a url"}}
+		}, "approval.webhook.url"},
+		{"approval slack template", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Slack: &SlackApprovalConfig{WebhookURL: "https://hooks.slack.com/x", Template: "{{.Username"}}
+		}, "approval.slack.template"},
+		{"approval slack retry", func(cfg *Config) {
+			cfg.Approval = &ApprovalConfig{Slack: &SlackApprovalConfig{WebhookURL: "https://hooks.slack.com/x", Retry: &DeliveryRetryConfig{MaxAttempts: -1}}}
+		}, "approval.slack.retry.max_attempts"},
+		{"storage type", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "gcs"} }, "storage.type"},
+		{"kubernetes storage namespace", func(cfg *Config) {
+			cfg.Storage = &StorageConfig{Type: "kubernetes", ResourceName: "cfg"}
+		}, "storage.namespace"},
+		{"s3 storage bucket", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "s3"} }, "storage.s3.bucket"},
+		{"vault storage path", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "vault"} }, "storage.vault.path"},
+		{"consul storage key", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "consul", Consul: &ConsulStorageConfig{}} }, "storage.consul.key"},
+		{"etcd storage endpoints", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "etcd", Etcd: &EtcdStorageConfig{}} }, "storage.etcd.endpoints"},
+		{"git storage repository", func(cfg *Config) { cfg.Storage = &StorageConfig{Type: "git", Git: &GitStorageConfig{}} }, "storage.git.repository"},
+		{"otlp endpoint", func(cfg *Config) {
+			cfg.Observability = &ObservabilityConfig{OTLPEndpoint: "otel-collector:4318"}
+		}, "observability.otlp_endpoint"},
+		{"sample rate above 1", func(cfg *Config) {
+			cfg.Observability = &ObservabilityConfig{OTLPEndpoint: "http://otel-collector:4318", SampleRate: 1.5}
+		}, "observability.sample_rate"},
+		{"time whitelist window", func(cfg *Config) {
+			cfg.Policies[0].TimeWhitelists = []TimeWindowWhitelist{{Start: "9:00", Whitelist: []string{"^UPDATE.*"}}}
+		}, "policies[0].time_whitelists[0]"},
+		{"time whitelist patterns", func(cfg *Config) {
+			cfg.Policies[0].TimeWhitelists = []TimeWindowWhitelist{{Start: "09:00"}}
+		}, "policies[0].time_whitelists[0].whitelist"},
+		{"negative audit max", func(cfg *Config) { cfg.Logging.AuditMaxMB = -1 }, "logging.audit_max_mb"},
+		{"unknown log level", func(cfg *Config) { cfg.Logging.LogLevel = "verbose" }, "logging.log_level"},
+		{"unknown log format", func(cfg *Config) { cfg.Logging.LogFormat = "xml" }, "logging.log_format"},
+		{"banner without message", func(cfg *Config) {
+			cfg.Connections[0].Banner = &BannerConfig{RequireAck: true}
+		}, "connections[0].banner.message"},
+		{"negative policy max duration", func(cfg *Config) { cfg.Policies[0].MaxDuration = -time.Minute }, "policies[0].max_duration"},
+		{"negative policy concurrent connections", func(cfg *Config) { cfg.Policies[0].MaxConcurrentConnections = -1 }, "policies[0].max_concurrent_connections"},
+		{"negative server concurrent connections", func(cfg *Config) { cfg.Server.MaxConcurrentConnections = -1 }, "server.max_concurrent_connections"},
+		{"invalid policy source cidr", func(cfg *Config) { cfg.Policies[0].SourceCIDRs = []string{"10.0.0.0/33"} }, "policies[0].source_cidrs[0]"},
+		{"negative decision log retention", func(cfg *Config) { cfg.Logging.DecisionLogRetentionDays = -1 }, "logging.decision_log_retention_days"},
+		{"invalid audit redaction pattern", func(cfg *Config) {
+			cfg.Security.AuditRedactions = []AuditRedaction{{Pattern: "token=("}}
+		}, "security.audit_redactions[0].pattern"},
+		{"audit redaction for unknown connection", func(cfg *Config) {
+			cfg.Security.AuditRedactions = []AuditRedaction{{Pattern: "secret", Connections: []string{"nope"}}}
+		}, "security.audit_redactions[0].connections[0]"},
+		{"negative server idle timeout", func(cfg *Config) { cfg.Server.IdleTimeout = -time.Second }, "server.idle_timeout"},
+		{"negative http write timeout", func(cfg *Config) { cfg.Server.HTTP.WriteTimeout = -time.Second }, "server.http.write_timeout"},
+		{"negative http max header bytes", func(cfg *Config) { cfg.Server.HTTP.MaxHeaderBytes = -1 }, "server.http.max_header_bytes"},
+		{"negative connection idle timeout", func(cfg *Config) { cfg.Connections[0].IdleTimeout = -time.Second }, "connections[0].idle_timeout"},
+		{"negative server byte quota", func(cfg *Config) { cfg.Server.MaxBytesOut = -1 }, "server.max_bytes_out"},
+		{"negative connection byte quota", func(cfg *Config) { cfg.Connections[0].MaxBytesIn = -1 }, "connections[0].max_bytes_in"},
+		{"negative server request size limit", func(cfg *Config) { cfg.Server.MaxRequestBytes = -1 }, "server.max_request_bytes"},
+		{"negative connection request size limit", func(cfg *Config) { cfg.Connections[0].MaxRequestBytes = -1 }, "connections[0].max_request_bytes"},
+		{"failover host without port", func(cfg *Config) { cfg.Connections[0].Hosts = []string{"db2"} }, "connections[0].hosts[0]"},
+		{"failover host port out of range", func(cfg *Config) { cfg.Connections[0].Hosts = []string{"db2:70000"} }, "connections[0].hosts[0]"},
+		{"failover hosts on http", func(cfg *Config) {
+			cfg.Connections[0].Type = "http"
+			cfg.Connections[0].Whitelist = nil
+			cfg.Connections[0].Hosts = []string{"api2:443"}
+		}, "connections[0].hosts"},
+		{"unknown host selection", func(cfg *Config) { cfg.Connections[0].HostSelection = "random" }, "connections[0].host_selection"},
+		{"negative health check interval", func(cfg *Config) { cfg.Connections[0].HealthCheckInterval = -time.Second }, "connections[0].health_check_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			tt.modify(cfg)
+
+			err := Validate(cfg)
+			var problems ValidationErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("Validate() error = %v, want ValidationErrors", err)
+			}
+
+			found := false
+			for _, p := range problems {
+				if p.Field == tt.field {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Validate() problems = %v, want one for field %q", problems, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Auth.JWTSecret = ""
+	cfg.Connections[0].Port = -1
+	cfg.Policies[0].Whitelist = []string{"("}
+
+	err := Validate(cfg)
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("Validate() error = %v, want ValidationErrors", err)
+	}
+	if len(problems) != 3 {
+		t.Errorf("Validate() returned %d problems, want 3: %v", len(problems), problems)
+	}
+	if !strings.Contains(err.Error(), "3 configuration problem(s)") {
+		t.Errorf("Error() = %q, want problem count", err.Error())
+	}
+}
+
+func TestValidate_ExternalProviderSkipsRoleCheck(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Policies[0].Roles = []string{"oidc-group"}
+	cfg.Auth.Providers = []AuthProviderConfig{{Name: "sso", Type: "oidc", Enabled: true}}
+
+	if err := Validate(cfg); err != nil {
+		t.Errorf("Validate() error = %v, want nil when roles come from an external provider", err)
+	}
+}
@@ -0,0 +1,75 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// CountryLookup resolves the ISO country code of an IP address
+type CountryLookup interface {
+	// Country returns the ISO 3166-1 alpha-2 country code, or "" if unknown
+	Country(ip net.IP) (string, error)
+}
+
+// Resolver looks up countries in a MaxMind GeoIP2/GeoLite2 database
+type Resolver struct {
+	db *geoip2.Reader
+}
+
+// Open opens a GeoIP2 or GeoLite2 Country/City database (.mmdb)
+func Open(path string) (*Resolver, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+	return &Resolver{db: db}, nil
+}
+
+// Country returns the ISO country code for an IP address
+func (r *Resolver) Country(ip net.IP) (string, error) {
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address")
+	}
+
+	record, err := r.db.Country(ip)
+	if err != nil {
+		return "", fmt.Errorf("GeoIP lookup failed: %w", err)
+	}
+
+	return strings.ToUpper(record.Country.IsoCode), nil
+}
+
+// Close closes the underlying database
+func (r *Resolver) Close() error {
+	return r.db.Close()
+}
+
+// Allowed checks a country against allow and block lists (ISO codes, case-insensitive).
+// Block list takes precedence. An empty allow list allows every country not blocked.
+// Unknown countries ("") are only allowed when allowUnknown is true.
+func Allowed(country string, allowed, blocked []string, allowUnknown bool) bool {
+	if country == "" {
+		return allowUnknown
+	}
+
+	for _, c := range blocked {
+		if strings.EqualFold(c, country) {
+			return false
+		}
+	}
+
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, c := range allowed {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package geoip
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen_MissingDatabase(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err == nil {
+		t.Error("Open() expected error for missing database, got nil")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name         string
+		country      string
+		allowed      []string
+		blocked      []string
+		allowUnknown bool
+		want         bool
+	}{
+		{"no lists", "US", nil, nil, false, true},
+		{"in allow list", "DE", []string{"DE", "FR"}, nil, false, true},
+		{"allow list case-insensitive", "de", []string{"DE"}, nil, false, true},
+		{"not in allow list", "US", []string{"DE", "FR"}, nil, false, false},
+		{"blocked", "RU", nil, []string{"RU"}, false, false},
+		{"block wins over allow", "DE", []string{"DE"}, []string{"DE"}, false, false},
+		{"unknown denied", "", []string{"DE"}, nil, false, false},
+		{"unknown allowed", "", []string{"DE"}, nil, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.country, tt.allowed, tt.blocked, tt.allowUnknown); got != tt.want {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.country, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// level is shared by every handler created by Configure, so log_level can change on reload
+var level = new(slog.LevelVar)
+
+// ParseLevel converts a log_level setting (debug, info, warn, error) to a slog level
+// An empty level means info.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+}
+
+// New creates a leveled logger writing to w as text or JSON (log_format)
+func New(w io.Writer, logLevel, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := newHandler(w, format, lvl)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(handler), nil
+}
+
+// Configure installs the server's logger as the slog default, writing to stderr
+// Loggers obtained with Component afterwards follow later SetLevel calls.
+func Configure(logLevel, format string) error {
+	lvl, err := ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+
+	// slog.SetDefault also routes the standard log package through the handler
+	level.Set(lvl)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the level of the logger installed by Configure (e.g., on config reload)
+func SetLevel(logLevel string) error {
+	lvl, err := ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+	return nil
+}
+
+// Component returns the default logger tagged with the component producing the logs
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// newHandler creates a text or JSON handler; an empty format means text
+func newHandler(w io.Writer, format string, lvl slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (use text or json)", format)
+	}
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		format   string
+		wantErr  bool
+		wantJSON bool
+		wantInfo bool
+	}{
+		{name: "defaults to text at info", wantInfo: true},
+		{name: "json", level: "debug", format: "json", wantJSON: true, wantInfo: true},
+		{name: "level filters lower levels", level: "warn", format: "JSON", wantJSON: true},
+		{name: "unknown level", level: "verbose", wantErr: true},
+		{name: "unknown format", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			logger.With("component", "proxy").Info("connection created", "connection_id", "conn-1", "username", "alice")
+			if !tt.wantInfo {
+				if buf.Len() != 0 {
+					t.Errorf("info logged at level %s: %q", tt.level, buf.String())
+				}
+				return
+			}
+
+			if !tt.wantJSON {
+				if !strings.Contains(buf.String(), "component=proxy") || !strings.Contains(buf.String(), "username=alice") {
+					t.Errorf("text output = %q, want key=value fields", buf.String())
+				}
+				return
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("output is not JSON: %v (%q)", err, buf.String())
+			}
+			if entry["msg"] != "connection created" || entry["component"] != "proxy" || entry["connection_id"] != "conn-1" {
+				t.Errorf("JSON entry = %v", entry)
+			}
+		})
+	}
+}
+
+func TestConfigure_SetLevel(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	if err := Configure("error", "json"); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	logger := Component("api")
+	if logger.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info enabled at log_level error")
+	}
+
+	// Loggers created before a reload follow the new level
+	if err := SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug not enabled after SetLevel(debug)")
+	}
+
+	if err := SetLevel("loud"); err == nil {
+		t.Error("SetLevel() accepted an unknown level")
+	}
+	if err := Configure("info", "yaml"); err == nil {
+		t.Error("Configure() accepted an unknown format")
+	}
+}
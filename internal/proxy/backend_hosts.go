@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// Host selection modes of connections with several backend hosts
+const (
+	HostSelectionFailover   = "failover"    // Always prefer the first healthy host in order (default)
+	HostSelectionRoundRobin = "round_robin" // Spread sessions across the healthy hosts
+)
+
+// defaultHealthCheckInterval is how often hosts marked down are probed when the
+// connection sets no health_check_interval
+const defaultHealthCheckInterval = 10 * time.Second
+
+// BackendSelection records which backend host a session reached
+type BackendSelection struct {
+	Host   string   // Configured host:port the session connected to
+	Failed []string // Hosts tried and given up on first, in order
+	Errors []string // Why each of Failed was given up on
+	Hosts  int      // Number of hosts configured for the connection
+	Mode   string   // Host selection mode
+}
+
+// BackendAddrs returns the backend hosts ("host:port") of a connection in preference
+// order: host:port first, then the hosts list, without duplicates
+func BackendAddrs(connConfig *config.ConnectionConfig) []string {
+	addrs := []string{net.JoinHostPort(connConfig.Host, strconv.Itoa(connConfig.Port))}
+	for _, addr := range connConfig.Hosts {
+		duplicate := false
+		for _, seen := range addrs {
+			duplicate = duplicate || seen == addr
+		}
+		if !duplicate {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// DialBackendSelection is DialBackend that also reports which host it reached.
+// Connections with several hosts try them in the order of their host_selection mode,
+// failing over to the next when a dial (or TLS handshake) fails; hosts that fail are
+// skipped by later sessions until a background probe reaches them again.
+func DialBackendSelection(connConfig *config.ConnectionConfig, timeout time.Duration) (net.Conn, *BackendSelection, error) {
+	tlsConfig, err := BackendTLSConfig(connConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dialBackendHosts(connConfig, tlsConfig, timeout)
+}
+
+// dialBackendHosts dials a connection's backend hosts until one answers; tlsConfig is
+// used with each host's own ServerName
+func dialBackendHosts(connConfig *config.ConnectionConfig, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, *BackendSelection, error) {
+	addrs := BackendAddrs(connConfig)
+	selection := &BackendSelection{Hosts: len(addrs), Mode: hostSelectionMode(connConfig)}
+	if len(addrs) == 1 {
+		selection.Host = addrs[0]
+		conn, err := dialBackendAddr(connConfig.Type, addrs[0], tlsConfig, timeout)
+		return conn, selection, err
+	}
+
+	health := backendHealthFor(connConfig, addrs)
+	var errs []error
+	for _, addr := range health.order(selection.Mode) {
+		hostTLS := tlsConfig
+		if tlsConfig != nil {
+			host, _, _ := net.SplitHostPort(addr)
+			hostTLS = tlsConfig.Clone()
+			hostTLS.ServerName = host
+		}
+		conn, err := dialBackendAddr(connConfig.Type, addr, hostTLS, timeout)
+		if err == nil {
+			health.markUp(addr)
+			selection.Host = addr
+			return conn, selection, nil
+		}
+		health.markDown(addr)
+		selection.Failed = append(selection.Failed, addr)
+		selection.Errors = append(selection.Errors, err.Error())
+		errs = append(errs, err)
+	}
+	return nil, selection, fmt.Errorf("all %d backend hosts failed: %w", len(addrs), errors.Join(errs...))
+}
+
+// LogBackendSelection audits the host a session on a multi-host connection reached:
+// backend_failover when hosts were given up on first, backend_selected otherwise
+func LogBackendSelection(auditLogPath, username, connectionName, connectionID string, selection *BackendSelection) {
+	if selection == nil || selection.Hosts < 2 || selection.Host == "" {
+		return
+	}
+	action := "backend_selected"
+	metadata := map[string]interface{}{
+		"connection_id":  connectionID,
+		"backend_host":   selection.Host,
+		"host_selection": selection.Mode,
+	}
+	if len(selection.Failed) > 0 {
+		action = "backend_failover"
+		metadata["failed_hosts"] = selection.Failed
+		metadata["errors"] = selection.Errors
+	}
+	_ = audit.Log(auditLogPath, username, action, connectionName, metadata)
+}
+
+func hostSelectionMode(connConfig *config.ConnectionConfig) string {
+	if connConfig.HostSelection == "" {
+		return HostSelectionFailover
+	}
+	return connConfig.HostSelection
+}
+
+// backendHealth tracks which hosts of a connection are down, shared by all its sessions
+type backendHealth struct {
+	mu       sync.Mutex
+	addrs    []string
+	down     map[string]bool
+	next     int  // Round-robin cursor
+	probing  bool // A probe loop is running for the hosts that are down
+	interval time.Duration
+	timeout  time.Duration
+}
+
+var (
+	backendHealthMu sync.Mutex
+	backendHealths  = make(map[string]*backendHealth)
+)
+
+// backendHealthFor returns the health tracker of a connection's host list; a changed
+// list (e.g. after a config reload) starts with every host healthy
+func backendHealthFor(connConfig *config.ConnectionConfig, addrs []string) *backendHealth {
+	key := connConfig.Name + "\x00" + strings.Join(addrs, ",")
+
+	backendHealthMu.Lock()
+	defer backendHealthMu.Unlock()
+	health, ok := backendHealths[key]
+	if !ok {
+		interval := connConfig.HealthCheckInterval
+		if interval <= 0 {
+			interval = defaultHealthCheckInterval
+		}
+		health = &backendHealth{
+			addrs:    addrs,
+			down:     make(map[string]bool),
+			interval: interval,
+			timeout:  2 * time.Second,
+		}
+		backendHealths[key] = health
+	}
+	return health
+}
+
+// order returns the hosts to try: healthy ones first (rotated for round_robin), then
+// the ones marked down as a last resort
+func (h *backendHealth) order(mode string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var healthy, down []string
+	for _, addr := range h.addrs {
+		if h.down[addr] {
+			down = append(down, addr)
+		} else {
+			healthy = append(healthy, addr)
+		}
+	}
+	if mode == HostSelectionRoundRobin && len(healthy) > 1 {
+		start := h.next % len(healthy)
+		h.next++
+		healthy = append(healthy[start:], healthy[:start]...)
+	}
+	return append(healthy, down...)
+}
+
+func (h *backendHealth) markUp(addr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.down, addr)
+}
+
+// markDown takes a host out of rotation and makes sure it is being probed
+func (h *backendHealth) markDown(addr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down[addr] = true
+	if !h.probing {
+		h.probing = true
+		go h.probe()
+	}
+}
+
+// probe dials the hosts that are down every interval, returning them to rotation once
+// they accept connections; it stops when no host is down
+func (h *backendHealth) probe() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.mu.Lock()
+		var down []string
+		for addr := range h.down {
+			down = append(down, addr)
+		}
+		h.mu.Unlock()
+
+		for _, addr := range down {
+			if conn, err := net.DialTimeout("tcp", addr, h.timeout); err == nil {
+				_ = conn.Close()
+				h.markUp(addr)
+			}
+		}
+
+		h.mu.Lock()
+		if len(h.down) == 0 {
+			h.probing = false
+			h.mu.Unlock()
+			return
+		}
+		h.mu.Unlock()
+	}
+}
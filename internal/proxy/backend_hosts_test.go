@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// startAcceptBackend listens on a free port, closing every connection it accepts
+func startAcceptBackend(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+// closedAddr returns a local address nothing listens on
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestBackendAddrs(t *testing.T) {
+	got := BackendAddrs(&config.ConnectionConfig{
+		Host:  "db1",
+		Port:  5432,
+		Hosts: []string{"db1:5432", "db2:5432", "db3:6432"},
+	})
+	want := "db1:5432,db2:5432,db3:6432"
+	if strings.Join(got, ",") != want {
+		t.Errorf("BackendAddrs() = %v, want %s", got, want)
+	}
+}
+
+func TestDialBackendSelection_Failover(t *testing.T) {
+	down := closedAddr(t)
+	up := startAcceptBackend(t)
+	host, port, _ := net.SplitHostPort(down)
+	downPort, _ := net.LookupPort("tcp", port)
+	cfg := &config.ConnectionConfig{
+		Name:                t.Name(),
+		Type:                "tcp",
+		Host:                host,
+		Port:                downPort,
+		Hosts:               []string{up.String()},
+		HealthCheckInterval: time.Hour,
+	}
+
+	conn, selection, err := DialBackendSelection(cfg, time.Second)
+	if err != nil {
+		t.Fatalf("DialBackendSelection() error = %v", err)
+	}
+	_ = conn.Close()
+	if selection.Host != up.String() || len(selection.Failed) != 1 || selection.Failed[0] != down {
+		t.Errorf("selection = %+v, want failover from %s to %s", selection, down, up)
+	}
+
+	auditLog := t.TempDir() + "/audit.log"
+	LogBackendSelection(auditLog, "alice", cfg.Name, "conn-1", selection)
+	content, _ := os.ReadFile(auditLog)
+	if !strings.Contains(string(content), `"action":"backend_failover"`) || !strings.Contains(string(content), down) {
+		t.Errorf("audit log missing failover: %s", content)
+	}
+
+	// The failed host is skipped until a probe brings it back
+	_, selection, err = DialBackendSelection(cfg, time.Second)
+	if err != nil || len(selection.Failed) != 0 || selection.Host != up.String() {
+		t.Errorf("second dial: selection = %+v, err = %v; want the healthy host first", selection, err)
+	}
+}
+
+func TestDialBackendSelection_AllDown(t *testing.T) {
+	first, second := closedAddr(t), closedAddr(t)
+	host, port, _ := net.SplitHostPort(first)
+	firstPort, _ := net.LookupPort("tcp", port)
+	cfg := &config.ConnectionConfig{Name: t.Name(), Type: "tcp", Host: host, Port: firstPort, Hosts: []string{second}, HealthCheckInterval: time.Hour}
+
+	if _, selection, err := DialBackendSelection(cfg, time.Second); err == nil || len(selection.Failed) != 2 {
+		t.Errorf("DialBackendSelection() = %+v, %v; want both hosts failed", selection, err)
+	}
+}
+
+func TestBackendHealth_RoundRobin(t *testing.T) {
+	health := &backendHealth{addrs: []string{"a:1", "b:1", "c:1"}, down: map[string]bool{"b:1": true}}
+
+	var firsts []string
+	for i := 0; i < 4; i++ {
+		order := health.order(HostSelectionRoundRobin)
+		if order[len(order)-1] != "b:1" {
+			t.Errorf("order() = %v, want the down host last", order)
+		}
+		firsts = append(firsts, order[0])
+	}
+	if got := strings.Join(firsts, ","); got != "a:1,c:1,a:1,c:1" {
+		t.Errorf("round robin picked %s, want a:1,c:1,a:1,c:1", got)
+	}
+	if order := health.order(HostSelectionFailover); order[0] != "a:1" || order[1] != "c:1" {
+		t.Errorf("failover order() = %v, want healthy hosts in config order", order)
+	}
+}
+
+func TestBackendHealth_ProbeRecovers(t *testing.T) {
+	up := startAcceptBackend(t)
+	health := &backendHealth{
+		addrs:    []string{up.String()},
+		down:     make(map[string]bool),
+		interval: 10 * time.Millisecond,
+		timeout:  time.Second,
+	}
+	health.markDown(up.String())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		health.mu.Lock()
+		recovered := !health.down[up.String()] && !health.probing
+		health.mu.Unlock()
+		if recovered {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("probe did not bring the host back")
+}
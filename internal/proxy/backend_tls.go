@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// pgSSLRequestCode is the protocol code of a Postgres SSLRequest
+const pgSSLRequestCode = 80877103
+
+// BackendTLSConfig builds the TLS client configuration for a connection's backend.
+// It returns nil when backend_tls is disabled; errors wrap ErrBackendTLS.
+func BackendTLSConfig(connConfig *config.ConnectionConfig) (*tls.Config, error) {
+	if !connConfig.BackendTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         connConfig.Host, // SNI and certificate verification
+		InsecureSkipVerify: connConfig.BackendTLSSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if connConfig.BackendCACert != "" {
+		pem, err := os.ReadFile(connConfig.BackendCACert)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read backend_ca_cert: %v", ErrBackendTLS, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: backend_ca_cert %s contains no PEM certificates", ErrBackendTLS, connConfig.BackendCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if connConfig.BackendClientCert != "" || connConfig.BackendClientKey != "" {
+		if connConfig.BackendClientCert == "" || connConfig.BackendClientKey == "" {
+			return nil, fmt.Errorf("%w: backend_client_cert and backend_client_key must be set together", ErrBackendTLS)
+		}
+		cert, err := tls.LoadX509KeyPair(connConfig.BackendClientCert, connConfig.BackendClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to load backend client certificate: %v", ErrBackendTLS, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// DialBackend connects to a connection's backend, negotiating TLS when backend_tls is enabled
+// and failing over between its hosts when it has several (see DialBackendSelection)
+func DialBackend(connConfig *config.ConnectionConfig, timeout time.Duration) (net.Conn, error) {
+	conn, _, err := DialBackendSelection(connConfig, timeout)
+	return conn, err
+}
+
+// ResolvedBackendAddr returns the concrete address a backend connection reached
+// (the resolved IP and port rather than the configured hostname), for audit records
+func ResolvedBackendAddr(conn net.Conn) string {
+	if conn == nil || conn.RemoteAddr() == nil {
+		return ""
+	}
+	return conn.RemoteAddr().String()
+}
+
+// dialBackendAddr dials addr and, if tlsConfig is set, performs the TLS handshake.
+// Postgres backends first receive an SSLRequest, as the protocol requires.
+func dialBackendAddr(connType, addr string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if connType == "postgres" {
+		if err := requestPostgresSSL(conn); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w: %s: %v", ErrBackendTLS, addr, err)
+		}
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: handshake with %s failed: %v", ErrBackendTLS, addr, err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// requestPostgresSSL sends an SSLRequest and checks that the server accepts TLS
+func requestPostgresSSL(conn net.Conn) error {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint32(msg[0:4], 8)
+	binary.BigEndian.PutUint32(msg[4:8], pgSSLRequestCode)
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to send SSLRequest: %w", err)
+	}
+
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("failed to read SSLRequest response: %w", err)
+	}
+	if reply[0] != 'S' {
+		return fmt.Errorf("server does not support TLS")
+	}
+	return nil
+}
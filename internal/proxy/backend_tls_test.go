@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// writeTestCert generates a self-signed certificate for host and writes cert/key PEM files
+func writeTestCert(t *testing.T, host string) (certFile, keyFile string, cert tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, certPEM, 0600)
+	_ = os.WriteFile(keyFile, keyPEM, 0600)
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load key pair: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+// startTLSEchoBackend accepts one connection, optionally answers a Postgres
+// SSLRequest, then echoes a line over TLS and reports the SNI it saw
+func startTLSEchoBackend(t *testing.T, cert tls.Certificate, postgres bool) (int, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	sni := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		if postgres {
+			msg := make([]byte, 8)
+			if _, err := io.ReadFull(conn, msg); err != nil || binary.BigEndian.Uint32(msg[4:8]) != pgSSLRequestCode {
+				return
+			}
+			_, _ = conn.Write([]byte{'S'})
+		}
+
+		tlsConn := tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				sni <- hello.ServerName
+				return nil, nil
+			},
+		})
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(tlsConn, buf); err != nil {
+			return
+		}
+		_, _ = tlsConn.Write(buf)
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, sni
+}
+
+func TestDialBackend_TLS(t *testing.T) {
+	certFile, _, cert := writeTestCert(t, "localhost")
+
+	for _, connType := range []string{"tcp", "postgres"} {
+		t.Run(connType, func(t *testing.T) {
+			port, sni := startTLSEchoBackend(t, cert, connType == "postgres")
+
+			conn, err := DialBackend(&config.ConnectionConfig{
+				Type:          connType,
+				Host:          "localhost",
+				Port:          port,
+				BackendTLS:    true,
+				BackendCACert: certFile,
+			}, 2*time.Second)
+			if err != nil {
+				t.Fatalf("DialBackend() error = %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			if _, ok := conn.(*tls.Conn); !ok {
+				t.Errorf("DialBackend() returned %T, want *tls.Conn", conn)
+			}
+			if got := <-sni; got != "localhost" {
+				t.Errorf("SNI = %q, want localhost", got)
+			}
+
+			_, _ = conn.Write([]byte("ping"))
+			reply := make([]byte, 4)
+			if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+				t.Errorf("echo = %q, %v", reply, err)
+			}
+		})
+	}
+}
+
+func TestDialBackend_UntrustedCertificate(t *testing.T) {
+	_, _, cert := writeTestCert(t, "localhost")
+	port, _ := startTLSEchoBackend(t, cert, false)
+
+	_, err := DialBackend(&config.ConnectionConfig{
+		Type:       "tcp",
+		Host:       "localhost",
+		Port:       port,
+		BackendTLS: true,
+	}, 2*time.Second)
+	if !errors.Is(err, ErrBackendTLS) {
+		t.Errorf("DialBackend() error = %v, want ErrBackendTLS", err)
+	}
+}
+
+func TestBackendTLSConfig(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t, "db.internal")
+
+	tests := []struct {
+		name    string
+		cfg     config.ConnectionConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "disabled", cfg: config.ConnectionConfig{Host: "db.internal"}, wantNil: true},
+		{name: "system roots", cfg: config.ConnectionConfig{Host: "db.internal", BackendTLS: true}},
+		{name: "custom CA and client cert", cfg: config.ConnectionConfig{
+			Host: "db.internal", BackendTLS: true, BackendCACert: certFile,
+			BackendClientCert: certFile, BackendClientKey: keyFile,
+		}},
+		{name: "missing CA file", cfg: config.ConnectionConfig{
+			Host: "db.internal", BackendTLS: true, BackendCACert: filepath.Join(t.TempDir(), "missing.pem"),
+		}, wantErr: true},
+		{name: "CA file without certificates", cfg: config.ConnectionConfig{
+			Host: "db.internal", BackendTLS: true, BackendCACert: keyFile,
+		}, wantErr: true},
+		{name: "client cert without key", cfg: config.ConnectionConfig{
+			Host: "db.internal", BackendTLS: true, BackendClientCert: certFile,
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := BackendTLSConfig(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BackendTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBackendTLS) {
+					t.Errorf("error %v does not wrap ErrBackendTLS", err)
+				}
+				return
+			}
+			if (tlsConfig == nil) != tt.wantNil {
+				t.Fatalf("BackendTLSConfig() = %v, wantNil %v", tlsConfig, tt.wantNil)
+			}
+			if tlsConfig != nil && tlsConfig.ServerName != "db.internal" {
+				t.Errorf("ServerName = %q, want db.internal", tlsConfig.ServerName)
+			}
+		})
+	}
+}
+
+func TestCreateConnection_BackendTLSError(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	cm := NewConnectionManager(time.Hour)
+
+	_, _, err := cm.CreateConnection("alice", &config.ConnectionConfig{
+		Name:          "secure-db",
+		Type:          "tcp",
+		Host:          "db.internal",
+		Port:          5432,
+		BackendTLS:    true,
+		BackendCACert: filepath.Join(t.TempDir(), "missing.pem"),
+	}, time.Minute, nil, auditFile, nil)
+	if !errors.Is(err, ErrBackendTLS) {
+		t.Fatalf("CreateConnection() error = %v, want ErrBackendTLS", err)
+	}
+
+	data, _ := os.ReadFile(auditFile)
+	if !strings.Contains(string(data), "backend_tls_error") {
+		t.Errorf("audit log missing backend_tls_error: %s", data)
+	}
+}
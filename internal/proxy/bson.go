@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Minimal BSON support for the MongoDB proxy: enough to read command names,
+// collections and SASL replies, and to build auth commands and error replies.
+
+// BSON element types used by the proxy
+const (
+	bsonDouble   byte = 0x01
+	bsonString   byte = 0x02
+	bsonDocument byte = 0x03
+	bsonArray    byte = 0x04
+	bsonBinary   byte = 0x05
+	bsonBool     byte = 0x08
+	bsonInt32    byte = 0x10
+	bsonInt64    byte = 0x12
+)
+
+// bsonElement is one key/value of a BSON document; value holds the raw encoding
+type bsonElement struct {
+	key   string
+	kind  byte
+	value []byte
+}
+
+// bsonElements splits a BSON document into its elements
+func bsonElements(doc []byte) ([]bsonElement, error) {
+	if len(doc) < 5 {
+		return nil, fmt.Errorf("bson document too short")
+	}
+	size := int(int32(binary.LittleEndian.Uint32(doc)))
+	if size < 5 || size > len(doc) {
+		return nil, fmt.Errorf("invalid bson document size %d", size)
+	}
+
+	var elements []bsonElement
+	pos := 4
+	for pos < size-1 {
+		kind := doc[pos]
+		pos++
+		end := bytes.IndexByte(doc[pos:size], 0)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated bson key")
+		}
+		key := string(doc[pos : pos+end])
+		pos += end + 1
+
+		n, err := bsonValueSize(kind, doc[pos:size])
+		if err != nil {
+			return nil, fmt.Errorf("bson key %q: %w", key, err)
+		}
+		elements = append(elements, bsonElement{key: key, kind: kind, value: doc[pos : pos+n]})
+		pos += n
+	}
+	return elements, nil
+}
+
+// bsonValueSize returns the encoded size of a value of the given type
+func bsonValueSize(kind byte, data []byte) (int, error) {
+	fixed := map[byte]int{
+		0x01: 8, 0x06: 0, 0x07: 12, 0x08: 1, 0x09: 8, 0x0A: 0,
+		0x10: 4, 0x11: 8, 0x12: 8, 0x13: 16, 0x7F: 0, 0xFF: 0,
+	}
+	if n, ok := fixed[kind]; ok {
+		if n > len(data) {
+			return 0, fmt.Errorf("truncated value")
+		}
+		return n, nil
+	}
+
+	readLen := func() (int, error) {
+		if len(data) < 4 {
+			return 0, fmt.Errorf("truncated value")
+		}
+		return int(int32(binary.LittleEndian.Uint32(data))), nil
+	}
+
+	var n int
+	switch kind {
+	case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+		l, err := readLen()
+		if err != nil {
+			return 0, err
+		}
+		n = 4 + l
+	case 0x03, 0x04, 0x0F: // document, array, code with scope
+		l, err := readLen()
+		if err != nil {
+			return 0, err
+		}
+		n = l
+	case 0x05: // binary
+		l, err := readLen()
+		if err != nil {
+			return 0, err
+		}
+		n = 4 + 1 + l
+	case 0x0B: // regex: two cstrings
+		first := bytes.IndexByte(data, 0)
+		if first < 0 {
+			return 0, fmt.Errorf("truncated regex")
+		}
+		second := bytes.IndexByte(data[first+1:], 0)
+		if second < 0 {
+			return 0, fmt.Errorf("truncated regex")
+		}
+		n = first + second + 2
+	case 0x0C: // DBPointer
+		l, err := readLen()
+		if err != nil {
+			return 0, err
+		}
+		n = 4 + l + 12
+	default:
+		return 0, fmt.Errorf("unsupported bson type 0x%02x", kind)
+	}
+
+	if n < 0 || n > len(data) {
+		return 0, fmt.Errorf("truncated value")
+	}
+	return n, nil
+}
+
+// stringValue returns the element's value if it is a string
+func (e bsonElement) stringValue() (string, bool) {
+	if e.kind != bsonString || len(e.value) < 5 {
+		return "", false
+	}
+	return string(e.value[4 : len(e.value)-1]), true
+}
+
+// numberValue returns the element's value as a float64 if it is numeric or boolean
+func (e bsonElement) numberValue() (float64, bool) {
+	switch e.kind {
+	case bsonDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(e.value)), true
+	case bsonInt32:
+		return float64(int32(binary.LittleEndian.Uint32(e.value))), true
+	case bsonInt64:
+		return float64(int64(binary.LittleEndian.Uint64(e.value))), true
+	case bsonBool:
+		if e.value[0] != 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// binaryValue returns the payload of a binary element
+func (e bsonElement) binaryValue() ([]byte, bool) {
+	if e.kind != bsonBinary || len(e.value) < 5 {
+		return nil, false
+	}
+	return e.value[5:], true
+}
+
+// bsonLookup returns the element with the given key
+func bsonLookup(elements []bsonElement, key string) (bsonElement, bool) {
+	for _, e := range elements {
+		if e.key == key {
+			return e, true
+		}
+	}
+	return bsonElement{}, false
+}
+
+// bsonBuilder builds a BSON document
+type bsonBuilder struct {
+	buf bytes.Buffer
+}
+
+func (b *bsonBuilder) key(kind byte, key string) {
+	b.buf.WriteByte(kind)
+	b.buf.WriteString(key)
+	b.buf.WriteByte(0)
+}
+
+func (b *bsonBuilder) appendString(key, value string) *bsonBuilder {
+	b.key(bsonString, key)
+	_ = binary.Write(&b.buf, binary.LittleEndian, int32(len(value)+1))
+	b.buf.WriteString(value)
+	b.buf.WriteByte(0)
+	return b
+}
+
+func (b *bsonBuilder) appendInt32(key string, value int32) *bsonBuilder {
+	b.key(bsonInt32, key)
+	_ = binary.Write(&b.buf, binary.LittleEndian, value)
+	return b
+}
+
+func (b *bsonBuilder) appendDouble(key string, value float64) *bsonBuilder {
+	b.key(bsonDouble, key)
+	_ = binary.Write(&b.buf, binary.LittleEndian, math.Float64bits(value))
+	return b
+}
+
+func (b *bsonBuilder) appendBool(key string, value bool) *bsonBuilder {
+	b.key(bsonBool, key)
+	if value {
+		b.buf.WriteByte(1)
+	} else {
+		b.buf.WriteByte(0)
+	}
+	return b
+}
+
+func (b *bsonBuilder) appendBinary(key string, value []byte) *bsonBuilder {
+	b.key(bsonBinary, key)
+	_ = binary.Write(&b.buf, binary.LittleEndian, int32(len(value)))
+	b.buf.WriteByte(0) // Generic subtype
+	b.buf.Write(value)
+	return b
+}
+
+func (b *bsonBuilder) appendDocument(key string, doc []byte) *bsonBuilder {
+	b.key(bsonDocument, key)
+	b.buf.Write(doc)
+	return b
+}
+
+// build returns the encoded document
+func (b *bsonBuilder) build() []byte {
+	body := b.buf.Bytes()
+	doc := make([]byte, 4, 4+len(body)+1)
+	binary.LittleEndian.PutUint32(doc, uint32(4+len(body)+1))
+	doc = append(doc, body...)
+	return append(doc, 0)
+}
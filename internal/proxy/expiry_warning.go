@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// ExpiryWarningLead is how long before a connection expires its clients are warned
+const ExpiryWarningLead = time.Minute
+
+// ExpiryWarningMessage returns the human-readable expiry warning sent to clients
+func ExpiryWarningMessage(expiresAt time.Time) string {
+	remaining := time.Until(expiresAt).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprintf("port-authorizing: connection expires in %s (at %s), please wrap up",
+		remaining, expiresAt.Format(time.RFC3339))
+}
+
+// ScheduleExpiryWarning calls warn ExpiryWarningLead before expiresAt (right
+// away if the connection is shorter than that) and audits whether the warning
+// was delivered. Stop the returned timer when the stream ends; it is nil when
+// the connection has no expiry or has already expired.
+func ScheduleExpiryWarning(expiresAt time.Time, auditLogPath, username, connectionName, connectionID, channel string, warn func(message string) error) *time.Timer {
+	if expiresAt.IsZero() || !time.Now().Before(expiresAt) {
+		return nil
+	}
+
+	delay := time.Until(expiresAt) - ExpiryWarningLead
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.AfterFunc(delay, func() {
+		metadata := map[string]interface{}{
+			"connection_id": connectionID,
+			"channel":       channel,
+			"expires_at":    expiresAt.Format(time.RFC3339),
+		}
+		if err := warn(ExpiryWarningMessage(expiresAt)); err != nil {
+			metadata["error"] = err.Error()
+			_ = audit.Log(auditLogPath, username, "connection_expiry_warning_failed", connectionName, metadata)
+			return
+		}
+		_ = audit.Log(auditLogPath, username, "connection_expiry_warning", connectionName, metadata)
+	})
+}
+
+// Expiry is a connection expiry that may be extended while streams are open
+// (implemented by Connection)
+type Expiry interface {
+	ExpiresAt() time.Time
+	// Extended returns a channel closed the next time the expiry is pushed out
+	Extended() <-chan struct{}
+}
+
+// WatchExpiryWarning is ScheduleExpiryWarning for an expiry that may be extended:
+// each extension re-arms the warning for the new expiry. Call the returned
+// function when the stream ends.
+func WatchExpiryWarning(expiry Expiry, auditLogPath, username, connectionName, connectionID, channel string, warn func(message string) error) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			extended := expiry.Extended()
+			warning := ScheduleExpiryWarning(expiry.ExpiresAt(), auditLogPath, username, connectionName, connectionID, channel, warn)
+			select {
+			case <-extended:
+			case <-done:
+			}
+			if warning != nil {
+				warning.Stop()
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// pgClientConn serializes writes to a Postgres client and tracks message
+// framing, so proxy-generated messages such as NoticeResponse are only
+// injected between complete backend messages
+type pgClientConn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	framing pgFraming
+	pending [][]byte // Messages waiting for the next message boundary
+}
+
+// newPGClientConn wraps a client connection that has completed startup
+func newPGClientConn(conn net.Conn) *pgClientConn {
+	return &pgClientConn{Conn: conn}
+}
+
+// Write forwards b to the client and flushes queued messages once the stream
+// is back on a message boundary
+func (c *pgClientConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.Conn.Write(b)
+	c.framing.advance(b[:n])
+	if err != nil {
+		return n, err
+	}
+	return n, c.flushPending()
+}
+
+// WriteMessage sends a complete protocol message, queuing it if a backend
+// message is only partially written
+func (c *pgClientConn) WriteMessage(msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, msg)
+	return c.flushPending()
+}
+
+// flushPending writes queued messages if the stream is on a message boundary
+func (c *pgClientConn) flushPending() error {
+	if !c.framing.atBoundary() {
+		return nil
+	}
+	for len(c.pending) > 0 {
+		if _, err := c.Conn.Write(c.pending[0]); err != nil {
+			return err
+		}
+		c.pending = c.pending[1:]
+	}
+	return nil
+}
+
+// pgFraming follows message boundaries in a Postgres protocol stream
+// (after startup, where every message is type + length + body)
+type pgFraming struct {
+	header    []byte // Partial message header (type + length) seen so far
+	remaining int    // Body bytes left in the current message
+	lastType  byte   // Type of the most recent message started
+	txStatus  byte   // Transaction status of the last ReadyForQuery
+}
+
+// advance moves the framing state over the next bytes of the stream
+func (f *pgFraming) advance(b []byte) {
+	for len(b) > 0 {
+		if f.remaining > 0 {
+			if f.lastType == 'Z' {
+				f.txStatus = b[0]
+			}
+			skip := min(f.remaining, len(b))
+			f.remaining -= skip
+			b = b[skip:]
+			continue
+		}
+
+		take := min(5-len(f.header), len(b))
+		f.header = append(f.header, b[:take]...)
+		b = b[take:]
+		if len(f.header) == 5 {
+			f.lastType = f.header[0]
+			f.remaining = max(int(binary.BigEndian.Uint32(f.header[1:5]))-4, 0)
+			f.header = f.header[:0]
+		}
+	}
+}
+
+// atBoundary reports whether the stream is between two complete messages
+func (f *pgFraming) atBoundary() bool {
+	return f.remaining == 0 && len(f.header) == 0
+}
+
+// buildNoticeResponse builds a Postgres NoticeResponse with WARNING severity
+func buildNoticeResponse(message string) []byte {
+	body := make([]byte, 0, len(message)+32)
+	body = append(body, "SWARNING\x00VWARNING\x00C01000\x00"...)
+	body = append(body, 'M')
+	body = append(body, message...)
+	body = append(body, 0, 0)
+	return buildPGMessage('N', body)
+}
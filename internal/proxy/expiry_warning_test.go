@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingConn captures everything written to it
+type recordingConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) { return c.buf.Write(b) }
+
+func TestPGClientConn_NoticeWaitsForMessageBoundary(t *testing.T) {
+	rec := &recordingConn{}
+	client := newPGClientConn(rec)
+
+	dataRow := buildPGMessage('D', []byte("0123456789"))
+	ready := buildPGMessage('Z', []byte{'I'})
+	notice := buildNoticeResponse("expiring soon")
+
+	// Backend message arrives split across reads, with the header itself split
+	_, _ = client.Write(dataRow[:3])
+	if err := client.WriteMessage(notice); err != nil {
+		t.Fatalf("WriteMessage() error = %v", err)
+	}
+	_, _ = client.Write(dataRow[3:8])
+	if rec.buf.Len() != 8 {
+		t.Fatalf("notice written mid-message: %q", rec.buf.Bytes())
+	}
+	_, _ = client.Write(append(dataRow[8:], ready...))
+
+	want := append(append(append([]byte{}, dataRow...), ready...), notice...)
+	if !bytes.Equal(rec.buf.Bytes(), want) {
+		t.Errorf("client stream = %q, want %q", rec.buf.Bytes(), want)
+	}
+
+	// On a boundary the notice goes out immediately
+	rec.buf.Reset()
+	_ = client.WriteMessage(notice)
+	if !bytes.Equal(rec.buf.Bytes(), notice) {
+		t.Errorf("idle notice = %q, want %q", rec.buf.Bytes(), notice)
+	}
+}
+
+func TestBuildNoticeResponse(t *testing.T) {
+	msg := buildNoticeResponse("wrap up")
+	if msg[0] != 'N' {
+		t.Fatalf("message type = %q, want N", msg[0])
+	}
+	for _, field := range []string{"SWARNING\x00", "C01000\x00", "Mwrap up\x00"} {
+		if !bytes.Contains(msg, []byte(field)) {
+			t.Errorf("notice missing field %q", field)
+		}
+	}
+	if !bytes.HasSuffix(msg, []byte{0, 0}) {
+		t.Error("notice fields not terminated")
+	}
+}
+
+func TestScheduleExpiryWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		warnErr   error
+		wantEvent string
+	}{
+		{name: "delivered", wantEvent: `"connection_expiry_warning"`},
+		{name: "delivery failed", warnErr: errors.New("client gone"), wantEvent: "connection_expiry_warning_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditFile := filepath.Join(t.TempDir(), "audit.log")
+			sent := make(chan string, 1)
+
+			// Shorter than the lead time, so the warning fires right away
+			timer := ScheduleExpiryWarning(time.Now().Add(30*time.Second), auditFile, "alice", "pg", "conn-1", "postgres_notice",
+				func(message string) error {
+					sent <- message
+					return tt.warnErr
+				})
+			if timer == nil {
+				t.Fatal("ScheduleExpiryWarning() returned nil timer")
+			}
+			defer timer.Stop()
+
+			select {
+			case message := <-sent:
+				if !strings.Contains(message, "please wrap up") {
+					t.Errorf("message = %q", message)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("warning was not sent")
+			}
+
+			// The audit entry is written after warn returns
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				data, _ := os.ReadFile(auditFile)
+				if strings.Contains(string(data), tt.wantEvent) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("audit log missing %s: %s", tt.wantEvent, data)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestScheduleExpiryWarning_NoExpiry(t *testing.T) {
+	warn := func(string) error { return nil }
+	if timer := ScheduleExpiryWarning(time.Time{}, "", "alice", "pg", "conn-1", "postgres_notice", warn); timer != nil {
+		t.Error("expected nil timer for zero expiry")
+	}
+	if timer := ScheduleExpiryWarning(time.Now().Add(-time.Second), "", "alice", "pg", "conn-1", "postgres_notice", warn); timer != nil {
+		t.Error("expected nil timer for expired connection")
+	}
+}
+
+func TestWatchExpiryWarning_Extended(t *testing.T) {
+	conn := &Connection{expiresAt: time.Now().Add(30 * time.Second)}
+	sent := make(chan string, 2)
+	stop := WatchExpiryWarning(conn, "", "alice", "pg", "conn-1", "websocket_text", func(message string) error {
+		sent <- message
+		return nil
+	})
+	defer stop()
+
+	// Within the lead time: warned right away
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("warning was not sent")
+	}
+
+	// Extended past the lead time: no warning until the new expiry approaches
+	conn.setExpiresAt(time.Now().Add(time.Hour))
+	select {
+	case message := <-sent:
+		t.Fatalf("unexpected warning after extension: %q", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Extended within the lead time again: warned about the new expiry
+	newExpiry := time.Now().Add(45 * time.Second)
+	conn.setExpiresAt(newExpiry)
+	select {
+	case message := <-sent:
+		if !strings.Contains(message, newExpiry.Format(time.RFC3339)) {
+			t.Errorf("message = %q, want the new expiry", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("warning for the new expiry was not sent")
+	}
+}
@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// gRPC status codes returned by the proxy itself
+const (
+	grpcStatusPermissionDenied = 7
+	grpcStatusUnavailable      = 14
+)
+
+// GRPCProxy terminates HTTP/2 from the client, gates each RPC on its method
+// (the :path, "/package.Service/Method") and forwards allowed calls to the backend
+// Streaming RPCs are gated on the initial method; their messages are relayed as-is.
+type GRPCProxy struct {
+	config       *config.ConnectionConfig
+	transport    *http2.Transport
+	backendURL   *url.URL
+	whitelist    []string
+	auditLogPath string
+	username     string
+	connectionID string
+	approvalMgr  *approval.Manager
+
+	whitelistSource WhitelistSource // Resolves time-scoped whitelists per call (optional)
+	connectReason   string          // Justification given at connect time, shown to approvers
+}
+
+// NewGRPCProxy creates a gRPC proxy with whitelist support
+// Backends are reached over TLS when backend_tls is set, otherwise over cleartext HTTP/2 (h2c).
+// Invalid backend TLS settings fail with an error wrapping ErrBackendTLS.
+func NewGRPCProxy(cfg *config.ConnectionConfig, whitelist []string, auditLogPath, username, connectionID string) (*GRPCProxy, error) {
+	tlsConfig, err := BackendTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	backendURL := &url.URL{Scheme: "http", Host: addr}
+	transport := &http2.Transport{}
+	if tlsConfig != nil {
+		backendURL.Scheme = "https"
+		transport.TLSClientConfig = tlsConfig
+	} else {
+		// h2c: speak HTTP/2 over a plain TCP connection
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	return &GRPCProxy{
+		config:       cfg,
+		transport:    transport,
+		backendURL:   backendURL,
+		whitelist:    whitelist,
+		auditLogPath: auditLogPath,
+		username:     username,
+		connectionID: connectionID,
+	}, nil
+}
+
+// SetApprovalManager sets the approval manager for this proxy
+func (p *GRPCProxy) SetApprovalManager(mgr *approval.Manager) {
+	p.approvalMgr = mgr
+}
+
+// SetConnectReason sets the justification given at connect time, included in approval requests
+func (p *GRPCProxy) SetConnectReason(reason string) {
+	p.connectReason = reason
+}
+
+// ServeConn serves the client's HTTP/2 connection (a tunnel stream) until it closes
+func (p *GRPCProxy) ServeConn(conn net.Conn) {
+	server := &http2.Server{}
+	server.ServeConn(conn, &http2.ServeConnOpts{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = p.HandleRequest(w, r)
+		}),
+	})
+}
+
+// HandleRequest proxies a single gRPC call
+func (p *GRPCProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
+	method := r.URL.Path
+
+	if !p.isMethodAllowed(method) {
+		metadata := map[string]interface{}{
+			"connection_id": p.connectionID,
+			"method":        method,
+			"reason":        "does not match whitelist",
+		}
+		if window := p.excludedWindow(method); window != "" {
+			metadata["reason"] = "outside time window"
+			metadata["time_window"] = window
+		}
+		_ = audit.Log(p.auditLogPath, p.username, "grpc_request_blocked", p.config.Name, metadata)
+		p.logDecision(method, audit.DecisionDeny, metadata["reason"].(string))
+		writeGRPCError(w, grpcStatusPermissionDenied, "method not allowed by security policy")
+		return fmt.Errorf("grpc method blocked by whitelist: %s", method)
+	}
+	if pattern, blacklisted := blacklistMatch(p.whitelistSource, method); blacklisted {
+		_ = audit.Log(p.auditLogPath, p.username, "blacklist_block", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"protocol":      "grpc",
+			"method":        method,
+			"pattern":       pattern,
+		})
+		p.logDecision(method, audit.DecisionDeny, "blacklist_block")
+		writeGRPCError(w, grpcStatusPermissionDenied, "method not allowed by security policy")
+		return fmt.Errorf("grpc method blocked by blacklist: %s", method)
+	}
+	p.logDecision(method, audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), method))
+
+	if err := p.checkApproval(r.Context(), method); err != nil {
+		writeGRPCError(w, grpcStatusPermissionDenied, err.Error())
+		return err
+	}
+
+	// Stream open
+	started := time.Now()
+	_ = audit.Log(p.auditLogPath, p.username, "grpc_request", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"method":        method,
+		"allowed":       true,
+	})
+
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	outReq.URL.Scheme = p.backendURL.Scheme
+	outReq.URL.Host = p.backendURL.Host
+	outReq.Host = p.backendURL.Host
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		p.logResponse(method, strconv.Itoa(grpcStatusUnavailable), started, err)
+		writeGRPCError(w, grpcStatusUnavailable, "backend unavailable")
+		return fmt.Errorf("failed to forward grpc call: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	// Relay messages as they arrive so server-streaming RPCs aren't buffered
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	var copyErr error
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				copyErr = writeErr
+				break
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			copyErr = err
+			break
+		}
+	}
+
+	// Trailers carry the call's grpc-status
+	for key, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status") // Trailers-only response
+	}
+
+	// Stream close
+	p.logResponse(method, status, started, copyErr)
+	return copyErr
+}
+
+// Close closes idle backend connections
+func (p *GRPCProxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return nil
+}
+
+// checkApproval waits for approval when the method requires it
+// For gRPC the approval "method" is GRPC and the "path" is the full method name.
+func (p *GRPCProxy) checkApproval(ctx context.Context, method string) error {
+	if p.approvalMgr == nil {
+		return nil
+	}
+	requiresApproval, timeout := p.approvalMgr.RequiresApproval("GRPC", method, p.config.Tags)
+	if !requiresApproval {
+		return nil
+	}
+
+	_ = audit.Log(p.auditLogPath, p.username, "grpc_approval_requested", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"method":        method,
+		"timeout":       timeout.String(),
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	metadata := map[string]string{
+		"connection_name": p.config.Name,
+		"connection_type": p.config.Type,
+	}
+	if p.connectReason != "" {
+		metadata["reason"] = p.connectReason
+	}
+	approvalResp, err := p.approvalMgr.RequestApproval(ctx, &approval.Request{
+		Username:          p.username,
+		ConnectionID:      p.connectionID,
+		Method:            "GRPC",
+		Path:              method,
+		Tags:              p.config.Tags,
+		RequiredApprovals: p.approvalMgr.RequiredApprovals("GRPC", method, p.config.Tags),
+		Escalation:        p.approvalMgr.EscalationFor("GRPC", method, p.config.Tags),
+		ApprovalCache:     p.approvalMgr.ApprovalCacheFor("GRPC", method, p.config.Tags),
+		Metadata:          metadata,
+	}, timeout)
+	if err != nil {
+		return fmt.Errorf("approval request failed: %w", err)
+	}
+
+	if approvalResp.Decision != approval.DecisionApproved {
+		_ = audit.Log(p.auditLogPath, p.username, "grpc_approval_rejected", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"method":        method,
+			"decision":      approvalResp.Decision,
+			"reason":        approvalResp.Reason,
+			"rejected_by":   approvalResp.ApprovedBy,
+		})
+		return fmt.Errorf("request not approved: %s", approvalResp.Decision)
+	}
+
+	_ = audit.Log(p.auditLogPath, p.username, "grpc_approval_granted", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"method":        method,
+		"approved_by":   approvalResp.ApprovedBy,
+	})
+	return nil
+}
+
+// isMethodAllowed checks a full gRPC method name ("/package.Service/Method") against the whitelist
+func (p *GRPCProxy) isMethodAllowed(method string) bool {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
+		return true // No whitelist means everything is allowed
+	}
+
+	for _, pattern := range whitelist {
+		matched, err := authorization.MatchPattern(pattern, method)
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "grpc_whitelist_error", p.config.Name, map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// logResponse audits the end of a call with its gRPC status
+func (p *GRPCProxy) logResponse(method, status string, started time.Time, err error) {
+	metadata := map[string]interface{}{
+		"connection_id": p.connectionID,
+		"method":        method,
+		"grpc_status":   status,
+		"duration_ms":   time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		metadata["error"] = err.Error()
+	}
+	_ = audit.Log(p.auditLogPath, p.username, "grpc_response", p.config.Name, metadata)
+}
+
+// logDecision records a per-call whitelist decision in the decision log
+func (p *GRPCProxy) logDecision(method, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "grpc_request",
+		Resource:     p.config.Name,
+		Request:      method,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
+}
+
+// writeGRPCError sends a trailers-only gRPC error response
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", strings.ReplaceAll(url.PathEscape(message), "%20", " "))
+	w.WriteHeader(http.StatusOK)
+}
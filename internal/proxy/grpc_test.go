@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// startGRPCBackend starts a cleartext HTTP/2 backend that answers every call
+// with a one-byte body and grpc-status 0
+func startGRPCBackend(t *testing.T) *net.TCPAddr {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte{0})
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().(*net.TCPAddr)
+}
+
+// grpcClient returns an HTTP/2 client whose connections are served by the proxy
+func grpcClient(p *GRPCProxy) *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			client, server := net.Pipe()
+			go p.ServeConn(server)
+			return client, nil
+		},
+	}}
+}
+
+func TestGRPCProxy_MethodWhitelist(t *testing.T) {
+	addr := startGRPCBackend(t)
+	auditLog := t.TempDir() + "/audit.log"
+
+	cfg := &config.ConnectionConfig{Name: "orders-grpc", Type: "grpc", Host: "127.0.0.1", Port: addr.Port}
+	p, err := NewGRPCProxy(cfg, []string{`^/orders\.OrderService/(List|Get).*`}, auditLog, "alice", "conn-1")
+	if err != nil {
+		t.Fatalf("NewGRPCProxy() error = %v", err)
+	}
+	defer func() { _ = p.Close() }()
+	client := grpcClient(p)
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus string
+		wantEvent  string
+	}{
+		{"allowed method", "/orders.OrderService/GetOrder", "0", "grpc_response"},
+		{"allowed prefix", "/orders.OrderService/ListOrders", "0", "grpc_response"},
+		{"blocked method", "/orders.OrderService/DeleteOrder", "7", "grpc_request_blocked"},
+		{"other service", "/billing.BillingService/GetInvoice", "7", "grpc_request_blocked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "http://orders"+tt.method, bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+			req.Header.Set("Content-Type", "application/grpc")
+			req.Header.Set("TE", "trailers")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			status := resp.Trailer.Get("Grpc-Status")
+			if status == "" {
+				status = resp.Header.Get("Grpc-Status")
+			}
+			if status != tt.wantStatus {
+				t.Errorf("grpc-status = %q, want %q", status, tt.wantStatus)
+			}
+
+			data, _ := os.ReadFile(auditLog)
+			if !strings.Contains(string(data), `"`+tt.wantEvent+`"`) || !strings.Contains(string(data), tt.method) {
+				t.Errorf("audit log missing %s for %s: %s", tt.wantEvent, tt.method, data)
+			}
+		})
+	}
+}
+
+func TestGRPCProxy_BackendUnavailable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().(*net.TCPAddr)
+	_ = listener.Close()
+
+	cfg := &config.ConnectionConfig{Name: "orders-grpc", Type: "grpc", Host: "127.0.0.1", Port: addr.Port}
+	p, err := NewGRPCProxy(cfg, nil, t.TempDir()+"/audit.log", "alice", "conn-1")
+	if err != nil {
+		t.Fatalf("NewGRPCProxy() error = %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "http://orders/orders.OrderService/GetOrder", bytes.NewReader(nil))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := grpcClient(p).Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if got := resp.Header.Get("Grpc-Status"); got != "14" {
+		t.Errorf("grpc-status = %q, want 14 (unavailable)", got)
+	}
+}
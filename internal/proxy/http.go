@@ -4,17 +4,22 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/approval"
 	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 )
 
 // HTTPProxy handles HTTP/HTTPS proxying
@@ -22,25 +27,35 @@ type HTTPProxy struct {
 	config       *config.ConnectionConfig
 	client       *http.Client
 	whitelist    []string
+	patterns     []*authorization.Pattern // whitelist compiled once (see compiledWhitelist)
+	compileOnce  sync.Once
 	auditLogPath string
 	username     string
 	connectionID string
 	approvalMgr  *approval.Manager
+
+	whitelistSource WhitelistSource // Resolves time-scoped whitelists per request (optional)
+
+	requestTimeout  time.Duration // Total time budget for a backend response (0 = default 30s)
+	connectReason   string        // Justification given at connect time, shown to approvers
+	maxRequestBytes int64         // Largest raw request accepted (0 = unlimited)
 }
 
 // NewHTTPProxy creates a new HTTP proxy
 func NewHTTPProxy(config *config.ConnectionConfig) *HTTPProxy {
-	return &HTTPProxy{
+	p := &HTTPProxy{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second, // Add timeout for HTTPS connections
 		},
 	}
+	p.SetDefaultRequestTimeout(0)
+	return p
 }
 
 // NewHTTPProxyWithWhitelist creates a new HTTP proxy with whitelist support
 func NewHTTPProxyWithWhitelist(config *config.ConnectionConfig, whitelist []string, auditLogPath, username, connectionID string) *HTTPProxy {
-	return &HTTPProxy{
+	p := &HTTPProxy{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second, // Add timeout for HTTPS connections
@@ -51,6 +66,76 @@ func NewHTTPProxyWithWhitelist(config *config.ConnectionConfig, whitelist []stri
 		connectionID: connectionID,
 		approvalMgr:  nil, // Will be set later if approvals are enabled
 	}
+	p.SetDefaultRequestTimeout(0)
+	p.compiledWhitelist()
+	return p
+}
+
+// SetDefaultRequestTimeout sets the response time budget used when the
+// connection has no request_timeout of its own (0 keeps the 30s client timeout)
+func (p *HTTPProxy) SetDefaultRequestTimeout(timeout time.Duration) {
+	if p.config.RequestTimeout > 0 {
+		timeout = p.config.RequestTimeout
+	}
+	p.requestTimeout = timeout
+	if timeout > 0 {
+		// The context deadline bounds the request, including reading the body
+		p.client.Timeout = 0
+	}
+}
+
+// SetConnectReason sets the justification given at connect time, included in approval requests
+func (p *HTTPProxy) SetConnectReason(reason string) {
+	p.connectReason = reason
+}
+
+type clientSchemeContextKey struct{}
+
+// WithClientScheme returns a context carrying the scheme ("http" or "https") the client
+// used to reach the API. Streams hand the proxy synthetic requests whose own TLS state
+// says nothing about the client's, so X-Forwarded-Proto comes from here when set.
+func WithClientScheme(ctx context.Context, scheme string) context.Context {
+	return context.WithValue(ctx, clientSchemeContextKey{}, scheme)
+}
+
+// clientScheme returns the scheme set with WithClientScheme, else the request's own
+func clientScheme(r *http.Request) string {
+	if scheme, _ := r.Context().Value(clientSchemeContextKey{}).(string); scheme != "" {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// setForwardedHeaders tells the backend who a request is really from: the client's IP is
+// appended to X-Forwarded-For (hops the client listed are kept), X-Forwarded-Proto and
+// X-Forwarded-Host carry what the client asked for, and X-PA-User the authenticated user,
+// replacing whatever the client sent
+func setForwardedHeaders(out, in *http.Request, host, username string) {
+	clientIP, _, err := net.SplitHostPort(in.RemoteAddr)
+	if err != nil {
+		clientIP = in.RemoteAddr
+	}
+	if clientIP != "" {
+		if prior := out.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		out.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	out.Header.Set("X-Forwarded-Proto", clientScheme(in))
+	if host != "" {
+		out.Header.Set("X-Forwarded-Host", host)
+	}
+	out.Header.Set("X-PA-User", username)
+}
+
+// SetMaxRequestBytes sets the largest raw HTTP request (headers and body) the proxy
+// buffers; larger requests are answered with 413 (0 = unlimited)
+func (p *HTTPProxy) SetMaxRequestBytes(limit int64) {
+	p.maxRequestBytes = limit
 }
 
 // SetApprovalManager sets the approval manager for this proxy
@@ -61,7 +146,15 @@ func (p *HTTPProxy) SetApprovalManager(mgr *approval.Manager) {
 // HandleRequest proxies HTTP requests
 func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
 	// Read the raw HTTP request from the body
-	body, err := io.ReadAll(r.Body)
+	body, err := ReadAllLimited(r.Body, r.ContentLength, p.maxRequestBytes)
+	var tooLarge *RequestTooLargeError
+	if errors.As(err, &tooLarge) {
+		if p.auditLogPath != "" {
+			LogRequestTooLarge(p.auditLogPath, p.username, p.config.Name, p.connectionID, "http", tooLarge, nil)
+		}
+		WriteRequestTooLarge(w, tooLarge)
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read request body: %w", err)
 	}
@@ -106,17 +199,45 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Validate request against whitelist if configured
-	if len(p.whitelist) > 0 {
-		requestPattern := fmt.Sprintf("%s %s", method, path)
+	requestPattern := fmt.Sprintf("%s %s", method, path)
+
+	// Blacklisted requests are denied even when whitelisted
+	if pattern, blacklisted := blacklistMatch(p.whitelistSource, requestPattern); blacklisted && p.isRequestAllowed(requestPattern) {
+		if p.auditLogPath != "" {
+			_ = audit.Log(p.auditLogPath, p.username, "blacklist_block", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"protocol":      "http",
+				"method":        method,
+				"path":          path,
+				"pattern":       pattern,
+			})
+		}
+		p.logDecision(requestPattern, audit.DecisionDeny, "blacklist_block")
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":"Request blocked by security policy","message":"This HTTP request matches the blacklist"}`))
+		return fmt.Errorf("request blocked by blacklist: %s %s", method, path)
+	}
+
+	if len(p.currentWhitelist()) == 0 {
+		p.logDecision(requestPattern, audit.DecisionAllow, whitelistAllowReason(nil, nil, requestPattern))
+	} else {
 		if !p.isRequestAllowed(requestPattern) {
 			// Log blocked request
 			if p.auditLogPath != "" {
-				_ = audit.Log(p.auditLogPath, p.username, "http_request_blocked", p.config.Name, map[string]interface{}{
+				metadata := map[string]interface{}{
 					"connection_id": p.connectionID,
 					"method":        method,
 					"path":          path,
 					"reason":        "does not match whitelist",
-				})
+				}
+				if window := p.excludedWindow(requestPattern); window != "" {
+					metadata["reason"] = "outside time window"
+					metadata["time_window"] = window
+				}
+				_ = audit.Log(p.auditLogPath, p.username, "http_request_blocked", p.config.Name, metadata)
+				p.logDecision(requestPattern, audit.DecisionDeny, metadata["reason"].(string))
 			}
 
 			// Add CORS headers even for blocked requests
@@ -131,6 +252,7 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 		}
 
 		// Log allowed request
+		p.logDecision(requestPattern, audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), requestPattern))
 		if p.auditLogPath != "" {
 			_ = audit.Log(p.auditLogPath, p.username, "http_request", p.config.Name, map[string]interface{}{
 				"connection_id": p.connectionID,
@@ -147,24 +269,31 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 		if requiresApproval {
 			// Request approval
 			approvalReq := &approval.Request{
-				Username:     p.username,
-				ConnectionID: p.connectionID,
-				Method:       method,
-				Path:         path,
+				Username:          p.username,
+				ConnectionID:      p.connectionID,
+				Method:            method,
+				Path:              path,
+				Tags:              p.config.Tags,
+				RequiredApprovals: p.approvalMgr.RequiredApprovals(method, path, p.config.Tags),
+				Escalation:        p.approvalMgr.EscalationFor(method, path, p.config.Tags),
+				ApprovalCache:     p.approvalMgr.ApprovalCacheFor(method, path, p.config.Tags),
 				Metadata: map[string]string{
 					"connection_name": p.config.Name,
 					"connection_type": p.config.Type,
 				},
 			}
+			if p.connectReason != "" {
+				approvalReq.Metadata["reason"] = p.connectReason
+			}
 
 			// Log approval request
 			if p.auditLogPath != "" {
-				_ = audit.Log(p.auditLogPath, p.username, "http_approval_requested", p.config.Name, map[string]interface{}{
+				_ = audit.Log(p.auditLogPath, p.username, "http_approval_requested", p.config.Name, tracing.Annotate(r.Context(), map[string]interface{}{
 					"connection_id": p.connectionID,
 					"method":        method,
 					"path":          path,
 					"timeout":       timeout.String(),
-				})
+				}))
 			}
 
 			// Wait for approval with timeout
@@ -187,14 +316,16 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 			if approvalResp.Decision != approval.DecisionApproved {
 				// Log rejection/timeout
 				if p.auditLogPath != "" {
-					_ = audit.Log(p.auditLogPath, p.username, "http_approval_rejected", p.config.Name, map[string]interface{}{
+					_ = audit.Log(p.auditLogPath, p.username, "http_approval_rejected", p.config.Name, tracing.Annotate(r.Context(), map[string]interface{}{
 						"connection_id": p.connectionID,
 						"method":        method,
 						"path":          path,
 						"decision":      approvalResp.Decision,
 						"reason":        approvalResp.Reason,
 						"rejected_by":   approvalResp.ApprovedBy,
-					})
+						"channel":       approvalResp.Channel,
+						"ledger":        approvalResp.Ledger,
+					}))
 				}
 
 				// Add CORS headers
@@ -209,12 +340,14 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 
 			// Log approval success
 			if p.auditLogPath != "" {
-				_ = audit.Log(p.auditLogPath, p.username, "http_approval_granted", p.config.Name, map[string]interface{}{
+				_ = audit.Log(p.auditLogPath, p.username, "http_approval_granted", p.config.Name, tracing.Annotate(r.Context(), map[string]interface{}{
 					"connection_id": p.connectionID,
 					"method":        method,
 					"path":          path,
 					"approved_by":   approvalResp.ApprovedBy,
-				})
+					"channel":       approvalResp.Channel,
+					"ledger":        approvalResp.Ledger,
+				}))
 			}
 		}
 	}
@@ -267,18 +400,52 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 			proxyReq.Header.Add(key, value)
 		}
 	}
+	if p.config.ForwardedHeaders {
+		setForwardedHeaders(proxyReq, r, headers.Get("Host"), p.username)
+	}
 
 	// Execute request with context timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	timeout := p.requestTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
-	proxyReq = proxyReq.WithContext(ctx)
 
+	// Record which backend address actually served the request (after DNS and connection reuse)
+	var backendAddr string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			backendAddr = ResolvedBackendAddr(info.Conn)
+		},
+	}
+	proxyReq = proxyReq.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	started := time.Now()
 	resp, err := p.client.Do(proxyReq)
 	if err != nil {
+		if p.requestTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			p.logRequestTimeout(method, path, started, false)
+
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(`{"error":"Gateway timeout","message":"The backend did not respond within the request timeout"}`))
+			return fmt.Errorf("request timed out after %s: %s %s", p.requestTimeout, method, path)
+		}
 		return fmt.Errorf("failed to execute proxy request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if p.auditLogPath != "" {
+		_ = audit.Log(p.auditLogPath, p.username, "http_response", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"method":        method,
+			"path":          path,
+			"status":        resp.StatusCode,
+			"backend_addr":  backendAddr,
+		})
+	}
+
 	// Add CORS headers (allow all origins for proxied connections)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, HEAD, OPTIONS")
@@ -317,12 +484,14 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 				break
 			}
 			if err != nil {
+				p.checkBodyTimeout(ctx, method, path, started)
 				return fmt.Errorf("failed to read response body: %w", err)
 			}
 		}
 	} else {
 		// Fallback to regular copy for non-flushable responses
 		if _, err := io.Copy(w, resp.Body); err != nil {
+			p.checkBodyTimeout(ctx, method, path, started)
 			return fmt.Errorf("failed to copy response body: %w", err)
 		}
 	}
@@ -330,38 +499,90 @@ func (p *HTTPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// checkBodyTimeout audits a request timeout hit while streaming the response body.
+// The status line has already been sent, so the client just sees a truncated body.
+func (p *HTTPProxy) checkBodyTimeout(ctx context.Context, method, path string, started time.Time) {
+	if p.requestTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.logRequestTimeout(method, path, started, true)
+	}
+}
+
+// logRequestTimeout audits a backend response that exceeded the request timeout
+func (p *HTTPProxy) logRequestTimeout(method, path string, started time.Time, partial bool) {
+	if p.auditLogPath == "" {
+		return
+	}
+	_ = audit.Log(p.auditLogPath, p.username, "http_request_timeout", p.config.Name, map[string]interface{}{
+		"connection_id":    p.connectionID,
+		"method":           method,
+		"path":             path,
+		"timeout":          p.requestTimeout.String(),
+		"elapsed":          time.Since(started).Round(time.Millisecond).String(),
+		"partial_response": partial,
+	})
+}
+
 // Close closes the HTTP proxy
 func (p *HTTPProxy) Close() error {
 	p.client.CloseIdleConnections()
 	return nil
 }
 
+// logDecision records a per-request whitelist decision in the decision log
+func (p *HTTPProxy) logDecision(request, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "http_request",
+		Resource:     p.config.Name,
+		Request:      request,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
+}
+
 // isRequestAllowed checks if an HTTP request matches the whitelist
-// Pattern format: "METHOD /path/pattern"
-// Examples: "GET /api/.*", "POST /api/users", "GET /api/users/[0-9]+"
 func (p *HTTPProxy) isRequestAllowed(request string) bool {
-	if len(p.whitelist) == 0 {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
 		return true // No whitelist means everything is allowed
 	}
 
-	for _, pattern := range p.whitelist {
-		// Make pattern case-insensitive for the HTTP method part
-		re, err := regexp.Compile("(?i)" + pattern)
-		if err != nil {
-			// Log error and skip this pattern
-			if p.auditLogPath != "" {
-				_ = audit.Log(p.auditLogPath, p.username, "http_whitelist_error", p.config.Name, map[string]interface{}{
-					"pattern": pattern,
-					"error":   err.Error(),
-				})
-			}
-			continue
-		}
+	// Resolved whitelists were compiled (and invalid patterns logged) by the authorizer
+	patterns := p.compiledWhitelist()
+	if p.whitelistSource != nil {
+		patterns, _ = authorization.CompileWhitelist(whitelist)
+	}
 
-		if re.MatchString(request) {
+	// Case-insensitive for the HTTP method part; AND groups must match entirely
+	for _, pattern := range patterns {
+		if pattern.Match(request) {
 			return true
 		}
 	}
 
 	return false
 }
+
+// compiledWhitelist compiles the fixed whitelist on first use
+// Invalid patterns are audited once here and skipped for every request.
+func (p *HTTPProxy) compiledWhitelist() []*authorization.Pattern {
+	p.compileOnce.Do(func() {
+		var errs []error
+		p.patterns, errs = authorization.CompileWhitelist(p.whitelist)
+		for _, err := range errs {
+			if p.auditLogPath == "" {
+				continue
+			}
+			var patternErr *authorization.PatternError
+			if errors.As(err, &patternErr) {
+				_ = audit.Log(p.auditLogPath, p.username, "http_whitelist_error", p.config.Name, map[string]interface{}{
+					"pattern": patternErr.Pattern,
+					"error":   patternErr.Err.Error(),
+				})
+			}
+		}
+	})
+	return p.patterns
+}
@@ -2,9 +2,13 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -309,6 +313,88 @@ func TestHTTPProxy_HandleRequest_WithWhitelist(t *testing.T) {
 	}
 }
 
+func TestHTTPProxy_HandleRequest_AuditsBackendAddr(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	addr := backend.Listener.Addr().(*net.TCPAddr)
+
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.ConnectionConfig{Name: "test-api", Type: "http", Host: "localhost", Port: addr.Port, Scheme: "http"}
+	proxy := NewHTTPProxyWithWhitelist(cfg, nil, auditLog, "testuser", "conn-123")
+
+	req := httptest.NewRequest("POST", "/proxy/conn-123", bytes.NewBufferString("GET /api/users HTTP/1.1\r\n\r\n"))
+	if err := proxy.HandleRequest(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(auditLog)
+	if !strings.Contains(string(content), `"backend_addr":"`+addr.String()+`"`) {
+		t.Errorf("audit log missing resolved backend address %s: %s", addr, content)
+	}
+}
+
+func TestHTTPProxy_HandleRequest_ForwardedHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	addr := backend.Listener.Addr().(*net.TCPAddr)
+
+	rawRequest := "GET /api/users HTTP/1.1\r\nHost: api.internal\r\nX-Forwarded-For: 10.0.0.1\r\nX-PA-User: admin\r\n\r\n"
+	for _, enabled := range []bool{false, true} {
+		got = nil
+		cfg := &config.ConnectionConfig{Name: "test-api", Type: "http", Host: "localhost", Port: addr.Port, Scheme: "http", ForwardedHeaders: enabled}
+		proxy := NewHTTPProxyWithWhitelist(cfg, nil, t.TempDir()+"/audit.log", "alice", "conn-123")
+
+		req := httptest.NewRequest("POST", "/proxy/conn-123", bytes.NewBufferString(rawRequest))
+		req.RemoteAddr = "203.0.113.7:51234"
+		if err := proxy.HandleRequest(httptest.NewRecorder(), req); err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+
+		if !enabled {
+			// Headers pass through untouched
+			if got.Get("X-Forwarded-For") != "10.0.0.1" || got.Get("X-PA-User") != "admin" || got.Get("X-Forwarded-Proto") != "" {
+				t.Errorf("forwarded_headers off: backend got %v", got)
+			}
+			continue
+		}
+		if xff := got.Get("X-Forwarded-For"); xff != "10.0.0.1, 203.0.113.7" {
+			t.Errorf("X-Forwarded-For = %q, want the client IP appended", xff)
+		}
+		if proto := got.Get("X-Forwarded-Proto"); proto != "http" {
+			t.Errorf("X-Forwarded-Proto = %q, want http", proto)
+		}
+		if host := got.Get("X-Forwarded-Host"); host != "api.internal" {
+			t.Errorf("X-Forwarded-Host = %q, want api.internal", host)
+		}
+		if user := got.Values("X-PA-User"); len(user) != 1 || user[0] != "alice" {
+			t.Errorf("X-PA-User = %v, want only the authenticated user", user)
+		}
+	}
+
+	// A TLS client request, and a synthetic stream request carrying the client's scheme
+	cfg := &config.ConnectionConfig{Name: "test-api", Type: "http", Host: "localhost", Port: addr.Port, Scheme: "http", ForwardedHeaders: true}
+	proxy := NewHTTPProxyWithWhitelist(cfg, nil, t.TempDir()+"/audit.log", "alice", "conn-123")
+	tlsReq := httptest.NewRequest("POST", "/proxy/conn-123", bytes.NewBufferString(rawRequest))
+	tlsReq.TLS = &tls.ConnectionState{}
+	streamReq := httptest.NewRequest("POST", "/", bytes.NewBufferString(rawRequest))
+	streamReq = streamReq.WithContext(WithClientScheme(streamReq.Context(), "https"))
+	for _, req := range []*http.Request{tlsReq, streamReq} {
+		got = nil
+		if err := proxy.HandleRequest(httptest.NewRecorder(), req); err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if proto := got.Get("X-Forwarded-Proto"); proto != "https" {
+			t.Errorf("X-Forwarded-Proto = %q, want https", proto)
+		}
+	}
+}
+
 func BenchmarkHTTPProxy_isRequestAllowed(b *testing.B) {
 	tmpFile, _ := os.CreateTemp("", "audit-*.log")
 	defer func() { _ = os.Remove(tmpFile.Name()) }()
@@ -355,3 +441,36 @@ func BenchmarkHTTPProxy_isRequestAllowed_NoMatch(b *testing.B) {
 	}
 }
 
+
+func TestHTTPProxy_InvalidRegexLoggedOnce(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	proxy := NewHTTPProxyWithWhitelist(&config.ConnectionConfig{Name: "test-api", Type: "http"},
+		[]string{"[invalid regex", "^GET /api/.*"}, auditLog, "testuser", "conn-123")
+
+	for i := 0; i < 3; i++ {
+		if !proxy.isRequestAllowed("GET /api/users") {
+			t.Fatal("valid pattern should still allow the request")
+		}
+	}
+
+	content, _ := os.ReadFile(auditLog)
+	if got := strings.Count(string(content), "http_whitelist_error"); got != 1 {
+		t.Errorf("http_whitelist_error logged %d times, want once when building the proxy", got)
+	}
+}
+
+// BenchmarkHTTPProxy_isRequestAllowed_Recompile is the baseline for BenchmarkHTTPProxy_isRequestAllowed:
+// the same whitelist check compiling every pattern per request
+func BenchmarkHTTPProxy_isRequestAllowed_Recompile(b *testing.B) {
+	whitelist := []string{"^GET /api/.*", "^POST /api/users", "^PUT /api/users/[0-9]+"}
+	request := "GET /api/users/123"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pattern := range whitelist {
+			if matched, _ := regexp.MatchString("(?i)"+pattern, request); matched {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestHTTPProxy_RequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"message":"success"}`))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	host, portStr, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	port, _ := strconv.Atoi(portStr)
+
+	tests := []struct {
+		name           string
+		connTimeout    time.Duration
+		defaultTimeout time.Duration
+		path           string
+		wantStatus     int
+		wantErr        bool
+		wantAudit      bool
+	}{
+		{
+			name:        "connection timeout exceeded",
+			connTimeout: 50 * time.Millisecond,
+			path:        "/slow",
+			wantStatus:  http.StatusGatewayTimeout,
+			wantErr:     true,
+			wantAudit:   true,
+		},
+		{
+			name:           "server default timeout exceeded",
+			defaultTimeout: 50 * time.Millisecond,
+			path:           "/slow",
+			wantStatus:     http.StatusGatewayTimeout,
+			wantErr:        true,
+			wantAudit:      true,
+		},
+		{
+			name:           "connection timeout overrides default",
+			connTimeout:    5 * time.Second,
+			defaultTimeout: 50 * time.Millisecond,
+			path:           "/fast",
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:        "fast response within timeout",
+			connTimeout: time.Second,
+			path:        "/fast",
+			wantStatus:  http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, _ := os.CreateTemp("", "audit-*.log")
+			defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+			cfg := &config.ConnectionConfig{
+				Name:           "test-api",
+				Type:           "http",
+				Host:           host,
+				Port:           port,
+				Scheme:         "http",
+				RequestTimeout: tt.connTimeout,
+			}
+			proxy := NewHTTPProxyWithWhitelist(cfg, nil, tmpFile.Name(), "testuser", "conn-123")
+			proxy.SetDefaultRequestTimeout(tt.defaultTimeout)
+
+			req := httptest.NewRequest("POST", "/proxy/conn-123", bytes.NewBufferString("GET "+tt.path+" HTTP/1.1\r\n\r\n"))
+			w := httptest.NewRecorder()
+
+			err := proxy.HandleRequest(w, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			logged, _ := os.ReadFile(tmpFile.Name())
+			if got := strings.Contains(string(logged), "http_request_timeout"); got != tt.wantAudit {
+				t.Errorf("http_request_timeout audited = %v, want %v", got, tt.wantAudit)
+			}
+		})
+	}
+}
@@ -0,0 +1,589 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// kafkaBackendTimeout bounds dialing a broker and discovering the cluster's brokers
+const kafkaBackendTimeout = 10 * time.Second
+
+// KafkaProxy proxies Kafka client connections with topic-level whitelisting.
+// Produce, Fetch and ListOffsets are checked once per topic as "<Api> <topic>"
+// (e.g. "Fetch events.clicks"); other requests are checked by API name alone
+// (e.g. "OffsetCommit"). Denied topic requests get TOPIC_AUTHORIZATION_FAILED
+// responses, denied topics are dropped from Metadata requests and responses
+// (a topic is listed when "Metadata <topic>" is allowed), and other denied
+// requests close the connection. ApiVersions is always allowed.
+//
+// Each tunnel stream targets one broker. The client opens a local listener per
+// broker and tells the proxy their addresses (KafkaStream), and broker hosts in
+// Metadata and FindCoordinator responses are rewritten to those listeners, so
+// clients never connect to brokers directly.
+type KafkaProxy struct {
+	config       *config.ConnectionConfig
+	whitelist    []string
+	auditLogPath string
+	username     string
+	connectionID string
+
+	mu          sync.Mutex
+	backendAddr string           // Resolved backend address of the latest stream, for audit records
+	brokers     map[int32]string // Real broker addresses by node ID, learned from Metadata responses
+
+	whitelistSource WhitelistSource // Resolves time-scoped whitelists per request (optional)
+}
+
+// KafkaStream describes a tunnel stream: the broker it targets and where the
+// client listens for each broker. Without listeners, broker addresses in
+// responses are passed through unchanged.
+type KafkaStream struct {
+	BrokerID  int32            // Target broker node ID, or -1 for the configured bootstrap broker
+	Bootstrap string           // Client-side address of the bootstrap listener
+	Listeners map[int32]string // Client-side address per broker node ID
+}
+
+// NewKafkaProxy creates a Kafka proxy with whitelist support
+func NewKafkaProxy(cfg *config.ConnectionConfig, whitelist []string, auditLogPath, username, connectionID string) *KafkaProxy {
+	return &KafkaProxy{
+		config:       cfg,
+		whitelist:    whitelist,
+		auditLogPath: auditLogPath,
+		username:     username,
+		connectionID: connectionID,
+		brokers:      make(map[int32]string),
+	}
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per request instead of using a fixed list
+func (p *KafkaProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next request
+func (p *KafkaProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// HandleRequest is not supported: Kafka is served over the proxy stream with HandleConnection
+func (p *KafkaProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
+	return fmt.Errorf("kafka connections are served over the proxy stream")
+}
+
+// Close releases resources held by the proxy
+func (p *KafkaProxy) Close() error {
+	return nil
+}
+
+// BackendAddr returns the resolved backend address of the latest stream, or "" before it is known
+func (p *KafkaProxy) BackendAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.backendAddr
+}
+
+// KafkaBrokers returns the node IDs of a connection's brokers, as reported by its bootstrap broker
+func KafkaBrokers(cfg *config.ConnectionConfig) ([]int32, error) {
+	brokers, err := discoverKafkaBrokers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int32, 0, len(brokers))
+	for id := range brokers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// discoverKafkaBrokers asks the bootstrap broker for the cluster's broker addresses
+func discoverKafkaBrokers(cfg *config.ConnectionConfig) (map[int32]string, error) {
+	conn, err := DialBackend(cfg, kafkaBackendTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetDeadline(time.Now().Add(kafkaBackendTimeout))
+	if err := writeKafkaFrame(conn, kafkaMetadataRequest(1)); err != nil {
+		return nil, fmt.Errorf("failed to send metadata request: %w", err)
+	}
+	frame, err := readKafkaFrame(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata response: %w", err)
+	}
+	resp, err := parseKafkaMetadataResponse(frame, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	brokers := make(map[int32]string, len(resp.brokers))
+	for _, broker := range resp.brokers {
+		brokers[broker.nodeID] = broker.addr()
+	}
+	return brokers, nil
+}
+
+// brokerAddr returns the real address of a broker, refreshing the cluster's brokers if it isn't known yet
+func (p *KafkaProxy) brokerAddr(nodeID int32) (string, error) {
+	p.mu.Lock()
+	addr, ok := p.brokers[nodeID]
+	p.mu.Unlock()
+	if ok {
+		return addr, nil
+	}
+
+	brokers, err := discoverKafkaBrokers(p.config)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, brokerAddr := range brokers {
+		p.brokers[id] = brokerAddr
+	}
+	if addr, ok := p.brokers[nodeID]; ok {
+		return addr, nil
+	}
+	return "", fmt.Errorf("unknown kafka broker %d", nodeID)
+}
+
+// rememberBroker records a broker's real address from a response
+func (p *KafkaProxy) rememberBroker(broker kafkaBroker) {
+	p.mu.Lock()
+	p.brokers[broker.nodeID] = broker.addr()
+	p.mu.Unlock()
+}
+
+// dialStreamBackend connects to the broker a stream targets
+func (p *KafkaProxy) dialStreamBackend(stream KafkaStream) (net.Conn, error) {
+	if stream.BrokerID < 0 {
+		return DialBackend(p.config, kafkaBackendTimeout)
+	}
+
+	addr, err := p.brokerAddr(stream.BrokerID)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := BackendTLSConfig(p.config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		// Each broker presents its own certificate
+		host, _, _ := net.SplitHostPort(addr)
+		tlsConfig.ServerName = host
+	}
+	return dialBackendAddr(p.config.Type, addr, tlsConfig, kafkaBackendTimeout)
+}
+
+// HandleConnection proxies one client connection (a tunnel stream) to the broker it targets until either side closes
+func (p *KafkaProxy) HandleConnection(clientConn net.Conn, stream KafkaStream) error {
+	backendConn, err := p.dialStreamBackend(stream)
+	if err != nil {
+		return fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	p.mu.Lock()
+	p.backendAddr = ResolvedBackendAddr(backendConn)
+	p.mu.Unlock()
+
+	s := &kafkaSession{proxy: p, client: clientConn, backend: backendConn, stream: stream}
+
+	responsesDone := make(chan error, 1)
+	go func() {
+		responsesDone <- s.relayResponses()
+		_ = clientConn.Close()
+	}()
+
+	err = s.relayRequests()
+	_ = backendConn.Close()
+	responseErr := <-responsesDone
+
+	if err == nil || isClosedErr(err) {
+		err = responseErr
+	}
+	if err == nil || isClosedErr(err) {
+		return nil
+	}
+	return err
+}
+
+// isClosedErr reports whether err just means one side of the stream went away
+func isClosedErr(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// kafkaSession relays one client connection. Kafka answers requests in order,
+// so responses the proxy synthesizes for denied requests are queued behind the
+// broker responses still in flight.
+type kafkaSession struct {
+	proxy   *KafkaProxy
+	client  net.Conn
+	backend net.Conn
+	stream  KafkaStream
+
+	mu      sync.Mutex // Guards pending and writes to client
+	pending []*kafkaPending
+}
+
+// kafkaPending is a request awaiting its response, in the order responses are due
+type kafkaPending struct {
+	req      *kafkaRequest
+	response []byte // Synthesized response, or nil while the broker's response is awaited
+}
+
+// relayRequests authorizes client requests and forwards the allowed ones to the broker
+func (s *kafkaSession) relayRequests() error {
+	p := s.proxy
+	for {
+		frame, err := readKafkaFrame(s.client)
+		if err != nil {
+			return err
+		}
+
+		req, err := parseKafkaRequest(frame)
+		if err != nil {
+			p.logBlocked(nil, "", err.Error())
+			return fmt.Errorf("kafka request blocked: %w", err)
+		}
+
+		filtered, reason := p.authorize(req)
+		if reason != "" {
+			response := kafkaAuthorizationError(req)
+			if response == nil && req.expectsResponse() {
+				return fmt.Errorf("kafka request blocked: %s %s", req.api(), reason)
+			}
+			if response != nil {
+				s.respond(&kafkaPending{req: req, response: response})
+			}
+			continue
+		}
+
+		switch req.apiKey {
+		case kafkaMetadata:
+			if len(filtered) > 0 {
+				if frame, err = req.withMetadataTopics(frame, allowedTopics(req, filtered)); err != nil {
+					p.logBlocked(req, req.api(), err.Error())
+					return fmt.Errorf("kafka request blocked: %w", err)
+				}
+			}
+		case kafkaFetch:
+			frame = req.withoutFetchSession(frame)
+		}
+		p.logRequest(req, filtered)
+
+		if req.expectsResponse() {
+			s.mu.Lock()
+			s.pending = append(s.pending, &kafkaPending{req: req})
+			s.mu.Unlock()
+		}
+		if err := writeKafkaFrame(s.backend, frame); err != nil {
+			return err
+		}
+	}
+}
+
+// respond sends a synthesized response, after any broker responses still due before it
+func (s *kafkaSession) respond(pending *kafkaPending) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		_ = writeKafkaFrame(s.client, pending.response)
+		return
+	}
+	s.pending = append(s.pending, pending)
+}
+
+// relayResponses forwards broker responses to the client, rewriting the ones
+// that carry broker addresses or topic lists
+func (s *kafkaSession) relayResponses() error {
+	for {
+		frame, err := readKafkaFrame(s.backend)
+		if err != nil {
+			return err
+		}
+
+		// The head stays queued until its response is written, so respond()
+		// can't slip a synthesized response in ahead of it
+		s.mu.Lock()
+		if len(s.pending) == 0 || s.pending[0].response != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("unexpected kafka response")
+		}
+		head := s.pending[0]
+		s.mu.Unlock()
+
+		if correlationID := int32(binary.BigEndian.Uint32(frame)); correlationID != head.req.correlationID {
+			return fmt.Errorf("kafka response %d does not match request %d", correlationID, head.req.correlationID)
+		}
+		if frame, err = s.rewriteResponse(head.req, frame); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		err = writeKafkaFrame(s.client, frame)
+		s.pending = s.pending[1:]
+		for err == nil && len(s.pending) > 0 && s.pending[0].response != nil {
+			err = writeKafkaFrame(s.client, s.pending[0].response)
+			s.pending = s.pending[1:]
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteResponse clamps ApiVersions, filters Metadata topics and points broker
+// addresses at the client's listeners. Responses the proxy can't decode are
+// not forwarded, so topics and broker addresses never leak.
+func (s *kafkaSession) rewriteResponse(req *kafkaRequest, frame []byte) ([]byte, error) {
+	switch req.apiKey {
+	case kafkaAPIVersions:
+		if err := clampKafkaAPIVersions(frame, req.apiVersion); err != nil {
+			return nil, fmt.Errorf("invalid ApiVersions response: %w", err)
+		}
+
+	case kafkaMetadata:
+		resp, err := parseKafkaMetadataResponse(frame, req.apiVersion)
+		if err != nil {
+			return nil, err
+		}
+		for i, broker := range resp.brokers {
+			s.proxy.rememberBroker(broker)
+			resp.brokers[i] = s.advertise(broker)
+		}
+		topics := resp.topics[:0]
+		for _, topic := range resp.topics {
+			if s.proxy.requestReason(kafkaRequestString("Metadata", topic.name)) == "" {
+				topics = append(topics, topic)
+			}
+		}
+		resp.topics = topics
+		return resp.encode(req.correlationID, req.apiVersion), nil
+
+	case kafkaFindCoordinator:
+		resp, err := parseKafkaCoordinatorResponse(frame, req.apiVersion)
+		if err != nil {
+			return nil, err
+		}
+		if resp.errorCode == 0 {
+			s.proxy.rememberBroker(resp.broker)
+			resp.broker = s.advertise(resp.broker)
+		}
+		return resp.encode(req.correlationID, req.apiVersion), nil
+	}
+	return frame, nil
+}
+
+// advertise replaces a broker's address with the client-side listener for it
+// (the bootstrap listener for brokers without one)
+func (s *kafkaSession) advertise(broker kafkaBroker) kafkaBroker {
+	addr, ok := s.stream.Listeners[broker.nodeID]
+	if !ok {
+		addr = s.stream.Bootstrap
+	}
+	if addr == "" {
+		return broker
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return broker
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return broker
+	}
+	broker.host, broker.port = host, int32(port)
+	return broker
+}
+
+// kafkaRequestString is the string a request is whitelisted as
+func kafkaRequestString(api, topic string) string {
+	if topic == "" {
+		return api
+	}
+	return api + " " + topic
+}
+
+// authorize checks a request against the whitelist and blacklist. It returns
+// the Metadata topics to drop from an otherwise allowed request, or the reason
+// the whole request is blocked (audited before returning).
+func (p *KafkaProxy) authorize(req *kafkaRequest) (map[string]string, string) {
+	switch req.apiKey {
+	case kafkaAPIVersions:
+		return nil, ""
+
+	case kafkaMetadata:
+		filtered := make(map[string]string)
+		for _, topic := range req.topics {
+			if reason := p.requestReason(kafkaRequestString("Metadata", topic.name)); reason != "" {
+				filtered[topic.name] = reason
+			}
+		}
+		return filtered, ""
+
+	case kafkaProduce, kafkaFetch, kafkaListOffsets:
+		for _, topic := range req.topics {
+			request := kafkaRequestString(req.api(), topic.name)
+			if reason := p.requestReason(request); reason != "" {
+				p.logBlocked(req, request, reason)
+				return nil, reason
+			}
+		}
+		return nil, ""
+	}
+
+	if reason := p.requestReason(req.api()); reason != "" {
+		p.logBlocked(req, req.api(), reason)
+		return nil, reason
+	}
+	return nil, ""
+}
+
+// allowedTopics lists a Metadata request's topics that were not filtered
+func allowedTopics(req *kafkaRequest, filtered map[string]string) []string {
+	var topics []string
+	for _, name := range req.topicNames() {
+		if _, denied := filtered[name]; !denied {
+			topics = append(topics, name)
+		}
+	}
+	return topics
+}
+
+// requestReason returns why a request string is blocked, or "" when it is allowed
+func (p *KafkaProxy) requestReason(request string) string {
+	if !p.isRequestAllowed(request) {
+		if window := p.excludedWindow(request); window != "" {
+			return "outside time window"
+		}
+		return "does not match whitelist"
+	}
+	if _, blacklisted := blacklistMatch(p.whitelistSource, request); blacklisted {
+		return "blacklist_block"
+	}
+	return ""
+}
+
+// logRequest audits a forwarded request with the topics it touches
+func (p *KafkaProxy) logRequest(req *kafkaRequest, filtered map[string]string) {
+	metadata := map[string]interface{}{
+		"connection_id": p.connectionID,
+		"api":           req.api(),
+		"api_version":   req.apiVersion,
+		"client_id":     req.clientID,
+		"backend_addr":  p.BackendAddr(),
+	}
+	if len(req.topics) > 0 {
+		metadata["topics"] = allowedTopics(req, filtered)
+	}
+	if len(filtered) > 0 {
+		metadata["filtered_topics"] = filtered
+	}
+	_ = audit.Log(p.auditLogPath, p.username, "kafka_request", p.config.Name, metadata)
+
+	if len(req.topics) == 0 {
+		p.logDecision(req.api(), audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), req.api()))
+		return
+	}
+	for _, topic := range req.topics {
+		request := kafkaRequestString(req.api(), topic.name)
+		if reason, denied := filtered[topic.name]; denied {
+			p.logDecision(request, audit.DecisionDeny, reason)
+		} else {
+			p.logDecision(request, audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), request))
+		}
+	}
+}
+
+// logBlocked audits a blocked request; req is nil for requests that could not be parsed
+func (p *KafkaProxy) logBlocked(req *kafkaRequest, request, reason string) {
+	action := "kafka_request_blocked"
+	metadata := map[string]interface{}{
+		"connection_id": p.connectionID,
+		"reason":        reason,
+		"backend_addr":  p.BackendAddr(),
+	}
+	if req != nil {
+		metadata["api"] = req.api()
+		metadata["api_version"] = req.apiVersion
+		metadata["client_id"] = req.clientID
+		metadata["request"] = request
+		if len(req.topics) > 0 {
+			metadata["topics"] = req.topicNames()
+		}
+	}
+	if reason == "outside time window" {
+		metadata["time_window"] = p.excludedWindow(request)
+	}
+	if pattern, blacklisted := blacklistMatch(p.whitelistSource, request); blacklisted && reason == "blacklist_block" {
+		action = "blacklist_block"
+		metadata["protocol"] = "kafka"
+		metadata["pattern"] = pattern
+	}
+	_ = audit.Log(p.auditLogPath, p.username, action, p.config.Name, metadata)
+	p.logDecision(request, audit.DecisionDeny, reason)
+}
+
+// excludedWindow returns the time window that excluded a blocked request, if any
+func (p *KafkaProxy) excludedWindow(request string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(request)
+}
+
+// isRequestAllowed checks a request string against the whitelist
+func (p *KafkaProxy) isRequestAllowed(request string) bool {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
+		return true // No whitelist means everything is allowed
+	}
+
+	request = strings.TrimSpace(request)
+	for _, pattern := range whitelist {
+		matched, err := authorization.MatchPattern(pattern, request)
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "kafka_whitelist_error", p.config.Name, map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// logDecision records a per-request whitelist decision in the decision log
+func (p *KafkaProxy) logDecision(request, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "kafka_request",
+		Resource:     p.config.Name,
+		Request:      request,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
+}
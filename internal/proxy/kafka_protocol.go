@@ -0,0 +1,689 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Kafka API keys the proxy inspects
+const (
+	kafkaProduce         int16 = 0
+	kafkaFetch           int16 = 1
+	kafkaListOffsets     int16 = 2
+	kafkaMetadata        int16 = 3
+	kafkaFindCoordinator int16 = 10
+	kafkaAPIVersions     int16 = 18
+)
+
+// kafkaErrTopicAuthorizationFailed is the TOPIC_AUTHORIZATION_FAILED error code
+const kafkaErrTopicAuthorizationFailed int16 = 29
+
+// kafkaMaxFrameSize bounds a single request or response (the broker's socket.request.max.bytes default)
+const kafkaMaxFrameSize = 100 << 20
+
+// kafkaMaxVersions caps the APIs whose bodies the proxy parses at their last
+// non-flexible version. ApiVersions responses are rewritten to advertise at most
+// these, so clients never send (or expect) a version the proxy can't decode.
+var kafkaMaxVersions = map[int16]int16{
+	kafkaProduce:         8,
+	kafkaFetch:           11,
+	kafkaListOffsets:     5,
+	kafkaMetadata:        8,
+	kafkaFindCoordinator: 2,
+}
+
+// kafkaAPINames names API keys in whitelist requests and audit records
+var kafkaAPINames = map[int16]string{
+	0: "Produce", 1: "Fetch", 2: "ListOffsets", 3: "Metadata", 8: "OffsetCommit", 9: "OffsetFetch",
+	10: "FindCoordinator", 11: "JoinGroup", 12: "Heartbeat", 13: "LeaveGroup", 14: "SyncGroup",
+	15: "DescribeGroups", 16: "ListGroups", 17: "SaslHandshake", 18: "ApiVersions", 19: "CreateTopics",
+	20: "DeleteTopics", 21: "DeleteRecords", 22: "InitProducerId", 23: "OffsetForLeaderEpoch",
+	24: "AddPartitionsToTxn", 25: "AddOffsetsToTxn", 26: "EndTxn", 28: "TxnOffsetCommit",
+	29: "DescribeAcls", 30: "CreateAcls", 31: "DeleteAcls", 32: "DescribeConfigs", 33: "AlterConfigs",
+	36: "SaslAuthenticate", 37: "CreatePartitions", 42: "DeleteGroups", 47: "OffsetDelete", 60: "DescribeCluster",
+}
+
+// kafkaAPIName returns the name of an API key ("ApiKey<n>" for keys the proxy doesn't know)
+func kafkaAPIName(key int16) string {
+	if name, ok := kafkaAPINames[key]; ok {
+		return name
+	}
+	return "ApiKey" + strconv.Itoa(int(key))
+}
+
+var errKafkaTruncated = errors.New("kafka message truncated")
+
+// readKafkaFrame reads one size-prefixed request or response and returns it without the size
+func readKafkaFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := int32(binary.BigEndian.Uint32(size[:]))
+	if n < 4 || n > kafkaMaxFrameSize {
+		return nil, fmt.Errorf("invalid kafka message size %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// writeKafkaFrame writes a request or response with its size prefix
+func writeKafkaFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	_, err := w.Write(buf)
+	return err
+}
+
+// kafkaReader decodes Kafka protocol primitives; after the first error every read returns zero values
+type kafkaReader struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.buf) {
+		r.err = errKafkaTruncated
+		return nil
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// nullableString reads an int16-prefixed string; null reads as ("", false)
+func (r *kafkaReader) nullableString() (string, bool) {
+	n := r.int16()
+	if n < 0 {
+		return "", false
+	}
+	return string(r.take(int(n))), true
+}
+
+func (r *kafkaReader) string() string {
+	s, _ := r.nullableString()
+	return s
+}
+
+// skipBytes skips an int32-prefixed (nullable) byte string
+func (r *kafkaReader) skipBytes() {
+	if n := r.int32(); n > 0 {
+		r.take(int(n))
+	}
+}
+
+// arrayLen reads an array length; null arrays read as -1
+func (r *kafkaReader) arrayLen() int {
+	n := int(r.int32())
+	if n > len(r.buf)-r.off {
+		// Every element takes at least a byte
+		r.err = errKafkaTruncated
+		return 0
+	}
+	return n
+}
+
+func (r *kafkaReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.off:])
+	if n <= 0 {
+		r.err = errKafkaTruncated
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+// skipTaggedFields skips the tagged fields section of a flexible-version structure
+func (r *kafkaReader) skipTaggedFields() {
+	for i := r.uvarint(); i > 0 && r.err == nil; i-- {
+		r.uvarint()
+		r.take(int(r.uvarint()))
+	}
+}
+
+// kafkaWriter encodes Kafka protocol primitives
+type kafkaWriter struct {
+	buf []byte
+}
+
+func (w *kafkaWriter) int8(v int8) { w.buf = append(w.buf, byte(v)) }
+
+func (w *kafkaWriter) int16(v int16) { w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v)) }
+
+func (w *kafkaWriter) int32(v int32) { w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v)) }
+
+func (w *kafkaWriter) int64(v int64) { w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v)) }
+
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *kafkaWriter) nullableString(s string, ok bool) {
+	if !ok {
+		w.int16(-1)
+		return
+	}
+	w.string(s)
+}
+
+func (w *kafkaWriter) raw(b []byte) { w.buf = append(w.buf, b...) }
+
+// kafkaTopic is a topic named in a request, with the partitions it reads or writes
+type kafkaTopic struct {
+	name       string
+	partitions []int32
+}
+
+// kafkaRequest is the part of a client request the proxy authorizes
+type kafkaRequest struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+
+	topics []kafkaTopic
+	acks   int16 // Produce only: 0 means the broker sends no response
+
+	// Metadata only: the topics array spans [topicsStart, topicsEnd) of the frame
+	topicsStart, topicsEnd int
+
+	sessionOffset int // Fetch v7+: offset of the session ID and epoch (0 = none)
+}
+
+// api returns the request's API name
+func (r *kafkaRequest) api() string {
+	return kafkaAPIName(r.apiKey)
+}
+
+// topicNames lists the topics a request names
+func (r *kafkaRequest) topicNames() []string {
+	names := make([]string, 0, len(r.topics))
+	for _, topic := range r.topics {
+		names = append(names, topic.name)
+	}
+	return names
+}
+
+// expectsResponse reports whether the broker answers the request (acks=0 produces get no response)
+func (r *kafkaRequest) expectsResponse() bool {
+	return r.apiKey != kafkaProduce || r.acks != 0
+}
+
+// parseKafkaRequest decodes a request header and, for the APIs the proxy
+// authorizes by topic, the topics and partitions it touches
+func parseKafkaRequest(frame []byte) (*kafkaRequest, error) {
+	r := &kafkaReader{buf: frame}
+	req := &kafkaRequest{
+		apiKey:        r.int16(),
+		apiVersion:    r.int16(),
+		correlationID: r.int32(),
+	}
+	req.clientID, _ = r.nullableString()
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid request header: %w", r.err)
+	}
+
+	maxVersion, parsed := kafkaMaxVersions[req.apiKey]
+	if !parsed || req.apiKey == kafkaFindCoordinator {
+		return req, nil
+	}
+	if req.apiVersion > maxVersion {
+		return nil, fmt.Errorf("%s v%d is not supported by the proxy (max v%d)", req.api(), req.apiVersion, maxVersion)
+	}
+
+	v := req.apiVersion
+	switch req.apiKey {
+	case kafkaProduce:
+		if v >= 3 {
+			r.nullableString() // transactional_id
+		}
+		req.acks = r.int16()
+		r.int32() // timeout_ms
+		for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+			topic := kafkaTopic{name: r.string()}
+			for j, m := 0, r.arrayLen(); j < m && r.err == nil; j++ {
+				topic.partitions = append(topic.partitions, r.int32())
+				r.skipBytes() // records
+			}
+			req.topics = append(req.topics, topic)
+		}
+
+	case kafkaFetch:
+		r.int32() // replica_id
+		r.int32() // max_wait_ms
+		r.int32() // min_bytes
+		if v >= 3 {
+			r.int32() // max_bytes
+		}
+		if v >= 4 {
+			r.int8() // isolation_level
+		}
+		if v >= 7 {
+			req.sessionOffset = r.off
+			r.int32() // session_id
+			r.int32() // session_epoch
+		}
+		for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+			topic := kafkaTopic{name: r.string()}
+			for j, m := 0, r.arrayLen(); j < m && r.err == nil; j++ {
+				topic.partitions = append(topic.partitions, r.int32())
+				if v >= 9 {
+					r.int32() // current_leader_epoch
+				}
+				r.int64() // fetch_offset
+				if v >= 5 {
+					r.int64() // log_start_offset
+				}
+				r.int32() // partition_max_bytes
+			}
+			req.topics = append(req.topics, topic)
+		}
+
+	case kafkaListOffsets:
+		r.int32() // replica_id
+		if v >= 2 {
+			r.int8() // isolation_level
+		}
+		for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+			topic := kafkaTopic{name: r.string()}
+			for j, m := 0, r.arrayLen(); j < m && r.err == nil; j++ {
+				topic.partitions = append(topic.partitions, r.int32())
+				if v >= 4 {
+					r.int32() // current_leader_epoch
+				}
+				r.int64() // timestamp
+				if v == 0 {
+					r.int32() // max_num_offsets
+				}
+			}
+			req.topics = append(req.topics, topic)
+		}
+
+	case kafkaMetadata:
+		req.topicsStart = r.off
+		for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+			req.topics = append(req.topics, kafkaTopic{name: r.string()})
+		}
+		req.topicsEnd = r.off
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid %s v%d request: %w", req.api(), v, r.err)
+	}
+	return req, nil
+}
+
+// withMetadataTopics rewrites a Metadata request to ask only for the given topics
+func (r *kafkaRequest) withMetadataTopics(frame []byte, topics []string) ([]byte, error) {
+	if len(topics) == 0 && r.apiVersion == 0 {
+		// An empty v0 topics array means all topics
+		return nil, fmt.Errorf("no requested topic is allowed")
+	}
+	w := &kafkaWriter{buf: append([]byte(nil), frame[:r.topicsStart]...)}
+	w.int32(int32(len(topics)))
+	for _, topic := range topics {
+		w.string(topic)
+	}
+	w.raw(frame[r.topicsEnd:])
+	return w.buf, nil
+}
+
+// withoutFetchSession rewrites a Fetch v7+ request as a sessionless full fetch,
+// so every request lists (and is authorized on) all of its partitions
+func (r *kafkaRequest) withoutFetchSession(frame []byte) []byte {
+	if r.sessionOffset == 0 {
+		return frame
+	}
+	binary.BigEndian.PutUint32(frame[r.sessionOffset:], 0)            // session_id: none
+	binary.BigEndian.PutUint32(frame[r.sessionOffset+4:], 0xffffffff) // session_epoch: -1 (final)
+	return frame
+}
+
+// kafkaAuthorizationError builds the response to a denied Produce, Fetch or
+// ListOffsets request, failing every partition with TOPIC_AUTHORIZATION_FAILED.
+// Returns nil for other APIs, which can't be answered and close the connection.
+func kafkaAuthorizationError(req *kafkaRequest) []byte {
+	w := &kafkaWriter{}
+	w.int32(req.correlationID)
+	v := req.apiVersion
+
+	switch req.apiKey {
+	case kafkaProduce:
+		w.int32(int32(len(req.topics)))
+		for _, topic := range req.topics {
+			w.string(topic.name)
+			w.int32(int32(len(topic.partitions)))
+			for _, partition := range topic.partitions {
+				w.int32(partition)
+				w.int16(kafkaErrTopicAuthorizationFailed)
+				w.int64(-1) // base_offset
+				if v >= 2 {
+					w.int64(-1) // log_append_time_ms
+				}
+				if v >= 5 {
+					w.int64(-1) // log_start_offset
+				}
+				if v >= 8 {
+					w.int32(0)                  // record_errors
+					w.nullableString("", false) // error_message
+				}
+			}
+		}
+		if v >= 1 {
+			w.int32(0) // throttle_time_ms
+		}
+
+	case kafkaFetch:
+		if v >= 1 {
+			w.int32(0) // throttle_time_ms
+		}
+		if v >= 7 {
+			w.int16(0) // error_code
+			w.int32(0) // session_id
+		}
+		w.int32(int32(len(req.topics)))
+		for _, topic := range req.topics {
+			w.string(topic.name)
+			w.int32(int32(len(topic.partitions)))
+			for _, partition := range topic.partitions {
+				w.int32(partition)
+				w.int16(kafkaErrTopicAuthorizationFailed)
+				w.int64(-1) // high_watermark
+				if v >= 4 {
+					w.int64(-1) // last_stable_offset
+				}
+				if v >= 5 {
+					w.int64(-1) // log_start_offset
+				}
+				if v >= 4 {
+					w.int32(-1) // aborted_transactions: null
+				}
+				if v >= 11 {
+					w.int32(-1) // preferred_read_replica
+				}
+				w.int32(0) // records: empty
+			}
+		}
+
+	case kafkaListOffsets:
+		if v >= 2 {
+			w.int32(0) // throttle_time_ms
+		}
+		w.int32(int32(len(req.topics)))
+		for _, topic := range req.topics {
+			w.string(topic.name)
+			w.int32(int32(len(topic.partitions)))
+			for _, partition := range topic.partitions {
+				w.int32(partition)
+				w.int16(kafkaErrTopicAuthorizationFailed)
+				if v == 0 {
+					w.int32(0) // old_style_offsets
+				} else {
+					w.int64(-1) // timestamp
+					w.int64(-1) // offset
+				}
+				if v >= 4 {
+					w.int32(-1) // leader_epoch
+				}
+			}
+		}
+
+	default:
+		return nil
+	}
+	return w.buf
+}
+
+// clampKafkaAPIVersions rewrites an ApiVersions response in place so the APIs
+// in kafkaMaxVersions advertise at most the version the proxy can parse
+func clampKafkaAPIVersions(frame []byte, version int16) error {
+	r := &kafkaReader{buf: frame}
+	r.int32() // correlation_id (ApiVersions responses always use header v0)
+	if errorCode := r.int16(); errorCode != 0 {
+		// Error responses (e.g. UNSUPPORTED_VERSION) carry no usable version list
+		return r.err
+	}
+
+	var n int
+	if version >= 3 {
+		n = int(r.uvarint()) - 1
+	} else {
+		n = r.arrayLen()
+	}
+	for i := 0; i < n && r.err == nil; i++ {
+		apiKey := r.int16()
+		r.int16() // min_version
+		maxOffset := r.off
+		maxVersion := r.int16()
+		if r.err != nil {
+			break
+		}
+		if limit, ok := kafkaMaxVersions[apiKey]; ok && maxVersion > limit {
+			binary.BigEndian.PutUint16(frame[maxOffset:], uint16(limit))
+		}
+		if version >= 3 {
+			r.skipTaggedFields()
+		}
+	}
+	return r.err
+}
+
+// kafkaBroker is a broker entry of a Metadata response
+type kafkaBroker struct {
+	nodeID  int32
+	host    string
+	port    int32
+	rack    string
+	hasRack bool
+}
+
+// addr returns the broker's host:port
+func (b kafkaBroker) addr() string {
+	return net.JoinHostPort(b.host, strconv.Itoa(int(b.port)))
+}
+
+// kafkaMetadataResponse is a decoded Metadata response (v0-v8); topic entries
+// are kept raw so they can be filtered without re-encoding
+type kafkaMetadataResponse struct {
+	throttleTimeMs int32
+	brokers        []kafkaBroker
+	clusterID      string
+	hasClusterID   bool
+	controllerID   int32
+	topics         []kafkaMetadataTopic
+	clusterOps     int32
+}
+
+type kafkaMetadataTopic struct {
+	name string
+	raw  []byte
+}
+
+// parseKafkaMetadataResponse decodes a Metadata response frame of the given version
+func parseKafkaMetadataResponse(frame []byte, version int16) (*kafkaMetadataResponse, error) {
+	r := &kafkaReader{buf: frame}
+	r.int32() // correlation_id
+	resp := &kafkaMetadataResponse{controllerID: -1}
+	if version >= 3 {
+		resp.throttleTimeMs = r.int32()
+	}
+	for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+		broker := kafkaBroker{nodeID: r.int32(), host: r.string(), port: r.int32()}
+		if version >= 1 {
+			broker.rack, broker.hasRack = r.nullableString()
+		}
+		resp.brokers = append(resp.brokers, broker)
+	}
+	if version >= 2 {
+		resp.clusterID, resp.hasClusterID = r.nullableString()
+	}
+	if version >= 1 {
+		resp.controllerID = r.int32()
+	}
+	for i, n := 0, r.arrayLen(); i < n && r.err == nil; i++ {
+		start := r.off
+		r.int16() // error_code
+		topic := kafkaMetadataTopic{name: r.string()}
+		if version >= 1 {
+			r.int8() // is_internal
+		}
+		for j, m := 0, r.arrayLen(); j < m && r.err == nil; j++ {
+			r.int16() // error_code
+			r.int32() // partition_index
+			r.int32() // leader_id
+			if version >= 7 {
+				r.int32() // leader_epoch
+			}
+			r.take(4 * r.arrayLen()) // replica_nodes
+			r.take(4 * r.arrayLen()) // isr_nodes
+			if version >= 5 {
+				r.take(4 * r.arrayLen()) // offline_replicas
+			}
+		}
+		if version >= 8 {
+			r.int32() // topic_authorized_operations
+		}
+		topic.raw = r.buf[start:r.off]
+		resp.topics = append(resp.topics, topic)
+	}
+	if version >= 8 {
+		resp.clusterOps = r.int32()
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid Metadata v%d response: %w", version, r.err)
+	}
+	return resp, nil
+}
+
+// encode re-encodes the response for the given version and correlation ID
+func (m *kafkaMetadataResponse) encode(correlationID int32, version int16) []byte {
+	w := &kafkaWriter{}
+	w.int32(correlationID)
+	if version >= 3 {
+		w.int32(m.throttleTimeMs)
+	}
+	w.int32(int32(len(m.brokers)))
+	for _, broker := range m.brokers {
+		w.int32(broker.nodeID)
+		w.string(broker.host)
+		w.int32(broker.port)
+		if version >= 1 {
+			w.nullableString(broker.rack, broker.hasRack)
+		}
+	}
+	if version >= 2 {
+		w.nullableString(m.clusterID, m.hasClusterID)
+	}
+	if version >= 1 {
+		w.int32(m.controllerID)
+	}
+	w.int32(int32(len(m.topics)))
+	for _, topic := range m.topics {
+		w.raw(topic.raw)
+	}
+	if version >= 8 {
+		w.int32(m.clusterOps)
+	}
+	return w.buf
+}
+
+// kafkaCoordinator is a decoded FindCoordinator response (v0-v2)
+type kafkaCoordinator struct {
+	throttleTimeMs int32
+	errorCode      int16
+	errorMessage   string
+	hasMessage     bool
+	broker         kafkaBroker
+}
+
+// parseKafkaCoordinatorResponse decodes a FindCoordinator response frame of the given version
+func parseKafkaCoordinatorResponse(frame []byte, version int16) (*kafkaCoordinator, error) {
+	r := &kafkaReader{buf: frame}
+	r.int32() // correlation_id
+	resp := &kafkaCoordinator{}
+	if version >= 1 {
+		resp.throttleTimeMs = r.int32()
+	}
+	resp.errorCode = r.int16()
+	if version >= 1 {
+		resp.errorMessage, resp.hasMessage = r.nullableString()
+	}
+	resp.broker = kafkaBroker{nodeID: r.int32(), host: r.string(), port: r.int32()}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid FindCoordinator v%d response: %w", version, r.err)
+	}
+	return resp, nil
+}
+
+// encode re-encodes the response for the given version and correlation ID
+func (c *kafkaCoordinator) encode(correlationID int32, version int16) []byte {
+	w := &kafkaWriter{}
+	w.int32(correlationID)
+	if version >= 1 {
+		w.int32(c.throttleTimeMs)
+	}
+	w.int16(c.errorCode)
+	if version >= 1 {
+		w.nullableString(c.errorMessage, c.hasMessage)
+	}
+	w.int32(c.broker.nodeID)
+	w.string(c.broker.host)
+	w.int32(c.broker.port)
+	return w.buf
+}
+
+// kafkaMetadataRequest builds a Metadata v4 request for no topics, used to discover brokers
+func kafkaMetadataRequest(correlationID int32) []byte {
+	w := &kafkaWriter{}
+	w.int16(kafkaMetadata)
+	w.int16(4)
+	w.int32(correlationID)
+	w.string("port-authorizing")
+	w.int32(0) // topics: none
+	w.int8(0)  // allow_auto_topic_creation: false
+	return w.buf
+}
@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// fakeKafkaBroker answers ApiVersions and Metadata requests and acknowledges
+// everything else with a bare "ok" body, recording the API keys it receives
+type fakeKafkaBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	received []int16
+}
+
+func newFakeKafkaBroker(t *testing.T) *fakeKafkaBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	b := &fakeKafkaBroker{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeKafkaBroker) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		frame, err := readKafkaFrame(conn)
+		if err != nil {
+			return
+		}
+		req, err := parseKafkaRequest(frame)
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.received = append(b.received, req.apiKey)
+		b.mu.Unlock()
+
+		// Slow responses make pipelined requests overtake them
+		time.Sleep(20 * time.Millisecond)
+
+		w := &kafkaWriter{}
+		switch req.apiKey {
+		case kafkaAPIVersions:
+			w.int32(req.correlationID)
+			w.int16(0)
+			w.int32(3)
+			for _, api := range [][3]int16{{kafkaProduce, 0, 9}, {kafkaFetch, 0, 13}, {kafkaMetadata, 0, 12}} {
+				w.int16(api[0])
+				w.int16(api[1])
+				w.int16(api[2])
+			}
+		case kafkaMetadata:
+			port := int32(b.listener.Addr().(*net.TCPAddr).Port)
+			resp := &kafkaMetadataResponse{
+				brokers:      []kafkaBroker{{nodeID: 1, host: "127.0.0.1", port: port}},
+				controllerID: 1,
+			}
+			for _, name := range []string{"events.clicks", "payments"} {
+				topic := &kafkaWriter{}
+				topic.int16(0)
+				topic.string(name)
+				topic.int8(0)
+				topic.int32(0)
+				resp.topics = append(resp.topics, kafkaMetadataTopic{name: name, raw: topic.buf})
+			}
+			w.raw(resp.encode(req.correlationID, req.apiVersion))
+		default:
+			w.int32(req.correlationID)
+			w.raw([]byte("ok"))
+		}
+		if err := writeKafkaFrame(conn, w.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeKafkaBroker) port() int {
+	return b.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (b *fakeKafkaBroker) receivedAPIs() []int16 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]int16(nil), b.received...)
+}
+
+// kafkaRequestFrame builds a request with the given header and body
+func kafkaRequestFrame(apiKey, version int16, correlationID int32, body func(w *kafkaWriter)) []byte {
+	w := &kafkaWriter{}
+	w.int16(apiKey)
+	w.int16(version)
+	w.int32(correlationID)
+	w.string("test-client")
+	if body != nil {
+		body(w)
+	}
+	return w.buf
+}
+
+// kafkaTopicRequest builds a Produce v3 or Fetch v4 request for partition 0 of topic
+func kafkaTopicRequest(apiKey int16, correlationID int32, topic string) []byte {
+	if apiKey == kafkaProduce {
+		return kafkaRequestFrame(kafkaProduce, 3, correlationID, func(w *kafkaWriter) {
+			w.nullableString("", false) // transactional_id
+			w.int16(1)                  // acks
+			w.int32(1000)               // timeout_ms
+			w.int32(1)
+			w.string(topic)
+			w.int32(1)
+			w.int32(0)
+			w.int32(3)
+			w.raw([]byte("abc"))
+		})
+	}
+	return kafkaRequestFrame(kafkaFetch, 4, correlationID, func(w *kafkaWriter) {
+		w.int32(-1)      // replica_id
+		w.int32(100)     // max_wait_ms
+		w.int32(1)       // min_bytes
+		w.int32(1 << 20) // max_bytes
+		w.int8(0)        // isolation_level
+		w.int32(1)
+		w.string(topic)
+		w.int32(1)
+		w.int32(0)       // partition
+		w.int64(0)       // fetch_offset
+		w.int32(1 << 20) // partition_max_bytes
+	})
+}
+
+// startKafkaProxy serves one stream with the proxy and returns the client side
+func startKafkaProxy(t *testing.T, p *KafkaProxy, stream KafkaStream) net.Conn {
+	t.Helper()
+	clientSide, proxySide := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.HandleConnection(proxySide, stream)
+	}()
+	t.Cleanup(func() {
+		_ = clientSide.Close()
+		<-done
+	})
+	_ = clientSide.SetDeadline(time.Now().Add(5 * time.Second))
+	return clientSide
+}
+
+func TestKafkaProxy_TopicAuthorization(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	broker := newFakeKafkaBroker(t)
+	cfg := &config.ConnectionConfig{Name: "events", Type: "kafka", Host: "127.0.0.1", Port: broker.port()}
+	p := NewKafkaProxy(cfg, []string{`^Metadata events\..*$`, `^Fetch events\..*$`}, logPath, "alice", "conn-1")
+	client := startKafkaProxy(t, p, KafkaStream{BrokerID: -1, Bootstrap: "localhost:9092"})
+
+	// Pipeline an allowed Fetch ahead of a denied Produce: responses must keep request order
+	if err := writeKafkaFrame(client, kafkaTopicRequest(kafkaFetch, 1, "events.clicks")); err != nil {
+		t.Fatalf("write Fetch error = %v", err)
+	}
+	if err := writeKafkaFrame(client, kafkaTopicRequest(kafkaProduce, 2, "events.clicks")); err != nil {
+		t.Fatalf("write Produce error = %v", err)
+	}
+
+	fetch, err := readKafkaFrame(client)
+	if err != nil {
+		t.Fatalf("read Fetch response error = %v", err)
+	}
+	if id := int32(binary.BigEndian.Uint32(fetch)); id != 1 || string(fetch[4:]) != "ok" {
+		t.Errorf("first response = %d %q, want the broker's Fetch response", id, fetch[4:])
+	}
+
+	produce, err := readKafkaFrame(client)
+	if err != nil {
+		t.Fatalf("read Produce response error = %v", err)
+	}
+	r := &kafkaReader{buf: produce}
+	if id := r.int32(); id != 2 {
+		t.Errorf("second response correlation ID = %d, want 2", id)
+	}
+	r.arrayLen()
+	topic := r.string()
+	r.arrayLen()
+	r.int32() // partition
+	if code := r.int16(); topic != "events.clicks" || code != kafkaErrTopicAuthorizationFailed {
+		t.Errorf("Produce response = %s error %d, want TOPIC_AUTHORIZATION_FAILED", topic, code)
+	}
+
+	for _, api := range broker.receivedAPIs() {
+		if api == kafkaProduce {
+			t.Error("broker received the denied Produce request")
+		}
+	}
+
+	requests, _ := audit.Query(logPath, audit.Filter{Action: "kafka_request"})
+	if len(requests) != 1 || requests[0].Metadata["api"] != "Fetch" {
+		t.Errorf("kafka_request entries = %+v, want the Fetch", requests)
+	}
+	blocked, _ := audit.Query(logPath, audit.Filter{Action: "kafka_request_blocked"})
+	if len(blocked) != 1 || blocked[0].Metadata["request"] != "Produce events.clicks" {
+		t.Errorf("kafka_request_blocked entries = %+v, want Produce events.clicks", blocked)
+	}
+}
+
+func TestKafkaProxy_MetadataRewrite(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	broker := newFakeKafkaBroker(t)
+	cfg := &config.ConnectionConfig{Name: "events", Type: "kafka", Host: "127.0.0.1", Port: broker.port()}
+	p := NewKafkaProxy(cfg, []string{`^Metadata events\..*$`}, logPath, "alice", "conn-1")
+	client := startKafkaProxy(t, p, KafkaStream{
+		BrokerID:  -1,
+		Bootstrap: "localhost:9092",
+		Listeners: map[int32]string{1: "localhost:9093"},
+	})
+
+	// ApiVersions advertises at most the versions the proxy parses
+	if err := writeKafkaFrame(client, kafkaRequestFrame(kafkaAPIVersions, 0, 1, nil)); err != nil {
+		t.Fatalf("write ApiVersions error = %v", err)
+	}
+	versions, err := readKafkaFrame(client)
+	if err != nil {
+		t.Fatalf("read ApiVersions response error = %v", err)
+	}
+	r := &kafkaReader{buf: versions}
+	r.int32()
+	r.int16()
+	for i, n := 0, r.arrayLen(); i < n; i++ {
+		key, _, maxVersion := r.int16(), r.int16(), r.int16()
+		if limit := kafkaMaxVersions[key]; maxVersion > limit {
+			t.Errorf("%s max version = %d, want at most %d", kafkaAPIName(key), maxVersion, limit)
+		}
+	}
+
+	// Metadata for all topics lists only whitelisted topics and the client-side broker address
+	if err := writeKafkaFrame(client, kafkaRequestFrame(kafkaMetadata, 1, 2, func(w *kafkaWriter) { w.int32(-1) })); err != nil {
+		t.Fatalf("write Metadata error = %v", err)
+	}
+	frame, err := readKafkaFrame(client)
+	if err != nil {
+		t.Fatalf("read Metadata response error = %v", err)
+	}
+	resp, err := parseKafkaMetadataResponse(frame, 1)
+	if err != nil {
+		t.Fatalf("parseKafkaMetadataResponse() error = %v", err)
+	}
+	if len(resp.brokers) != 1 || resp.brokers[0].addr() != "localhost:9093" {
+		t.Errorf("brokers = %+v, want node 1 at localhost:9093", resp.brokers)
+	}
+	if len(resp.topics) != 1 || resp.topics[0].name != "events.clicks" {
+		t.Errorf("topics = %+v, want only events.clicks", resp.topics)
+	}
+
+	// The real broker address was learned for streams that target node 1
+	if addr, err := p.brokerAddr(1); err != nil || addr != net.JoinHostPort("127.0.0.1", strconv.Itoa(broker.port())) {
+		t.Errorf("brokerAddr(1) = %q, %v, want the broker's real address", addr, err)
+	}
+}
+
+func TestKafkaProxy_DeniedAPIClosesConnection(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	broker := newFakeKafkaBroker(t)
+	cfg := &config.ConnectionConfig{Name: "events", Type: "kafka", Host: "127.0.0.1", Port: broker.port()}
+	p := NewKafkaProxy(cfg, []string{`^Fetch .*$`}, logPath, "alice", "conn-1")
+	client := startKafkaProxy(t, p, KafkaStream{BrokerID: -1})
+
+	// DeleteTopics has no topic-level error response the proxy can build
+	if err := writeKafkaFrame(client, kafkaRequestFrame(20, 0, 1, func(w *kafkaWriter) {
+		w.int32(1)
+		w.string("payments")
+		w.int32(1000)
+	})); err != nil {
+		t.Fatalf("write DeleteTopics error = %v", err)
+	}
+	if _, err := readKafkaFrame(client); err == nil {
+		t.Error("read after a denied DeleteTopics succeeded, want the connection closed")
+	}
+
+	blocked, _ := audit.Query(logPath, audit.Filter{Action: "kafka_request_blocked"})
+	if len(blocked) != 1 || blocked[0].Metadata["request"] != "DeleteTopics" {
+		t.Errorf("kafka_request_blocked entries = %+v, want DeleteTopics", blocked)
+	}
+	if apis := broker.receivedAPIs(); len(apis) != 0 {
+		t.Errorf("broker received %v, want nothing", apis)
+	}
+}
+
+func TestParseKafkaRequest_RejectsUnparsedVersions(t *testing.T) {
+	frame := kafkaRequestFrame(kafkaProduce, 9, 1, nil)
+	if _, err := parseKafkaRequest(frame); err == nil {
+		t.Error("parseKafkaRequest(Produce v9) succeeded, want an unsupported version error")
+	}
+}
@@ -1,16 +1,30 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/logging"
 	"github.com/google/uuid"
 )
 
+// ErrConnectionLimit is returned when a user already holds their maximum number of active connections
+var ErrConnectionLimit = errors.New("concurrent connection limit reached")
+
+// ErrNotExtended is returned when an extension would not push a connection's expiry out
+var ErrNotExtended = errors.New("new expiry is not after the current expiry")
+
 // Connection represents an active proxy connection
 type Connection struct {
 	ID        string
@@ -18,13 +32,89 @@ type Connection struct {
 	Config    *config.ConnectionConfig
 	Proxy     Protocol
 	CreatedAt time.Time
-	ExpiresAt time.Time
+
+	// Expiry, pushed out by ExtendConnection; see ExpiresAt and Extended
+	expiryMu  sync.RWMutex
+	expiresAt time.Time
+	extended  chan struct{} // Closed (and replaced) when the expiry is extended
+
+	// IdleTimeout closes the connection after this long without traffic (0 = off)
+	IdleTimeout  time.Duration
+	lastActivity atomic.Int64 // Unix nanoseconds of the last byte or request proxied
+	auditLogPath string
+
+	// Access policy for the owner, re-evaluated when the configuration is reloaded
+	policyMu        sync.RWMutex
+	roles           []string
+	clientIP        net.IP          // Address the owner connected from; scopes source_cidrs policies
+	whitelist       []string        // Whitelist resolved at connect time (fallback)
+	whitelistSource WhitelistSource // Current policy's whitelist resolver
+
+	backendAddr atomic.Value // string: resolved address of the backend last dialed for this connection
+	reason      atomic.Value // string: justification the user gave when connecting
+	database    atomic.Value // string: database the user picked when connecting (postgres)
+
+	// Byte quotas for the session (0 = unlimited); see AddBytesIn/AddBytesOut
+	MaxBytesIn    int64
+	MaxBytesOut   int64
+	bytesIn       atomic.Int64 // Bytes sent from the client to the backend
+	bytesOut      atomic.Int64 // Bytes sent from the backend to the client
+	quotaExceeded atomic.Bool  // Set (and audited) the first time a quota is hit
 
 	// Active TCP connections for this proxy connection
 	activeStreams map[net.Conn]bool
+	expiryStreams map[net.Conn]bool // Streams whose deadline follows the expiry
 	streamsMu     sync.Mutex
 }
 
+// ExpiresAt returns when the connection expires
+func (c *Connection) ExpiresAt() time.Time {
+	c.expiryMu.RLock()
+	defer c.expiryMu.RUnlock()
+	return c.expiresAt
+}
+
+// Extended returns a channel that is closed the next time the connection's
+// expiry is pushed out. Call it again afterwards to wait for a further extension.
+func (c *Connection) Extended() <-chan struct{} {
+	c.expiryMu.Lock()
+	defer c.expiryMu.Unlock()
+	if c.extended == nil {
+		c.extended = make(chan struct{})
+	}
+	return c.extended
+}
+
+// setExpiresAt moves the expiry, moving the deadlines of streams following it
+// and waking everything waiting on Extended
+func (c *Connection) setExpiresAt(expiresAt time.Time) {
+	c.expiryMu.Lock()
+	c.expiresAt = expiresAt
+	if c.extended != nil {
+		close(c.extended)
+		c.extended = nil
+	}
+	c.expiryMu.Unlock()
+
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	for stream := range c.expiryStreams {
+		_ = stream.SetDeadline(expiresAt)
+	}
+}
+
+// FollowExpiry sets the stream's deadline to the connection expiry and keeps it
+// there when the connection is extended, until the stream is unregistered
+func (c *Connection) FollowExpiry(stream net.Conn) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if c.expiryStreams == nil {
+		c.expiryStreams = make(map[net.Conn]bool)
+	}
+	c.expiryStreams[stream] = true
+	_ = stream.SetDeadline(c.ExpiresAt())
+}
+
 // RegisterStream registers an active TCP stream for this connection
 func (c *Connection) RegisterStream(conn net.Conn) {
 	c.streamsMu.Lock()
@@ -40,6 +130,7 @@ func (c *Connection) UnregisterStream(conn net.Conn) {
 	c.streamsMu.Lock()
 	defer c.streamsMu.Unlock()
 	delete(c.activeStreams, conn)
+	delete(c.expiryStreams, conn)
 }
 
 // CloseAllStreams forcefully closes all active TCP streams
@@ -50,6 +141,160 @@ func (c *Connection) CloseAllStreams() {
 		_ = conn.Close()
 	}
 	c.activeStreams = make(map[net.Conn]bool)
+	c.expiryStreams = nil
+}
+
+// SetBackendAddr records the resolved backend address a stream of this connection used
+func (c *Connection) SetBackendAddr(addr string) {
+	if addr != "" {
+		c.backendAddr.Store(addr)
+	}
+}
+
+// BackendAddr returns the resolved backend address last used, or "" if none is known yet
+func (c *Connection) BackendAddr() string {
+	addr, _ := c.backendAddr.Load().(string)
+	return addr
+}
+
+// SetReason records the justification the user gave when connecting
+func (c *Connection) SetReason(reason string) {
+	c.reason.Store(reason)
+}
+
+// Reason returns the justification the user gave when connecting, or "" if none
+func (c *Connection) Reason() string {
+	reason, _ := c.reason.Load().(string)
+	return reason
+}
+
+// SetDatabase records the database the user picked when connecting
+func (c *Connection) SetDatabase(database string) {
+	c.database.Store(database)
+}
+
+// Database returns the database the user picked when connecting, or "" for the default
+func (c *Connection) Database() string {
+	database, _ := c.database.Load().(string)
+	return database
+}
+
+// Touch records proxy activity on the connection, resetting its idle timer
+func (c *Connection) Touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// LastActivity returns when traffic last flowed through the connection
+func (c *Connection) LastActivity() time.Time {
+	return time.Unix(0, c.lastActivity.Load())
+}
+
+// IsIdle reports whether the connection has exceeded its idle timeout at now
+func (c *Connection) IsIdle(now time.Time) bool {
+	return c.IdleTimeout > 0 && now.Sub(c.LastActivity()) > c.IdleTimeout
+}
+
+// SetPolicy records the owner's roles and the whitelist source that applies to
+// them. Proxies using the connection as their WhitelistSource follow later
+// policy changes (see ConnectionManager.ApplyPolicyChange).
+func (c *Connection) SetPolicy(roles []string, source WhitelistSource) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	c.roles = roles
+	c.whitelistSource = source
+}
+
+// SetClientIP records the address the owner connected from
+func (c *Connection) SetClientIP(ip net.IP) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	c.clientIP = ip
+}
+
+// ClientIP returns the address the owner connected from, nil if not recorded
+func (c *Connection) ClientIP() net.IP {
+	c.policyMu.RLock()
+	defer c.policyMu.RUnlock()
+	return c.clientIP
+}
+
+// Whitelist implements WhitelistSource with the connection's current policy
+func (c *Connection) Whitelist() []string {
+	c.policyMu.RLock()
+	defer c.policyMu.RUnlock()
+	if c.whitelistSource != nil {
+		return c.whitelistSource.Whitelist()
+	}
+	return c.whitelist
+}
+
+// Blacklist implements WhitelistSource with the connection's current policy
+func (c *Connection) Blacklist() []string {
+	c.policyMu.RLock()
+	defer c.policyMu.RUnlock()
+	if c.whitelistSource != nil {
+		return c.whitelistSource.Blacklist()
+	}
+	return nil
+}
+
+// ExcludedWindow implements WhitelistSource with the connection's current policy
+func (c *Connection) ExcludedWindow(request string) string {
+	c.policyMu.RLock()
+	defer c.policyMu.RUnlock()
+	if c.whitelistSource != nil {
+		return c.whitelistSource.ExcludedWindow(request)
+	}
+	return ""
+}
+
+// MatchedRule implements WhitelistSource with the connection's current policy
+func (c *Connection) MatchedRule(request string) string {
+	c.policyMu.RLock()
+	defer c.policyMu.RUnlock()
+	if c.whitelistSource != nil {
+		return c.whitelistSource.MatchedRule(request)
+	}
+	return ""
+}
+
+// activityConn marks its Connection active whenever bytes are read or written
+// and charges the traffic against the connection's byte quotas
+type activityConn struct {
+	net.Conn
+	owner *Connection
+}
+
+// TrackActivity wraps a client stream so traffic through it resets the connection's
+// idle timer and counts towards its byte quotas. Reads from the client are bytes in,
+// writes to the client are bytes out; once a quota is exceeded the stream is closed
+// and both return ErrQuotaExceeded.
+func TrackActivity(stream net.Conn, owner *Connection) net.Conn {
+	return &activityConn{Conn: stream, owner: owner}
+}
+
+func (a *activityConn) Read(b []byte) (int, error) {
+	n, err := a.Conn.Read(b)
+	if n > 0 {
+		a.owner.Touch()
+		if quotaErr := a.owner.AddBytesIn(n); quotaErr != nil {
+			_ = a.Conn.Close()
+			return 0, quotaErr
+		}
+	}
+	return n, err
+}
+
+func (a *activityConn) Write(b []byte) (int, error) {
+	if err := a.owner.AddBytesOut(len(b)); err != nil {
+		_ = a.Conn.Close()
+		return 0, err
+	}
+	n, err := a.Conn.Write(b)
+	if n > 0 {
+		a.owner.Touch()
+	}
+	return n, err
 }
 
 // ConnectionManager manages active proxy connections
@@ -58,6 +303,11 @@ type ConnectionManager struct {
 	mu            sync.RWMutex
 	maxDuration   time.Duration
 	cleanupTicker *time.Ticker
+	alerted       map[string]bool // Connections whose session alert threshold has fired
+	idleTimeout   time.Duration   // Server-wide idle timeout for connections without idle_timeout
+	maxBytesIn    int64           // Server-wide byte quotas for connections without their own
+	maxBytesOut   int64
+	logger        *slog.Logger
 }
 
 // NewConnectionManager creates a new connection manager
@@ -65,6 +315,8 @@ func NewConnectionManager(maxDuration time.Duration) *ConnectionManager {
 	cm := &ConnectionManager{
 		connections: make(map[string]*Connection),
 		maxDuration: maxDuration,
+		alerted:     make(map[string]bool),
+		logger:      logging.Component("proxy"),
 	}
 
 	// Start cleanup goroutine
@@ -74,11 +326,74 @@ func NewConnectionManager(maxDuration time.Duration) *ConnectionManager {
 	return cm
 }
 
+// SetDefaultIdleTimeout sets the idle timeout applied to new connections that
+// don't configure their own idle_timeout (0 = off)
+func (cm *ConnectionManager) SetDefaultIdleTimeout(timeout time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.idleTimeout = timeout
+}
+
+// SetDefaultByteQuotas sets the per-session byte quotas applied to new connections
+// that don't configure max_bytes_in/max_bytes_out (0 = unlimited)
+func (cm *ConnectionManager) SetDefaultByteQuotas(maxBytesIn, maxBytesOut int64) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.maxBytesIn = maxBytesIn
+	cm.maxBytesOut = maxBytesOut
+}
+
 // CreateConnection creates a new proxy connection
+// If the connection has validate_on_connect set, the backend is checked first
+// and the error wraps ErrBackendUnreachable or ErrBackendAuthFailed.
+// Invalid backend TLS settings fail with an error wrapping ErrBackendTLS.
 func (cm *ConnectionManager) CreateConnection(username string, connConfig *config.ConnectionConfig, duration time.Duration, whitelist []string, auditLogPath string, approvalMgr *approval.Manager) (string, time.Time, error) {
+	return cm.CreateConnectionWithLimit(username, 0, connConfig, duration, whitelist, auditLogPath, approvalMgr)
+}
+
+// CreateConnectionWithLimit is CreateConnection for a user allowed at most maxConcurrent active
+// connections (0 = unlimited). At the limit it fails with ErrConnectionLimit; the user's connections
+// are counted under the same lock that adds the new one, so concurrent connects can't exceed it.
+func (cm *ConnectionManager) CreateConnectionWithLimit(username string, maxConcurrent int, connConfig *config.ConnectionConfig, duration time.Duration, whitelist []string, auditLogPath string, approvalMgr *approval.Manager) (string, time.Time, error) {
+	// Fail fast before any backend I/O; the check is repeated under the lock below
+	if maxConcurrent > 0 && cm.CountByUsername(username) >= maxConcurrent {
+		return "", time.Time{}, ErrConnectionLimit
+	}
+
+	// Load backend TLS material up front so misconfiguration fails here, not mid-session
+	if _, err := BackendTLSConfig(connConfig); err != nil {
+		_ = audit.Log(auditLogPath, username, "backend_tls_error", connConfig.Name, map[string]interface{}{
+			"type":  connConfig.Type,
+			"error": err.Error(),
+		})
+		return "", time.Time{}, err
+	}
+
+	// Validate backend before taking the lock (network I/O)
+	var backendAddr string
+	if connConfig.ValidateOnConnect {
+		var err error
+		if backendAddr, err = validateBackend(connConfig); err != nil {
+			event := "connect_validation_failed"
+			if errors.Is(err, ErrBackendTLS) {
+				event = "backend_tls_error"
+			}
+			_ = audit.Log(auditLogPath, username, event, connConfig.Name, map[string]interface{}{
+				"type":         connConfig.Type,
+				"error":        err.Error(),
+				"backend_addr": backendAddr,
+			})
+			return "", time.Time{}, err
+		}
+	}
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	if maxConcurrent > 0 && cm.countByUsername(username, time.Now()) >= maxConcurrent {
+		return "", time.Time{}, ErrConnectionLimit
+	}
+
 	// Generate unique connection ID first (needed for proxy creation)
 	connectionID := uuid.New().String()
 
@@ -98,6 +413,29 @@ func (cm *ConnectionManager) CreateConnection(username string, connConfig *confi
 			}
 
 			proxy = httpProxy
+		} else if connConfig.Type == "grpc" {
+			// Create gRPC proxy with method-level whitelist support
+			grpcProxy, err := NewGRPCProxy(connConfig, whitelist, auditLogPath, username, connectionID)
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to create proxy: %w", err)
+			}
+			if approvalMgr != nil {
+				grpcProxy.SetApprovalManager(approvalMgr)
+			}
+			proxy = grpcProxy
+		} else if connConfig.Type == "mongodb" {
+			// Create MongoDB proxy with command-level whitelist support
+			proxy = NewMongoProxy(connConfig, whitelist, auditLogPath, username, connectionID)
+		} else if connConfig.Type == "ssh" {
+			// Create SSH proxy with exec/subsystem whitelist support
+			sshProxy, err := NewSSHProxy(connConfig, whitelist, auditLogPath, username, connectionID)
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to create proxy: %w", err)
+			}
+			proxy = sshProxy
+		} else if connConfig.Type == "kafka" {
+			// Create Kafka proxy with topic-level whitelist support
+			proxy = NewKafkaProxy(connConfig, whitelist, auditLogPath, username, connectionID)
 		} else {
 			// Other protocols don't support whitelist yet
 			proxy, err = NewProtocol(connConfig)
@@ -110,20 +448,148 @@ func (cm *ConnectionManager) CreateConnection(username string, connConfig *confi
 
 	expiresAt := time.Now().Add(duration)
 
+	idleTimeout := connConfig.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = cm.idleTimeout
+	}
+
+	maxBytesIn := connConfig.MaxBytesIn
+	if maxBytesIn == 0 {
+		maxBytesIn = cm.maxBytesIn
+	}
+	maxBytesOut := connConfig.MaxBytesOut
+	if maxBytesOut == 0 {
+		maxBytesOut = cm.maxBytesOut
+	}
+
 	conn := &Connection{
-		ID:        connectionID,
-		Username:  username,
-		Config:    connConfig,
-		Proxy:     proxy,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
+		ID:           connectionID,
+		Username:     username,
+		Config:       connConfig,
+		Proxy:        proxy,
+		CreatedAt:    time.Now(),
+		expiresAt:    expiresAt,
+		IdleTimeout:  idleTimeout,
+		MaxBytesIn:   maxBytesIn,
+		MaxBytesOut:  maxBytesOut,
+		auditLogPath: auditLogPath,
+		whitelist:    whitelist,
 	}
+	conn.Touch()
+	conn.SetBackendAddr(backendAddr)
 
 	cm.connections[connectionID] = conn
+	cm.checkSessionThreshold(conn, auditLogPath, approvalMgr)
+	cm.logger.Debug("connection created",
+		"connection_id", connectionID,
+		"username", username,
+		"connection", connConfig.Name,
+		"type", connConfig.Type,
+		"expires_at", expiresAt)
 
 	return connectionID, expiresAt, nil
 }
 
+// checkSessionThreshold alerts once when a connection's active sessions reach
+// its session_alert_threshold. Must be called with cm.mu held.
+func (cm *ConnectionManager) checkSessionThreshold(conn *Connection, auditLogPath string, approvalMgr *approval.Manager) {
+	threshold := conn.Config.SessionAlertThreshold
+	name := conn.Config.Name
+	if threshold <= 0 || cm.alerted[name] {
+		return
+	}
+
+	active := cm.countSessions(name)
+	if active < threshold {
+		return
+	}
+	cm.alerted[name] = true
+
+	_ = audit.Log(auditLogPath, conn.Username, "session_threshold_exceeded", name, map[string]interface{}{
+		"connection_id":   conn.ID,
+		"active_sessions": active,
+		"threshold":       threshold,
+	})
+
+	if approvalMgr == nil {
+		return
+	}
+	notification := &approval.Notification{
+		Title:   fmt.Sprintf("Connection %s reached %d active sessions", name, active),
+		Message: fmt.Sprintf("Connection %q has %d active sessions (alert threshold %d). Latest session opened by %s.", name, active, threshold, conn.Username),
+		Metadata: map[string]string{
+			"connection":      name,
+			"active_sessions": strconv.Itoa(active),
+			"threshold":       strconv.Itoa(threshold),
+			"username":        conn.Username,
+		},
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := approvalMgr.Notify(ctx, notification); err != nil {
+			_ = audit.Log(auditLogPath, "system", "session_threshold_notify_failed", name, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+// rearmSessionThreshold re-enables the alert once a connection drops below its
+// threshold. Must be called with cm.mu held, after the session was removed.
+func (cm *ConnectionManager) rearmSessionThreshold(conn *Connection) {
+	name := conn.Config.Name
+	if cm.alerted[name] && cm.countSessions(name) < conn.Config.SessionAlertThreshold {
+		delete(cm.alerted, name)
+	}
+}
+
+// countSessions returns the number of tracked sessions for a connection name
+func (cm *ConnectionManager) countSessions(name string) int {
+	count := 0
+	for _, conn := range cm.connections {
+		if conn.Config.Name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// CountByUsername returns the number of active (unexpired) connections a user holds
+func (cm *ConnectionManager) CountByUsername(username string) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.countByUsername(username, time.Now())
+}
+
+// countByUsername counts a user's connections that have not expired at now.
+// Expired connections free their slot before the cleanup loop removes them. Must be called with cm.mu held.
+func (cm *ConnectionManager) countByUsername(username string, now time.Time) int {
+	count := 0
+	for _, conn := range cm.connections {
+		if conn.Username == username && !now.After(conn.ExpiresAt()) {
+			count++
+		}
+	}
+	return count
+}
+
+// ActiveSessionsByConnection returns the number of active sessions per connection name
+func (cm *ConnectionManager) ActiveSessionsByConnection() map[string]int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	now := time.Now()
+	for _, conn := range cm.connections {
+		if now.After(conn.ExpiresAt()) {
+			continue
+		}
+		counts[conn.Config.Name]++
+	}
+	return counts
+}
+
 // GetConnection retrieves a connection by ID
 func (cm *ConnectionManager) GetConnection(connectionID string) (*Connection, error) {
 	cm.mu.RLock()
@@ -134,13 +600,42 @@ func (cm *ConnectionManager) GetConnection(connectionID string) (*Connection, er
 		return nil, fmt.Errorf("connection not found")
 	}
 
-	if time.Now().After(conn.ExpiresAt) {
+	now := time.Now()
+	if now.After(conn.ExpiresAt()) {
 		return nil, fmt.Errorf("connection expired")
 	}
+	if conn.IsIdle(now) {
+		return nil, fmt.Errorf("connection idle timeout")
+	}
 
 	return conn, nil
 }
 
+// ExtendConnection pushes out the expiry of a live connection, moving the deadlines
+// of its open streams along. It returns the previous expiry. Limits on how far a
+// connection may be extended are the caller's to enforce.
+func (cm *ConnectionManager) ExtendConnection(connectionID string, expiresAt time.Time) (time.Time, error) {
+	conn, err := cm.GetConnection(connectionID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	previous := conn.ExpiresAt()
+	if !expiresAt.After(previous) {
+		return previous, fmt.Errorf("%w (%s, currently %s)", ErrNotExtended,
+			expiresAt.Format(time.RFC3339), previous.Format(time.RFC3339))
+	}
+	conn.setExpiresAt(expiresAt)
+
+	cm.logger.Debug("connection extended",
+		"connection_id", connectionID,
+		"username", conn.Username,
+		"connection", conn.Config.Name,
+		"previous_expires_at", previous,
+		"expires_at", expiresAt)
+	return previous, nil
+}
+
 // CloseConnection closes a specific connection
 func (cm *ConnectionManager) CloseConnection(connectionID string) error {
 	cm.mu.Lock()
@@ -155,10 +650,67 @@ func (cm *ConnectionManager) CloseConnection(connectionID string) error {
 		_ = conn.Proxy.Close()
 	}
 	delete(cm.connections, connectionID)
+	cm.rearmSessionThreshold(conn)
 
 	return nil
 }
 
+// ApplyPolicyChange re-evaluates live connections against a reloaded policy.
+// Connections whose config was removed or whose owner lost access are drained
+// (streams closed, connection removed) and audited as revoked_by_reload; the
+// rest switch to the new policy's whitelist in place. Returns the number of
+// revoked connections.
+func (cm *ConnectionManager) ApplyPolicyChange(authz *authorization.Authorizer, auditLogPath string) int {
+	cm.mu.RLock()
+	conns := make([]*Connection, 0, len(cm.connections))
+	for _, conn := range cm.connections {
+		conns = append(conns, conn)
+	}
+	cm.mu.RUnlock()
+
+	revoked := 0
+	for _, conn := range conns {
+		conn.policyMu.RLock()
+		roles, ip, tracked := conn.roles, conn.clientIP, conn.whitelistSource != nil
+		conn.policyMu.RUnlock()
+		if !tracked {
+			// No policy recorded at connect time; nothing to re-evaluate
+			continue
+		}
+
+		name := conn.Config.Name
+		access := authz.CheckConnectionAccess(roles, name)
+		if access.Allowed && ip != nil && !authz.SourceAllowed(roles, name, ip) {
+			access = authorization.AccessDecision{Reason: fmt.Sprintf("client IP %s not in any allowed source network", ip)}
+		}
+		if access.Allowed {
+			scoped := authz
+			if ip != nil {
+				scoped = authz.ForSource(ip)
+			}
+			conn.SetPolicy(roles, scoped.NewWhitelistResolver(roles, name))
+			continue
+		}
+
+		cm.logger.Info("connection revoked by config reload",
+			"connection_id", conn.ID,
+			"username", conn.Username,
+			"connection", name,
+			"reason", access.Reason)
+		_ = audit.Log(auditLogPath, conn.Username, "revoked_by_reload", name, map[string]interface{}{
+			"connection_id": conn.ID,
+			"roles":         roles,
+			"reason":        access.Reason,
+		})
+		conn.CloseAllStreams()
+		if err := cm.CloseConnection(conn.ID); err == nil {
+			revoked++
+		}
+	}
+
+	return revoked
+}
+
 // CloseAll closes all active connections
 func (cm *ConnectionManager) CloseAll() {
 	cm.mu.Lock()
@@ -171,29 +723,58 @@ func (cm *ConnectionManager) CloseAll() {
 	}
 
 	cm.connections = make(map[string]*Connection)
+	cm.alerted = make(map[string]bool)
 	cm.cleanupTicker.Stop()
 }
 
-// cleanupExpired removes expired connections and forcefully closes active streams
+// cleanupExpired periodically removes expired and idle connections
 func (cm *ConnectionManager) cleanupExpired() {
 	for range cm.cleanupTicker.C {
-		cm.mu.Lock()
-		now := time.Now()
-		for id, conn := range cm.connections {
-			if now.After(conn.ExpiresAt) {
-				// Forcefully close all active TCP streams for this connection
-				conn.CloseAllStreams()
-
-				// Close the protocol handler (if not postgres)
-				if conn.Proxy != nil {
-					_ = conn.Proxy.Close()
-				}
-
-				// Remove from tracking
-				delete(cm.connections, id)
-			}
+		cm.removeStale(time.Now())
+	}
+}
+
+// removeStale removes connections that expired or went idle at now and
+// forcefully closes their active streams
+func (cm *ConnectionManager) removeStale(now time.Time) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for id, conn := range cm.connections {
+		expired := now.After(conn.ExpiresAt())
+		if !expired && !conn.IsIdle(now) {
+			continue
+		}
+
+		reason := "expired"
+		if !expired {
+			reason = "idle_timeout"
+		}
+		cm.logger.Debug("removing stale connection",
+			"connection_id", id,
+			"username", conn.Username,
+			"connection", conn.Config.Name,
+			"reason", reason)
+
+		if !expired {
+			_ = audit.Log(conn.auditLogPath, conn.Username, "idle_timeout", conn.Config.Name, map[string]interface{}{
+				"connection_id": id,
+				"idle_timeout":  conn.IdleTimeout.String(),
+				"last_activity": conn.LastActivity().Format(time.RFC3339),
+			})
+		}
+
+		// Forcefully close all active TCP streams for this connection
+		conn.CloseAllStreams()
+
+		// Close the protocol handler (if not postgres)
+		if conn.Proxy != nil {
+			_ = conn.Proxy.Close()
 		}
-		cm.mu.Unlock()
+
+		// Remove from tracking
+		delete(cm.connections, id)
+		cm.rearmSessionThreshold(conn)
 	}
 }
 
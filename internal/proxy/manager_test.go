@@ -1,11 +1,20 @@
 package proxy
 
 import (
+	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/davidcohan/port-authorizing/internal/approval"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
 )
 
@@ -222,6 +231,86 @@ func TestConnectionManager_GetConnection(t *testing.T) {
 	}
 }
 
+// deadlineConn records the deadline set on it
+type deadlineConn struct {
+	net.Conn
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *deadlineConn) Deadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline
+}
+
+func TestConnectionManager_ExtendConnection(t *testing.T) {
+	cm := NewConnectionManager(time.Hour)
+	defer cm.CloseAll()
+
+	connConfig := &config.ConnectionConfig{Name: "test-http", Type: "http", Host: "localhost", Port: 8080, Scheme: "http"}
+	connectionID, expiresAt, err := cm.CreateConnection("testuser", connConfig, 10*time.Minute, []string{}, "", nil)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	conn, _ := cm.GetConnection(connectionID)
+
+	followed, other := &deadlineConn{}, &deadlineConn{}
+	conn.RegisterStream(followed)
+	conn.FollowExpiry(followed)
+	conn.RegisterStream(other)
+	if !followed.Deadline().Equal(expiresAt) {
+		t.Errorf("followed stream deadline = %v, want %v", followed.Deadline(), expiresAt)
+	}
+
+	extended := conn.Extended()
+	newExpiry := expiresAt.Add(20 * time.Minute)
+	previous, err := cm.ExtendConnection(connectionID, newExpiry)
+	if err != nil {
+		t.Fatalf("ExtendConnection() error = %v", err)
+	}
+	if !previous.Equal(expiresAt) {
+		t.Errorf("previous expiry = %v, want %v", previous, expiresAt)
+	}
+	if !conn.ExpiresAt().Equal(newExpiry) {
+		t.Errorf("ExpiresAt() = %v, want %v", conn.ExpiresAt(), newExpiry)
+	}
+	select {
+	case <-extended:
+	default:
+		t.Error("Extended() channel was not closed")
+	}
+	if !followed.Deadline().Equal(newExpiry) {
+		t.Errorf("followed stream deadline = %v, want %v", followed.Deadline(), newExpiry)
+	}
+	if !other.Deadline().IsZero() {
+		t.Errorf("stream not following the expiry got deadline %v", other.Deadline())
+	}
+
+	// Unregistered streams stop following
+	conn.UnregisterStream(followed)
+	if _, err := cm.ExtendConnection(connectionID, newExpiry.Add(time.Minute)); err != nil {
+		t.Fatalf("ExtendConnection() error = %v", err)
+	}
+	if !followed.Deadline().Equal(newExpiry) {
+		t.Errorf("unregistered stream deadline moved to %v", followed.Deadline())
+	}
+
+	if _, err := cm.ExtendConnection(connectionID, expiresAt); !errors.Is(err, ErrNotExtended) {
+		t.Errorf("ExtendConnection() to an earlier expiry error = %v, want ErrNotExtended", err)
+	}
+	if _, err := cm.ExtendConnection("non-existent-id", newExpiry); err == nil {
+		t.Error("ExtendConnection() on unknown connection should fail")
+	}
+}
+
 func TestConnectionManager_CloseConnection(t *testing.T) {
 	cm := NewConnectionManager(1 * time.Hour)
 	defer cm.CloseAll()
@@ -275,6 +364,88 @@ func TestConnectionManager_CloseConnection(t *testing.T) {
 	}
 }
 
+func TestConnectionManager_CreateConnectionWithLimit(t *testing.T) {
+	cm := NewConnectionManager(1 * time.Hour)
+	defer cm.CloseAll()
+
+	connConfig := &config.ConnectionConfig{
+		Name:   "test-http",
+		Type:   "http",
+		Host:   "localhost",
+		Port:   8080,
+		Scheme: "http",
+	}
+	create := func(username string, limit int, duration time.Duration) (string, error) {
+		id, _, err := cm.CreateConnectionWithLimit(username, limit, connConfig, duration, []string{}, "", nil)
+		return id, err
+	}
+
+	// Concurrent connects never exceed the limit
+	const limit = 3
+	var wg sync.WaitGroup
+	var created, limited atomic.Int32
+	ids := make(chan string, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := create("alice", limit, 10*time.Minute)
+			switch {
+			case err == nil:
+				created.Add(1)
+				ids <- id
+			case errors.Is(err, ErrConnectionLimit):
+				limited.Add(1)
+			default:
+				t.Errorf("CreateConnectionWithLimit() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	if created.Load() != limit || limited.Load() != 20-limit {
+		t.Fatalf("created %d, limited %d; want %d created", created.Load(), limited.Load(), limit)
+	}
+	if count := cm.CountByUsername("alice"); count != limit {
+		t.Errorf("CountByUsername(alice) = %d, want %d", count, limit)
+	}
+
+	// Limits are per user, and 0 means unlimited
+	if _, err := create("bob", limit, 10*time.Minute); err != nil {
+		t.Errorf("other user blocked by alice's limit: %v", err)
+	}
+	if _, err := create("alice", 0, 10*time.Minute); err != nil {
+		t.Errorf("unlimited create failed: %v", err)
+	}
+	if _, err := create("alice", limit, 10*time.Minute); !errors.Is(err, ErrConnectionLimit) {
+		t.Errorf("create over limit error = %v, want ErrConnectionLimit", err)
+	}
+
+	// Closing a connection frees its slot (alice now holds 4)
+	if _, err := create("alice", 4, 10*time.Minute); !errors.Is(err, ErrConnectionLimit) {
+		t.Fatalf("create at limit error = %v, want ErrConnectionLimit", err)
+	}
+	if err := cm.CloseConnection(<-ids); err != nil {
+		t.Fatalf("CloseConnection() error = %v", err)
+	}
+	if _, err := create("alice", 4, 10*time.Minute); err != nil {
+		t.Errorf("create after close failed: %v", err)
+	}
+
+	// Expired connections free their slot before cleanup removes them
+	if _, err := create("carol", 1, time.Millisecond); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if count := cm.CountByUsername("carol"); count != 0 {
+		t.Errorf("CountByUsername(carol) = %d after expiry, want 0", count)
+	}
+	if _, err := create("carol", 1, 10*time.Minute); err != nil {
+		t.Errorf("create after expiry failed: %v", err)
+	}
+}
+
 func TestConnectionManager_GetActiveConnections(t *testing.T) {
 	cm := NewConnectionManager(1 * time.Hour)
 	defer cm.CloseAll()
@@ -720,3 +891,255 @@ func TestPostgresConnectionNoProxy(t *testing.T) {
 
 	// Postgres uses PostgresAuthProxy created in the handler with whitelist and approval manager
 }
+
+func TestConnectionManager_SessionAlertThreshold(t *testing.T) {
+	cm := NewConnectionManager(1 * time.Hour)
+	defer cm.CloseAll()
+
+	tmpFile, _ := os.CreateTemp("", "audit-*.log")
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	notified := make(chan map[string]interface{}, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		notified <- payload
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	approvalMgr := approval.NewManager(time.Minute)
+	approvalMgr.RegisterProvider(approval.NewWebhookProvider(webhook.URL, ""))
+
+	connConfig := &config.ConnectionConfig{
+		Name:                  "busy-api",
+		Type:                  "http",
+		Host:                  "localhost",
+		Port:                  8080,
+		SessionAlertThreshold: 2,
+	}
+
+	create := func() string {
+		id, _, err := cm.CreateConnection("alice", connConfig, time.Hour, nil, tmpFile.Name(), approvalMgr)
+		if err != nil {
+			t.Fatalf("CreateConnection() error = %v", err)
+		}
+		return id
+	}
+
+	first := create()
+	select {
+	case payload := <-notified:
+		t.Fatalf("unexpected notification below threshold: %v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	second := create()
+	select {
+	case payload := <-notified:
+		if payload["type"] != "notification" {
+			t.Errorf("payload type = %v, want notification", payload["type"])
+		}
+		metadata, _ := payload["metadata"].(map[string]interface{})
+		if metadata["active_sessions"] != "2" || metadata["connection"] != "busy-api" {
+			t.Errorf("notification metadata = %v", metadata)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected notification when threshold was reached")
+	}
+
+	// Staying above the threshold does not alert again
+	third := create()
+	select {
+	case payload := <-notified:
+		t.Fatalf("unexpected repeated notification: %v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if got := cm.ActiveSessionsByConnection()["busy-api"]; got != 3 {
+		t.Errorf("ActiveSessionsByConnection() = %d, want 3", got)
+	}
+
+	// Dropping below the threshold re-arms the alert
+	for _, id := range []string{first, second, third} {
+		_ = cm.CloseConnection(id)
+	}
+	create()
+	create()
+	select {
+	case <-notified:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected notification after the alert re-armed")
+	}
+
+	data, _ := os.ReadFile(tmpFile.Name())
+	if !strings.Contains(string(data), "session_threshold_exceeded") {
+		t.Error("audit log missing session_threshold_exceeded")
+	}
+}
+
+func TestConnectionManager_IdleTimeout(t *testing.T) {
+	tmpFile, _ := os.CreateTemp("", "audit-*.log")
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+	_ = tmpFile.Close()
+
+	cm := NewConnectionManager(time.Hour)
+	defer cm.CloseAll()
+	cm.SetDefaultIdleTimeout(time.Minute)
+
+	create := func(idleTimeout time.Duration) *Connection {
+		id, _, err := cm.CreateConnection("alice", &config.ConnectionConfig{
+			Name:        "idle-db",
+			Type:        "postgres",
+			Host:        "localhost",
+			Port:        5432,
+			IdleTimeout: idleTimeout,
+		}, time.Hour, nil, tmpFile.Name(), nil)
+		if err != nil {
+			t.Fatalf("CreateConnection() error = %v", err)
+		}
+		conn, err := cm.GetConnection(id)
+		if err != nil {
+			t.Fatalf("GetConnection() error = %v", err)
+		}
+		return conn
+	}
+
+	idle := create(0)
+	if idle.IdleTimeout != time.Minute {
+		t.Errorf("IdleTimeout = %v, want server default 1m", idle.IdleTimeout)
+	}
+	active := create(0)
+	custom := create(time.Hour)
+
+	// Backdate activity past the idle timeout; the active connection keeps traffic flowing
+	idle.lastActivity.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	custom.lastActivity.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	active.lastActivity.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	active.Touch()
+
+	if _, err := cm.GetConnection(idle.ID); err == nil || !strings.Contains(err.Error(), "idle") {
+		t.Errorf("GetConnection() on idle connection error = %v, want idle timeout", err)
+	}
+
+	stream, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	idle.RegisterStream(stream)
+
+	cm.removeStale(time.Now())
+
+	if _, err := peer.Write([]byte("x")); err == nil {
+		t.Error("idle connection stream was not closed")
+	}
+	if got := cm.GetActiveConnections(); got != 2 {
+		t.Errorf("GetActiveConnections() = %d, want 2", got)
+	}
+	for _, conn := range []*Connection{active, custom} {
+		if _, err := cm.GetConnection(conn.ID); err != nil {
+			t.Errorf("GetConnection(%s) error = %v", conn.ID, err)
+		}
+	}
+
+	data, _ := os.ReadFile(tmpFile.Name())
+	if !strings.Contains(string(data), "idle_timeout") || !strings.Contains(string(data), idle.ID) {
+		t.Errorf("audit log missing idle_timeout for %s: %s", idle.ID, data)
+	}
+}
+
+func TestTrackActivity(t *testing.T) {
+	conn := &Connection{IdleTimeout: time.Minute}
+	conn.lastActivity.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	tracked := TrackActivity(server, conn)
+	defer func() { _ = tracked.Close() }()
+
+	go func() { _, _ = client.Write([]byte("ping")) }()
+	buf := make([]byte, 4)
+	if _, err := tracked.Read(buf); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if conn.IsIdle(time.Now()) {
+		t.Error("connection still idle after traffic")
+	}
+}
+
+func TestConnectionManager_ApplyPolicyChange(t *testing.T) {
+	tmpFile, _ := os.CreateTemp("", "audit-*.log")
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+	_ = tmpFile.Close()
+
+	policyConfig := func(devWhitelist []string, connections ...string) *config.Config {
+		cfg := &config.Config{
+			Policies: []config.RolePolicy{
+				{Name: "dev", Roles: []string{"developer"}, Tags: []string{"env:dev"}, Whitelist: devWhitelist},
+				{Name: "ops", Roles: []string{"ops"}, Tags: []string{"env:prod"}},
+			},
+		}
+		for _, name := range connections {
+			tag := "env:dev"
+			if name == "prod-db" {
+				tag = "env:prod"
+			}
+			cfg.Connections = append(cfg.Connections, config.ConnectionConfig{Name: name, Type: "postgres", Tags: []string{tag}})
+		}
+		return cfg
+	}
+
+	oldAuthz := authorization.NewAuthorizer(policyConfig([]string{"^SELECT"}, "dev-db", "prod-db", "old-db"))
+	cm := NewConnectionManager(time.Hour)
+	defer cm.CloseAll()
+
+	connect := func(name string, roles []string) *Connection {
+		connConfig := &config.ConnectionConfig{Name: name, Type: "postgres", Host: "localhost", Port: 5432}
+		id, _, err := cm.CreateConnection("alice", connConfig, time.Hour, nil, tmpFile.Name(), nil)
+		if err != nil {
+			t.Fatalf("CreateConnection() error = %v", err)
+		}
+		conn, _ := cm.GetConnection(id)
+		conn.SetPolicy(roles, oldAuthz.NewWhitelistResolver(roles, name))
+		return conn
+	}
+
+	kept := connect("dev-db", []string{"developer"})
+	lostRole := connect("prod-db", []string{"developer", "ops"})
+	removed := connect("old-db", []string{"developer"})
+
+	stream, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	removed.RegisterStream(stream)
+
+	if got := kept.Whitelist(); len(got) != 1 || got[0] != "^SELECT" {
+		t.Fatalf("Whitelist() before reload = %v", got)
+	}
+
+	// Reload: old-db is gone, ops no longer matches prod-db, dev gains INSERT
+	newCfg := policyConfig([]string{"^SELECT", "^INSERT"}, "dev-db", "prod-db")
+	newCfg.Policies[1].Tags = []string{"env:staging"}
+	revoked := cm.ApplyPolicyChange(authorization.NewAuthorizer(newCfg), tmpFile.Name())
+
+	if revoked != 2 {
+		t.Errorf("ApplyPolicyChange() revoked = %d, want 2", revoked)
+	}
+	for _, conn := range []*Connection{lostRole, removed} {
+		if _, err := cm.GetConnection(conn.ID); err == nil {
+			t.Errorf("connection %s (%s) still active after revocation", conn.ID, conn.Config.Name)
+		}
+	}
+	if _, err := peer.Write([]byte("x")); err == nil {
+		t.Error("stream of revoked connection was not closed")
+	}
+
+	if _, err := cm.GetConnection(kept.ID); err != nil {
+		t.Fatalf("kept connection was revoked: %v", err)
+	}
+	if got := kept.Whitelist(); len(got) != 2 {
+		t.Errorf("Whitelist() after reload = %v, want updated policy", got)
+	}
+
+	data, _ := os.ReadFile(tmpFile.Name())
+	if strings.Count(string(data), "revoked_by_reload") != 2 {
+		t.Errorf("audit log should have 2 revoked_by_reload events: %s", data)
+	}
+}
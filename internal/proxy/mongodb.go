@@ -0,0 +1,751 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/xdg-go/scram"
+)
+
+// MongoDB wire protocol opcodes
+const (
+	mongoOpReply      int32 = 1
+	mongoOpQuery      int32 = 2004
+	mongoOpCompressed int32 = 2012
+	mongoOpMsg        int32 = 2013
+)
+
+const (
+	mongoHeaderSize     = 16
+	mongoMaxMessageSize = 48 * 1024 * 1024 // maxMessageSizeBytes advertised by mongod
+
+	mongoMsgChecksumPresent uint32 = 1 << 0
+	mongoMsgMoreToCome      uint32 = 1 << 1
+
+	mongoUnauthorizedCode = 13
+)
+
+// mongoAlwaysAllowed are connection handshake and cursor housekeeping commands
+// that every client needs regardless of the whitelist (keys are lowercase)
+var mongoAlwaysAllowed = map[string]bool{
+	"hello":       true,
+	"ismaster":    true,
+	"ping":        true,
+	"buildinfo":   true,
+	"getmore":     true,
+	"killcursors": true,
+	"endsessions": true,
+}
+
+// mongoAuthCommands are rejected: the proxy authenticates to the backend itself
+var mongoAuthCommands = map[string]bool{
+	"saslstart":    true,
+	"saslcontinue": true,
+	"authenticate": true,
+	"logout":       true,
+}
+
+// mongoReadCommands classify commands for the op_type audit field (keys are lowercase)
+var mongoReadCommands = map[string]bool{
+	"find": true, "aggregate": true, "count": true, "distinct": true, "getmore": true,
+	"listcollections": true, "listindexes": true, "listdatabases": true, "dbstats": true,
+	"collstats": true, "explain": true,
+}
+
+// mongoWriteCommands classify commands for the op_type audit field (keys are lowercase)
+var mongoWriteCommands = map[string]bool{
+	"insert": true, "update": true, "delete": true, "findandmodify": true, "bulkwrite": true,
+}
+
+// mongoCommand is the part of a client request the whitelist is evaluated on
+type mongoCommand struct {
+	name       string
+	database   string
+	collection string
+}
+
+// request returns the string matched against whitelist patterns:
+// "<command> <db>.<collection>", or "<command> <db>" for database-level commands
+func (c mongoCommand) request() string {
+	if c.collection == "" {
+		return c.name + " " + c.database
+	}
+	return c.name + " " + c.database + "." + c.collection
+}
+
+// opType classifies the command as read, write or admin
+func (c mongoCommand) opType() string {
+	name := strings.ToLower(c.name)
+	switch {
+	case mongoReadCommands[name]:
+		return "read"
+	case mongoWriteCommands[name]:
+		return "write"
+	default:
+		return "admin"
+	}
+}
+
+// MongoProxy proxies MongoDB connections with command-level whitelisting.
+// It authenticates to the backend with the connection's backend credentials
+// (SCRAM), so clients connect without credentials. Each OP_MSG/OP_QUERY command
+// is checked against the whitelist using "<command> <db>.<collection>", e.g.
+// "find shop.orders" or "dropDatabase shop".
+type MongoProxy struct {
+	config       *config.ConnectionConfig
+	whitelist    []string
+	auditLogPath string
+	username     string
+	connectionID string
+	requestID    atomic.Int32 // IDs for messages the proxy generates itself
+
+	mu          sync.Mutex
+	backendAddr string // Resolved backend address of the latest session, for audit records
+
+	whitelistSource WhitelistSource // Resolves time-scoped whitelists per command (optional)
+}
+
+// NewMongoProxy creates a MongoDB proxy with whitelist support
+func NewMongoProxy(cfg *config.ConnectionConfig, whitelist []string, auditLogPath, username, connectionID string) *MongoProxy {
+	return &MongoProxy{
+		config:       cfg,
+		whitelist:    whitelist,
+		auditLogPath: auditLogPath,
+		username:     username,
+		connectionID: connectionID,
+	}
+}
+
+// HandleRequest is not supported: MongoDB is served over the proxy stream with HandleConnection
+func (p *MongoProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
+	return fmt.Errorf("mongodb connections are served over the proxy stream")
+}
+
+// Close releases resources held by the proxy
+func (p *MongoProxy) Close() error {
+	return nil
+}
+
+// BackendAddr returns the resolved backend address of the latest session, or "" before it is known
+func (p *MongoProxy) BackendAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.backendAddr
+}
+
+// HandleConnection proxies one client connection (a tunnel stream) until either side closes
+func (p *MongoProxy) HandleConnection(clientConn net.Conn) error {
+	backendConn, selection, err := DialBackendSelection(p.config, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	defer func() { _ = backendConn.Close() }()
+
+	p.mu.Lock()
+	p.backendAddr = ResolvedBackendAddr(backendConn)
+	p.mu.Unlock()
+	LogBackendSelection(p.auditLogPath, p.username, p.config.Name, p.connectionID, selection)
+
+	if err := p.authenticateBackend(backendConn); err != nil {
+		_ = audit.Log(p.auditLogPath, p.username, "mongodb_backend_auth_failed", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"error":         err.Error(),
+		})
+		return fmt.Errorf("backend authentication failed: %w", err)
+	}
+
+	// Backend replies are relayed untouched
+	backendDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(clientConn, backendConn)
+		backendDone <- err
+		_ = clientConn.Close()
+	}()
+
+	clientErr := p.relayClientMessages(clientConn, backendConn)
+	_ = backendConn.Close()
+	<-backendDone
+
+	if errors.Is(clientErr, io.EOF) || errors.Is(clientErr, net.ErrClosed) {
+		return nil
+	}
+	return clientErr
+}
+
+// relayClientMessages reads client messages, enforces the whitelist and forwards allowed ones
+func (p *MongoProxy) relayClientMessages(clientConn, backendConn net.Conn) error {
+	for {
+		msg, err := readMongoMessage(clientConn)
+		if err != nil {
+			return err
+		}
+		opCode := int32(binary.LittleEndian.Uint32(msg[12:16]))
+
+		var cmd mongoCommand
+		var fireAndForget bool
+		switch opCode {
+		case mongoOpMsg:
+			cmd, fireAndForget, err = parseMongoOpMsg(msg)
+		case mongoOpQuery:
+			cmd, err = parseMongoOpQuery(msg)
+		case mongoOpCompressed:
+			// Compression is stripped from the handshake, so clients shouldn't send these
+			err = fmt.Errorf("compressed messages are not supported")
+		default:
+			err = fmt.Errorf("unsupported opcode %d", opCode)
+		}
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "mongodb_command_blocked", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"opcode":        opCode,
+				"reason":        err.Error(),
+			})
+			p.logDecision(fmt.Sprintf("opcode %d", opCode), audit.DecisionDeny, err.Error())
+			if opCode == mongoOpMsg || opCode == mongoOpQuery || opCode == mongoOpCompressed {
+				if writeErr := p.writeError(clientConn, msg, "request could not be parsed by the proxy"); writeErr != nil {
+					return writeErr
+				}
+				continue
+			}
+			return fmt.Errorf("mongodb message blocked: %w", err)
+		}
+
+		if reason := p.blockReason(cmd, msg); reason != "" {
+			action := "mongodb_command_blocked"
+			metadata := map[string]interface{}{
+				"connection_id": p.connectionID,
+				"command":       cmd.name,
+				"database":      cmd.database,
+				"collection":    cmd.collection,
+				"op_type":       cmd.opType(),
+				"reason":        reason,
+			}
+			if window := p.excludedWindow(cmd.request()); window != "" && reason == "does not match whitelist" {
+				metadata["reason"] = "outside time window"
+				metadata["time_window"] = window
+			}
+			if pattern, blacklisted := p.blacklistHit(cmd); blacklisted && reason == "blacklist_block" {
+				action = "blacklist_block"
+				metadata["protocol"] = "mongodb"
+				metadata["pattern"] = pattern
+			}
+			_ = audit.Log(p.auditLogPath, p.username, action, p.config.Name, metadata)
+			p.logDecision(cmd.request(), audit.DecisionDeny, metadata["reason"].(string))
+
+			if !fireAndForget {
+				errmsg := fmt.Sprintf("command %s not allowed by security policy", cmd.name)
+				if err := p.writeError(clientConn, msg, errmsg); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		_ = audit.Log(p.auditLogPath, p.username, "mongodb_command", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"command":       cmd.name,
+			"database":      cmd.database,
+			"collection":    cmd.collection,
+			"op_type":       cmd.opType(),
+			"allowed":       true,
+		})
+		p.logDecision(cmd.request(), audit.DecisionAllow, p.allowReason(cmd))
+
+		// Compression can't be inspected, so it is never negotiated
+		if isMongoHandshake(cmd.name) {
+			msg = stripMongoCompression(msg)
+		}
+
+		if _, err := backendConn.Write(msg); err != nil {
+			return fmt.Errorf("failed to forward to backend: %w", err)
+		}
+	}
+}
+
+// blockReason returns why a command is blocked, or "" when it may be forwarded
+func (p *MongoProxy) blockReason(cmd mongoCommand, msg []byte) string {
+	name := strings.ToLower(cmd.name)
+	if mongoAuthCommands[name] {
+		return "client authentication is handled by the proxy"
+	}
+	if mongoAlwaysAllowed[name] {
+		if isMongoHandshake(cmd.name) && mongoHasField(msg, "speculativeAuthenticate") {
+			return "client authentication is handled by the proxy"
+		}
+		return ""
+	}
+	if !p.isCommandAllowed(cmd) {
+		return "does not match whitelist"
+	}
+	if _, blacklisted := p.blacklistHit(cmd); blacklisted {
+		return "blacklist_block"
+	}
+	return ""
+}
+
+// blacklistHit returns the blacklist pattern a command matches
+func (p *MongoProxy) blacklistHit(cmd mongoCommand) (string, bool) {
+	return blacklistMatch(p.whitelistSource, cmd.request())
+}
+
+// isCommandAllowed checks a command against the whitelist
+func (p *MongoProxy) isCommandAllowed(cmd mongoCommand) bool {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
+		return true // No whitelist means everything is allowed
+	}
+
+	request := cmd.request()
+	for _, pattern := range whitelist {
+		matched, err := authorization.MatchPattern(pattern, request)
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "mongodb_whitelist_error", p.config.Name, map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowReason explains an allowed command for the decision log
+func (p *MongoProxy) allowReason(cmd mongoCommand) string {
+	if mongoAlwaysAllowed[strings.ToLower(cmd.name)] {
+		return "handshake or cursor command"
+	}
+	return whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), cmd.request())
+}
+
+// logDecision records a per-command whitelist decision in the decision log
+func (p *MongoProxy) logDecision(request, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "mongodb_command",
+		Resource:     p.config.Name,
+		Request:      request,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
+}
+
+// writeError answers a blocked request with an Unauthorized error document,
+// as an OP_MSG reply for OP_MSG requests and an OP_REPLY for legacy OP_QUERY
+func (p *MongoProxy) writeError(conn net.Conn, request []byte, errmsg string) error {
+	doc := (&bsonBuilder{}).
+		appendDouble("ok", 0).
+		appendString("errmsg", errmsg).
+		appendInt32("code", mongoUnauthorizedCode).
+		appendString("codeName", "Unauthorized").
+		build()
+
+	responseTo := int32(binary.LittleEndian.Uint32(request[4:8]))
+	var reply []byte
+	if int32(binary.LittleEndian.Uint32(request[12:16])) == mongoOpQuery {
+		reply = buildMongoOpReply(p.requestID.Add(1), responseTo, doc)
+	} else {
+		reply = buildMongoOpMsg(p.requestID.Add(1), responseTo, doc)
+	}
+	_, err := conn.Write(reply)
+	return err
+}
+
+// authenticateBackend runs a SCRAM conversation with the backend using the
+// connection's backend credentials. The mechanism is SCRAM-SHA-256 unless
+// metadata auth_mechanism selects SCRAM-SHA-1; the auth database is
+// backend_database, defaulting to "admin".
+func (p *MongoProxy) authenticateBackend(conn net.Conn) error {
+	if p.config.BackendUsername == "" {
+		return nil // Backend doesn't require authentication
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	mechanism := p.config.Metadata["auth_mechanism"]
+	if mechanism == "" {
+		mechanism = "SCRAM-SHA-256"
+	}
+
+	var client *scram.Client
+	var err error
+	switch mechanism {
+	case "SCRAM-SHA-256":
+		client, err = scram.SHA256.NewClient(p.config.BackendUsername, p.config.BackendPassword, "")
+	case "SCRAM-SHA-1":
+		// MongoDB's SCRAM-SHA-1 uses the legacy MONGODB-CR password digest
+		digest := md5.Sum([]byte(p.config.BackendUsername + ":mongo:" + p.config.BackendPassword))
+		client, err = scram.SHA1.NewClient(p.config.BackendUsername, hex.EncodeToString(digest[:]), "")
+	default:
+		return fmt.Errorf("unsupported auth mechanism %q (SCRAM-SHA-256, SCRAM-SHA-1)", mechanism)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create SCRAM client: %w", err)
+	}
+
+	authDB := p.config.BackendDatabase
+	if authDB == "" {
+		authDB = "admin"
+	}
+
+	conv := client.NewConversation()
+	payload, err := conv.Step("")
+	if err != nil {
+		return fmt.Errorf("SCRAM step 1 failed: %w", err)
+	}
+
+	reply, err := p.mongoRoundTrip(conn, (&bsonBuilder{}).
+		appendInt32("saslStart", 1).
+		appendString("mechanism", mechanism).
+		appendBinary("payload", []byte(payload)).
+		appendDocument("options", (&bsonBuilder{}).appendBool("skipEmptyExchange", true).build()).
+		appendString("$db", authDB).
+		build())
+	if err != nil {
+		return err
+	}
+
+	for {
+		serverPayload, conversationID, done, err := parseSASLReply(reply)
+		if err != nil {
+			return err
+		}
+
+		if conv.Done() {
+			if done {
+				return nil
+			}
+			payload = ""
+		} else {
+			payload, err = conv.Step(string(serverPayload))
+			if err != nil {
+				return fmt.Errorf("SCRAM step failed: %w", err)
+			}
+			if done && conv.Done() {
+				return nil
+			}
+		}
+
+		reply, err = p.mongoRoundTrip(conn, (&bsonBuilder{}).
+			appendInt32("saslContinue", 1).
+			appendInt32("conversationId", conversationID).
+			appendBinary("payload", []byte(payload)).
+			appendString("$db", authDB).
+			build())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mongoRoundTrip sends a command as OP_MSG and returns the reply's body document
+func (p *MongoProxy) mongoRoundTrip(conn net.Conn, doc []byte) ([]bsonElement, error) {
+	if _, err := conn.Write(buildMongoOpMsg(p.requestID.Add(1), 0, doc)); err != nil {
+		return nil, err
+	}
+	msg, err := readMongoMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	if int32(binary.LittleEndian.Uint32(msg[12:16])) != mongoOpMsg {
+		return nil, fmt.Errorf("unexpected reply opcode %d", int32(binary.LittleEndian.Uint32(msg[12:16])))
+	}
+	body, _, err := mongoOpMsgBody(msg)
+	if err != nil {
+		return nil, err
+	}
+	return bsonElements(body)
+}
+
+// parseSASLReply extracts the payload, conversation ID and done flag from a saslStart/saslContinue reply
+func parseSASLReply(reply []bsonElement) ([]byte, int32, bool, error) {
+	if ok, found := bsonLookup(reply, "ok"); !found || !mongoOK(ok) {
+		errmsg := "authentication failed"
+		if e, found := bsonLookup(reply, "errmsg"); found {
+			if s, isString := e.stringValue(); isString {
+				errmsg = s
+			}
+		}
+		return nil, 0, false, errors.New(errmsg)
+	}
+
+	var payload []byte
+	if e, found := bsonLookup(reply, "payload"); found {
+		payload, _ = e.binaryValue()
+	}
+	var conversationID int32
+	if e, found := bsonLookup(reply, "conversationId"); found {
+		if n, isNumber := e.numberValue(); isNumber {
+			conversationID = int32(n)
+		}
+	}
+	var done bool
+	if e, found := bsonLookup(reply, "done"); found {
+		n, _ := e.numberValue()
+		done = n != 0
+	}
+	return payload, conversationID, done, nil
+}
+
+// mongoOK reports whether an "ok" field signals success
+func mongoOK(e bsonElement) bool {
+	n, isNumber := e.numberValue()
+	return isNumber && n == 1
+}
+
+// readMongoMessage reads one complete wire protocol message, header included
+func readMongoMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, mongoHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(int32(binary.LittleEndian.Uint32(header)))
+	if length < mongoHeaderSize || length > mongoMaxMessageSize {
+		return nil, fmt.Errorf("invalid mongodb message length %d", length)
+	}
+
+	msg := make([]byte, length)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[mongoHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// mongoOpMsgBody returns the kind 0 (body) section of an OP_MSG and its flag bits
+func mongoOpMsgBody(msg []byte) ([]byte, uint32, error) {
+	offset, flags, err := mongoOpMsgBodyOffset(msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := int(int32(binary.LittleEndian.Uint32(msg[offset:])))
+	return msg[offset : offset+size], flags, nil
+}
+
+// mongoOpMsgBodyOffset locates the body section document of an OP_MSG
+func mongoOpMsgBodyOffset(msg []byte) (int, uint32, error) {
+	if len(msg) < mongoHeaderSize+5 {
+		return 0, 0, fmt.Errorf("OP_MSG too short")
+	}
+	flags := binary.LittleEndian.Uint32(msg[mongoHeaderSize:])
+	end := len(msg)
+	if flags&mongoMsgChecksumPresent != 0 {
+		end -= 4
+	}
+
+	pos := mongoHeaderSize + 4
+	for pos < end {
+		kind := msg[pos]
+		pos++
+		if pos+4 > end {
+			return 0, 0, fmt.Errorf("truncated OP_MSG section")
+		}
+		size := int(int32(binary.LittleEndian.Uint32(msg[pos:])))
+		if size < 5 || pos+size > end {
+			return 0, 0, fmt.Errorf("invalid OP_MSG section size %d", size)
+		}
+		if kind == 0 {
+			return pos, flags, nil
+		}
+		pos += size // Kind 1: document sequence
+	}
+	return 0, 0, fmt.Errorf("OP_MSG has no body section")
+}
+
+// parseMongoOpMsg extracts the command from an OP_MSG; fireAndForget is set
+// when the client expects no reply (moreToCome)
+func parseMongoOpMsg(msg []byte) (mongoCommand, bool, error) {
+	body, flags, err := mongoOpMsgBody(msg)
+	if err != nil {
+		return mongoCommand{}, false, err
+	}
+	elements, err := bsonElements(body)
+	if err != nil {
+		return mongoCommand{}, false, err
+	}
+	if len(elements) == 0 {
+		return mongoCommand{}, false, fmt.Errorf("empty command document")
+	}
+
+	cmd := commandFromElements(elements)
+	if db, found := bsonLookup(elements, "$db"); found {
+		cmd.database, _ = db.stringValue()
+	}
+	return cmd, flags&mongoMsgMoreToCome != 0, nil
+}
+
+// parseMongoOpQuery extracts the command from a legacy OP_QUERY
+// Commands are queries against "<db>.$cmd"; other queries are treated as a find.
+func parseMongoOpQuery(msg []byte) (mongoCommand, error) {
+	pos := mongoHeaderSize + 4 // flags
+	if pos >= len(msg) {
+		return mongoCommand{}, fmt.Errorf("OP_QUERY too short")
+	}
+	end := strings.IndexByte(string(msg[pos:]), 0)
+	if end < 0 {
+		return mongoCommand{}, fmt.Errorf("unterminated collection name")
+	}
+	fullName := string(msg[pos : pos+end])
+	pos += end + 1 + 8 // numberToSkip, numberToReturn
+	if pos > len(msg) {
+		return mongoCommand{}, fmt.Errorf("OP_QUERY too short")
+	}
+
+	elements, err := bsonElements(msg[pos:])
+	if err != nil {
+		return mongoCommand{}, err
+	}
+
+	database, collection, _ := strings.Cut(fullName, ".")
+	if collection != "$cmd" {
+		return mongoCommand{name: "find", database: database, collection: collection}, nil
+	}
+
+	// Commands with read preferences are wrapped as {$query: {...}}
+	if wrapped, found := bsonLookup(elements, "$query"); found && wrapped.kind == bsonDocument {
+		if elements, err = bsonElements(wrapped.value); err != nil {
+			return mongoCommand{}, err
+		}
+	}
+	if len(elements) == 0 {
+		return mongoCommand{}, fmt.Errorf("empty command document")
+	}
+
+	cmd := commandFromElements(elements)
+	cmd.database = database
+	return cmd, nil
+}
+
+// commandFromElements takes the command name from the first key and the
+// collection from its value (or the "collection" field, as getMore uses)
+func commandFromElements(elements []bsonElement) mongoCommand {
+	cmd := mongoCommand{name: elements[0].key}
+	if collection, ok := elements[0].stringValue(); ok {
+		cmd.collection = collection
+	} else if e, found := bsonLookup(elements, "collection"); found {
+		cmd.collection, _ = e.stringValue()
+	}
+	return cmd
+}
+
+// isMongoHandshake reports whether a command is the connection handshake
+func isMongoHandshake(name string) bool {
+	return strings.EqualFold(name, "hello") || strings.EqualFold(name, "isMaster")
+}
+
+// mongoHasField reports whether the command document of a message has a top-level field
+func mongoHasField(msg []byte, key string) bool {
+	elements, _, _ := mongoCommandElements(msg)
+	_, found := bsonLookup(elements, key)
+	return found
+}
+
+// mongoCommandElements returns the command document's elements and its bounds in msg
+func mongoCommandElements(msg []byte) ([]bsonElement, [2]int, error) {
+	var start int
+	switch int32(binary.LittleEndian.Uint32(msg[12:16])) {
+	case mongoOpMsg:
+		offset, _, err := mongoOpMsgBodyOffset(msg)
+		if err != nil {
+			return nil, [2]int{}, err
+		}
+		start = offset
+	case mongoOpQuery:
+		pos := mongoHeaderSize + 4
+		end := strings.IndexByte(string(msg[pos:]), 0)
+		if end < 0 || pos+end+1+8 > len(msg) {
+			return nil, [2]int{}, fmt.Errorf("OP_QUERY too short")
+		}
+		start = pos + end + 1 + 8
+	default:
+		return nil, [2]int{}, fmt.Errorf("unsupported opcode")
+	}
+
+	elements, err := bsonElements(msg[start:])
+	if err != nil {
+		return nil, [2]int{}, err
+	}
+	size := int(int32(binary.LittleEndian.Uint32(msg[start:])))
+	return elements, [2]int{start, start + size}, nil
+}
+
+// stripMongoCompression removes the "compression" field from a handshake so
+// the backend never negotiates compressed (uninspectable) messages
+func stripMongoCompression(msg []byte) []byte {
+	elements, bounds, err := mongoCommandElements(msg)
+	if err != nil {
+		return msg
+	}
+	if _, found := bsonLookup(elements, "compression"); !found {
+		return msg
+	}
+
+	b := &bsonBuilder{}
+	for _, e := range elements {
+		if e.key == "compression" {
+			continue
+		}
+		b.key(e.kind, e.key)
+		b.buf.Write(e.value)
+	}
+	doc := b.build()
+
+	out := make([]byte, 0, len(msg))
+	out = append(out, msg[:bounds[0]]...)
+	out = append(out, doc...)
+	out = append(out, msg[bounds[1]:]...)
+
+	// The checksum no longer matches the rewritten message; drop it
+	if int32(binary.LittleEndian.Uint32(out[12:16])) == mongoOpMsg {
+		flags := binary.LittleEndian.Uint32(out[mongoHeaderSize:])
+		if flags&mongoMsgChecksumPresent != 0 {
+			out = out[:len(out)-4]
+			binary.LittleEndian.PutUint32(out[mongoHeaderSize:], flags&^mongoMsgChecksumPresent)
+		}
+	}
+	binary.LittleEndian.PutUint32(out, uint32(len(out)))
+	return out
+}
+
+// buildMongoOpMsg builds an OP_MSG with a single body section
+func buildMongoOpMsg(requestID, responseTo int32, doc []byte) []byte {
+	msg := make([]byte, mongoHeaderSize+4+1, mongoHeaderSize+4+1+len(doc))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(msg[8:], uint32(responseTo))
+	binary.LittleEndian.PutUint32(msg[12:], uint32(mongoOpMsg))
+	// flagBits (0) and section kind 0 are already zero
+	msg = append(msg, doc...)
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+	return msg
+}
+
+// buildMongoOpReply builds a legacy OP_REPLY carrying one document
+func buildMongoOpReply(requestID, responseTo int32, doc []byte) []byte {
+	msg := make([]byte, mongoHeaderSize+20, mongoHeaderSize+20+len(doc))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(msg[8:], uint32(responseTo))
+	binary.LittleEndian.PutUint32(msg[12:], uint32(mongoOpReply))
+	// responseFlags, cursorID and startingFrom are zero
+	binary.LittleEndian.PutUint32(msg[mongoHeaderSize+16:], 1) // numberReturned
+	msg = append(msg, doc...)
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+	return msg
+}
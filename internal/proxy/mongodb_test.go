@@ -0,0 +1,346 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xdg-go/scram"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// fakeMongo is a MongoDB backend that requires SCRAM-SHA-256 and answers
+// every other command with {ok: 1}, recording the commands it received
+type fakeMongo struct {
+	t        *testing.T
+	server   *scram.Server
+	mu       sync.Mutex
+	commands []string
+}
+
+func startFakeMongo(t *testing.T, username, password string) (*fakeMongo, *net.TCPAddr) {
+	client, _ := scram.SHA256.NewClient(username, password, "")
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "fake-mongo-salt", Iters: 4096})
+	server, err := scram.SHA256.NewServer(func(name string) (scram.StoredCredentials, error) {
+		if name != username {
+			return scram.StoredCredentials{}, errors.New("unknown user")
+		}
+		return credentials, nil
+	})
+	if err != nil {
+		t.Fatalf("scram.NewServer() error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	fm := &fakeMongo{t: t, server: server}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fm.serve(conn)
+		}
+	}()
+	return fm, listener.Addr().(*net.TCPAddr)
+}
+
+func (fm *fakeMongo) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	conv := fm.server.NewConversation()
+	authenticated := false
+
+	for {
+		msg, err := readMongoMessage(conn)
+		if err != nil {
+			return
+		}
+		requestID := int32(binary.LittleEndian.Uint32(msg[4:8]))
+		body, _, err := mongoOpMsgBody(msg)
+		if err != nil {
+			return
+		}
+		elements, _ := bsonElements(body)
+
+		reply := &bsonBuilder{}
+		switch elements[0].key {
+		case "saslStart", "saslContinue":
+			e, _ := bsonLookup(elements, "payload")
+			payload, _ := e.binaryValue()
+			response, err := conv.Step(string(payload))
+			if err != nil {
+				reply.appendDouble("ok", 0).appendString("errmsg", "Authentication failed.").appendInt32("code", 18)
+				break
+			}
+			authenticated = conv.Valid()
+			reply.appendInt32("conversationId", 1).
+				appendBool("done", conv.Done()).
+				appendBinary("payload", []byte(response)).
+				appendDouble("ok", 1)
+		default:
+			fm.mu.Lock()
+			fm.commands = append(fm.commands, elements[0].key)
+			fm.mu.Unlock()
+			if !authenticated && elements[0].key != "hello" {
+				reply.appendDouble("ok", 0).appendString("errmsg", "requires authentication").appendInt32("code", 13)
+				break
+			}
+			if _, found := bsonLookup(elements, "compression"); found {
+				reply.appendBool("compressionNegotiated", true)
+			}
+			reply.appendDouble("ok", 1)
+		}
+
+		if _, err := conn.Write(buildMongoOpMsg(requestID+1000, requestID, reply.build())); err != nil {
+			return
+		}
+	}
+}
+
+func (fm *fakeMongo) received() []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return append([]string(nil), fm.commands...)
+}
+
+// mongoCommandMsg builds a client OP_MSG for a command
+func mongoCommandMsg(requestID int32, build func(b *bsonBuilder)) []byte {
+	b := &bsonBuilder{}
+	build(b)
+	return buildMongoOpMsg(requestID, 0, b.build())
+}
+
+// mongoReply reads a reply and returns its body elements
+func mongoReply(t *testing.T, conn net.Conn) []bsonElement {
+	msg, err := readMongoMessage(conn)
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	var doc []byte
+	switch int32(binary.LittleEndian.Uint32(msg[12:16])) {
+	case mongoOpMsg:
+		doc, _, err = mongoOpMsgBody(msg)
+		if err != nil {
+			t.Fatalf("invalid OP_MSG reply: %v", err)
+		}
+	case mongoOpReply:
+		doc = msg[mongoHeaderSize+20:]
+	default:
+		t.Fatalf("unexpected reply opcode %d", binary.LittleEndian.Uint32(msg[12:16]))
+	}
+	elements, err := bsonElements(doc)
+	if err != nil {
+		t.Fatalf("invalid reply document: %v", err)
+	}
+	return elements
+}
+
+func TestMongoProxy_CommandWhitelist(t *testing.T) {
+	backend, addr := startFakeMongo(t, "proxyuser", "s3cret")
+	auditLog := t.TempDir() + "/audit.log"
+
+	cfg := &config.ConnectionConfig{
+		Name:            "orders-mongo",
+		Type:            "mongodb",
+		Host:            "127.0.0.1",
+		Port:            addr.Port,
+		BackendUsername: "proxyuser",
+		BackendPassword: "s3cret",
+	}
+	p := NewMongoProxy(cfg, []string{`^(find|aggregate) shop\.`}, auditLog, "alice", "conn-1")
+
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	done := make(chan error, 1)
+	go func() { done <- p.HandleConnection(server) }()
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		wantOK  bool
+		wantCmd string
+	}{
+		{
+			name: "handshake always allowed",
+			msg: mongoCommandMsg(1, func(b *bsonBuilder) {
+				b.appendInt32("hello", 1).appendString("$db", "admin")
+			}),
+			wantOK:  true,
+			wantCmd: "hello",
+		},
+		{
+			name: "find allowed",
+			msg: mongoCommandMsg(2, func(b *bsonBuilder) {
+				b.appendString("find", "orders").appendString("$db", "shop")
+			}),
+			wantOK:  true,
+			wantCmd: "find",
+		},
+		{
+			name: "aggregate allowed",
+			msg: mongoCommandMsg(3, func(b *bsonBuilder) {
+				b.appendString("aggregate", "orders").appendString("$db", "shop")
+			}),
+			wantOK:  true,
+			wantCmd: "aggregate",
+		},
+		{
+			name: "find in other database blocked",
+			msg: mongoCommandMsg(4, func(b *bsonBuilder) {
+				b.appendString("find", "users").appendString("$db", "billing")
+			}),
+		},
+		{
+			name: "dropDatabase blocked",
+			msg: mongoCommandMsg(5, func(b *bsonBuilder) {
+				b.appendInt32("dropDatabase", 1).appendString("$db", "shop")
+			}),
+		},
+		{
+			name: "client authentication blocked",
+			msg: mongoCommandMsg(6, func(b *bsonBuilder) {
+				b.appendInt32("saslStart", 1).appendString("mechanism", "SCRAM-SHA-256").appendString("$db", "admin")
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.Write(tt.msg); err != nil {
+				t.Fatalf("failed to send command: %v", err)
+			}
+			reply := mongoReply(t, client)
+
+			ok, _ := bsonLookup(reply, "ok")
+			if mongoOK(ok) != tt.wantOK {
+				t.Fatalf("reply ok = %v, want %v", mongoOK(ok), tt.wantOK)
+			}
+			if !tt.wantOK {
+				code, _ := bsonLookup(reply, "code")
+				if n, _ := code.numberValue(); n != mongoUnauthorizedCode {
+					t.Errorf("error code = %v, want %d", n, mongoUnauthorizedCode)
+				}
+				codeName, _ := bsonLookup(reply, "codeName")
+				if s, _ := codeName.stringValue(); s != "Unauthorized" {
+					t.Errorf("codeName = %q, want Unauthorized", s)
+				}
+			}
+		})
+	}
+
+	_ = client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("HandleConnection() error = %v", err)
+	}
+
+	got := strings.Join(backend.received(), ",")
+	if got != "hello,find,aggregate" {
+		t.Errorf("backend received %q, want only allowed commands", got)
+	}
+
+	data, _ := os.ReadFile(auditLog)
+	log := string(data)
+	for _, want := range []string{
+		`"mongodb_command"`, `"collection":"orders"`, `"op_type":"read"`,
+		`"mongodb_command_blocked"`, `"command":"dropDatabase"`, `"op_type":"admin"`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("audit log missing %s: %s", want, log)
+		}
+	}
+	if p.BackendAddr() != addr.String() {
+		t.Errorf("BackendAddr() = %q, want %q", p.BackendAddr(), addr.String())
+	}
+}
+
+func TestMongoProxy_LegacyOpQuery(t *testing.T) {
+	_, addr := startFakeMongo(t, "proxyuser", "s3cret")
+	cfg := &config.ConnectionConfig{
+		Name: "orders-mongo", Type: "mongodb", Host: "127.0.0.1", Port: addr.Port,
+		BackendUsername: "proxyuser", BackendPassword: "s3cret",
+	}
+	p := NewMongoProxy(cfg, []string{`^find shop\.`}, t.TempDir()+"/audit.log", "alice", "conn-1")
+
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	go func() { _ = p.HandleConnection(server) }()
+
+	// OP_QUERY against shop.$cmd carrying {drop: "orders"}
+	query := []byte{0, 0, 0, 0} // flags
+	query = append(query, "shop.$cmd\x00"...)
+	query = append(query, 0, 0, 0, 0, 1, 0, 0, 0) // numberToSkip, numberToReturn
+	query = append(query, (&bsonBuilder{}).appendString("drop", "orders").build()...)
+
+	msg := make([]byte, mongoHeaderSize, mongoHeaderSize+len(query))
+	binary.LittleEndian.PutUint32(msg[4:], 7)
+	binary.LittleEndian.PutUint32(msg[12:], uint32(mongoOpQuery))
+	msg = append(msg, query...)
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+
+	if _, err := client.Write(msg); err != nil {
+		t.Fatalf("failed to send query: %v", err)
+	}
+
+	reply, err := readMongoMessage(client)
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if opCode := int32(binary.LittleEndian.Uint32(reply[12:16])); opCode != mongoOpReply {
+		t.Fatalf("reply opcode = %d, want OP_REPLY", opCode)
+	}
+	if responseTo := binary.LittleEndian.Uint32(reply[8:12]); responseTo != 7 {
+		t.Errorf("responseTo = %d, want 7", responseTo)
+	}
+	elements, _ := bsonElements(reply[mongoHeaderSize+20:])
+	if ok, _ := bsonLookup(elements, "ok"); mongoOK(ok) {
+		t.Error("blocked OP_QUERY command should reply ok: 0")
+	}
+}
+
+func TestMongoProxy_StripsCompression(t *testing.T) {
+	msg := mongoCommandMsg(1, func(b *bsonBuilder) {
+		b.appendInt32("hello", 1)
+		b.key(bsonArray, "compression")
+		b.buf.Write((&bsonBuilder{}).appendString("0", "zstd").build())
+		b.appendString("$db", "admin")
+	})
+
+	stripped := stripMongoCompression(msg)
+	if mongoHasField(stripped, "compression") {
+		t.Fatal("compression field was not removed")
+	}
+	if got := int(binary.LittleEndian.Uint32(stripped)); got != len(stripped) {
+		t.Errorf("message length = %d, want %d", got, len(stripped))
+	}
+	cmd, _, err := parseMongoOpMsg(stripped)
+	if err != nil || cmd.name != "hello" || cmd.database != "admin" {
+		t.Errorf("parseMongoOpMsg() = %+v, %v", cmd, err)
+	}
+}
+
+func TestMongoProxy_BackendAuthFailure(t *testing.T) {
+	_, addr := startFakeMongo(t, "proxyuser", "s3cret")
+	cfg := &config.ConnectionConfig{
+		Name: "orders-mongo", Type: "mongodb", Host: "127.0.0.1", Port: addr.Port,
+		BackendUsername: "proxyuser", BackendPassword: "wrong",
+	}
+
+	if err := ValidateBackend(cfg); !errors.Is(err, ErrBackendAuthFailed) {
+		t.Errorf("ValidateBackend() error = %v, want ErrBackendAuthFailed", err)
+	}
+
+	cfg.BackendPassword = "s3cret"
+	if err := ValidateBackend(cfg); err != nil {
+		t.Errorf("ValidateBackend() with valid credentials error = %v", err)
+	}
+}
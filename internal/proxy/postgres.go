@@ -44,6 +44,7 @@ type PostgresProxy struct {
 	username     string // API username (for audit logging)
 	connectionID string
 	apiConfig    *config.Config // Full API config for user validation
+	backendAddr  string         // Resolved backend address, for audit records
 }
 
 // NewPostgresProxy creates a new PostgreSQL protocol-aware proxy
@@ -182,12 +183,14 @@ func (p *PostgresProxy) HandleConnection(clientConn net.Conn) error {
 	}
 
 	// Connect to backend
-	backendConn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", p.config.Host, p.config.Port), 10*time.Second)
+	backendConn, selection, err := DialBackendSelection(p.config, 10*time.Second)
 	if err != nil {
 		p.sendError(clientConn, "08006", fmt.Sprintf("could not connect to backend: %v", err))
 		return fmt.Errorf("failed to connect to backend: %w", err)
 	}
 	defer func() { _ = backendConn.Close() }()
+	p.backendAddr = ResolvedBackendAddr(backendConn)
+	LogBackendSelection(p.auditLogPath, p.username, p.config.Name, p.connectionID, selection)
 
 	// Create frontend to backend
 	backendReader := newSimpleChunkReader(backendConn)
@@ -344,6 +347,7 @@ func (p *PostgresProxy) logQuery(query string) {
 		"connection_id": p.connectionID,
 		"query":         query,
 		"database":      p.config.BackendDatabase,
+		"backend_addr":  p.backendAddr,
 	})
 }
 
@@ -416,7 +420,7 @@ func (p *PostgresProxy) validateAPICredentials(username, password string) bool {
 	}
 
 	for _, user := range p.apiConfig.Auth.Users {
-		if user.Username == username && user.Password == password {
+		if config.SameUsername(user.Username, username) && user.Password == password {
 			return true
 		}
 	}
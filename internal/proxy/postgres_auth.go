@@ -5,18 +5,21 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/approval"
 	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 	"github.com/davidcohan/port-authorizing/internal/config"
 	"github.com/davidcohan/port-authorizing/internal/security"
 	"github.com/xdg-go/scram"
@@ -31,6 +34,34 @@ type PostgresAuthProxy struct {
 	apiConfig    *config.Config
 	whitelist    []string
 	approvalMgr  *approval.Manager
+	explainOnly  bool   // EXPLAIN preview mode: queries are never executed
+	readOnly     bool   // Read-only mode: only SELECT/EXPLAIN are forwarded
+	reason       string // Justification given at connect time, shown to approvers
+	database     string // Backend database: backend_database, the one picked at connect time, or the client's
+	expiry       Expiry // Connection expiry; clients get a NoticeResponse shortly before
+	backendAddr  string // Resolved backend address of this session, for audit records
+
+	// Backend pooling state: whether the session came from the pool, and whether the client
+	// ended it with Terminate while the backend stream was idle (so it may go back)
+	reusedBackend    bool
+	clientTerminated bool
+	clientFraming    pgFraming
+	backendFraming   pgFraming
+
+	// Client message state: complete messages are validated one at a time, and after a
+	// blocked Parse the rest of the extended-query batch is dropped up to its Sync
+	clientMessages pgMessageReader
+	skipUntilSync  bool
+	statements     map[string]string // Prepared statement name -> SQL, for auditing executions
+	portals        map[string]string // Portal name -> prepared statement name
+
+	whitelistSource  WhitelistSource          // Resolves time-scoped whitelists per query (optional)
+	tablePermissions []config.TablePermission // Operations allowed per table; empty means not enforced
+	copyDirections   []string                 // COPY directions allowed by policy (FROM, TO)
+	analyzer         *security.SQLAnalyzer
+
+	// Stacked statements and unlisted operations pass whitelist-only connections (security.block_multi_statement: false)
+	allowMultiStatement bool
 }
 
 // NewPostgresAuthProxy creates a postgres proxy with auth handling
@@ -42,7 +73,9 @@ func NewPostgresAuthProxy(cfg *config.ConnectionConfig, auditLogPath, username,
 		connectionID: connectionID,
 		apiConfig:    apiConfig,
 		whitelist:    whitelist,
+		database:     cfg.BackendDatabase,
 		approvalMgr:  nil, // Will be set later if approvals are enabled
+		analyzer:     security.NewSQLAnalyzer(),
 	}
 }
 
@@ -51,6 +84,52 @@ func (p *PostgresAuthProxy) SetApprovalManager(mgr *approval.Manager) {
 	p.approvalMgr = mgr
 }
 
+// SetTablePermissions sets the table permissions checked against each parsed query
+func (p *PostgresAuthProxy) SetTablePermissions(permissions []config.TablePermission) {
+	p.tablePermissions = permissions
+}
+
+// SetConnectReason sets the justification given at connect time, included in approval requests
+func (p *PostgresAuthProxy) SetConnectReason(reason string) {
+	p.reason = reason
+}
+
+// SetDatabase sets the database picked at connect time ("" keeps backend_database); it
+// replaces the one in the client's startup message and must be allowed by the connection
+func (p *PostgresAuthProxy) SetDatabase(database string) {
+	if database != "" {
+		p.database = database
+	}
+}
+
+// SetExpiry sets the connection expiry used to warn the client before disconnect
+func (p *PostgresAuthProxy) SetExpiry(expiry Expiry) {
+	p.expiry = expiry
+}
+
+// BackendAddr returns the resolved address of the backend this session connected to
+func (p *PostgresAuthProxy) BackendAddr() string {
+	return p.backendAddr
+}
+
+// DatabaseAllowed reports whether sessions on the connection may use database: its
+// backend_database or one of its allowed_databases. Connections with neither set pass
+// through whatever database the client asks for.
+func DatabaseAllowed(cfg *config.ConnectionConfig, database string) bool {
+	if cfg.BackendDatabase == "" && len(cfg.AllowedDatabases) == 0 {
+		return true
+	}
+	if database == cfg.BackendDatabase {
+		return true
+	}
+	for _, allowed := range cfg.AllowedDatabases {
+		if database == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 // HandleConnection handles the full postgres connection with auth
 func (p *PostgresAuthProxy) HandleConnection(clientConn net.Conn) error {
 	defer func() { _ = clientConn.Close() }()
@@ -76,11 +155,17 @@ func (p *PostgresAuthProxy) HandleConnection(clientConn net.Conn) error {
 		}
 	}
 
+	// CancelRequest arrives on its own connection instead of a startup message
+	if isCancelRequest(startupMsg) {
+		return p.handleCancelRequest(startupMsg)
+	}
+
 	// Parse parameters from startup
 	params, database := p.parseStartupParams(startupMsg)
 	clientUser := params["user"]
 
-	// Request password from client (cleartext for simplicity)
+	// Request password from client. Cleartext is accepted by every driver and the password
+	// is not checked, so the front side never depends on how the backend authenticates.
 	if err := p.sendAuthRequest(clientConn); err != nil {
 		return err
 	}
@@ -113,32 +198,88 @@ func (p *PostgresAuthProxy) HandleConnection(clientConn net.Conn) error {
 		"note":          "password validation skipped - already authenticated via JWT",
 	})
 
-	// Connect to backend with BACKEND credentials
-	backendAddr := fmt.Sprintf("%s:%d", p.config.Host, p.config.Port)
-	backendConn, err := net.DialTimeout("tcp", backendAddr, 10*time.Second)
+	// Connect to backend with BACKEND credentials (read-only sessions go to the replica, if any)
+	backendHost, backendPort, replica := p.backendTarget()
+	backendAddr := fmt.Sprintf("%s:%d", backendHost, backendPort)
+	backendTLS, err := BackendTLSConfig(p.config)
 	if err != nil {
-		p.sendAuthError(clientConn, "Backend connection failed")
-		return fmt.Errorf("failed to connect to backend: %w", err)
+		p.logBackendTLSError(err)
+		p.sendAuthError(clientConn, "Backend TLS misconfigured")
+		return err
+	}
+	if backendTLS != nil {
+		backendTLS.ServerName = backendHost
+	}
+	if p.readOnly {
+		params = readOnlyStartupParams(params)
 	}
-	defer func() { _ = backendConn.Close() }()
 
-	// Send startup to backend with BACKEND username
-	backendDB := p.config.BackendDatabase
+	backendDB := p.database
 	if backendDB == "" {
 		backendDB = database
 	}
-	if err := p.sendBackendStartup(backendConn, p.config.BackendUsername, backendDB); err != nil {
-		return err
+	if !DatabaseAllowed(p.config, backendDB) {
+		p.sendAuthError(clientConn, fmt.Sprintf("Access to database %q is not allowed on this connection", backendDB))
+		_ = audit.Log(p.auditLogPath, p.username, "database_denied", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"database":      backendDB,
+			"allowed":       p.config.AllowedDatabases,
+		})
+		return fmt.Errorf("database %q not allowed", backendDB)
+	}
+	p.database = backendDB
+
+	// Reuse an idle pooled backend session when pooling is enabled
+	var pooled *pgPooledConn
+	var poolKey string
+	if p.config.PoolMax > 0 {
+		poolKey = postgresPoolKey(p.config, backendAddr, backendDB, params)
+		pooled = acquirePooledBackend(poolKey)
+	}
+	if pooled == nil {
+		pooled, err = p.openBackend(clientConn, backendAddr, replica, backendTLS, backendDB, params)
+		if err != nil {
+			return err
+		}
+	} else {
+		p.reusedBackend = true
+	}
+	backendConn := pooled.conn
+	returnedToPool := false
+	defer func() {
+		if !returnedToPool {
+			_ = backendConn.Close()
+		}
+	}()
+	p.backendAddr = ResolvedBackendAddr(backendConn)
+	if replica {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_replica_route", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"replica":       backendAddr,
+			"backend_addr":  p.backendAddr,
+		})
 	}
 
-	// Handle backend authentication
-	if err := p.handleBackendAuth(backendConn, p.config.BackendPassword); err != nil {
-		p.sendAuthError(clientConn, "Backend authentication failed")
-		return fmt.Errorf("backend auth failed: %w", err)
+	// Issue the client a proxy cancel key mapped to the backend session
+	startup := *pooled.startup
+	if startup.HasKeyData {
+		key, err := registerCancelKey(&cancelTarget{
+			BackendAddr:  pooled.addr,
+			BackendTLS:   backendTLS,
+			BackendKey:   cancelKey{ProcessID: startup.ProcessID, SecretKey: startup.SecretKey},
+			Username:     p.username,
+			ConnectionID: p.connectionID,
+		})
+		if err != nil {
+			p.sendAuthError(clientConn, "Failed to set up session")
+			return err
+		}
+		defer unregisterCancelKey(key)
+		startup.ProcessID, startup.SecretKey = key.ProcessID, key.SecretKey
 	}
 
-	// Send success to client
-	if err := p.sendAuthSuccess(clientConn); err != nil {
+	// Send success to client with the backend's session parameters
+	if err := p.sendAuthSuccess(clientConn, &startup); err != nil {
 		return err
 	}
 
@@ -147,28 +288,106 @@ func (p *PostgresAuthProxy) HandleConnection(clientConn net.Conn) error {
 		"client_user":   clientUser,
 		"database":      database,
 		"status":        "authenticated",
+		"backend_addr":  p.backendAddr,
+		"backend_auth":  startup.AuthMethod,
+		"pooled":        p.reusedBackend,
+		"read_only":     p.readOnly,
 	})
 
+	// From here on all client writes go through a framing-aware writer so the
+	// expiry warning is never interleaved with a partial backend message
+	client := newPGClientConn(clientConn)
+	if p.expiry != nil {
+		stopWarning := WatchExpiryWarning(p.expiry, p.auditLogPath, p.username, p.config.Name, p.connectionID, "postgres_notice",
+			func(message string) error {
+				return client.WriteMessage(buildNoticeResponse(message))
+			})
+		defer stopWarning()
+	}
+
 	// Now do transparent bidirectional forwarding with query logging
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		defer func() { _ = backendConn.Close() }()
-		p.forwardWithLogging(clientConn, backendConn, true)
+		p.forwardWithLogging(client, backendConn, true)
+		if p.clientTerminated {
+			// Wake the backend reader without closing the session so it can return to the pool
+			_ = backendConn.SetReadDeadline(time.Now())
+			return
+		}
+		_ = backendConn.Close()
 	}()
 
 	go func() {
 		defer wg.Done()
-		defer func() { _ = clientConn.Close() }()
-		p.forwardWithLogging(backendConn, clientConn, false)
+		defer func() { _ = client.Close() }()
+		p.forwardWithLogging(backendConn, client, false)
 	}()
 
 	wg.Wait()
+
+	// A session is only reusable if the client left cleanly while the backend was idle
+	if p.clientTerminated && p.backendFraming.atBoundary() && p.backendFraming.lastType == 'Z' {
+		_ = backendConn.SetReadDeadline(time.Time{})
+		ok, err := releasePooledBackend(p.config, poolKey, pooled)
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "postgres_pool_reset_failed", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"error":         err.Error(),
+				"backend_addr":  p.backendAddr,
+			})
+		}
+		returnedToPool = ok
+	}
 	return nil
 }
 
+// openBackend dials the backend and authenticates with the backend credentials.
+// The primary fails over between the connection's hosts; the replica is dialed as is.
+func (p *PostgresAuthProxy) openBackend(clientConn net.Conn, backendAddr string, replica bool, backendTLS *tls.Config, backendDB string, params map[string]string) (*pgPooledConn, error) {
+	var backendConn net.Conn
+	var err error
+	selection := &BackendSelection{Host: backendAddr, Hosts: 1}
+	if replica {
+		backendConn, err = dialBackendAddr("postgres", backendAddr, backendTLS, 10*time.Second)
+	} else {
+		backendConn, selection, err = dialBackendHosts(p.config, backendTLS, 10*time.Second)
+	}
+	if err != nil {
+		if errors.Is(err, ErrBackendTLS) {
+			p.logBackendTLSError(err)
+		}
+		p.sendAuthError(clientConn, "Backend connection failed")
+		return nil, fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	LogBackendSelection(p.auditLogPath, p.username, p.config.Name, p.connectionID, selection)
+	backendAddr = selection.Host
+
+	// Send startup to backend with BACKEND username
+	if err := p.sendBackendStartup(backendConn, p.config.BackendUsername, backendDB, params); err != nil {
+		_ = backendConn.Close()
+		return nil, err
+	}
+
+	// Handle backend authentication
+	startup, err := p.handleBackendAuth(backendConn, p.config.BackendPassword)
+	if err != nil {
+		_ = backendConn.Close()
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_backend_auth_failed", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"backend_addr":  backendAddr,
+			"unsupported":   errors.Is(err, ErrBackendAuthUnsupported),
+			"error":         err.Error(),
+		})
+		p.sendAuthError(clientConn, "Backend authentication failed")
+		return nil, fmt.Errorf("backend auth failed: %w", err)
+	}
+
+	return &pgPooledConn{conn: backendConn, addr: backendAddr, startup: startup, createdAt: time.Now()}, nil
+}
+
 // readStartupMessage reads the postgres startup message
 func (p *PostgresAuthProxy) readStartupMessage(conn net.Conn) ([]byte, error) {
 	// First 4 bytes are length
@@ -273,7 +492,9 @@ func (p *PostgresAuthProxy) readPassword(conn net.Conn) (string, error) {
 }
 
 // sendBackendStartup sends startup message to backend with backend credentials
-func (p *PostgresAuthProxy) sendBackendStartup(conn net.Conn, username, database string) error {
+// Client startup parameters (application_name, client_encoding, options, ...) are passed
+// through so the backend reports session parameters matching what the client asked for.
+func (p *PostgresAuthProxy) sendBackendStartup(conn net.Conn, username, database string, clientParams map[string]string) error {
 	// Build startup message
 	var buf bytes.Buffer
 
@@ -291,6 +512,24 @@ func (p *PostgresAuthProxy) sendBackendStartup(conn net.Conn, username, database
 	buf.WriteString(database)
 	buf.WriteByte(0)
 
+	keys := make([]string, 0, len(clientParams))
+	for key := range clientParams {
+		switch key {
+		case "user", "database", "replication":
+			// Identity and replication mode are controlled by the proxy
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		buf.WriteString(key)
+		buf.WriteByte(0)
+		buf.WriteString(clientParams[key])
+		buf.WriteByte(0)
+	}
+
 	// End marker
 	buf.WriteByte(0)
 
@@ -304,28 +543,76 @@ func (p *PostgresAuthProxy) sendBackendStartup(conn net.Conn, username, database
 	return err
 }
 
+// ErrBackendAuthUnsupported is returned when the backend demands an authentication
+// method the proxy cannot perform with the configured backend credentials
+var ErrBackendAuthUnsupported = errors.New("unsupported backend authentication method")
+
+// scramSHA256 is the only SASL mechanism the proxy negotiates with the backend;
+// SCRAM-SHA-256-PLUS (channel binding) is not supported
+const scramSHA256 = "SCRAM-SHA-256"
+
+// pgAuthMethodName names a backend authentication request type
+func pgAuthMethodName(authType uint32) string {
+	switch authType {
+	case 0:
+		return "trust"
+	case 2:
+		return "kerberos-v5"
+	case 3:
+		return "password"
+	case 5:
+		return "md5"
+	case 6:
+		return "scm-credential"
+	case 7:
+		return "gss"
+	case 9:
+		return "sspi"
+	case 10:
+		return "sasl"
+	default:
+		return fmt.Sprintf("type %d", authType)
+	}
+}
+
+// backendStartup holds the session state the backend reports after authentication
+type backendStartup struct {
+	AuthMethod      string   // Authentication the backend negotiated: trust, password, md5 or scram-sha-256
+	ParameterStatus [][]byte // Raw ParameterStatus ('S') messages, in the order received
+	Notices         [][]byte // Raw NoticeResponse ('N') messages sent during startup
+	ProcessID       uint32   // From BackendKeyData
+	SecretKey       uint32   // From BackendKeyData
+	HasKeyData      bool
+	TxStatus        byte // From ReadyForQuery
+}
+
 // handleBackendAuth handles backend authentication flow
-func (p *PostgresAuthProxy) handleBackendAuth(conn net.Conn, password string) error {
+// Returns the session parameters and key data the backend sent before ReadyForQuery.
+func (p *PostgresAuthProxy) handleBackendAuth(conn net.Conn, password string) (*backendStartup, error) {
 	reader := bufio.NewReader(conn)
+	startup := &backendStartup{TxStatus: 'I'}
 
 	for {
 		// Read message type
 		msgType, err := reader.ReadByte()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Read length
 		lenBuf := make([]byte, 4)
 		if _, err := io.ReadFull(reader, lenBuf); err != nil {
-			return err
+			return nil, err
 		}
 		length := binary.BigEndian.Uint32(lenBuf)
+		if length < 4 {
+			return nil, fmt.Errorf("invalid backend message length: %d", length)
+		}
 
 		// Read message body
 		body := make([]byte, length-4)
 		if _, err := io.ReadFull(reader, body); err != nil {
-			return err
+			return nil, err
 		}
 
 		switch msgType {
@@ -335,39 +622,58 @@ func (p *PostgresAuthProxy) handleBackendAuth(conn net.Conn, password string) er
 				switch authType {
 				case 0:
 					// Auth OK, continue
+					if startup.AuthMethod == "" {
+						startup.AuthMethod = "trust"
+					}
 				case 3:
 					// Cleartext password requested
 					if err := p.sendBackendPassword(conn, password); err != nil {
-						return err
+						return nil, err
 					}
+					startup.AuthMethod = "password"
 				case 5:
 					// MD5 password requested
 					if len(body) < 8 {
-						return fmt.Errorf("invalid MD5 auth message")
+						return nil, fmt.Errorf("invalid MD5 auth message")
 					}
 					salt := body[4:8]
 					if err := p.sendBackendPasswordMD5(conn, password, p.config.BackendUsername, salt); err != nil {
-						return err
+						return nil, err
 					}
+					startup.AuthMethod = "md5"
 				case 10:
-					// SCRAM-SHA-256 requested
-					if err := p.handleSCRAMAuth(conn, reader, password, p.config.BackendUsername); err != nil {
-						return err
+					// SASL requested, with the mechanisms the backend offers
+					if err := p.handleSCRAMAuth(conn, reader, body[4:], password, p.config.BackendUsername); err != nil {
+						return nil, err
 					}
+					startup.AuthMethod = "scram-sha-256"
 				default:
-					return fmt.Errorf("unsupported auth type: %d", authType)
+					return nil, fmt.Errorf("%w: backend requested %s authentication; configure it for scram-sha-256, md5 or password",
+						ErrBackendAuthUnsupported, pgAuthMethodName(authType))
 				}
 			}
 
 		case 'Z': // ReadyForQuery
-			return nil // Backend ready
+			if len(body) >= 1 {
+				startup.TxStatus = body[0]
+			}
+			return startup, nil // Backend ready
 
 		case 'E': // ErrorResponse
-			return fmt.Errorf("backend auth error: %s", string(body))
+			return nil, fmt.Errorf("backend auth error: %s", pgErrorMessage(body))
 
-		case 'S', 'K': // ParameterStatus, BackendKeyData
-			// Ignore these
-			continue
+		case 'S': // ParameterStatus
+			startup.ParameterStatus = append(startup.ParameterStatus, buildPGMessage('S', body))
+
+		case 'K': // BackendKeyData
+			if len(body) >= 8 {
+				startup.ProcessID = binary.BigEndian.Uint32(body[0:4])
+				startup.SecretKey = binary.BigEndian.Uint32(body[4:8])
+				startup.HasKeyData = true
+			}
+
+		case 'N': // NoticeResponse
+			startup.Notices = append(startup.Notices, buildPGMessage('N', body))
 		}
 	}
 }
@@ -413,8 +719,26 @@ func (p *PostgresAuthProxy) sendBackendPasswordMD5(conn net.Conn, password, user
 	return err
 }
 
-// handleSCRAMAuth handles SCRAM-SHA-256 authentication
-func (p *PostgresAuthProxy) handleSCRAMAuth(conn net.Conn, reader *bufio.Reader, password, username string) error {
+// handleSCRAMAuth performs the SCRAM-SHA-256 exchange after AuthenticationSASL.
+// mechanisms is the null-terminated list the backend offered.
+func (p *PostgresAuthProxy) handleSCRAMAuth(conn net.Conn, reader *bufio.Reader, mechanisms []byte, password, username string) error {
+	offered := make([]string, 0)
+	for _, mechanism := range bytes.Split(mechanisms, []byte{0}) {
+		if len(mechanism) > 0 {
+			offered = append(offered, string(mechanism))
+		}
+	}
+	supported := false
+	for _, mechanism := range offered {
+		if mechanism == scramSHA256 {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("%w: backend offered SASL mechanisms %s, only %s is supported",
+			ErrBackendAuthUnsupported, strings.Join(offered, ", "), scramSHA256)
+	}
+
 	// Create SCRAM client
 	client, err := scram.SHA256.NewClient(username, password, "")
 	if err != nil {
@@ -429,17 +753,15 @@ func (p *PostgresAuthProxy) handleSCRAMAuth(conn net.Conn, reader *bufio.Reader,
 		return fmt.Errorf("SCRAM step 1 failed: %w", err)
 	}
 
-	// Send SASL Initial Response
+	// Send SASLInitialResponse
 	var buf bytes.Buffer
 	buf.WriteByte('p') // PasswordMessage type
 
-	// Calculate total message length
-	mechanism := "SCRAM-SHA-256"
 	// Length = 4 (length itself) + len(mechanism) + 1 (null) + 4 (clientFirst length) + len(clientFirst)
-	totalLen := 4 + len(mechanism) + 1 + 4 + len(clientFirst)
+	totalLen := 4 + len(scramSHA256) + 1 + 4 + len(clientFirst)
 
 	_ = binary.Write(&buf, binary.BigEndian, int32(totalLen))
-	buf.WriteString(mechanism)
+	buf.WriteString(scramSHA256)
 	buf.WriteByte(0) // Null terminator
 	_ = binary.Write(&buf, binary.BigEndian, int32(len(clientFirst)))
 	buf.WriteString(clientFirst)
@@ -448,46 +770,19 @@ func (p *PostgresAuthProxy) handleSCRAMAuth(conn net.Conn, reader *bufio.Reader,
 		return err
 	}
 
-	// Read server-first-message
-	msgType, err := reader.ReadByte()
+	// Read server-first-message (AuthenticationSASLContinue)
+	serverFirst, err := readSASLMessage(reader, 11)
 	if err != nil {
 		return err
 	}
 
-	if msgType == 'E' {
-		// Error response
-		return fmt.Errorf("SCRAM auth error from server")
-	}
-
-	if msgType != 'R' {
-		return fmt.Errorf("unexpected message type during SCRAM: %c", msgType)
-	}
-
-	lenBuf := make([]byte, 4)
-	if _, err := io.ReadFull(reader, lenBuf); err != nil {
-		return err
-	}
-	length := binary.BigEndian.Uint32(lenBuf)
-
-	body := make([]byte, length-4)
-	if _, err := io.ReadFull(reader, body); err != nil {
-		return err
-	}
-
-	// Check if this is AuthenticationSASLContinue (type 11)
-	if len(body) < 4 || binary.BigEndian.Uint32(body[:4]) != 11 {
-		return fmt.Errorf("expected SASL Continue")
-	}
-
-	serverFirst := string(body[4:])
-
 	// Process server-first and generate client-final
 	clientFinal, err := conv.Step(serverFirst)
 	if err != nil {
 		return fmt.Errorf("SCRAM step 2 failed: %w", err)
 	}
 
-	// Send client-final-message
+	// Send SASLResponse with the client-final-message
 	buf.Reset()
 	buf.WriteByte('p')
 	_ = binary.Write(&buf, binary.BigEndian, uint32(len(clientFinal)+4))
@@ -497,47 +792,79 @@ func (p *PostgresAuthProxy) handleSCRAMAuth(conn net.Conn, reader *bufio.Reader,
 		return err
 	}
 
-	// Read server-final-message
-	msgType, err = reader.ReadByte()
+	// Read server-final-message (AuthenticationSASLFinal)
+	serverFinal, err := readSASLMessage(reader, 12)
 	if err != nil {
 		return err
 	}
 
-	if msgType == 'E' {
-		return fmt.Errorf("SCRAM auth failed")
+	// Validate server signature, so a backend that does not know the password is rejected
+	if _, err := conv.Step(serverFinal); err != nil {
+		return fmt.Errorf("SCRAM validation failed: %w", err)
 	}
 
-	if msgType != 'R' {
-		return fmt.Errorf("unexpected message type during SCRAM final: %c", msgType)
+	return nil
+}
+
+// readSASLMessage reads an authentication message of the given SASL type
+// (11 = continue, 12 = final) and returns its data
+func readSASLMessage(reader *bufio.Reader, authType uint32) (string, error) {
+	msgType, err := reader.ReadByte()
+	if err != nil {
+		return "", err
 	}
 
+	lenBuf := make([]byte, 4)
 	if _, err := io.ReadFull(reader, lenBuf); err != nil {
-		return err
+		return "", err
 	}
-	length = binary.BigEndian.Uint32(lenBuf)
-
-	body = make([]byte, length-4)
+	length := binary.BigEndian.Uint32(lenBuf)
+	if length < 4 {
+		return "", fmt.Errorf("invalid backend message length: %d", length)
+	}
+	body := make([]byte, length-4)
 	if _, err := io.ReadFull(reader, body); err != nil {
-		return err
+		return "", err
 	}
 
-	// Check if this is AuthenticationSASLFinal (type 12)
-	if len(body) < 4 || binary.BigEndian.Uint32(body[:4]) != 12 {
-		return fmt.Errorf("expected SASL Final")
+	if msgType == 'E' {
+		return "", fmt.Errorf("SCRAM auth failed: %s", pgErrorMessage(body))
 	}
-
-	serverFinal := string(body[4:])
-
-	// Validate server signature
-	if _, err := conv.Step(serverFinal); err != nil {
-		return fmt.Errorf("SCRAM validation failed: %w", err)
+	if msgType != 'R' {
+		return "", fmt.Errorf("unexpected message type during SCRAM: %c", msgType)
+	}
+	if len(body) < 4 || binary.BigEndian.Uint32(body[:4]) != authType {
+		return "", fmt.Errorf("unexpected authentication message during SCRAM, want type %d", authType)
 	}
+	return string(body[4:]), nil
+}
 
-	return nil
+// pgErrorMessage returns the severity and message fields of an ErrorResponse body
+func pgErrorMessage(body []byte) string {
+	var severity, message string
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) < 2 {
+			continue
+		}
+		switch field[0] {
+		case 'S':
+			severity = string(field[1:])
+		case 'M':
+			message = string(field[1:])
+		}
+	}
+	if message == "" {
+		return "unknown error"
+	}
+	if severity != "" {
+		return severity + ": " + message
+	}
+	return message
 }
 
-// sendAuthSuccess sends authentication success to client
-func (p *PostgresAuthProxy) sendAuthSuccess(conn net.Conn) error {
+// sendAuthSuccess sends authentication success to client, followed by the
+// ParameterStatus, BackendKeyData and ReadyForQuery the backend reported
+func (p *PostgresAuthProxy) sendAuthSuccess(conn net.Conn, startup *backendStartup) error {
 	var buf bytes.Buffer
 
 	// AuthenticationOk
@@ -545,37 +872,39 @@ func (p *PostgresAuthProxy) sendAuthSuccess(conn net.Conn) error {
 	_ = binary.Write(&buf, binary.BigEndian, int32(8))
 	_ = binary.Write(&buf, binary.BigEndian, int32(0))
 
-	// ParameterStatus messages
-	params := map[string]string{
-		"server_version":  "14.0",
-		"server_encoding": "UTF8",
-		"client_encoding": "UTF8",
-		"DateStyle":       "ISO, MDY",
-		"TimeZone":        "UTC",
+	// ParameterStatus and startup notices, exactly as the backend sent them
+	for _, msg := range startup.ParameterStatus {
+		buf.Write(msg)
 	}
-
-	for key, value := range params {
-		buf.WriteByte('S')
-		paramData := key + "\x00" + value + "\x00"
-		_ = binary.Write(&buf, binary.BigEndian, int32(len(paramData)+4))
-		buf.WriteString(paramData)
+	for _, msg := range startup.Notices {
+		buf.Write(msg)
 	}
 
-	// BackendKeyData (dummy)
-	buf.WriteByte('K')
-	_ = binary.Write(&buf, binary.BigEndian, int32(12))
-	_ = binary.Write(&buf, binary.BigEndian, int32(12345)) // process ID
-	_ = binary.Write(&buf, binary.BigEndian, int32(67890)) // secret key
+	// BackendKeyData
+	if startup.HasKeyData {
+		buf.WriteByte('K')
+		_ = binary.Write(&buf, binary.BigEndian, int32(12))
+		_ = binary.Write(&buf, binary.BigEndian, startup.ProcessID)
+		_ = binary.Write(&buf, binary.BigEndian, startup.SecretKey)
+	}
 
 	// ReadyForQuery
 	buf.WriteByte('Z')
 	_ = binary.Write(&buf, binary.BigEndian, int32(5))
-	buf.WriteByte('I') // Idle status
+	buf.WriteByte(startup.TxStatus)
 
 	_, err := conn.Write(buf.Bytes())
 	return err
 }
 
+// logBackendTLSError audits a backend TLS misconfiguration or handshake failure
+func (p *PostgresAuthProxy) logBackendTLSError(err error) {
+	_ = audit.Log(p.auditLogPath, p.username, "backend_tls_error", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"error":         err.Error(),
+	})
+}
+
 // sendAuthError sends authentication error to client
 func (p *PostgresAuthProxy) sendAuthError(conn net.Conn, message string) {
 	// ErrorResponse message
@@ -604,7 +933,7 @@ func (p *PostgresAuthProxy) validateAPICredentials(username, password string) bo
 	}
 
 	for _, user := range p.apiConfig.Auth.Users {
-		if user.Username == username && user.Password == password {
+		if config.SameUsername(user.Username, username) && user.Password == password {
 			return true
 		}
 	}
@@ -620,17 +949,27 @@ func (p *PostgresAuthProxy) forwardWithLogging(src, dst net.Conn, logQueries boo
 		if n > 0 {
 			data := buf[:n]
 
-			if logQueries {
-				// Validate queries against whitelist before forwarding
-				if blocked, query := p.validateAndLogQuery(data); blocked {
-					// Send error to client and don't forward to backend
-					p.sendQueryBlockedError(src, query)
-					continue
+			if p.config.PoolMax > 0 {
+				if !logQueries {
+					p.backendFraming.advance(data)
+				} else if isPGTerminate(data) && p.clientFraming.atBoundary() {
+					// Keep the backend session open for the pool instead of forwarding Terminate
+					p.clientTerminated = true
+					return
+				} else {
+					p.clientFraming.advance(data)
 				}
 			}
 
-			if _, err := dst.Write(data); err != nil {
-				return
+			if logQueries {
+				// Validate (or, in preview mode, rewrite) each complete client message before forwarding
+				data = p.filterClientMessages(src, data)
+			}
+
+			if len(data) > 0 {
+				if _, err := dst.Write(data); err != nil {
+					return
+				}
 			}
 		}
 
@@ -640,139 +979,251 @@ func (p *PostgresAuthProxy) forwardWithLogging(src, dst net.Conn, logQueries boo
 	}
 }
 
-// validateAndLogQuery extracts queries, validates against whitelist, checks approval, and logs
-// Returns (blocked, query) where blocked=true if query should be blocked
-func (p *PostgresAuthProxy) validateAndLogQuery(data []byte) (bool, string) {
-	for i := 0; i < len(data); i++ {
-		// Check for both Simple Query ('Q') and Extended Query Parse ('P') messages
-		msgType := data[i]
-		if (msgType == 'Q' || msgType == 'P') && i+5 < len(data) {
-			length := int(binary.BigEndian.Uint32(data[i+1 : i+5]))
-
-			if i+1+length <= len(data) && length > 4 {
-				var query string
-
-				switch msgType {
-				case 'Q':
-					// Simple Query: query string starts at i+5
-					queryBytes := data[i+5 : i+1+length]
-					query = string(bytes.TrimRight(queryBytes, "\x00"))
-				case 'P':
-					// Parse message: format is statement_name (null-terminated) + query (null-terminated)
-					// Skip statement name to get to query
-					nameStart := i + 5
-					nameEnd := nameStart
-					for nameEnd < i+1+length && data[nameEnd] != 0 {
-						nameEnd++
-					}
-					if nameEnd < i+1+length {
-						nameEnd++ // Skip null terminator
-						queryBytes := data[nameEnd : i+1+length]
-						query = string(bytes.TrimRight(queryBytes, "\x00"))
-					}
-				}
+// validateAndLogQuery validates the query of a Simple Query ('Q') or Parse ('P') message against
+// the whitelist, table permissions and COPY policy, checks approval, and logs it
+// Returns (blocked, query, message, hint) where blocked=true if query should be blocked and message
+// and hint, if set, are the error to show the client instead of the generic whitelist one
+func (p *PostgresAuthProxy) validateAndLogQuery(msg []byte) (bool, string, string, string) {
+	msgType, query := pgMessageQuery(msg)
+	if query == "" {
+		return false, "", "", ""
+	}
 
-				if query != "" {
-					// Check whitelist first
-					allowed := p.isQueryAllowed(query)
-
-					// Log the query with whitelist result
-					_ = audit.Log(p.auditLogPath, p.username, "postgres_query", p.config.Name, map[string]interface{}{
-						"connection_id": p.connectionID,
-						"query":         query,
-						"database":      p.config.BackendDatabase,
-						"allowed":       allowed,
-						"whitelist":     len(p.whitelist) > 0,
-						"message_type":  string(msgType),
-					})
-
-					if !allowed {
-						// Log blocked query
-						_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, map[string]interface{}{
-							"connection_id": p.connectionID,
-							"query":         query,
-							"reason":        "whitelist_violation",
-						})
-						return true, query
-					}
+	// Check whitelist first, then the blacklist, which overrides it
+	allowed := p.isQueryAllowed(query)
+	blacklistPattern, blacklisted := "", false
+	if allowed {
+		blacklistPattern, blacklisted = p.isQueryBlacklisted(query)
+	}
 
-					// Check if approval is required for this query
-					if p.approvalMgr != nil {
-						normalizedQuery := strings.TrimSpace(query)
-						requiresApproval, timeout := p.approvalMgr.RequiresApproval(normalizedQuery, "", p.config.Tags)
-						if requiresApproval {
-							// Request approval
-							approvalReq := &approval.Request{
-								Username:     p.username,
-								ConnectionID: p.connectionID,
-								Method:       normalizedQuery, // For postgres, query is the "method"
-								Path:         "",              // No path for SQL queries
-								Metadata: map[string]string{
-									"connection_name": p.config.Name,
-									"connection_type": p.config.Type,
-									"database":        p.config.BackendDatabase,
-								},
-							}
-
-							// Log approval request
-							_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_requested", p.config.Name, map[string]interface{}{
-								"connection_id": p.connectionID,
-								"query":         query,
-								"database":      p.config.BackendDatabase,
-								"timeout":       timeout.String(),
-							})
-
-							// Wait for approval with timeout
-							ctx, cancel := context.WithTimeout(context.Background(), timeout)
-							defer cancel()
-
-							approvalResp, err := p.approvalMgr.RequestApproval(ctx, approvalReq, timeout)
-							if err != nil {
-								// Log approval error
-								_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_error", p.config.Name, map[string]interface{}{
-									"connection_id": p.connectionID,
-									"query":         query,
-									"error":         err.Error(),
-								})
-								return true, query
-							}
-
-							// Check approval decision
-							if approvalResp.Decision != approval.DecisionApproved {
-								// Log rejection/timeout
-								_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_rejected", p.config.Name, map[string]interface{}{
-									"connection_id": p.connectionID,
-									"query":         query,
-									"decision":      approvalResp.Decision,
-									"reason":        approvalResp.Reason,
-									"rejected_by":   approvalResp.ApprovedBy,
-								})
-								return true, query
-							}
-
-							// Log approval success
-							_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_granted", p.config.Name, map[string]interface{}{
-								"connection_id": p.connectionID,
-								"query":         query,
-								"database":      p.config.BackendDatabase,
-								"approved_by":   approvalResp.ApprovedBy,
-							})
-						}
-					}
-				}
+	// Then table permissions; queries the analyzer can't parse fall back to the whitelist alone
+	analysis, analysisErr := p.analyzer.Analyze(query)
+	var tableErr error
+	if allowed && !blacklisted && analysisErr == nil && len(p.tablePermissions) > 0 {
+		tableErr = security.CheckTablePermissions(analysis, p.tablePermissions)
+	}
+
+	// Read-only sessions reject writes whatever the policy allows
+	readOnlyErr := ""
+	if p.readOnly {
+		readOnlyErr = readOnlyViolation(analysis, analysisErr)
+	}
+
+	// COPY needs its direction allowed by policy, on top of the whitelist
+	copyErr := copyViolation(query, analysis, analysisErr, p.copyDirections)
+
+	// Without table_permissions a whitelist regex is all that vets the query, and a
+	// matching prefix says nothing about what follows it
+	statementReason, statementErr, statements := "", "", 0
+	whitelist := p.currentWhitelist()
+	if allowed && !blacklisted && !p.allowMultiStatement && len(p.tablePermissions) == 0 && len(whitelist) > 0 {
+		statementReason, statementErr, statements = statementViolation(query, analysis, analysisErr, whitelist)
+	}
+
+	// Log the query with whitelist result and the tables it touches
+	queryMetadata := map[string]interface{}{
+		"connection_id": p.connectionID,
+		"query":         query,
+		"database":      p.database,
+		"allowed":       allowed && !blacklisted && tableErr == nil && readOnlyErr == "" && copyErr == "" && statementErr == "",
+		"whitelist":     len(whitelist) > 0,
+		"message_type":  string(msgType),
+		"backend_addr":  p.backendAddr,
+	}
+	if analysisErr != nil {
+		queryMetadata["analysis_error"] = analysisErr.Error()
+	} else {
+		queryMetadata["operations"] = analysis.Operations
+		queryMetadata["tables"] = analysis.Tables
+	}
+	_ = audit.Log(p.auditLogPath, p.username, "postgres_query", p.config.Name, queryMetadata)
 
-				i += length
+	if readOnlyErr != "" {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        "read_only_violation",
+			"violation":     readOnlyErr,
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, "read_only_violation")
+		return true, query, fmt.Sprintf("Query blocked: connection is read-only (%s)", readOnlyErr),
+			"Only SELECT and EXPLAIN statements can run on this connection."
+	}
+	if copyErr != "" {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        "copy_not_allowed",
+			"violation":     copyErr,
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, "copy_not_allowed")
+		return true, query, fmt.Sprintf("Query blocked: %s", copyErr),
+			"Check your role's copy setting in the configuration."
+	}
+	if statementReason == "multi_statement" {
+		_ = audit.Log(p.auditLogPath, p.username, "multi_statement_blocked", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"statements":    statements,
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, "multi_statement")
+		return true, query, fmt.Sprintf("Query blocked: only one statement per query is allowed (got %d)", statements),
+			"Send each statement as its own query."
+	}
+	if statementReason != "" {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        statementReason,
+			"violation":     statementErr,
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, statementReason)
+		return true, query, fmt.Sprintf("Query blocked: %s", statementErr),
+			"Check your role's whitelist patterns in the configuration."
+	}
+	if !allowed {
+		// Log blocked query
+		metadata := map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        "whitelist_violation",
+			"backend_addr":  p.backendAddr,
+		}
+		if window := p.excludedWindow(query); window != "" {
+			metadata["reason"] = "outside_time_window"
+			metadata["time_window"] = window
+		}
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, metadata)
+		p.logDecision(query, audit.DecisionDeny, metadata["reason"].(string))
+		return true, query, "", ""
+	}
+	if blacklisted {
+		_ = audit.Log(p.auditLogPath, p.username, "blacklist_block", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"protocol":      "postgres",
+			"query":         query,
+			"pattern":       blacklistPattern,
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, "blacklist_block")
+		return true, query, fmt.Sprintf("Query blocked by blacklist policy: %s", truncateQuery(query)),
+			"Check your role's blacklist patterns in the configuration."
+	}
+	if tableErr != nil {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_blocked", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        "table_permission_violation",
+			"violation":     tableErr.Error(),
+			"backend_addr":  p.backendAddr,
+		})
+		p.logDecision(query, audit.DecisionDeny, "table_permission_violation")
+		return true, query, fmt.Sprintf("Query blocked by table permissions: %s", tableErr),
+			"Check your role's table_permissions in the configuration."
+	}
+	p.logDecision(query, audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, whitelist, query))
+
+	// Check if approval is required for this query
+	if p.approvalMgr != nil {
+		normalizedQuery := strings.TrimSpace(query)
+		requiresApproval, timeout := p.approvalMgr.RequiresApproval(normalizedQuery, "", p.config.Tags)
+		if requiresApproval {
+			// Request approval
+			approvalReq := &approval.Request{
+				Username:          p.username,
+				ConnectionID:      p.connectionID,
+				Method:            normalizedQuery, // For postgres, query is the "method"
+				Path:              "",              // No path for SQL queries
+				Tags:              p.config.Tags,
+				RequiredApprovals: p.approvalMgr.RequiredApprovals(normalizedQuery, "", p.config.Tags),
+				Escalation:        p.approvalMgr.EscalationFor(normalizedQuery, "", p.config.Tags),
+				ApprovalCache:     p.approvalMgr.ApprovalCacheFor(normalizedQuery, "", p.config.Tags),
+				Metadata: map[string]string{
+					"connection_name": p.config.Name,
+					"connection_type": p.config.Type,
+					"database":        p.database,
+				},
+			}
+			if p.reason != "" {
+				approvalReq.Metadata["reason"] = p.reason
+			}
+
+			// Log approval request
+			_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_requested", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"query":         query,
+				"database":      p.database,
+				"timeout":       timeout.String(),
+			})
+
+			// Wait for approval with timeout
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			approvalResp, err := p.approvalMgr.RequestApproval(ctx, approvalReq, timeout)
+			if err != nil {
+				// Log approval error
+				_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_error", p.config.Name, map[string]interface{}{
+					"connection_id": p.connectionID,
+					"query":         query,
+					"error":         err.Error(),
+				})
+				return true, query, "", ""
+			}
+
+			// Check approval decision
+			if approvalResp.Decision != approval.DecisionApproved {
+				// Log rejection/timeout
+				_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_rejected", p.config.Name, map[string]interface{}{
+					"connection_id": p.connectionID,
+					"query":         query,
+					"decision":      approvalResp.Decision,
+					"reason":        approvalResp.Reason,
+					"rejected_by":   approvalResp.ApprovedBy,
+					"channel":       approvalResp.Channel,
+					"ledger":        approvalResp.Ledger,
+				})
+				return true, query, "", ""
 			}
+
+			// Log approval success
+			_ = audit.Log(p.auditLogPath, p.username, "postgres_approval_granted", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"query":         query,
+				"database":      p.database,
+				"approved_by":   approvalResp.ApprovedBy,
+				"channel":       approvalResp.Channel,
+				"ledger":        approvalResp.Ledger,
+			})
 		}
 	}
-	return false, ""
+	return false, "", "", ""
+}
+
+// logDecision records a per-query whitelist decision in the decision log
+func (p *PostgresAuthProxy) logDecision(query, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "postgres_query",
+		Resource:     p.config.Name,
+		Request:      query,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
 }
 
 // isQueryAllowed checks if a query matches the whitelist patterns (case-insensitive)
 // For PL/SQL scripts, validates each subquery individually
 func (p *PostgresAuthProxy) isQueryAllowed(query string) bool {
 	// If no whitelist, allow everything (backward compatibility)
-	if len(p.whitelist) == 0 {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
 		return true
 	}
 
@@ -780,7 +1231,7 @@ func (p *PostgresAuthProxy) isQueryAllowed(query string) bool {
 	if p.isPLSQLScript(query) {
 		// Use subquery validation for PL/SQL scripts
 		validator := security.NewSubqueryValidator()
-		validationResult := validator.ValidateScript(query, p.whitelist)
+		validationResult := validator.ValidateScript(query, whitelist)
 
 		// Log subquery validation results
 		_ = audit.Log(p.auditLogPath, p.username, "plsql_subquery_validation", p.config.Name, map[string]interface{}{
@@ -795,9 +1246,9 @@ func (p *PostgresAuthProxy) isQueryAllowed(query string) bool {
 	}
 
 	// For single queries, use the original logic
-	for _, pattern := range p.whitelist {
-		// Compile with case-insensitive flag
-		re, err := regexp.Compile("(?i)" + pattern)
+	for _, pattern := range whitelist {
+		// Case-insensitive; AND groups from whitelist_mode "all" policies must match entirely
+		matched, err := authorization.MatchPattern(pattern, query)
 		if err != nil {
 			// Log bad pattern but don't block
 			_ = audit.Log(p.auditLogPath, p.username, "whitelist_error", p.config.Name, map[string]interface{}{
@@ -807,7 +1258,7 @@ func (p *PostgresAuthProxy) isQueryAllowed(query string) bool {
 			})
 			continue
 		}
-		if re.MatchString(query) {
+		if matched {
 			return true
 		}
 	}
@@ -815,6 +1266,24 @@ func (p *PostgresAuthProxy) isQueryAllowed(query string) bool {
 	return false
 }
 
+// isQueryBlacklisted returns the blacklist pattern a query matches
+// Scripts are also checked statement by statement, so anchored patterns
+// (e.g. "^DROP") can't be bypassed by prefixing an allowed statement.
+func (p *PostgresAuthProxy) isQueryBlacklisted(query string) (string, bool) {
+	if pattern, matched := blacklistMatch(p.whitelistSource, query); matched {
+		return pattern, true
+	}
+	if !p.isPLSQLScript(query) {
+		return "", false
+	}
+	for _, subquery := range security.NewPLSQLParser().ParseScript(query) {
+		if pattern, matched := blacklistMatch(p.whitelistSource, subquery.Query); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
 // isPLSQLScript checks if a query looks like a PL/SQL script with multiple statements
 func (p *PostgresAuthProxy) isPLSQLScript(query string) bool {
 	// Check for multiple semicolons (indicating multiple statements)
@@ -848,14 +1317,30 @@ func (p *PostgresAuthProxy) isPLSQLScript(query string) bool {
 	return statementCount > 1
 }
 
-// sendQueryBlockedError sends a proper PostgreSQL error response to the client for blocked queries
-func (p *PostgresAuthProxy) sendQueryBlockedError(conn net.Conn, query string) {
-	// Truncate query if too long
-	displayQuery := query
-	if len(displayQuery) > 100 {
-		displayQuery = displayQuery[:100] + "..."
+// truncateQuery shortens a query for display in error messages
+func truncateQuery(query string) string {
+	if len(query) > 100 {
+		return query[:100] + "..."
 	}
+	return query
+}
 
+// sendQueryError sends a PostgreSQL ErrorResponse followed by ReadyForQuery
+func (p *PostgresAuthProxy) sendQueryError(conn net.Conn, message, hint string) {
+	p.sendErrorResponse(conn, message, hint)
+
+	// Now send ReadyForQuery to indicate we're ready for next command
+	// This prevents client from hanging
+	var readyBuf bytes.Buffer
+	readyBuf.WriteByte('Z')                                 // ReadyForQuery message type
+	_ = binary.Write(&readyBuf, binary.BigEndian, int32(5)) // Length
+	readyBuf.WriteByte('I')                                 // Transaction status: Idle
+
+	_, _ = conn.Write(readyBuf.Bytes())
+}
+
+// sendErrorResponse sends a PostgreSQL ErrorResponse (insufficient_privilege) without ReadyForQuery
+func (p *PostgresAuthProxy) sendErrorResponse(conn net.Conn, message, hint string) {
 	// Build PostgreSQL ErrorResponse message
 	var buf bytes.Buffer
 
@@ -867,9 +1352,11 @@ func (p *PostgresAuthProxy) sendQueryBlockedError(conn net.Conn, query string) {
 	var fields bytes.Buffer
 	fields.WriteString("SERROR\x00") // Severity: ERROR
 	fields.WriteString("C42501\x00") // SQLSTATE: insufficient_privilege
-	fields.WriteString(fmt.Sprintf("MQuery blocked by whitelist policy: %s\x00", displayQuery))
-	fields.WriteString("HCheck your role's whitelist patterns in the configuration.\x00") // Hint
-	fields.WriteByte(0)                                                                   // Null terminator for fields
+	fields.WriteString(fmt.Sprintf("M%s\x00", message))
+	if hint != "" {
+		fields.WriteString(fmt.Sprintf("H%s\x00", hint)) // Hint
+	}
+	fields.WriteByte(0) // Null terminator for fields
 
 	// Write message length (includes the length field itself)
 	msgLength := uint32(4 + fields.Len())
@@ -880,13 +1367,4 @@ func (p *PostgresAuthProxy) sendQueryBlockedError(conn net.Conn, query string) {
 
 	// Send complete error message to client
 	_, _ = conn.Write(buf.Bytes())
-
-	// Now send ReadyForQuery to indicate we're ready for next command
-	// This prevents client from hanging
-	var readyBuf bytes.Buffer
-	readyBuf.WriteByte('Z')                                 // ReadyForQuery message type
-	_ = binary.Write(&readyBuf, binary.BigEndian, int32(5)) // Length
-	readyBuf.WriteByte('I')                                 // Transaction status: Idle
-
-	_, _ = conn.Write(readyBuf.Bytes())
 }
@@ -1,8 +1,11 @@
 package proxy
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/davidcohan/port-authorizing/internal/audit"
 	"github.com/davidcohan/port-authorizing/internal/config"
 )
 
@@ -199,3 +202,175 @@ func BenchmarkPostgresAuthProxy_IsQueryAllowed(b *testing.B) {
 		proxy.isQueryAllowed(query)
 	}
 }
+
+func TestPostgresAuthProxy_TablePermissions(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres"}
+	p := NewPostgresAuthProxy(connConfig, logPath, "alice", "conn-1", &config.Config{}, []string{"^SELECT.*", "^UPDATE.*", "^DO.*"})
+	p.SetTablePermissions([]config.TablePermission{
+		{Operations: []string{"SELECT"}, Tables: []string{"users", "orders"}},
+	})
+
+	tests := []struct {
+		name        string
+		query       string
+		wantBlocked bool
+		wantMessage string
+	}{
+		{"permitted tables", "SELECT * FROM users JOIN orders ON orders.user_id = users.id", false, ""},
+		{"table not permitted", "SELECT * FROM secrets", true, "Query blocked by table permissions: SELECT on secrets is not permitted"},
+		{"operation not permitted", "UPDATE users SET name = 'x'", true, "Query blocked by table permissions: UPDATE on users is not permitted"},
+		{"whitelist still applies", "DELETE FROM users", true, ""},
+		{"unparseable falls back to whitelist", "DO $$ BEGIN DELETE FROM secrets; END $$", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(tt.query), 0)))
+			if blocked != tt.wantBlocked {
+				t.Errorf("validateAndLogQuery(%q) blocked = %v, want %v", tt.query, blocked, tt.wantBlocked)
+			}
+			if message != tt.wantMessage {
+				t.Errorf("validateAndLogQuery(%q) message = %q, want %q", tt.query, message, tt.wantMessage)
+			}
+		})
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "postgres_query"})
+	if len(entries) == 0 || entries[0].Metadata["tables"] == nil {
+		t.Fatalf("postgres_query audit should record the tables a query touches: %+v", entries)
+	}
+	blocked, _ := audit.Query(logPath, audit.Filter{Action: "postgres_query_blocked"})
+	violations := 0
+	for _, entry := range blocked {
+		if entry.Metadata["reason"] == "table_permission_violation" {
+			violations++
+		}
+	}
+	if violations != 2 {
+		t.Errorf("table_permission_violation audits = %d, want 2", violations)
+	}
+}
+
+func TestPostgresAuthProxy_ReadOnly(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres", ReadOnly: true}
+	p := NewPostgresAuthProxy(connConfig, logPath, "alice", "conn-1", &config.Config{}, []string{".*"})
+	p.SetReadOnly(true)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantBlocked bool
+	}{
+		{"select", "SELECT * FROM users", false},
+		{"explain", "EXPLAIN SELECT * FROM users", false},
+		{"cte select", "WITH t AS (SELECT id FROM users) SELECT * FROM t", false},
+		{"insert", "INSERT INTO users (name) VALUES ('x')", true},
+		{"explain analyze write", "EXPLAIN ANALYZE DELETE FROM users", true},
+		{"writable cte", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", true},
+		{"stacked write", "SELECT 1; DROP TABLE users", true},
+		{"set", "SET default_transaction_read_only = off", true},
+		{"unparseable", "DO $$ BEGIN DELETE FROM users; END $$", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(tt.query), 0)))
+			if blocked != tt.wantBlocked {
+				t.Errorf("validateAndLogQuery(%q) blocked = %v, want %v (message %q)", tt.query, blocked, tt.wantBlocked, message)
+			}
+			if blocked && !strings.HasPrefix(message, "Query blocked: connection is read-only") {
+				t.Errorf("validateAndLogQuery(%q) message = %q", tt.query, message)
+			}
+		})
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "postgres_query_blocked"})
+	for _, entry := range entries {
+		if entry.Metadata["reason"] != "read_only_violation" {
+			t.Errorf("blocked reason = %v, want read_only_violation", entry.Metadata["reason"])
+		}
+	}
+}
+
+func TestPostgresAuthProxy_BackendTarget(t *testing.T) {
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres", Host: "primary", Port: 5432, ReplicaHost: "replica"}
+	p := NewPostgresAuthProxy(connConfig, "", "alice", "conn-1", &config.Config{}, nil)
+
+	if host, port, replica := p.backendTarget(); host != "primary" || port != 5432 || replica {
+		t.Errorf("backendTarget() = %s:%d replica=%v, want the primary for read-write sessions", host, port, replica)
+	}
+
+	p.SetReadOnly(true)
+	if host, port, replica := p.backendTarget(); host != "replica" || port != 5432 || !replica {
+		t.Errorf("backendTarget() = %s:%d replica=%v, want replica:5432", host, port, replica)
+	}
+
+	connConfig.ReplicaPort = 6432
+	if _, port, _ := p.backendTarget(); port != 6432 {
+		t.Errorf("backendTarget() port = %d, want replica_port 6432", port)
+	}
+
+	params := readOnlyStartupParams(map[string]string{"application_name": "psql"})
+	if params["default_transaction_read_only"] != "on" || params["application_name"] != "psql" {
+		t.Errorf("readOnlyStartupParams() = %v", params)
+	}
+}
+
+func TestPostgresAuthProxy_BlockMultiStatement(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres"}
+	p := NewPostgresAuthProxy(connConfig, logPath, "alice", "conn-1", &config.Config{}, []string{"^SELECT.*", "^WITH.*", "^EXPLAIN.*"})
+
+	tests := []struct {
+		name        string
+		query       string
+		wantBlocked bool
+		wantMessage string
+	}{
+		{"select", "SELECT * FROM users", false, ""},
+		{"semicolon in literal", "SELECT * FROM users WHERE name = 'a;b'", false, ""},
+		{"trailing comment", "SELECT 1 -- ; DROP TABLE users", false, ""},
+		{"stacked statement", "SELECT 1; DROP TABLE users", true, "Query blocked: only one statement per query is allowed (got 2)"},
+		{"stacked after comment", "SELECT 1 /* harmless */; TRUNCATE users", true, "Query blocked: only one statement per query is allowed (got 2)"},
+		{"writable cte", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", true, "Query blocked: DELETE is not allowed by the matching whitelist patterns"},
+		{"explain analyze write", "EXPLAIN ANALYZE UPDATE users SET name = 'x'", true, "Query blocked: UPDATE is not allowed by the matching whitelist patterns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(tt.query), 0)))
+			if blocked != tt.wantBlocked {
+				t.Errorf("validateAndLogQuery(%q) blocked = %v, want %v (message %q)", tt.query, blocked, tt.wantBlocked, message)
+			}
+			if message != tt.wantMessage {
+				t.Errorf("validateAndLogQuery(%q) message = %q, want %q", tt.query, message, tt.wantMessage)
+			}
+		})
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "multi_statement_blocked"})
+	if len(entries) != 2 || entries[0].Metadata["statements"] != float64(2) {
+		t.Errorf("multi_statement_blocked audits = %+v, want 2 with statements = 2", entries)
+	}
+
+	// Turned off, the whitelist regex alone decides
+	p.SetBlockMultiStatement(false)
+	if blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte("SELECT 1; DROP TABLE users"), 0))); blocked {
+		t.Errorf("stacked statement blocked with block_multi_statement off: %q", message)
+	}
+
+	// Table permissions vet each statement, so stacking is left to them
+	p.SetBlockMultiStatement(true)
+	p.SetTablePermissions([]config.TablePermission{{Operations: []string{"SELECT"}, Tables: []string{"*"}}})
+	if blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte("SELECT 1 FROM users; SELECT 2 FROM orders"), 0))); blocked {
+		t.Errorf("stacked selects blocked with table permissions: %q", message)
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// pgCancelRequestCode is the protocol code of a CancelRequest startup packet
+const pgCancelRequestCode = 80877102
+
+// cancelKey is the (process ID, secret key) pair from BackendKeyData
+type cancelKey struct {
+	ProcessID uint32
+	SecretKey uint32
+}
+
+// cancelTarget is the backend session a proxy-issued cancel key refers to
+type cancelTarget struct {
+	BackendAddr  string
+	BackendTLS   *tls.Config // nil for plain TCP backends
+	BackendKey   cancelKey
+	Username     string
+	ConnectionID string
+}
+
+var (
+	cancelMu   sync.Mutex
+	cancelKeys = make(map[cancelKey]*cancelTarget)
+)
+
+// registerCancelKey issues a proxy cancel key for a backend session
+// Clients only ever see the proxy key; the backend key stays on the server.
+func registerCancelKey(target *cancelTarget) (cancelKey, error) {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+
+	for {
+		var buf [8]byte
+		if _, err := rand.Read(buf[:]); err != nil {
+			return cancelKey{}, fmt.Errorf("failed to generate cancel key: %w", err)
+		}
+		key := cancelKey{
+			ProcessID: binary.BigEndian.Uint32(buf[0:4]) & 0x7fffffff, // Keep the PID positive for clients using int32
+			SecretKey: binary.BigEndian.Uint32(buf[4:8]),
+		}
+		if key.ProcessID == 0 {
+			continue
+		}
+		if _, exists := cancelKeys[key]; exists {
+			continue
+		}
+		cancelKeys[key] = target
+		return key, nil
+	}
+}
+
+// unregisterCancelKey removes a cancel key when its session ends
+func unregisterCancelKey(key cancelKey) {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	delete(cancelKeys, key)
+}
+
+// lookupCancelKey returns the backend session for a proxy cancel key
+func lookupCancelKey(key cancelKey) (*cancelTarget, bool) {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	target, ok := cancelKeys[key]
+	return target, ok
+}
+
+// isCancelRequest reports whether a startup packet is a CancelRequest
+func isCancelRequest(msg []byte) bool {
+	return len(msg) == 16 && binary.BigEndian.Uint32(msg[4:8]) == pgCancelRequestCode
+}
+
+// buildCancelRequest builds a CancelRequest packet for a key
+func buildCancelRequest(key cancelKey) []byte {
+	msg := make([]byte, 16)
+	binary.BigEndian.PutUint32(msg[0:4], 16)
+	binary.BigEndian.PutUint32(msg[4:8], pgCancelRequestCode)
+	binary.BigEndian.PutUint32(msg[8:12], key.ProcessID)
+	binary.BigEndian.PutUint32(msg[12:16], key.SecretKey)
+	return msg
+}
+
+// handleCancelRequest maps a client CancelRequest to its backend session and forwards it
+// Per the protocol no response is sent to the client; the connection is simply closed.
+func (p *PostgresAuthProxy) handleCancelRequest(msg []byte) error {
+	key := cancelKey{
+		ProcessID: binary.BigEndian.Uint32(msg[8:12]),
+		SecretKey: binary.BigEndian.Uint32(msg[12:16]),
+	}
+
+	target, ok := lookupCancelKey(key)
+	if !ok {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_cancel_rejected", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"reason":        "unknown_cancel_key",
+		})
+		return fmt.Errorf("cancel request for unknown session")
+	}
+
+	// Only the user who owns the session may cancel its queries
+	if target.Username != p.username {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_cancel_rejected", p.config.Name, map[string]interface{}{
+			"connection_id":        p.connectionID,
+			"target_connection_id": target.ConnectionID,
+			"reason":               "session_owned_by_another_user",
+		})
+		return fmt.Errorf("cancel request for another user's session")
+	}
+
+	backendConn, err := dialBackendAddr("postgres", target.BackendAddr, target.BackendTLS, 10*time.Second)
+	if err != nil {
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_cancel_failed", p.config.Name, map[string]interface{}{
+			"connection_id":        p.connectionID,
+			"target_connection_id": target.ConnectionID,
+			"error":                err.Error(),
+		})
+		return fmt.Errorf("failed to connect to backend for cancel: %w", err)
+	}
+	defer func() { _ = backendConn.Close() }()
+
+	if _, err := backendConn.Write(buildCancelRequest(target.BackendKey)); err != nil {
+		return fmt.Errorf("failed to forward cancel request: %w", err)
+	}
+
+	_ = audit.Log(p.auditLogPath, p.username, "postgres_cancel", p.config.Name, map[string]interface{}{
+		"connection_id":        p.connectionID,
+		"target_connection_id": target.ConnectionID,
+		"backend_pid":          target.BackendKey.ProcessID,
+	})
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestPostgresAuthProxy_CancelRequest(t *testing.T) {
+	backend := newFakePGBackend(t)
+	proxyAddr := startTestPostgresProxy(t, backend.port(), "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := connectTestDriver(ctx, t, proxyAddr)
+	<-backend.startup
+
+	// The driver sends the proxy-issued key on a new connection to the proxy
+	if err := conn.CancelRequest(ctx); err != nil {
+		t.Fatalf("CancelRequest() error = %v", err)
+	}
+
+	select {
+	case req := <-backend.cancels:
+		if req.ProcessID != backend.processID || req.SecretKey != backend.secretKey {
+			t.Errorf("backend received cancel for %d/%d, want %d/%d", req.ProcessID, req.SecretKey, backend.processID, backend.secretKey)
+		}
+	case <-ctx.Done():
+		t.Fatal("backend did not receive the cancel request")
+	}
+}
+
+func TestPostgresAuthProxy_HandleCancelRequest_Rejected(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	key, err := registerCancelKey(&cancelTarget{
+		BackendAddr:  "127.0.0.1:1",
+		BackendKey:   cancelKey{ProcessID: 1, SecretKey: 2},
+		Username:     "alice",
+		ConnectionID: "conn-alice",
+	})
+	if err != nil {
+		t.Fatalf("registerCancelKey() error = %v", err)
+	}
+	defer unregisterCancelKey(key)
+
+	tests := []struct {
+		name       string
+		username   string
+		key        cancelKey
+		wantReason string
+	}{
+		{"unknown key", "alice", cancelKey{ProcessID: key.ProcessID, SecretKey: key.SecretKey + 1}, "unknown_cancel_key"},
+		{"another user's session", "bob", key, "session_owned_by_another_user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPostgresAuthProxy(&config.ConnectionConfig{Name: "pg"}, logPath, tt.username, "conn-1", nil, nil)
+			if err := p.handleCancelRequest(buildCancelRequest(tt.key)); err == nil {
+				t.Fatal("handleCancelRequest() error = nil, want rejection")
+			}
+
+			entries, _ := audit.Query(logPath, audit.Filter{Action: "postgres_cancel_rejected", Username: tt.username})
+			if len(entries) == 0 || entries[len(entries)-1].Metadata["reason"] != tt.wantReason {
+				t.Errorf("postgres_cancel_rejected entries = %+v, want reason %q", entries, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestIsCancelRequest(t *testing.T) {
+	if !isCancelRequest(buildCancelRequest(cancelKey{ProcessID: 1, SecretKey: 2})) {
+		t.Error("isCancelRequest() = false for a CancelRequest")
+	}
+	sslRequest := []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+	if isCancelRequest(sslRequest) {
+		t.Error("isCancelRequest() = true for an SSLRequest")
+	}
+}
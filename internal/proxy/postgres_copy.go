@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/security"
+)
+
+// SetCopyDirections sets the COPY directions ("FROM", "TO") the user's policies allow.
+// COPY statements in any other direction are blocked even when whitelisted.
+func (p *PostgresAuthProxy) SetCopyDirections(directions []string) {
+	p.copyDirections = directions
+}
+
+// copyViolation returns why a COPY statement may not run, or "" if query is not a COPY
+// or its direction is allowed. A COPY the analyzer cannot parse is rejected.
+func copyViolation(query string, analysis *security.SQLAnalysis, analysisErr error, allowed []string) string {
+	if analysisErr != nil {
+		if isCopyStatement(query) {
+			return fmt.Sprintf("COPY statement could not be verified: %v", analysisErr)
+		}
+		return ""
+	}
+	for _, direction := range analysis.Copy {
+		permitted := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, direction) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return fmt.Sprintf("COPY %s is not allowed by policy", direction)
+		}
+	}
+	return ""
+}
+
+// isCopyStatement reports whether query starts with COPY
+func isCopyStatement(query string) bool {
+	fields := strings.Fields(strings.TrimLeft(query, " \t\r\n("))
+	return len(fields) > 0 && strings.EqualFold(fields[0], "copy")
+}
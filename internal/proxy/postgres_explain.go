@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// SetExplainOnly enables EXPLAIN preview mode for this proxy.
+// In preview mode every SELECT is wrapped in EXPLAIN server-side so the client
+// receives the query plan and the original query is never executed.
+func (p *PostgresAuthProxy) SetExplainOnly(enabled bool) {
+	p.explainOnly = enabled
+}
+
+// rewriteForExplain rewrites Simple Query ('Q') and Parse ('P') messages into
+// EXPLAIN statements. Returns the rewritten data, or blocked=true with the
+// offending query if a message cannot be previewed.
+func (p *PostgresAuthProxy) rewriteForExplain(data []byte) ([]byte, bool, string) {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(data) {
+		// Incomplete message header - forward as-is
+		if i+5 > len(data) {
+			out.Write(data[i:])
+			break
+		}
+
+		msgType := data[i]
+		length := int(binary.BigEndian.Uint32(data[i+1 : i+5]))
+		end := i + 1 + length
+		if length < 4 || end > len(data) {
+			out.Write(data[i:])
+			break
+		}
+
+		body := data[i+5 : end]
+
+		switch msgType {
+		case 'Q':
+			query := string(bytes.TrimRight(body, "\x00"))
+			explained, ok := p.explainQuery(query, string(msgType))
+			if !ok {
+				return nil, true, query
+			}
+			out.Write(buildPGMessage('Q', append([]byte(explained), 0)))
+
+		case 'P':
+			// Parse: statement name\0 query\0 int16 param count + param OIDs
+			nameEnd := bytes.IndexByte(body, 0)
+			if nameEnd == -1 {
+				return nil, true, ""
+			}
+			rest := body[nameEnd+1:]
+			queryEnd := bytes.IndexByte(rest, 0)
+			if queryEnd == -1 {
+				return nil, true, ""
+			}
+			query := string(rest[:queryEnd])
+			explained, ok := p.explainQuery(query, string(msgType))
+			if !ok {
+				return nil, true, query
+			}
+
+			var parseBody bytes.Buffer
+			parseBody.Write(body[:nameEnd+1])
+			parseBody.WriteString(explained)
+			parseBody.WriteByte(0)
+			parseBody.Write(rest[queryEnd+1:])
+			out.Write(buildPGMessage('P', parseBody.Bytes()))
+
+		default:
+			out.Write(data[i:end])
+		}
+
+		i = end
+	}
+
+	return out.Bytes(), false, ""
+}
+
+// explainQuery validates that a query can be previewed and returns the EXPLAIN statement
+func (p *PostgresAuthProxy) explainQuery(query, msgType string) (string, bool) {
+	normalized := strings.TrimSpace(query)
+	normalized = strings.TrimSpace(strings.TrimSuffix(normalized, ";"))
+
+	reason := ""
+	switch {
+	case !isPreviewableQuery(normalized):
+		reason = "only single SELECT statements can be previewed"
+	case !p.isQueryAllowed(normalized):
+		reason = "whitelist_violation"
+	}
+
+	if reason != "" {
+		metadata := map[string]interface{}{
+			"connection_id": p.connectionID,
+			"query":         query,
+			"reason":        reason,
+			"message_type":  msgType,
+		}
+		if reason == "whitelist_violation" {
+			if window := p.excludedWindow(normalized); window != "" {
+				metadata["reason"] = "outside_time_window"
+				metadata["time_window"] = window
+			}
+		}
+		_ = audit.Log(p.auditLogPath, p.username, "postgres_query_preview_blocked", p.config.Name, metadata)
+		return "", false
+	}
+
+	_ = audit.Log(p.auditLogPath, p.username, "postgres_query_preview", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"query":         query,
+		"database":      p.database,
+		"message_type":  msgType,
+	})
+
+	return "EXPLAIN " + normalized, true
+}
+
+// isPreviewableQuery reports whether a query is a single read-only SELECT (or WITH ... SELECT)
+func isPreviewableQuery(query string) bool {
+	if query == "" || strings.Contains(query, ";") {
+		return false
+	}
+
+	upper := strings.ToUpper(query)
+	if !strings.HasPrefix(upper, "SELECT") && !strings.HasPrefix(upper, "WITH") {
+		return false
+	}
+
+	// EXPLAIN of a data-modifying CTE or SELECT INTO would still be safe (EXPLAIN
+	// without ANALYZE never executes), but keep preview mode strictly read-only.
+	for _, keyword := range []string{"INSERT ", "UPDATE ", "DELETE ", "INTO "} {
+		if strings.Contains(upper, keyword) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildPGMessage builds a postgres protocol message with type byte and length prefix
+func buildPGMessage(msgType byte, body []byte) []byte {
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = msgType
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(body)+4))
+	return append(msg, body...)
+}
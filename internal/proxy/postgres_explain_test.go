@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func newExplainTestProxy(whitelist []string) *PostgresAuthProxy {
+	connConfig := &config.ConnectionConfig{
+		Name:            "test-postgres",
+		Type:            "postgres",
+		BackendDatabase: "testdb",
+	}
+	globalConfig := &config.Config{}
+
+	proxy := NewPostgresAuthProxy(connConfig, "", "user1", "conn-123", globalConfig, whitelist)
+	proxy.SetExplainOnly(true)
+	return proxy
+}
+
+func TestIsPreviewableQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM users", true},
+		{"select id from users where id = 1", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"", false},
+		{"DELETE FROM users", false},
+		{"UPDATE users SET name = 'x'", false},
+		{"SELECT 1; DROP TABLE users", false},
+		{"SELECT * INTO backup FROM users", false},
+		{"WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := isPreviewableQuery(tt.query); got != tt.want {
+				t.Errorf("isPreviewableQuery(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresAuthProxy_RewriteForExplain_SimpleQuery(t *testing.T) {
+	proxy := newExplainTestProxy([]string{"^SELECT.*"})
+
+	msg := buildPGMessage('Q', append([]byte("SELECT * FROM users;"), 0))
+	out, blocked, _ := proxy.rewriteForExplain(msg)
+	if blocked {
+		t.Fatal("rewriteForExplain() blocked a whitelisted SELECT")
+	}
+
+	want := buildPGMessage('Q', append([]byte("EXPLAIN SELECT * FROM users"), 0))
+	if !bytes.Equal(out, want) {
+		t.Errorf("rewriteForExplain() = %q, want %q", out, want)
+	}
+}
+
+func TestPostgresAuthProxy_RewriteForExplain_Parse(t *testing.T) {
+	proxy := newExplainTestProxy(nil)
+
+	// Parse + Sync, with one int4 parameter
+	var body bytes.Buffer
+	body.WriteString("stmt1\x00SELECT * FROM users WHERE id = $1\x00")
+	body.Write([]byte{0, 1, 0, 0, 0, 23})
+	msg := append(buildPGMessage('P', body.Bytes()), buildPGMessage('S', nil)...)
+
+	out, blocked, _ := proxy.rewriteForExplain(msg)
+	if blocked {
+		t.Fatal("rewriteForExplain() blocked a SELECT parse message")
+	}
+
+	var wantBody bytes.Buffer
+	wantBody.WriteString("stmt1\x00EXPLAIN SELECT * FROM users WHERE id = $1\x00")
+	wantBody.Write([]byte{0, 1, 0, 0, 0, 23})
+	want := append(buildPGMessage('P', wantBody.Bytes()), buildPGMessage('S', nil)...)
+
+	if !bytes.Equal(out, want) {
+		t.Errorf("rewriteForExplain() = %q, want %q", out, want)
+	}
+}
+
+func TestPostgresAuthProxy_RewriteForExplain_Blocked(t *testing.T) {
+	tests := []struct {
+		name      string
+		whitelist []string
+		query     string
+	}{
+		{"write statement", nil, "DELETE FROM users"},
+		{"not whitelisted", []string{"^SELECT \\* FROM orders.*"}, "SELECT * FROM users"},
+		{"multiple statements", nil, "SELECT 1; SELECT 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := newExplainTestProxy(tt.whitelist)
+
+			msg := buildPGMessage('Q', append([]byte(tt.query), 0))
+			_, blocked, query := proxy.rewriteForExplain(msg)
+			if !blocked {
+				t.Fatalf("rewriteForExplain() did not block %q", tt.query)
+			}
+			if query != tt.query {
+				t.Errorf("blocked query = %q, want %q", query, tt.query)
+			}
+		})
+	}
+}
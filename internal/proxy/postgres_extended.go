@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// pgMessageReader reassembles complete protocol messages from a client stream
+// (after startup), so a message split across reads is validated as a whole
+// rather than forwarded unchecked
+type pgMessageReader struct {
+	pending []byte // Start of a message whose remaining bytes have not arrived yet
+	limit   int64  // Largest message buffered (0 = unlimited)
+	discard int64  // Bytes of an oversized message still to drop
+}
+
+// push adds the next bytes of the stream and returns the messages they complete.
+// A message over the limit is never buffered: it is returned as just its 5-byte
+// header (see pgOversizedMessage) and its remaining bytes are dropped as they arrive.
+func (r *pgMessageReader) push(data []byte) [][]byte {
+	if r.discard > 0 {
+		skip := min(r.discard, int64(len(data)))
+		r.discard -= skip
+		data = data[skip:]
+	}
+	buf := append(r.pending, data...)
+
+	var messages [][]byte
+	for len(buf) >= 5 {
+		length := int(binary.BigEndian.Uint32(buf[1:5]))
+		if length < 4 {
+			// Not a valid message: hand the rest on as-is and let the backend reject it
+			messages = append(messages, buf)
+			buf = nil
+			break
+		}
+		if size := int64(1 + length); r.limit > 0 && size > r.limit {
+			messages = append(messages, append([]byte(nil), buf[:5]...))
+			if int64(len(buf)) < size {
+				r.discard = size - int64(len(buf))
+				buf = nil
+			} else {
+				buf = buf[size:]
+			}
+			continue
+		}
+		if len(buf) < 1+length {
+			break
+		}
+		messages = append(messages, buf[:1+length])
+		buf = buf[1+length:]
+	}
+
+	// Keep the incomplete tail in its own buffer so later appends never touch returned messages
+	r.pending = append([]byte(nil), buf...)
+	return messages
+}
+
+// pgOversizedMessage returns the declared size of a message push cut down to its
+// header for being over the limit
+func pgOversizedMessage(msg []byte) (int64, bool) {
+	if len(msg) != 5 {
+		return 0, false
+	}
+	size := 1 + int64(binary.BigEndian.Uint32(msg[1:5]))
+	return size, size > 5
+}
+
+// pgMessageQuery returns the type of a Simple Query ('Q') or Parse ('P') message and its SQL;
+// the query is empty for other messages
+func pgMessageQuery(msg []byte) (byte, string) {
+	if len(msg) < 5 {
+		return 0, ""
+	}
+	body := msg[5:]
+
+	switch msg[0] {
+	case 'Q':
+		return 'Q', string(bytes.TrimRight(body, "\x00"))
+	case 'P':
+		// Parse: statement name\0 query\0 int16 param count + param OIDs
+		_, rest := pgCString(body)
+		query, _ := pgCString(rest)
+		return 'P', query
+	}
+	return msg[0], ""
+}
+
+// pgCString splits a null-terminated string off the front of b
+func pgCString(b []byte) (string, []byte) {
+	end := bytes.IndexByte(b, 0)
+	if end == -1 {
+		return string(b), nil
+	}
+	return string(b[:end]), b[end+1:]
+}
+
+// filterClientMessages validates the complete client messages in data and returns the bytes to
+// forward to the backend. Blocked queries are answered with an error: a Simple Query gets
+// ErrorResponse + ReadyForQuery; a Parse gets ErrorResponse and, like the backend after an
+// error, the proxy drops the rest of the batch up to Sync, which it forwards so the backend
+// sends the ReadyForQuery.
+func (p *PostgresAuthProxy) filterClientMessages(client net.Conn, data []byte) []byte {
+	var out []byte
+	for _, msg := range p.clientMessages.push(data) {
+		msgType := msg[0]
+		if size, oversized := pgOversizedMessage(msg); oversized {
+			out = append(out, p.rejectOversizedMessage(client, msgType, size)...)
+			continue
+		}
+		if p.skipUntilSync {
+			if msgType != 'S' {
+				continue
+			}
+			p.skipUntilSync = false
+		}
+
+		switch msgType {
+		case 'Q', 'P':
+			if p.explainOnly {
+				// Preview mode: rewrite queries to EXPLAIN, never execute them
+				rewritten, blocked, query := p.rewriteForExplain(msg)
+				if blocked {
+					p.rejectClientMessage(client, msgType, fmt.Sprintf("Query cannot be previewed: %s", truncateQuery(query)),
+						"Preview mode only allows single whitelisted SELECT statements.")
+					continue
+				}
+				msg = rewritten
+			} else if blocked, query, message, hint := p.validateAndLogQuery(msg); blocked {
+				if message == "" {
+					message = fmt.Sprintf("Query blocked by whitelist policy: %s", truncateQuery(query))
+					hint = "Check your role's whitelist patterns in the configuration."
+				}
+				p.rejectClientMessage(client, msgType, message, hint)
+				continue
+			}
+			if msgType == 'P' {
+				p.trackParse(msg)
+			}
+		case 'B':
+			p.trackBind(msg)
+		case 'E':
+			p.logExecute(msg)
+		case 'C':
+			p.trackClose(msg)
+		}
+		out = append(out, msg...)
+	}
+	return out
+}
+
+// rejectClientMessage answers a blocked Simple Query or Parse message
+func (p *PostgresAuthProxy) rejectClientMessage(client net.Conn, msgType byte, message, hint string) {
+	if msgType == 'Q' {
+		p.sendQueryError(client, message, hint)
+		return
+	}
+	p.sendErrorResponse(client, message, hint)
+	p.skipUntilSync = true
+}
+
+// SetMaxRequestBytes sets the largest client message (query, Parse, Bind, CopyData, ...)
+// the proxy buffers; larger ones are rejected without being read into memory (0 = unlimited)
+func (p *PostgresAuthProxy) SetMaxRequestBytes(limit int64) {
+	p.clientMessages.limit = limit
+}
+
+// rejectOversizedMessage audits a client message over max_request_bytes, answers it like a
+// blocked query and returns what to forward instead: a CopyFail for CopyData, so the backend
+// aborts the COPY and reports the error itself
+func (p *PostgresAuthProxy) rejectOversizedMessage(client net.Conn, msgType byte, size int64) []byte {
+	tooLarge := &RequestTooLargeError{Size: size, Limit: p.clientMessages.limit}
+	LogRequestTooLarge(p.auditLogPath, p.username, p.config.Name, p.connectionID, "postgres", tooLarge, map[string]interface{}{
+		"message_type": string(msgType),
+		"backend_addr": p.backendAddr,
+	})
+	p.logDecision("", audit.DecisionDeny, "request_too_large")
+
+	message := fmt.Sprintf("Message blocked: %s", tooLarge)
+	hint := "Split the statement or its data into smaller parts, or ask for a higher max_request_bytes."
+	if msgType == 'd' {
+		return pgCopyFail(message)
+	}
+	p.rejectClientMessage(client, msgType, message, hint)
+	return nil
+}
+
+// pgCopyFail builds a CopyFail message
+func pgCopyFail(message string) []byte {
+	msg := []byte{'f', 0, 0, 0, 0}
+	msg = append(msg, message...)
+	msg = append(msg, 0)
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)-1))
+	return msg
+}
+
+// trackParse remembers the SQL of a prepared statement. The unnamed statement is replaced by
+// every Parse; a named one keeps its SQL until closed, as the backend refuses to redefine it.
+func (p *PostgresAuthProxy) trackParse(msg []byte) {
+	name, rest := pgCString(msg[5:])
+	query, _ := pgCString(rest)
+	if p.statements == nil {
+		p.statements = make(map[string]string)
+	}
+	if _, exists := p.statements[name]; name == "" || !exists {
+		p.statements[name] = query
+	}
+}
+
+// trackBind remembers which prepared statement a portal runs
+func (p *PostgresAuthProxy) trackBind(msg []byte) {
+	portal, rest := pgCString(msg[5:])
+	statement, _ := pgCString(rest)
+	if p.portals == nil {
+		p.portals = make(map[string]string)
+	}
+	p.portals[portal] = statement
+}
+
+// trackClose forgets a closed prepared statement ('S') or portal ('P')
+func (p *PostgresAuthProxy) trackClose(msg []byte) {
+	if len(msg) < 6 {
+		return
+	}
+	name, _ := pgCString(msg[6:])
+	switch msg[5] {
+	case 'S':
+		delete(p.statements, name)
+	case 'P':
+		delete(p.portals, name)
+	}
+}
+
+// logExecute audits the execution of a portal with the SQL of its prepared statement
+func (p *PostgresAuthProxy) logExecute(msg []byte) {
+	portal, _ := pgCString(msg[5:])
+	statement, bound := p.portals[portal]
+	if !bound {
+		return
+	}
+	query, prepared := p.statements[statement]
+	if !prepared {
+		return
+	}
+
+	_ = audit.Log(p.auditLogPath, p.username, "postgres_execute", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"query":         query,
+		"statement":     statement,
+		"portal":        portal,
+		"database":      p.database,
+		"backend_addr":  p.backendAddr,
+	})
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func pgParse(name, query string) []byte {
+	body := append([]byte(name+"\x00"+query+"\x00"), 0, 0) // No parameter types
+	return buildPGMessage('P', body)
+}
+
+func pgBind(portal, statement string) []byte {
+	body := append([]byte(portal+"\x00"+statement+"\x00"), 0, 0, 0, 0, 0, 0) // No formats, parameters or result formats
+	return buildPGMessage('B', body)
+}
+
+func pgExecute(portal string) []byte {
+	return buildPGMessage('E', append([]byte(portal+"\x00"), 0, 0, 0, 0))
+}
+
+func pgSync() []byte {
+	return buildPGMessage('S', nil)
+}
+
+func TestPGMessageReader_Reassembles(t *testing.T) {
+	var r pgMessageReader
+	query := buildPGMessage('Q', []byte("SELECT 1\x00"))
+	sync := pgSync()
+	stream := append(append([]byte{}, query...), sync...)
+
+	// Header split, then body split, then the rest with a second message
+	var got [][]byte
+	for _, chunk := range [][]byte{stream[:3], stream[3:7], stream[7:]} {
+		got = append(got, r.push(chunk)...)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], query) || !bytes.Equal(got[1], sync) {
+		t.Fatalf("push() messages = %q, want the query and Sync", got)
+	}
+	if len(r.pending) != 0 {
+		t.Errorf("pending = %q after complete messages", r.pending)
+	}
+}
+
+func TestPostgresAuthProxy_ExtendedQuery(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	p := NewPostgresAuthProxy(&config.ConnectionConfig{Name: "pg", Type: "postgres"}, logPath, "alice", "conn-1", &config.Config{}, []string{"^SELECT"})
+	client := &recordingConn{}
+
+	// An allowed Parse/Bind/Execute/Sync batch split mid-Parse is forwarded unchanged
+	batch := bytes.Join([][]byte{
+		pgParse("users_by_id", "SELECT * FROM users WHERE id = $1"),
+		pgBind("", "users_by_id"),
+		pgExecute(""),
+		pgSync(),
+	}, nil)
+	forwarded := p.filterClientMessages(client, batch[:10])
+	forwarded = append(forwarded, p.filterClientMessages(client, batch[10:])...)
+	if !bytes.Equal(forwarded, batch) {
+		t.Fatalf("forwarded %q, want the whole batch", forwarded)
+	}
+	if client.buf.Len() != 0 {
+		t.Fatalf("client got %q for an allowed batch", client.buf.Bytes())
+	}
+
+	executed, _ := audit.Query(logPath, audit.Filter{Action: "postgres_execute"})
+	if len(executed) != 1 || executed[0].Metadata["query"] != "SELECT * FROM users WHERE id = $1" || executed[0].Metadata["statement"] != "users_by_id" {
+		t.Fatalf("postgres_execute audit entries = %+v", executed)
+	}
+
+	// A blocked Parse gets an ErrorResponse; the rest of its batch is dropped except the
+	// Sync, whose ReadyForQuery comes from the backend
+	blocked := bytes.Join([][]byte{
+		pgParse("", "DELETE FROM users"),
+		pgBind("", ""),
+		pgExecute(""),
+		pgSync(),
+	}, nil)
+	forwarded = p.filterClientMessages(client, blocked)
+	if !bytes.Equal(forwarded, pgSync()) {
+		t.Errorf("forwarded %q for a blocked batch, want only Sync", forwarded)
+	}
+	if out := client.buf.Bytes(); len(out) == 0 || out[0] != 'E' || bytes.Contains(out, []byte{'Z', 0, 0, 0, 5}) {
+		t.Errorf("client got %q, want a single ErrorResponse", out)
+	}
+	if !strings.Contains(client.buf.String(), "Query blocked by whitelist policy: DELETE FROM users") {
+		t.Errorf("ErrorResponse = %q", client.buf.String())
+	}
+
+	// The session continues normally after the Sync
+	next := buildPGMessage('Q', []byte("SELECT 1\x00"))
+	if forwarded := p.filterClientMessages(client, next); !bytes.Equal(forwarded, next) {
+		t.Errorf("query after the blocked batch was not forwarded: %q", forwarded)
+	}
+}
+
+func TestPostgresAuthProxy_Copy(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	p := NewPostgresAuthProxy(&config.ConnectionConfig{Name: "pg", Type: "postgres"}, logPath, "alice", "conn-1", &config.Config{}, []string{".*"})
+	p.SetCopyDirections([]string{"TO"})
+
+	tests := []struct {
+		query       string
+		wantMessage string
+	}{
+		{"COPY users TO STDOUT WITH (FORMAT csv)", ""},
+		{"COPY (SELECT id FROM users) TO STDOUT", ""},
+		{"COPY users FROM STDIN", "Query blocked: COPY FROM is not allowed by policy"},
+		{"copy users (id, name) from '/tmp/users.csv'", "Query blocked: COPY FROM is not allowed by policy"},
+		{"COPY users", "Query blocked: COPY statement could not be verified: COPY without FROM or TO"},
+	}
+	for _, tt := range tests {
+		_, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(tt.query), 0)))
+		if message != tt.wantMessage {
+			t.Errorf("validateAndLogQuery(%q) message = %q, want %q", tt.query, message, tt.wantMessage)
+		}
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "postgres_query_blocked"})
+	if len(entries) != 3 {
+		t.Fatalf("postgres_query_blocked audit entries = %d, want 3", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Metadata["reason"] != "copy_not_allowed" {
+			t.Errorf("blocked reason = %v, want copy_not_allowed", entry.Metadata["reason"])
+		}
+	}
+
+	// Once COPY FROM STDIN is allowed, CopyData is forwarded as-is even when it looks like a query
+	p.SetCopyDirections([]string{"FROM"})
+	stream := bytes.Join([][]byte{
+		buildPGMessage('Q', []byte("COPY users FROM STDIN\x00")),
+		buildPGMessage('d', buildPGMessage('Q', []byte("DROP TABLE users\x00"))),
+		buildPGMessage('c', nil),
+	}, nil)
+	client := &recordingConn{}
+	if forwarded := p.filterClientMessages(client, stream); !bytes.Equal(forwarded, stream) || client.buf.Len() != 0 {
+		t.Errorf("COPY FROM STDIN stream: forwarded %q, client got %q", forwarded, client.buf.Bytes())
+	}
+}
+
+func TestPostgresAuthProxy_MaxRequestBytes(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	p := NewPostgresAuthProxy(&config.ConnectionConfig{Name: "pg", Type: "postgres"}, logPath, "alice", "conn-1", &config.Config{}, []string{".*"})
+	p.SetMaxRequestBytes(64)
+	client := &recordingConn{}
+
+	// An oversized query split across reads is dropped without being buffered,
+	// and the message after it goes through
+	big := buildPGMessage('Q', []byte("SELECT '"+strings.Repeat("x", 100)+"'\x00"))
+	next := buildPGMessage('Q', []byte("SELECT 1\x00"))
+	forwarded := p.filterClientMessages(client, big[:20])
+	if len(p.clientMessages.pending) != 0 {
+		t.Fatalf("oversized message was buffered: %d bytes pending", len(p.clientMessages.pending))
+	}
+	forwarded = append(forwarded, p.filterClientMessages(client, append(append([]byte{}, big[20:]...), next...))...)
+	if !bytes.Equal(forwarded, next) {
+		t.Fatalf("forwarded %q, want only the next query", forwarded)
+	}
+	want := fmt.Sprintf("Message blocked: request too large: %d bytes, limit is 64 bytes", len(big))
+	if !strings.Contains(client.buf.String(), want) || !bytes.Contains(client.buf.Bytes(), []byte{'Z', 0, 0, 0, 5}) {
+		t.Errorf("client got %q, want an error with %q and ReadyForQuery", client.buf.String(), want)
+	}
+
+	// Oversized COPY data aborts the COPY at the backend
+	data := buildPGMessage('d', bytes.Repeat([]byte("1,alice\n"), 20))
+	if forwarded := p.filterClientMessages(client, data); len(forwarded) == 0 || forwarded[0] != 'f' {
+		t.Errorf("forwarded %q for oversized CopyData, want CopyFail", forwarded)
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "request_too_large"})
+	if len(entries) != 2 || entries[0].Metadata["size"] != float64(len(big)) || entries[0].Metadata["limit"] != float64(64) || entries[0].Metadata["message_type"] != "Q" {
+		t.Errorf("request_too_large audits = %+v", entries)
+	}
+}
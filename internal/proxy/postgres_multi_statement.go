@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/security"
+)
+
+// SetBlockMultiStatement enables (the default) or disables the checks that keep regex
+// whitelists from being bypassed: with only whitelist patterns guarding a connection,
+// stacked statements ("SELECT 1; DROP TABLE t") are rejected, and so are operations the
+// matching patterns' leading keywords don't cover (e.g. a DELETE in a CTE under ^WITH).
+// Connections with table_permissions are checked statement by statement instead.
+func (p *PostgresAuthProxy) SetBlockMultiStatement(enabled bool) {
+	p.allowMultiStatement = !enabled
+}
+
+// statementViolation returns why a whitelisted query may not run, or "" if it may:
+// "multi_statement" when it stacks statements, "operation_not_whitelisted" when the
+// analyzer finds an operation none of the whitelist patterns it matched grant.
+// Queries the analyzer cannot parse are only checked for stacked statements.
+func statementViolation(query string, analysis *security.SQLAnalysis, analysisErr error, whitelist []string) (reason, violation string, statements int) {
+	statements, err := security.CountStatements(query)
+	if err == nil && statements > 1 {
+		return "multi_statement", fmt.Sprintf("%d statements in one query", statements), statements
+	}
+	if analysisErr != nil {
+		return "", "", statements
+	}
+
+	var matched []string
+	for _, pattern := range whitelist {
+		if ok, err := authorization.MatchPattern(pattern, query); err == nil && ok {
+			matched = append(matched, pattern)
+		}
+	}
+	granted, restricted := security.WhitelistOperations(matched)
+	if len(matched) == 0 || !restricted {
+		return "", "", statements
+	}
+	var denied []string
+	for _, op := range analysis.Operations {
+		if !granted[op] {
+			denied = append(denied, op)
+		}
+	}
+	if len(denied) > 0 {
+		return "operation_not_whitelisted", fmt.Sprintf("%s is not allowed by the matching whitelist patterns", strings.Join(denied, ", ")), statements
+	}
+	return "", "", statements
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+const (
+	defaultPoolIdle        = 5 * time.Minute
+	defaultPoolMaxLifetime = 30 * time.Minute
+	poolResetTimeout       = 5 * time.Second
+)
+
+// pgPooledConn is an authenticated backend session waiting to be reused
+type pgPooledConn struct {
+	conn      net.Conn
+	addr      string          // Configured host:port the session is on (cancel requests go here)
+	startup   *backendStartup // Session parameters and backend key reported at startup
+	createdAt time.Time
+	idleUntil time.Time // Closed if still unused at this time
+	expiresAt time.Time // Never reused after this time (max lifetime)
+}
+
+var (
+	pgPoolMu sync.Mutex
+	pgPools  = make(map[string][]*pgPooledConn) // Idle sessions by pool key, most recently used last
+)
+
+// postgresPoolKey identifies backend sessions that are interchangeable: same
+// backend, database and startup parameters (DISCARD ALL resets to these)
+func postgresPoolKey(cfg *config.ConnectionConfig, backendAddr, database string, clientParams map[string]string) string {
+	keys := make([]string, 0, len(clientParams))
+	for key := range clientParams {
+		switch key {
+		case "user", "database", "replication":
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s\x00%s\x00%s\x00%t", cfg.Name, backendAddr, cfg.BackendUsername, database, cfg.BackendTLS)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\x00%s=%s", key, clientParams[key])
+	}
+	return b.String()
+}
+
+// acquirePooledBackend returns an idle backend session for key, or nil if there is none
+func acquirePooledBackend(key string) *pgPooledConn {
+	pgPoolMu.Lock()
+	defer pgPoolMu.Unlock()
+
+	sweepPooledBackends(time.Now())
+	idle := pgPools[key]
+	if len(idle) == 0 {
+		return nil
+	}
+	pc := idle[len(idle)-1]
+	if len(idle) == 1 {
+		delete(pgPools, key)
+	} else {
+		pgPools[key] = idle[:len(idle)-1]
+	}
+	return pc
+}
+
+// releasePooledBackend resets a backend session after a client is done with it
+// and keeps it for reuse. It returns false if the session could not be reset or
+// the pool is full; the caller must then close it.
+func releasePooledBackend(cfg *config.ConnectionConfig, key string, pc *pgPooledConn) (bool, error) {
+	now := time.Now()
+	maxLifetime := cfg.PoolMaxLifetime
+	if maxLifetime == 0 {
+		maxLifetime = defaultPoolMaxLifetime
+	}
+	if now.Sub(pc.createdAt) >= maxLifetime {
+		return false, nil
+	}
+
+	// Never hand one user's transaction or session state to the next
+	if err := resetBackendSession(pc.conn); err != nil {
+		return false, err
+	}
+
+	idleTimeout := cfg.PoolIdle
+	if idleTimeout == 0 {
+		idleTimeout = defaultPoolIdle
+	}
+	pc.idleUntil = now.Add(idleTimeout)
+	pc.expiresAt = pc.createdAt.Add(maxLifetime)
+
+	pgPoolMu.Lock()
+	defer pgPoolMu.Unlock()
+
+	sweepPooledBackends(now)
+	if len(pgPools[key]) >= cfg.PoolMax {
+		return false, nil
+	}
+	pgPools[key] = append(pgPools[key], pc)
+	return true, nil
+}
+
+// sweepPooledBackends closes sessions that sat idle too long or reached their
+// max lifetime. Must be called with pgPoolMu held.
+func sweepPooledBackends(now time.Time) {
+	for key, idle := range pgPools {
+		kept := idle[:0]
+		for _, pc := range idle {
+			if now.After(pc.idleUntil) || now.After(pc.expiresAt) {
+				_ = pc.conn.Close()
+				continue
+			}
+			kept = append(kept, pc)
+		}
+		if len(kept) == 0 {
+			delete(pgPools, key)
+		} else {
+			pgPools[key] = kept
+		}
+	}
+}
+
+// resetBackendSession rolls back any open transaction and runs DISCARD ALL,
+// which drops temp tables, prepared statements, cursors, listeners, advisory
+// locks and SET values. The session must be idle on a message boundary.
+func resetBackendSession(conn net.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(poolResetTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	// Separate queries: DISCARD ALL cannot run inside the implicit transaction of a multi-statement query
+	reset := append(buildPGMessage('Q', []byte("ROLLBACK\x00")), buildPGMessage('Q', []byte("DISCARD ALL\x00"))...)
+	if _, err := conn.Write(reset); err != nil {
+		return fmt.Errorf("failed to send session reset: %w", err)
+	}
+
+	discarded := false
+	for ready := 0; ready < 2; {
+		msgType, body, err := readPGMessage(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read session reset response: %w", err)
+		}
+		switch msgType {
+		case 'C': // CommandComplete
+			if ready == 1 && string(bytes.TrimRight(body, "\x00")) == "DISCARD ALL" {
+				discarded = true
+			}
+		case 'E': // ErrorResponse
+			if ready == 1 {
+				return fmt.Errorf("DISCARD ALL failed: %s", string(body))
+			}
+		case 'Z': // ReadyForQuery
+			ready++
+			if ready == 2 && (len(body) < 1 || body[0] != 'I') {
+				return fmt.Errorf("backend session not idle after reset (status %q)", body)
+			}
+		}
+	}
+	if !discarded {
+		return fmt.Errorf("backend did not confirm DISCARD ALL")
+	}
+	return nil
+}
+
+// readPGMessage reads one type + length + body message from a Postgres stream
+func readPGMessage(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < 4 || length > 1<<30 {
+		return 0, nil, fmt.Errorf("invalid message length: %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// isPGTerminate reports whether data is exactly one Terminate message
+func isPGTerminate(data []byte) bool {
+	return len(data) == 5 && data[0] == 'X' && binary.BigEndian.Uint32(data[1:5]) == 4
+}
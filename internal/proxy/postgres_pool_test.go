@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func pooledTestConfig(name string, port int) *config.ConnectionConfig {
+	return &config.ConnectionConfig{
+		Name:            name,
+		Type:            "postgres",
+		Host:            "127.0.0.1",
+		Port:            port,
+		BackendUsername: "backend_user",
+		BackendPassword: "backend_pass",
+		BackendDatabase: "appdb",
+		PoolMax:         2,
+	}
+}
+
+// waitForQueries waits until the backend has received n simple queries
+func waitForQueries(t *testing.T, backend *fakePGBackend, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if queries := backend.receivedQueries(); len(queries) >= n {
+			return queries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("backend received %v, want at least %d queries", backend.receivedQueries(), n)
+	return nil
+}
+
+func TestPostgresPool_ReusesResetBackendSession(t *testing.T) {
+	backend := newFakePGBackend(t)
+	proxyAddr := startTestPostgresProxyWithConfig(t, pooledTestConfig("pool-reuse", backend.port()), "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := connectTestDriver(ctx, t, proxyAddr)
+	if _, err := first.Exec(ctx, "SELECT 1").ReadAll(); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if err := first.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// The session is reset before anyone else can use it
+	queries := waitForQueries(t, backend, 3)
+	if queries[1] != "ROLLBACK" || queries[2] != "DISCARD ALL" {
+		t.Errorf("queries after client left = %v, want ROLLBACK then DISCARD ALL", queries[1:])
+	}
+
+	second := connectTestDriver(ctx, t, proxyAddr)
+	if _, err := second.Exec(ctx, "SELECT 2").ReadAll(); err != nil {
+		t.Fatalf("Exec() on pooled session error = %v", err)
+	}
+	if got := backend.sessions.Load(); got != 1 {
+		t.Errorf("backend sessions = %d, want 1 (reused)", got)
+	}
+	if got := second.ParameterStatus("TimeZone"); got != backend.params["TimeZone"] {
+		t.Errorf("ParameterStatus(TimeZone) on pooled session = %q, want %q", got, backend.params["TimeZone"])
+	}
+	if _, ok := lookupCancelKey(cancelKey{ProcessID: second.PID(), SecretKey: second.SecretKey()}); !ok {
+		t.Error("pooled session has no registered proxy cancel key")
+	}
+}
+
+func TestPostgresPool_AbruptDisconnectNotReused(t *testing.T) {
+	backend := newFakePGBackend(t)
+	proxyAddr := startTestPostgresProxyWithConfig(t, pooledTestConfig("pool-abrupt", backend.port()), "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Dropping the socket without Terminate may leave the backend mid-request
+	first := connectTestDriver(ctx, t, proxyAddr)
+	_ = first.Conn().Close()
+	time.Sleep(100 * time.Millisecond)
+
+	second := connectTestDriver(ctx, t, proxyAddr)
+	if _, err := second.Exec(ctx, "SELECT 1").ReadAll(); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if got := backend.sessions.Load(); got != 2 {
+		t.Errorf("backend sessions = %d, want 2 (not reused)", got)
+	}
+	for _, query := range backend.receivedQueries() {
+		if query == "DISCARD ALL" {
+			t.Error("abruptly closed session was reset for reuse")
+		}
+	}
+}
+
+func TestPostgresPool_DisabledClosesBackend(t *testing.T) {
+	backend := newFakePGBackend(t)
+	cfg := pooledTestConfig("pool-disabled", backend.port())
+	cfg.PoolMax = 0
+	proxyAddr := startTestPostgresProxyWithConfig(t, cfg, "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		conn := connectTestDriver(ctx, t, proxyAddr)
+		if err := conn.Close(ctx); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	if got := backend.sessions.Load(); got != 2 {
+		t.Errorf("backend sessions = %d, want 2 without pooling", got)
+	}
+}
+
+func TestPostgresPoolKey(t *testing.T) {
+	cfg := pooledTestConfig("pool-key", 5432)
+	base := postgresPoolKey(cfg, "db:5432", "appdb", map[string]string{"user": "alice", "application_name": "psql"})
+
+	if got := postgresPoolKey(cfg, "db:5432", "appdb", map[string]string{"user": "bob", "application_name": "psql"}); got != base {
+		t.Error("pool key depends on the client user; sessions authenticate as the backend user")
+	}
+	if got := postgresPoolKey(cfg, "db:5432", "otherdb", map[string]string{"application_name": "psql"}); got == base {
+		t.Error("sessions for different databases share a pool key")
+	}
+	if got := postgresPoolKey(cfg, "db:5432", "appdb", map[string]string{"application_name": "psql", "options": "-c search_path=x"}); got == base {
+		t.Error("sessions with different startup parameters share a pool key")
+	}
+	if got := postgresPoolKey(cfg, "replica:5432", "appdb", map[string]string{"application_name": "psql"}); got == base {
+		t.Error("sessions on the primary and the replica share a pool key")
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/security"
+)
+
+// SetReadOnly enables read-only mode for this proxy.
+// In read-only mode only SELECT and EXPLAIN statements are forwarded, whatever the
+// whitelist allows, and the backend session is opened with default_transaction_read_only
+// so functions called from a SELECT cannot write either. Read-only sessions connect to
+// the connection's replica when one is configured.
+func (p *PostgresAuthProxy) SetReadOnly(enabled bool) {
+	p.readOnly = enabled
+}
+
+// backendTarget returns the host and port this session connects to, and whether it is the replica
+func (p *PostgresAuthProxy) backendTarget() (string, int, bool) {
+	if !p.readOnly || p.config.ReplicaHost == "" {
+		return p.config.Host, p.config.Port, false
+	}
+	port := p.config.ReplicaPort
+	if port == 0 {
+		port = p.config.Port
+	}
+	return p.config.ReplicaHost, port, true
+}
+
+// readOnlyStartupParams returns the client startup parameters with the backend session forced read-only
+func readOnlyStartupParams(params map[string]string) map[string]string {
+	forced := make(map[string]string, len(params)+1)
+	for key, value := range params {
+		forced[key] = value
+	}
+	forced["default_transaction_read_only"] = "on"
+	return forced
+}
+
+// readOnlyViolation returns why a query may not run on a read-only session, or "" if it may.
+// Only statements the analyzer recognizes as SELECT (including EXPLAIN of a SELECT) pass;
+// anything it cannot parse is rejected rather than trusted.
+func readOnlyViolation(analysis *security.SQLAnalysis, analysisErr error) string {
+	if analysisErr != nil {
+		return fmt.Sprintf("query could not be verified as read-only: %v", analysisErr)
+	}
+	if len(analysis.Operations) == 0 {
+		return "only SELECT and EXPLAIN statements are allowed"
+	}
+	var writes []string
+	for _, op := range analysis.Operations {
+		if op != "SELECT" {
+			writes = append(writes, op)
+		}
+	}
+	if len(writes) > 0 {
+		return fmt.Sprintf("%s is not allowed", strings.Join(writes, ", "))
+	}
+	return ""
+}
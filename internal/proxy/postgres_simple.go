@@ -20,6 +20,7 @@ type SimplePostgresProxy struct {
 	auditLogPath string
 	username     string
 	connectionID string
+	backendAddr  string // Resolved backend address, for audit records
 }
 
 // NewSimplePostgresProxy creates a simplified postgres proxy
@@ -37,16 +38,18 @@ func (p *SimplePostgresProxy) HandleConnection(clientConn net.Conn) error {
 	defer func() { _ = clientConn.Close() }()
 
 	// Connect to backend immediately
-	backendAddr := fmt.Sprintf("%s:%d", p.config.Host, p.config.Port)
-	backendConn, err := net.DialTimeout("tcp", backendAddr, 10*time.Second)
+	backendConn, selection, err := DialBackendSelection(p.config, 10*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to connect to backend: %w", err)
 	}
 	defer func() { _ = backendConn.Close() }()
+	p.backendAddr = ResolvedBackendAddr(backendConn)
+	LogBackendSelection(p.auditLogPath, p.username, p.config.Name, p.connectionID, selection)
 
 	_ = audit.Log(p.auditLogPath, p.username, "postgres_connect", p.config.Name, map[string]interface{}{
 		"connection_id": p.connectionID,
-		"backend":       backendAddr,
+		"backend":       selection.Host,
+		"backend_addr":  p.backendAddr,
 	})
 
 	// Do bidirectional proxying with query interception
@@ -149,6 +152,7 @@ func (p *SimplePostgresProxy) tryLogQuery(data []byte) {
 							"connection_id": p.connectionID,
 							"query":         query,
 							"database":      p.config.BackendDatabase,
+							"backend_addr":  p.backendAddr,
 						})
 					}
 				}
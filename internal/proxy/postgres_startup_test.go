@@ -0,0 +1,475 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/xdg-go/scram"
+)
+
+// fakePGBackend is a minimal Postgres server that authenticates with a cleartext password
+// (or SCRAM-SHA-256, see auth) and reports a fixed set of session parameters
+type fakePGBackend struct {
+	listener  net.Listener
+	auth      string            // "" (cleartext), "scram-sha-256" or "gss"
+	sasl      []string          // SASL mechanisms offered for scram-sha-256; defaults to SCRAM-SHA-256
+	params    map[string]string // ParameterStatus to report
+	processID uint32
+	secretKey uint32
+	startup   chan map[string]string // Startup parameters received from the proxy
+	cancels   chan *pgproto3.CancelRequest
+	sessions  atomic.Int32 // Backend sessions started
+
+	mu      sync.Mutex
+	queries []string // Simple queries received, across all sessions
+}
+
+func newFakePGBackend(t *testing.T) *fakePGBackend {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	b := &fakePGBackend{
+		listener: listener,
+		params: map[string]string{
+			"server_version":    "15.4",
+			"server_encoding":   "UTF8",
+			"client_encoding":   "UTF8",
+			"DateStyle":         "ISO, DMY",
+			"TimeZone":          "Europe/Madrid",
+			"integer_datetimes": "on",
+		},
+		processID: 4242,
+		secretKey: 987654321,
+		startup:   make(chan map[string]string, 4),
+		cancels:   make(chan *pgproto3.CancelRequest, 1),
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go b.serve()
+	return b
+}
+
+func (b *fakePGBackend) port() int {
+	return b.listener.Addr().(*net.TCPAddr).Port
+}
+
+// receivedQueries returns the simple queries the backend received so far
+func (b *fakePGBackend) receivedQueries() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.queries...)
+}
+
+func (b *fakePGBackend) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakePGBackend) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	backend := pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn)
+
+	msg, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	if cancel, ok := msg.(*pgproto3.CancelRequest); ok {
+		b.cancels <- cancel
+		return
+	}
+	startup, ok := msg.(*pgproto3.StartupMessage)
+	if !ok {
+		return
+	}
+	b.sessions.Add(1)
+	select {
+	case b.startup <- startup.Parameters:
+	default:
+	}
+
+	if !b.authenticate(backend) {
+		return
+	}
+
+	_ = backend.Send(&pgproto3.AuthenticationOk{})
+	for name, value := range b.params {
+		_ = backend.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+	}
+	if appName, ok := startup.Parameters["application_name"]; ok {
+		_ = backend.Send(&pgproto3.ParameterStatus{Name: "application_name", Value: appName})
+	}
+	_ = backend.Send(&pgproto3.BackendKeyData{ProcessID: b.processID, SecretKey: b.secretKey})
+	_ = backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			b.mu.Lock()
+			b.queries = append(b.queries, msg.String)
+			b.mu.Unlock()
+			tag := "SELECT 0"
+			if msg.String == "ROLLBACK" || msg.String == "DISCARD ALL" {
+				tag = msg.String
+			}
+			_ = backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+			_ = backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// authenticate runs the backend side of the configured authentication method, accepting
+// backend_user/backend_pass. It reports whether the session may continue.
+func (b *fakePGBackend) authenticate(backend *pgproto3.Backend) bool {
+	switch b.auth {
+	case "":
+		_ = backend.Send(&pgproto3.AuthenticationCleartextPassword{})
+		_, err := backend.Receive()
+		return err == nil
+	case "gss":
+		_ = backend.Send(&pgproto3.AuthenticationGSS{})
+		_ = backend.SetAuthType(pgproto3.AuthTypeGSS)
+		_, _ = backend.Receive()
+		return false
+	}
+
+	client, err := scram.SHA256.NewClient("backend_user", "backend_pass", "")
+	if err != nil {
+		return false
+	}
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "fake-backend-salt", Iters: 4096})
+	server, err := scram.SHA256.NewServer(func(string) (scram.StoredCredentials, error) {
+		return credentials, nil
+	})
+	if err != nil {
+		return false
+	}
+	conv := server.NewConversation()
+
+	mechanisms := b.sasl
+	if mechanisms == nil {
+		mechanisms = []string{"SCRAM-SHA-256"}
+	}
+	_ = backend.Send(&pgproto3.AuthenticationSASL{AuthMechanisms: mechanisms})
+	_ = backend.SetAuthType(pgproto3.AuthTypeSASL)
+	msg, err := backend.Receive()
+	if err != nil {
+		return false
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok || initial.AuthMechanism != "SCRAM-SHA-256" {
+		return false
+	}
+	serverFirst, err := conv.Step(string(initial.Data))
+	if err != nil {
+		return false
+	}
+
+	_ = backend.Send(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)})
+	_ = backend.SetAuthType(pgproto3.AuthTypeSASLContinue)
+	msg, err = backend.Receive()
+	if err != nil {
+		return false
+	}
+	response, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return false
+	}
+	serverFinal, err := conv.Step(string(response.Data))
+	if err != nil {
+		_ = backend.Send(&pgproto3.ErrorResponse{
+			Severity: "FATAL",
+			Code:     "28P01",
+			Message:  `password authentication failed for user "backend_user"`,
+		})
+		return false
+	}
+	_ = backend.Send(&pgproto3.AuthenticationSASLFinal{Data: []byte(serverFinal)})
+	return true
+}
+
+// startTestPostgresProxy runs the auth proxy for client connections authenticated as username
+func startTestPostgresProxy(t *testing.T, backendPort int, username string) string {
+	t.Helper()
+	return startTestPostgresProxyWithConfig(t, &config.ConnectionConfig{
+		Name:            "test-postgres",
+		Type:            "postgres",
+		Host:            "127.0.0.1",
+		Port:            backendPort,
+		BackendUsername: "backend_user",
+		BackendPassword: "backend_pass",
+		BackendDatabase: "appdb",
+	}, username)
+}
+
+// startTestPostgresProxyWithConfig runs the auth proxy for connConfig
+func startTestPostgresProxyWithConfig(t *testing.T, connConfig *config.ConnectionConfig, username string) string {
+	t.Helper()
+	return startTestPostgresProxyWithAudit(t, connConfig, username, "")
+}
+
+// startTestPostgresProxyWithAudit runs the auth proxy for connConfig, auditing to auditLogPath
+func startTestPostgresProxyWithAudit(t *testing.T, connConfig *config.ConnectionConfig, username, auditLogPath string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			p := NewPostgresAuthProxy(connConfig, auditLogPath, username, "conn-1", &config.Config{}, nil)
+			go func() { _ = p.HandleConnection(conn) }()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestPostgresAuthProxy_StartupPassthrough(t *testing.T) {
+	backend := newFakePGBackend(t)
+	proxyAddr := startTestPostgresProxy(t, backend.port(), "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := connectTestDriver(ctx, t, proxyAddr)
+
+	// Client startup parameters reach the backend, identity is replaced by the proxy
+	startup := <-backend.startup
+	if startup["user"] != "backend_user" || startup["database"] != "appdb" {
+		t.Errorf("backend startup user/database = %q/%q, want backend_user/appdb", startup["user"], startup["database"])
+	}
+	if startup["application_name"] != "driver-test" {
+		t.Errorf("backend startup application_name = %q, want driver-test", startup["application_name"])
+	}
+
+	// ParameterStatus is the backend's, not a synthesized set
+	for name, want := range backend.params {
+		if got := conn.ParameterStatus(name); got != want {
+			t.Errorf("ParameterStatus(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := conn.ParameterStatus("application_name"); got != "driver-test" {
+		t.Errorf("ParameterStatus(application_name) = %q, want driver-test", got)
+	}
+
+	// BackendKeyData is a proxy-issued key mapped to the backend session
+	target, ok := lookupCancelKey(cancelKey{ProcessID: conn.PID(), SecretKey: conn.SecretKey()})
+	if !ok {
+		t.Fatalf("BackendKeyData %d/%d is not a registered proxy cancel key", conn.PID(), conn.SecretKey())
+	}
+	if target.BackendKey != (cancelKey{ProcessID: backend.processID, SecretKey: backend.secretKey}) {
+		t.Errorf("cancel key maps to backend key %+v, want %d/%d", target.BackendKey, backend.processID, backend.secretKey)
+	}
+	if conn.PID() == backend.processID && conn.SecretKey() == backend.secretKey {
+		t.Error("client received the backend's own BackendKeyData")
+	}
+
+	// The session is usable after the handshake
+	if _, err := conn.Exec(ctx, "SELECT 1").ReadAll(); err != nil {
+		t.Errorf("Exec() after handshake error = %v", err)
+	}
+}
+
+func TestPostgresAuthProxy_SCRAMBackend(t *testing.T) {
+	defer audit.Close()
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+
+	backend := newFakePGBackend(t)
+	backend.auth = "scram-sha-256"
+	backend.sasl = []string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}
+	proxyAddr := startTestPostgresProxyWithAudit(t, &config.ConnectionConfig{
+		Name:            "test-postgres",
+		Type:            "postgres",
+		Host:            "127.0.0.1",
+		Port:            backend.port(),
+		BackendUsername: "backend_user",
+		BackendPassword: "backend_pass",
+		BackendDatabase: "appdb",
+	}, "alice", auditLog)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The client authenticates to the proxy as its own user; the proxy does SCRAM with the backend
+	conn := connectTestDriver(ctx, t, proxyAddr)
+	if _, err := conn.Exec(ctx, "SELECT 1").ReadAll(); err != nil {
+		t.Fatalf("Exec() through SCRAM backend error = %v", err)
+	}
+
+	entries, _ := audit.Query(auditLog, audit.Filter{Action: "postgres_auth"})
+	if len(entries) != 1 {
+		t.Fatalf("postgres_auth audit entries = %d, want 1", len(entries))
+	}
+	if got := entries[0].Metadata["backend_auth"]; got != "scram-sha-256" {
+		t.Errorf("postgres_auth backend_auth = %v, want scram-sha-256", got)
+	}
+}
+
+func TestPostgresAuthProxy_BackendAuthMethods(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        string
+		sasl        []string
+		password    string
+		wantMethod  string
+		wantErr     string
+		unsupported bool
+	}{
+		{name: "cleartext", password: "backend_pass", wantMethod: "password"},
+		{name: "scram", auth: "scram-sha-256", password: "backend_pass", wantMethod: "scram-sha-256"},
+		{
+			name:     "scram wrong password",
+			auth:     "scram-sha-256",
+			password: "wrong",
+			wantErr:  "password authentication failed",
+		},
+		{
+			name:        "channel binding only",
+			auth:        "scram-sha-256",
+			sasl:        []string{"SCRAM-SHA-256-PLUS"},
+			password:    "backend_pass",
+			wantErr:     "SCRAM-SHA-256-PLUS",
+			unsupported: true,
+		},
+		{name: "gss", auth: "gss", password: "backend_pass", wantErr: "gss", unsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakePGBackend(t)
+			backend.auth = tt.auth
+			backend.sasl = tt.sasl
+
+			conn, err := net.Dial("tcp", backend.listener.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial backend: %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			p := NewPostgresAuthProxy(&config.ConnectionConfig{
+				Name:            "test-postgres",
+				BackendUsername: "backend_user",
+				BackendPassword: tt.password,
+			}, "", "alice", "conn-1", &config.Config{}, nil)
+			if err := p.sendBackendStartup(conn, "backend_user", "appdb", nil); err != nil {
+				t.Fatalf("sendBackendStartup() error = %v", err)
+			}
+
+			startup, err := p.handleBackendAuth(conn, tt.password)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("handleBackendAuth() error = %v, want containing %q", err, tt.wantErr)
+				}
+				if errors.Is(err, ErrBackendAuthUnsupported) != tt.unsupported {
+					t.Errorf("errors.Is(err, ErrBackendAuthUnsupported) = %v, want %v", !tt.unsupported, tt.unsupported)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleBackendAuth() error = %v", err)
+			}
+			if startup.AuthMethod != tt.wantMethod {
+				t.Errorf("AuthMethod = %q, want %q", startup.AuthMethod, tt.wantMethod)
+			}
+		})
+	}
+}
+
+// connectTestDriver connects a real Postgres driver to the proxy as alice
+func connectTestDriver(ctx context.Context, t *testing.T, proxyAddr string) *pgconn.PgConn {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(proxyAddr)
+	portNum, _ := strconv.Atoi(port)
+	connString := fmt.Sprintf("host=%s port=%d user=alice password=anything dbname=appdb sslmode=disable application_name=driver-test", host, portNum)
+
+	conn, err := pgconn.Connect(ctx, connString)
+	if err != nil {
+		t.Fatalf("pgconn.Connect() through proxy error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close(context.Background()) })
+	return conn
+}
+
+func TestPostgresAuthProxy_AllowedDatabases(t *testing.T) {
+	backend := newFakePGBackend(t)
+	proxyAddr := startTestPostgresProxyWithConfig(t, &config.ConnectionConfig{
+		Name:             "test-postgres",
+		Type:             "postgres",
+		Host:             "127.0.0.1",
+		Port:             backend.port(),
+		BackendUsername:  "backend_user",
+		BackendPassword:  "backend_pass",
+		AllowedDatabases: []string{"appdb"},
+	}, "alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A listed database passes through to the backend
+	connectTestDriver(ctx, t, proxyAddr)
+	if startup := <-backend.startup; startup["database"] != "appdb" {
+		t.Errorf("backend startup database = %q, want appdb", startup["database"])
+	}
+
+	// Any other is refused before the backend is contacted
+	host, port, _ := net.SplitHostPort(proxyAddr)
+	_, err := pgconn.Connect(ctx, fmt.Sprintf("host=%s port=%s user=alice password=x dbname=payroll sslmode=disable", host, port))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("connect to unlisted database error = %v, want not allowed", err)
+	}
+}
+
+func TestDatabaseAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ConnectionConfig
+		database string
+		want     bool
+	}{
+		{"no restrictions", config.ConnectionConfig{}, "anything", true},
+		{"backend database", config.ConnectionConfig{BackendDatabase: "app"}, "app", true},
+		{"other than backend database", config.ConnectionConfig{BackendDatabase: "app"}, "billing", false},
+		{"allowed database", config.ConnectionConfig{BackendDatabase: "app", AllowedDatabases: []string{"analytics"}}, "analytics", true},
+		{"unlisted database", config.ConnectionConfig{AllowedDatabases: []string{"analytics"}}, "billing", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DatabaseAllowed(&tt.cfg, tt.database); got != tt.want {
+				t.Errorf("DatabaseAllowed(%q) = %v, want %v", tt.database, got, tt.want)
+			}
+		})
+	}
+}
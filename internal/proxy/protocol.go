@@ -26,6 +26,14 @@ func NewProtocol(connConfig *config.ConnectionConfig) (Protocol, error) {
 		return nil, fmt.Errorf("postgres protocol uses dedicated handler, not this interface")
 	case "tcp":
 		return NewTCPProxy(connConfig), nil
+	case "grpc":
+		return NewGRPCProxy(connConfig, nil, "", "", "")
+	case "mongodb":
+		return NewMongoProxy(connConfig, nil, "", "", ""), nil
+	case "ssh":
+		return NewSSHProxy(connConfig, nil, "", "", "")
+	case "kafka":
+		return NewKafkaProxy(connConfig, nil, "", "", ""), nil
 	default:
 		return nil, fmt.Errorf("unsupported protocol type: %s", connConfig.Type)
 	}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Protocols recognized by DetectClientProtocol and IsMySQLGreeting
+const (
+	ProtocolPostgres = "postgres"
+	ProtocolRedis    = "redis"
+	ProtocolMySQL    = "mysql"
+)
+
+// pgProtocolVersion3 is the protocol code of a Postgres 3.0 StartupMessage
+const pgProtocolVersion3 = 196608
+
+// DetectClientProtocol recognizes a protocol from the first bytes a client sends:
+// a Postgres startup packet (StartupMessage, SSLRequest or CancelRequest) or a Redis
+// RESP command array. It returns "" for anything else, including server-first
+// protocols such as MySQL, whose clients send nothing until the server greets them.
+func DetectClientProtocol(data []byte) string {
+	if isPostgresStartup(data) {
+		return ProtocolPostgres
+	}
+	if isRESPCommand(data) {
+		return ProtocolRedis
+	}
+	return ""
+}
+
+// isPostgresStartup reports whether data starts with a Postgres startup packet
+func isPostgresStartup(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length < 8 || length > 10000 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(data[4:8]) {
+	case pgProtocolVersion3, pgSSLRequestCode:
+		return true
+	case pgCancelRequestCode:
+		return length == 16
+	}
+	return false
+}
+
+// isRESPCommand reports whether data starts with a RESP array header ("*<count>\r\n")
+// followed by a bulk string, the way Redis clients send every command
+func isRESPCommand(data []byte) bool {
+	if len(data) < 4 || data[0] != '*' {
+		return false
+	}
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 2 {
+		return false
+	}
+	for _, c := range data[1:end] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	rest := data[end+2:]
+	return len(rest) == 0 || rest[0] == '$'
+}
+
+// IsMySQLGreeting reports whether data starts with a MySQL initial handshake packet
+// (protocol version 10), which the server sends as soon as a client connects
+func IsMySQLGreeting(data []byte) bool {
+	if len(data) < 6 {
+		return false
+	}
+	length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	if length < 2 || data[3] != 0 || data[4] != 10 {
+		return false
+	}
+	// The server version string follows, NUL-terminated, within the packet
+	version := data[5:]
+	if len(version) > length-1 {
+		version = version[:length-1]
+	}
+	return bytes.IndexByte(version, 0) > 0
+}
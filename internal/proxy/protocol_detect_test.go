@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDetectClientProtocol(t *testing.T) {
+	startup := func(code uint32, params string) []byte {
+		msg := make([]byte, 8, 8+len(params))
+		msg = append(msg, params...)
+		binary.BigEndian.PutUint32(msg[0:4], uint32(len(msg)))
+		binary.BigEndian.PutUint32(msg[4:8], code)
+		return msg
+	}
+	cancel := startup(pgCancelRequestCode, "\x00\x00\x00\x01\x00\x00\x00\x02")
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"postgres startup", startup(pgProtocolVersion3, "user\x00alice\x00\x00"), ProtocolPostgres},
+		{"postgres ssl request", startup(pgSSLRequestCode, ""), ProtocolPostgres},
+		{"postgres cancel request", cancel, ProtocolPostgres},
+		{"postgres cancel request with wrong length", startup(pgCancelRequestCode, ""), ""},
+		{"unknown startup code", startup(12345, ""), ""},
+		{"redis command", []byte("*1\r\n$4\r\nPING\r\n"), ProtocolRedis},
+		{"redis array header only", []byte("*3\r\n"), ProtocolRedis},
+		{"redis inline command", []byte("PING\r\n"), ""},
+		{"not a resp count", []byte("*x\r\n$4\r\n"), ""},
+		{"http request", []byte("GET / HTTP/1.1\r\nHost: example\r\n\r\n"), ""},
+		{"tls client hello", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01, 0x00, 0x01}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectClientProtocol(tt.data); got != tt.want {
+				t.Errorf("DetectClientProtocol(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMySQLGreeting(t *testing.T) {
+	payload := append([]byte{10}, "8.0.36\x00"...)
+	payload = append(payload, make([]byte, 40)...)
+	greeting := append([]byte{byte(len(payload)), 0, 0, 0}, payload...)
+
+	if !IsMySQLGreeting(greeting) {
+		t.Error("IsMySQLGreeting() = false for a MySQL 8 handshake")
+	}
+	if IsMySQLGreeting([]byte("+OK\r\n")) {
+		t.Error("IsMySQLGreeting() = true for a Redis reply")
+	}
+	if IsMySQLGreeting([]byte{5, 0, 0, 0, 10, 'x', 'y', 'z', 'w'}) {
+		t.Error("IsMySQLGreeting() = true for a version string without terminator")
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/logging"
+)
+
+// ErrQuotaExceeded is returned when a session transfers more bytes than its quota allows
+var ErrQuotaExceeded = errors.New("connection byte quota exceeded")
+
+// AddBytesIn charges n bytes sent from the client to the backend against max_bytes_in
+// The bytes are not counted (and must not be forwarded) if they would exceed the quota.
+func (c *Connection) AddBytesIn(n int) error {
+	return c.addBytes(&c.bytesIn, c.MaxBytesIn, n, "in")
+}
+
+// AddBytesOut charges n bytes sent from the backend to the client against max_bytes_out
+// The bytes are not counted (and must not be forwarded) if they would exceed the quota.
+func (c *Connection) AddBytesOut(n int) error {
+	return c.addBytes(&c.bytesOut, c.MaxBytesOut, n, "out")
+}
+
+// BytesIn returns the bytes sent from the client to the backend so far
+func (c *Connection) BytesIn() int64 {
+	return c.bytesIn.Load()
+}
+
+// BytesOut returns the bytes sent from the backend to the client so far
+func (c *Connection) BytesOut() int64 {
+	return c.bytesOut.Load()
+}
+
+// QuotaExceeded reports whether the session has hit one of its byte quotas
+func (c *Connection) QuotaExceeded() bool {
+	return c.quotaExceeded.Load()
+}
+
+// addBytes adds n to a direction's counter, backing it out again if the limit is exceeded
+// Both directions run concurrently, so the counters are atomic; quota_exceeded is audited once.
+func (c *Connection) addBytes(counter *atomic.Int64, limit int64, n int, direction string) error {
+	if n <= 0 {
+		return nil
+	}
+
+	total := counter.Add(int64(n))
+	if limit <= 0 || total <= limit {
+		return nil
+	}
+	counter.Add(-int64(n))
+
+	if c.quotaExceeded.CompareAndSwap(false, true) {
+		logging.Component("proxy").Warn("connection byte quota exceeded",
+			"connection_id", c.ID,
+			"username", c.Username,
+			"connection", c.Config.Name,
+			"direction", direction,
+			"limit", limit)
+		_ = audit.Log(c.auditLogPath, c.Username, "quota_exceeded", c.Config.Name, map[string]interface{}{
+			"connection_id": c.ID,
+			"direction":     direction,
+			"limit":         limit,
+			"bytes_in":      c.bytesIn.Load(),
+			"bytes_out":     c.bytesOut.Load(),
+		})
+	}
+	return ErrQuotaExceeded
+}
+
+// ConnectionUsage describes an active connection and the traffic it has carried
+type ConnectionUsage struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Connection  string    `json:"connection"`
+	Type        string    `json:"type"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	MaxBytesIn  int64     `json:"max_bytes_in,omitempty"`
+	MaxBytesOut int64     `json:"max_bytes_out,omitempty"`
+}
+
+// GetActiveConnectionDetails returns the active connections with their byte usage, oldest first
+func (cm *ConnectionManager) GetActiveConnectionDetails() []ConnectionUsage {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	details := make([]ConnectionUsage, 0, len(cm.connections))
+	for _, conn := range cm.connections {
+		details = append(details, ConnectionUsage{
+			ID:          conn.ID,
+			Username:    conn.Username,
+			Connection:  conn.Config.Name,
+			Type:        conn.Config.Type,
+			CreatedAt:   conn.CreatedAt,
+			ExpiresAt:   conn.ExpiresAt(),
+			BytesIn:     conn.BytesIn(),
+			BytesOut:    conn.BytesOut(),
+			MaxBytesIn:  conn.MaxBytesIn,
+			MaxBytesOut: conn.MaxBytesOut,
+		})
+	}
+
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].CreatedAt.Before(details[j].CreatedAt)
+	})
+	return details
+}
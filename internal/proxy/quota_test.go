@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestConnection_ByteQuotas(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	conn := &Connection{
+		ID:           "conn-1",
+		Username:     "alice",
+		Config:       &config.ConnectionConfig{Name: "redis", Type: "tcp"},
+		MaxBytesOut:  100,
+		auditLogPath: logPath,
+	}
+
+	// Both directions are charged concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); _ = conn.AddBytesIn(50) }()
+		go func() { defer wg.Done(); _ = conn.AddBytesOut(10) }()
+	}
+	wg.Wait()
+
+	if conn.BytesIn() != 500 || conn.BytesOut() != 100 {
+		t.Fatalf("usage = %d in / %d out, want 500 / 100", conn.BytesIn(), conn.BytesOut())
+	}
+	if conn.QuotaExceeded() {
+		t.Fatal("QuotaExceeded() = true at exactly the limit")
+	}
+
+	if err := conn.AddBytesOut(1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("AddBytesOut() over quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := conn.AddBytesOut(1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("AddBytesOut() after quota error = %v, want ErrQuotaExceeded", err)
+	}
+	if conn.BytesOut() != 100 {
+		t.Errorf("BytesOut() = %d, want rejected bytes not counted", conn.BytesOut())
+	}
+	if err := conn.AddBytesIn(1000); err != nil {
+		t.Errorf("AddBytesIn() without max_bytes_in error = %v", err)
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "quota_exceeded"})
+	if len(entries) != 1 {
+		t.Fatalf("quota_exceeded entries = %d, want 1", len(entries))
+	}
+	if entries[0].Metadata["direction"] != "out" {
+		t.Errorf("quota_exceeded direction = %v, want out", entries[0].Metadata["direction"])
+	}
+}
+
+func TestTrackActivity_ByteQuota(t *testing.T) {
+	defer audit.Close()
+	conn := &Connection{
+		Config:       &config.ConnectionConfig{Name: "pg", Type: "postgres"},
+		MaxBytesIn:   6,
+		auditLogPath: filepath.Join(t.TempDir(), "audit.log"),
+	}
+
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	tracked := TrackActivity(server, conn)
+
+	go func() {
+		_, _ = client.Write([]byte("ping"))
+		_, _ = client.Write([]byte("ping"))
+	}()
+
+	buf := make([]byte, 4)
+	if _, err := tracked.Read(buf); err != nil {
+		t.Fatalf("first Read() error = %v", err)
+	}
+	if n, err := tracked.Read(buf); !errors.Is(err, ErrQuotaExceeded) || n != 0 {
+		t.Fatalf("second Read() = %d, %v, want 0, ErrQuotaExceeded", n, err)
+	}
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("client stream still open after quota exceeded")
+	}
+}
+
+func TestConnectionManager_ByteQuotaDefaults(t *testing.T) {
+	cm := NewConnectionManager(time.Hour)
+	defer cm.CloseAll()
+	cm.SetDefaultByteQuotas(1000, 2000)
+
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	ownID, _, err := cm.CreateConnection("alice", &config.ConnectionConfig{Name: "own", Type: "tcp", Host: "localhost", Port: 6379, MaxBytesOut: 50}, time.Hour, nil, logPath, nil)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	defaultID, _, err := cm.CreateConnection("bob", &config.ConnectionConfig{Name: "default", Type: "tcp", Host: "localhost", Port: 6379}, time.Hour, nil, logPath, nil)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+
+	own, _ := cm.GetConnection(ownID)
+	if own.MaxBytesIn != 1000 || own.MaxBytesOut != 50 {
+		t.Errorf("own quotas = %d/%d, want server default in and configured out (1000/50)", own.MaxBytesIn, own.MaxBytesOut)
+	}
+	_ = own.AddBytesIn(10)
+
+	details := cm.GetActiveConnectionDetails()
+	if len(details) != 2 {
+		t.Fatalf("GetActiveConnectionDetails() returned %d connections, want 2", len(details))
+	}
+	for _, d := range details {
+		switch d.ID {
+		case ownID:
+			if d.BytesIn != 10 || d.MaxBytesOut != 50 || d.Connection != "own" {
+				t.Errorf("own usage = %+v", d)
+			}
+		case defaultID:
+			if d.MaxBytesIn != 1000 || d.MaxBytesOut != 2000 || d.Username != "bob" {
+				t.Errorf("default usage = %+v", d)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+)
+
+// RequestTooLargeError reports a query, command or HTTP request larger than the
+// connection's max_request_bytes
+type RequestTooLargeError struct {
+	Size  int64 // Bytes in the request; a lower bound when AtLeast is set
+	Limit int64
+	// AtLeast means the request was cut off once over the limit, so its full size is unknown
+	AtLeast bool
+}
+
+func (e *RequestTooLargeError) Error() string {
+	if e.AtLeast {
+		return fmt.Sprintf("request too large: at least %d bytes, limit is %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("request too large: %d bytes, limit is %d bytes", e.Size, e.Limit)
+}
+
+// ReadAllLimited reads r to the end like io.ReadAll, but stops with a
+// *RequestTooLargeError once more than limit bytes arrive (limit 0 = unlimited).
+// size is the request's declared size if known in advance (e.g. Content-Length), or -1.
+func ReadAllLimited(r io.Reader, size, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	if size > limit {
+		return nil, &RequestTooLargeError{Size: size, Limit: limit}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &RequestTooLargeError{Size: int64(len(data)), Limit: limit, AtLeast: true}
+	}
+	return data, nil
+}
+
+// LogRequestTooLarge audits a request rejected for exceeding max_request_bytes
+func LogRequestTooLarge(auditLogPath, username, connectionName, connectionID, protocol string, tooLarge *RequestTooLargeError, metadata map[string]interface{}) {
+	entry := map[string]interface{}{
+		"connection_id": connectionID,
+		"protocol":      protocol,
+		"size":          tooLarge.Size,
+		"limit":         tooLarge.Limit,
+	}
+	if tooLarge.AtLeast {
+		entry["size_at_least"] = true
+	}
+	for key, value := range metadata {
+		entry[key] = value
+	}
+	_ = audit.Log(auditLogPath, username, "request_too_large", connectionName, entry)
+}
+
+// WriteRequestTooLarge answers an oversized HTTP request with 413; the connection is
+// closed afterwards as the rest of the request was never read
+func WriteRequestTooLarge(w http.ResponseWriter, tooLarge *RequestTooLargeError) {
+	body := fmt.Sprintf(`{"error":"Request too large","message":%q}`, tooLarge.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = io.WriteString(w, body)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+func TestReadAllLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		size    int64
+		limit   int64
+		wantErr string
+	}{
+		{"unlimited", strings.Repeat("x", 100), -1, 0, ""},
+		{"at the limit", "0123456789", -1, 10, ""},
+		{"declared size over the limit", "0123456789x", 11, 10, "request too large: 11 bytes, limit is 10 bytes"},
+		{"unknown size over the limit", strings.Repeat("x", 100), -1, 10, "request too large: at least 11 bytes, limit is 10 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ReadAllLimited(iotest.OneByteReader(strings.NewReader(tt.data)), tt.size, tt.limit)
+			if tt.wantErr == "" {
+				if err != nil || string(data) != tt.data {
+					t.Fatalf("ReadAllLimited() = %q, %v, want all data", data, err)
+				}
+				return
+			}
+			var tooLarge *RequestTooLargeError
+			if !errors.As(err, &tooLarge) || err.Error() != tt.wantErr {
+				t.Fatalf("ReadAllLimited() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPProxy_HandleRequest_TooLarge(t *testing.T) {
+	auditLog := t.TempDir() + "/audit.log"
+	cfg := &config.ConnectionConfig{Name: "test-api", Type: "http", Host: "localhost", Port: 1, Scheme: "http"}
+	proxy := NewHTTPProxyWithWhitelist(cfg, nil, auditLog, "testuser", "conn-123")
+	proxy.SetMaxRequestBytes(64)
+
+	raw := "POST /upload HTTP/1.1\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("x", 100)
+	req := httptest.NewRequest("POST", "/proxy/conn-123", bytes.NewBufferString(raw))
+	w := httptest.NewRecorder()
+	err := proxy.HandleRequest(w, req)
+
+	var tooLarge *RequestTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != int64(len(raw)) || tooLarge.Limit != 64 {
+		t.Fatalf("HandleRequest() error = %v, want RequestTooLargeError with the request size", err)
+	}
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "limit is 64 bytes") {
+		t.Errorf("response = %d %s, want 413 with the limit", w.Code, w.Body.String())
+	}
+
+	content, _ := os.ReadFile(auditLog)
+	if !strings.Contains(string(content), `"action":"request_too_large"`) || !strings.Contains(string(content), `"limit":64`) {
+		t.Errorf("audit log missing request_too_large: %s", content)
+	}
+}
@@ -0,0 +1,470 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshBackendTimeout bounds dialing and authenticating to the backend SSH server
+const sshBackendTimeout = 10 * time.Second
+
+// ephemeralHostKey is the host key presented to clients by connections without
+// ssh_host_key. It lives for the process, so clients see a new key after a restart.
+var ephemeralHostKey struct {
+	once   sync.Once
+	signer ssh.Signer
+	err    error
+}
+
+// SSHProxy proxies SSH sessions with request-level whitelisting.
+// It terminates the client's SSH connection (the tunnel already carries the
+// user's JWT identity, so clients authenticate with any method) and opens its own
+// session to the backend with the connection's backend credentials. Only session
+// channels are allowed; each exec, shell and subsystem request is checked against
+// the whitelist as "exec <command>", "shell" or "subsystem <name>", e.g.
+// "exec uptime" or "subsystem sftp".
+type SSHProxy struct {
+	config       *config.ConnectionConfig
+	whitelist    []string
+	auditLogPath string
+	username     string
+	connectionID string
+	hostKey      ssh.Signer
+
+	mu          sync.Mutex
+	backendAddr string // Resolved backend address of the latest session, for audit records
+
+	whitelistSource WhitelistSource // Resolves time-scoped whitelists per request (optional)
+}
+
+// NewSSHProxy creates an SSH proxy with whitelist support
+func NewSSHProxy(cfg *config.ConnectionConfig, whitelist []string, auditLogPath, username, connectionID string) (*SSHProxy, error) {
+	hostKey, err := loadSSHHostKey(cfg.SSHHostKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHProxy{
+		config:       cfg,
+		whitelist:    whitelist,
+		auditLogPath: auditLogPath,
+		username:     username,
+		connectionID: connectionID,
+		hostKey:      hostKey,
+	}, nil
+}
+
+// loadSSHHostKey reads the proxy's host key, or returns the process-wide ephemeral key if path is empty
+func loadSSHHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		ephemeralHostKey.once.Do(func() {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				ephemeralHostKey.err = fmt.Errorf("failed to generate ssh host key: %w", err)
+				return
+			}
+			ephemeralHostKey.signer, ephemeralHostKey.err = ssh.NewSignerFromKey(key)
+		})
+		return ephemeralHostKey.signer, ephemeralHostKey.err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh host key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh host key: %w", err)
+	}
+	return signer, nil
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per request instead of using a fixed list
+func (p *SSHProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next request
+func (p *SSHProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// HandleRequest is not supported: SSH is served over the proxy stream with HandleConnection
+func (p *SSHProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
+	return fmt.Errorf("ssh connections are served over the proxy stream")
+}
+
+// Close releases resources held by the proxy
+func (p *SSHProxy) Close() error {
+	return nil
+}
+
+// BackendAddr returns the resolved backend address of the latest session, or "" before it is known
+func (p *SSHProxy) BackendAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.backendAddr
+}
+
+// HandleConnection proxies one client SSH connection (a tunnel stream) until either side closes
+func (p *SSHProxy) HandleConnection(clientConn net.Conn) error {
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(p.hostKey)
+
+	serverConn, clientChans, clientReqs, err := ssh.NewServerConn(clientConn, serverConfig)
+	if err != nil {
+		return fmt.Errorf("ssh handshake failed: %w", err)
+	}
+	defer func() { _ = serverConn.Close() }()
+
+	backend, err := p.dialBackend()
+	if err != nil {
+		_ = audit.Log(p.auditLogPath, p.username, "ssh_backend_auth_failed", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"error":         err.Error(),
+		})
+		return err
+	}
+	defer func() { _ = backend.Close() }()
+
+	// Global requests (e.g. remote port forwarding) are never forwarded
+	go ssh.DiscardRequests(clientReqs)
+
+	// The backend closing ends the client connection too
+	go func() {
+		_ = backend.Wait()
+		_ = serverConn.Close()
+	}()
+
+	var sessions sync.WaitGroup
+	for newChannel := range clientChans {
+		if newChannel.ChannelType() != "session" {
+			_ = audit.Log(p.auditLogPath, p.username, "ssh_channel_rejected", p.config.Name, map[string]interface{}{
+				"connection_id": p.connectionID,
+				"channel_type":  newChannel.ChannelType(),
+				"backend_addr":  p.BackendAddr(),
+			})
+			p.logDecision("channel "+newChannel.ChannelType(), audit.DecisionDeny, "only session channels are allowed")
+			_ = newChannel.Reject(ssh.Prohibited, "only session channels are allowed")
+			continue
+		}
+
+		sessions.Add(1)
+		go func(newChannel ssh.NewChannel) {
+			defer sessions.Done()
+			p.proxySession(newChannel, backend)
+		}(newChannel)
+	}
+	sessions.Wait()
+	return nil
+}
+
+// dialBackend opens an authenticated SSH connection to the backend
+func (p *SSHProxy) dialBackend() (*ssh.Client, error) {
+	conn, selection, err := DialBackendSelection(p.config, sshBackendTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to backend: %w", err)
+	}
+	addr := ResolvedBackendAddr(conn)
+	p.mu.Lock()
+	p.backendAddr = addr
+	p.mu.Unlock()
+	LogBackendSelection(p.auditLogPath, p.username, p.config.Name, p.connectionID, selection)
+
+	clientConfig, err := p.backendClientConfig()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(sshBackendTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("backend authentication failed: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// backendClientConfig builds the backend login from the connection's backend credentials
+func (p *SSHProxy) backendClientConfig() (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if p.config.SSHPrivateKey != "" {
+		data, err := os.ReadFile(p.config.SSHPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if p.config.BackendPassword != "" {
+		auth = append(auth, ssh.Password(p.config.BackendPassword))
+	}
+
+	hostKeyCallback, err := p.backendHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            p.config.BackendUsername,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshBackendTimeout,
+	}, nil
+}
+
+// backendHostKeyCallback pins the backend host key to ssh_backend_host_key; without
+// one any key is accepted and its fingerprint is audited
+func (p *SSHProxy) backendHostKeyCallback() (ssh.HostKeyCallback, error) {
+	if p.config.SSHBackendHostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(p.config.SSHBackendHostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh_backend_host_key: %w", err)
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		_ = audit.Log(p.auditLogPath, p.username, "ssh_backend_host_key_unverified", p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"fingerprint":   ssh.FingerprintSHA256(key),
+			"backend_addr":  remote.String(),
+		})
+		return nil
+	}, nil
+}
+
+// validateSSHBackend logs in to the backend over conn with the connection's backend credentials
+func validateSSHBackend(connConfig *config.ConnectionConfig, conn net.Conn) error {
+	clientConfig, err := (&SSHProxy{config: connConfig}).backendClientConfig()
+	if err != nil {
+		return err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(backendValidationTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, ResolvedBackendAddr(conn), clientConfig)
+	if err != nil {
+		return err
+	}
+	_ = ssh.NewClient(sshConn, chans, reqs)
+	return sshConn.Close()
+}
+
+// proxySession relays one session channel, gating its exec, shell and subsystem requests
+func (p *SSHProxy) proxySession(newChannel ssh.NewChannel, backend *ssh.Client) {
+	backendChannel, backendReqs, err := backend.OpenChannel("session", newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = newChannel.Reject(ssh.ConnectionFailed, "backend session could not be opened")
+		}
+		return
+	}
+	defer func() { _ = backendChannel.Close() }()
+
+	_ = audit.Log(p.auditLogPath, p.username, "ssh_channel_open", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"channel_type":  "session",
+		"backend_addr":  p.BackendAddr(),
+	})
+
+	clientChannel, clientReqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = clientChannel.Close() }()
+
+	var bytesIn, bytesOut atomic.Int64
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		n, _ := io.Copy(backendChannel, clientChannel)
+		bytesIn.Add(n)
+		_ = backendChannel.CloseWrite()
+	}()
+	go func() {
+		defer output.Done()
+		n, _ := io.Copy(clientChannel, backendChannel)
+		bytesOut.Add(n)
+	}()
+	go func() {
+		defer output.Done()
+		n, _ := io.Copy(clientChannel.Stderr(), backendChannel.Stderr())
+		bytesOut.Add(n)
+	}()
+
+	// Backend requests (exit-status, exit-signal, ...) go to the client once its output is flushed
+	backendDone := make(chan struct{})
+	go func() {
+		defer close(backendDone)
+		for req := range backendReqs {
+			if req.Type == "exit-status" || req.Type == "exit-signal" {
+				output.Wait()
+			}
+			ok, _ := clientChannel.SendRequest(req.Type, req.WantReply, req.Payload)
+			if req.WantReply {
+				_ = req.Reply(ok, nil)
+			}
+		}
+		output.Wait()
+		_ = clientChannel.CloseWrite()
+		_ = clientChannel.Close()
+	}()
+
+	for req := range clientReqs {
+		p.handleClientRequest(req, backendChannel)
+	}
+	_ = backendChannel.Close()
+	<-backendDone
+
+	_ = audit.Log(p.auditLogPath, p.username, "ssh_channel_close", p.config.Name, map[string]interface{}{
+		"connection_id": p.connectionID,
+		"channel_type":  "session",
+		"bytes_in":      bytesIn.Load(),
+		"bytes_out":     bytesOut.Load(),
+		"backend_addr":  p.BackendAddr(),
+	})
+}
+
+// handleClientRequest forwards a session request to the backend, checking
+// exec, shell and subsystem requests against the whitelist first
+func (p *SSHProxy) handleClientRequest(req *ssh.Request, backendChannel ssh.Channel) {
+	request, gated := sshRequestString(req)
+	if gated {
+		if reason := p.blockReason(request); reason != "" {
+			action := "ssh_request_blocked"
+			metadata := map[string]interface{}{
+				"connection_id": p.connectionID,
+				"request":       request,
+				"reason":        reason,
+				"backend_addr":  p.BackendAddr(),
+			}
+			if reason == "outside time window" {
+				metadata["time_window"] = p.excludedWindow(request)
+			}
+			if pattern, blacklisted := blacklistMatch(p.whitelistSource, request); blacklisted && reason == "blacklist_block" {
+				action = "blacklist_block"
+				metadata["protocol"] = "ssh"
+				metadata["pattern"] = pattern
+			}
+			_ = audit.Log(p.auditLogPath, p.username, action, p.config.Name, metadata)
+			p.logDecision(request, audit.DecisionDeny, reason)
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+			return
+		}
+
+		_ = audit.Log(p.auditLogPath, p.username, "ssh_"+req.Type, p.config.Name, map[string]interface{}{
+			"connection_id": p.connectionID,
+			"request":       request,
+			"backend_addr":  p.BackendAddr(),
+		})
+		p.logDecision(request, audit.DecisionAllow, whitelistAllowReason(p.whitelistSource, p.currentWhitelist(), request))
+	}
+
+	ok, err := backendChannel.SendRequest(req.Type, req.WantReply, req.Payload)
+	if req.WantReply {
+		_ = req.Reply(ok && err == nil, nil)
+	}
+}
+
+// sshRequestString returns the string an exec, shell or subsystem request is
+// whitelisted as; other requests (pty-req, env, window-change, ...) are not gated
+func sshRequestString(req *ssh.Request) (string, bool) {
+	switch req.Type {
+	case "shell":
+		return "shell", true
+	case "exec", "subsystem":
+		var payload struct{ Value string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			// Malformed requests are gated as empty so a non-empty whitelist denies them
+			return req.Type + " ", true
+		}
+		return req.Type + " " + payload.Value, true
+	}
+	return "", false
+}
+
+// blockReason returns why a request is blocked, or "" when it may be forwarded
+func (p *SSHProxy) blockReason(request string) string {
+	if !p.isRequestAllowed(request) {
+		if window := p.excludedWindow(request); window != "" {
+			return "outside time window"
+		}
+		return "does not match whitelist"
+	}
+	if _, blacklisted := blacklistMatch(p.whitelistSource, request); blacklisted {
+		return "blacklist_block"
+	}
+	return ""
+}
+
+// excludedWindow returns the time window that excluded a blocked request, if any
+func (p *SSHProxy) excludedWindow(request string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(request)
+}
+
+// isRequestAllowed checks a request against the whitelist
+func (p *SSHProxy) isRequestAllowed(request string) bool {
+	whitelist := p.currentWhitelist()
+	if len(whitelist) == 0 {
+		return true // No whitelist means everything is allowed
+	}
+
+	request = strings.TrimSpace(request)
+	for _, pattern := range whitelist {
+		matched, err := authorization.MatchPattern(pattern, request)
+		if err != nil {
+			_ = audit.Log(p.auditLogPath, p.username, "ssh_whitelist_error", p.config.Name, map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// logDecision records a per-request whitelist decision in the decision log
+func (p *SSHProxy) logDecision(request, decision, reason string) {
+	_ = audit.LogDecision(audit.Decision{
+		Subject:      p.username,
+		Action:       "ssh_request",
+		Resource:     p.config.Name,
+		Request:      request,
+		Decision:     decision,
+		Policy:       "whitelist",
+		Reason:       reason,
+		ConnectionID: p.connectionID,
+	})
+}
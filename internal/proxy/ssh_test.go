@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSHBackend is an SSH server that answers exec requests with "ran: <command>"
+type fakeSSHBackend struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeSSHBackend(t *testing.T, password string) *fakeSSHBackend {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	b := &fakeSSHBackend{listener: listener, hostKey: signer}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if meta.User() == "deploy" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn, serverConfig)
+		}
+	}()
+	return b
+}
+
+func (b *fakeSSHBackend) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer func() { _ = channel.Close() }()
+			for req := range requests {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Value string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				b.mu.Lock()
+				b.commands = append(b.commands, payload.Value)
+				b.mu.Unlock()
+
+				_ = req.Reply(true, nil)
+				_, _ = channel.Write([]byte("ran: " + payload.Value + "\n"))
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+func (b *fakeSSHBackend) port() int {
+	return b.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (b *fakeSSHBackend) receivedCommands() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.commands...)
+}
+
+// dialSSHProxy serves one connection with the proxy and returns an SSH client connected to it
+// (net.Pipe can't be used: both SSH peers write their version line before reading)
+func dialSSHProxy(t *testing.T, p *SSHProxy) *ssh.Client {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		if proxySide, err := listener.Accept(); err == nil {
+			_ = p.HandleConnection(proxySide)
+		}
+	}()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	conn, chans, reqs, err := ssh.NewClientConn(clientSide, "proxy", &ssh.ClientConfig{
+		User:            "alice",
+		HostKeyCallback: ssh.FixedHostKey(p.hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatalf("NewClientConn() error = %v", err)
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestSSHProxy_ExecWhitelist(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	backend := newFakeSSHBackend(t, "s3cret")
+	cfg := &config.ConnectionConfig{
+		Name:              "jump",
+		Type:              "ssh",
+		Host:              "127.0.0.1",
+		Port:              backend.port(),
+		BackendUsername:   "deploy",
+		BackendPassword:   "s3cret",
+		SSHBackendHostKey: string(ssh.MarshalAuthorizedKey(backend.hostKey.PublicKey())),
+	}
+	p, err := NewSSHProxy(cfg, []string{`^exec (uptime|df -h)$`}, logPath, "alice", "conn-1")
+	if err != nil {
+		t.Fatalf("NewSSHProxy() error = %v", err)
+	}
+	client := dialSSHProxy(t, p)
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	output, err := session.Output("uptime")
+	if err != nil {
+		t.Fatalf("Output(uptime) error = %v", err)
+	}
+	if string(output) != "ran: uptime\n" {
+		t.Errorf("Output(uptime) = %q, want backend output", output)
+	}
+
+	session, err = client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	if err := session.Run("rm -rf /"); err == nil {
+		t.Error("Run(rm -rf /) succeeded, want the exec request rejected")
+	}
+	_ = session.Close()
+
+	if commands := backend.receivedCommands(); len(commands) != 1 || commands[0] != "uptime" {
+		t.Errorf("backend commands = %v, want only uptime", commands)
+	}
+
+	execs, _ := audit.Query(logPath, audit.Filter{Action: "ssh_exec"})
+	if len(execs) != 1 || execs[0].Metadata["request"] != "exec uptime" {
+		t.Errorf("ssh_exec entries = %+v, want exec uptime", execs)
+	}
+	blocked, _ := audit.Query(logPath, audit.Filter{Action: "ssh_request_blocked"})
+	if len(blocked) != 1 || blocked[0].Metadata["request"] != "exec rm -rf /" {
+		t.Errorf("ssh_request_blocked entries = %+v, want exec rm -rf /", blocked)
+	}
+	opened, _ := audit.Query(logPath, audit.Filter{Action: "ssh_channel_open"})
+	if len(opened) != 2 {
+		t.Errorf("ssh_channel_open entries = %d, want 2", len(opened))
+	}
+}
+
+func TestSSHProxy_RejectsPortForwarding(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	backend := newFakeSSHBackend(t, "s3cret")
+	cfg := &config.ConnectionConfig{
+		Name:            "jump",
+		Type:            "ssh",
+		Host:            "127.0.0.1",
+		Port:            backend.port(),
+		BackendUsername: "deploy",
+		BackendPassword: "s3cret",
+	}
+	p, err := NewSSHProxy(cfg, nil, logPath, "alice", "conn-1")
+	if err != nil {
+		t.Fatalf("NewSSHProxy() error = %v", err)
+	}
+	client := dialSSHProxy(t, p)
+
+	if _, err := client.Dial("tcp", "10.0.0.1:5432"); err == nil || !strings.Contains(err.Error(), "only session channels") {
+		t.Errorf("Dial() through proxy error = %v, want direct-tcpip rejected", err)
+	}
+
+	rejected, _ := audit.Query(logPath, audit.Filter{Action: "ssh_channel_rejected"})
+	if len(rejected) != 1 || rejected[0].Metadata["channel_type"] != "direct-tcpip" {
+		t.Errorf("ssh_channel_rejected entries = %+v, want direct-tcpip", rejected)
+	}
+	unverified, _ := audit.Query(logPath, audit.Filter{Action: "ssh_backend_host_key_unverified"})
+	if len(unverified) != 1 || unverified[0].Metadata["fingerprint"] != ssh.FingerprintSHA256(backend.hostKey.PublicKey()) {
+		t.Errorf("ssh_backend_host_key_unverified entries = %+v, want the backend fingerprint", unverified)
+	}
+}
+
+func TestSSHProxy_BackendAuthFailure(t *testing.T) {
+	backend := newFakeSSHBackend(t, "s3cret")
+	cfg := &config.ConnectionConfig{
+		Name:            "jump",
+		Type:            "ssh",
+		Host:            "127.0.0.1",
+		Port:            backend.port(),
+		BackendUsername: "deploy",
+		BackendPassword: "wrong",
+	}
+	if err := ValidateBackend(cfg); err == nil {
+		t.Fatal("ValidateBackend() with a wrong password succeeded")
+	}
+	cfg.BackendPassword = "s3cret"
+	if err := ValidateBackend(cfg); err != nil {
+		t.Errorf("ValidateBackend() error = %v", err)
+	}
+}
@@ -1,17 +1,19 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"time"
 
 	"github.com/davidcohan/port-authorizing/internal/config"
 )
 
 // TCPProxy handles raw TCP proxying
 type TCPProxy struct {
-	config *config.ConnectionConfig
+	config          *config.ConnectionConfig
+	maxRequestBytes int64 // Largest request body accepted (0 = unlimited)
 }
 
 // NewTCPProxy creates a new TCP proxy
@@ -21,24 +23,32 @@ func NewTCPProxy(config *config.ConnectionConfig) *TCPProxy {
 	}
 }
 
+// SetMaxRequestBytes sets the largest request body the proxy buffers (0 = unlimited)
+func (p *TCPProxy) SetMaxRequestBytes(limit int64) {
+	p.maxRequestBytes = limit
+}
+
 // HandleRequest handles TCP proxy requests
 // Note: This is simplified for HTTP-based API. In production:
 // 1. The CLI would establish a TCP connection
 // 2. This would proxy raw TCP data bidirectionally
 func (p *TCPProxy) HandleRequest(w http.ResponseWriter, r *http.Request) error {
-	// Connect to target
-	targetAddr := fmt.Sprintf("%s:%d", p.config.Host, p.config.Port)
-	conn, err := net.Dial("tcp", targetAddr)
+	// Read request body; an oversized one fails with *RequestTooLargeError
+	body, err := ReadAllLimited(r.Body, r.ContentLength, p.maxRequestBytes)
+	var tooLarge *RequestTooLargeError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to connect to target: %w", err)
+		return fmt.Errorf("failed to read request body: %w", err)
 	}
-	defer func() { _ = conn.Close() }()
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	// Connect to target
+	conn, err := DialBackend(p.config, 10*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to read request body: %w", err)
+		return fmt.Errorf("failed to connect to target: %w", err)
 	}
+	defer func() { _ = conn.Close() }()
 
 	// Send to target
 	if _, err := conn.Write(body); err != nil {
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// Backend validation errors returned by ValidateBackend
+var (
+	ErrBackendUnreachable = errors.New("backend unreachable")
+	ErrBackendAuthFailed  = errors.New("backend auth failed")
+	ErrBackendTLS         = errors.New("backend tls error")
+)
+
+// backendValidationTimeout bounds the whole reachability + auth check
+const backendValidationTimeout = 5 * time.Second
+
+// ValidateBackend checks that a connection's backend is reachable and, for
+// postgres, mongodb and ssh, that the configured backend credentials are accepted.
+// Errors wrap ErrBackendUnreachable, ErrBackendAuthFailed or ErrBackendTLS.
+func ValidateBackend(connConfig *config.ConnectionConfig) error {
+	_, err := validateBackend(connConfig)
+	return err
+}
+
+// validateBackend is ValidateBackend that also returns the resolved backend address
+func validateBackend(connConfig *config.ConnectionConfig) (string, error) {
+	conn, err := DialBackend(connConfig, backendValidationTimeout)
+	if err != nil {
+		if errors.Is(err, ErrBackendTLS) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %v", ErrBackendUnreachable, err)
+	}
+	defer func() { _ = conn.Close() }()
+	addr := ResolvedBackendAddr(conn)
+
+	if connConfig.Type == "mongodb" {
+		if err := NewMongoProxy(connConfig, nil, "", "", "").authenticateBackend(conn); err != nil {
+			return addr, fmt.Errorf("%w: %v", ErrBackendAuthFailed, err)
+		}
+		return addr, nil
+	}
+	if connConfig.Type == "ssh" {
+		if err := validateSSHBackend(connConfig, conn); err != nil {
+			return addr, fmt.Errorf("%w: %v", ErrBackendAuthFailed, err)
+		}
+		return addr, nil
+	}
+	if connConfig.Type != "postgres" {
+		return addr, nil
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(backendValidationTimeout))
+
+	p := NewPostgresAuthProxy(connConfig, "", "", "", nil, nil)
+	database := connConfig.BackendDatabase
+	if database == "" {
+		database = connConfig.Metadata["database"]
+	}
+
+	if err := p.sendBackendStartup(conn, connConfig.BackendUsername, database, nil); err != nil {
+		return addr, fmt.Errorf("%w: %v", ErrBackendUnreachable, err)
+	}
+	if _, err := p.handleBackendAuth(conn, connConfig.BackendPassword); err != nil {
+		return addr, fmt.Errorf("%w: %v", ErrBackendAuthFailed, err)
+	}
+
+	// Terminate the session cleanly
+	_, _ = conn.Write(buildPGMessage('X', nil))
+	return addr, nil
+}
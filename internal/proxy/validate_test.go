@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// startFakePostgres accepts one connection, reads the startup message and replies with reply
+func startFakePostgres(t *testing.T, reply []byte) *net.TCPAddr {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		lenBuf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, lenBuf); err != nil {
+			return
+		}
+		startup := make([]byte, binary.BigEndian.Uint32(lenBuf)-4)
+		if _, err := io.ReadFull(conn, startup); err != nil {
+			return
+		}
+
+		_, _ = conn.Write(reply)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func TestValidateBackend_Postgres(t *testing.T) {
+	authOK := buildPGMessage('R', []byte{0, 0, 0, 0})
+	ready := buildPGMessage('Z', []byte{'I'})
+	authError := buildPGMessage('E', []byte("SFATAL\x00Mpassword authentication failed\x00\x00"))
+
+	tests := []struct {
+		name    string
+		reply   []byte
+		wantErr error
+	}{
+		{"auth ok", append(authOK, ready...), nil},
+		{"auth failed", authError, ErrBackendAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startFakePostgres(t, tt.reply)
+			cfg := &config.ConnectionConfig{
+				Name:            "test-db",
+				Type:            "postgres",
+				Host:            addr.IP.String(),
+				Port:            addr.Port,
+				BackendUsername: "user",
+				BackendPassword: "pass",
+				BackendDatabase: "db",
+			}
+
+			err := ValidateBackend(cfg)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("ValidateBackend() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateBackend() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBackend_Unreachable(t *testing.T) {
+	// Reserve a port and close it so nothing is listening
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().(*net.TCPAddr)
+	_ = listener.Close()
+
+	cfg := &config.ConnectionConfig{Name: "test-http", Type: "http", Host: "127.0.0.1", Port: addr.Port}
+	if err := ValidateBackend(cfg); !errors.Is(err, ErrBackendUnreachable) {
+		t.Errorf("ValidateBackend() error = %v, want %v", err, ErrBackendUnreachable)
+	}
+}
+
+func TestConnectionManager_CreateConnection_ValidateOnConnect(t *testing.T) {
+	cm := NewConnectionManager(1 * time.Hour)
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().(*net.TCPAddr)
+	_ = listener.Close()
+
+	cfg := &config.ConnectionConfig{
+		Name:              "test-tcp",
+		Type:              "tcp",
+		Host:              "127.0.0.1",
+		Port:              addr.Port,
+		ValidateOnConnect: true,
+	}
+
+	_, _, err := cm.CreateConnection("alice", cfg, time.Minute, nil, "", nil)
+	if !errors.Is(err, ErrBackendUnreachable) {
+		t.Fatalf("CreateConnection() error = %v, want %v", err, ErrBackendUnreachable)
+	}
+	if len(cm.connections) != 0 {
+		t.Errorf("expected no connection to be registered, got %d", len(cm.connections))
+	}
+}
+
+func TestConnectionManager_CreateConnection_RecordsBackendAddr(t *testing.T) {
+	cm := NewConnectionManager(1 * time.Hour)
+	defer cm.CloseAll()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+	addr := listener.Addr().(*net.TCPAddr)
+
+	cfg := &config.ConnectionConfig{
+		Name:              "test-tcp",
+		Type:              "tcp",
+		Host:              "localhost",
+		Port:              addr.Port,
+		ValidateOnConnect: true,
+	}
+
+	id, _, err := cm.CreateConnection("alice", cfg, time.Minute, nil, "", nil)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	conn, _ := cm.GetConnection(id)
+	if got := conn.BackendAddr(); got != addr.String() {
+		t.Errorf("BackendAddr() = %q, want %q", got, addr.String())
+	}
+}
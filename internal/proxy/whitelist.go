@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+)
+
+// WhitelistSource resolves the effective whitelist at request time
+// Used for time-scoped policy patterns, which change over the lifetime of a connection.
+type WhitelistSource interface {
+	// Whitelist returns the patterns in effect now
+	Whitelist() []string
+	// Blacklist returns the patterns that deny a request even when it is whitelisted
+	Blacklist() []string
+	// ExcludedWindow describes the inactive time window that would have allowed a request, or "" if none
+	ExcludedWindow(request string) string
+	// MatchedRule describes the policy and pattern that allow a request, or "" if none does
+	MatchedRule(request string) string
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per request instead of using a fixed list
+func (p *HTTPProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next request
+func (p *HTTPProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// excludedWindow returns the time window that excluded a blocked request, if any
+func (p *HTTPProxy) excludedWindow(request string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(request)
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per query instead of using a fixed list
+func (p *PostgresAuthProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next query
+func (p *PostgresAuthProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// excludedWindow returns the time window that excluded a blocked query, if any
+func (p *PostgresAuthProxy) excludedWindow(query string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(query)
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per call instead of using a fixed list
+func (p *GRPCProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next call
+func (p *GRPCProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// excludedWindow returns the time window that excluded a blocked call, if any
+func (p *GRPCProxy) excludedWindow(method string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(method)
+}
+
+// SetWhitelistSource makes the proxy resolve its whitelist per command instead of using a fixed list
+func (p *MongoProxy) SetWhitelistSource(source WhitelistSource) {
+	p.whitelistSource = source
+}
+
+// currentWhitelist returns the whitelist in effect for the next command
+func (p *MongoProxy) currentWhitelist() []string {
+	if p.whitelistSource != nil {
+		return p.whitelistSource.Whitelist()
+	}
+	return p.whitelist
+}
+
+// excludedWindow returns the time window that excluded a blocked command, if any
+func (p *MongoProxy) excludedWindow(command string) string {
+	if p.whitelistSource == nil {
+		return ""
+	}
+	return p.whitelistSource.ExcludedWindow(command)
+}
+
+// whitelistAllowReason explains an allowed request for the decision log: the policy and
+// pattern that allowed it when the source knows them, else the first matching pattern
+func whitelistAllowReason(source WhitelistSource, whitelist []string, request string) string {
+	if len(whitelist) == 0 {
+		return "no whitelist configured"
+	}
+	if source != nil {
+		if rule := source.MatchedRule(request); rule != "" {
+			return "allowed by " + rule
+		}
+	}
+	for _, pattern := range whitelist {
+		if matched, err := authorization.MatchPattern(pattern, request); err == nil && matched {
+			return fmt.Sprintf("matches whitelist pattern %q", strings.Join(authorization.PatternParts(pattern), " AND "))
+		}
+	}
+	return "matches whitelist"
+}
+
+// blacklistMatch returns the blacklist pattern from the source's policy that a request matches
+// Proxies without a source have no blacklist.
+func blacklistMatch(source WhitelistSource, request string) (string, bool) {
+	if source == nil {
+		return "", false
+	}
+	return authorization.MatchBlacklist(request, source.Blacklist())
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/audit"
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// fakeWhitelistSource returns a fixed whitelist, blacklist, excluded window and matched rule
+type fakeWhitelistSource struct {
+	whitelist []string
+	blacklist []string
+	window    string
+	rule      string
+}
+
+func (f *fakeWhitelistSource) Whitelist() []string { return f.whitelist }
+
+func (f *fakeWhitelistSource) Blacklist() []string { return f.blacklist }
+
+func (f *fakeWhitelistSource) MatchedRule(request string) string { return f.rule }
+
+func (f *fakeWhitelistSource) ExcludedWindow(request string) string {
+	if strings.HasPrefix(strings.ToUpper(request), "UPDATE") {
+		return f.window
+	}
+	return ""
+}
+
+func TestPostgresAuthProxy_WhitelistSource(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres"}
+	p := NewPostgresAuthProxy(connConfig, logPath, "alice", "conn-1", &config.Config{}, []string{".*"})
+
+	source := &fakeWhitelistSource{whitelist: []string{"^SELECT.*"}, window: "business-hours (daily 09:00-18:00 UTC)"}
+	p.SetWhitelistSource(source)
+
+	if !p.isQueryAllowed("SELECT 1") {
+		t.Error("isQueryAllowed(SELECT) = false, want true from source whitelist")
+	}
+
+	blocked, _, _, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte("UPDATE users SET a = 1"), 0)))
+	if !blocked {
+		t.Fatal("validateAndLogQuery() did not block UPDATE outside the time window")
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "postgres_query_blocked"})
+	if len(entries) != 1 {
+		t.Fatalf("postgres_query_blocked entries = %d, want 1", len(entries))
+	}
+	if entries[0].Metadata["reason"] != "outside_time_window" || entries[0].Metadata["time_window"] != source.window {
+		data, _ := json.Marshal(entries[0].Metadata)
+		t.Errorf("blocked audit metadata = %s, want time window reason", data)
+	}
+}
+
+func TestHTTPProxy_WhitelistSource(t *testing.T) {
+	p := NewHTTPProxyWithWhitelist(&config.ConnectionConfig{Name: "api", Type: "http"}, []string{"^GET .*"}, "", "alice", "conn-1")
+	if p.isRequestAllowed("POST /users") {
+		t.Fatal("isRequestAllowed(POST) = true with fixed GET whitelist")
+	}
+
+	p.SetWhitelistSource(&fakeWhitelistSource{whitelist: []string{"^POST .*"}})
+	if !p.isRequestAllowed("POST /users") {
+		t.Error("isRequestAllowed(POST) = false, want true from source whitelist")
+	}
+	if p.isRequestAllowed("GET /users") {
+		t.Error("isRequestAllowed(GET) = true, want source whitelist to replace the fixed list")
+	}
+}
+
+func TestPostgresAuthProxy_Blacklist(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	connConfig := &config.ConnectionConfig{Name: "pg", Type: "postgres"}
+	p := NewPostgresAuthProxy(connConfig, logPath, "alice", "conn-1", &config.Config{}, nil)
+	p.SetWhitelistSource(&fakeWhitelistSource{blacklist: []string{`^\s*DROP\b`}})
+
+	for _, query := range []string{"SELECT 1", "SELECT 1; SELECT 2"} {
+		if blocked, _, _, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(query), 0))); blocked {
+			t.Errorf("validateAndLogQuery(%q) blocked, want allowed with no whitelist", query)
+		}
+	}
+	for _, query := range []string{"DROP TABLE users", "SELECT 1; DROP TABLE users;"} {
+		blocked, _, message, _ := p.validateAndLogQuery(buildPGMessage('Q', append([]byte(query), 0)))
+		if !blocked || !strings.Contains(message, "blacklist") {
+			t.Errorf("validateAndLogQuery(%q) = %v, %q, want blocked by blacklist", query, blocked, message)
+		}
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "blacklist_block"})
+	if len(entries) != 2 {
+		t.Fatalf("blacklist_block entries = %d, want 2", len(entries))
+	}
+	if entries[0].Metadata["pattern"] != `^\s*DROP\b` || entries[0].Metadata["protocol"] != "postgres" {
+		data, _ := json.Marshal(entries[0].Metadata)
+		t.Errorf("blacklist_block metadata = %s, want pattern and protocol", data)
+	}
+}
+
+func TestHTTPProxy_Blacklist(t *testing.T) {
+	defer audit.Close()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+
+	p := NewHTTPProxyWithWhitelist(&config.ConnectionConfig{Name: "api", Type: "http", Host: "127.0.0.1", Port: 1}, nil, logPath, "alice", "conn-1")
+	p.SetWhitelistSource(&fakeWhitelistSource{whitelist: []string{".*"}, blacklist: []string{"^DELETE "}})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/proxy/conn-1", strings.NewReader("DELETE /users/1 HTTP/1.1\r\nHost: api\r\n\r\n"))
+	if err := p.HandleRequest(rec, req); err == nil || rec.Code != http.StatusForbidden {
+		t.Fatalf("HandleRequest(DELETE) = %v, status %d, want blacklist 403", err, rec.Code)
+	}
+
+	entries, _ := audit.Query(logPath, audit.Filter{Action: "blacklist_block"})
+	if len(entries) != 1 || entries[0].Metadata["method"] != http.MethodDelete {
+		t.Errorf("blacklist_block entries = %+v, want the DELETE request", entries)
+	}
+}
+
+func TestWhitelistAllowReason(t *testing.T) {
+	whitelist := []string{`^GET /health`, `^GET /api/.*`}
+	tests := []struct {
+		name      string
+		source    WhitelistSource
+		whitelist []string
+		want      string
+	}{
+		{"no whitelist", nil, nil, "no whitelist configured"},
+		{"first matching pattern", nil, whitelist, `matches whitelist pattern "^GET /api/.*"`},
+		{"policy rule from source", &fakeWhitelistSource{rule: `policy "api-read" pattern "^GET /api/.*"`}, whitelist, `allowed by policy "api-read" pattern "^GET /api/.*"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := whitelistAllowReason(tt.source, tt.whitelist, "GET /api/users"); got != tt.want {
+				t.Errorf("whitelistAllowReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,813 @@
+package security
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// TableAccess is one operation a query performs on a table
+type TableAccess struct {
+	Operation string `json:"operation"` // SELECT, INSERT, UPDATE, DELETE, TRUNCATE, CREATE, DROP or ALTER
+	Table     string `json:"table"`     // Lowercase, schema-qualified if the query qualified it
+}
+
+// SQLAnalysis describes the operations and tables a query touches
+type SQLAnalysis struct {
+	Accesses   []TableAccess
+	Operations []string // Distinct operations, sorted
+	Tables     []string // Distinct tables, sorted
+	HasJoin    bool     // Some statement combines tables with JOIN or a FROM list
+	Copy       []string // Directions of COPY statements (FROM, TO), sorted
+	Statements int      // Number of statements, e.g. 2 for "SELECT 1; DROP TABLE t"
+}
+
+// SQLAnalyzer extracts table accesses from PostgreSQL queries. It is not a
+// full SQL parser: it understands DML (including CTEs, joins and subqueries),
+// common table DDL, COPY and transaction/session statements, and reports an error
+// for anything else so callers can fall back to pattern matching.
+type SQLAnalyzer struct{}
+
+// NewSQLAnalyzer creates a new SQL analyzer
+func NewSQLAnalyzer() *SQLAnalyzer {
+	return &SQLAnalyzer{}
+}
+
+// utilityStatements touch no tables
+var utilityStatements = map[string]bool{
+	"begin": true, "start": true, "commit": true, "end": true, "rollback": true, "abort": true,
+	"savepoint": true, "release": true, "set": true, "show": true, "reset": true,
+	"discard": true, "deallocate": true, "listen": true, "unlisten": true,
+}
+
+// queryStarts are keywords that begin a query inside parentheses (subqueries, CTE bodies)
+var queryStarts = map[string]bool{
+	"select": true, "with": true, "values": true, "insert": true, "update": true, "delete": true, "table": true,
+}
+
+// aliasStopWords can follow a table reference but are never its alias
+var aliasStopWords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "full": true, "cross": true,
+	"natural": true, "outer": true, "on": true, "using": true, "group": true, "order": true, "having": true,
+	"limit": true, "offset": true, "union": true, "intersect": true, "except": true, "window": true,
+	"for": true, "returning": true, "set": true, "values": true, "select": true, "from": true, "into": true,
+	"fetch": true, "lateral": true, "tablesample": true, "when": true, "then": true, "do": true,
+	"default": true, "overriding": true, "partition": true, "as": true, "with": true,
+}
+
+// Analyze extracts the table accesses of every statement in query
+func (a *SQLAnalyzer) Analyze(query string) (*SQLAnalysis, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlScan{}
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && tokens[i].text != ";" {
+			continue
+		}
+		if i > start {
+			if err := s.statement(tokens[start:i]); err != nil {
+				return nil, err
+			}
+			s.statements++
+		}
+		start = i + 1
+	}
+
+	return s.result(), nil
+}
+
+// CountStatements returns the number of statements in query, ignoring semicolons
+// inside comments, string literals and dollar-quoted bodies. Unlike Analyze it
+// accepts statements the analyzer does not understand.
+func CountStatements(query string) (int, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return 0, err
+	}
+
+	count, start := 0, 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && tokens[i].text != ";" {
+			continue
+		}
+		if i > start {
+			count++
+		}
+		start = i + 1
+	}
+	return count, nil
+}
+
+// CheckTablePermissions verifies every table access in analysis is granted by permissions
+// Returns an error describing the first access that no permission allows.
+func CheckTablePermissions(analysis *SQLAnalysis, permissions []config.TablePermission) error {
+	for _, access := range analysis.Accesses {
+		allowed := false
+		for _, permission := range permissions {
+			if permissionGrants(permission, access) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s on %s is not permitted", access.Operation, access.Table)
+		}
+	}
+	return nil
+}
+
+// permissionGrants reports whether a permission covers an access
+func permissionGrants(permission config.TablePermission, access TableAccess) bool {
+	opAllowed := false
+	for _, op := range permission.Operations {
+		if op == "*" || strings.EqualFold(op, access.Operation) {
+			opAllowed = true
+			break
+		}
+	}
+	if !opAllowed {
+		return false
+	}
+
+	for _, table := range permission.Tables {
+		if tableMatches(strings.ToLower(table), access.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableMatches matches a permission table ("users", "billing.invoices", "billing.*", "*")
+// against a table name from a query. Unqualified query tables are taken to be in "public".
+func tableMatches(pattern, table string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	schema, name := "public", table
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		schema, name = table[:i], table[i+1:]
+	}
+
+	patternSchema, patternName, qualified := strings.Cut(pattern, ".")
+	if !qualified {
+		return patternSchema == name // Unqualified permission: any schema
+	}
+	if patternSchema != schema {
+		return false
+	}
+	return patternName == "*" || patternName == name
+}
+
+// sqlToken is a word (keyword or identifier, lowercase, possibly qualified) or punctuation
+type sqlToken struct {
+	text   string
+	isWord bool
+}
+
+// tokenizeSQL splits a query into words and punctuation, dropping comments,
+// string literals and numbers
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			depth := 0
+			for i < len(query) {
+				if strings.HasPrefix(query[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(query[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+		case c == '\'':
+			end, err := skipStringLiteral(query, i, false)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case (c == 'e' || c == 'E') && i+1 < len(query) && query[i+1] == '\'':
+			end, err := skipStringLiteral(query, i+1, true)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '$' && i+1 < len(query) && (query[i+1] == '$' || isIdentStart(query[i+1])):
+			end := i + 1
+			for end < len(query) && query[end] != '$' && isIdentChar(query[end]) {
+				end++
+			}
+			if end >= len(query) || query[end] != '$' {
+				tokens = append(tokens, sqlToken{text: "$"})
+				i++
+				continue
+			}
+			tag := query[i : end+1]
+			closing := strings.Index(query[end+1:], tag)
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string")
+			}
+			i = end + 1 + closing + len(tag)
+		case c == '$' || (c >= '0' && c <= '9'):
+			// Parameters ($1) and numbers
+			i++
+			for i < len(query) && (isIdentChar(query[i]) || query[i] == '.') {
+				i++
+			}
+		case isIdentStart(c) || c == '"':
+			word, end, err := readQualifiedName(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{text: word, isWord: true})
+			i = end
+		default:
+			tokens = append(tokens, sqlToken{text: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// skipStringLiteral returns the index after the literal starting at the quote at start
+func skipStringLiteral(query string, start int, backslashEscapes bool) (int, error) {
+	i := start + 1
+	for i < len(query) {
+		switch {
+		case backslashEscapes && query[i] == '\\':
+			i += 2
+		case query[i] == '\'' && i+1 < len(query) && query[i+1] == '\'':
+			i += 2
+		case query[i] == '\'':
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal")
+}
+
+// readQualifiedName reads an identifier with optional dotted parts (schema.table, "Quoted".x)
+func readQualifiedName(query string, start int) (string, int, error) {
+	var parts []string
+	i := start
+	for {
+		if i < len(query) && query[i] == '"' {
+			end := i + 1
+			var part strings.Builder
+			for {
+				if end >= len(query) {
+					return "", 0, fmt.Errorf("unterminated quoted identifier")
+				}
+				if query[end] == '"' {
+					if end+1 < len(query) && query[end+1] == '"' {
+						part.WriteByte('"')
+						end += 2
+						continue
+					}
+					break
+				}
+				part.WriteByte(query[end])
+				end++
+			}
+			parts = append(parts, strings.ToLower(part.String()))
+			i = end + 1
+		} else if i < len(query) && query[i] == '*' && len(parts) > 0 {
+			parts = append(parts, "*") // alias.* in select lists
+			i++
+		} else {
+			end := i
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			parts = append(parts, strings.ToLower(query[i:end]))
+			i = end
+		}
+
+		if i+1 < len(query) && query[i] == '.' && (isIdentStart(query[i+1]) || query[i+1] == '"' || query[i+1] == '*') {
+			i++
+			continue
+		}
+		return strings.Join(parts, "."), i, nil
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+// sqlScan accumulates table accesses across statements
+type sqlScan struct {
+	accesses   []TableAccess
+	operations map[string]bool
+	copies     map[string]bool
+	hasJoin    bool
+	statements int
+}
+
+func (s *sqlScan) add(op, table string) {
+	s.accesses = append(s.accesses, TableAccess{Operation: op, Table: table})
+	s.addOperation(op)
+}
+
+func (s *sqlScan) addOperation(op string) {
+	if s.operations == nil {
+		s.operations = make(map[string]bool)
+	}
+	s.operations[op] = true
+}
+
+func (s *sqlScan) addCopy(direction string) {
+	if s.copies == nil {
+		s.copies = make(map[string]bool)
+	}
+	s.copies[direction] = true
+}
+
+func (s *sqlScan) result() *SQLAnalysis {
+	analysis := &SQLAnalysis{Accesses: s.accesses, Operations: []string{}, Tables: []string{}, HasJoin: s.hasJoin, Statements: s.statements}
+	tables := make(map[string]bool)
+	for _, access := range s.accesses {
+		tables[access.Table] = true
+	}
+	for table := range tables {
+		analysis.Tables = append(analysis.Tables, table)
+	}
+	for op := range s.operations {
+		analysis.Operations = append(analysis.Operations, op)
+	}
+	for direction := range s.copies {
+		analysis.Copy = append(analysis.Copy, direction)
+	}
+	sort.Strings(analysis.Tables)
+	sort.Strings(analysis.Operations)
+	sort.Strings(analysis.Copy)
+	return analysis
+}
+
+// statement analyzes one statement (no trailing semicolon)
+func (s *sqlScan) statement(tokens []sqlToken) error {
+	first := 0
+	for first < len(tokens) && tokens[first].text == "(" {
+		first++
+	}
+	if first == len(tokens) || !tokens[first].isWord {
+		return fmt.Errorf("unrecognized statement")
+	}
+
+	keyword := tokens[first].text
+	switch {
+	case queryStarts[keyword]:
+		if keyword == "select" || keyword == "values" || keyword == "table" {
+			s.addOperation("SELECT")
+		}
+		return s.dml(tokens)
+	case keyword == "explain":
+		return s.statement(skipExplainOptions(tokens[first+1:]))
+	case keyword == "create" || keyword == "drop" || keyword == "alter" || keyword == "truncate":
+		return s.ddl(tokens[first:])
+	case keyword == "copy":
+		return s.copyStatement(tokens[first+1:])
+	case utilityStatements[keyword]:
+		return nil
+	default:
+		return fmt.Errorf("unsupported statement %s", strings.ToUpper(keyword))
+	}
+}
+
+// copyStatement extracts the table or query of COPY ... FROM/TO. COPY FROM writes
+// the table (INSERT), COPY TO reads the table or query (SELECT).
+func (s *sqlScan) copyStatement(tokens []sqlToken) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("COPY without a table")
+	}
+
+	if tokens[0].text == "(" {
+		end := matchingParen(tokens, 0)
+		if end < 0 {
+			return fmt.Errorf("unbalanced parentheses in COPY")
+		}
+		if len(tokens) == end+1 || tokens[end+1].text != "to" {
+			return fmt.Errorf("COPY (query) without TO")
+		}
+		if err := s.statement(tokens[1:end]); err != nil {
+			return err
+		}
+		s.addCopy("TO")
+		return nil
+	}
+
+	if !tokens[0].isWord {
+		return fmt.Errorf("COPY without a table")
+	}
+	table := tokens[0].text
+	rest := tokens[1:]
+	if len(rest) > 0 && rest[0].text == "(" {
+		end := matchingParen(rest, 0)
+		if end < 0 {
+			return fmt.Errorf("unbalanced parentheses in COPY")
+		}
+		rest = rest[end+1:]
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("COPY without FROM or TO")
+	}
+	switch rest[0].text {
+	case "from":
+		s.add("INSERT", table)
+		s.addCopy("FROM")
+	case "to":
+		s.add("SELECT", table)
+		s.addCopy("TO")
+	default:
+		return fmt.Errorf("COPY without FROM or TO")
+	}
+	return nil
+}
+
+// skipExplainOptions drops EXPLAIN's options, leaving the explained statement
+func skipExplainOptions(tokens []sqlToken) []sqlToken {
+	if len(tokens) > 0 && tokens[0].text == "(" {
+		if end := matchingParen(tokens, 0); end > 0 {
+			return tokens[end+1:]
+		}
+	}
+	for len(tokens) > 0 && (tokens[0].text == "analyze" || tokens[0].text == "verbose") {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
+
+// matchingParen returns the index of the ")" closing the "(" at open, or -1
+func matchingParen(tokens []sqlToken, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// sqlFrame is one parenthesis level of a statement
+type sqlFrame struct {
+	isQuery bool   // The parentheses hold a query (FROM/JOIN are table references)
+	started bool   // The first token has been seen
+	listOp  string // Operation of the FROM/USING list being read, empty outside one
+}
+
+// fromListEnds are clause keywords that end a FROM/USING list
+var fromListEnds = map[string]bool{
+	"where": true, "group": true, "having": true, "order": true, "limit": true, "offset": true,
+	"union": true, "intersect": true, "except": true, "window": true, "for": true, "fetch": true,
+	"returning": true, "set": true, "select": true, "values": true, "into": true,
+}
+
+// dml extracts table accesses from SELECT/INSERT/UPDATE/DELETE statements, including CTEs and subqueries
+func (s *sqlScan) dml(tokens []sqlToken) error {
+	cteNames := collectCTENames(tokens)
+	frames := []*sqlFrame{{isQuery: true}}
+	insertTarget := ""
+	prev := ""
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		top := frames[len(frames)-1]
+
+		if !tok.isWord {
+			switch tok.text {
+			case "(":
+				frames = append(frames, &sqlFrame{})
+			case ")":
+				if len(frames) > 1 {
+					frames = frames[:len(frames)-1]
+				}
+			case ",":
+				if top.isQuery && top.listOp != "" {
+					s.hasJoin = true
+					i = s.tableItem(tokens, i+1, top.listOp, cteNames) - 1
+				}
+			}
+			prev = tok.text
+			continue
+		}
+
+		word := tok.text
+		if !top.started {
+			top.started = true
+			if queryStarts[word] {
+				top.isQuery = true
+			}
+		}
+		if !top.isQuery {
+			prev = word
+			continue
+		}
+		if fromListEnds[word] {
+			top.listOp = ""
+		}
+
+		switch word {
+		case "from":
+			if prev == "distinct" { // IS [NOT] DISTINCT FROM
+				break
+			}
+			top.listOp = "SELECT"
+			if prev == "delete" {
+				top.listOp = "DELETE"
+			}
+			i = s.tableItem(tokens, i+1, top.listOp, cteNames) - 1
+			prev = ""
+			continue
+		case "join":
+			s.hasJoin = true
+			i = s.tableItem(tokens, i+1, "SELECT", cteNames) - 1
+			prev = ""
+			continue
+		case "using":
+			if i+1 < len(tokens) && tokens[i+1].text == "(" {
+				break // JOIN ... USING (columns)
+			}
+			top.listOp = "SELECT"
+			i = s.tableItem(tokens, i+1, top.listOp, cteNames) - 1
+			prev = ""
+			continue
+		case "into":
+			switch prev {
+			case "insert":
+				if table, next, ok := tableRef(tokens, i+1, true); ok {
+					insertTarget = table
+					s.addTable("INSERT", table, cteNames)
+					i = next - 1
+				}
+			case "merge":
+				return fmt.Errorf("unsupported statement MERGE")
+			default:
+				// SELECT ... INTO new_table creates a table
+				if table, next, ok := tableRef(tokens, i+1, false); ok {
+					s.addTable("CREATE", table, cteNames)
+					i = next - 1
+				}
+			}
+		case "update":
+			switch prev {
+			case "do": // INSERT ... ON CONFLICT DO UPDATE
+				if insertTarget != "" {
+					s.addTable("UPDATE", insertTarget, cteNames)
+				}
+			case "for", "key", "on": // Row locking clauses and DDL actions
+			default:
+				if table, next, ok := tableRef(tokens, i+1, false); ok {
+					s.addTable("UPDATE", table, cteNames)
+					i = next - 1
+				}
+			}
+		case "table":
+			if prev == "" || prev == "(" {
+				if table, next, ok := tableRef(tokens, i+1, false); ok {
+					s.addTable("SELECT", table, cteNames)
+					i = next - 1
+				}
+			}
+		case "merge":
+			return fmt.Errorf("unsupported statement MERGE")
+		}
+		prev = word
+	}
+	return nil
+}
+
+// tableItem records the FROM/JOIN/USING item at tokens[i] and returns the index
+// of the first token after it. A parenthesized item is left for the main loop to walk.
+func (s *sqlScan) tableItem(tokens []sqlToken, i int, op string, cteNames map[string]bool) int {
+	for i < len(tokens) && (tokens[i].text == "only" || tokens[i].text == "lateral") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].text == "(" {
+		return i
+	}
+
+	table, next, ok := tableRef(tokens, i, false)
+	if !ok {
+		if next >= len(tokens) || tokens[next].text != "(" {
+			return i
+		}
+		// Function in FROM: skip its arguments, then the alias
+		if end := matchingParen(tokens, next); end > 0 {
+			next = end + 1
+		}
+	} else {
+		s.addTable(op, table, cteNames)
+	}
+	return skipAlias(tokens, next)
+}
+
+// tableRef reads a table name at tokens[i]. Unless columns allows a column list
+// (INSERT INTO t (a, b)), a name followed by "(" is a function call and is reported
+// as not a table, with next pointing at the "(".
+func tableRef(tokens []sqlToken, i int, columns bool) (string, int, bool) {
+	for i < len(tokens) && tokens[i].text == "only" {
+		i++
+	}
+	if i >= len(tokens) || !tokens[i].isWord || aliasStopWords[tokens[i].text] {
+		return "", i, false
+	}
+	if !columns && i+1 < len(tokens) && tokens[i+1].text == "(" {
+		return "", i + 1, false
+	}
+	next := i + 1
+	if next < len(tokens) && tokens[next].text == "*" { // Inheritance: FROM parent *
+		next++
+	}
+	return tokens[i].text, next, true
+}
+
+// skipAlias skips an optional [AS] alias [(column, ...)] at tokens[i]
+func skipAlias(tokens []sqlToken, i int) int {
+	if i < len(tokens) && tokens[i].text == "as" {
+		i++
+	}
+	if i < len(tokens) && tokens[i].isWord && !aliasStopWords[tokens[i].text] {
+		i++
+		if i < len(tokens) && tokens[i].text == "(" {
+			if end := matchingParen(tokens, i); end > 0 {
+				i = end + 1
+			}
+		}
+	}
+	return i
+}
+
+// collectCTENames finds the names defined by WITH clauses ("name AS (" or "name (cols) AS (")
+func collectCTENames(tokens []sqlToken) map[string]bool {
+	names := make(map[string]bool)
+	hasWith := false
+	for _, tok := range tokens {
+		if tok.text == "with" {
+			hasWith = true
+			break
+		}
+	}
+	if !hasWith {
+		return names
+	}
+
+	for i := 0; i+2 < len(tokens); i++ {
+		if !tokens[i].isWord {
+			continue
+		}
+		j := i + 1
+		if tokens[j].text == "(" {
+			end := matchingParen(tokens, j)
+			if end < 0 {
+				continue
+			}
+			j = end + 1
+		}
+		if j >= len(tokens) || tokens[j].text != "as" {
+			continue
+		}
+		j++
+		for j < len(tokens) && (tokens[j].text == "not" || tokens[j].text == "materialized") {
+			j++
+		}
+		if j < len(tokens) && tokens[j].text == "(" {
+			names[tokens[i].text] = true
+		}
+	}
+	return names
+}
+
+// addTable records an access unless the name refers to a CTE
+func (s *sqlScan) addTable(op, table string, cteNames map[string]bool) {
+	if cteNames[table] {
+		return
+	}
+	s.add(op, table)
+}
+
+// ddl extracts table accesses from CREATE/DROP/ALTER/TRUNCATE statements on tables, views and indexes
+func (s *sqlScan) ddl(tokens []sqlToken) error {
+	keyword := tokens[0].text
+	i := 1
+	skip := func(words ...string) {
+		for i < len(tokens) {
+			matched := false
+			for _, w := range words {
+				if tokens[i].text == w {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return
+			}
+			i++
+		}
+	}
+	names := func(op string) {
+		for i < len(tokens) && tokens[i].isWord {
+			s.add(op, strings.TrimSuffix(tokens[i].text, "*"))
+			i++
+			if i >= len(tokens) || tokens[i].text != "," {
+				return
+			}
+			i++
+			skip("only")
+		}
+	}
+
+	switch keyword {
+	case "truncate":
+		skip("table", "only")
+		names("TRUNCATE")
+		return nil
+
+	case "drop":
+		skip("materialized")
+		if i >= len(tokens) || (tokens[i].text != "table" && tokens[i].text != "view") {
+			return fmt.Errorf("unsupported statement DROP")
+		}
+		i++
+		skip("if", "exists")
+		names("DROP")
+		return nil
+
+	case "alter":
+		if i >= len(tokens) || tokens[i].text != "table" {
+			return fmt.Errorf("unsupported statement ALTER")
+		}
+		i++
+		skip("if", "exists", "only")
+		if i >= len(tokens) || !tokens[i].isWord {
+			return fmt.Errorf("ALTER TABLE without a table")
+		}
+		s.add("ALTER", tokens[i].text)
+		return nil
+
+	default: // create
+		skip("or", "replace", "global", "local", "temp", "temporary", "unlogged", "materialized", "unique")
+		if i >= len(tokens) {
+			return fmt.Errorf("unsupported statement CREATE")
+		}
+		switch tokens[i].text {
+		case "table", "view":
+			i++
+			skip("if", "not", "exists")
+			if i >= len(tokens) || !tokens[i].isWord {
+				return fmt.Errorf("CREATE without a name")
+			}
+			s.add("CREATE", tokens[i].text)
+			// CREATE TABLE ... AS SELECT / CREATE VIEW ... AS SELECT read their sources
+			return s.dml(tokens[i+1:])
+		case "index":
+			i++
+			skip("concurrently", "if", "not", "exists")
+			for i < len(tokens) && tokens[i].text != "on" {
+				i++
+			}
+			i++
+			skip("only")
+			if i >= len(tokens) || !tokens[i].isWord {
+				return fmt.Errorf("CREATE INDEX without a table")
+			}
+			s.add("CREATE", tokens[i].text)
+			return nil
+		}
+		return fmt.Errorf("unsupported statement CREATE %s", strings.ToUpper(tokens[i].text))
+	}
+}
@@ -0,0 +1,286 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// formatAccesses renders accesses as "OP table" pairs for comparison
+func formatAccesses(accesses []TableAccess) string {
+	parts := make([]string, len(accesses))
+	for i, access := range accesses {
+		parts[i] = access.Operation + " " + access.Table
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestSQLAnalyzer_Analyze(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+		wantOps string
+		join    bool
+		copy    string
+	}{
+		{
+			name:    "simple select",
+			query:   "SELECT id, name FROM users WHERE active = true",
+			want:    "SELECT users",
+			wantOps: "SELECT",
+		},
+		{
+			name:  "select with alias list and joins",
+			query: "SELECT u.name, o.total FROM public.users u JOIN orders AS o ON o.user_id = u.id, items i LEFT JOIN billing.invoices inv USING (id)",
+			want:  "SELECT public.users, SELECT orders, SELECT items, SELECT billing.invoices",
+			join:  true,
+		},
+		{
+			name:  "quoted identifiers",
+			query: `SELECT * FROM "Sales"."Orders"`,
+			want:  "SELECT sales.orders",
+		},
+		{
+			name:  "subquery in where and from",
+			query: "SELECT * FROM (SELECT id FROM accounts) a, users WHERE id IN (SELECT user_id FROM orders)",
+			want:  "SELECT accounts, SELECT users, SELECT orders",
+			join:  true,
+		},
+		{
+			name:  "functions and keywords are not tables",
+			query: "SELECT extract(year FROM created_at), trim(both ' ' FROM name) FROM users, generate_series(1, 3) g WHERE a IS DISTINCT FROM b",
+			want:  "SELECT users",
+			join:  true, // Cross join with generate_series
+		},
+		{
+			name:  "strings and comments are ignored",
+			query: "SELECT 'FROM secrets', $$DELETE FROM audit$$ /* FROM hidden */ FROM users -- JOIN passwords",
+			want:  "SELECT users",
+		},
+		{
+			name:  "cte names are not tables",
+			query: "WITH recent AS (SELECT * FROM orders WHERE created > now()) DELETE FROM archive USING recent WHERE archive.id = recent.id",
+			want:  "SELECT orders, DELETE archive",
+		},
+		{
+			name:    "insert with select",
+			query:   "INSERT INTO orders (id, total) SELECT id, total FROM staging_orders",
+			want:    "INSERT orders, SELECT staging_orders",
+			wantOps: "INSERT,SELECT",
+		},
+		{
+			name:  "insert on conflict do update",
+			query: "INSERT INTO counters (k, v) VALUES ('a', 1) ON CONFLICT (k) DO UPDATE SET v = counters.v + 1",
+			want:  "INSERT counters, UPDATE counters",
+		},
+		{
+			name:  "update with from",
+			query: "UPDATE orders o SET status = 'paid' FROM payments p WHERE p.order_id = o.id",
+			want:  "UPDATE orders, SELECT payments",
+		},
+		{
+			name:  "select for update locks rows only",
+			query: "SELECT * FROM jobs FOR UPDATE SKIP LOCKED",
+			want:  "SELECT jobs",
+		},
+		{
+			name:  "delete",
+			query: "DELETE FROM ONLY sessions WHERE expires < now()",
+			want:  "DELETE sessions",
+		},
+		{
+			name:  "multiple statements",
+			query: "BEGIN; UPDATE accounts SET balance = 0; COMMIT;",
+			want:  "UPDATE accounts",
+		},
+		{
+			name:  "select into creates a table",
+			query: "SELECT * INTO backup_users FROM users",
+			want:  "CREATE backup_users, SELECT users",
+		},
+		{
+			name:  "explain analyzes the inner statement",
+			query: "EXPLAIN (ANALYZE, FORMAT JSON) DELETE FROM users",
+			want:  "DELETE users",
+		},
+		{
+			name:  "truncate",
+			query: "TRUNCATE TABLE logs, audit.events RESTART IDENTITY",
+			want:  "TRUNCATE logs, TRUNCATE audit.events",
+		},
+		{
+			name:  "drop table",
+			query: "DROP TABLE IF EXISTS users, orders CASCADE",
+			want:  "DROP users, DROP orders",
+		},
+		{
+			name:  "alter table",
+			query: "ALTER TABLE IF EXISTS ONLY users ADD COLUMN age int",
+			want:  "ALTER users",
+		},
+		{
+			name:  "create table as select",
+			query: "CREATE TABLE IF NOT EXISTS report AS SELECT * FROM orders",
+			want:  "CREATE report, SELECT orders",
+		},
+		{
+			name:  "create index",
+			query: "CREATE UNIQUE INDEX CONCURRENTLY idx_email ON users (email)",
+			want:  "CREATE users",
+		},
+		{
+			name:    "no tables",
+			query:   "SELECT 1",
+			want:    "",
+			wantOps: "SELECT",
+		},
+		{
+			name:  "session statement",
+			query: "SET search_path TO public",
+			want:  "",
+		},
+		{
+			name:  "copy from stdin",
+			query: "COPY public.users (id, name) FROM STDIN WITH (FORMAT csv)",
+			want:  "INSERT public.users",
+			copy:  "FROM",
+		},
+		{
+			name:  "copy table to file",
+			query: "COPY orders TO '/tmp/orders.csv'",
+			want:  "SELECT orders",
+			copy:  "TO",
+		},
+		{
+			name:  "copy query to stdout",
+			query: "COPY (SELECT * FROM users JOIN orders ON orders.user_id = users.id) TO STDOUT",
+			want:  "SELECT users, SELECT orders",
+			join:  true,
+			copy:  "TO",
+		},
+		{
+			name:    "copy without direction",
+			query:   "COPY users",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported statement",
+			query:   "DO $$ BEGIN DELETE FROM users; END $$",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			query:   "SELECT 'oops FROM users",
+			wantErr: true,
+		},
+	}
+
+	analyzer := NewSQLAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Analyze() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := formatAccesses(analysis.Accesses); got != tt.want {
+				t.Errorf("Analyze() accesses = %q, want %q", got, tt.want)
+			}
+			if analysis.HasJoin != tt.join {
+				t.Errorf("Analyze() HasJoin = %v, want %v", analysis.HasJoin, tt.join)
+			}
+			if got := strings.Join(analysis.Copy, ","); got != tt.copy {
+				t.Errorf("Analyze() copy = %q, want %q", got, tt.copy)
+			}
+			if tt.wantOps != "" {
+				if got := strings.Join(analysis.Operations, ","); got != tt.wantOps {
+					t.Errorf("Analyze() operations = %q, want %q", got, tt.wantOps)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTablePermissions(t *testing.T) {
+	permissions := []config.TablePermission{
+		{Operations: []string{"SELECT"}, Tables: []string{"users", "orders"}},
+		{Operations: []string{"select", "insert"}, Tables: []string{"reporting.*"}},
+		{Operations: []string{"*"}, Tables: []string{"public.scratch"}},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "allowed select", query: "SELECT * FROM users JOIN orders ON orders.user_id = users.id"},
+		{name: "unqualified permission matches any schema", query: "SELECT * FROM archive.users"},
+		{name: "schema wildcard", query: "INSERT INTO reporting.daily SELECT * FROM orders"},
+		{name: "operation wildcard on public table", query: "DELETE FROM scratch"},
+		{name: "no tables", query: "SELECT now()"},
+		{name: "operation not granted", query: "UPDATE users SET name = 'x'", wantErr: "UPDATE on users is not permitted"},
+		{name: "table not granted", query: "SELECT * FROM users, secrets", wantErr: "SELECT on secrets is not permitted"},
+		{name: "schema wildcard does not cover other schemas", query: "SELECT * FROM billing.daily", wantErr: "SELECT on billing.daily is not permitted"},
+		{name: "qualified permission requires schema", query: "DELETE FROM other.scratch", wantErr: "DELETE on other.scratch is not permitted"},
+	}
+
+	analyzer := NewSQLAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.query)
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			err = CheckTablePermissions(analysis, permissions)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckTablePermissions() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("CheckTablePermissions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountStatements(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"single", "SELECT 1", 1},
+		{"trailing semicolon", "SELECT 1;  ", 1},
+		{"stacked", "SELECT 1; DROP TABLE users", 2},
+		{"empty statements", ";; SELECT 1;;", 1},
+		{"semicolon in string", "SELECT ';DROP TABLE users'", 1},
+		{"semicolon in comments", "SELECT 1 -- ; DROP TABLE users\n/* ; DELETE FROM t */", 1},
+		{"comment hides nothing", "SELECT 1 /* x */; DROP TABLE users", 2},
+		{"dollar-quoted body", "DO $$ BEGIN DELETE FROM users; DROP TABLE t; END $$", 1},
+		{"unsupported statements", "VACUUM users; GRANT ALL ON users TO bob", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CountStatements(tt.query)
+			if err != nil {
+				t.Fatalf("CountStatements(%q) error = %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("CountStatements(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	analysis, err := NewSQLAnalyzer().Analyze("SELECT 1; SELECT 2")
+	if err != nil || analysis.Statements != 2 {
+		t.Errorf("Analyze().Statements = %+v, %v, want 2", analysis, err)
+	}
+}
@@ -0,0 +1,156 @@
+package security
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+)
+
+// keywordOperations are the analyzer operations a whitelist pattern pinned to a leading
+// keyword is meant to allow. Writes may read their sources (INSERT ... SELECT,
+// UPDATE ... FROM), so they grant SELECT too. Utility statements grant nothing.
+var keywordOperations = map[string][]string{
+	"select":   {"SELECT"},
+	"with":     {"SELECT"},
+	"values":   {"SELECT"},
+	"table":    {"SELECT"},
+	"explain":  {"SELECT"},
+	"insert":   {"INSERT", "SELECT"},
+	"update":   {"UPDATE", "SELECT"},
+	"delete":   {"DELETE", "SELECT"},
+	"create":   {"CREATE", "SELECT"},
+	"drop":     {"DROP"},
+	"alter":    {"ALTER"},
+	"truncate": {"TRUNCATE"},
+	"copy":     {"SELECT", "INSERT"},
+}
+
+// patternFlags matches a leading flag group such as (?i) or (?is)
+var patternFlags = regexp.MustCompile(`^\(\?[a-zA-Z]+\)`)
+
+// WhitelistOperations returns the operations granted by whitelist entries, judged by
+// the statement keyword each entry is anchored to (e.g. ^SELECT grants SELECT,
+// ^(INSERT|UPDATE) grants INSERT, UPDATE and SELECT). restricted is false when some
+// entry is not pinned to a known keyword (e.g. ".*" or "^SEL"); such a whitelist says
+// nothing about operations and the caller should not check them.
+func WhitelistOperations(whitelist []string) (operations map[string]bool, restricted bool) {
+	operations = make(map[string]bool)
+	for _, entry := range whitelist {
+		// An AND group is pinned as soon as one of its patterns is
+		pinned := false
+		for _, part := range authorization.PatternParts(entry) {
+			keywords, ok := leadingKeywords(part)
+			if !ok {
+				continue
+			}
+			pinned = true
+			for _, keyword := range keywords {
+				for _, op := range keywordOperations[keyword] {
+					operations[op] = true
+				}
+			}
+			break
+		}
+		if !pinned {
+			return nil, false
+		}
+	}
+	return operations, true
+}
+
+// leadingKeywords returns the statement keywords a pattern is anchored to: every
+// top-level alternative must start with ^ followed by a keyword or a group of
+// keyword alternatives
+func leadingKeywords(pattern string) ([]string, bool) {
+	pattern = patternFlags.ReplaceAllString(pattern, "")
+	var keywords []string
+	for _, branch := range splitAlternatives(pattern) {
+		branchKeywords, ok := branchKeywords(branch)
+		if !ok {
+			return nil, false
+		}
+		keywords = append(keywords, branchKeywords...)
+	}
+	return keywords, true
+}
+
+func branchKeywords(branch string) ([]string, bool) {
+	rest, ok := strings.CutPrefix(branch, "^")
+	if !ok {
+		return nil, false
+	}
+	for {
+		trimmed := strings.TrimLeft(rest, " ")
+		for _, space := range []string{`\s*`, `\s+`, `\s?`} {
+			trimmed = strings.TrimPrefix(trimmed, space)
+		}
+		if trimmed == rest {
+			break
+		}
+		rest = trimmed
+	}
+
+	var words []string
+	if group, ok := strings.CutPrefix(rest, "("); ok {
+		group = strings.TrimPrefix(group, "?:")
+		end := strings.IndexByte(group, ')')
+		if end < 0 {
+			return nil, false
+		}
+		words = strings.Split(group[:end], "|")
+		rest = group[end+1:]
+	} else {
+		end := 0
+		for end < len(rest) && isLetter(rest[end]) {
+			end++
+		}
+		words = []string{rest[:end]}
+		rest = rest[end:]
+	}
+
+	// A quantifier or more letters would make the keyword optional or partial
+	if rest != "" && (isLetter(rest[0]) || strings.ContainsRune("?*+{", rune(rest[0]))) {
+		return nil, false
+	}
+	keywords := make([]string, 0, len(words))
+	for _, word := range words {
+		keyword := strings.ToLower(word)
+		if keyword == "" || strings.IndexFunc(keyword, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+			return nil, false
+		}
+		if _, known := keywordOperations[keyword]; !known && !utilityStatements[keyword] {
+			return nil, false
+		}
+		keywords = append(keywords, keyword)
+	}
+	return keywords, true
+}
+
+// splitAlternatives splits a pattern on its top-level | (outside groups and classes)
+func splitAlternatives(pattern string) []string {
+	var branches []string
+	depth, start, inClass := 0, 0, false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			branches = append(branches, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(branches, pattern[start:])
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
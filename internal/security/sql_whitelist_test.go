@@ -0,0 +1,49 @@
+package security
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/davidcohan/port-authorizing/internal/authorization"
+)
+
+func TestWhitelistOperations(t *testing.T) {
+	tests := []struct {
+		name           string
+		whitelist      []string
+		wantOps        string
+		wantRestricted bool
+	}{
+		{"select prefix", []string{"^SELECT.*"}, "SELECT", true},
+		{"case and flags", []string{`(?i)^\s*select\s+.*`}, "SELECT", true},
+		{"keyword group", []string{`^(INSERT|UPDATE)\s`}, "INSERT, SELECT, UPDATE", true},
+		{"non-capturing group", []string{`^(?:DELETE)\b`}, "DELETE, SELECT", true},
+		{"top-level alternatives", []string{"^EXPLAIN.*|^TRUNCATE.*"}, "SELECT, TRUNCATE", true},
+		{"utility keyword grants nothing", []string{"^SHOW.*", "^SELECT.*"}, "SELECT", true},
+		{"all-of group pinned by one part", []string{authorization.AllOfPattern([]string{".*users.*", "^SELECT"})}, "SELECT", true},
+		{"match anything", []string{"^SELECT.*", ".*"}, "", false},
+		{"not anchored", []string{"SELECT.*"}, "", false},
+		{"partial keyword", []string{"^SEL.*"}, "", false},
+		{"optional keyword", []string{"^(SELECT)?.*"}, "", false},
+		{"unanchored alternative", []string{"^SELECT.*|DROP"}, "", false},
+		{"unknown keyword", []string{"^VACUUM"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, restricted := WhitelistOperations(tt.whitelist)
+			if restricted != tt.wantRestricted {
+				t.Fatalf("WhitelistOperations(%q) restricted = %v, want %v", tt.whitelist, restricted, tt.wantRestricted)
+			}
+			var got []string
+			for op := range ops {
+				got = append(got, op)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != tt.wantOps {
+				t.Errorf("WhitelistOperations(%q) = %v, want %s", tt.whitelist, got, tt.wantOps)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/davidcohan/port-authorizing/internal/authorization"
 )
 
 // SubqueryValidationResult represents the result of validating a subquery
@@ -90,14 +92,14 @@ func (v *SubqueryValidator) ValidateSubquery(subquery PLSQLSubQuery, whitelist [
 
 	// Check each whitelist pattern
 	for _, pattern := range whitelist {
-		// Compile with case-insensitive flag
-		re, err := regexp.Compile("(?i)" + pattern)
+		// Case-insensitive; AND groups from whitelist_mode "all" policies must match entirely
+		matched, err := authorization.MatchPattern(pattern, subquery.Query)
 		if err != nil {
 			result.Error = fmt.Sprintf("invalid whitelist pattern: %s", pattern)
 			continue
 		}
 
-		if re.MatchString(subquery.Query) {
+		if matched {
 			result.IsAllowed = true
 			result.MatchedBy = pattern
 			return result
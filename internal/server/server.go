@@ -1,14 +1,17 @@
 package server
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/davidcohan/port-authorizing/internal/api"
 	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/davidcohan/port-authorizing/internal/logging"
+	"github.com/davidcohan/port-authorizing/internal/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -27,48 +30,72 @@ func RunServer(cmd *cobra.Command, args []string) error {
 	// Load configuration
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Server logs are separate from the audit log
+	if err := logging.Configure(cfg.Logging.LogLevel, cfg.Logging.LogFormat); err != nil {
+		return fmt.Errorf("invalid logging configuration: %w", err)
+	}
+	logger := logging.Component("server")
+
+	// Export traces when observability.otlp_endpoint is set (a no-op otherwise)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Observability)
+	if err != nil {
+		return fmt.Errorf("invalid observability configuration: %w", err)
 	}
 
 	// Create and start server
 	server, err := api.NewServer(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		logger.Error("failed to create server", "error", err)
+		os.Exit(1)
 	}
 
 	// Load the latest configuration from storage backend if configured
 	if cfg.Storage != nil {
-		log.Println("Loading latest configuration from storage backend...")
+		logger.Info("loading latest configuration from storage backend", "storage", cfg.Storage.Type)
 		latestCfg, err := server.LoadConfigFromStorage()
 		if err != nil {
-			log.Printf("Warning: Failed to load config from storage backend: %v", err)
-			log.Println("Using initial configuration from file")
+			logger.Warn("failed to load config from storage backend, using initial configuration from file", "error", err)
 		} else {
-			log.Println("Successfully loaded configuration from storage backend")
+			logger.Info("loaded configuration from storage backend")
 			// Reload the server with the latest config
 			if err := server.ReloadConfig(latestCfg); err != nil {
-				log.Printf("Warning: Failed to reload config: %v", err)
+				logger.Warn("failed to reload config", "error", err)
 			}
 		}
 	}
 
+	// Follow changes made to the stored configuration outside this server
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if cfg.Storage != nil {
+		go server.WatchStorage(watchCtx)
+	}
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		<-sigChan
-		log.Println("Shutting down gracefully...")
+		sig := <-sigChan
+		logger.Info("shutting down gracefully", "signal", sig.String())
+		stopWatch()
 		if err := server.Shutdown(); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+			logger.Error("error during shutdown", "error", err)
+		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Warn("failed to flush traces", "error", err)
 		}
 		os.Exit(0)
 	}()
 
 	// Start server
-	log.Printf("Starting API server on port %d", cfg.Server.Port)
+	logger.Info("starting API server", "port", cfg.Server.Port)
 	if err := server.Start(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		logger.Error("server error", "error", err)
+		os.Exit(1)
 	}
 
 	return nil
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// RunValidate loads and validates a configuration file without starting the server
+func RunValidate(cmd *cobra.Command, args []string) error {
+	configPath, _ := cmd.Flags().GetString("config")
+
+	problems := validateConfigFile(configPath)
+	out := cmd.OutOrStdout()
+	if len(problems) == 0 {
+		_, _ = fmt.Fprintf(out, "%s: configuration is valid\n", configPath)
+		return nil
+	}
+
+	for _, problem := range problems {
+		_, _ = fmt.Fprintf(out, "  - %s\n", problem)
+	}
+
+	cmd.SilenceUsage = true
+	return fmt.Errorf("%s: %d configuration problem(s) found", configPath, len(problems))
+}
+
+// validateConfigFile returns every problem found in a configuration file
+func validateConfigFile(configPath string) []string {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	if err := config.Validate(cfg); err != nil {
+		var validationErrs config.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			for _, v := range validationErrs {
+				problems = append(problems, v.Error())
+			}
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// Dry-run storage backend initialization (nothing is read or written)
+	if cfg.Storage != nil {
+		if err := checkStorageBackend(cfg.Storage); err != nil {
+			problems = append(problems, fmt.Sprintf("storage: %v", err))
+		}
+	}
+
+	return problems
+}
+
+// checkStorageBackend initializes the configured storage backend without loading or saving
+func checkStorageBackend(storageCfg *config.StorageConfig) error {
+	if _, err := config.NewStorageBackend(storageCfg); err != nil {
+		return err
+	}
+
+	// The file backend creates its file lazily, so check the directory it will write to
+	if storageCfg.Type == "" || storageCfg.Type == "file" {
+		path := storageCfg.Path
+		if path == "" {
+			path = "config.yaml"
+		}
+		dir := filepath.Dir(path)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("file backend directory %s: %w", dir, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("file backend directory %s is not a directory", dir)
+		}
+	}
+
+	return nil
+}
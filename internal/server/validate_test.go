@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func newValidateTestCmd(configPath string) (*cobra.Command, *bytes.Buffer) {
+	cmd := &cobra.Command{Use: "validate", RunE: RunValidate}
+	cmd.Flags().String("config", configPath, "")
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	return cmd, out
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		wantErr  bool
+		wantText []string
+	}{
+		{
+			name: "valid config",
+			config: `
+auth:
+  jwt_secret: secret
+  users:
+    - username: admin
+      password: admin
+      roles: [admin]
+connections:
+  - name: pg
+    type: postgres
+    host: localhost
+    port: 5432
+policies:
+  - name: admins
+    roles: [admin]
+    tags: [env:dev]
+`,
+			wantText: []string{"configuration is valid"},
+		},
+		{
+			name: "invalid config lists every problem",
+			config: `
+auth:
+  jwt_secret: ""
+connections:
+  - name: pg
+    type: mysql
+    host: localhost
+    port: 5432
+    whitelist: ["^SELECT ("]
+`,
+			wantErr:  true,
+			wantText: []string{"auth.jwt_secret", "connections[0].type", "connections[0].whitelist[0]"},
+		},
+		{
+			name: "storage backend dry run",
+			config: `
+auth:
+  jwt_secret: secret
+storage:
+  type: file
+  path: /nonexistent-dir/config.yaml
+`,
+			wantErr:  true,
+			wantText: []string{"storage: file backend directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, out := newValidateTestCmd(writeTestConfig(t, tt.config))
+
+			err := cmd.RunE(cmd, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunValidate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, text := range tt.wantText {
+				if !strings.Contains(out.String(), text) {
+					t.Errorf("output = %q, want it to contain %q", out.String(), text)
+				}
+			}
+		})
+	}
+}
+
+func TestRunValidate_MissingFile(t *testing.T) {
+	cmd, _ := newValidateTestCmd(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Error("RunValidate() error = nil, want error for missing file")
+	}
+}
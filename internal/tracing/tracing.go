@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+const (
+	// instrumentationName identifies the spans created by this package
+	instrumentationName = "github.com/davidcohan/port-authorizing"
+	// defaultServiceName is used when observability.service_name is not set
+	defaultServiceName = "port-authorizing"
+)
+
+// Setup installs an OTLP/HTTP trace exporter as the global tracer provider
+// Without an observability.otlp_endpoint tracing stays a no-op. The returned function
+// flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg *config.ObservabilityConfig) (func(context.Context) error, error) {
+	if cfg == nil || cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	sampleRate := cfg.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx (if any)
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail records err on the span and marks it as failed
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Middleware continues a trace from an incoming traceparent header (e.g., sent by the CLI)
+// Handlers start their spans from the request context, so they join the caller's trace.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// TraceID returns the ID of the trace in ctx, or "" if there is none
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Annotate adds the trace ID from ctx to audit metadata so audit events can be matched to traces
+// Metadata is returned unchanged when there is no trace.
+func Annotate(ctx context.Context, metadata map[string]interface{}) map[string]interface{} {
+	traceID := TraceID(ctx)
+	if traceID == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["trace_id"] = traceID
+	return metadata
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/davidcohan/port-authorizing/internal/config"
+)
+
+// useRecorder installs a tracer provider that records spans in memory for the test
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func TestSetup_Unconfigured(t *testing.T) {
+	provider := otel.GetTracerProvider()
+
+	for _, cfg := range []*config.ObservabilityConfig{nil, {SampleRate: 0.5}} {
+		shutdown, err := Setup(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("Setup(%v) error = %v", cfg, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutdown() error = %v", err)
+		}
+	}
+
+	if otel.GetTracerProvider() != provider {
+		t.Error("Setup() replaced the tracer provider without an otlp_endpoint")
+	}
+
+	// Spans are no-ops and carry no trace ID
+	ctx, span := Start(context.Background(), "auth.login")
+	defer span.End()
+	if span.IsRecording() || TraceID(ctx) != "" {
+		t.Error("span recorded without tracing configured")
+	}
+	if metadata := Annotate(ctx, map[string]interface{}{"connection_id": "conn-1"}); len(metadata) != 1 {
+		t.Errorf("Annotate() = %v, want metadata unchanged", metadata)
+	}
+}
+
+func TestMiddleware_ContinuesTrace(t *testing.T) {
+	recorder := useRecorder(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var metadata map[string]interface{}
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(r.Context(), "proxy.connect")
+		defer span.End()
+		Fail(span, errors.New("backend unreachable"))
+		metadata = Annotate(ctx, nil)
+	}))
+
+	req := httptest.NewRequest("POST", "/api/connect/db", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if metadata["trace_id"] != traceID {
+		t.Errorf("audit trace_id = %v, want %s", metadata["trace_id"], traceID)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "proxy.connect" || span.SpanContext().TraceID().String() != traceID {
+		t.Errorf("span = %s in trace %s, want proxy.connect in %s", span.Name(), span.SpanContext().TraceID(), traceID)
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span parent = %s, want the caller's span", span.Parent().SpanID())
+	}
+	if span.Status().Code != codes.Error || len(span.Events()) != 1 {
+		t.Errorf("span status = %v with %d events, want error recorded", span.Status(), len(span.Events()))
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -23,6 +28,8 @@ type WebhookPayload struct {
 	RequestedAt  string            `json:"requested_at"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
 	ApprovalURL  string            `json:"approval_url"`
+	ApproveURL   string            `json:"approve_url"` // Signed when approval.webhook.secret is set
+	RejectURL    string            `json:"reject_url"`
 }
 
 var (
@@ -33,6 +40,7 @@ var (
 	approveDelay = flag.Duration("delay", 0, "Delay before approving (e.g., 2s, 1m)")
 	approverName = flag.String("approver", "mock-server", "Name of the approver")
 	verbose      = flag.Bool("verbose", true, "Verbose logging")
+	secret       = flag.String("secret", "", "Shared secret to verify X-PA-Signature (approval.webhook.secret)")
 )
 
 func main() {
@@ -76,9 +84,22 @@ func handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	// Verify the payload came from the API server
+	if *secret != "" && !validSignature(body, r.Header.Get("X-PA-Signature")) {
+		log.Printf("❌ Rejected webhook with invalid X-PA-Signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
 	// Parse webhook payload
 	var payload WebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	if err := json.Unmarshal(body, &payload); err != nil {
 		log.Printf("❌ Failed to parse webhook payload: %v", err)
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
@@ -118,12 +139,12 @@ func handleWebhook(w http.ResponseWriter, r *http.Request) {
 			log.Printf("⏳ Waiting %v before approving...", *approveDelay)
 			time.Sleep(*approveDelay)
 		}
-		go approveRequest(payload.RequestID, *approverName, "auto-approved")
+		go approveRequest(payload, *approverName, "auto-approved")
 	} else {
 		// Manual mode - just log URLs
 		log.Println("⏸️  Auto-approve disabled. Manual approval required.")
-		log.Printf("   Approve URL: %s%s/approve", *apiURL, payload.ApprovalURL)
-		log.Printf("   Reject URL:  %s%s/reject", *apiURL, payload.ApprovalURL)
+		log.Printf("   Approve URL: %s", callbackURL(payload, "approve", *approverName, ""))
+		log.Printf("   Reject URL:  %s", callbackURL(payload, "reject", *approverName, ""))
 	}
 
 	if !*interactive {
@@ -132,9 +153,34 @@ func handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func approveRequest(requestID, approver, reason string) {
-	approvalURL := fmt.Sprintf("%s/api/approvals/%s/approve?approver=%s&reason=%s",
-		*apiURL, requestID, approver, reason)
+// validSignature checks the HMAC-SHA256 signature of a webhook body
+func validSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(*secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// callbackURL builds the approve or reject URL from the (possibly signed) link in the payload
+func callbackURL(payload WebhookPayload, action, approver, reason string) string {
+	link := payload.ApproveURL
+	if action == "reject" {
+		link = payload.RejectURL
+	}
+	if link == "" {
+		link = fmt.Sprintf("/api/approvals/%s/%s?channel=webhook", payload.RequestID, action)
+	}
+
+	query := url.Values{"approver": {approver}}
+	if reason != "" {
+		query.Set("reason", reason)
+	}
+	return *apiURL + link + "&" + query.Encode()
+}
+
+func approveRequest(payload WebhookPayload, approver, reason string) {
+	requestID := payload.RequestID
+	approvalURL := callbackURL(payload, "approve", approver, reason)
 
 	if *verbose {
 		log.Printf("🔄 Sending approval to: %s", approvalURL)
@@ -154,9 +200,9 @@ func approveRequest(requestID, approver, reason string) {
 	}
 }
 
-func rejectRequest(requestID, approver, reason string) {
-	rejectURL := fmt.Sprintf("%s/api/approvals/%s/reject?approver=%s&reason=%s",
-		*apiURL, requestID, approver, reason)
+func rejectRequest(payload WebhookPayload, approver, reason string) {
+	requestID := payload.RequestID
+	rejectURL := callbackURL(payload, "reject", approver, reason)
 
 	if *verbose {
 		log.Printf("🔄 Sending rejection to: %s", rejectURL)
@@ -202,12 +248,12 @@ func promptForApproval(payload WebhookPayload) {
 
 		switch input {
 		case "approve", "a", "yes", "y":
-			approveRequest(payload.RequestID, *approverName, "approved-interactively")
+			approveRequest(payload, *approverName, "approved-interactively")
 			fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 			return
 
 		case "reject", "r", "no", "n":
-			rejectRequest(payload.RequestID, *approverName, "rejected-interactively")
+			rejectRequest(payload, *approverName, "rejected-interactively")
 			fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 			return
 